@@ -0,0 +1,37 @@
+#!/bin/bash
+
+# Downloads the ADOT collector layer into ./opt, which the Dockerfile copies
+# to /opt in the image. Container-image functions can't use layers, so the
+# extension is part of the image instead.
+
+set -e
+
+SCRIPT_DIR="$(cd "$(dirname "${BASH_SOURCE[0]}")" && pwd)"
+cd "$SCRIPT_DIR"
+
+if [ -f ../.env ]; then
+    export $(grep -v '^#' ../.env | xargs)
+fi
+if [ -f .env ]; then
+    export $(grep -v '^#' .env | xargs)
+fi
+
+if [ -z "$OTEL_LAYER_ARN" ]; then
+  echo "Error: OTEL_LAYER_ARN is not set. See .env.example"
+  exit 1
+fi
+
+echo "📦 Downloading $OTEL_LAYER_ARN..."
+URL=$(aws lambda get-layer-version-by-arn \
+    --arn "$OTEL_LAYER_ARN" \
+    --region "$AWS_REGION" \
+    --query 'Content.Location' \
+    --output text)
+curl -sSfL "$URL" -o layer.zip
+
+rm -rf opt
+unzip -q layer.zip -d opt
+rm -f layer.zip
+
+echo "✅ Extension unpacked into ./opt:"
+ls -R opt | head -20
@@ -0,0 +1,132 @@
+// The container-image variant of the Go Lambda example. The function runs
+// from a container image with the OpenTelemetry collector extension copied
+// into it, and exports traces and metrics to the extension on localhost.
+//
+// Its configuration comes from flags, which the image's command sets in the
+// SAM template or Terraform:
+//
+//	bootstrap -otlp-protocol=http/protobuf -otlp-endpoint=http://localhost:4318
+//
+// OTEL_EXPORTER_OTLP_ENDPOINT in the function's environment is the Last9
+// endpoint the extension forwards to, not the function's own endpoint.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
+)
+
+// MyEvent represents the input event structure
+type MyEvent struct {
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+// MyResponse represents the output response structure
+type MyResponse struct {
+	StatusCode int    `json:"statusCode"`
+	Body       string `json:"body"`
+}
+
+// HandleRequest is your Lambda function handler
+func HandleRequest(ctx context.Context, event MyEvent) (MyResponse, error) {
+	log.Printf("Received event: Name=%s, Message=%s", event.Name, event.Message)
+
+	if event.Name == "" {
+		return MyResponse{}, errors.New("name is required")
+	}
+
+	// Your business logic here
+	responseBody := fmt.Sprintf("Hello %s! Your message was: %s", event.Name, event.Message)
+
+	return MyResponse{StatusCode: 200, Body: responseBody}, nil
+}
+
+// config is the function's telemetry configuration.
+type config struct {
+	serviceName string
+	// protocol is the OTLP protocol to the extension: http/protobuf or grpc
+	protocol string
+	// endpoint is the extension's OTLP receiver, such as
+	// http://localhost:4318, without a signal path
+	endpoint string
+	// flushTimeout bounds the flush at the end of each invocation
+	flushTimeout time.Duration
+}
+
+// parseConfig reads the flags in args. The service name and protocol fall
+// back to OTEL_SERVICE_NAME and OTEL_EXPORTER_OTLP_PROTOCOL, and the
+// endpoint to the extension's receiver for the protocol.
+func parseConfig(args []string) (config, error) {
+	var cfg config
+	fs := flag.NewFlagSet("bootstrap", flag.ContinueOnError)
+	fs.StringVar(&cfg.serviceName, "service-name", getEnv("OTEL_SERVICE_NAME", "go-lambda-container-example"),
+		"service.name of the function's telemetry (OTEL_SERVICE_NAME)")
+	fs.StringVar(&cfg.protocol, "otlp-protocol", getEnv("OTEL_EXPORTER_OTLP_PROTOCOL", "http/protobuf"),
+		"OTLP protocol to the extension, http/protobuf or grpc (OTEL_EXPORTER_OTLP_PROTOCOL)")
+	fs.StringVar(&cfg.endpoint, "otlp-endpoint", "",
+		"OTLP endpoint of the extension, by default http://localhost:4318, or http://localhost:4317 for grpc")
+	fs.DurationVar(&cfg.flushTimeout, "flush-timeout", 2*time.Second,
+		"how long the flush at the end of an invocation may take")
+	if err := fs.Parse(args); err != nil {
+		return config{}, err
+	}
+
+	switch cfg.protocol {
+	case "http/protobuf":
+		if cfg.endpoint == "" {
+			cfg.endpoint = "http://localhost:4318"
+		}
+	case "grpc":
+		if cfg.endpoint == "" {
+			cfg.endpoint = "http://localhost:4317"
+		}
+	default:
+		return config{}, fmt.Errorf("unsupported OTLP protocol %q, use http/protobuf or grpc", cfg.protocol)
+	}
+	return cfg, nil
+}
+
+func main() {
+	cfg, err := parseConfig(os.Args[1:])
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+
+	// Initialize tracer and meter providers
+	tel, err := initTelemetry(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("Failed to initialize telemetry: %v", err)
+	}
+	log.Printf("Exporting telemetry to %s over %s", cfg.endpoint, cfg.protocol)
+
+	// Ensure telemetry is flushed on shutdown
+	defer func() {
+		if err := tel.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down telemetry: %v", err)
+		}
+	}()
+
+	// Wrap the handler with OpenTelemetry instrumentation. The Flusher sends
+	// the invocation's spans and its duration to the extension before
+	// Lambda freezes the environment
+	lambda.Start(otellambda.InstrumentHandler(
+		measure(tel.invokeDuration, HandleRequest),
+		otellambda.WithFlusher(tel),
+	))
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	lambdadetector "go.opentelemetry.io/contrib/detectors/aws/lambda"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// telemetry holds the function's providers. It is the otellambda Flusher,
+// so both are flushed at the end of each invocation.
+type telemetry struct {
+	tp             *sdktrace.TracerProvider
+	mp             *sdkmetric.MeterProvider
+	flushTimeout   time.Duration
+	invokeDuration metric.Float64Histogram
+}
+
+func initTelemetry(ctx context.Context, cfg config) (*telemetry, error) {
+	// The Lambda detector adds faas.name, faas.version, faas.instance and
+	// cloud.region. service.instance.id is the execution environment, so
+	// the metrics of concurrent environments are separate series
+	res, err := resource.New(ctx,
+		resource.WithDetectors(lambdadetector.NewResourceDetector()),
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			semconv.ServiceName(cfg.serviceName),
+			semconv.ServiceInstanceID(getEnv("AWS_LAMBDA_LOG_STREAM_NAME", "local")),
+		),
+	)
+	if err != nil {
+		// The resource has what was detected, and the detector fails
+		// outside Lambda, such as in a local run
+		log.Printf("Resource detection: %v", err)
+	}
+
+	spanExporter, metricExporter, err := newExporters(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	// The environment is frozen between invocations, so the reader's own
+	// interval rarely fires: the metrics go out with each flush instead
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{}))
+
+	invokeDuration, err := mp.Meter("go-lambda-otel-example").Float64Histogram("faas.invoke_duration",
+		metric.WithDescription("Measures the duration of the function's logic execution"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create histogram: %w", err)
+	}
+
+	return &telemetry{tp: tp, mp: mp, flushTimeout: cfg.flushTimeout, invokeDuration: invokeDuration}, nil
+}
+
+// newExporters returns the span and metric exporters for cfg.protocol. The
+// http/protobuf endpoint is a base URL, like OTEL_EXPORTER_OTLP_ENDPOINT,
+// so each signal's path is added to it.
+func newExporters(ctx context.Context, cfg config) (sdktrace.SpanExporter, sdkmetric.Exporter, error) {
+	if cfg.protocol == "grpc" {
+		spanExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithEndpointURL(cfg.endpoint))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+		}
+		metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithEndpointURL(cfg.endpoint))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+		}
+		return spanExporter, metricExporter, nil
+	}
+
+	spanExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpointURL(cfg.endpoint+"/v1/traces"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpointURL(cfg.endpoint+"/v1/metrics"))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP metric exporter: %w", err)
+	}
+	return spanExporter, metricExporter, nil
+}
+
+// ForceFlush sends the spans and metrics of the invocation to the extension,
+// which forwards them to Last9. otellambda calls it after each invocation.
+func (t *telemetry) ForceFlush(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, t.flushTimeout)
+	defer cancel()
+	return errors.Join(t.tp.ForceFlush(ctx), t.mp.ForceFlush(ctx))
+}
+
+func (t *telemetry) Shutdown(ctx context.Context) error {
+	return errors.Join(t.tp.Shutdown(ctx), t.mp.Shutdown(ctx))
+}
+
+// coldStart is true until the first invocation of the execution environment
+// has started.
+var coldStart atomic.Bool
+
+func init() { coldStart.Store(true) }
+
+// measure records the duration of each invocation of handler in
+// faas.invoke_duration, with faas.coldstart, and error.type for failed
+// invocations.
+func measure[In, Out any](h metric.Float64Histogram, handler func(context.Context, In) (Out, error)) func(context.Context, In) (Out, error) {
+	return func(ctx context.Context, in In) (Out, error) {
+		cold := coldStart.Swap(false)
+		start := time.Now()
+		out, err := handler(ctx, in)
+
+		attrs := []attribute.KeyValue{semconv.FaaSColdstart(cold)}
+		if err != nil {
+			attrs = append(attrs, semconv.ErrorTypeOther)
+		}
+		h.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+		return out, err
+	}
+}
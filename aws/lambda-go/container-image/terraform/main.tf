@@ -0,0 +1,100 @@
+# Go Lambda from a container image, with the OpenTelemetry collector
+# extension. Push the image built from ../Dockerfile to ECR, then:
+#
+#   terraform init
+#   terraform apply -var image_uri=<account>.dkr.ecr.<region>.amazonaws.com/go-lambda-container:latest
+
+terraform {
+  required_providers {
+    aws = {
+      source  = "hashicorp/aws"
+      version = ">= 5.0"
+    }
+  }
+}
+
+variable "function_name" {
+  type    = string
+  default = "go-lambda-container"
+}
+
+variable "image_uri" {
+  type        = string
+  description = "ECR image URI of the function"
+}
+
+variable "otlp_protocol" {
+  type        = string
+  default     = "http/protobuf"
+  description = "OTLP protocol from the function to the extension: http/protobuf or grpc"
+
+  validation {
+    condition     = contains(["http/protobuf", "grpc"], var.otlp_protocol)
+    error_message = "otlp_protocol must be http/protobuf or grpc."
+  }
+}
+
+variable "last9_otlp_endpoint" {
+  type        = string
+  description = "Last9 OTLP endpoint the extension forwards to"
+}
+
+variable "last9_auth_header" {
+  type        = string
+  sensitive   = true
+  description = "Authorization header value for Last9, such as \"Basic ...\""
+}
+
+locals {
+  # The extension's receiver for the protocol
+  otlp_endpoint = var.otlp_protocol == "grpc" ? "http://localhost:4317" : "http://localhost:4318"
+}
+
+resource "aws_iam_role" "lambda" {
+  name = "${var.function_name}-role"
+  assume_role_policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [{
+      Effect    = "Allow"
+      Principal = { Service = "lambda.amazonaws.com" }
+      Action    = "sts:AssumeRole"
+    }]
+  })
+}
+
+resource "aws_iam_role_policy_attachment" "logs" {
+  role       = aws_iam_role.lambda.name
+  policy_arn = "arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"
+}
+
+resource "aws_lambda_function" "this" {
+  function_name = var.function_name
+  role          = aws_iam_role.lambda.arn
+  package_type  = "Image"
+  image_uri     = var.image_uri
+  architectures = ["x86_64"]
+  memory_size   = 256
+  timeout       = 30
+
+  image_config {
+    # The Go flags of the function
+    command = [
+      "-service-name=${var.function_name}",
+      "-otlp-protocol=${var.otlp_protocol}",
+      "-otlp-endpoint=${local.otlp_endpoint}",
+      "-flush-timeout=2s",
+    ]
+  }
+
+  environment {
+    variables = {
+      OTEL_EXPORTER_OTLP_ENDPOINT              = var.last9_otlp_endpoint
+      OTEL_EXPORTER_OTLP_HEADERS_AUTHORIZATION = var.last9_auth_header
+      OTEL_RESOURCE_ATTRIBUTES                 = "deployment.environment=production"
+    }
+  }
+}
+
+output "function_name" {
+  value = aws_lambda_function.this.function_name
+}
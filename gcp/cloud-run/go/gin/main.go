@@ -5,11 +5,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -18,12 +20,15 @@ import (
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	otellog "go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
 var (
 	tracer           trace.Tracer
+	logger           otellog.Logger
 	meter            metric.Meter
 	requestCounter   metric.Int64Counter
 	requestLatency   metric.Float64Histogram
@@ -33,10 +38,10 @@ var (
 
 // User represents a user entity
 type User struct {
-	ID        int       `json:"id"`
-	Name      string    `json:"name"`
-	Email     string    `json:"email"`
-	CreatedAt time.Time `json:"created_at,omitempty"`
+	ID        int       `json:"id" firestore:"id"`
+	Name      string    `json:"name" firestore:"name"`
+	Email     string    `json:"email" firestore:"email"`
+	CreatedAt time.Time `json:"created_at,omitempty" firestore:"created_at,omitempty"`
 }
 
 // LogEntry represents a structured log entry for Cloud Logging
@@ -44,21 +49,19 @@ type LogEntry struct {
 	Severity   string                 `json:"severity"`
 	Message    string                 `json:"message"`
 	Timestamp  string                 `json:"timestamp"`
-	Service    string                 `json:"service,omitempty"`
-	Revision   string                 `json:"revision,omitempty"`
 	Trace      string                 `json:"logging.googleapis.com/trace,omitempty"`
 	SpanID     string                 `json:"logging.googleapis.com/spanId,omitempty"`
 	Extra      map[string]interface{} `json:"extra,omitempty"`
 }
 
-// structuredLog outputs a JSON-formatted log entry with trace correlation
+// structuredLog outputs a JSON-formatted log entry with trace correlation,
+// and emits the same entry as an OpenTelemetry log record
 func structuredLog(ctx context.Context, level, message string, extra map[string]interface{}) {
+	now := time.Now()
 	entry := LogEntry{
 		Severity:  level,
 		Message:   message,
-		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
-		Service:   os.Getenv("K_SERVICE"),
-		Revision:  os.Getenv("K_REVISION"),
+		Timestamp: now.UTC().Format(time.RFC3339Nano),
 		Extra:     extra,
 	}
 
@@ -74,6 +77,61 @@ func structuredLog(ctx context.Context, level, message string, extra map[string]
 
 	jsonBytes, _ := json.Marshal(entry)
 	fmt.Println(string(jsonBytes))
+
+	emitLogRecord(ctx, now, level, message, extra)
+}
+
+// severities maps Cloud Logging severities to OpenTelemetry's
+var severities = map[string]otellog.Severity{
+	"DEBUG":     otellog.SeverityDebug,
+	"INFO":      otellog.SeverityInfo,
+	"NOTICE":    otellog.SeverityInfo2,
+	"WARNING":   otellog.SeverityWarn,
+	"ERROR":     otellog.SeverityError,
+	"CRITICAL":  otellog.SeverityFatal,
+	"ALERT":     otellog.SeverityFatal2,
+	"EMERGENCY": otellog.SeverityFatal3,
+}
+
+// emitLogRecord sends a log entry through the OpenTelemetry logs SDK. The
+// SDK takes the trace and span IDs from ctx, so the record is correlated
+// with the span in Last9 the way the logging.googleapis.com/trace field
+// correlates the stdout entry in Cloud Logging.
+func emitLogRecord(ctx context.Context, t time.Time, level, message string, extra map[string]interface{}) {
+	if logger == nil {
+		return
+	}
+
+	var record otellog.Record
+	record.SetTimestamp(t)
+	record.SetSeverity(severities[level])
+	record.SetSeverityText(level)
+	record.SetBody(otellog.StringValue(message))
+	for k, v := range extra {
+		record.AddAttributes(logAttribute(k, v))
+	}
+
+	logger.Emit(ctx, record)
+}
+
+// logAttribute converts an extra field of a log entry to a log attribute
+func logAttribute(key string, value interface{}) otellog.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return otellog.String(key, v)
+	case bool:
+		return otellog.Bool(key, v)
+	case int:
+		return otellog.Int(key, v)
+	case int64:
+		return otellog.Int64(key, v)
+	case float64:
+		return otellog.Float64(key, v)
+	case error:
+		return otellog.String(key, v.Error())
+	default:
+		return otellog.String(key, fmt.Sprint(v))
+	}
 }
 
 func initMetrics() {
@@ -153,7 +211,7 @@ func coldStartMiddleware() gin.HandlerFunc {
 
 func main() {
 	// Initialize OpenTelemetry
-	tp, mp := initTelemetry()
+	tp, mp, lp, metricsHandler := initTelemetry()
 	defer func() {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -170,12 +228,44 @@ func main() {
 				"error": err.Error(),
 			})
 		}
+		// Last, so the errors above are still exported
+		if err := lp.Shutdown(ctx); err != nil {
+			structuredLog(ctx, "ERROR", "Error shutting down logger provider", map[string]interface{}{
+				"error": err.Error(),
+			})
+		}
 	}()
 
-	// Initialize tracer and metrics
+	// Initialize tracer, logger and metrics
 	tracer = otel.Tracer("cloud-run-gin")
+	logger = global.Logger("cloud-run-gin")
 	initMetrics()
 
+	// Users are kept in Firestore when FIRESTORE_COLLECTION is set
+	var err error
+	store, err = initFirestore(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to create Firestore client: %v", err)
+	}
+	if store != nil {
+		defer store.client.Close()
+	}
+
+	// Scaling pressure from the latency and concurrency of the API routes,
+	// recomputed every 5s; probes and the pressure endpoint don't count
+	pressure := newPressureTracker()
+	pressure.registerMetrics(meter)
+	pressureCtx, stopPressure := context.WithCancel(context.Background())
+	defer stopPressure()
+	go pressure.run(pressureCtx)
+	scaled := func(route string) bool {
+		switch route {
+		case "", "/health", "/ready", "/scaling", "/metrics":
+			return false
+		}
+		return true
+	}
+
 	// Set up Gin
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.New()
@@ -185,15 +275,21 @@ func main() {
 	r.Use(coldStartMiddleware())  // Detect cold starts before tracing
 	r.Use(otelgin.Middleware(os.Getenv("OTEL_SERVICE_NAME")))
 	r.Use(metricsMiddleware())
+	r.Use(pressure.middleware(scaled))
 
 	// Routes
 	r.GET("/", homeHandler)
 	r.GET("/users", getUsersHandler)
 	r.GET("/users/:id", getUserHandler)
+	r.GET("/users/:id/posts", getUserPostsHandler)
 	r.POST("/users", createUserHandler)
 	r.GET("/error", errorHandler)
 	r.GET("/health", healthHandler)
 	r.GET("/ready", readyHandler)
+	r.GET("/scaling", pressure.handler)
+	if metricsHandler != nil {
+		r.GET("/metrics", gin.WrapH(metricsHandler))
+	}
 
 	// Start server
 	port := os.Getenv("PORT")
@@ -273,7 +369,7 @@ func getUserHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 	idParam := c.Param("id")
 
-	_, span := tracer.Start(ctx, "fetch_user_by_id",
+	ctx, span := tracer.Start(ctx, "fetch_user_by_id",
 		trace.WithAttributes(
 			attribute.String("db.system", "postgresql"),
 			attribute.String("db.operation", "SELECT"),
@@ -292,12 +388,28 @@ func getUserHandler(c *gin.Context) {
 
 	span.SetAttributes(attribute.Int("user.id", userID))
 
-	// Simulate user lookup
+	// Simulate user lookup, unless users are kept in Firestore
 	user := User{
 		ID:    userID,
 		Name:  fmt.Sprintf("User %d", userID),
 		Email: fmt.Sprintf("user%d@example.com", userID),
 	}
+	if store != nil {
+		var err error
+		user, err = store.get(ctx, userID)
+		if errors.Is(err, errUserNotFound) {
+			structuredLog(ctx, "WARNING", fmt.Sprintf("User %d not found", userID), nil)
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Firestore lookup failed")
+			structuredLog(ctx, "ERROR", fmt.Sprintf("Failed to get user %d", userID), map[string]interface{}{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get user"})
+			return
+		}
+	}
 
 	structuredLog(ctx, "INFO", fmt.Sprintf("Retrieved user %d", userID), nil)
 
@@ -307,7 +419,7 @@ func getUserHandler(c *gin.Context) {
 func createUserHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
-	_, span := tracer.Start(ctx, "create_user",
+	ctx, span := tracer.Start(ctx, "create_user",
 		trace.WithAttributes(
 			attribute.String("db.system", "postgresql"),
 			attribute.String("db.operation", "INSERT"),
@@ -335,6 +447,15 @@ func createUserHandler(c *gin.Context) {
 	}
 
 	span.SetAttributes(attribute.Int("user.id", newUser.ID))
+	if store != nil {
+		if err := store.create(ctx, newUser); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "Firestore write failed")
+			structuredLog(ctx, "ERROR", "Failed to create user", map[string]interface{}{"error": err.Error()})
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
+			return
+		}
+	}
 	span.AddEvent("User created successfully")
 
 	structuredLog(ctx, "INFO", fmt.Sprintf("Created user %d", newUser.ID), map[string]interface{}{"userName": input.Name})
@@ -342,6 +463,28 @@ func createUserHandler(c *gin.Context) {
 	c.JSON(http.StatusCreated, newUser)
 }
 
+func getUserPostsHandler(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	userID, err := strconv.Atoi(c.Param("id"))
+	if err != nil || userID <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	// The HTTP client span is a child of the server span
+	posts, err := fetchPosts(ctx, userID)
+	if err != nil {
+		structuredLog(ctx, "ERROR", fmt.Sprintf("Failed to fetch posts of user %d", userID), map[string]interface{}{"error": err.Error()})
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to fetch posts"})
+		return
+	}
+
+	structuredLog(ctx, "INFO", fmt.Sprintf("Fetched %d posts of user %d", len(posts), userID), nil)
+
+	c.JSON(http.StatusOK, posts)
+}
+
 func errorHandler(c *gin.Context) {
 	ctx := c.Request.Context()
 
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/baggage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errUserNotFound is returned by the user store for a user it doesn't have
+var errUserNotFound = errors.New("user not found")
+
+// httpClient makes the outbound HTTP calls. otelhttp's transport starts a
+// client span for each request and injects the trace context, and the
+// baggage, into its headers
+var httpClient = &http.Client{
+	Transport: otelhttp.NewTransport(http.DefaultTransport,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return "HTTP " + r.Method + " " + r.URL.Host
+		}),
+	),
+	Timeout: 10 * time.Second,
+}
+
+// Post is a post from the external API
+type Post struct {
+	ID     int    `json:"id"`
+	UserID int    `json:"userId"`
+	Title  string `json:"title"`
+}
+
+// fetchPosts gets a user's posts from the public API at EXTERNAL_API_URL,
+// JSONPlaceholder by default
+func fetchPosts(ctx context.Context, userID int) ([]Post, error) {
+	base := strings.TrimSuffix(getEnvOrDefault("EXTERNAL_API_URL", "https://jsonplaceholder.typicode.com"), "/")
+	req, err := http.NewRequestWithContext(revisionBaggage(ctx), http.MethodGet,
+		fmt.Sprintf("%s/posts?userId=%d", base, userID), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("external API: %s", resp.Status)
+	}
+	var posts []Post
+	if err := json.NewDecoder(resp.Body).Decode(&posts); err != nil {
+		return nil, fmt.Errorf("external API: %w", err)
+	}
+	return posts, nil
+}
+
+// revisionBaggage adds the Cloud Run service and revision to ctx's baggage,
+// so the services this one calls can tell which revision a call came from.
+// The resource already has them for this service's own telemetry
+func revisionBaggage(ctx context.Context) context.Context {
+	bag := baggage.FromContext(ctx)
+	for key, env := range map[string]string{
+		"cloud_run.service":  "K_SERVICE",
+		"cloud_run.revision": "K_REVISION",
+	} {
+		value := os.Getenv(env)
+		if value == "" {
+			continue
+		}
+		member, err := baggage.NewMember(key, value)
+		if err != nil {
+			continue
+		}
+		if b, err := bag.SetMember(member); err == nil {
+			bag = b
+		}
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// userStore keeps users in the Firestore collection FIRESTORE_COLLECTION.
+// When it isn't set, users are simulated as before. The Firestore client
+// traces itself with the global tracer provider: a span per operation,
+// with a gRPC client span under it for each RPC
+type userStore struct {
+	client *firestore.Client
+	users  *firestore.CollectionRef
+}
+
+// store is nil unless FIRESTORE_COLLECTION is set
+var store *userStore
+
+// initFirestore connects to Firestore when FIRESTORE_COLLECTION is set. The
+// project is GOOGLE_CLOUD_PROJECT, or detected from the credentials, and
+// FIRESTORE_EMULATOR_HOST points the client at the emulator
+func initFirestore(ctx context.Context) (*userStore, error) {
+	collection := os.Getenv("FIRESTORE_COLLECTION")
+	if collection == "" {
+		return nil, nil
+	}
+
+	project := getEnvOrDefault("GOOGLE_CLOUD_PROJECT", firestore.DetectProjectID)
+	client, err := firestore.NewClientWithDatabase(ctx, project,
+		getEnvOrDefault("FIRESTORE_DATABASE", firestore.DefaultDatabaseID))
+	if err != nil {
+		return nil, err
+	}
+	return &userStore{client: client, users: client.Collection(collection)}, nil
+}
+
+func (s *userStore) get(ctx context.Context, id int) (User, error) {
+	doc, err := s.users.Doc(strconv.Itoa(id)).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return User{}, errUserNotFound
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	var user User
+	if err := doc.DataTo(&user); err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
+
+func (s *userStore) create(ctx context.Context, user User) error {
+	_, err := s.users.Doc(strconv.Itoa(user.ID)).Create(ctx, user)
+	return err
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// scalingInterval is how often the scaling pressure is recomputed
+const scalingInterval = 5 * time.Second
+
+// scalingSmoothing is the weight of the newest interval in the smoothed
+// concurrency and latency; the rest is the previous value. It keeps one
+// slow request from swinging the pressure
+const scalingSmoothing = 0.5
+
+// pressureTracker turns the requests this instance serves into one scaling
+// signal. The pressure is the larger of two ratios:
+//
+//   - concurrency: requests being served at once, over the target
+//     concurrency
+//   - latency: mean request latency, over the target latency
+//
+// 1 means the instance is at its target, above 1 that the service needs
+// more instances, and well below 1 that it has too many
+type pressureTracker struct {
+	targetConcurrency float64
+	targetLatency     time.Duration
+
+	inFlight atomic.Int64
+
+	mu sync.Mutex
+	// requests and busy are the requests finished in the current interval,
+	// and the time spent serving them
+	requests int64
+	busy     time.Duration
+
+	// The smoothed values, published every interval; math.Float64bits
+	// so reads don't take the lock
+	concurrency atomic.Uint64
+	latency     atomic.Uint64
+	pressure    atomic.Uint64
+}
+
+func newPressureTracker() *pressureTracker {
+	p := &pressureTracker{
+		targetConcurrency: 80,
+		targetLatency:     250 * time.Millisecond,
+	}
+	if n, err := strconv.Atoi(os.Getenv("SCALING_TARGET_CONCURRENCY")); err == nil && n > 0 {
+		p.targetConcurrency = float64(n)
+	}
+	if d, err := time.ParseDuration(os.Getenv("SCALING_TARGET_LATENCY")); err == nil && d > 0 {
+		p.targetLatency = d
+	}
+	return p
+}
+
+// middleware counts the requests of the routes in scaled, and records the
+// pressure at the start of each on its span as scaling.pressure, so a slow
+// trace shows whether the instance was overloaded at the time. Add it after
+// otelgin, so the span exists
+func (p *pressureTracker) middleware(scaled func(route string) bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !scaled(c.FullPath()) {
+			c.Next()
+			return
+		}
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(
+			attribute.Float64("scaling.pressure", p.Pressure()))
+
+		p.inFlight.Add(1)
+		start := time.Now()
+		c.Next()
+		elapsed := time.Since(start)
+		p.inFlight.Add(-1)
+
+		p.mu.Lock()
+		p.requests++
+		p.busy += elapsed
+		p.mu.Unlock()
+	}
+}
+
+// run recomputes the pressure every scalingInterval until ctx is done
+func (p *pressureTracker) run(ctx context.Context) {
+	ticker := time.NewTicker(scalingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.update(scalingInterval)
+		}
+	}
+}
+
+func (p *pressureTracker) update(interval time.Duration) {
+	p.mu.Lock()
+	requests, busy := p.requests, p.busy
+	p.requests, p.busy = 0, 0
+	p.mu.Unlock()
+
+	// Little's law: the time spent serving requests over the interval is
+	// the mean number served at once. Requests still running aren't in busy
+	// yet, so the current count is a floor
+	concurrency := math.Max(busy.Seconds()/interval.Seconds(), float64(p.inFlight.Load()))
+	var latency float64
+	if requests > 0 {
+		latency = busy.Seconds() / float64(requests)
+	}
+
+	concurrency = smooth(loadFloat(&p.concurrency), concurrency)
+	latency = smooth(loadFloat(&p.latency), latency)
+	storeFloat(&p.concurrency, concurrency)
+	storeFloat(&p.latency, latency)
+	storeFloat(&p.pressure, math.Max(
+		concurrency/p.targetConcurrency,
+		latency/p.targetLatency.Seconds()))
+}
+
+// Pressure returns the latest scaling pressure
+func (p *pressureTracker) Pressure() float64 {
+	return loadFloat(&p.pressure)
+}
+
+// registerMetrics exports the pressure and its inputs as gauges
+func (p *pressureTracker) registerMetrics(meter metric.Meter) {
+	pressure, err := meter.Float64ObservableGauge(
+		"scaling.pressure",
+		metric.WithDescription("Load over target capacity; above 1 means scale out"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		log.Printf("Failed to create scaling pressure gauge: %v", err)
+		return
+	}
+	concurrency, err := meter.Float64ObservableGauge(
+		"scaling.concurrency",
+		metric.WithDescription("Smoothed mean number of requests served at once"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		log.Printf("Failed to create scaling concurrency gauge: %v", err)
+		return
+	}
+	latency, err := meter.Float64ObservableGauge(
+		"scaling.latency",
+		metric.WithDescription("Smoothed mean request latency"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Printf("Failed to create scaling latency gauge: %v", err)
+		return
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(pressure, p.Pressure())
+		o.ObserveFloat64(concurrency, loadFloat(&p.concurrency))
+		o.ObserveFloat64(latency, loadFloat(&p.latency))
+		return nil
+	}, pressure, concurrency, latency)
+	if err != nil {
+		log.Printf("Failed to register scaling gauges: %v", err)
+	}
+}
+
+// handler serves the pressure to external autoscalers: JSON by default,
+// for a KEDA metrics-api scaler, or the Prometheus text format with
+// ?format=prometheus
+func (p *pressureTracker) handler(c *gin.Context) {
+	pressure := p.Pressure()
+	concurrency := loadFloat(&p.concurrency)
+	latency := loadFloat(&p.latency)
+
+	if c.Query("format") == "prometheus" {
+		body := fmt.Sprintf(`# HELP scaling_pressure Load over target capacity; above 1 means scale out
+# TYPE scaling_pressure gauge
+scaling_pressure %g
+# HELP scaling_concurrency Smoothed mean number of requests served at once
+# TYPE scaling_concurrency gauge
+scaling_concurrency %g
+# HELP scaling_latency_seconds Smoothed mean request latency
+# TYPE scaling_latency_seconds gauge
+scaling_latency_seconds %g
+`, pressure, concurrency, latency)
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(body))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"pressure":               pressure,
+		"concurrency":            concurrency,
+		"target_concurrency":     p.targetConcurrency,
+		"latency_seconds":        latency,
+		"target_latency_seconds": p.targetLatency.Seconds(),
+		"in_flight":              p.inFlight.Load(),
+	})
+}
+
+func smooth(previous, current float64) float64 {
+	return scalingSmoothing*current + (1-scalingSmoothing)*previous
+}
+
+func loadFloat(v *atomic.Uint64) float64 {
+	return math.Float64frombits(v.Load())
+}
+
+func storeFloat(v *atomic.Uint64, f float64) {
+	v.Store(math.Float64bits(f))
+}
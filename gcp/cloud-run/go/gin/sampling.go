@@ -0,0 +1,109 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// defaultExcludedRoutes are the routes left out of traces when
+// OTEL_TRACES_EXCLUDED_ROUTES is unset: Cloud Run's probes and the scrapes
+// of the Prometheus exporter
+var defaultExcludedRoutes = []string{"/health", "/ready", "/metrics"}
+
+// routePathKeys are the start attributes a server span's route or path may
+// be in, by semconv version
+var routePathKeys = []attribute.Key{"http.route", "url.path", "http.target"}
+
+// excludedRoutes returns the routes in OTEL_TRACES_EXCLUDED_ROUTES, a
+// comma-separated list, or defaultExcludedRoutes if it is unset. Set it empty
+// to trace every route.
+func excludedRoutes() map[string]bool {
+	list := defaultExcludedRoutes
+	if v, ok := os.LookupEnv("OTEL_TRACES_EXCLUDED_ROUTES"); ok {
+		list = strings.Split(v, ",")
+	}
+	routes := make(map[string]bool, len(list))
+	for _, r := range list {
+		if r = normalizeRoute(strings.TrimSpace(r)); r != "" {
+			routes[r] = true
+		}
+	}
+	return routes
+}
+
+// routeFilterSampler drops the server spans of excluded routes, so probe
+// traffic isn't exported and paid for, and leaves every other decision to
+// base. It wraps the whole sampler, so probes are dropped even with a
+// sampled traceparent; spans started under a dropped span are dropped by
+// the parent-based base.
+type routeFilterSampler struct {
+	routes map[string]bool
+	base   sdktrace.Sampler
+}
+
+func (s routeFilterSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Kind == trace.SpanKindServer && len(s.routes) > 0 {
+		for _, kv := range p.Attributes {
+			for _, k := range routePathKeys {
+				if kv.Key != k {
+					continue
+				}
+				path, _, _ := strings.Cut(kv.Value.AsString(), "?")
+				if s.routes[normalizeRoute(path)] {
+					return sdktrace.SamplingResult{
+						Decision:   sdktrace.Drop,
+						Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+					}
+				}
+			}
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s routeFilterSampler) Description() string {
+	return "RouteFilter{" + s.base.Description() + "}"
+}
+
+// normalizeRoute drops a trailing slash, except from the root, so /health/
+// is excluded along with /health
+func normalizeRoute(path string) string {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
+
+// envSampler returns the sampler named by OTEL_TRACES_SAMPLER, with the ratio
+// in OTEL_TRACES_SAMPLER_ARG, as the SDK would pick it on its own:
+// parentbased_always_on by default. Passing a sampler to the provider stops
+// the SDK from reading them.
+func envSampler() sdktrace.Sampler {
+	ratio := 1.0
+	if r, err := strconv.ParseFloat(os.Getenv("OTEL_TRACES_SAMPLER_ARG"), 64); err == nil && r >= 0 && r <= 1 {
+		ratio = r
+	}
+	switch name := os.Getenv("OTEL_TRACES_SAMPLER"); name {
+	case "always_on":
+		return sdktrace.AlwaysSample()
+	case "always_off":
+		return sdktrace.NeverSample()
+	case "traceidratio":
+		return sdktrace.TraceIDRatioBased(ratio)
+	case "parentbased_always_off":
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case "parentbased_traceidratio":
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+	case "", "parentbased_always_on":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	default:
+		log.Printf("unknown OTEL_TRACES_SAMPLER %q, using parentbased_always_on", name)
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+}
@@ -2,16 +2,29 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
 
+	"cloud.google.com/go/compute/metadata"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/detectors/gcp"
 	"go.opentelemetry.io/contrib/instrumentation/runtime"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/log/global"
 	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
@@ -39,7 +52,8 @@ func parseOTLPHeaders() map[string]string {
 	return headers
 }
 
-// createCloudRunResource creates a resource with Cloud Run-specific attributes
+// createCloudRunResource creates a resource with Cloud Run-specific attributes,
+// from the GCP resource detector and cloudRunDetector
 func createCloudRunResource(ctx context.Context) (*resource.Resource, error) {
 	serviceName := os.Getenv("OTEL_SERVICE_NAME")
 	if serviceName == "" {
@@ -49,26 +63,69 @@ func createCloudRunResource(ctx context.Context) (*resource.Resource, error) {
 		serviceName = "go-cloud-run"
 	}
 
-	return resource.New(ctx,
+	res, err := resource.New(ctx,
 		resource.WithFromEnv(),
 		resource.WithTelemetrySDK(),
+		// Cloud Run specific attributes. The GCP detector reads the
+		// metadata server, so it only adds them on Google Cloud, where its
+		// values win over cloudRunDetector's
+		resource.WithDetectors(cloudRunDetector{}, gcp.NewDetector()),
 		resource.WithAttributes(
 			semconv.ServiceName(serviceName),
 			semconv.ServiceVersion(getEnvOrDefault("SERVICE_VERSION", "1.0.0")),
 			semconv.DeploymentEnvironment(getEnvOrDefault("DEPLOYMENT_ENVIRONMENT", "production")),
-			// Cloud Run specific attributes
-			semconv.CloudProviderGCP,
-			semconv.CloudPlatformGCPCloudRun,
-			semconv.CloudRegion(getEnvOrDefault("CLOUD_RUN_REGION", getEnvOrDefault("GOOGLE_CLOUD_REGION", "unknown"))),
-			semconv.CloudAccountID(getEnvOrDefault("GOOGLE_CLOUD_PROJECT", "unknown")),
-			// FaaS attributes
-			semconv.FaaSName(getEnvOrDefault("K_SERVICE", serviceName)),
-			semconv.FaaSVersion(getEnvOrDefault("K_REVISION", "unknown")),
-			semconv.FaaSInstance(getEnvOrDefault("K_REVISION", "unknown")),
-			// Service instance
-			semconv.ServiceInstanceID(getEnvOrDefault("K_REVISION", "local")),
 		),
 	)
+	// A partial resource still has what could be detected
+	if errors.Is(err, resource.ErrPartialResource) {
+		log.Printf("Resource detection: %v", err)
+		err = nil
+	}
+	return res, err
+}
+
+// cloudRunConfigurationKey is the Cloud Run configuration the revision was
+// created from. Semantic conventions have no attribute for it
+const cloudRunConfigurationKey = attribute.Key("gcp.cloud_run.configuration")
+
+// cloudRunDetector detects the Cloud Run service, revision and
+// configuration from the K_SERVICE, K_REVISION and K_CONFIGURATION
+// variables Cloud Run sets, and a service.instance.id unique to the
+// instance: the instance ID from the metadata server, or a random UUID off
+// Google Cloud. Every instance of a revision would otherwise report the
+// same service, so series of instance-level metrics, such as
+// scaling.pressure, would collide.
+type cloudRunDetector struct{}
+
+func (cloudRunDetector) Detect(ctx context.Context) (*resource.Resource, error) {
+	instanceID := uuid.NewString()
+	if metadata.OnGCE() {
+		id, err := metadata.InstanceIDWithContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		instanceID = id
+	}
+	attrs := []attribute.KeyValue{semconv.ServiceInstanceID(instanceID)}
+
+	service := os.Getenv("K_SERVICE")
+	if service == "" {
+		return resource.NewSchemaless(attrs...), nil
+	}
+	attrs = append(attrs,
+		semconv.CloudProviderGCP,
+		semconv.CloudPlatformGCPCloudRun,
+		semconv.FaaSName(service),
+		semconv.FaaSVersion(os.Getenv("K_REVISION")),
+		cloudRunConfigurationKey.String(os.Getenv("K_CONFIGURATION")),
+	)
+	if region := getEnvOrDefault("CLOUD_RUN_REGION", os.Getenv("GOOGLE_CLOUD_REGION")); region != "" {
+		attrs = append(attrs, semconv.CloudRegion(region))
+	}
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		attrs = append(attrs, semconv.CloudAccountID(project))
+	}
+	return resource.NewSchemaless(attrs...), nil
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -78,8 +135,10 @@ func getEnvOrDefault(key, defaultValue string) string {
 	return defaultValue
 }
 
-// initTelemetry initializes OpenTelemetry tracing and metrics
-func initTelemetry() (*sdktrace.TracerProvider, *metric.MeterProvider) {
+// initTelemetry initializes OpenTelemetry tracing, metrics and logs. The
+// handler serves the metrics in the Prometheus format, and is nil unless
+// METRICS_EXPORTER=prometheus.
+func initTelemetry() (*sdktrace.TracerProvider, *metric.MeterProvider, *sdklog.LoggerProvider, http.Handler) {
 	ctx := context.Background()
 
 	// Create resource
@@ -109,9 +168,11 @@ func initTelemetry() (*sdktrace.TracerProvider, *metric.MeterProvider) {
 		panic(err)
 	}
 
-	// Create trace provider with batch processor
+	// Create trace provider with batch processor. The sampler drops the spans
+	// of OTEL_TRACES_EXCLUDED_ROUTES (default /health, /ready, /metrics)
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithResource(res),
+		sdktrace.WithSampler(routeFilterSampler{routes: excludedRoutes(), base: envSampler()}),
 		sdktrace.WithBatcher(traceExporter,
 			sdktrace.WithBatchTimeout(5*time.Second),
 			sdktrace.WithMaxExportBatchSize(512),
@@ -125,22 +186,19 @@ func initTelemetry() (*sdktrace.TracerProvider, *metric.MeterProvider) {
 		propagation.Baggage{},
 	))
 
-	// Initialize metric exporter
-	metricExporter, err := otlpmetrichttp.New(ctx,
-		otlpmetrichttp.WithEndpoint(endpoint),
-		otlpmetrichttp.WithHeaders(headers),
-		otlpmetrichttp.WithURLPath("/v1/metrics"),
-	)
+	// Metrics are pushed over OTLP, or served for scraping with
+	// METRICS_EXPORTER=prometheus
+	reader, metricsHandler, err := newMetricReader(ctx, endpoint, headers)
 	if err != nil {
 		panic(err)
 	}
 
-	// Create meter provider
+	// Create meter provider. The views set the latency histograms'
+	// aggregation, and rename and trim the outbound request duration
 	mp := metric.NewMeterProvider(
 		metric.WithResource(res),
-		metric.WithReader(metric.NewPeriodicReader(metricExporter,
-			metric.WithInterval(60*time.Second),
-		)),
+		metric.WithReader(reader),
+		metric.WithView(metricViews()...),
 	)
 	otel.SetMeterProvider(mp)
 
@@ -150,5 +208,69 @@ func initTelemetry() (*sdktrace.TracerProvider, *metric.MeterProvider) {
 		log.Printf("Failed to start runtime instrumentation: %v", err)
 	}
 
-	return tp, mp
+	// Logs are pushed over OTLP, besides the JSON lines structuredLog
+	// writes to stdout for Cloud Logging
+	logOptions, err := newLogProcessors(ctx, endpoint, headers)
+	if err != nil {
+		panic(err)
+	}
+
+	// Create logger provider
+	lp := sdklog.NewLoggerProvider(append(logOptions, sdklog.WithResource(res))...)
+	global.SetLoggerProvider(lp)
+
+	return tp, mp, lp, metricsHandler
+}
+
+// newMetricReader returns the meter provider's reader for METRICS_EXPORTER:
+// by default, or with otlp, a periodic reader pushing to the OTLP endpoint
+// every 60s; with prometheus, the OpenTelemetry Prometheus exporter, read
+// on every scrape of the returned handler. The instruments are the same
+// either way.
+func newMetricReader(ctx context.Context, endpoint string, headers map[string]string) (metric.Reader, http.Handler, error) {
+	switch exporter := strings.ToLower(os.Getenv("METRICS_EXPORTER")); exporter {
+	case "", "otlp":
+		metricExporter, err := otlpmetrichttp.New(ctx,
+			otlpmetrichttp.WithEndpoint(endpoint),
+			otlpmetrichttp.WithHeaders(headers),
+			otlpmetrichttp.WithURLPath("/v1/metrics"),
+		)
+		if err != nil {
+			return nil, nil, err
+		}
+		return metric.NewPeriodicReader(metricExporter, metric.WithInterval(60*time.Second)), nil, nil
+	case "prometheus":
+		// Its own registry, so /metrics serves only what the meter
+		// provider records, without client_golang's Go collector
+		registry := prometheus.NewRegistry()
+		reader, err := otelprom.New(otelprom.WithRegisterer(registry))
+		if err != nil {
+			return nil, nil, err
+		}
+		return reader, promhttp.HandlerFor(registry, promhttp.HandlerOpts{}), nil
+	default:
+		return nil, nil, fmt.Errorf("METRICS_EXPORTER %q: want otlp or prometheus", exporter)
+	}
+}
+
+// newLogProcessors returns the logger provider's processors for
+// LOGS_EXPORTER: by default, or with otlp, a batch processor pushing to the
+// OTLP endpoint; with none, no processor, so logs only reach stdout.
+func newLogProcessors(ctx context.Context, endpoint string, headers map[string]string) ([]sdklog.LoggerProviderOption, error) {
+	switch exporter := strings.ToLower(os.Getenv("LOGS_EXPORTER")); exporter {
+	case "", "otlp":
+		logExporter, err := otlploghttp.New(ctx,
+			otlploghttp.WithEndpoint(endpoint),
+			otlploghttp.WithHeaders(headers),
+			otlploghttp.WithURLPath("/v1/logs"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return []sdklog.LoggerProviderOption{sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter))}, nil
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("LOGS_EXPORTER %q: want otlp or none", exporter)
+	}
 }
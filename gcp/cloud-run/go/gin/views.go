@@ -0,0 +1,75 @@
+package main
+
+import (
+	"log"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/instrumentation"
+	"go.opentelemetry.io/otel/sdk/metric"
+)
+
+// outboundDurationAttributes are the attributes kept on the outbound request
+// duration: enough to tell dependencies and failures apart. The port, the
+// URL scheme and the protocol version would only multiply the series
+var outboundDurationAttributes = []attribute.Key{
+	"http.request.method",
+	"server.address",
+	"http.response.status_code",
+	"error.type",
+}
+
+// latencyAggregation returns the aggregation of the request latency
+// histograms set by LATENCY_HISTOGRAM: nil for explicit, the default, which
+// keeps each instrument's own bucket boundaries, or a base-2 exponential
+// histogram for exponential.
+func latencyAggregation() metric.Aggregation {
+	switch v := strings.ToLower(os.Getenv("LATENCY_HISTOGRAM")); v {
+	case "", "explicit":
+		return nil
+	case "exponential":
+		// The SDK defaults: up to 160 buckets per sign, at the finest scale
+		// the recorded range allows
+		return metric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+	default:
+		log.Printf("unknown LATENCY_HISTOGRAM %q, using explicit", v)
+		return nil
+	}
+}
+
+// metricViews returns the meter provider's views. Each instrument matches at
+// most one of them: an instrument two views match is exported twice.
+//
+//   - http_request_duration_seconds gets the LATENCY_HISTOGRAM aggregation.
+//     Exponential buckets follow the latencies actually recorded, instead of
+//     the fixed boundaries, which are too coarse for a fast service and cut
+//     off at 10s for a slow one.
+//   - otelhttp's http.client.request.duration, the outbound calls, is
+//     renamed http_client_request_duration_seconds to sit next to the server
+//     histogram, keeps only outboundDurationAttributes, and gets the same
+//     aggregation.
+func metricViews() []metric.View {
+	agg := latencyAggregation()
+	views := []metric.View{
+		metric.NewView(
+			metric.Instrument{
+				Name:  "http.client.request.duration",
+				Scope: instrumentation.Scope{Name: otelhttp.ScopeName},
+			},
+			metric.Stream{
+				Name:            "http_client_request_duration_seconds",
+				Aggregation:     agg,
+				AttributeFilter: attribute.NewAllowKeysFilter(outboundDurationAttributes...),
+			},
+		),
+	}
+	if agg != nil {
+		views = append(views, metric.NewView(
+			metric.Instrument{Name: "http_request_duration_seconds"},
+			metric.Stream{Aggregation: agg},
+		))
+	}
+	return views
+}
@@ -0,0 +1,122 @@
+// Cloud Run Job with OpenTelemetry: each task processes its shard of a batch
+// under a root span, and flushes its traces and metrics to Last9 before exit.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Exit codes. A task that exits with any code but 0 fails, and Cloud Run
+// retries it up to the job's --max-retries. A task interrupted by a signal
+// exits with 128 plus the signal's number: 143 for SIGTERM.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitConfig = 2
+)
+
+// interruptedError is the cause of the task's context being canceled by a
+// signal, such as the SIGTERM Cloud Run sends when the task timeout passes.
+type interruptedError struct {
+	sig syscall.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return "interrupted by " + e.sig.String()
+}
+
+// exitCode is the exit code of a task that ended with err, where ctx is the
+// task's context.
+func exitCode(ctx context.Context, err error) int {
+	var interrupted *interruptedError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(context.Cause(ctx), &interrupted):
+		return 128 + int(interrupted.sig)
+	default:
+		return exitFailed
+	}
+}
+
+func main() {
+	// os.Exit skips deferred calls, so the flush is deferred in run, and
+	// run returns the exit code. Never call log.Fatal after initTelemetry:
+	// it exits without flushing.
+	os.Exit(run())
+}
+
+// run runs this task once and returns its exit code.
+func run() int {
+	task, err := taskEnvFromEnv()
+	if err != nil {
+		log.Print(err)
+		return exitConfig
+	}
+	w, err := newWorker(task)
+	if err != nil {
+		log.Printf("create worker: %v", err)
+		return exitConfig
+	}
+	if w.items, err = getEnvInt("JOB_ITEMS", 100); err != nil {
+		log.Print(err)
+		return exitConfig
+	}
+	if w.batchSize, err = getEnvInt("BATCH_SIZE", 10); err != nil || w.batchSize == 0 {
+		log.Printf("BATCH_SIZE: want a positive integer, got %q", os.Getenv("BATCH_SIZE"))
+		return exitConfig
+	}
+	if w.itemDelay, err = time.ParseDuration(getEnvOrDefault("ITEM_DELAY", "50ms")); err != nil {
+		log.Printf("ITEM_DELAY: %v", err)
+		return exitConfig
+	}
+	if w.failRate, err = strconv.ParseFloat(getEnvOrDefault("FAIL_RATE", "0"), 64); err != nil || w.failRate < 0 || w.failRate > 1 {
+		log.Printf("FAIL_RATE: want a probability from 0 to 1, got %q", os.Getenv("FAIL_RATE"))
+		return exitConfig
+	}
+	flushTimeout, err := time.ParseDuration(getEnvOrDefault("FLUSH_TIMEOUT", "5s"))
+	if err != nil {
+		log.Printf("FLUSH_TIMEOUT: %v", err)
+		return exitConfig
+	}
+
+	ctx := context.Background()
+	tel, err := initTelemetry(ctx, task)
+	if err != nil {
+		log.Printf("init telemetry: %v", err)
+		return exitConfig
+	}
+	defer func() {
+		// Runs after the task's root span has ended, also on failure and
+		// after SIGTERM, within FLUSH_TIMEOUT. Cloud Run sends SIGKILL 10s
+		// after SIGTERM, so keep it below that.
+		flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := tel.flush(flushCtx); err != nil {
+			log.Printf("telemetry flush: %v", err)
+		}
+	}()
+
+	// A signal cancels the task instead of killing the process, so the
+	// batch in progress ends its span with the reason and the task is
+	// flushed
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		if sig, ok := <-sigs; ok {
+			cancel(&interruptedError{sig: sig.(syscall.Signal)})
+		}
+	}()
+
+	return exitCode(ctx, w.run(ctx))
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/last9/opentelemetry-examples/gcp/cloud-run/go/job"
+
+// taskEnv is this task's place in the job execution, from the variables
+// Cloud Run sets on each task
+type taskEnv struct {
+	job       string
+	execution string
+	index     int
+	count     int
+	attempt   int
+}
+
+// taskEnvFromEnv reads CLOUD_RUN_JOB, CLOUD_RUN_EXECUTION and
+// CLOUD_RUN_TASK_INDEX, _COUNT and _ATTEMPT. Outside Cloud Run, the
+// defaults are a single task's first attempt.
+func taskEnvFromEnv() (taskEnv, error) {
+	t := taskEnv{
+		job:       os.Getenv("CLOUD_RUN_JOB"),
+		execution: getEnvOrDefault("CLOUD_RUN_EXECUTION", "local"),
+	}
+	var err error
+	if t.index, err = getEnvInt("CLOUD_RUN_TASK_INDEX", 0); err != nil {
+		return t, err
+	}
+	if t.count, err = getEnvInt("CLOUD_RUN_TASK_COUNT", 1); err != nil {
+		return t, err
+	}
+	if t.attempt, err = getEnvInt("CLOUD_RUN_TASK_ATTEMPT", 0); err != nil {
+		return t, err
+	}
+	if t.index >= t.count {
+		return t, fmt.Errorf("CLOUD_RUN_TASK_INDEX %d: want less than CLOUD_RUN_TASK_COUNT %d", t.index, t.count)
+	}
+	return t, nil
+}
+
+// shard is the range [start, end) of the job's items this task processes.
+// The tasks split the items evenly, in order of task index.
+func (t taskEnv) shard(items int) (start, end int) {
+	return items * t.index / t.count, items * (t.index + 1) / t.count
+}
+
+// worker processes one task's shard of the job's items, in batches
+type worker struct {
+	task      taskEnv
+	items     int
+	batchSize int
+	// itemDelay stands in for the work on each item
+	itemDelay time.Duration
+	// failRate is the probability an item fails, failing the task
+	failRate float64
+
+	tracer    trace.Tracer
+	processed metric.Int64Counter
+	duration  metric.Float64Histogram
+}
+
+func newWorker(task taskEnv) (*worker, error) {
+	meter := otel.Meter(scopeName)
+	processed, err := meter.Int64Counter("job.items.processed",
+		metric.WithDescription("Items processed by the job's tasks"),
+		metric.WithUnit("{item}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := meter.Float64Histogram("job.task.duration",
+		metric.WithDescription("Duration of task attempts, by outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &worker{
+		task:      task,
+		tracer:    otel.Tracer(scopeName),
+		processed: processed,
+		duration:  duration,
+	}, nil
+}
+
+// run processes the task's shard under the task's root span, with a child
+// span per batch, and a progress event on the root span after each batch.
+// It ends the root span before returning, so the span is complete when the
+// caller flushes.
+func (w *worker) run(ctx context.Context) error {
+	start, end := w.task.shard(w.items)
+	began := time.Now()
+	ctx, span := w.tracer.Start(ctx, "run_task", trace.WithAttributes(
+		semconv.GCPCloudRunJobExecution(w.task.execution),
+		semconv.GCPCloudRunJobTaskIndex(w.task.index),
+		taskCountKey.Int(w.task.count),
+		taskAttemptKey.Int(w.task.attempt),
+		attribute.Int("job.shard.start", start),
+		attribute.Int("job.shard.end", end),
+	))
+	defer span.End()
+
+	structuredLog(ctx, "INFO", fmt.Sprintf("Task %d of %d processing items %d to %d", w.task.index, w.task.count, start, end), map[string]interface{}{
+		"attempt": w.task.attempt,
+	})
+
+	var err error
+	processed := 0
+	for from := start; from < end && err == nil; from += w.batchSize {
+		to := min(from+w.batchSize, end)
+		var n int
+		n, err = w.processBatch(ctx, from, to)
+		processed += n
+
+		total := end - start
+		span.AddEvent("progress", trace.WithAttributes(
+			attribute.Int("job.items.processed", processed),
+			attribute.Int("job.items.total", total),
+			attribute.Float64("job.progress", float64(processed)/float64(total)),
+		))
+	}
+
+	// The span carries the exit code the process is about to exit with
+	code := exitCode(ctx, err)
+	outcome := outcomeOf(code)
+	span.SetAttributes(
+		attribute.Int("job.items.processed", processed),
+		attribute.String("task.outcome", outcome),
+		semconv.ProcessExitCode(code),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		structuredLog(ctx, "ERROR", fmt.Sprintf("Task %d stopped after %d items: %s", w.task.index, processed, outcome), map[string]interface{}{
+			"error":     err.Error(),
+			"exit_code": code,
+		})
+	} else {
+		structuredLog(ctx, "INFO", fmt.Sprintf("Task %d processed %d items", w.task.index, processed), nil)
+	}
+
+	w.duration.Record(ctx, time.Since(began).Seconds(),
+		metric.WithAttributes(attribute.String("task.outcome", outcome)))
+	return err
+}
+
+// processBatch processes items [from, to) under a span, and returns the
+// number it processed before an item failed or ctx was canceled
+func (w *worker) processBatch(ctx context.Context, from, to int) (int, error) {
+	ctx, span := w.tracer.Start(ctx, "process_batch", trace.WithAttributes(
+		attribute.Int("job.batch.start", from),
+		attribute.Int("job.batch.end", to),
+	))
+	defer span.End()
+
+	n := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("job.items.processed", n))
+		w.processed.Add(ctx, int64(n))
+	}()
+	for item := from; item < to; item++ {
+		select {
+		case <-time.After(w.itemDelay):
+		case <-ctx.Done():
+			err := fmt.Errorf("item %d: %w", item, context.Cause(ctx))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return n, err
+		}
+		if rand.Float64() < w.failRate {
+			err := fmt.Errorf("item %d: simulated failure", item)
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// outcomeOf is the task.outcome of a task that exits with code
+func outcomeOf(code int) string {
+	switch {
+	case code == exitOK:
+		return "success"
+	case code > 128:
+		return "interrupted"
+	default:
+		return "failure"
+	}
+}
+
+// LogEntry is a structured log entry for Cloud Logging. Cloud Run labels
+// each entry with the execution, task index and attempt.
+type LogEntry struct {
+	Severity  string                 `json:"severity"`
+	Message   string                 `json:"message"`
+	Timestamp string                 `json:"timestamp"`
+	Trace     string                 `json:"logging.googleapis.com/trace,omitempty"`
+	SpanID    string                 `json:"logging.googleapis.com/spanId,omitempty"`
+	Extra     map[string]interface{} `json:"extra,omitempty"`
+}
+
+// structuredLog outputs a JSON-formatted log entry with trace correlation
+func structuredLog(ctx context.Context, level, message string, extra map[string]interface{}) {
+	entry := LogEntry{
+		Severity:  level,
+		Message:   message,
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		Extra:     extra,
+	}
+
+	span := trace.SpanFromContext(ctx)
+	if span.SpanContext().IsValid() {
+		if projectID := os.Getenv("GOOGLE_CLOUD_PROJECT"); projectID != "" {
+			entry.Trace = fmt.Sprintf("projects/%s/traces/%s", projectID, span.SpanContext().TraceID())
+			entry.SpanID = span.SpanContext().SpanID().String()
+		}
+	}
+
+	jsonBytes, _ := json.Marshal(entry)
+	fmt.Println(string(jsonBytes))
+}
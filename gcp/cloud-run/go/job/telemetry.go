@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/contrib/detectors/gcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// Attributes of a task that semantic conventions have no attribute for
+const (
+	taskCountKey   = attribute.Key("gcp.cloud_run.job.task_count")
+	taskAttemptKey = attribute.Key("gcp.cloud_run.job.task_attempt")
+)
+
+// telemetry holds the providers, so the task can be flushed before exit
+type telemetry struct {
+	tp *sdktrace.TracerProvider
+	mp *sdkmetric.MeterProvider
+}
+
+// initTelemetry sets up tracing and metrics. The exporters read
+// OTEL_EXPORTER_OTLP_ENDPOINT and OTEL_EXPORTER_OTLP_HEADERS. A task usually
+// exits before a batch or an export interval ends, so most of what it
+// records is exported by flush.
+func initTelemetry(ctx context.Context, task taskEnv) (*telemetry, error) {
+	res, err := createCloudRunJobResource(ctx, task)
+	if err != nil {
+		return nil, fmt.Errorf("create resource: %w", err)
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP metric exporter: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	return &telemetry{tp: tp, mp: mp}, nil
+}
+
+// flush exports the spans and metrics recorded so far, then shuts the
+// providers down. ForceFlush reports export errors, so a task whose
+// telemetry was lost says so in its log.
+func (t *telemetry) flush(ctx context.Context) error {
+	return errors.Join(
+		t.tp.ForceFlush(ctx),
+		t.mp.ForceFlush(ctx),
+		t.tp.Shutdown(ctx),
+		t.mp.Shutdown(ctx),
+	)
+}
+
+// createCloudRunJobResource creates a resource with the task's place in the
+// job execution. Each task attempt is a process of its own, so the task
+// index and attempt are attributes of the resource, and every span and
+// metric of the process has them.
+func createCloudRunJobResource(ctx context.Context, task taskEnv) (*resource.Resource, error) {
+	serviceName := getEnvOrDefault("OTEL_SERVICE_NAME", getEnvOrDefault("CLOUD_RUN_JOB", "cloud-run-job"))
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		// The GCP detector reads the metadata server, so it only adds
+		// attributes on Google Cloud, where its values win
+		resource.WithDetectors(cloudRunJobDetector{task: task}, gcp.NewDetector()),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+			semconv.ServiceVersion(getEnvOrDefault("SERVICE_VERSION", "1.0.0")),
+			semconv.DeploymentEnvironmentName(getEnvOrDefault("DEPLOYMENT_ENVIRONMENT", "production")),
+		),
+	)
+	// A partial resource still has what could be detected
+	if errors.Is(err, resource.ErrPartialResource) {
+		log.Printf("Resource detection: %v", err)
+		err = nil
+	}
+	return res, err
+}
+
+// cloudRunJobDetector detects the job, execution and task from the
+// variables Cloud Run sets on each task. service.instance.id is the task
+// attempt, unique to the process.
+type cloudRunJobDetector struct {
+	task taskEnv
+}
+
+func (d cloudRunJobDetector) Detect(context.Context) (*resource.Resource, error) {
+	t := d.task
+	attrs := []attribute.KeyValue{
+		semconv.ServiceInstanceID(fmt.Sprintf("%s/%d/%d", t.execution, t.index, t.attempt)),
+		semconv.GCPCloudRunJobExecution(t.execution),
+		semconv.GCPCloudRunJobTaskIndex(t.index),
+		taskCountKey.Int(t.count),
+		taskAttemptKey.Int(t.attempt),
+	}
+	if t.job != "" {
+		attrs = append(attrs,
+			semconv.CloudProviderGCP,
+			semconv.CloudPlatformGCPCloudRun,
+			semconv.FaaSName(t.job),
+		)
+	}
+	if region := os.Getenv("CLOUD_RUN_REGION"); region != "" {
+		attrs = append(attrs, semconv.CloudRegion(region))
+	}
+	if project := os.Getenv("GOOGLE_CLOUD_PROJECT"); project != "" {
+		attrs = append(attrs, semconv.CloudAccountID(project))
+	}
+	return resource.NewSchemaless(attrs...), nil
+}
+
+func getEnvOrDefault(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// getEnvInt reads a non-negative integer variable
+func getEnvInt(key string, defaultValue int) (int, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: want a non-negative integer, got %q", key, value)
+	}
+	return n, nil
+}
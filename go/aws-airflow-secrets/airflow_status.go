@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/mwaa"
+	"github.com/aws/aws-sdk-go-v2/service/mwaa/document"
+	"github.com/aws/aws-sdk-go-v2/service/mwaa/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	dagRunPollInterval   = 2 * time.Second
+	defaultDagRunTimeout = 30 * time.Second
+	maxDagRunTimeout     = 5 * time.Minute
+	// dagRunRetention is how long triggered runs are remembered for linking
+	// status polls back to the trigger trace.
+	dagRunRetention = 24 * time.Hour
+)
+
+// useMockMWAA reports whether MWAA calls are simulated, for LocalStack or
+// when no AWS credentials are set.
+func useMockMWAA() bool {
+	return os.Getenv("AWS_ENDPOINT_URL_MWAA") != "" || os.Getenv("AWS_ACCESS_KEY_ID") == ""
+}
+
+// invokeAirflow calls the Airflow REST API of an MWAA environment through
+// MWAA's InvokeRestApi, so no web login token or Airflow URL is needed. path
+// is relative to /api/v1.
+func invokeAirflow(ctx context.Context, environmentName string, method types.RestApiMethod, path string, body map[string]interface{}) (map[string]interface{}, error) {
+	cfg, err := newAWSConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AWS config: %w", err)
+	}
+
+	input := &mwaa.InvokeRestApiInput{
+		Name:   aws.String(environmentName),
+		Method: method,
+		Path:   aws.String(path),
+	}
+	if body != nil {
+		input.Body = document.NewLazyDocument(body)
+	}
+
+	out, err := mwaa.NewFromConfig(cfg).InvokeRestApi(ctx, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp map[string]interface{}
+	if out.RestApiResponse != nil {
+		if err := out.RestApiResponse.UnmarshalSmithyDocument(&resp); err != nil {
+			return nil, fmt.Errorf("failed to decode Airflow response: %w", err)
+		}
+	}
+	return resp, nil
+}
+
+// dagRun is a DAG run triggered by this service.
+type dagRun struct {
+	EnvironmentName string
+	DagID           string
+	TriggeredAt     time.Time
+	// Trigger is the airflow.dag.trigger span. Status polls are recorded
+	// under it, so the run from trigger to completion is one trace.
+	Trigger trace.SpanContext
+	Mock    bool
+}
+
+// dagRunRegistry remembers triggered runs in memory.
+type dagRunRegistry struct {
+	mu   sync.Mutex
+	runs map[string]dagRun
+}
+
+var dagRuns = &dagRunRegistry{runs: make(map[string]dagRun)}
+
+func (r *dagRunRegistry) add(id string, run dagRun) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for k, v := range r.runs {
+		if time.Since(v.TriggeredAt) > dagRunRetention {
+			delete(r.runs, k)
+		}
+	}
+	r.runs[id] = run
+}
+
+func (r *dagRunRegistry) get(id string) (dagRun, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	run, ok := r.runs[id]
+	return run, ok
+}
+
+// mockDagRunState simulates a run that is queued for 3s, runs for 5s and
+// then succeeds.
+func mockDagRunState(run dagRun) string {
+	switch elapsed := time.Since(run.TriggeredAt); {
+	case elapsed < 3*time.Second:
+		return "queued"
+	case elapsed < 8*time.Second:
+		return "running"
+	default:
+		return "success"
+	}
+}
+
+func isTerminalDagRunState(state string) bool {
+	return state == "success" || state == "failed"
+}
+
+// fetchDagRunState returns the current state of a DAG run.
+func fetchDagRunState(ctx context.Context, run dagRun, dagRunID string) (string, error) {
+	if run.Mock {
+		return mockDagRunState(run), nil
+	}
+	resp, err := invokeAirflow(ctx, run.EnvironmentName, types.RestApiMethodGet,
+		fmt.Sprintf("/dags/%s/dagRuns/%s", run.DagID, dagRunID), nil)
+	if err != nil {
+		return "", err
+	}
+	state, _ := resp["state"].(string)
+	return state, nil
+}
+
+type dagRunStatus struct {
+	DagID    string `json:"dag_id"`
+	DagRunID string `json:"dag_run_id"`
+	State    string `json:"state"`
+	Attempts int    `json:"attempts"`
+	TimedOut bool   `json:"timed_out"`
+}
+
+// pollDagRun polls a DAG run until it finishes or timeout passes. With
+// wait false it checks the state once.
+//
+// The airflow.dag_run.poll span is a child of the trigger span when the run
+// was triggered by this service, and links to the span of the current
+// request. Each poll is a poll.attempt event on it.
+func pollDagRun(ctx context.Context, tracer trace.Tracer, run dagRun, dagRunID string, wait bool, timeout time.Duration) (*dagRunStatus, error) {
+	parent := ctx
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("airflow.environment", run.EnvironmentName),
+			attribute.String("airflow.dag_id", run.DagID),
+			attribute.String("airflow.dag_run.id", dagRunID),
+			attribute.Bool("airflow.poll.wait", wait),
+		),
+	}
+	if run.Trigger.IsValid() {
+		parent = trace.ContextWithRemoteSpanContext(ctx, run.Trigger)
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: trace.SpanContextFromContext(ctx)}))
+	}
+	pollCtx, span := tracer.Start(parent, "airflow.dag_run.poll", opts...)
+	defer span.End()
+
+	status := &dagRunStatus{DagID: run.DagID, DagRunID: dagRunID}
+	deadline := time.Now().Add(timeout)
+	for {
+		status.Attempts++
+		start := time.Now()
+		state, err := fetchDagRunState(pollCtx, run, dagRunID)
+		attrs := []attribute.KeyValue{
+			attribute.Int("poll.attempt", status.Attempts),
+			attribute.Int64("poll.duration_ms", time.Since(start).Milliseconds()),
+		}
+		if err != nil {
+			span.AddEvent("poll.attempt", trace.WithAttributes(append(attrs, attribute.String("error.message", err.Error()))...))
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "failed to fetch DAG run state")
+			return nil, err
+		}
+		span.AddEvent("poll.attempt", trace.WithAttributes(append(attrs, attribute.String("airflow.dag_run.state", state))...))
+		status.State = state
+
+		if isTerminalDagRunState(state) || !wait {
+			break
+		}
+		if time.Now().Add(dagRunPollInterval).After(deadline) {
+			status.TimedOut = true
+			span.AddEvent("poll.timeout")
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			span.RecordError(ctx.Err())
+			return nil, ctx.Err()
+		case <-time.After(dagRunPollInterval):
+		}
+	}
+
+	span.SetAttributes(
+		attribute.String("airflow.dag_run.state", status.State),
+		attribute.Int("airflow.poll.attempts", status.Attempts),
+		attribute.Bool("airflow.poll.timed_out", status.TimedOut),
+	)
+	if status.State == "failed" {
+		span.SetStatus(codes.Error, "DAG run failed")
+	}
+	return status, nil
+}
+
+// parseDagRunTimeout parses the timeout query parameter, capped at
+// maxDagRunTimeout.
+func parseDagRunTimeout(v string) (time.Duration, error) {
+	if v == "" {
+		return defaultDagRunTimeout, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid timeout %q", v)
+	}
+	if d > maxDagRunTimeout {
+		d = maxDagRunTimeout
+	}
+	return d, nil
+}
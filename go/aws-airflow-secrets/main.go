@@ -10,13 +10,20 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/mwaa"
+	"github.com/aws/aws-sdk-go-v2/service/mwaa/types"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/redact"
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
 	"go.opentelemetry.io/contrib/detectors/aws/ec2"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -31,15 +38,29 @@ func getServiceName() string {
 	return serviceName
 }
 
-func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
-	serviceName := getServiceName()
-	exporter, err := otlptracehttp.New(ctx)
+// secretRules mask the secret names that appear in request paths.
+var secretRules = []redact.Rule{
+	{Key: "url.path", Pattern: `(/secrets/)[^/?#]+`, Replacement: "${1}" + redact.Mask},
+	{Key: "url.full", Pattern: `(/secrets/)[^/?#]+`, Replacement: "${1}" + redact.Mask},
+}
+
+// newRedactor combines the default rules, the demo's secret rules and any
+// rules from REDACT_RULES or REDACT_RULES_FILE.
+func newRedactor() (*redact.Redactor, error) {
+	envRules, err := redact.RulesFromEnv()
 	if err != nil {
-		log.Fatalf("failed to create otlp http exporter: %v", err)
+		return nil, err
 	}
+	rules := append(append(append([]redact.Rule{}, redact.DefaultRules...), secretRules...), envRules...)
+	return redact.New(rules...)
+}
+
+func newResource(ctx context.Context) *resource.Resource {
+	serviceName := getServiceName()
 
 	// Use AWS resource detector if running on AWS
 	var res *resource.Resource
+	var err error
 	if os.Getenv("AWS_REGION") != "" && os.Getenv("AWS_ENDPOINT_URL_SECRETSMANAGER") == "" {
 		res, err = resource.New(ctx,
 			resource.WithDetectors(ec2.NewResourceDetector()),
@@ -69,6 +90,21 @@ func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
 	if err != nil {
 		log.Fatalf("failed to create resource: %v", err)
 	}
+	return res
+}
+
+func initTracerProvider(ctx context.Context, res *resource.Resource) *sdktrace.TracerProvider {
+	otlpExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp http exporter: %v", err)
+	}
+
+	// Mask sensitive attribute values before spans leave the process
+	redactor, err := newRedactor()
+	if err != nil {
+		log.Fatalf("failed to load redaction rules: %v", err)
+	}
+	exporter := redact.NewExporter(otlpExporter, redactor)
 
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
@@ -81,10 +117,24 @@ func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
 	return tp
 }
 
+func initMeterProvider(ctx context.Context, res *resource.Resource) *sdkmetric.MeterProvider {
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp metric exporter: %v", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	return mp
+}
+
 func newAWSConfig(ctx context.Context) (aws.Config, error) {
 	// Configure for LocalStack if endpoint is set
 	var opts []func(*config.LoadOptions) error
-	
+
 	if endpoint := os.Getenv("AWS_ENDPOINT_URL_SECRETSMANAGER"); endpoint != "" {
 		opts = append(opts, config.WithEndpointResolverWithOptions(
 			aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
@@ -96,79 +146,42 @@ func newAWSConfig(ctx context.Context) (aws.Config, error) {
 		))
 	}
 
-	return config.LoadDefaultConfig(ctx, opts...)
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return cfg, err
+	}
+	// Create a client span for every AWS SDK call
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	return cfg, nil
 }
 
-// createSecret creates a new secret in AWS Secrets Manager with OpenTelemetry instrumentation
-func createSecret(ctx context.Context, secretName, secretValue string, tracer trace.Tracer) (*secretsmanager.CreateSecretOutput, error) {
-	ctx, span := tracer.Start(ctx, "secretsmanager.secret.create", trace.WithSpanKind(trace.SpanKindClient))
-	defer span.End()
-
-	// Set attributes for the Secrets Manager operation
-	span.SetAttributes(
-		semconv.ServiceNameKey.String("secretsmanager"),
-		semconv.ServiceVersionKey.String("v1"),
-		semconv.HTTPRequestMethodKey.String("POST"),
-		semconv.AWSRequestIDKey.String(secretName),
-	)
-
-	// Debug: Print trace ID
-	spanCtx := trace.SpanContextFromContext(ctx)
-	log.Printf("Secrets Manager trace ID: %s, Span ID: %s", spanCtx.TraceID().String(), spanCtx.SpanID().String())
-
-	// Create AWS config
+// createSecret creates a new secret in AWS Secrets Manager. The client span
+// (SecretsManager.CreateSecret) is created by the otelaws middleware.
+func createSecret(ctx context.Context, secretName, secretValue string) (*secretsmanager.CreateSecretOutput, error) {
 	cfg, err := newAWSConfig(ctx)
 	if err != nil {
-		span.RecordError(err)
-		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(500))
 		return nil, fmt.Errorf("failed to create AWS config: %w", err)
 	}
 
-	// Create Secrets Manager client
 	client := secretsmanager.NewFromConfig(cfg)
-
-	// Create the secret
 	result, err := client.CreateSecret(ctx, &secretsmanager.CreateSecretInput{
 		Name:         aws.String(secretName),
 		SecretString: aws.String(secretValue),
 		Description:  aws.String("Secret created by OpenTelemetry demo"),
 	})
-
 	if err != nil {
-		span.RecordError(err)
-		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(400))
 		return nil, fmt.Errorf("secretsmanager.secret.create call failed: %w", err)
 	}
 
-	// Record success
-	span.SetAttributes(
-		semconv.HTTPResponseStatusCodeKey.Int(200),
-		semconv.AWSRequestIDKey.String(*result.ARN),
-	)
-
 	log.Printf("Successfully created secret: %s", *result.ARN)
 	return result, nil
 }
 
-// getSecret retrieves a secret from AWS Secrets Manager with OpenTelemetry instrumentation
-func getSecret(ctx context.Context, secretName string, tracer trace.Tracer) (*secretsmanager.GetSecretValueOutput, error) {
-	ctx, span := tracer.Start(ctx, "secretsmanager.secret.get", trace.WithSpanKind(trace.SpanKindClient))
-	defer span.End()
-
-	// Set attributes
-	span.SetAttributes(
-		semconv.ServiceNameKey.String("secretsmanager"),
-		semconv.ServiceVersionKey.String("v1"),
-		semconv.HTTPRequestMethodKey.String("GET"),
-		semconv.AWSRequestIDKey.String(secretName),
-	)
-
-	spanCtx := trace.SpanContextFromContext(ctx)
-	log.Printf("Get Secret trace ID: %s, Span ID: %s", spanCtx.TraceID().String(), spanCtx.SpanID().String())
-
+// getSecret retrieves a secret from AWS Secrets Manager. The client span
+// (SecretsManager.GetSecretValue) is created by the otelaws middleware.
+func getSecret(ctx context.Context, secretName string) (*secretsmanager.GetSecretValueOutput, error) {
 	cfg, err := newAWSConfig(ctx)
 	if err != nil {
-		span.RecordError(err)
 		return nil, fmt.Errorf("failed to create AWS config: %w", err)
 	}
 
@@ -176,91 +189,110 @@ func getSecret(ctx context.Context, secretName string, tracer trace.Tracer) (*se
 	result, err := client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
 		SecretId: aws.String(secretName),
 	})
-
 	if err != nil {
-		span.RecordError(err)
-		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(404))
 		return nil, fmt.Errorf("secretsmanager.secret.get call failed: %w", err)
 	}
 
-	span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(200))
 	log.Printf("Successfully retrieved secret: %s", secretName)
 	return result, nil
 }
 
 // triggerAirflowDAG triggers a DAG run in AWS MWAA with OpenTelemetry instrumentation
-func triggerAirflowDAG(ctx context.Context, environmentName, dagID string, dagParams map[string]interface{}, tracer trace.Tracer) error {
+// and returns its dag_run_id. The run is recorded so later status polls join
+// this trace.
+func triggerAirflowDAG(ctx context.Context, environmentName, dagID string, dagParams map[string]interface{}, tracer trace.Tracer) (string, error) {
 	ctx, span := tracer.Start(ctx, "airflow.dag.trigger", trace.WithSpanKind(trace.SpanKindClient))
 	defer span.End()
 
+	dagRunID := fmt.Sprintf("otel_%d", time.Now().UnixNano())
+
 	// Set attributes for the Airflow operation
 	span.SetAttributes(
 		semconv.ServiceNameKey.String("mwaa"),
 		semconv.ServiceVersionKey.String("v1"),
 		semconv.HTTPRequestMethodKey.String("POST"),
 		semconv.URLPathKey.String(fmt.Sprintf("/airflow/%s/dag/%s/trigger", environmentName, dagID)),
+		attribute.String("airflow.environment", environmentName),
+		attribute.String("airflow.dag_id", dagID),
+		attribute.String("airflow.dag_run.id", dagRunID),
 	)
 
 	spanCtx := trace.SpanContextFromContext(ctx)
 	log.Printf("Airflow DAG trigger trace ID: %s, Span ID: %s", spanCtx.TraceID().String(), spanCtx.SpanID().String())
 
+	run := dagRun{
+		EnvironmentName: environmentName,
+		DagID:           dagID,
+		TriggeredAt:     time.Now(),
+		Trigger:         spanCtx,
+		Mock:            useMockMWAA(),
+	}
+
 	// For LocalStack or when MWAA is not available, use mock response
-	if os.Getenv("AWS_ENDPOINT_URL_MWAA") != "" || os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+	if run.Mock {
 		log.Printf("Using mock Airflow DAG trigger for environment: %s, DAG: %s", environmentName, dagID)
-		span.SetAttributes(
-			semconv.HTTPResponseStatusCodeKey.Int(200),
-			semconv.AWSRequestIDKey.String("mock-execution-"+fmt.Sprintf("%d", time.Now().Unix())),
-		)
+		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(200))
 		time.Sleep(100 * time.Millisecond) // Simulate API call
-		return nil
-	}
-
-	cfg, err := newAWSConfig(ctx)
-	if err != nil {
-		span.RecordError(err)
-		return fmt.Errorf("failed to create AWS config: %w", err)
+		dagRuns.add(dagRunID, run)
+		return dagRunID, nil
 	}
 
-	// Create MWAA client
-	client := mwaa.NewFromConfig(cfg)
-
 	// Convert parameters to JSON string for logging
 	confJSON, err := json.Marshal(dagParams)
 	if err != nil {
 		span.RecordError(err)
-		return fmt.Errorf("failed to marshal DAG parameters: %w", err)
+		return "", fmt.Errorf("failed to marshal DAG parameters: %w", err)
 	}
 	log.Printf("DAG parameters: %s", string(confJSON))
 
-	// Create CLI token (required for MWAA API calls)
-	tokenResult, err := client.CreateCliToken(ctx, &mwaa.CreateCliTokenInput{
-		Name: aws.String(environmentName),
-	})
+	// Create the run through the Airflow REST API (MWAA InvokeRestApi)
+	body := map[string]interface{}{"dag_run_id": dagRunID}
+	if dagParams != nil {
+		body["conf"] = dagParams
+	}
+	_, err = invokeAirflow(ctx, environmentName, types.RestApiMethodPost, fmt.Sprintf("/dags/%s/dagRuns", dagID), body)
 	if err != nil {
 		span.RecordError(err)
-		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(403))
-		return fmt.Errorf("failed to create CLI token: %w", err)
+		span.SetStatus(codes.Error, "failed to trigger DAG run")
+		return "", fmt.Errorf("failed to trigger DAG run: %w", err)
 	}
 
-	log.Printf("Successfully triggered DAG %s in environment %s with token", dagID, environmentName)
-	span.SetAttributes(
-		semconv.HTTPResponseStatusCodeKey.Int(200),
-		semconv.AWSRequestIDKey.String(*tokenResult.CliToken),
-	)
-
-	return nil
+	log.Printf("Successfully triggered DAG %s in environment %s: %s", dagID, environmentName, dagRunID)
+	span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(200))
+	dagRuns.add(dagRunID, run)
+	return dagRunID, nil
 }
 
-// TracingMiddleware creates a span for each inbound HTTP request
+// TracingMiddleware creates a span for each inbound HTTP request. Spans are
+// named by HTTP_SPAN_NAME_STRATEGY, "GET /secrets/:secret_name" by default;
+// see the spanname package.
 func TracingMiddleware() gin.HandlerFunc {
+	// Name spans after the route so secret names in the path don't end up
+	// in span names, which are not redacted
+	namer := spanname.FromEnv()
+	if namer.Strategy == spanname.Target {
+		log.Printf("%s=%s would put secret names in span names; using %s", spanname.EnvStrategy, spanname.Target, spanname.MethodRoute)
+		namer.Strategy = spanname.MethodRoute
+	}
 	return func(c *gin.Context) {
 		tracer := otel.Tracer(getServiceName())
-		spanName := fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path)
+		route := c.FullPath()
+		legacy := route
+		if legacy == "" {
+			legacy = c.Request.URL.Path
+		}
+		spanName, nameAttrs := namer.Name(spanname.Request{
+			Method: c.Request.Method,
+			Route:  route,
+			Target: c.Request.URL.Path,
+			Legacy: fmt.Sprintf("%s %s", c.Request.Method, legacy),
+		})
 
 		ctx, span := tracer.Start(
 			c.Request.Context(),
 			spanName,
 			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(nameAttrs...),
 		)
 		defer span.End()
 
@@ -272,6 +304,8 @@ func TracingMiddleware() gin.HandlerFunc {
 		span.SetAttributes(
 			semconv.HTTPRequestMethodKey.String(c.Request.Method),
 			semconv.URLFull(c.Request.URL.String()),
+			semconv.URLPath(c.Request.URL.Path),
+			semconv.HTTPRoute(c.FullPath()),
 			semconv.UserAgentOriginal(c.Request.UserAgent()),
 		)
 		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(c.Writer.Status()))
@@ -291,6 +325,12 @@ type airflowRequest struct {
 }
 
 func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
+	// Cache secrets in process so each request doesn't call Secrets Manager
+	cache, err := newSecretsCache(secretsCacheTTL(), getSecret)
+	if err != nil {
+		return fmt.Errorf("failed to create secrets cache: %w", err)
+	}
+
 	r := gin.Default()
 	r.Use(TracingMiddleware())
 
@@ -309,13 +349,15 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 			return
 		}
 
-		tracer := tp.Tracer(getServiceName())
-		result, err := createSecret(c.Request.Context(), req.SecretName, req.SecretValue, tracer)
+		result, err := createSecret(c.Request.Context(), req.SecretName, req.SecretValue)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
 		}
 
+		// Drop any cached value so the next read fetches the new secret
+		cache.Invalidate(req.SecretName)
+
 		response := gin.H{
 			"status":      "ok",
 			"secret_name": req.SecretName,
@@ -335,8 +377,7 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 			return
 		}
 
-		tracer := tp.Tracer(getServiceName())
-		result, err := getSecret(c.Request.Context(), secretName, tracer)
+		result, cached, err := cache.Get(c.Request.Context(), secretName)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -345,6 +386,7 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 		c.JSON(200, gin.H{
 			"status":      "ok",
 			"secret_name": secretName,
+			"cached":      cached,
 			"secret_value": func() string {
 				if result.SecretString != nil {
 					return *result.SecretString
@@ -376,7 +418,7 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 		}
 
 		tracer := tp.Tracer(getServiceName())
-		err := triggerAirflowDAG(c.Request.Context(), environmentName, req.DagID, req.Parameters, tracer)
+		dagRunID, err := triggerAirflowDAG(c.Request.Context(), environmentName, req.DagID, req.Parameters, tracer)
 		if err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -386,10 +428,52 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 			"status":           "ok",
 			"environment_name": environmentName,
 			"dag_id":           req.DagID,
+			"dag_run_id":       dagRunID,
 			"parameters":       req.Parameters,
 		})
 	})
 
+	// Polls a DAG run's state. ?wait=true keeps polling until the run
+	// finishes or ?timeout= (default 30s) passes.
+	r.GET("/airflow/status/:dag_run_id", func(c *gin.Context) {
+		dagRunID := c.Param("dag_run_id")
+
+		run, known := dagRuns.get(dagRunID)
+		if !known {
+			// Runs not triggered by this service need the DAG ID
+			run = dagRun{
+				EnvironmentName: c.Query("environment_name"),
+				DagID:           c.Query("dag_id"),
+				Mock:            useMockMWAA(),
+			}
+			if run.EnvironmentName == "" {
+				run.EnvironmentName = os.Getenv("MWAA_ENVIRONMENT_NAME")
+			}
+			if run.Mock {
+				c.JSON(404, gin.H{"error": "unknown dag run"})
+				return
+			}
+			if run.DagID == "" || run.EnvironmentName == "" {
+				c.JSON(400, gin.H{"error": "dag_id and environment_name are required for runs not triggered by this service"})
+				return
+			}
+		}
+
+		timeout, err := parseDagRunTimeout(c.Query("timeout"))
+		if err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		tracer := tp.Tracer(getServiceName())
+		status, err := pollDagRun(c.Request.Context(), tracer, run, dagRunID, c.Query("wait") == "true", timeout)
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(200, status)
+	})
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -400,10 +484,15 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 func main() {
 	ctx := context.Background()
 
-	tp := initTracerProvider(ctx)
+	res := newResource(ctx)
+	tp := initTracerProvider(ctx, res)
 	defer func() {
 		_ = tp.Shutdown(context.Background())
 	}()
+	mp := initMeterProvider(ctx, res)
+	defer func() {
+		_ = mp.Shutdown(context.Background())
+	}()
 
 	if os.Getenv("RUN_SERVER") == "true" {
 		if err := startServer(ctx, tp); err != nil {
@@ -419,4 +508,5 @@ func main() {
 	log.Println("  POST /secrets/create - Create secret")
 	log.Println("  GET /secrets/{name} - Get secret")
 	log.Println("  POST /airflow/trigger - Trigger DAG")
-}
\ No newline at end of file
+	log.Println("  GET /airflow/status/{dag_run_id} - Poll DAG run state")
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const defaultSecretsCacheTTL = 5 * time.Minute
+
+// secretFetcher loads a secret from Secrets Manager.
+type secretFetcher func(ctx context.Context, secretName string) (*secretsmanager.GetSecretValueOutput, error)
+
+type cachedSecret struct {
+	value     *secretsmanager.GetSecretValueOutput
+	fetchedAt time.Time
+	expiresAt time.Time
+}
+
+func (e *cachedSecret) size() int64 {
+	return int64(len(aws.ToString(e.value.SecretString)) + len(e.value.SecretBinary))
+}
+
+// secretsCache is an in-process TTL cache in front of GetSecretValue.
+//
+// Expired entries are kept until they are refreshed, so a refresh can compare
+// the new version with the cached one and record a rotation. Secret names
+// are never recorded on spans or metrics.
+type secretsCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	entries map[string]*cachedSecret
+	fetch   secretFetcher
+
+	tracer    trace.Tracer
+	lookups   metric.Int64Counter
+	rotations metric.Int64Counter
+}
+
+func newSecretsCache(ttl time.Duration, fetch secretFetcher) (*secretsCache, error) {
+	c := &secretsCache{
+		ttl:     ttl,
+		entries: make(map[string]*cachedSecret),
+		fetch:   fetch,
+		tracer:  otel.Tracer(getServiceName()),
+	}
+
+	meter := otel.Meter(getServiceName())
+	var err error
+	c.lookups, err = meter.Int64Counter("secretsmanager.cache.lookups",
+		metric.WithDescription("Secret lookups by cache result"),
+		metric.WithUnit("{lookup}"))
+	if err != nil {
+		return nil, err
+	}
+	c.rotations, err = meter.Int64Counter("secretsmanager.cache.rotations",
+		metric.WithDescription("Secret version changes seen when refreshing the cache"),
+		metric.WithUnit("{rotation}"))
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := meter.Int64ObservableGauge("secretsmanager.cache.size",
+		metric.WithDescription("Cached secrets by state"),
+		metric.WithUnit("{secret}"))
+	if err != nil {
+		return nil, err
+	}
+	bytes, err := meter.Int64ObservableGauge("secretsmanager.cache.bytes",
+		metric.WithDescription("Size of the cached secret values"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		fresh, stale, total := c.stats()
+		o.ObserveInt64(entries, fresh, metric.WithAttributes(attribute.String("cache.state", "fresh")))
+		o.ObserveInt64(entries, stale, metric.WithAttributes(attribute.String("cache.state", "stale")))
+		o.ObserveInt64(bytes, total)
+		return nil
+	}, entries, bytes)
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// secretsCacheTTL reads the cache TTL from SECRETS_CACHE_TTL, for example
+// "30s" or "10m".
+func secretsCacheTTL() time.Duration {
+	if v := os.Getenv("SECRETS_CACHE_TTL"); v != "" {
+		if ttl, err := time.ParseDuration(v); err == nil && ttl > 0 {
+			return ttl
+		}
+	}
+	return defaultSecretsCacheTTL
+}
+
+func (c *secretsCache) stats() (fresh, stale, bytes int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	for _, e := range c.entries {
+		if now.Before(e.expiresAt) {
+			fresh++
+		} else {
+			stale++
+		}
+		bytes += e.size()
+	}
+	return fresh, stale, bytes
+}
+
+// Get returns the secret from the cache, or fetches it from Secrets Manager
+// if it is missing or expired. The second result reports a cache hit.
+func (c *secretsCache) Get(ctx context.Context, secretName string) (*secretsmanager.GetSecretValueOutput, bool, error) {
+	ctx, span := c.tracer.Start(ctx, "secretsmanager.cache.get")
+	defer span.End()
+
+	c.mu.Lock()
+	cached := c.entries[secretName]
+	c.mu.Unlock()
+
+	now := time.Now()
+	if cached != nil && now.Before(cached.expiresAt) {
+		span.SetAttributes(
+			attribute.Bool("cache.hit", true),
+			attribute.Int64("cache.entry.age_ms", now.Sub(cached.fetchedAt).Milliseconds()),
+		)
+		c.lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.result", "hit")))
+		return cached.value, true, nil
+	}
+
+	span.SetAttributes(
+		attribute.Bool("cache.hit", false),
+		attribute.Bool("cache.stale", cached != nil),
+	)
+	c.lookups.Add(ctx, 1, metric.WithAttributes(attribute.String("cache.result", "miss")))
+
+	value, err := c.fetch(ctx, secretName)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "secret fetch failed")
+		return nil, false, err
+	}
+	if cached != nil {
+		c.detectRotation(ctx, span, cached.value, value)
+	}
+
+	c.mu.Lock()
+	c.entries[secretName] = &cachedSecret{
+		value:     value,
+		fetchedAt: now,
+		expiresAt: now.Add(c.ttl),
+	}
+	c.mu.Unlock()
+	return value, false, nil
+}
+
+// detectRotation records a span event when a refreshed secret has a new
+// version or its version moved between stages (for example from AWSPENDING
+// to AWSCURRENT).
+func (c *secretsCache) detectRotation(ctx context.Context, span trace.Span, prev, cur *secretsmanager.GetSecretValueOutput) {
+	prevVersion, curVersion := aws.ToString(prev.VersionId), aws.ToString(cur.VersionId)
+	if prevVersion != curVersion {
+		span.AddEvent("secret.rotated", trace.WithAttributes(
+			attribute.String("secret.version.previous", prevVersion),
+			attribute.String("secret.version.current", curVersion),
+			attribute.String("secret.version_stages", strings.Join(cur.VersionStages, ",")),
+		))
+		c.rotations.Add(ctx, 1)
+		return
+	}
+	if !slices.Equal(prev.VersionStages, cur.VersionStages) {
+		span.AddEvent("secret.version_stages_changed", trace.WithAttributes(
+			attribute.String("secret.version", curVersion),
+			attribute.String("secret.version_stages.previous", strings.Join(prev.VersionStages, ",")),
+			attribute.String("secret.version_stages.current", strings.Join(cur.VersionStages, ",")),
+		))
+	}
+}
+
+// Invalidate drops a cached secret, for example after it has been written.
+func (c *secretsCache) Invalidate(secretName string) {
+	c.mu.Lock()
+	delete(c.entries, secretName)
+	c.mu.Unlock()
+}
@@ -0,0 +1,151 @@
+// Command consumer is the Lambda target of the order rule. It continues the
+// trace the publisher put in the event detail and processes the order.
+//
+// The tracer setup is the one from aws/lambda-go: spans go to the ADOT
+// Collector layer on localhost:4317, which forwards them to Last9.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/last9/opentelemetry-examples/go/aws-eventbridge/internal/orderevent"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// HandleRequest runs inside the span otellambda starts for the invocation.
+// Its parent is the publisher's span, read from the detail by
+// detailToCarrier.
+func HandleRequest(ctx context.Context, event events.EventBridgeEvent) error {
+	var detail orderevent.Detail
+	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+		return fmt.Errorf("decode detail: %w", err)
+	}
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		semconv.MessagingSystemKey.String("aws_eventbridge"),
+		semconv.MessagingOperationTypeReceive,
+		semconv.MessagingMessageID(event.ID),
+		attribute.String("aws.eventbridge.source", event.Source),
+		attribute.String("aws.eventbridge.detail_type", event.DetailType),
+		attribute.Bool("aws.eventbridge.trace_context.present", len(detail.TraceContext) > 0),
+		attribute.String("order.id", detail.Order.ID),
+	)
+	// Time is when the event was put on the bus, so this is how long
+	// EventBridge took to deliver it, retries included
+	if !event.Time.IsZero() {
+		span.SetAttributes(attribute.Float64("aws.eventbridge.delivery_delay", time.Since(event.Time).Seconds()))
+	}
+	if len(detail.TraceContext) == 0 {
+		span.AddEvent("trace_context.missing")
+	}
+
+	return processOrder(ctx, detail.Order)
+}
+
+// processOrder simulates the work of the consumer. Orders without a positive
+// quantity fail, so EventBridge retries the invocation.
+func processOrder(ctx context.Context, order orderevent.Order) error {
+	_, span := otel.Tracer("aws-eventbridge-consumer").Start(ctx, "process order",
+		trace.WithAttributes(
+			attribute.String("order.id", order.ID),
+			attribute.String("order.item", order.Item),
+			attribute.Int("order.quantity", order.Quantity),
+		))
+	defer span.End()
+
+	time.Sleep(50 * time.Millisecond)
+	if order.Quantity <= 0 {
+		err := fmt.Errorf("order %s has quantity %d", order.ID, order.Quantity)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "order rejected")
+		return err
+	}
+	return nil
+}
+
+// detailToCarrier gives otellambda the trace context from the event detail.
+// Without it the invocation span would start a new trace.
+func detailToCarrier(eventJSON []byte) propagation.TextMapCarrier {
+	var event events.EventBridgeEvent
+	if err := json.Unmarshal(eventJSON, &event); err != nil {
+		return propagation.MapCarrier{}
+	}
+	var detail orderevent.Detail
+	if err := json.Unmarshal(event.Detail, &detail); err != nil {
+		return propagation.MapCarrier{}
+	}
+	return propagation.MapCarrier(detail.TraceContext)
+}
+
+func initTracer() (*sdktrace.TracerProvider, error) {
+	// Create OTLP trace exporter that sends to localhost:4317 (ADOT Collector)
+	ctx := context.Background()
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint("localhost:4317"),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "aws-eventbridge-consumer"
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
+}
+
+func main() {
+	tp, err := initTracer()
+	if err != nil {
+		log.Fatalf("Failed to initialize tracer: %v", err)
+	}
+	defer func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+	}()
+
+	// The Flusher ensures traces are sent before Lambda freezes
+	lambda.Start(otellambda.InstrumentHandler(HandleRequest,
+		otellambda.WithFlusher(tp),
+		otellambda.WithEventToCarrier(detailToCarrier),
+		otellambda.WithPropagator(otel.GetTextMapPropagator()),
+	))
+}
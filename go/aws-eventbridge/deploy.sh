@@ -0,0 +1,122 @@
+#!/bin/bash
+
+# EventBridge Deployment Script
+# Deploys the consumer Lambda and a rule that sends order events to it. Run
+# the publisher locally afterwards.
+
+set -e
+
+# Load environment variables (copy .env.example to .env and update values)
+if [ -f .env ]; then
+    export $(grep -v '^#' .env | xargs)
+else
+    echo "Error: .env file not found. Please create it from .env.example"
+    exit 1
+fi
+
+ACCOUNT_ID=$(aws sts get-caller-identity --profile "$AWS_PROFILE" --query Account --output text)
+
+echo "🔨 Building consumer Lambda for Linux AMD64..."
+GOOS=linux GOARCH=amd64 go build -o bootstrap ./consumer
+
+echo "📦 Creating Lambda deployment package..."
+zip -q function.zip bootstrap collector-config.yaml
+
+echo "Creating IAM role for the consumer..."
+cat > trust-policy.json <<JSON
+{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": {"Service": "lambda.amazonaws.com"}, "Action": "sts:AssumeRole"}]
+}
+JSON
+
+ROLE_NAME="${FUNCTION_NAME}-role"
+ROLE_ARN=$(aws iam create-role \
+    --role-name "$ROLE_NAME" \
+    --assume-role-policy-document file://trust-policy.json \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text 2>/dev/null || \
+    aws iam get-role \
+    --role-name "$ROLE_NAME" \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text)
+
+aws iam attach-role-policy \
+    --role-name "$ROLE_NAME" \
+    --policy-arn arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole \
+    --profile "$AWS_PROFILE"
+
+echo "Waiting for IAM role to propagate (10 seconds)..."
+sleep 10
+
+echo "☁️  Creating consumer Lambda..."
+FUNCTION_ARN=$(aws lambda create-function \
+    --function-name "$FUNCTION_NAME" \
+    --runtime "$LAMBDA_RUNTIME" \
+    --role "$ROLE_ARN" \
+    --handler bootstrap \
+    --zip-file fileb://function.zip \
+    --timeout "$LAMBDA_TIMEOUT" \
+    --memory-size "$LAMBDA_MEMORY" \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" \
+    --layers "$OTEL_LAYER_ARN" \
+    --tracing-config Mode=PassThrough \
+    --environment "Variables={
+        OTEL_SERVICE_NAME=$CONSUMER_SERVICE_NAME,
+        OTEL_RESOURCE_ATTRIBUTES=$OTEL_RESOURCE_ATTRIBUTES,
+        OPENTELEMETRY_COLLECTOR_CONFIG_FILE=/var/task/collector-config.yaml
+    }" \
+    --architectures x86_64 \
+    --query 'FunctionArn' \
+    --output text)
+
+if [ "$EVENT_BUS_NAME" != "default" ]; then
+    echo "Creating event bus $EVENT_BUS_NAME..."
+    aws events create-event-bus \
+        --name "$EVENT_BUS_NAME" \
+        --region "$AWS_REGION" \
+        --profile "$AWS_PROFILE" >/dev/null 2>&1 || true
+fi
+
+echo "Creating rule $RULE_NAME..."
+# Matches on source and detail-type only. trace_context in the detail does
+# not affect matching
+RULE_ARN=$(aws events put-rule \
+    --name "$RULE_NAME" \
+    --event-bus-name "$EVENT_BUS_NAME" \
+    --event-pattern '{"source":["com.example.orders"],"detail-type":["OrderCreated"]}' \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" \
+    --query 'RuleArn' \
+    --output text)
+
+aws lambda add-permission \
+    --function-name "$FUNCTION_NAME" \
+    --statement-id "${RULE_NAME}-invoke" \
+    --action lambda:InvokeFunction \
+    --principal events.amazonaws.com \
+    --source-arn "$RULE_ARN" \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" >/dev/null
+
+# Failed invocations are retried twice, then dropped
+aws events put-targets \
+    --rule "$RULE_NAME" \
+    --event-bus-name "$EVENT_BUS_NAME" \
+    --targets "Id=consumer,Arn=${FUNCTION_ARN},RetryPolicy={MaximumRetryAttempts=2,MaximumEventAgeInSeconds=3600}" \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" >/dev/null
+
+echo ""
+echo "✅ Deployed successfully!"
+echo "Consumer: $FUNCTION_ARN"
+echo "Rule:     $RULE_ARN"
+echo ""
+echo "🧪 Start the publisher with:"
+echo "EVENT_BUS_NAME=$EVENT_BUS_NAME go run ./publisher"
+
+# Cleanup
+rm -f trust-policy.json
@@ -0,0 +1,49 @@
+// Package orderevent holds the event the publisher puts on the bus and the
+// consumer receives, and the helpers that carry trace context through
+// EventBridge.
+//
+// PutEvents entries have no message attributes, and the TraceHeader field
+// only takes X-Ray headers. The part of the event every target receives
+// unchanged is the detail, so the W3C trace context travels as a
+// trace_context object inside it:
+//
+//	{"order": {...}, "trace_context": {"traceparent": "00-...", "baggage": "..."}}
+package orderevent
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+const (
+	// Source and DetailType are what the rule in deploy.sh matches on.
+	Source     = "com.example.orders"
+	DetailType = "OrderCreated"
+)
+
+// Order is the business payload of the event.
+type Order struct {
+	ID       string `json:"id"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// Detail is the event detail.
+type Detail struct {
+	Order        Order             `json:"order"`
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// InjectTraceContext returns the trace context of ctx as a JSON-friendly map.
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractTraceContext returns ctx with the trace context from m.
+func ExtractTraceContext(ctx context.Context, m map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(m))
+}
@@ -0,0 +1,194 @@
+// Command publisher is an HTTP API that puts order events on an EventBridge
+// bus with the trace context in the event detail.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	ebtypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/last9/opentelemetry-examples/go/aws-eventbridge/internal/orderevent"
+	otelaws "go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "aws-eventbridge-publisher"
+
+type server struct {
+	eb      *eventbridge.Client
+	tracer  trace.Tracer
+	busName string
+}
+
+func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp http exporter: %v", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithOS(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+	if err != nil {
+		log.Fatalf("failed to create resource: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp
+}
+
+// publishOrder handles POST /orders. The trace context of the publish span
+// goes into the event detail, where the consumer reads it.
+func (s *server) publishOrder(w http.ResponseWriter, r *http.Request) {
+	var order orderevent.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if order.ID == "" {
+		order.ID = fmt.Sprintf("order-%d", time.Now().UnixNano())
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "publish "+s.busName,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("aws_eventbridge"),
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(s.busName),
+			attribute.String("aws.eventbridge.source", orderevent.Source),
+			attribute.String("aws.eventbridge.detail_type", orderevent.DetailType),
+			attribute.String("order.id", order.ID),
+		))
+	defer span.End()
+
+	detail, err := json.Marshal(orderevent.Detail{
+		Order:        order,
+		TraceContext: orderevent.InjectTraceContext(ctx),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "marshal detail failed")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// PutEvents: span auto-created by otelaws
+	out, err := s.eb.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []ebtypes.PutEventsRequestEntry{{
+			EventBusName: aws.String(s.busName),
+			Source:       aws.String(orderevent.Source),
+			DetailType:   aws.String(orderevent.DetailType),
+			Detail:       aws.String(string(detail)),
+		}},
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "put events failed")
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// PutEvents succeeds as a call even when entries are rejected, so the
+	// result of each entry has to be checked
+	entry := out.Entries[0]
+	if out.FailedEntryCount > 0 || entry.ErrorCode != nil {
+		span.SetAttributes(
+			attribute.Int("aws.eventbridge.failed_entry_count", int(out.FailedEntryCount)),
+			attribute.String("aws.eventbridge.error_code", aws.ToString(entry.ErrorCode)),
+		)
+		span.SetStatus(codes.Error, "entry rejected: "+aws.ToString(entry.ErrorMessage))
+		writeJSON(w, http.StatusBadGateway, map[string]string{
+			"error":      "event rejected",
+			"error_code": aws.ToString(entry.ErrorCode),
+			"message":    aws.ToString(entry.ErrorMessage),
+		})
+		return
+	}
+	span.SetAttributes(semconv.MessagingMessageID(aws.ToString(entry.EventId)))
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"event_id": aws.ToString(entry.EventId),
+		"trace_id": span.SpanContext().TraceID().String(),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func main() {
+	ctx := context.Background()
+
+	tp := initTracerProvider(ctx)
+	defer func() {
+		_ = tp.Shutdown(context.Background())
+	}()
+
+	// The SDK reads AWS_ENDPOINT_URL itself, so LocalStack needs no custom
+	// resolver
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("failed to load aws config: %v", err)
+	}
+	// Enable OTel middleware for all AWS SDK v2 clients
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
+	busName := os.Getenv("EVENT_BUS_NAME")
+	if busName == "" {
+		busName = "default"
+	}
+	s := &server{
+		eb:      eventbridge.NewFromConfig(cfg),
+		tracer:  tp.Tracer(serviceName),
+		busName: busName,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", s.publishOrder)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	log.Printf("listening on :%s, publishing to bus %s", port, busName)
+	if err := http.ListenAndServe(":"+port, otelhttp.NewHandler(mux, "eventbridge-publisher",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method + " " + r.URL.Path }),
+	)); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
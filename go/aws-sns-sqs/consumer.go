@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// subscriber is an SQS queue subscribed to the topic.
+type subscriber struct {
+	QueueURL string
+	// RawDelivery is whether the subscription has raw message delivery on.
+	RawDelivery bool
+}
+
+// Where the trace context of a message was found.
+const (
+	contextFromAttributes = "sqs_message_attributes"
+	contextFromEnvelope   = "sns_envelope"
+	contextNotFound       = "none"
+)
+
+// snsEnvelope is the JSON body SNS delivers to SQS when raw message delivery
+// is off. The message attributes of the publish are inside it, not on the
+// SQS message.
+type snsEnvelope struct {
+	Type              string `json:"Type"`
+	MessageID         string `json:"MessageId"`
+	TopicArn          string `json:"TopicArn"`
+	Message           string `json:"Message"`
+	MessageAttributes map[string]struct {
+		Type  string `json:"Type"`
+		Value string `json:"Value"`
+	} `json:"MessageAttributes"`
+}
+
+// extractFromSNSMessage returns the trace context of a message delivered by
+// SNS, the message body, and where the context was found.
+//
+// With raw message delivery the publish attributes arrive as SQS message
+// attributes. Without it the SQS message has no attributes and the body is
+// an SNS envelope, so reading only the SQS attributes silently loses the
+// trace context.
+func extractFromSNSMessage(ctx context.Context, m sqstypes.Message) (context.Context, string, string, *snsEnvelope) {
+	body := aws.ToString(m.Body)
+
+	carrier := propagation.MapCarrier{}
+	for k, v := range m.MessageAttributes {
+		if v.StringValue != nil {
+			carrier[k] = aws.ToString(v.StringValue)
+		}
+	}
+	if len(carrier) > 0 {
+		return otel.GetTextMapPropagator().Extract(ctx, carrier), body, contextFromAttributes, nil
+	}
+
+	var env snsEnvelope
+	if err := json.Unmarshal([]byte(body), &env); err != nil || env.Type != "Notification" {
+		return ctx, body, contextNotFound, nil
+	}
+	for k, v := range env.MessageAttributes {
+		if v.Type == "String" {
+			carrier[k] = v.Value
+		}
+	}
+	source := contextFromEnvelope
+	if len(carrier) == 0 {
+		source = contextNotFound
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, carrier), env.Message, source, &env
+}
+
+// consume receives messages from a subscribed queue until one is processed
+// or timeout passes.
+func consume(ctx context.Context, tracer trace.Tracer, sqsc *sqs.Client, s subscriber, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		// SQS Receive: use background context to avoid creating spans for polling
+		recv, err := sqsc.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(s.QueueURL),
+			MaxNumberOfMessages:   1,
+			WaitTimeSeconds:       5,
+			MessageAttributeNames: []string{"All"},
+		})
+		if err != nil {
+			return fmt.Errorf("sqs receive failed: %w", err)
+		}
+		for _, m := range recv.Messages {
+			process(ctx, tracer, s, m)
+
+			// Delete the message so it is not reprocessed
+			_, _ = sqsc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+				QueueUrl:      aws.String(s.QueueURL),
+				ReceiptHandle: m.ReceiptHandle,
+			})
+		}
+		if len(recv.Messages) > 0 {
+			return nil
+		}
+	}
+	return fmt.Errorf("no message within %s", timeout)
+}
+
+// process handles one message in a consumer span that links to the publish
+// span. Each subscriber starts its own trace, so a fan-out shows as one
+// publish trace with a linked trace per subscriber.
+func process(ctx context.Context, tracer trace.Tracer, s subscriber, m sqstypes.Message) {
+	msgCtx, body, source, env := extractFromSNSMessage(ctx, m)
+	producer := trace.SpanContextFromContext(msgCtx)
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemAWSSqs,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingDestinationName(queueName(s.QueueURL)),
+		semconv.MessagingMessageID(aws.ToString(m.MessageId)),
+		attribute.Bool("aws.sns.raw_message_delivery", s.RawDelivery),
+		attribute.String("messaging.trace_context.source", source),
+	}
+	if env != nil {
+		attrs = append(attrs,
+			attribute.String("aws.sns.message_id", env.MessageID),
+			attribute.String("aws.sns.topic_arn", env.TopicArn),
+		)
+	}
+
+	// Baggage from the publisher still applies, but the span starts a new
+	// trace
+	_, span := tracer.Start(msgCtx, "process "+queueName(s.QueueURL),
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.Link{SpanContext: producer}),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	if !producer.IsValid() {
+		span.AddEvent("trace_context.missing")
+	}
+	log.Printf("%s (raw delivery %t): %q, trace context from %s", queueName(s.QueueURL), s.RawDelivery, body, source)
+
+	// Simulate work
+	time.Sleep(50 * time.Millisecond)
+}
+
+// queueName returns the queue name from its URL.
+func queueName(queueURL string) string {
+	return queueURL[strings.LastIndex(queueURL, "/")+1:]
+}
+
+// arnName returns the resource name at the end of an ARN.
+func arnName(arn string) string {
+	return arn[strings.LastIndex(arn, ":")+1:]
+}
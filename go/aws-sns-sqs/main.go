@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	snstypes "github.com/aws/aws-sdk-go-v2/service/sns/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	otelaws "go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	serviceName     = "aws-sns-sqs-demo"
+	consumerTimeout = 20 * time.Second
+)
+
+func mustGetenv(key string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		log.Fatalf("missing required env: %s (or set CREATE_RESOURCES=true)", key)
+	}
+	return v
+}
+
+func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp http exporter: %v", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithOS(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+	if err != nil {
+		log.Fatalf("failed to create resource: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp
+}
+
+// newAWSConfig loads the default AWS config. The SDK reads AWS_ENDPOINT_URL
+// itself, so pointing it at LocalStack needs no custom resolver.
+func newAWSConfig(ctx context.Context) aws.Config {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("failed to load aws config: %v", err)
+	}
+	// Enable OTel middleware for all AWS SDK v2 clients
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	return cfg
+}
+
+// Inject W3C context into SNS MessageAttributes. SNS copies them to SQS
+// subscribers: as SQS message attributes with raw message delivery, and
+// inside the JSON body without it.
+func injectIntoSNS(ctx context.Context, in *sns.PublishInput) {
+	if in.MessageAttributes == nil {
+		in.MessageAttributes = map[string]snstypes.MessageAttributeValue{}
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	for k, v := range carrier {
+		in.MessageAttributes[k] = snstypes.MessageAttributeValue{
+			DataType:    aws.String("String"),
+			StringValue: aws.String(v),
+		}
+	}
+}
+
+// publish sends one message to the topic under a producer span.
+func publish(ctx context.Context, tracer trace.Tracer, snsc *sns.Client, topicARN, body string) error {
+	ctx, span := tracer.Start(ctx, "publish "+arnName(topicARN),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemKey.String("aws_sns"),
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(arnName(topicARN)),
+		))
+	defer span.End()
+
+	in := &sns.PublishInput{
+		TopicArn: aws.String(topicARN),
+		Message:  aws.String(body),
+	}
+	injectIntoSNS(ctx, in)
+
+	// SNS Publish: span auto-created by otelaws
+	out, err := snsc.Publish(ctx, in)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "publish failed")
+		return fmt.Errorf("sns publish failed: %w", err)
+	}
+	span.SetAttributes(semconv.MessagingMessageID(aws.ToString(out.MessageId)))
+	return nil
+}
+
+func main() {
+	ctx := context.Background()
+
+	tp := initTracerProvider(ctx)
+	defer func() {
+		// give exporter a moment to flush
+		_ = tp.Shutdown(context.Background())
+	}()
+
+	cfg := newAWSConfig(ctx)
+	snsc := sns.NewFromConfig(cfg)
+	sqsc := sqs.NewFromConfig(cfg)
+
+	var topicARN string
+	var subs []subscriber
+	if os.Getenv("CREATE_RESOURCES") == "true" {
+		var err error
+		topicARN, subs, err = createResources(ctx, snsc, sqsc)
+		if err != nil {
+			log.Fatalf("failed to create resources: %v", err)
+		}
+	} else {
+		topicARN = mustGetenv("SNS_TOPIC_ARN")
+		subs = []subscriber{
+			{QueueURL: mustGetenv("SQS_RAW_QUEUE_URL"), RawDelivery: true},
+			{QueueURL: mustGetenv("SQS_WRAPPED_QUEUE_URL"), RawDelivery: false},
+		}
+	}
+
+	tracer := tp.Tracer(serviceName)
+	rootCtx, span := tracer.Start(ctx, "sns fan-out demo")
+	span.SetAttributes(attribute.Int("fanout.subscribers", len(subs)))
+	if err := publish(rootCtx, tracer, snsc, topicARN, fmt.Sprintf("order created at %s", time.Now().Format(time.RFC3339))); err != nil {
+		span.RecordError(err)
+		span.End()
+		log.Fatalf("demo failed: %v", err)
+	}
+	span.End()
+
+	// Consumers run outside the publish trace and link back to it, as separate
+	// services would
+	var wg sync.WaitGroup
+	for _, s := range subs {
+		wg.Add(1)
+		go func(s subscriber) {
+			defer wg.Done()
+			if err := consume(ctx, tracer, sqsc, s, consumerTimeout); err != nil {
+				log.Printf("consumer %s: %v", queueName(s.QueueURL), err)
+			}
+		}(s)
+	}
+	wg.Wait()
+	log.Println("done")
+}
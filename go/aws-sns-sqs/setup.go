@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+)
+
+const topicName = "fanout-demo"
+
+// queuePolicy lets the topic send to the queue.
+const queuePolicy = `{
+  "Version": "2012-10-17",
+  "Statement": [{
+    "Effect": "Allow",
+    "Principal": {"Service": "sns.amazonaws.com"},
+    "Action": "sqs:SendMessage",
+    "Resource": %q,
+    "Condition": {"ArnEquals": {"aws:SourceArn": %q}}
+  }]
+}`
+
+// createResources creates the topic and two subscribed queues, one with raw
+// message delivery and one without. All calls are idempotent, so it can run
+// on every start.
+func createResources(ctx context.Context, snsc *sns.Client, sqsc *sqs.Client) (string, []subscriber, error) {
+	topic, err := snsc.CreateTopic(ctx, &sns.CreateTopicInput{Name: aws.String(topicName)})
+	if err != nil {
+		return "", nil, fmt.Errorf("create topic: %w", err)
+	}
+	topicARN := aws.ToString(topic.TopicArn)
+
+	var subs []subscriber
+	for _, raw := range []bool{true, false} {
+		name := topicName + "-wrapped"
+		if raw {
+			name = topicName + "-raw"
+		}
+
+		queue, err := sqsc.CreateQueue(ctx, &sqs.CreateQueueInput{QueueName: aws.String(name)})
+		if err != nil {
+			return "", nil, fmt.Errorf("create queue %s: %w", name, err)
+		}
+		attrs, err := sqsc.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl:       queue.QueueUrl,
+			AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("get queue arn %s: %w", name, err)
+		}
+		queueARN := attrs.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+
+		_, err = sqsc.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+			QueueUrl: queue.QueueUrl,
+			Attributes: map[string]string{
+				string(sqstypes.QueueAttributeNamePolicy): fmt.Sprintf(queuePolicy, queueARN, topicARN),
+			},
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("set queue policy %s: %w", name, err)
+		}
+
+		_, err = snsc.Subscribe(ctx, &sns.SubscribeInput{
+			TopicArn: aws.String(topicARN),
+			Protocol: aws.String("sqs"),
+			Endpoint: aws.String(queueARN),
+			Attributes: map[string]string{
+				"RawMessageDelivery": strconv.FormatBool(raw),
+			},
+		})
+		if err != nil {
+			return "", nil, fmt.Errorf("subscribe %s: %w", name, err)
+		}
+
+		log.Printf("subscribed %s (raw delivery %t)", name, raw)
+		subs = append(subs, subscriber{QueueURL: aws.ToString(queue.QueueUrl), RawDelivery: raw})
+	}
+	return topicARN, subs, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/last9/opentelemetry-examples/go/common/cloudcost"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sdkCosts estimates the cost of AWS SDK calls. It is nil, and records
+// nothing, unless CLOUD_COST_ESTIMATES is true.
+var sdkCosts = cloudcost.NewRecorderFromEnv()
+
+// addCostEstimates adds the cost middleware to a client's stack. Append it
+// after otelaws so the span in the context is the one for the call.
+func addCostEstimates(stack *middleware.Stack) error {
+	if sdkCosts == nil {
+		return nil
+	}
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CostEstimate", estimateCost), middleware.After)
+}
+
+// estimateCost puts the estimated cost of a successful call on its otelaws
+// span. Failed calls and retried attempts are not counted.
+func estimateCost(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if err != nil {
+		return out, metadata, err
+	}
+
+	service, operation := awsmiddleware.GetServiceID(ctx), awsmiddleware.GetOperationName(ctx)
+	var est cloudcost.Estimate
+	switch service {
+	case "S3":
+		est = cloudcost.S3(operation)
+	case "SQS":
+		est = sqsCost(in.Parameters, out.Result)
+	default:
+		return out, metadata, err
+	}
+	sdkCosts.Record(ctx, trace.SpanFromContext(ctx), est,
+		semconv.CloudProviderAWS,
+		semconv.RPCService(service),
+		semconv.RPCMethod(operation),
+	)
+	return out, metadata, err
+}
+
+// sqsCost estimates an SQS request from the messages it sent or received.
+func sqsCost(params, result any) cloudcost.Estimate {
+	var queueURL string
+	var size int64
+	switch p := params.(type) {
+	case *sqs.SendMessageInput:
+		queueURL = aws.ToString(p.QueueUrl)
+		size = sqsMessageSize(aws.ToString(p.MessageBody), p.MessageAttributes)
+	case *sqs.SendMessageBatchInput:
+		queueURL = aws.ToString(p.QueueUrl)
+		for _, e := range p.Entries {
+			size += sqsMessageSize(aws.ToString(e.MessageBody), e.MessageAttributes)
+		}
+	case *sqs.ReceiveMessageInput:
+		queueURL = aws.ToString(p.QueueUrl)
+		if r, ok := result.(*sqs.ReceiveMessageOutput); ok {
+			for _, m := range r.Messages {
+				size += sqsMessageSize(aws.ToString(m.Body), m.MessageAttributes)
+			}
+		}
+	case *sqs.DeleteMessageInput:
+		queueURL = aws.ToString(p.QueueUrl)
+	case *sqs.DeleteMessageBatchInput:
+		queueURL = aws.ToString(p.QueueUrl)
+	case *sqs.ChangeMessageVisibilityInput:
+		queueURL = aws.ToString(p.QueueUrl)
+	}
+	return cloudcost.SQS(size, isFIFOQueue(queueURL))
+}
+
+// sqsMessageSize is the billed size of a message: its body plus the names,
+// types and values of its attributes.
+func sqsMessageSize(body string, attrs map[string]sqstypes.MessageAttributeValue) int64 {
+	size := int64(len(body))
+	for name, v := range attrs {
+		size += int64(len(name) + len(aws.ToString(v.DataType)) + len(aws.ToString(v.StringValue)) + len(v.BinaryValue))
+	}
+	return size
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	"github.com/last9/opentelemetry-examples/go/common/errclass"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sdkErrors classifies the errors of every AWS SDK call.
+var sdkErrors = errclass.NewRecorder()
+
+// addErrorClassification adds the classification middleware to a client's
+// stack. Append it after otelaws so the span in the context is the one for
+// the call.
+func addErrorClassification(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("ErrorClassification", classifyError), middleware.After)
+}
+
+// classifyError sets error.category on the otelaws span of a failed call,
+// and counts it by service and operation. The error seen here is the final
+// one, after the SDK's retries.
+func classifyError(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	out, metadata, err := next.HandleInitialize(ctx, in)
+	if err != nil {
+		sdkErrors.Record(ctx, trace.SpanFromContext(ctx), err,
+			semconv.CloudProviderAWS,
+			semconv.RPCService(awsmiddleware.GetServiceID(ctx)),
+			semconv.RPCMethod(awsmiddleware.GetOperationName(ctx)),
+		)
+	}
+	return out, metadata, err
+}
+
+// errorCategoryAttr returns error.category for err, for spans that wrap
+// several SDK calls.
+func errorCategoryAttr(err error) attribute.KeyValue {
+	return errclass.AttributeKey.String(string(sdkErrors.Classify(err)))
+}
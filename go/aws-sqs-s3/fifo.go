@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultFIFOMessagesPerGroup = 3
+	maxFIFOGroups               = 10
+	maxFIFOMessagesPerGroup     = 10
+	fifoConsumeTimeout          = 30 * time.Second
+
+	// Message attributes identifying a message of a demo run. The sequence
+	// is the order the message was sent in within its group.
+	fifoRunAttr = "fifo-run"
+	fifoSeqAttr = "fifo-seq"
+)
+
+var defaultFIFOGroups = []string{"customer-1", "customer-2"}
+
+func isFIFOQueue(queueURL string) bool {
+	return strings.HasSuffix(queueURL, ".fifo")
+}
+
+// queueName returns the queue name from its URL.
+func queueName(queueURL string) string {
+	return queueURL[strings.LastIndex(queueURL, "/")+1:]
+}
+
+type fifoRequest struct {
+	QueueURL         string   `json:"queue_url"`
+	Groups           []string `json:"groups"`
+	MessagesPerGroup int      `json:"messages_per_group"`
+}
+
+type fifoGroupResult struct {
+	Group     string `json:"group"`
+	Sent      int    `json:"sent"`
+	Processed []int  `json:"processed"`
+	Ordered   bool   `json:"ordered"`
+}
+
+type fifoResult struct {
+	QueueURL string             `json:"queue_url"`
+	RunID    string             `json:"run_id"`
+	Groups   []*fifoGroupResult `json:"groups"`
+	// Stale counts messages left in the queue by earlier runs, and
+	// redeliveries. They are deleted so they don't hold up their message
+	// group.
+	Stale    int  `json:"stale"`
+	TimedOut bool `json:"timed_out"`
+}
+
+// fifoDemo sends messagesPerGroup messages to each group of a FIFO queue and
+// then consumes them, processing each group's messages in order.
+func fifoDemo(ctx context.Context, tracer trace.Tracer, queueURL string, groups []string, messagesPerGroup int) (*fifoResult, error) {
+	_, sqsc := newAWSClients(ctx)
+	result := &fifoResult{
+		QueueURL: queueURL,
+		RunID:    strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+
+	for _, group := range groups {
+		g := &fifoGroupResult{Group: group, Processed: []int{}, Ordered: true}
+		result.Groups = append(result.Groups, g)
+		for seq := 1; seq <= messagesPerGroup; seq++ {
+			if err := sendFIFOMessage(ctx, tracer, sqsc, queueURL, result.RunID, group, seq); err != nil {
+				return nil, err
+			}
+			g.Sent++
+		}
+	}
+
+	if err := consumeFIFO(ctx, tracer, sqsc, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// sendFIFOMessage sends one message to a group. The deduplication ID is
+// derived from the run, group and sequence, so a retried send is dropped by
+// SQS instead of being delivered twice.
+func sendFIFOMessage(ctx context.Context, tracer trace.Tracer, sqsc *sqs.Client, queueURL, runID, group string, seq int) error {
+	dedupID := fmt.Sprintf("%s-%s-%d", runID, group, seq)
+	ctx, span := tracer.Start(ctx, "send FIFO message",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingOperationTypePublish,
+			semconv.MessagingDestinationName(queueName(queueURL)),
+			semconv.MessagingMessageConversationID(group),
+			attribute.String("messaging.aws.sqs.message_deduplication_id", dedupID),
+			attribute.Int("fifo.sequence", seq),
+		))
+	defer span.End()
+
+	in := &sqs.SendMessageInput{
+		QueueUrl:               aws.String(queueURL),
+		MessageBody:            aws.String(fmt.Sprintf("%s message %d", group, seq)),
+		MessageGroupId:         aws.String(group),
+		MessageDeduplicationId: aws.String(dedupID),
+		MessageAttributes: map[string]sqstypes.MessageAttributeValue{
+			fifoRunAttr: {DataType: aws.String("String"), StringValue: aws.String(runID)},
+			fifoSeqAttr: {DataType: aws.String("Number"), StringValue: aws.String(strconv.Itoa(seq))},
+		},
+	}
+	injectIntoSQS(ctx, in)
+
+	out, err := sqsc.SendMessage(ctx, in)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "send failed")
+		span.SetAttributes(errorCategoryAttr(err))
+		return fmt.Errorf("sqs fifo send failed: %w", err)
+	}
+	span.SetAttributes(
+		semconv.MessagingMessageID(aws.ToString(out.MessageId)),
+		attribute.String("messaging.aws.sqs.sequence_number", aws.ToString(out.SequenceNumber)),
+	)
+	return nil
+}
+
+// consumeFIFO receives the messages of a run and hands each group's
+// messages to a worker of its own. Groups are processed in parallel, and the
+// messages of one group one after another.
+//
+// Each group gets a "process group" span whose children are the "process
+// FIFO message" spans in the order they ran, so a trace shows the order each
+// group was processed in. Message spans link to the span that sent them.
+func consumeFIFO(ctx context.Context, tracer trace.Tracer, sqsc *sqs.Client, result *fifoResult) error {
+	ctx, span := tracer.Start(ctx, "consume FIFO queue",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingOperationTypeReceive,
+			semconv.MessagingDestinationName(queueName(result.QueueURL)),
+		))
+	defer span.End()
+
+	var expected int64
+	var processed atomic.Int64
+	var wg sync.WaitGroup
+	workers := make(map[string]chan sqstypes.Message, len(result.Groups))
+	for _, g := range result.Groups {
+		expected += int64(g.Sent)
+		ch := make(chan sqstypes.Message, g.Sent)
+		workers[g.Group] = ch
+		wg.Add(1)
+		go func(g *fifoGroupResult) {
+			defer wg.Done()
+			processFIFOGroup(ctx, tracer, sqsc, result.QueueURL, g, ch, &processed)
+		}(g)
+	}
+	defer func() {
+		for _, ch := range workers {
+			close(ch)
+		}
+		wg.Wait()
+		span.SetAttributes(
+			attribute.Int64("fifo.messages.processed", processed.Load()),
+			attribute.Int("fifo.messages.stale", result.Stale),
+			attribute.Bool("fifo.timed_out", result.TimedOut),
+		)
+	}()
+
+	deadline := time.Now().Add(fifoConsumeTimeout)
+	for processed.Load() < expected {
+		if time.Now().After(deadline) {
+			result.TimedOut = true
+			span.AddEvent("fifo.consume_timeout")
+			return nil
+		}
+
+		// Use background context to avoid creating spans for polling
+		recv, err := sqsc.ReceiveMessage(context.Background(), &sqs.ReceiveMessageInput{
+			QueueUrl:              aws.String(result.QueueURL),
+			MaxNumberOfMessages:   10,
+			WaitTimeSeconds:       1,
+			MessageAttributeNames: []string{"All"},
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{
+				sqstypes.MessageSystemAttributeNameMessageGroupId,
+				sqstypes.MessageSystemAttributeNameSequenceNumber,
+				sqstypes.MessageSystemAttributeNameApproximateReceiveCount,
+			},
+		})
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, "receive failed")
+			span.SetAttributes(errorCategoryAttr(err))
+			return fmt.Errorf("sqs fifo receive failed: %w", err)
+		}
+
+		for _, m := range recv.Messages {
+			ch, ok := workers[m.Attributes[string(sqstypes.MessageSystemAttributeNameMessageGroupId)]]
+			if !ok || messageAttr(m, fifoRunAttr) != result.RunID {
+				result.Stale++
+				_, _ = sqsc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      aws.String(result.QueueURL),
+					ReceiptHandle: m.ReceiptHandle,
+				})
+				continue
+			}
+			select {
+			case ch <- m:
+			default:
+				// The group already got all its messages, so this is a
+				// redelivery
+				result.Stale++
+				_, _ = sqsc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+					QueueUrl:      aws.String(result.QueueURL),
+					ReceiptHandle: m.ReceiptHandle,
+				})
+			}
+		}
+	}
+	return nil
+}
+
+// processFIFOGroup processes the messages of one group in the order they
+// arrive, and records on the group span whether that matched the order they
+// were sent in.
+func processFIFOGroup(ctx context.Context, tracer trace.Tracer, sqsc *sqs.Client, queueURL string, g *fifoGroupResult, msgs <-chan sqstypes.Message, processed *atomic.Int64) {
+	var span trace.Span
+	defer func() {
+		if span != nil {
+			span.SetAttributes(
+				attribute.Int("fifo.group.messages", len(g.Processed)),
+				attribute.Bool("fifo.ordered", g.Ordered),
+			)
+			span.End()
+		}
+	}()
+
+	for m := range msgs {
+		if span == nil {
+			// Started on the first message, so the span covers the processing
+			// of the group and not the time spent sending
+			ctx, span = tracer.Start(ctx, "process group "+g.Group,
+				trace.WithAttributes(
+					semconv.MessagingSystemAWSSqs,
+					semconv.MessagingMessageConversationID(g.Group),
+				))
+		}
+
+		seq, _ := strconv.Atoi(messageAttr(m, fifoSeqAttr))
+		position := len(g.Processed) + 1
+		if seq != position {
+			g.Ordered = false
+			span.AddEvent("fifo.out_of_order", trace.WithAttributes(
+				attribute.Int("fifo.sequence.expected", position),
+				attribute.Int("fifo.sequence.received", seq),
+			))
+		}
+		processFIFOMessage(ctx, tracer, queueURL, g.Group, seq, position, m)
+		g.Processed = append(g.Processed, seq)
+
+		// Delete before taking the next message. SQS holds back the rest of
+		// the group until this one is deleted or its visibility times out.
+		_, _ = sqsc.DeleteMessage(ctx, &sqs.DeleteMessageInput{
+			QueueUrl:      aws.String(queueURL),
+			ReceiptHandle: m.ReceiptHandle,
+		})
+		processed.Add(1)
+
+		if len(g.Processed) == g.Sent {
+			return
+		}
+	}
+}
+
+func processFIFOMessage(ctx context.Context, tracer trace.Tracer, queueURL, group string, seq, position int, m sqstypes.Message) {
+	receiveCount, _ := strconv.Atoi(m.Attributes[string(sqstypes.MessageSystemAttributeNameApproximateReceiveCount)])
+	producer := trace.SpanContextFromContext(extractFromSQS(context.Background(), m))
+	_, span := tracer.Start(ctx, "process FIFO message",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.Link{SpanContext: producer}),
+		trace.WithAttributes(
+			semconv.MessagingSystemAWSSqs,
+			semconv.MessagingOperationTypeDeliver,
+			semconv.MessagingDestinationName(queueName(queueURL)),
+			semconv.MessagingMessageID(aws.ToString(m.MessageId)),
+			semconv.MessagingMessageConversationID(group),
+			attribute.String("messaging.aws.sqs.sequence_number", m.Attributes[string(sqstypes.MessageSystemAttributeNameSequenceNumber)]),
+			attribute.Int("messaging.aws.sqs.receive_count", receiveCount),
+			attribute.Int("fifo.sequence", seq),
+			attribute.Int("fifo.position", position),
+		))
+	defer span.End()
+
+	// Simulate work of varying length
+	time.Sleep(time.Duration(20+rand.Intn(60)) * time.Millisecond)
+}
+
+func messageAttr(m sqstypes.Message, name string) string {
+	if v, ok := m.MessageAttributes[name]; ok {
+		return aws.ToString(v.StringValue)
+	}
+	return ""
+}
@@ -3,6 +3,7 @@ package main
 import (
     "context"
     "fmt"
+    "io"
     "log"
     "os"
     "strings"
@@ -14,10 +15,13 @@ import (
     "github.com/aws/aws-sdk-go-v2/service/s3"
     "github.com/aws/aws-sdk-go-v2/service/sqs"
     sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+    "github.com/last9/opentelemetry-examples/go/common/spanname"
     otelaws "go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
     "go.opentelemetry.io/otel"
+    "go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
     "go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
     "go.opentelemetry.io/otel/propagation"
+    sdkmetric "go.opentelemetry.io/otel/sdk/metric"
     "go.opentelemetry.io/otel/sdk/resource"
     sdktrace "go.opentelemetry.io/otel/sdk/trace"
     semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -32,12 +36,7 @@ func mustGetenv(key string) string {
     return v
 }
 
-func initTracerProvider(ctx context.Context, serviceName string) *sdktrace.TracerProvider {
-    exporter, err := otlptracehttp.New(ctx)
-    if err != nil {
-        log.Fatalf("failed to create otlp http exporter: %v", err)
-    }
-
+func newResource(ctx context.Context, serviceName string) *resource.Resource {
     res, err := resource.New(ctx,
         resource.WithFromEnv(),
         resource.WithTelemetrySDK(),
@@ -52,6 +51,14 @@ func initTracerProvider(ctx context.Context, serviceName string) *sdktrace.Trace
     if err != nil {
         log.Fatalf("failed to create resource: %v", err)
     }
+    return res
+}
+
+func initTracerProvider(ctx context.Context, res *resource.Resource) *sdktrace.TracerProvider {
+    exporter, err := otlptracehttp.New(ctx)
+    if err != nil {
+        log.Fatalf("failed to create otlp http exporter: %v", err)
+    }
 
     tp := sdktrace.NewTracerProvider(
         sdktrace.WithBatcher(exporter),
@@ -63,6 +70,21 @@ func initTracerProvider(ctx context.Context, serviceName string) *sdktrace.Trace
     return tp
 }
 
+func initMeterProvider(ctx context.Context, res *resource.Resource) *sdkmetric.MeterProvider {
+    exporter, err := otlpmetrichttp.New(ctx)
+    if err != nil {
+        log.Fatalf("failed to create otlp metric http exporter: %v", err)
+    }
+
+    mp := sdkmetric.NewMeterProvider(
+        sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+        sdkmetric.WithResource(res),
+    )
+
+    otel.SetMeterProvider(mp)
+    return mp
+}
+
 func newAWSConfig(ctx context.Context) aws.Config {
     endpoint := os.Getenv("AWS_ENDPOINT_URL")
     if endpoint == "" {
@@ -72,6 +94,7 @@ func newAWSConfig(ctx context.Context) aws.Config {
         }
         // Enable OTel middleware for all AWS SDK v2 clients
         otelaws.AppendMiddlewares(&cfg.APIOptions)
+        cfg.APIOptions = append(cfg.APIOptions, addErrorClassification, addCostEstimates)
         return cfg
     }
 
@@ -87,20 +110,25 @@ func newAWSConfig(ctx context.Context) aws.Config {
         log.Fatalf("failed to load aws config (custom endpoint): %v", err)
     }
     otelaws.AppendMiddlewares(&cfg.APIOptions)
+    cfg.APIOptions = append(cfg.APIOptions, addErrorClassification, addCostEstimates)
     return cfg
 }
 
-func newAWSClients(ctx context.Context) (*s3.Client, *sqs.Client) {
-    cfg := newAWSConfig(ctx)
+func newS3Client(ctx context.Context, optFns ...func(*s3.Options)) *s3.Client {
     endpoint := os.Getenv("AWS_ENDPOINT_URL")
 
     // S3: enable path-style for Localstack-compatible endpoints
-    s3Client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+    optFns = append([]func(*s3.Options){func(o *s3.Options) {
         if endpoint != "" {
             o.UsePathStyle = true
         }
-    })
-    sqsClient := sqs.NewFromConfig(cfg)
+    }}, optFns...)
+    return s3.NewFromConfig(newAWSConfig(ctx), optFns...)
+}
+
+func newAWSClients(ctx context.Context) (*s3.Client, *sqs.Client) {
+    s3Client := newS3Client(ctx)
+    sqsClient := sqs.NewFromConfig(newAWSConfig(ctx))
     return s3Client, sqsClient
 }
 
@@ -186,15 +214,24 @@ func demo(ctx context.Context, bucket, key, queueURL string, tracer trace.Tracer
 }
 
 // TracingMiddleware creates a span for each inbound HTTP request and attaches it to the Gin context.
+// Spans are named by HTTP_SPAN_NAME_STRATEGY, "POST /upload" by default (see the spanname package).
 func TracingMiddleware() gin.HandlerFunc {
+    namer := spanname.FromEnv()
     return func(c *gin.Context) {
         tracer := otel.Tracer("aws-sqs-s3-demo")
-        spanName := fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path)
+        // Spans used to be named by the raw path, kept as http.span_name.legacy
+        spanName, nameAttrs := namer.Name(spanname.Request{
+            Method: c.Request.Method,
+            Route:  c.FullPath(),
+            Target: c.Request.URL.Path,
+            Legacy: fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path),
+        })
 
         ctx, span := tracer.Start(
             c.Request.Context(),
             spanName,
             trace.WithSpanKind(trace.SpanKindServer),
+            trace.WithAttributes(nameAttrs...),
         )
         defer span.End()
 
@@ -222,6 +259,11 @@ type demoRequest struct {
 }
 
 func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
+    uploads, err := newUploadTelemetry()
+    if err != nil {
+        return fmt.Errorf("failed to create upload telemetry: %w", err)
+    }
+
     r := gin.Default()
     r.Use(TracingMiddleware())
 
@@ -267,6 +309,87 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
         c.JSON(200, gin.H{"status": "ok", "bucket": bucket, "key": key, "queue_url": queueURL})
     })
 
+    // POST /fifo sends messages to several groups of a FIFO queue, then
+    // consumes them with one sequential worker per group
+    r.POST("/fifo", func(c *gin.Context) {
+        var req fifoRequest
+        _ = c.ShouldBindJSON(&req)
+
+        queueURL := req.QueueURL
+        if queueURL == "" {
+            queueURL = os.Getenv("SQS_FIFO_QUEUE_URL")
+        }
+        if !isFIFOQueue(queueURL) {
+            c.JSON(400, gin.H{"error": "missing or non-FIFO queue_url (json queue_url or env SQS_FIFO_QUEUE_URL, must end in .fifo)"})
+            return
+        }
+
+        groups := req.Groups
+        if len(groups) == 0 {
+            groups = defaultFIFOGroups
+        }
+        perGroup := req.MessagesPerGroup
+        if perGroup == 0 {
+            perGroup = defaultFIFOMessagesPerGroup
+        }
+        if len(groups) > maxFIFOGroups || perGroup < 0 || perGroup > maxFIFOMessagesPerGroup {
+            c.JSON(400, gin.H{"error": fmt.Sprintf("at most %d groups of %d messages", maxFIFOGroups, maxFIFOMessagesPerGroup)})
+            return
+        }
+
+        seen := map[string]bool{}
+        for _, g := range groups {
+            if g == "" || seen[g] {
+                c.JSON(400, gin.H{"error": "group names must be unique and non-empty"})
+                return
+            }
+            seen[g] = true
+        }
+
+        tracer := tp.Tracer("aws-sqs-s3-demo")
+        result, err := fifoDemo(c.Request.Context(), tracer, queueURL, groups, perGroup)
+        if err != nil {
+            c.JSON(500, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(200, result)
+    })
+
+    // POST /upload streams the request body to S3 as a multipart upload.
+    // Without a body it uploads size_mb (default 12) of random data.
+    r.POST("/upload", func(c *gin.Context) {
+        bucket := c.Query("bucket")
+        if bucket == "" {
+            bucket = os.Getenv("S3_BUCKET")
+        }
+        if bucket == "" {
+            c.JSON(400, gin.H{"error": "missing bucket (query bucket or env S3_BUCKET)"})
+            return
+        }
+
+        key := c.Query("key")
+        if key == "" {
+            key = fmt.Sprintf("uploads/%d.bin", time.Now().UnixNano())
+        }
+
+        var body io.Reader = c.Request.Body
+        if c.Request.ContentLength <= 0 {
+            generated, err := generatedBody(c.Query("size_mb"))
+            if err != nil {
+                c.JSON(400, gin.H{"error": err.Error()})
+                return
+            }
+            body = generated
+        }
+
+        result, err := uploadObject(c.Request.Context(), uploads, bucket, key, body)
+        if err != nil {
+            c.JSON(500, gin.H{"error": err.Error()})
+            return
+        }
+        c.JSON(200, result)
+    })
+
     port := os.Getenv("PORT")
     if port == "" {
         port = "8080"
@@ -277,10 +400,13 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 func main() {
     ctx := context.Background()
 
-    tp := initTracerProvider(ctx, "aws-sqs-s3-demo")
+    res := newResource(ctx, "aws-sqs-s3-demo")
+    tp := initTracerProvider(ctx, res)
+    mp := initMeterProvider(ctx, res)
     defer func() {
-        // give exporter a moment to flush
+        // give exporters a moment to flush
         _ = tp.Shutdown(context.Background())
+        _ = mp.Shutdown(context.Background())
     }()
 
     // If RUN_SERVER=true, start the Gin server. Otherwise, run one-shot CLI demo.
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultUploadPartSizeMB   = 5
+	defaultUploadConcurrency  = 3
+	defaultGeneratedObjectMB  = 12
+	maxGeneratedObjectMB      = 100
+	partAttemptEventName      = "s3.part.attempt"
+	uploadInstrumentationName = "aws-sqs-s3-demo"
+)
+
+// uploadTelemetry traces multipart uploads made with the S3 upload manager.
+//
+// The manager sends each part as its own UploadPart call, which otelaws
+// already wraps in a span under the upload span. The middleware added by
+// s3Options enriches those spans with the part number, size and retries,
+// and counts the bytes of every part that was stored.
+type uploadTelemetry struct {
+	tracer        trace.Tracer
+	bytesUploaded metric.Int64Counter
+}
+
+func newUploadTelemetry() (*uploadTelemetry, error) {
+	bytesUploaded, err := otel.Meter(uploadInstrumentationName).Int64Counter("s3.upload.bytes",
+		metric.WithDescription("Bytes stored in S3 by uploads, counted per part"),
+		metric.WithUnit("By"))
+	if err != nil {
+		return nil, err
+	}
+	return &uploadTelemetry{
+		tracer:        otel.Tracer(uploadInstrumentationName),
+		bytesUploaded: bytesUploaded,
+	}, nil
+}
+
+// partAttemptsKey holds a *int counting the attempts of one S3 call.
+type partAttemptsKey struct{}
+
+// s3Options adds the part middleware to an S3 client.
+func (t *uploadTelemetry) s3Options(o *s3.Options) {
+	o.APIOptions = append(o.APIOptions, t.addPartMiddleware)
+}
+
+func (t *uploadTelemetry) addPartMiddleware(stack *middleware.Stack) error {
+	// After otelaws, so the span in the context is the one for this call
+	if err := stack.Initialize.Add(middleware.InitializeMiddlewareFunc("UploadPartTracing", t.tracePart), middleware.After); err != nil {
+		return err
+	}
+	// After the retry middleware, so it runs once per attempt
+	return stack.Finalize.Insert(middleware.FinalizeMiddlewareFunc("UploadPartAttempt", recordPartAttempt), "Retry", middleware.After)
+}
+
+func (t *uploadTelemetry) tracePart(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (middleware.InitializeOutput, middleware.Metadata, error) {
+	var bucket string
+	var size int64
+	span := trace.SpanFromContext(ctx)
+	switch params := in.Parameters.(type) {
+	case *s3.UploadPartInput:
+		bucket, size = aws.ToString(params.Bucket), bodySize(params.Body, params.ContentLength)
+		span.SetAttributes(
+			semconv.AWSS3Bucket(bucket),
+			semconv.AWSS3Key(aws.ToString(params.Key)),
+			semconv.AWSS3UploadID(aws.ToString(params.UploadId)),
+			semconv.AWSS3PartNumber(int(aws.ToInt32(params.PartNumber))),
+			attribute.Int64("s3.part.size_bytes", size),
+		)
+	case *s3.PutObjectInput:
+		// Objects smaller than one part are sent with a single PutObject
+		bucket, size = aws.ToString(params.Bucket), bodySize(params.Body, params.ContentLength)
+		span.SetAttributes(
+			semconv.AWSS3Bucket(bucket),
+			semconv.AWSS3Key(aws.ToString(params.Key)),
+			attribute.Int64("s3.part.size_bytes", size),
+		)
+	default:
+		return next.HandleInitialize(ctx, in)
+	}
+
+	attempts := 0
+	out, metadata, err := next.HandleInitialize(context.WithValue(ctx, partAttemptsKey{}, &attempts), in)
+	span.SetAttributes(
+		attribute.Int("s3.part.attempts", attempts),
+		attribute.Int("s3.part.retries", max(attempts-1, 0)),
+	)
+	if err == nil {
+		t.bytesUploaded.Add(ctx, size, metric.WithAttributes(semconv.AWSS3Bucket(bucket)))
+	}
+	return out, metadata, err
+}
+
+// recordPartAttempt adds an event for each attempt at sending a part, so
+// retries show up on the part span with the error that caused them.
+func recordPartAttempt(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	attempts, ok := ctx.Value(partAttemptsKey{}).(*int)
+	if !ok {
+		return next.HandleFinalize(ctx, in)
+	}
+	*attempts++
+
+	out, metadata, err := next.HandleFinalize(ctx, in)
+	attrs := []attribute.KeyValue{attribute.Int("s3.part.attempt", *attempts)}
+	if err != nil {
+		attrs = append(attrs, attribute.String("error.message", err.Error()))
+	}
+	trace.SpanFromContext(ctx).AddEvent(partAttemptEventName, trace.WithAttributes(attrs...))
+	return out, metadata, err
+}
+
+// bodySize returns the size of a part body. The upload manager leaves
+// ContentLength unset but passes a seekable buffer.
+func bodySize(body io.Reader, contentLength *int64) int64 {
+	if contentLength != nil {
+		return *contentLength
+	}
+	s, ok := body.(io.Seeker)
+	if !ok {
+		return -1
+	}
+	cur, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return -1
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return -1
+	}
+	if _, err := s.Seek(cur, io.SeekStart); err != nil {
+		return -1
+	}
+	return end - cur
+}
+
+// countingReader counts the bytes read from the upload body.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type uploadResult struct {
+	Bucket   string `json:"bucket"`
+	Key      string `json:"key"`
+	UploadID string `json:"upload_id,omitempty"`
+	Parts    int    `json:"parts"`
+	Bytes    int64  `json:"bytes"`
+	Location string `json:"location"`
+}
+
+// uploadObject uploads body to S3 with the upload manager under an
+// "s3.multipart_upload" span.
+func uploadObject(ctx context.Context, t *uploadTelemetry, bucket, key string, body io.Reader) (*uploadResult, error) {
+	partSize := int64(getEnvInt("S3_UPLOAD_PART_SIZE_MB", defaultUploadPartSizeMB)) * 1024 * 1024
+	if partSize < manager.MinUploadPartSize {
+		partSize = manager.MinUploadPartSize
+	}
+	concurrency := getEnvInt("S3_UPLOAD_CONCURRENCY", defaultUploadConcurrency)
+
+	ctx, span := t.tracer.Start(ctx, "s3.multipart_upload",
+		trace.WithAttributes(
+			semconv.AWSS3Bucket(bucket),
+			semconv.AWSS3Key(key),
+			attribute.Int64("s3.upload.part_size_bytes", partSize),
+			attribute.Int("s3.upload.concurrency", concurrency),
+		))
+	defer span.End()
+
+	uploader := manager.NewUploader(newS3Client(ctx, t.s3Options), func(u *manager.Uploader) {
+		u.PartSize = partSize
+		u.Concurrency = concurrency
+	})
+
+	counter := &countingReader{r: body}
+	out, err := uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   counter,
+	})
+	span.SetAttributes(attribute.Int64("s3.upload.bytes", counter.n))
+	if err != nil {
+		var mu manager.MultiUploadFailure
+		if errors.As(err, &mu) {
+			span.SetAttributes(semconv.AWSS3UploadID(mu.UploadID()))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "upload failed")
+		span.SetAttributes(errorCategoryAttr(err))
+		return nil, fmt.Errorf("s3 upload failed: %w", err)
+	}
+
+	result := &uploadResult{
+		Bucket:   bucket,
+		Key:      key,
+		UploadID: out.UploadID,
+		Parts:    len(out.CompletedParts),
+		Bytes:    counter.n,
+		Location: out.Location,
+	}
+	if result.UploadID != "" {
+		span.SetAttributes(semconv.AWSS3UploadID(result.UploadID))
+	} else {
+		// Sent as one PutObject
+		result.Parts = 1
+	}
+	span.SetAttributes(attribute.Int("s3.upload.parts", result.Parts))
+	return result, nil
+}
+
+// generatedBody returns sizeMB of random data, for uploading without a
+// request body.
+func generatedBody(sizeMB string) (io.Reader, error) {
+	mb := defaultGeneratedObjectMB
+	if sizeMB != "" {
+		n, err := strconv.Atoi(sizeMB)
+		if err != nil || n <= 0 || n > maxGeneratedObjectMB {
+			return nil, fmt.Errorf("size_mb must be between 1 and %d", maxGeneratedObjectMB)
+		}
+		mb = n
+	}
+	return io.LimitReader(rand.Reader, int64(mb)*1024*1024), nil
+}
+
+func getEnvInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
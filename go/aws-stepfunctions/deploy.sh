@@ -0,0 +1,141 @@
+#!/bin/bash
+
+# Step Functions Deployment Script
+# Deploys the Lambda task and the state machine that calls it back with a
+# task token. Run the starter locally afterwards with the printed ARN.
+
+set -e
+
+# Load environment variables (copy .env.example to .env and update values)
+if [ -f .env ]; then
+    export $(grep -v '^#' .env | xargs)
+else
+    echo "Error: .env file not found. Please create it from .env.example"
+    exit 1
+fi
+
+ACCOUNT_ID=$(aws sts get-caller-identity --profile "$AWS_PROFILE" --query Account --output text)
+
+echo "🔨 Building Lambda task for Linux AMD64..."
+GOOS=linux GOARCH=amd64 go build -o bootstrap ./task
+
+echo "📦 Creating Lambda deployment package..."
+zip -q function.zip bootstrap collector-config.yaml
+
+echo "Creating IAM role for the Lambda task..."
+cat > lambda-trust-policy.json <<JSON
+{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": {"Service": "lambda.amazonaws.com"}, "Action": "sts:AssumeRole"}]
+}
+JSON
+
+# Logs, plus the task token callbacks
+cat > lambda-policy.json <<JSON
+{
+  "Version": "2012-10-17",
+  "Statement": [
+    {"Effect": "Allow", "Action": ["logs:CreateLogGroup", "logs:CreateLogStream", "logs:PutLogEvents"], "Resource": "arn:aws:logs:${AWS_REGION}:${ACCOUNT_ID}:*"},
+    {"Effect": "Allow", "Action": ["states:SendTaskSuccess", "states:SendTaskFailure"], "Resource": "*"}
+  ]
+}
+JSON
+
+LAMBDA_ROLE_NAME="${FUNCTION_NAME}-role"
+LAMBDA_ROLE_ARN=$(aws iam create-role \
+    --role-name "$LAMBDA_ROLE_NAME" \
+    --assume-role-policy-document file://lambda-trust-policy.json \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text 2>/dev/null || \
+    aws iam get-role \
+    --role-name "$LAMBDA_ROLE_NAME" \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text)
+
+aws iam put-role-policy \
+    --role-name "$LAMBDA_ROLE_NAME" \
+    --policy-name "${FUNCTION_NAME}-policy" \
+    --policy-document file://lambda-policy.json \
+    --profile "$AWS_PROFILE"
+
+echo "Creating IAM role for the state machine..."
+cat > states-trust-policy.json <<JSON
+{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Principal": {"Service": "states.amazonaws.com"}, "Action": "sts:AssumeRole"}]
+}
+JSON
+
+TASK_FUNCTION_ARN="arn:aws:lambda:${AWS_REGION}:${ACCOUNT_ID}:function:${FUNCTION_NAME}"
+cat > states-policy.json <<JSON
+{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Action": "lambda:InvokeFunction", "Resource": "${TASK_FUNCTION_ARN}"}]
+}
+JSON
+
+STATES_ROLE_NAME="${STATE_MACHINE_NAME}-role"
+STATES_ROLE_ARN=$(aws iam create-role \
+    --role-name "$STATES_ROLE_NAME" \
+    --assume-role-policy-document file://states-trust-policy.json \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text 2>/dev/null || \
+    aws iam get-role \
+    --role-name "$STATES_ROLE_NAME" \
+    --profile "$AWS_PROFILE" \
+    --query 'Role.Arn' \
+    --output text)
+
+aws iam put-role-policy \
+    --role-name "$STATES_ROLE_NAME" \
+    --policy-name "${STATE_MACHINE_NAME}-policy" \
+    --policy-document file://states-policy.json \
+    --profile "$AWS_PROFILE"
+
+echo "Waiting for IAM roles to propagate (10 seconds)..."
+sleep 10
+
+echo "☁️  Creating Lambda task..."
+aws lambda create-function \
+    --function-name "$FUNCTION_NAME" \
+    --runtime "$LAMBDA_RUNTIME" \
+    --role "$LAMBDA_ROLE_ARN" \
+    --handler bootstrap \
+    --zip-file fileb://function.zip \
+    --timeout "$LAMBDA_TIMEOUT" \
+    --memory-size "$LAMBDA_MEMORY" \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" \
+    --layers "$OTEL_LAYER_ARN" \
+    --tracing-config Mode=PassThrough \
+    --environment "Variables={
+        OTEL_SERVICE_NAME=$TASK_SERVICE_NAME,
+        OTEL_RESOURCE_ATTRIBUTES=$OTEL_RESOURCE_ATTRIBUTES,
+        OPENTELEMETRY_COLLECTOR_CONFIG_FILE=/var/task/collector-config.yaml
+    }" \
+    --architectures x86_64
+
+echo "☁️  Creating state machine..."
+sed "s|\${TASK_FUNCTION_ARN}|${TASK_FUNCTION_ARN}|" state-machine.json > state-machine.deploy.json
+STATE_MACHINE_ARN=$(aws stepfunctions create-state-machine \
+    --name "$STATE_MACHINE_NAME" \
+    --definition file://state-machine.deploy.json \
+    --role-arn "$STATES_ROLE_ARN" \
+    --region "$AWS_REGION" \
+    --profile "$AWS_PROFILE" \
+    --query 'stateMachineArn' \
+    --output text)
+
+echo ""
+echo "✅ Deployed successfully!"
+echo "Lambda task:   $TASK_FUNCTION_ARN"
+echo "State machine: $STATE_MACHINE_ARN"
+echo ""
+echo "🧪 Start the starter with:"
+echo "STATE_MACHINE_ARN=$STATE_MACHINE_ARN go run ./starter"
+
+# Cleanup
+rm -f lambda-trust-policy.json lambda-policy.json states-trust-policy.json states-policy.json state-machine.deploy.json
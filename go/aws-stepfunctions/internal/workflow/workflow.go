@@ -0,0 +1,61 @@
+// Package workflow holds the types shared by the starter and the Lambda task,
+// and the helpers that carry trace context through Step Functions.
+//
+// Step Functions has no message attributes or headers. The only thing that
+// reaches every state is the JSON input, so the W3C trace context travels as
+// a trace_context object inside it:
+//
+//	{"order": {...}, "trace_context": {"traceparent": "00-...", "baggage": "..."}}
+//
+// The state machine copies it into the Lambda payload next to the task token,
+// and the Lambda puts its own trace context in the result it sends back.
+package workflow
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// Order is the work item the state machine processes.
+type Order struct {
+	ID       string `json:"id"`
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// ExecutionInput is the input of a state machine execution.
+type ExecutionInput struct {
+	Order        Order             `json:"order"`
+	TraceContext map[string]string `json:"trace_context"`
+}
+
+// TaskPayload is the payload the ProcessOrder state invokes the Lambda with.
+type TaskPayload struct {
+	Order        Order             `json:"order"`
+	TraceContext map[string]string `json:"trace_context"`
+	// TaskToken identifies the waiting task. The execution stays in
+	// ProcessOrder until SendTaskSuccess or SendTaskFailure is called with it.
+	TaskToken string `json:"task_token"`
+}
+
+// TaskResult is sent with SendTaskSuccess and becomes $.result in the
+// execution output.
+type TaskResult struct {
+	OrderID      string            `json:"order_id"`
+	Status       string            `json:"status"`
+	TraceContext map[string]string `json:"trace_context"`
+}
+
+// InjectTraceContext returns the trace context of ctx as a JSON-friendly map.
+func InjectTraceContext(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	return carrier
+}
+
+// ExtractTraceContext returns ctx with the trace context from m.
+func ExtractTraceContext(ctx context.Context, m map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(m))
+}
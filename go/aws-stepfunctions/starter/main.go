@@ -0,0 +1,253 @@
+// Command starter is an HTTP API that starts state machine executions with
+// the trace context in their input, and reports execution status under the
+// same trace.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	sfntypes "github.com/aws/aws-sdk-go-v2/service/sfn/types"
+	"github.com/last9/opentelemetry-examples/go/aws-stepfunctions/internal/workflow"
+	otelaws "go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "aws-stepfunctions-starter"
+
+type server struct {
+	sfn             *sfn.Client
+	tracer          trace.Tracer
+	stateMachineARN string
+}
+
+func mustGetenv(key string) string {
+	v := os.Getenv(key)
+	if v == "" {
+		log.Fatalf("missing required env: %s", key)
+	}
+	return v
+}
+
+func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp http exporter: %v", err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithOS(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	)
+	if err != nil {
+		log.Fatalf("failed to create resource: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp
+}
+
+// startExecution handles POST /orders. The trace context of the start span
+// goes into the execution input, where the state machine and the Lambda task
+// read it.
+func (s *server) startExecution(w http.ResponseWriter, r *http.Request) {
+	var order workflow.Order
+	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+	if order.ID == "" {
+		order.ID = fmt.Sprintf("order-%d", time.Now().UnixNano())
+	}
+
+	ctx, span := s.tracer.Start(r.Context(), "start order workflow",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("order.id", order.ID),
+			attribute.String("aws.stepfunctions.state_machine.arn", s.stateMachineARN),
+		))
+	defer span.End()
+
+	input, err := json.Marshal(workflow.ExecutionInput{
+		Order:        order,
+		TraceContext: workflow.InjectTraceContext(ctx),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "marshal input failed")
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	// StartExecution: span auto-created by otelaws. The execution name is
+	// the order ID, so retries of the same order don't start twice
+	out, err := s.sfn.StartExecution(ctx, &sfn.StartExecutionInput{
+		StateMachineArn: aws.String(s.stateMachineARN),
+		Name:            aws.String(order.ID),
+		Input:           aws.String(string(input)),
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "start execution failed")
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+	span.SetAttributes(attribute.String("aws.stepfunctions.execution.arn", aws.ToString(out.ExecutionArn)))
+
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"execution_arn": aws.ToString(out.ExecutionArn),
+		"trace_id":      span.SpanContext().TraceID().String(),
+	})
+}
+
+// executionStatus handles GET /executions?arn=... The status lookup is
+// recorded in the execution's trace: its span is a child of the trace
+// context stored in the execution input, and links to the span of this
+// HTTP request, which may be in another trace.
+func (s *server) executionStatus(w http.ResponseWriter, r *http.Request) {
+	arn := r.URL.Query().Get("arn")
+	if arn == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "missing arn query parameter"})
+		return
+	}
+
+	// DescribeExecution: span auto-created by otelaws, in the request trace
+	desc, err := s.sfn.DescribeExecution(r.Context(), &sfn.DescribeExecutionInput{ExecutionArn: aws.String(arn)})
+	if err != nil {
+		var notFound *sfntypes.ExecutionDoesNotExist
+		if errors.As(err, &notFound) {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "execution not found"})
+			return
+		}
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	var input workflow.ExecutionInput
+	_ = json.Unmarshal([]byte(aws.ToString(desc.Input)), &input)
+	execCtx := workflow.ExtractTraceContext(context.Background(), input.TraceContext)
+
+	_, span := s.tracer.Start(execCtx, "order workflow status",
+		trace.WithLinks(trace.LinkFromContext(r.Context())),
+		trace.WithAttributes(
+			attribute.String("aws.stepfunctions.execution.arn", arn),
+			attribute.String("aws.stepfunctions.execution.status", string(desc.Status)),
+			attribute.String("order.id", input.Order.ID),
+			attribute.Bool("aws.stepfunctions.trace_context.present", len(input.TraceContext) > 0),
+		))
+	defer span.End()
+
+	resp := map[string]any{
+		"execution_arn": arn,
+		"status":        desc.Status,
+		"trace_id":      span.SpanContext().TraceID().String(),
+	}
+	if desc.StartDate != nil && desc.StopDate != nil {
+		duration := desc.StopDate.Sub(*desc.StartDate)
+		span.SetAttributes(attribute.Float64("aws.stepfunctions.execution.duration", duration.Seconds()))
+		resp["duration_ms"] = duration.Milliseconds()
+	}
+
+	switch desc.Status {
+	case sfntypes.ExecutionStatusSucceeded:
+		var output struct {
+			Result workflow.TaskResult `json:"result"`
+		}
+		if err := json.Unmarshal([]byte(aws.ToString(desc.Output)), &output); err == nil {
+			resp["result"] = output.Result
+			// Link to the task span that sent the callback
+			if task := trace.SpanContextFromContext(workflow.ExtractTraceContext(context.Background(), output.Result.TraceContext)); task.IsValid() {
+				span.AddLink(trace.Link{SpanContext: task, Attributes: []attribute.KeyValue{attribute.String("link.type", "task_callback")}})
+			}
+		}
+	case sfntypes.ExecutionStatusFailed, sfntypes.ExecutionStatusTimedOut, sfntypes.ExecutionStatusAborted:
+		span.SetAttributes(
+			attribute.String("aws.stepfunctions.execution.error", aws.ToString(desc.Error)),
+			attribute.String("aws.stepfunctions.execution.cause", aws.ToString(desc.Cause)),
+		)
+		span.SetStatus(codes.Error, "execution "+strings.ToLower(string(desc.Status)))
+		resp["error"] = aws.ToString(desc.Error)
+		resp["cause"] = aws.ToString(desc.Cause)
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func main() {
+	ctx := context.Background()
+
+	tp := initTracerProvider(ctx)
+	defer func() {
+		_ = tp.Shutdown(context.Background())
+	}()
+
+	// The SDK reads AWS_ENDPOINT_URL itself, so Step Functions Local needs
+	// no custom resolver
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		log.Fatalf("failed to load aws config: %v", err)
+	}
+	// Enable OTel middleware for all AWS SDK v2 clients
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+
+	s := &server{
+		sfn:             sfn.NewFromConfig(cfg),
+		tracer:          tp.Tracer(serviceName),
+		stateMachineARN: mustGetenv("STATE_MACHINE_ARN"),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", s.startExecution)
+	mux.HandleFunc("GET /executions", s.executionStatus)
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	log.Printf("listening on :%s", port)
+	if err := http.ListenAndServe(":"+port, otelhttp.NewHandler(mux, "stepfunctions-starter",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return r.Method + " " + r.URL.Path }),
+	)); err != nil {
+		log.Fatalf("server error: %v", err)
+	}
+}
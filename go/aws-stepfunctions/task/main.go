@@ -0,0 +1,186 @@
+// Command task is the Lambda behind the ProcessOrder state. It continues the
+// trace the starter put in the execution input, processes the order, and
+// calls back to Step Functions with the task token.
+//
+// The tracer setup is the one from aws/lambda-go: spans go to the ADOT
+// Collector layer on localhost:4317, which forwards them to Last9.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/sfn"
+	"github.com/last9/opentelemetry-examples/go/aws-stepfunctions/internal/workflow"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-lambda-go/otellambda"
+	otelaws "go.opentelemetry.io/contrib/instrumentation/github.com/aws/aws-sdk-go-v2/otelaws"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var sfnClient *sfn.Client
+
+// HandleRequest runs inside the span otellambda starts for the invocation.
+// Its parent is the starter's span, read from the payload by
+// payloadToCarrier.
+//
+// The state machine waits for the callback, not for this function to return,
+// so the result goes through SendTaskSuccess or SendTaskFailure. Both calls
+// are traced by otelaws.
+func HandleRequest(ctx context.Context, p workflow.TaskPayload) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(
+		attribute.String("order.id", p.Order.ID),
+		attribute.Bool("aws.stepfunctions.task_token.present", p.TaskToken != ""),
+		attribute.Bool("aws.stepfunctions.trace_context.present", len(p.TraceContext) > 0),
+	)
+	if p.TaskToken == "" {
+		return errors.New("payload has no task_token; invoke this function from the state machine")
+	}
+
+	if err := processOrder(ctx, p.Order); err != nil {
+		_, cbErr := sfnClient.SendTaskFailure(ctx, &sfn.SendTaskFailureInput{
+			TaskToken: aws.String(p.TaskToken),
+			Error:     aws.String("OrderRejected"),
+			Cause:     aws.String(err.Error()),
+		})
+		if cbErr != nil {
+			span.RecordError(cbErr)
+			span.SetStatus(codes.Error, "task failure callback failed")
+			return fmt.Errorf("send task failure: %w", cbErr)
+		}
+		span.AddEvent("stepfunctions.callback", trace.WithAttributes(attribute.String("aws.stepfunctions.callback", "failure")))
+		return nil
+	}
+
+	// The result carries this span's context, so the starter can link the
+	// execution output back to the task that produced it
+	out, err := json.Marshal(workflow.TaskResult{
+		OrderID:      p.Order.ID,
+		Status:       "processed",
+		TraceContext: workflow.InjectTraceContext(ctx),
+	})
+	if err != nil {
+		return fmt.Errorf("marshal task result: %w", err)
+	}
+	if _, err := sfnClient.SendTaskSuccess(ctx, &sfn.SendTaskSuccessInput{
+		TaskToken: aws.String(p.TaskToken),
+		Output:    aws.String(string(out)),
+	}); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "task success callback failed")
+		return fmt.Errorf("send task success: %w", err)
+	}
+	span.AddEvent("stepfunctions.callback", trace.WithAttributes(attribute.String("aws.stepfunctions.callback", "success")))
+	return nil
+}
+
+// processOrder simulates the work of the task. Orders without a positive
+// quantity are rejected, to show the failure callback.
+func processOrder(ctx context.Context, order workflow.Order) error {
+	_, span := otel.Tracer("aws-stepfunctions-task").Start(ctx, "process order",
+		trace.WithAttributes(
+			attribute.String("order.id", order.ID),
+			attribute.String("order.item", order.Item),
+			attribute.Int("order.quantity", order.Quantity),
+		))
+	defer span.End()
+
+	time.Sleep(100 * time.Millisecond)
+	if order.Quantity <= 0 {
+		err := fmt.Errorf("order %s has quantity %d", order.ID, order.Quantity)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "order rejected")
+		return err
+	}
+	return nil
+}
+
+// payloadToCarrier gives otellambda the trace context the state machine
+// copied into the payload. Without it the invocation span would start a new
+// trace.
+func payloadToCarrier(eventJSON []byte) propagation.TextMapCarrier {
+	var p workflow.TaskPayload
+	if err := json.Unmarshal(eventJSON, &p); err != nil {
+		return propagation.MapCarrier{}
+	}
+	return propagation.MapCarrier(p.TraceContext)
+}
+
+func initTracer() (*sdktrace.TracerProvider, error) {
+	// Create OTLP trace exporter that sends to localhost:4317 (ADOT Collector)
+	ctx := context.Background()
+	exporter, err := otlptracegrpc.New(ctx,
+		otlptracegrpc.WithEndpoint("localhost:4317"),
+		otlptracegrpc.WithInsecure(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OTLP trace exporter: %w", err)
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "aws-stepfunctions-task"
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithAttributes(
+			semconv.ServiceName(serviceName),
+		),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
+}
+
+func main() {
+	tp, err := initTracer()
+	if err != nil {
+		log.Fatalf("Failed to initialize tracer: %v", err)
+	}
+	defer func() {
+		if err := tp.Shutdown(context.Background()); err != nil {
+			log.Printf("Error shutting down tracer provider: %v", err)
+		}
+	}()
+
+	cfg, err := config.LoadDefaultConfig(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to load AWS config: %v", err)
+	}
+	otelaws.AppendMiddlewares(&cfg.APIOptions)
+	sfnClient = sfn.NewFromConfig(cfg)
+
+	// The Flusher ensures traces are sent before Lambda freezes
+	lambda.Start(otellambda.InstrumentHandler(HandleRequest,
+		otellambda.WithFlusher(tp),
+		otellambda.WithEventToCarrier(payloadToCarrier),
+		otellambda.WithPropagator(otel.GetTextMapPropagator()),
+	))
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/last9/opentelemetry-examples/go/batch-job"
+
+var regions = []string{"us-east", "us-west", "eu-central", "ap-south"}
+
+// order is one record the job reports on.
+type order struct {
+	Region string
+	Amount float64
+}
+
+// regionTotal is one line of the report.
+type regionTotal struct {
+	Region string  `json:"region"`
+	Orders int     `json:"orders"`
+	Total  float64 `json:"total"`
+}
+
+// job builds a daily sales report in three steps, each under its own span:
+// extract the orders, total them by region, and write the report.
+type job struct {
+	name      string
+	records   int
+	outputDir string
+	// stepDelay stands in for the I/O a real step waits on.
+	stepDelay time.Duration
+	// failStep, if set, is the step that fails, with failMode "error" or
+	// "panic", to show how failures reach the trace.
+	failStep string
+	failMode string
+
+	tracer      trace.Tracer
+	duration    metric.Float64Histogram
+	lastSuccess metric.Int64Gauge
+}
+
+func newJob(name string) (*job, error) {
+	meter := otel.Meter(scopeName)
+	duration, err := meter.Float64Histogram("job.run.duration",
+		metric.WithDescription("Duration of job runs, by job and outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	lastSuccess, err := meter.Int64Gauge("job.run.last_success",
+		metric.WithDescription("Unix time the job last completed successfully"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &job{
+		name:        name,
+		tracer:      otel.Tracer(scopeName),
+		duration:    duration,
+		lastSuccess: lastSuccess,
+	}, nil
+}
+
+// run runs the steps in order under the job's root span, and records the
+// run's duration and outcome. It ends the root span before returning, so the
+// span is complete when the caller flushes.
+func (j *job) run(ctx context.Context) (string, error) {
+	start := time.Now()
+	ctx, span := j.tracer.Start(ctx, j.name, trace.WithAttributes(
+		attribute.String("job.name", j.name),
+	))
+	defer span.End()
+
+	var orders []order
+	var totals []regionTotal
+	var path string
+	err := j.step(ctx, "extract", func(ctx context.Context, span trace.Span) error {
+		orders = extract(j.records)
+		span.SetAttributes(attribute.Int("job.records", len(orders)))
+		return nil
+	})
+	if err == nil {
+		err = j.step(ctx, "transform", func(ctx context.Context, span trace.Span) error {
+			totals = transform(orders)
+			span.SetAttributes(attribute.Int("job.groups", len(totals)))
+			return nil
+		})
+	}
+	if err == nil {
+		err = j.step(ctx, "load", func(ctx context.Context, span trace.Span) error {
+			var err error
+			path, err = load(j.outputDir, totals)
+			span.SetAttributes(attribute.String("file.path", path))
+			return err
+		})
+	}
+
+	// The span carries the exit code the process is about to exit with,
+	// and any code but 0 is an error
+	code := exitCode(ctx, err)
+	outcome := outcomeOf(code)
+	span.SetAttributes(
+		attribute.String("job.outcome", outcome),
+		attribute.Int("process.exit.code", code),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	jobName := attribute.String("job.name", j.name)
+	j.duration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(jobName, attribute.String("job.outcome", outcome)))
+	if err == nil {
+		j.lastSuccess.Record(ctx, time.Now().Unix(), metric.WithAttributes(jobName))
+	}
+	return path, err
+}
+
+// step runs fn under a span named after the step. It waits stepDelay first,
+// or until ctx is canceled, and turns a panic in fn into an error, so the
+// span ends and the run can still be flushed.
+func (j *job) step(ctx context.Context, name string, fn func(context.Context, trace.Span) error) (err error) {
+	ctx, span := j.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("job.name", j.name),
+		attribute.String("job.step", name),
+	))
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: panic: %v", name, r)
+		}
+		if err != nil {
+			span.RecordError(err, trace.WithStackTrace(true))
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	select {
+	case <-time.After(j.stepDelay):
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", name, context.Cause(ctx))
+	}
+
+	if name == j.failStep {
+		if j.failMode == "panic" {
+			panic("injected failure")
+		}
+		return fmt.Errorf("%s: injected failure", name)
+	}
+	return fn(ctx, span)
+}
+
+// outcomeOf is the job.outcome of a run that exits with code.
+func outcomeOf(code int) string {
+	switch {
+	case code == exitOK:
+		return "success"
+	case code > 128:
+		return "interrupted"
+	default:
+		return "failure"
+	}
+}
+
+func extract(n int) []order {
+	orders := make([]order, n)
+	for i := range orders {
+		orders[i] = order{
+			Region: regions[rand.IntN(len(regions))],
+			Amount: float64(rand.IntN(50_000)) / 100,
+		}
+	}
+	return orders
+}
+
+func transform(orders []order) []regionTotal {
+	byRegion := map[string]*regionTotal{}
+	for _, o := range orders {
+		t, ok := byRegion[o.Region]
+		if !ok {
+			t = &regionTotal{Region: o.Region}
+			byRegion[o.Region] = t
+		}
+		t.Orders++
+		t.Total += o.Amount
+	}
+	totals := make([]regionTotal, 0, len(byRegion))
+	for _, t := range byRegion {
+		totals = append(totals, *t)
+	}
+	sort.Slice(totals, func(a, b int) bool { return totals[a].Region < totals[b].Region })
+	return totals
+}
+
+// load writes the report to dir, named after the time of the run.
+func load(dir string, totals []regionTotal) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, "report-"+time.Now().UTC().Format("20060102T150405Z")+".json")
+	data, err := json.MarshalIndent(totals, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, data, 0o644)
+}
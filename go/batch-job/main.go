@@ -0,0 +1,182 @@
+// Short-lived job, such as a Kubernetes CronJob, that traces and measures
+// each run and exports everything before it exits.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exit codes. A run interrupted by a signal exits with 128 plus the
+// signal's number, as a shell would report it: 143 for SIGTERM.
+const (
+	exitOK     = 0
+	exitFailed = 1
+	exitConfig = 2
+)
+
+// interruptedError is the cause of the run's context being canceled by a
+// signal, such as the SIGTERM Kubernetes sends when the Job's
+// activeDeadlineSeconds passes or the pod is evicted.
+type interruptedError struct {
+	sig syscall.Signal
+}
+
+func (e *interruptedError) Error() string {
+	return "interrupted by " + e.sig.String()
+}
+
+// exitCode is the exit code of a run that ended with err, where ctx is the
+// run's context.
+func exitCode(ctx context.Context, err error) int {
+	var interrupted *interruptedError
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.As(context.Cause(ctx), &interrupted):
+		return 128 + int(interrupted.sig)
+	default:
+		return exitFailed
+	}
+}
+
+// telemetry holds the providers, so the run can be flushed before exit.
+type telemetry struct {
+	tp *sdktrace.TracerProvider
+	mp *sdkmetric.MeterProvider
+}
+
+// initTelemetry sets up tracing and metrics. The job exits long before a
+// batch or an export interval would end, so nothing is exported until flush.
+func initTelemetry(ctx context.Context) (*telemetry, error) {
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP metric exporter: %w", err)
+	}
+
+	// resource.Default() reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	res := resource.Default()
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	return &telemetry{tp: tp, mp: mp}, nil
+}
+
+// flush exports the spans and metrics recorded so far, then shuts the
+// providers down. ForceFlush reports export errors, such as an unreachable
+// endpoint, so a run whose telemetry was lost says so in its log.
+func (t *telemetry) flush(ctx context.Context) error {
+	return errors.Join(
+		t.tp.ForceFlush(ctx),
+		t.mp.ForceFlush(ctx),
+		t.tp.Shutdown(ctx),
+		t.mp.Shutdown(ctx),
+	)
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	// os.Exit skips deferred calls, so everything that has to run before
+	// exit, the flush above all, is deferred in run instead. Never call
+	// log.Fatal after initTelemetry: it exits without flushing.
+	os.Exit(run())
+}
+
+// run runs the job once and returns its exit code.
+func run() int {
+	j, err := newJob(getenv("JOB_NAME", "nightly-report"))
+	if err != nil {
+		log.Printf("create job: %v", err)
+		return exitConfig
+	}
+	j.records, err = strconv.Atoi(getenv("JOB_RECORDS", "10000"))
+	if err != nil || j.records < 0 {
+		log.Printf("JOB_RECORDS: want a count, got %q", os.Getenv("JOB_RECORDS"))
+		return exitConfig
+	}
+	j.stepDelay, err = time.ParseDuration(getenv("JOB_STEP_DELAY", "500ms"))
+	if err != nil {
+		log.Printf("JOB_STEP_DELAY: %v", err)
+		return exitConfig
+	}
+	flushTimeout, err := time.ParseDuration(getenv("FLUSH_TIMEOUT", "10s"))
+	if err != nil {
+		log.Printf("FLUSH_TIMEOUT: %v", err)
+		return exitConfig
+	}
+	j.outputDir = getenv("JOB_OUTPUT_DIR", "reports")
+	j.failStep = os.Getenv("JOB_FAIL_STEP")
+	j.failMode = getenv("JOB_FAIL_MODE", "error")
+
+	ctx := context.Background()
+	tel, err := initTelemetry(ctx)
+	if err != nil {
+		log.Printf("init telemetry: %v", err)
+		return exitConfig
+	}
+	defer func() {
+		// Runs after the job's root span has ended, also on failure and
+		// after a signal, within FLUSH_TIMEOUT. Keep it below the pod's
+		// terminationGracePeriodSeconds, or the flush is cut short by SIGKILL.
+		flushCtx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := tel.flush(flushCtx); err != nil {
+			log.Printf("telemetry flush: %v", err)
+		}
+	}()
+
+	// A signal cancels the run instead of killing the process, so the step
+	// in progress ends its span with the reason and the run is flushed
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+	go func() {
+		if sig, ok := <-sigs; ok {
+			cancel(&interruptedError{sig: sig.(syscall.Signal)})
+		}
+	}()
+
+	log.Printf("Running %s", j.name)
+	path, err := j.run(ctx)
+	code := exitCode(ctx, err)
+	if err != nil {
+		log.Printf("%s %s: %v (exit code %d)", j.name, outcomeOf(code), err, code)
+		return code
+	}
+	log.Printf("Wrote %s", path)
+	return code
+}
@@ -0,0 +1,22 @@
+package last9
+
+import (
+	"beego_example/last9/otelhttplib"
+
+	"github.com/beego/beego/v2/client/httplib"
+	beecontext "github.com/beego/beego/v2/server/web/context"
+)
+
+// InstrumentedHttplib returns an httplib request, instrumented by
+// otelhttplib, for a call made while handling ctx. Its client span is a child
+// of the request's server span, its trace context headers are injected, and
+// its status and duration are recorded:
+//
+//	var joke Joke
+//	err := last9.InstrumentedHttplib(c.Ctx, http.MethodGet, jokeURL).ToJSON(&joke)
+//
+// It saves passing ctx.Request.Context() by hand, which is easy to forget:
+// a request made with context.Background() starts a new trace.
+func InstrumentedHttplib(ctx *beecontext.Context, method, rawURL string, opts ...otelhttplib.Option) *httplib.BeegoHTTPRequest {
+	return otelhttplib.NewRequest(ctx.Request.Context(), rawURL, method, opts...)
+}
@@ -5,9 +5,11 @@ import (
 	"os"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -16,18 +18,11 @@ import (
 
 type Instrumentation struct {
 	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
 	Tracer         trace.Tracer
 }
 
-func initTracerProvider(serviceName string) *sdktrace.TracerProvider {
-	exporter, err := otlptracehttp.New(context.Background())
-
-	if err != nil {
-		panic(err)
-	}
-
-	var tracerProviderOpts []sdktrace.TracerProviderOption
-
+func newResource(serviceName string) *resource.Resource {
 	attr := resource.WithAttributes(
 		semconv.DeploymentEnvironmentKey.String("production"),
 		semconv.ServiceNameKey.String(serviceName),
@@ -42,10 +37,21 @@ func initTracerProvider(serviceName string) *sdktrace.TracerProvider {
 		resource.WithHost(),
 		attr)
 
+	if err != nil {
+		panic(err)
+	}
+	return resources
+}
+
+func initTracerProvider(resources *resource.Resource) *sdktrace.TracerProvider {
+	exporter, err := otlptracehttp.New(context.Background())
+
 	if err != nil {
 		panic(err)
 	}
 
+	var tracerProviderOpts []sdktrace.TracerProviderOption
+
 	tracerProviderOpts = append(tracerProviderOpts, sdktrace.WithResource(resources))
 	tracerProviderOpts = append(tracerProviderOpts, sdktrace.WithBatcher(exporter))
 
@@ -64,11 +70,29 @@ func initTracerProvider(serviceName string) *sdktrace.TracerProvider {
 	return tp
 }
 
+// initMeterProvider exports the HTTP client duration metrics recorded by
+// otelhttplib.
+func initMeterProvider(resources *resource.Resource) *sdkmetric.MeterProvider {
+	exporter, err := otlpmetrichttp.New(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(resources),
+	)
+	otel.SetMeterProvider(mp)
+	return mp
+}
+
 func NewInstrumentation(serviceName string) *Instrumentation {
-	tp := initTracerProvider(serviceName)
+	resources := newResource(serviceName)
+	tp := initTracerProvider(resources)
 
 	return &Instrumentation{
 		TracerProvider: tp,
+		MeterProvider:  initMeterProvider(resources),
 		Tracer:         tp.Tracer(serviceName),
 	}
 }
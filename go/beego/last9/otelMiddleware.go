@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
@@ -12,6 +13,7 @@ import (
 	"go.opentelemetry.io/otel/trace"
 
 	beego "github.com/beego/beego/v2/server/web"
+	beecontext "github.com/beego/beego/v2/server/web/context"
 )
 
 func httpStatusCodeToSpanStatus(code int) codes.Code {
@@ -31,43 +33,79 @@ func normalizePath(path string) string {
 	return path
 }
 
-// WrapBeegoHandler wraps a Beego handler/controller method with OpenTelemetry tracing.
-func WrapBeegoHandler(service string, handler func(ctx *beego.Controller)) func(ctx *beego.Controller) {
-	return func(ctx *beego.Controller) {
-		propagator := otel.GetTextMapPropagator()
-		carrier := propagation.HeaderCarrier(ctx.Ctx.Request.Header)
-		ctxReq := propagator.Extract(ctx.Ctx.Request.Context(), carrier)
+// FilterChain returns a Beego filter chain that traces every request the
+// server handles, including static files and requests that match no route:
+//
+//	beego.InsertFilterChain("*", last9.FilterChain("beego-app"))
+//
+// Filter chains wrap routing, so unlike a per-handler wrapper, the span
+// covers the router, other filters and the controller, and no handler can be
+// left untraced. Handlers get the span from ctx.Ctx.Request.Context().
+func FilterChain(service string) beego.FilterChain {
+	tracer := otel.Tracer(service)
+	// Spans are named by HTTP_SPAN_NAME_STRATEGY, "GET /users/:id" by
+	// default. They used to be named by path, kept as http.span_name.legacy
+	namer := spanname.FromEnv()
 
-		tracer := otel.Tracer(service)
-		spanName := normalizePath(ctx.Ctx.Request.URL.Path)
-		attrs := []attribute.KeyValue{
-			semconv.ServiceNameKey.String(service),
-			semconv.HTTPRequestMethodKey.String(ctx.Ctx.Request.Method),
-			semconv.HTTPRouteKey.String(ctx.Ctx.Request.URL.Path),
-			semconv.URLFullKey.String(ctx.Ctx.Request.URL.String()),
-			semconv.URLSchemeKey.String(ctx.Ctx.Request.URL.Scheme),
-		}
-		if ua := ctx.Ctx.Request.UserAgent(); ua != "" {
-			attrs = append(attrs, semconv.UserAgentOriginalKey.String(ua))
-		}
-		if host := ctx.Ctx.Request.Host; host != "" {
-			attrs = append(attrs, semconv.ServerAddressKey.String(host))
-		}
-		spanCtx, span := tracer.Start(ctxReq, spanName, trace.WithAttributes(attrs...), trace.WithSpanKind(trace.SpanKindServer))
-		defer func() {
-			status := ctx.Ctx.ResponseWriter.Status
-			span.SetAttributes(
-				semconv.HTTPResponseStatusCodeKey.Int(status),
-				attribute.String("otel.debug", "http-root"),
-			)
-			span.SetStatus(httpStatusCodeToSpanStatus(status), http.StatusText(status))
-			span.End()
-		}()
+	return func(next beego.FilterFunc) beego.FilterFunc {
+		return func(ctx *beecontext.Context) {
+			propagator := otel.GetTextMapPropagator()
+			carrier := propagation.HeaderCarrier(ctx.Request.Header)
+			ctxReq := propagator.Extract(ctx.Request.Context(), carrier)
+
+			// The chain runs before routing, so look the route up; the
+			// router sets RouterPattern only once it has matched
+			route := ""
+			if r, ok := beego.BeeApp.Handlers.FindRouter(ctx); ok {
+				route = r.GetPattern()
+			}
+			spanName, nameAttrs := namer.Name(spanname.Request{
+				Method: ctx.Request.Method,
+				Route:  route,
+				Target: ctx.Request.URL.Path,
+				Legacy: normalizePath(ctx.Request.URL.Path),
+			})
+			attrs := []attribute.KeyValue{
+				semconv.ServiceNameKey.String(service),
+				semconv.HTTPRequestMethodKey.String(ctx.Request.Method),
+				semconv.URLFullKey.String(ctx.Request.URL.String()),
+				semconv.URLSchemeKey.String(scheme(ctx.Request)),
+			}
+			if route != "" {
+				attrs = append(attrs, semconv.HTTPRouteKey.String(route))
+			}
+			if ua := ctx.Request.UserAgent(); ua != "" {
+				attrs = append(attrs, semconv.UserAgentOriginalKey.String(ua))
+			}
+			if host := ctx.Request.Host; host != "" {
+				attrs = append(attrs, semconv.ServerAddressKey.String(host))
+			}
+			attrs = append(attrs, nameAttrs...)
+			spanCtx, span := tracer.Start(ctxReq, spanName, trace.WithAttributes(attrs...), trace.WithSpanKind(trace.SpanKindServer))
+			defer span.End()
+
+			// Inject the span context into the request headers and Beego context
+			propagator.Inject(spanCtx, carrier)
+			ctx.Request = ctx.Request.WithContext(spanCtx)
 
-		// Inject the span context into the request headers and Beego context
-		propagator.Inject(spanCtx, carrier)
-		ctx.Ctx.Request = ctx.Ctx.Request.WithContext(spanCtx)
+			next(ctx)
+
+			// The response writer reports 0 when nothing set a status
+			status := ctx.ResponseWriter.Status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(status))
+			span.SetStatus(httpStatusCodeToSpanStatus(status), http.StatusText(status))
+		}
+	}
+}
 
-		handler(ctx)
+// scheme returns the scheme the request was served over. URL.Scheme is empty
+// for server requests.
+func scheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
 	}
+	return "http"
 }
@@ -0,0 +1,227 @@
+// Package otelhttplib instruments Beego's httplib client.
+//
+// It plugs into httplib's FilterChain, so every request made through a
+// BeegoHTTPRequest gets a client span, W3C trace context headers, a span
+// status derived from the response code and an http.client.request.duration
+// measurement:
+//
+//	req := otelhttplib.Get(ctx, "https://official-joke-api.appspot.com/random_joke")
+//	var joke Joke
+//	err := req.ToJSON(&joke)
+//
+// Existing requests can be instrumented with AddFilters:
+//
+//	req.AddFilters(otelhttplib.FilterChain())
+package otelhttplib
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/beego/beego/v2/client/httplib"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope name.
+const ScopeName = "beego_example/last9/otelhttplib"
+
+const (
+	defaultConnectTimeout   = 5 * time.Second
+	defaultReadWriteTimeout = 10 * time.Second
+)
+
+type config struct {
+	tracerProvider   trace.TracerProvider
+	meterProvider    metric.MeterProvider
+	propagators      propagation.TextMapPropagator
+	spanNameFormat   func(req *http.Request) string
+	connectTimeout   time.Duration
+	readWriteTimeout time.Duration
+}
+
+// Option configures the instrumentation.
+type Option func(*config)
+
+// WithTracerProvider sets the tracer provider. Defaults to the global one.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(c *config) { c.tracerProvider = tp }
+}
+
+// WithMeterProvider sets the meter provider. Defaults to the global one.
+func WithMeterProvider(mp metric.MeterProvider) Option {
+	return func(c *config) { c.meterProvider = mp }
+}
+
+// WithPropagators sets the propagators used to inject trace context.
+// Defaults to the global propagator.
+func WithPropagators(p propagation.TextMapPropagator) Option {
+	return func(c *config) { c.propagators = p }
+}
+
+// WithSpanNameFormatter overrides the default "HTTP <method>" span name.
+func WithSpanNameFormatter(f func(req *http.Request) string) Option {
+	return func(c *config) { c.spanNameFormat = f }
+}
+
+// WithTimeout sets the connect and read/write timeouts applied by NewRequest.
+// httplib's own defaults are 60s each, which is too long for most
+// service-to-service calls.
+func WithTimeout(connect, readWrite time.Duration) Option {
+	return func(c *config) {
+		c.connectTimeout = connect
+		c.readWriteTimeout = readWrite
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{
+		tracerProvider:   otel.GetTracerProvider(),
+		meterProvider:    otel.GetMeterProvider(),
+		propagators:      otel.GetTextMapPropagator(),
+		connectTimeout:   defaultConnectTimeout,
+		readWriteTimeout: defaultReadWriteTimeout,
+		spanNameFormat: func(req *http.Request) string {
+			return "HTTP " + req.Method
+		},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewRequest returns an instrumented httplib request bound to ctx. The span
+// started for the request is a child of the span in ctx.
+func NewRequest(ctx context.Context, rawURL, method string, opts ...Option) *httplib.BeegoHTTPRequest {
+	cfg := newConfig(opts)
+	return httplib.NewBeegoRequestWithCtx(ctx, rawURL, method).
+		SetTimeout(cfg.connectTimeout, cfg.readWriteTimeout).
+		AddFilters(filterChain(cfg))
+}
+
+// Get returns an instrumented GET request.
+func Get(ctx context.Context, rawURL string, opts ...Option) *httplib.BeegoHTTPRequest {
+	return NewRequest(ctx, rawURL, http.MethodGet, opts...)
+}
+
+// Post returns an instrumented POST request.
+func Post(ctx context.Context, rawURL string, opts ...Option) *httplib.BeegoHTTPRequest {
+	return NewRequest(ctx, rawURL, http.MethodPost, opts...)
+}
+
+// Put returns an instrumented PUT request.
+func Put(ctx context.Context, rawURL string, opts ...Option) *httplib.BeegoHTTPRequest {
+	return NewRequest(ctx, rawURL, http.MethodPut, opts...)
+}
+
+// Delete returns an instrumented DELETE request.
+func Delete(ctx context.Context, rawURL string, opts ...Option) *httplib.BeegoHTTPRequest {
+	return NewRequest(ctx, rawURL, http.MethodDelete, opts...)
+}
+
+// FilterChain returns an httplib filter that traces the request. Use it with
+// BeegoHTTPRequest.AddFilters or httplib.WithFilters for requests not created
+// through NewRequest.
+func FilterChain(opts ...Option) httplib.FilterChain {
+	return filterChain(newConfig(opts))
+}
+
+func filterChain(cfg *config) httplib.FilterChain {
+	tracer := cfg.tracerProvider.Tracer(ScopeName)
+	// The meter provider returns the same instrument for every request
+	duration, err := cfg.meterProvider.Meter(ScopeName).Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of HTTP client requests"),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(next httplib.Filter) httplib.Filter {
+		return func(ctx context.Context, req *httplib.BeegoHTTPRequest) (*http.Response, error) {
+			r := req.GetRequest()
+			attrs := requestAttributes(r)
+
+			ctx, span := tracer.Start(ctx, cfg.spanNameFormat(r),
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...),
+			)
+			defer span.End()
+
+			cfg.propagators.Inject(ctx, propagation.HeaderCarrier(r.Header))
+
+			start := time.Now()
+			resp, err := next(ctx, req)
+			elapsed := time.Since(start).Seconds()
+			if err != nil {
+				errType := semconv.ErrorTypeKey.String(fmt.Sprintf("%T", err))
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				// httplib may have failed before sending, so this is the URL
+				// as far as it was built
+				span.SetAttributes(errType, semconv.URLFull(r.URL.String()))
+				record(ctx, duration, elapsed, append(attrs, errType))
+				return resp, err
+			}
+
+			// httplib adds the query parameters to the URL when it sends the
+			// request, and the response's request is the last one after
+			// redirects, so url.full is what was actually requested
+			fullURL := r.URL
+			if resp.Request != nil {
+				fullURL = resp.Request.URL
+			}
+			span.SetAttributes(
+				semconv.URLFull(fullURL.String()),
+				semconv.HTTPResponseStatusCode(resp.StatusCode),
+			)
+			if resp.ContentLength >= 0 {
+				span.SetAttributes(semconv.HTTPResponseBodySize(int(resp.ContentLength)))
+			}
+			attrs = append(attrs, semconv.HTTPResponseStatusCode(resp.StatusCode))
+			// Per the HTTP client semantic conventions only 4xx and 5xx are
+			// errors; 2xx and 3xx leave the status unset.
+			if resp.StatusCode >= 400 {
+				errType := semconv.ErrorTypeKey.String(strconv.Itoa(resp.StatusCode))
+				span.SetStatus(codes.Error, http.StatusText(resp.StatusCode))
+				span.SetAttributes(errType)
+				attrs = append(attrs, errType)
+			}
+			record(ctx, duration, elapsed, attrs)
+			return resp, nil
+		}
+	}
+}
+
+func record(ctx context.Context, duration metric.Float64Histogram, seconds float64, attrs []attribute.KeyValue) {
+	if duration != nil {
+		duration.Record(ctx, seconds, metric.WithAttributes(attrs...))
+	}
+}
+
+// requestAttributes returns the low-cardinality request attributes shared by
+// the span and the duration metric. url.full is added to the span only.
+func requestAttributes(r *http.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(r.Method),
+		semconv.ServerAddress(r.URL.Hostname()),
+	}
+	if port := r.URL.Port(); port != "" {
+		if p, err := strconv.Atoi(port); err == nil {
+			attrs = append(attrs, semconv.ServerPort(p))
+		}
+	} else if r.URL.Scheme == "https" {
+		attrs = append(attrs, semconv.ServerPort(443))
+	} else if r.URL.Scheme == "http" {
+		attrs = append(attrs, semconv.ServerPort(80))
+	}
+	return attrs
+}
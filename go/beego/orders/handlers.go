@@ -0,0 +1,181 @@
+package orders
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	orm "github.com/beego/beego/v2/client/orm"
+	beego "github.com/beego/beego/v2/server/web"
+)
+
+var (
+	errNotFound     = errors.New("order not found")
+	errInvalidInput = errors.New("invalid input")
+	errNotPending   = errors.New("only pending orders can be cancelled")
+)
+
+// cancelTxName names the cancel transaction. The otelorm filter names the
+// spans of queries run inside it "<Method>#tx(cancel-order)".
+const cancelTxName = "cancel-order"
+
+// OrdersHandler serves orders through Beego ORM.
+type OrdersHandler struct {
+	orm orm.Ormer
+}
+
+// NewOrdersHandler must be called after Init has registered the database.
+func NewOrdersHandler() *OrdersHandler {
+	return &OrdersHandler{
+		orm: orm.NewOrm(),
+	}
+}
+
+type createInput struct {
+	UserEmail string `json:"user_email"`
+	Item      string `json:"item"`
+	Quantity  int    `json:"quantity"`
+}
+
+type updateInput struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// ListOrders returns the 50 most recent orders, with QueryTable.
+func (h *OrdersHandler) ListOrders(ctx *beego.Controller) {
+	var orders []Order
+	_, err := h.orm.QueryTable(new(Order)).
+		OrderBy("-id").
+		Limit(50).
+		AllWithCtx(ctx.Ctx.Request.Context(), &orders)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	if orders == nil {
+		orders = []Order{}
+	}
+	writeJSON(ctx, http.StatusOK, orders)
+}
+
+// GetOrder returns an order by ID, with Read.
+func (h *OrdersHandler) GetOrder(ctx *beego.Controller) {
+	id, err := orderID(ctx)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	order := Order{ID: id}
+	if err := h.orm.ReadWithCtx(ctx.Ctx.Request.Context(), &order); err != nil {
+		writeError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusOK, order)
+}
+
+// CreateOrder places a pending order, with Insert.
+func (h *OrdersHandler) CreateOrder(ctx *beego.Controller) {
+	var in createInput
+	if err := json.NewDecoder(ctx.Ctx.Request.Body).Decode(&in); err != nil || in.UserEmail == "" || in.Item == "" || in.Quantity <= 0 {
+		writeError(ctx, errInvalidInput)
+		return
+	}
+	order := Order{UserEmail: in.UserEmail, Item: in.Item, Quantity: in.Quantity, Status: StatusPending}
+	if _, err := h.orm.InsertWithCtx(ctx.Ctx.Request.Context(), &order); err != nil {
+		writeError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusCreated, order)
+}
+
+// UpdateOrder changes an order's item and quantity, with Update.
+func (h *OrdersHandler) UpdateOrder(ctx *beego.Controller) {
+	id, err := orderID(ctx)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	var in updateInput
+	if err := json.NewDecoder(ctx.Ctx.Request.Body).Decode(&in); err != nil || in.Item == "" || in.Quantity <= 0 {
+		writeError(ctx, errInvalidInput)
+		return
+	}
+	reqCtx := ctx.Ctx.Request.Context()
+	order := Order{ID: id, Item: in.Item, Quantity: in.Quantity}
+	n, err := h.orm.UpdateWithCtx(reqCtx, &order, "Item", "Quantity")
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	if n == 0 {
+		writeError(ctx, errNotFound)
+		return
+	}
+	if err := h.orm.ReadWithCtx(reqCtx, &order); err != nil {
+		writeError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusOK, order)
+}
+
+// CancelOrder cancels a pending order and records the change, in one
+// transaction: ReadForUpdate, Update and Insert, committed by DoTx, or rolled
+// back if any of them fails.
+func (h *OrdersHandler) CancelOrder(ctx *beego.Controller) {
+	id, err := orderID(ctx)
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	order := Order{ID: id}
+	txCtx := context.WithValue(ctx.Ctx.Request.Context(), orm.TxNameKey, cancelTxName)
+	err = h.orm.DoTxWithCtx(txCtx, func(txCtx context.Context, tx orm.TxOrmer) error {
+		if err := tx.ReadForUpdateWithCtx(txCtx, &order); err != nil {
+			return err
+		}
+		if order.Status != StatusPending {
+			return errNotPending
+		}
+		order.Status = StatusCancelled
+		if _, err := tx.UpdateWithCtx(txCtx, &order, "Status"); err != nil {
+			return err
+		}
+		_, err := tx.InsertWithCtx(txCtx, &OrderEvent{OrderID: order.ID, Status: order.Status})
+		return err
+	})
+	if err != nil {
+		writeError(ctx, err)
+		return
+	}
+	writeJSON(ctx, http.StatusOK, order)
+}
+
+func orderID(ctx *beego.Controller) (int64, error) {
+	id, err := strconv.ParseInt(ctx.Ctx.Input.Param(":id"), 10, 64)
+	if err != nil {
+		return 0, errInvalidInput
+	}
+	return id, nil
+}
+
+func writeJSON(ctx *beego.Controller, status int, v any) {
+	ctx.Ctx.Output.SetStatus(status)
+	ctx.Data["json"] = v
+	ctx.ServeJSON()
+}
+
+func writeError(ctx *beego.Controller, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, orm.ErrNoRows), errors.Is(err, errNotFound):
+		status, err = http.StatusNotFound, errNotFound
+	case errors.Is(err, errInvalidInput):
+		status = http.StatusBadRequest
+	case errors.Is(err, errNotPending):
+		status = http.StatusConflict
+	}
+	writeJSON(ctx, status, map[string]string{"error": err.Error()})
+}
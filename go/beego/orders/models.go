@@ -0,0 +1,56 @@
+// Package orders serves the /orm endpoints. Unlike the users endpoints, which
+// query through otelsql, it uses Beego ORM models, so every query goes
+// through the ORM filter chain and is traced by the otelorm filter registered
+// in main.
+package orders
+
+import (
+	"time"
+
+	orm "github.com/beego/beego/v2/client/orm"
+)
+
+// Order is an order placed by a user.
+type Order struct {
+	ID        int64     `orm:"pk;auto;column(id)" json:"id"`
+	UserEmail string    `orm:"size(255)" json:"user_email"`
+	Item      string    `orm:"size(255)" json:"item"`
+	Quantity  int       `json:"quantity"`
+	Status    string    `orm:"size(32)" json:"status"`
+	Created   time.Time `orm:"auto_now_add;type(datetime)" json:"created"`
+}
+
+// TableName keeps the ORM's table apart from the users example's tables.
+func (*Order) TableName() string { return "orm_orders" }
+
+// OrderEvent records a status change of an order. It is written in the same
+// transaction as the change.
+type OrderEvent struct {
+	ID      int64     `orm:"pk;auto;column(id)" json:"id"`
+	OrderID int64     `orm:"column(order_id);index" json:"order_id"`
+	Status  string    `orm:"size(32)" json:"status"`
+	Created time.Time `orm:"auto_now_add;type(datetime)" json:"created"`
+}
+
+func (*OrderEvent) TableName() string { return "orm_order_events" }
+
+// Order statuses.
+const (
+	StatusPending   = "pending"
+	StatusShipped   = "shipped"
+	StatusCancelled = "cancelled"
+)
+
+func init() {
+	orm.RegisterModel(new(Order), new(OrderEvent))
+}
+
+// Init registers dsn as the ORM's default database, with the plain lib/pq
+// driver rather than otelsql's, so the ORM's queries are traced by the
+// otelorm filter alone, and creates the tables if they don't exist.
+func Init(dsn string) error {
+	if err := orm.RegisterDataBase("default", "postgres", dsn); err != nil {
+		return err
+	}
+	return orm.RunSyncdb("default", false, false)
+}
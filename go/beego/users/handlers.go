@@ -1,126 +1,86 @@
 package users
 
 import (
-	"strconv"
-	// "go.opentelemetry.io/otel/attribute"
-	// oteltrace "go.opentelemetry.io/otel/trace"
-	"beego_example/last9"
+	"encoding/json"
+	"net/http"
 
 	beego "github.com/beego/beego/v2/server/web"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 )
 
+// UsersHandler adapts the shared users service to Beego controllers.
 type UsersHandler struct {
-	controller *UsersController
-	tracer     interface{} // Replace oteltrace.Tracer with interface{}
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController, t interface{}) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
-		tracer:     t,
+		service: s,
 	}
 }
 
-// Beego-compatible handlers
+// Beego-compatible handlers. They are traced by last9.FilterChain, which
+// puts the server span in ctx.Ctx.Request.Context().
 func (u *UsersHandler) GetUsersBeego(ctx *beego.Controller) {
-	last9.WrapBeegoHandler("beego-app", u.getUsersBeegoInner)(ctx)
-}
-
-func (u *UsersHandler) getUsersBeegoInner(ctx *beego.Controller) {
-	users, err := u.controller.GetUsers(ctx.Ctx.Request.Context())
+	users, err := u.service.List(ctx.Ctx.Request.Context())
 	if err != nil {
-		ctx.Ctx.Output.SetStatus(500)
-		ctx.Data["json"] = map[string]string{"error": "Failed to fetch users"}
-		ctx.ServeJSON()
+		writeError(ctx, err)
 		return
 	}
-	ctx.Ctx.Output.SetStatus(200)
-	ctx.Data["json"] = users
-	ctx.ServeJSON()
+	writeJSON(ctx, http.StatusOK, users)
 }
 
 func (u *UsersHandler) GetUserBeego(ctx *beego.Controller) {
-	last9.WrapBeegoHandler("beego-app", u.getUserBeegoInner)(ctx)
-}
-
-func (u *UsersHandler) getUserBeegoInner(ctx *beego.Controller) {
-	id := ctx.Ctx.Input.Param(":id")
-	user, err := u.controller.GetUser(ctx.Ctx.Request.Context(), id)
+	user, err := u.service.Get(ctx.Ctx.Request.Context(), ctx.Ctx.Input.Param(":id"))
 	if err != nil {
-		ctx.Ctx.Output.SetStatus(404)
-		ctx.Data["json"] = map[string]string{"message": "User not found"}
-		ctx.ServeJSON()
+		writeError(ctx, err)
 		return
 	}
-	ctx.Ctx.Output.SetStatus(200)
-	ctx.Data["json"] = user
-	ctx.ServeJSON()
+	writeJSON(ctx, http.StatusOK, user)
 }
 
 func (u *UsersHandler) CreateUserBeego(ctx *beego.Controller) {
-	last9.WrapBeegoHandler("beego-app", u.createUserBeegoInner)(ctx)
-}
-
-func (u *UsersHandler) createUserBeegoInner(ctx *beego.Controller) {
-	var newUser User
-	if err := ctx.ParseForm(&newUser); err != nil {
-		ctx.Ctx.Output.SetStatus(400)
-		ctx.Data["json"] = map[string]string{"error": "Invalid input data"}
-		ctx.ServeJSON()
+	var in commonusers.CreateInput
+	if err := json.NewDecoder(ctx.Ctx.Request.Body).Decode(&in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-	if err := u.controller.CreateUser(ctx.Ctx.Request.Context(), &newUser); err != nil {
-		ctx.Ctx.Output.SetStatus(500)
-		ctx.Data["json"] = map[string]string{"error": "Failed to create user"}
-		ctx.ServeJSON()
+	user, err := u.service.Create(ctx.Ctx.Request.Context(), in)
+	if err != nil {
+		writeError(ctx, err)
 		return
 	}
-	ctx.Ctx.Output.SetStatus(201)
-	ctx.Data["json"] = newUser
-	ctx.ServeJSON()
+	writeJSON(ctx, http.StatusCreated, user)
 }
 
 func (u *UsersHandler) UpdateUserBeego(ctx *beego.Controller) {
-	last9.WrapBeegoHandler("beego-app", u.updateUserBeegoInner)(ctx)
-}
-
-func (u *UsersHandler) updateUserBeegoInner(ctx *beego.Controller) {
-	idStr := ctx.Ctx.Input.Param(":id")
-	name := ctx.GetString("name")
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		ctx.Ctx.Output.SetStatus(400)
-		ctx.Data["json"] = map[string]string{"error": "Invalid user ID"}
-		ctx.ServeJSON()
+	var in commonusers.UpdateInput
+	if err := json.NewDecoder(ctx.Ctx.Request.Body).Decode(&in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-	user := u.controller.UpdateUser(ctx.Ctx.Request.Context(), id, name)
-	if user == nil {
-		ctx.Ctx.Output.SetStatus(404)
-		ctx.Data["json"] = map[string]string{"error": "User not found or update failed"}
-		ctx.ServeJSON()
+	user, err := u.service.Update(ctx.Ctx.Request.Context(), ctx.Ctx.Input.Param(":id"), in)
+	if err != nil {
+		writeError(ctx, err)
 		return
 	}
-	ctx.Ctx.Output.SetStatus(200)
-	ctx.Data["json"] = user
-	ctx.ServeJSON()
+	writeJSON(ctx, http.StatusOK, user)
 }
 
 func (u *UsersHandler) DeleteUserBeego(ctx *beego.Controller) {
-	last9.WrapBeegoHandler("beego-app", u.deleteUserBeegoInner)(ctx)
-}
-
-func (u *UsersHandler) deleteUserBeegoInner(ctx *beego.Controller) {
-	id := ctx.Ctx.Input.Param(":id")
-	user, err := u.controller.GetUser(ctx.Ctx.Request.Context(), id)
-	if err != nil || user == nil {
-		ctx.Ctx.Output.SetStatus(404)
-		ctx.Data["json"] = map[string]string{"error": "User not found"}
-		ctx.ServeJSON()
+	if err := u.service.Delete(ctx.Ctx.Request.Context(), ctx.Ctx.Input.Param(":id")); err != nil {
+		writeError(ctx, err)
 		return
 	}
-	// Here you would delete the user from DB and cache (not implemented)
-	ctx.Ctx.Output.SetStatus(204)
-	ctx.Data["json"] = map[string]string{"message": "User deleted (not really)"}
+	ctx.Ctx.Output.SetStatus(http.StatusNoContent)
+}
+
+func writeJSON(ctx *beego.Controller, status int, v any) {
+	ctx.Ctx.Output.SetStatus(status)
+	ctx.Data["json"] = v
 	ctx.ServeJSON()
 }
+
+func writeError(ctx *beego.Controller, err error) {
+	writeJSON(ctx, commonusers.StatusCode(err), commonusers.ErrorBody(err))
+}
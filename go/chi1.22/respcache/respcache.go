@@ -0,0 +1,324 @@
+// Package respcache caches GET responses in front of their handlers, and
+// traces what it did: every cached request's server span gets cache.status
+// hit, miss or stale, a counter by status gives the hit ratio, and writes
+// that invalidate responses do it in a span of their own.
+//
+//	cache := respcache.New(respcache.Config{Store: respcache.NewMemoryStore(), TTL: 30 * time.Second})
+//	r.With(cache.Middleware).Get("/users", h.GetUsers)
+//	r.With(cache.Invalidate("/users")).Post("/users", h.CreateUser)
+//
+// A response younger than TTL is a hit. Up to StaleTTL after that it is
+// stale: it is still served, and the handler runs again in the background to
+// replace it. Older responses are misses.
+package respcache
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the cache's spans and metrics.
+const ScopeName = "chi1.22/respcache"
+
+// The values of StatusKey.
+const (
+	StatusHit   = "hit"
+	StatusMiss  = "miss"
+	StatusStale = "stale"
+)
+
+// Attribute keys.
+const (
+	// StatusKey is set on the server span of every cached request, and on
+	// the lookup span.
+	StatusKey = attribute.Key("cache.status")
+	// BackendKey is the Store's Backend.
+	BackendKey = attribute.Key("cache.backend")
+	KeyKey     = attribute.Key("cache.key")
+	// AgeKey is the age of the response served, in seconds.
+	AgeKey = attribute.Key("cache.age")
+)
+
+// The instrument names.
+const (
+	// RequestsName counts cached requests, by cache.status, cache.backend
+	// and http.route. Hits and stale responses over all is the hit ratio.
+	// Unit {request}.
+	RequestsName = "http.server.cache.requests"
+	// InvalidationsName counts responses deleted by writes, by
+	// cache.backend and http.route, the route of the write. Unit {entry}.
+	InvalidationsName = "http.server.cache.invalidations"
+)
+
+// Config configures New.
+type Config struct {
+	Store Store
+	// TTL is how long a response is served as a hit.
+	TTL time.Duration
+	// StaleTTL is how long after TTL a response is still served, as stale,
+	// while it is revalidated.
+	StaleTTL time.Duration
+	// Route returns the http.route of a request, for the metrics. It
+	// defaults to chi's route pattern.
+	Route func(*http.Request) string
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+// Cache is a response cache. Share one between the routes it caches and the
+// routes that invalidate them.
+type Cache struct {
+	cfg           Config
+	tracer        trace.Tracer
+	requests      metric.Int64Counter
+	invalidations metric.Int64Counter
+
+	mu           sync.Mutex
+	revalidating map[string]bool
+}
+
+// New returns a Cache that keeps responses in cfg.Store.
+func New(cfg Config) *Cache {
+	if cfg.Route == nil {
+		cfg.Route = func(r *http.Request) string {
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				return rctx.RoutePattern()
+			}
+			return ""
+		}
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := cfg.MeterProvider.Meter(ScopeName)
+	c := &Cache{
+		cfg:          cfg,
+		tracer:       otel.Tracer(ScopeName),
+		revalidating: make(map[string]bool),
+	}
+	var err error
+	if c.requests, err = meter.Int64Counter(RequestsName,
+		metric.WithDescription("Requests to cached routes, by cache status"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	if c.invalidations, err = meter.Int64Counter(InvalidationsName,
+		metric.WithDescription("Cached responses deleted by writes"),
+		metric.WithUnit("{entry}")); err != nil {
+		otel.Handle(err)
+	}
+	return c
+}
+
+// Key is the cache key of a request: its path. The query is ignored, so
+// only cache routes whose responses don't depend on it.
+func Key(r *http.Request) string {
+	return r.URL.Path
+}
+
+// Middleware serves GET requests from the cache, and caches the 200
+// responses of the ones it can't serve. The X-Cache response header is the
+// cache status. Add it inside the HTTP instrumentation, with chi's With, so
+// the server span exists and the route is known when it runs.
+func (c *Cache) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		key := Key(r)
+		e, status := c.lookup(ctx, key)
+
+		trace.SpanFromContext(ctx).SetAttributes(StatusKey.String(status))
+		if c.requests != nil {
+			c.requests.Add(ctx, 1, metric.WithAttributes(
+				StatusKey.String(status),
+				BackendKey.String(c.cfg.Store.Backend()),
+				attribute.String("http.route", c.cfg.Route(r)),
+			))
+		}
+		w.Header().Set("X-Cache", strings.ToUpper(status))
+
+		if status == StatusMiss {
+			c.fill(ctx, key, w, r, next)
+			return
+		}
+		for name, values := range e.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Age", strconv.Itoa(int(time.Since(e.StoredAt).Seconds())))
+		w.WriteHeader(e.Status)
+		w.Write(e.Body)
+		if status == StatusStale {
+			c.revalidate(r, key, next)
+		}
+	})
+}
+
+// lookup gets key from the store, in a span. A store error is a miss, so the
+// request is still served.
+func (c *Cache) lookup(ctx context.Context, key string) (Entry, string) {
+	ctx, span := c.tracer.Start(ctx, "cache lookup", trace.WithAttributes(
+		KeyKey.String(key),
+		BackendKey.String(c.cfg.Store.Backend()),
+	))
+	defer span.End()
+
+	e, ok, err := c.cfg.Store.Get(ctx, key)
+	if err != nil {
+		span.RecordError(err)
+	}
+	status := StatusMiss
+	if ok {
+		age := time.Since(e.StoredAt)
+		status = StatusHit
+		if age >= c.cfg.TTL {
+			status = StatusStale
+		}
+		span.SetAttributes(AgeKey.Float64(age.Seconds()))
+	}
+	span.SetAttributes(StatusKey.String(status))
+	return e, status
+}
+
+// fill serves r with next, writing to w and to the cache at once.
+func (c *Cache) fill(ctx context.Context, key string, w http.ResponseWriter, r *http.Request, next http.Handler) {
+	ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	var body bytes.Buffer
+	ww.Tee(&body)
+	next.ServeHTTP(ww, r)
+	c.store(ctx, key, ww, body.Bytes())
+}
+
+// store caches a 200 response, without the X-Cache header, for TTL plus
+// StaleTTL. Responses that set cookies are per client, and not cached.
+func (c *Cache) store(ctx context.Context, key string, ww middleware.WrapResponseWriter, body []byte) {
+	if ww.Status() != http.StatusOK || ww.Header().Get("Set-Cookie") != "" {
+		return
+	}
+	ctx, span := c.tracer.Start(ctx, "cache store", trace.WithAttributes(
+		KeyKey.String(key),
+		BackendKey.String(c.cfg.Store.Backend()),
+	))
+	defer span.End()
+
+	header := ww.Header().Clone()
+	header.Del("X-Cache")
+	e := Entry{Status: ww.Status(), Header: header, Body: body, StoredAt: time.Now()}
+	if err := c.cfg.Store.Set(ctx, key, e, c.cfg.TTL+c.cfg.StaleTTL); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+// revalidate runs next again for a stale key in the background, once per key
+// at a time, and caches its response. It outlives the request, so its span
+// is the root of a trace of its own, linked to the request's.
+func (c *Cache) revalidate(r *http.Request, key string, next http.Handler) {
+	c.mu.Lock()
+	if c.revalidating[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.revalidating[key] = true
+	c.mu.Unlock()
+
+	ctx := detach(r.Context())
+	ctx, span := c.tracer.Start(ctx, "cache revalidate",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(r.Context())),
+		trace.WithAttributes(KeyKey.String(key), BackendKey.String(c.cfg.Store.Backend())),
+	)
+	r = r.Clone(ctx)
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.revalidating, key)
+			c.mu.Unlock()
+		}()
+		defer span.End()
+
+		ww := middleware.NewWrapResponseWriter(&discardWriter{header: make(http.Header)}, r.ProtoMajor)
+		var body bytes.Buffer
+		ww.Tee(&body)
+		next.ServeHTTP(ww, r)
+		if ww.Status() != http.StatusOK {
+			// The stale response stays until it expires
+			span.SetStatus(codes.Error, "revalidation got "+strconv.Itoa(ww.Status()))
+			return
+		}
+		c.store(ctx, key, ww, body.Bytes())
+	}()
+}
+
+// Invalidate returns middleware that deletes keys from the cache once the
+// handler has answered with a 2xx, in a span under the server span. Failed
+// writes change nothing, so they keep the cached responses.
+func (c *Cache) Invalidate(keys ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+			if ww.Status() < 200 || ww.Status() >= 300 {
+				return
+			}
+
+			ctx, span := c.tracer.Start(r.Context(), "cache invalidate", trace.WithAttributes(
+				attribute.StringSlice("cache.keys", keys),
+				BackendKey.String(c.cfg.Store.Backend()),
+			))
+			defer span.End()
+			n, err := c.cfg.Store.Delete(ctx, keys...)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			span.SetAttributes(attribute.Int("cache.invalidated", n))
+			if c.invalidations != nil && n > 0 {
+				c.invalidations.Add(ctx, int64(n), metric.WithAttributes(
+					BackendKey.String(c.cfg.Store.Backend()),
+					attribute.String("http.route", c.cfg.Route(r)),
+				))
+			}
+		})
+	}
+}
+
+// detach returns a context with ctx's values that isn't canceled with it.
+// chi reuses a request's routing context for another request once the
+// handler returns, so the copy gets its own.
+func detach(ctx context.Context) context.Context {
+	ctx = context.WithoutCancel(ctx)
+	rctx := chi.RouteContext(ctx)
+	if rctx == nil {
+		return ctx
+	}
+	copied := *rctx
+	copied.URLParams.Keys = append([]string(nil), rctx.URLParams.Keys...)
+	copied.URLParams.Values = append([]string(nil), rctx.URLParams.Values...)
+	copied.RoutePatterns = append([]string(nil), rctx.RoutePatterns...)
+	return context.WithValue(ctx, chi.RouteCtxKey, &copied)
+}
+
+// discardWriter is the ResponseWriter of a revalidation: there is no client.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header         { return w.header }
+func (w *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardWriter) WriteHeader(int)             {}
@@ -0,0 +1,125 @@
+package respcache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Entry is a cached response.
+type Entry struct {
+	Status   int         `json:"status"`
+	Header   http.Header `json:"header"`
+	Body     []byte      `json:"body"`
+	StoredAt time.Time   `json:"stored_at"`
+}
+
+// Store keeps cached responses. Get returns ok false for a key it doesn't
+// have. Delete returns the number of keys it removed.
+type Store interface {
+	Get(ctx context.Context, key string) (e Entry, ok bool, err error)
+	Set(ctx context.Context, key string, e Entry, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) (int, error)
+	// Backend is the cache.backend attribute: "memory" or "redis".
+	Backend() string
+}
+
+// MemoryStore keeps responses in the process. Each replica has its own, so a
+// write only invalidates the replica that served it.
+type MemoryStore struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+type memoryEntry struct {
+	Entry
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]memoryEntry)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[key]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	if time.Now().After(e.expires) {
+		delete(s.entries, key)
+		return Entry{}, false, nil
+	}
+	return e.Entry, true, nil
+}
+
+func (s *MemoryStore) Set(_ context.Context, key string, e Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = memoryEntry{Entry: e, expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, keys ...string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, key := range keys {
+		if _, ok := s.entries[key]; ok {
+			delete(s.entries, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Backend() string { return "memory" }
+
+// RedisStore keeps responses in Redis as JSON, under Prefix plus the key,
+// so replicas share them. Its commands are traced by the client's own
+// instrumentation.
+type RedisStore struct {
+	Client redis.Cmdable
+	Prefix string
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) (Entry, bool, error) {
+	data, err := s.Client.Get(ctx, s.Prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	var e Entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return Entry{}, false, err
+	}
+	return e, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, e Entry, ttl time.Duration) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return s.Client.Set(ctx, s.Prefix+key, data, ttl).Err()
+}
+
+func (s *RedisStore) Delete(ctx context.Context, keys ...string) (int, error) {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = s.Prefix + key
+	}
+	n, err := s.Client.Del(ctx, prefixed...).Result()
+	return int(n), err
+}
+
+func (s *RedisStore) Backend() string { return "redis" }
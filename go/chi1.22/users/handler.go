@@ -5,121 +5,88 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	oteltrace "go.opentelemetry.io/otel/trace"
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 )
 
+// UsersHandler adapts the shared users service to chi.
 type UsersHandler struct {
-	controller *UsersController
-	tracer     oteltrace.Tracer
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController, t oteltrace.Tracer) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
-		tracer:     t,
+		service: s,
 	}
 }
 
 func (u *UsersHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	ctx, span := u.tracer.Start(r.Context(), "GetUsers")
-	defer span.End()
-
-	users, err := u.controller.GetUsers(ctx)
+	users, err := u.service.List(r.Context())
 	if err != nil {
-        span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"error": "Failed to fetch users"}`, http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeJSON(w, http.StatusOK, users)
 }
 
 func (u *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	_, span := u.tracer.Start(r.Context(), "GetUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	user, err := u.controller.GetUser(r.Context(), id)
+	user, err := u.service.Get(r.Context(), chi.URLParam(r, "id"))
 	if err != nil {
-        span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, user)
 }
 
 func (u *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	_, span := u.tracer.Start(r.Context(), "CreateUser")
-	defer span.End()
-
-	var newUser User
-	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-        span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"error": "Invalid input data"}`, http.StatusBadRequest)
+	var in commonusers.CreateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
 		return
 	}
-
-	err := u.controller.CreateUser(r.Context(), &newUser)
+	user, err := u.service.Create(r.Context(), in)
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusInternalServerError)
-        span.SetStatus(codes.Error, err.Error())
-		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error()})
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(map[string]interface{}{"message": "User created successfully", "user": newUser})
+	writeJSON(w, http.StatusCreated, user)
 }
 
 func (u *UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	_, span := u.tracer.Start(r.Context(), "UpdateUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	var payload struct {
-		Name  *string `json:"name"`
-		Email *string `json:"email"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"message": "Invalid input data"}`, http.StatusBadRequest)
+	var in commonusers.UpdateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
 		return
 	}
-
-	updated, err := u.controller.UpdateUser(r.Context(), id, payload.Name, payload.Email)
+	user, err := u.service.Update(r.Context(), chi.URLParam(r, "id"), in)
 	if err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"message": "User not found"}`, http.StatusNotFound)
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updated)
+	writeJSON(w, http.StatusOK, user)
 }
 
 func (u *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	id := chi.URLParam(r, "id")
-	_, span := u.tracer.Start(r.Context(), "DeleteUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	if err := u.controller.DeleteUser(r.Context(), id); err != nil {
-		span.SetStatus(codes.Error, err.Error())
-		http.Error(w, `{"error": "Failed to delete user"}`, http.StatusInternalServerError)
+	if err := u.service.Delete(r.Context(), chi.URLParam(r, "id")); err != nil {
+		writeError(w, r, err)
 		return
 	}
-
 	w.WriteHeader(http.StatusNoContent)
 }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error response. Server errors are also recorded on
+// the request span, with the stack of the service operation that failed; the
+// service span already carries the error itself.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := commonusers.StatusCode(err)
+	if status >= http.StatusInternalServerError {
+		otelerr.Record(r.Context(), err)
+	}
+	writeJSON(w, status, commonusers.ErrorBody(err))
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// exportConfig is the app side of the pipeline: how spans are batched and
+// sent to the collector. Every field is read from the standard OTel
+// variable of the same meaning, and passed to the SDK explicitly, so the
+// report can show the settings a result was measured with.
+type exportConfig struct {
+	// Protocol is "grpc" or "http/protobuf", from OTEL_EXPORTER_OTLP_PROTOCOL.
+	Protocol string
+	// Gzip compresses export requests, from OTEL_EXPORTER_OTLP_COMPRESSION.
+	Gzip bool
+	// Timeout bounds one export request, retries included, from
+	// OTEL_EXPORTER_OTLP_TIMEOUT.
+	Timeout time.Duration
+
+	// The batch span processor: OTEL_BSP_SCHEDULE_DELAY,
+	// OTEL_BSP_EXPORT_TIMEOUT, OTEL_BSP_MAX_QUEUE_SIZE and
+	// OTEL_BSP_MAX_EXPORT_BATCH_SIZE, with the SDK's defaults.
+	BatchDelay    time.Duration
+	ExportTimeout time.Duration
+	MaxQueueSize  int
+	MaxBatchSize  int
+	// Blocking makes a full queue block span.End instead of dropping the
+	// span, from BSP_BLOCKING. It trades the app's latency for completeness.
+	Blocking bool
+}
+
+func exportConfigFromEnv() (exportConfig, error) {
+	cfg := exportConfig{
+		Protocol:      envLower("OTEL_EXPORTER_OTLP_PROTOCOL", "grpc"),
+		Timeout:       envMillis("OTEL_EXPORTER_OTLP_TIMEOUT", 10*time.Second),
+		BatchDelay:    envMillis("OTEL_BSP_SCHEDULE_DELAY", 5*time.Second),
+		ExportTimeout: envMillis("OTEL_BSP_EXPORT_TIMEOUT", 30*time.Second),
+		MaxQueueSize:  envInt("OTEL_BSP_MAX_QUEUE_SIZE", 2048),
+		MaxBatchSize:  envInt("OTEL_BSP_MAX_EXPORT_BATCH_SIZE", 512),
+		Blocking:      os.Getenv("BSP_BLOCKING") == "true",
+	}
+	switch c := envLower("OTEL_EXPORTER_OTLP_COMPRESSION", "gzip"); c {
+	case "gzip":
+		cfg.Gzip = true
+	case "none":
+	default:
+		return cfg, fmt.Errorf("OTEL_EXPORTER_OTLP_COMPRESSION %q: want gzip or none", c)
+	}
+	if cfg.Protocol != "grpc" && cfg.Protocol != "http/protobuf" {
+		return cfg, fmt.Errorf("OTEL_EXPORTER_OTLP_PROTOCOL %q: want grpc or http/protobuf", cfg.Protocol)
+	}
+	if cfg.MaxBatchSize > cfg.MaxQueueSize {
+		return cfg, fmt.Errorf("OTEL_BSP_MAX_EXPORT_BATCH_SIZE %d is larger than OTEL_BSP_MAX_QUEUE_SIZE %d", cfg.MaxBatchSize, cfg.MaxQueueSize)
+	}
+	return cfg, nil
+}
+
+func (c exportConfig) String() string {
+	compression := "none"
+	if c.Gzip {
+		compression = "gzip"
+	}
+	return fmt.Sprintf("protocol=%s compression=%s timeout=%s batch_delay=%s max_batch=%d max_queue=%d blocking=%t",
+		c.Protocol, compression, c.Timeout, c.BatchDelay, c.MaxBatchSize, c.MaxQueueSize, c.Blocking)
+}
+
+// newExporter returns the OTLP exporter for cfg, counting the bytes it puts
+// on the wire into m. Without OTEL_EXPORTER_OTLP_ENDPOINT it sends to the
+// collector of docker-compose.yaml, on the protocol's default port.
+func newExporter(ctx context.Context, cfg exportConfig, m *measurements) (sdktrace.SpanExporter, error) {
+	endpointSet := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+
+	if cfg.Protocol == "grpc" {
+		opts := []otlptracegrpc.Option{
+			otlptracegrpc.WithTimeout(cfg.Timeout),
+			otlptracegrpc.WithDialOption(grpc.WithStatsHandler(&wireCounter{m: m})),
+		}
+		if cfg.Gzip {
+			opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+		}
+		if !endpointSet {
+			opts = append(opts, otlptracegrpc.WithEndpointURL("http://localhost:4317"))
+		}
+		return otlptracegrpc.New(ctx, opts...)
+	}
+
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithTimeout(cfg.Timeout),
+		otlptracehttp.WithHTTPClient(&http.Client{Transport: &countingTransport{base: http.DefaultTransport, m: m}}),
+	}
+	if cfg.Gzip {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	} else {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.NoCompression))
+	}
+	if !endpointSet {
+		opts = append(opts, otlptracehttp.WithEndpointURL("http://localhost:4318/v1/traces"))
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+// batchOptions are the batch span processor's options for cfg.
+func batchOptions(cfg exportConfig) []sdktrace.BatchSpanProcessorOption {
+	opts := []sdktrace.BatchSpanProcessorOption{
+		sdktrace.WithBatchTimeout(cfg.BatchDelay),
+		sdktrace.WithExportTimeout(cfg.ExportTimeout),
+		sdktrace.WithMaxQueueSize(cfg.MaxQueueSize),
+		sdktrace.WithMaxExportBatchSize(cfg.MaxBatchSize),
+	}
+	if cfg.Blocking {
+		opts = append(opts, sdktrace.WithBlocking())
+	}
+	return opts
+}
+
+// loadConfig is the load the app generates.
+type loadConfig struct {
+	// Rate is requests per second, across all workers.
+	Rate     int
+	Duration time.Duration
+	Workers  int
+	// SpansPerRequest includes the request's root span.
+	SpansPerRequest int
+	// AttributesPerSpan sets span size, which is what compression acts on.
+	AttributesPerSpan int
+}
+
+func loadConfigFromEnv() loadConfig {
+	return loadConfig{
+		Rate:              max(envInt("LOAD_RATE", 500), 1),
+		Duration:          envDuration("LOAD_DURATION", 30*time.Second),
+		Workers:           max(envInt("LOAD_WORKERS", 4), 1),
+		SpansPerRequest:   max(envInt("LOAD_SPANS_PER_REQUEST", 5), 1),
+		AttributesPerSpan: max(envInt("LOAD_ATTRIBUTES_PER_SPAN", 8), 0),
+	}
+}
+
+func (c loadConfig) String() string {
+	return fmt.Sprintf("rate=%d/s duration=%s workers=%d spans_per_request=%d attributes_per_span=%d",
+		c.Rate, c.Duration, c.Workers, c.SpansPerRequest, c.AttributesPerSpan)
+}
+
+// envLower reads a variable whose values are case-insensitive, such as
+// gzip or GZIP.
+func envLower(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return strings.ToLower(v)
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+// envMillis reads an OTel duration variable, which is in milliseconds.
+func envMillis(key string, fallback time.Duration) time.Duration {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n >= 0 {
+		return time.Duration(n) * time.Millisecond
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,203 @@
+// Load generator that exports spans over OTLP to a collector, with the
+// exporter and batch span processor tuned from the environment, and reports
+// what exporting cost: spans dropped, batches, export latency, bytes on the
+// wire and CPU time. Run it against docker-compose.yaml's collector with
+// different settings to compare them.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// shutdownTimeout bounds the final flush of the queue after the load ends.
+const shutdownTimeout = 30 * time.Second
+
+func main() {
+	exportCfg, err := exportConfigFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	loadCfg := loadConfigFromEnv()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	m := &measurements{}
+	exporter, err := newExporter(ctx, exportCfg, m)
+	if err != nil {
+		log.Fatalf("create exporter: %v", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(envOr("OTEL_SERVICE_NAME", "collector-pipeline"))),
+	)
+	if err != nil {
+		log.Fatalf("create resource: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(countingProcessor{m: m}),
+		sdktrace.WithBatcher(meteredExporter{SpanExporter: exporter, m: m}, batchOptions(exportCfg)...),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	fmt.Printf("Export config  %s\n", exportCfg)
+	fmt.Printf("Load           %s\n\n", loadCfg)
+
+	runtime.GC()
+	cpuStart := cpuBusy()
+	start := time.Now()
+	requests, hotPath := generate(ctx, tp.Tracer("collector-pipeline"), loadCfg)
+	elapsed := time.Since(start)
+
+	// Shutdown exports what is still queued, so it counts toward the run
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := tp.Shutdown(shutdownCtx); err != nil {
+		log.Printf("tracer provider shutdown: %v; spans still queued are counted as dropped", err)
+	}
+	runtime.GC()
+	cpu := cpuBusy() - cpuStart
+
+	report(m, requests, elapsed, hotPath, cpu)
+}
+
+// generate sends requests at cfg.Rate, spread over cfg.Workers, until
+// cfg.Duration passes or ctx is canceled. Each request is a root span with
+// cfg.SpansPerRequest-1 children. It returns the number of requests and the
+// time spent starting, filling and ending their spans.
+func generate(ctx context.Context, tracer trace.Tracer, cfg loadConfig) (int64, time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, cfg.Duration)
+	defer cancel()
+
+	// Each worker paces its share of the rate from a fixed schedule, so a
+	// slow request is caught up on rather than lowering the rate
+	interval := time.Duration(float64(time.Second) * float64(cfg.Workers) / float64(cfg.Rate))
+	var requests, hotPath atomic.Int64
+	var wg sync.WaitGroup
+	for w := range cfg.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attrs := spanAttributes(cfg.AttributesPerSpan)
+			next := time.Now()
+			for i := 0; ; i++ {
+				if wait := time.Until(next); wait > 0 {
+					select {
+					case <-ctx.Done():
+						return
+					case <-time.After(wait):
+					}
+				} else if ctx.Err() != nil {
+					return
+				}
+				next = next.Add(interval)
+
+				start := time.Now()
+				request(ctx, tracer, cfg.SpansPerRequest, attrs, w, i)
+				hotPath.Add(int64(time.Since(start)))
+				requests.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	return requests.Load(), time.Duration(hotPath.Load())
+}
+
+// request records one request's spans. The attributes are built once per
+// worker, so the hot path measures the SDK, not the formatting of values.
+func request(ctx context.Context, tracer trace.Tracer, spans int, attrs []attribute.KeyValue, worker, n int) {
+	ctx, root := tracer.Start(ctx, "GET /orders/{id}",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodGet,
+			semconv.HTTPRoute("/orders/{id}"),
+			semconv.HTTPResponseStatusCode(200),
+			semconv.EnduserID("user-"+strconv.Itoa(worker)+"-"+strconv.Itoa(n%1000)),
+			// Removed by the collector's attributes processor
+			attribute.String("http.request.header.authorization", "Bearer demo-token"),
+		),
+		trace.WithAttributes(attrs...),
+	)
+	for i := 1; i < spans; i++ {
+		_, child := tracer.Start(ctx, childNames[i%len(childNames)], trace.WithAttributes(attrs...))
+		child.End()
+	}
+	root.End()
+}
+
+var childNames = []string{"orders.load", "db.query", "cache.get", "pricing.compute", "inventory.check"}
+
+// spanAttributes returns n attributes shaped like real ones: short keys,
+// and values that repeat across spans, as route names and IDs do, which is
+// what gzip compresses.
+func spanAttributes(n int) []attribute.KeyValue {
+	attrs := make([]attribute.KeyValue, n)
+	for i := range attrs {
+		attrs[i] = attribute.String(fmt.Sprintf("app.field_%d", i), fmt.Sprintf("value-%d-%s", i, "abcdefghijklmnop"[:i%16]))
+	}
+	return attrs
+}
+
+func report(m *measurements, requests int64, elapsed, hotPath, cpu time.Duration) {
+	ended, exported, failed := m.ended.Load(), m.exported.Load(), m.failed.Load()
+	dropped := ended - exported - failed
+	m.mu.Lock()
+	batches, errs, lastErr := len(m.exportLatencies), m.exportErrors, m.lastError
+	m.mu.Unlock()
+	wire := m.wireBytes.Load()
+
+	fmt.Printf("Requests       %d in %s (%.0f/s)\n", requests, elapsed.Round(100*time.Millisecond), float64(requests)/elapsed.Seconds())
+	fmt.Printf("Spans          ended %d, exported %d, failed %d, dropped %d (%.2f%%)\n", ended, exported, failed, dropped, percent(dropped, ended))
+	fmt.Printf("Batches        %d, avg %.0f spans, export latency p50 %s p99 %s, %d errors\n",
+		batches, ratio(exported+failed, int64(batches)), m.percentile(0.5).Round(10*time.Microsecond), m.percentile(0.99).Round(10*time.Microsecond), errs)
+	fmt.Printf("Wire           %.2f MB, %.1f B/span\n", float64(wire)/1e6, ratio(wire, exported+failed))
+	fmt.Printf("App hot path   %s per span (start, attributes, end)\n", perSpan(hotPath, ended))
+	fmt.Printf("CPU            %s busy, %s per span (Go runtime estimate, all goroutines)\n", cpu.Round(10*time.Millisecond), perSpan(cpu, ended))
+	if lastErr != nil {
+		fmt.Printf("\nLast export error: %v\n", lastErr)
+	}
+}
+
+func percent(n, total int64) float64 {
+	return 100 * ratio(n, total)
+}
+
+func ratio(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
+
+func perSpan(d time.Duration, spans int64) time.Duration {
+	if spans == 0 {
+		return 0
+	}
+	return (d / time.Duration(spans)).Round(10 * time.Nanosecond)
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"runtime/metrics"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/stats"
+)
+
+// measurements are what one run costs, collected at the points spans pass
+// through: ended by the app, exported in a batch, and written to the wire.
+type measurements struct {
+	ended     atomic.Int64
+	exported  atomic.Int64
+	failed    atomic.Int64
+	wireBytes atomic.Int64
+
+	mu sync.Mutex
+	// exportLatencies has one entry per batch, retries included.
+	exportLatencies []time.Duration
+	exportErrors    int
+	lastError       error
+}
+
+// countingProcessor counts the spans the app ends. Register it next to the
+// batch span processor: the difference between the spans it counts and the
+// spans exported is what the batch processor dropped.
+type countingProcessor struct {
+	m *measurements
+}
+
+func (p countingProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+func (p countingProcessor) OnEnd(sdktrace.ReadOnlySpan)                     { p.m.ended.Add(1) }
+func (p countingProcessor) Shutdown(context.Context) error                  { return nil }
+func (p countingProcessor) ForceFlush(context.Context) error                { return nil }
+
+// meteredExporter times every batch the batch span processor exports, and
+// counts its spans as exported or failed.
+type meteredExporter struct {
+	sdktrace.SpanExporter
+	m *measurements
+}
+
+func (e meteredExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	start := time.Now()
+	err := e.SpanExporter.ExportSpans(ctx, spans)
+	elapsed := time.Since(start)
+
+	e.m.mu.Lock()
+	e.m.exportLatencies = append(e.m.exportLatencies, elapsed)
+	if err != nil {
+		e.m.exportErrors++
+		e.m.lastError = err
+	}
+	e.m.mu.Unlock()
+	if err != nil {
+		e.m.failed.Add(int64(len(spans)))
+	} else {
+		e.m.exported.Add(int64(len(spans)))
+	}
+	return err
+}
+
+// countingTransport counts the bytes of OTLP/HTTP request bodies, after
+// compression, retries included.
+type countingTransport struct {
+	base http.RoundTripper
+	m    *measurements
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body = &countingBody{ReadCloser: req.Body, m: t.m}
+	}
+	return t.base.RoundTrip(req)
+}
+
+type countingBody struct {
+	io.ReadCloser
+	m *measurements
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.m.wireBytes.Add(int64(n))
+	return n, err
+}
+
+// wireCounter counts the bytes of OTLP/gRPC request messages, after
+// compression, as a gRPC stats handler.
+type wireCounter struct {
+	m *measurements
+}
+
+func (w *wireCounter) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context { return ctx }
+func (w *wireCounter) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+func (w *wireCounter) HandleConn(context.Context, stats.ConnStats) {}
+
+func (w *wireCounter) HandleRPC(_ context.Context, s stats.RPCStats) {
+	if out, ok := s.(*stats.OutPayload); ok {
+		w.m.wireBytes.Add(int64(out.WireLength))
+	}
+}
+
+// percentile returns the p-th percentile of the export latencies.
+func (m *measurements) percentile(p float64) time.Duration {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.exportLatencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(m.exportLatencies)
+	slices.Sort(sorted)
+	return sorted[int(p*float64(len(sorted)-1))]
+}
+
+// cpuBusy returns the CPU time the process has spent so far, as the Go
+// runtime estimates it: the time available to it minus the time it was
+// idle. It covers every goroutine, so it includes the batch span
+// processor's serialization and compression.
+func cpuBusy() time.Duration {
+	samples := []metrics.Sample{
+		{Name: "/cpu/classes/total:cpu-seconds"},
+		{Name: "/cpu/classes/idle:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindFloat64 || samples[1].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	busy := samples[0].Value.Float64() - samples[1].Value.Float64()
+	return time.Duration(busy * float64(time.Second))
+}
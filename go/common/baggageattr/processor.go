@@ -0,0 +1,101 @@
+// Package baggageattr copies allow-listed W3C baggage members onto spans.
+//
+// Baggage travels with the request across services, but it is not recorded
+// anywhere by default. Registering the SpanProcessor turns selected members,
+// such as tenant.id, into span attributes on every span started in the
+// request, including database and Redis client spans, without any
+// SetAttributes calls in handlers:
+//
+//	curl -H 'baggage: tenant.id=acme,user.plan=pro' localhost:8080/users
+//
+// Only keys on the allow-list are copied. Baggage is set by the caller, so
+// copying every member would let clients write arbitrary attributes.
+package baggageattr
+
+import (
+	"context"
+	"errors"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultKeys are the baggage members copied when no keys are given.
+var DefaultKeys = []string{"tenant.id", "user.plan"}
+
+// maxValueLen caps copied values so a client can't inflate every span.
+const maxValueLen = 128
+
+// SpanProcessor sets allow-listed baggage members from the parent context as
+// attributes on each span when it starts. The attribute key is the baggage
+// key.
+type SpanProcessor struct {
+	keys []string
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// NewSpanProcessor returns a SpanProcessor that copies keys, or DefaultKeys
+// if none are given.
+func NewSpanProcessor(keys ...string) *SpanProcessor {
+	if len(keys) == 0 {
+		keys = DefaultKeys
+	}
+	return &SpanProcessor{keys: append([]string(nil), keys...)}
+}
+
+// OnStart copies the allow-listed members present in parent's baggage.
+func (p *SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	bag := baggage.FromContext(parent)
+	if bag.Len() == 0 {
+		return
+	}
+
+	attrs := make([]attribute.KeyValue, 0, len(p.keys))
+	for _, k := range p.keys {
+		m := bag.Member(k)
+		if m.Key() == "" {
+			continue
+		}
+		attrs = append(attrs, attribute.String(k, truncate(m.Value(), maxValueLen)))
+	}
+	if len(attrs) > 0 {
+		s.SetAttributes(attrs...)
+	}
+}
+
+// truncate cuts v to at most n bytes, backing off to the start of a rune so
+// a multi-byte character isn't split into invalid UTF-8.
+func truncate(v string, n int) string {
+	if len(v) <= n {
+		return v
+	}
+	for n > 0 && !utf8.RuneStart(v[n]) {
+		n--
+	}
+	return v[:n]
+}
+
+// OnEnd does nothing; attributes can't be changed once a span has ended.
+func (p *SpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown does nothing.
+func (p *SpanProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (p *SpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// Register adds a SpanProcessor for keys to tp. tp is usually
+// otel.GetTracerProvider() after the provider has been set up, for example
+// after agent.Start(). It must be an SDK TracerProvider.
+func Register(tp trace.TracerProvider, keys ...string) error {
+	sdkTP, ok := tp.(*sdktrace.TracerProvider)
+	if !ok {
+		return errors.New("baggageattr: tracer provider is not an SDK TracerProvider")
+	}
+	sdkTP.RegisterSpanProcessor(NewSpanProcessor(keys...))
+	return nil
+}
@@ -0,0 +1,68 @@
+package baggageattr
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/otel/baggage"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		v    string
+		n    int
+		want string
+	}{
+		{"acme", 8, "acme"},
+		{"acme", 4, "acme"},
+		{"acme-corp", 4, "acme"},
+		// é is two bytes; cutting after its first byte drops it
+		{"café", 4, "caf"},
+		{"café", 5, "café"},
+		{"日本", 4, "日"},
+		{"日本", 2, ""},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.v, tt.n)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.v, tt.n, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q, which isn't valid UTF-8", tt.v, tt.n, got)
+		}
+	}
+}
+
+func TestOnStart(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(NewSpanProcessor("tenant.id")), sdktrace.WithSpanProcessor(sr))
+
+	// The value's last byte within maxValueLen is the first half of an é
+	long := "a" + strings.Repeat("é", maxValueLen)
+	tenant, err := baggage.NewMemberRaw("tenant.id", long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := baggage.NewMemberRaw("user.plan", "pro")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bag, err := baggage.New(tenant, plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := tp.Tracer("test").Start(baggage.ContextWithBaggage(context.Background(), bag), "op")
+	span.End()
+
+	attrs := sr.Ended()[0].Attributes()
+	if len(attrs) != 1 || attrs[0].Key != "tenant.id" {
+		t.Fatalf("got attributes %v, want only tenant.id", attrs)
+	}
+	if got, want := attrs[0].Value.AsString(), long[:maxValueLen-1]; got != want {
+		t.Errorf("tenant.id is %d bytes (%q), want %d", len(got), got, len(want))
+	}
+}
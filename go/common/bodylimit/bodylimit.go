@@ -0,0 +1,123 @@
+// Package bodylimit rejects oversized request bodies with 413 and records
+// each rejection on the request span and in a counter.
+//
+// http.MaxBytesReader alone protects the server, but the handler sees a read
+// error and usually answers 400, and nothing shows how often the limit is
+// hit. Here rejections are visible: the server span gets the body size and
+// limit, and http.server.request.body.rejected counts them, so a limit that
+// is too tight for real traffic shows up before users report it.
+//
+// Run the middleware inside the HTTP instrumentation so the server span
+// already exists:
+//
+//	limit := bodylimit.Middleware(1 << 20)
+//	mux.Handle("POST /users", limit(http.HandlerFunc(createUser)))
+package bodylimit
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the rejection counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/bodylimit"
+
+// DefaultLimit is the limit used when MAX_BODY_BYTES is not set.
+const DefaultLimit int64 = 1 << 20
+
+// How an oversized body was detected.
+const (
+	// ReasonContentLength means the declared Content-Length was over the
+	// limit, so the body was never read.
+	ReasonContentLength = "content_length"
+	// ReasonBodyRead means a body without Content-Length, such as a chunked
+	// upload, went over the limit while it was read.
+	ReasonBodyRead = "body_read"
+)
+
+// LimitFromEnv returns MAX_BODY_BYTES, or DefaultLimit if it is unset or not
+// a positive integer.
+func LimitFromEnv() int64 {
+	if n, err := strconv.ParseInt(os.Getenv("MAX_BODY_BYTES"), 10, 64); err == nil && n > 0 {
+		return n
+	}
+	return DefaultLimit
+}
+
+// Middleware returns middleware that answers 413 to requests whose body is
+// larger than limit bytes.
+//
+// A body without Content-Length is read up to limit bytes and replayed to the
+// handler, so handlers never see a truncated body. That buffers at most limit
+// bytes per request, which suits JSON APIs. Streaming uploads should wrap
+// their body with http.MaxBytesReader instead.
+func Middleware(limit int64) func(http.Handler) http.Handler {
+	rejected, err := otel.Meter(ScopeName).Int64Counter("http.server.request.body.rejected",
+		metric.WithDescription("Requests rejected because the body was over the size limit"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reject := func(size int64, reason string) {
+				span := trace.SpanFromContext(r.Context())
+				attrs := []attribute.KeyValue{
+					attribute.Int64("http.request.body.size", size),
+					attribute.Int64("http.request.body.limit", limit),
+					attribute.String("http.request.body.rejected_by", reason),
+				}
+				span.SetAttributes(attrs...)
+				span.AddEvent("request.body.rejected", trace.WithAttributes(attrs...))
+				if rejected != nil {
+					rejected.Add(r.Context(), 1, metric.WithAttributes(
+						attribute.String("http.request.method", r.Method),
+						attribute.String("http.request.body.rejected_by", reason),
+					))
+				}
+
+				w.Header().Set("Connection", "close")
+				writeError(w, http.StatusRequestEntityTooLarge,
+					`{"error":"request body too large","limit_bytes":`+strconv.FormatInt(limit, 10)+"}\n")
+			}
+
+			if r.ContentLength > limit {
+				reject(r.ContentLength, ReasonContentLength)
+				return
+			}
+			if r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody {
+				body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+				if err != nil {
+					writeError(w, http.StatusBadRequest, `{"error":"failed to read request body"}`+"\n")
+					return
+				}
+				if int64(len(body)) > limit {
+					// Only limit+1 bytes were read, so the size is a lower
+					// bound
+					reject(int64(len(body)), ReasonBodyRead)
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(body))
+				r.ContentLength = int64(len(body))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// writeError answers with status and the JSON body.
+func writeError(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	io.WriteString(w, body)
+}
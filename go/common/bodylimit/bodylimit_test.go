@@ -0,0 +1,64 @@
+package bodylimit
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// errReader fails every read, as a body does when the client goes away
+// mid-upload.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) { return 0, errors.New("connection reset by peer") }
+
+func TestMiddleware(t *testing.T) {
+	const limit = 8
+	tests := []struct {
+		name          string
+		body          io.Reader
+		contentLength int64
+		status        int
+		wantBody      string
+	}{
+		{name: "under the limit", body: strings.NewReader("12345678"), contentLength: 8, status: http.StatusOK, wantBody: "12345678"},
+		{name: "chunked under the limit", body: strings.NewReader("12345678"), contentLength: -1, status: http.StatusOK, wantBody: "12345678"},
+		{name: "content length over", body: strings.NewReader("123456789"), contentLength: 9, status: http.StatusRequestEntityTooLarge},
+		{name: "chunked over", body: strings.NewReader("123456789"), contentLength: -1, status: http.StatusRequestEntityTooLarge},
+		{name: "read error", body: errReader{}, contentLength: -1, status: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := Middleware(limit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				b, _ := io.ReadAll(r.Body)
+				got = string(b)
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/users", tt.body)
+			req.ContentLength = tt.contentLength
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.status)
+			}
+			if tt.status == http.StatusOK {
+				if got != tt.wantBody {
+					t.Errorf("handler read %q, want %q", got, tt.wantBody)
+				}
+				return
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type is %q, want application/json", ct)
+			}
+			var body map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body["error"] == nil {
+				t.Errorf("body %q isn't a JSON error: %v", rec.Body, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+// Package cloudcost estimates what cloud API calls cost and puts the
+// estimate on their spans, so a trace can be tied to spend.
+//
+// Estimates use public list prices for request charges only: AWS prices are
+// for us-east-1, and GCS prices for Standard storage in a region. Free
+// tiers, discounts, storage, data transfer and retried attempts are left
+// out, so the numbers are for comparing operations and spotting expensive
+// call patterns, not for reconciling a bill.
+//
+// Estimates are opt-in. NewRecorderFromEnv returns nil unless
+// CLOUD_COST_ESTIMATES is true, and a nil Recorder records nothing:
+//
+//	costs := cloudcost.NewRecorderFromEnv()
+//	costs.Record(ctx, span, cloudcost.S3("PutObject"), semconv.CloudProviderAWS)
+package cloudcost
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the cost counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/cloudcost"
+
+// Span and counter attributes.
+const (
+	// PricingClassKey is the price the call is billed at, such as
+	// s3.tier1 or pubsub.throughput.
+	PricingClassKey = attribute.Key("cloud.cost.pricing_class")
+	// BillableUnitsKey is how many units of the pricing class the call is
+	// billed for: requests, operations or bytes.
+	BillableUnitsKey = attribute.Key("cloud.cost.billable_units")
+	// EstimatedUSDKey is the estimated cost of the call in US dollars.
+	EstimatedUSDKey = attribute.Key("cloud.cost.estimated_usd")
+)
+
+// List prices, per unit.
+const (
+	s3Tier1PerRequest     = 0.005 / 1_000 // PUT, COPY, POST, LIST
+	s3Tier2PerRequest     = 0.0004 / 1_000
+	sqsStandardPerRequest = 0.40 / 1_000_000
+	sqsFIFOPerRequest     = 0.50 / 1_000_000
+	gcsClassAPerOperation = 0.05 / 10_000
+	gcsClassBPerOperation = 0.004 / 10_000
+	pubsubPerByte         = 40.0 / (1 << 40) // $40 per TiB
+)
+
+const (
+	// sqsChunkBytes is the payload size billed as one SQS request.
+	sqsChunkBytes = 64 * 1024
+	// pubsubMinBytes is the least Pub/Sub bills for a request.
+	pubsubMinBytes = 1000
+)
+
+// Estimate is the estimated cost of one call.
+type Estimate struct {
+	PricingClass string
+	Units        int64
+	USD          float64
+}
+
+// S3 returns the estimate for an S3 operation, such as PutObject. PUT,
+// COPY, POST and LIST requests are tier 1; deletes and aborted uploads are
+// free; everything else, such as GET and HEAD, is tier 2.
+func S3(operation string) Estimate {
+	switch {
+	case strings.HasPrefix(operation, "Delete"), operation == "AbortMultipartUpload":
+		return Estimate{PricingClass: "s3.free", Units: 1}
+	case strings.HasPrefix(operation, "Put"),
+		strings.HasPrefix(operation, "Copy"),
+		strings.HasPrefix(operation, "List"),
+		strings.HasPrefix(operation, "Create"),
+		strings.HasPrefix(operation, "UploadPart"),
+		operation == "CompleteMultipartUpload",
+		operation == "PostObject":
+		return Estimate{PricingClass: "s3.tier1", Units: 1, USD: s3Tier1PerRequest}
+	default:
+		return Estimate{PricingClass: "s3.tier2", Units: 1, USD: s3Tier2PerRequest}
+	}
+}
+
+// SQS returns the estimate for an SQS request with payloadBytes of messages
+// sent or received. Every 64 KiB of payload is billed as one request.
+func SQS(payloadBytes int64, fifo bool) Estimate {
+	units := max((payloadBytes+sqsChunkBytes-1)/sqsChunkBytes, 1)
+	if fifo {
+		return Estimate{PricingClass: "sqs.fifo", Units: units, USD: float64(units) * sqsFIFOPerRequest}
+	}
+	return Estimate{PricingClass: "sqs.standard", Units: units, USD: float64(units) * sqsStandardPerRequest}
+}
+
+// gcsClassB lists the read-only GCS JSON API methods. Deletes are free;
+// everything else changes state or lists and is Class A.
+var gcsClassB = map[string]bool{
+	"objects.get": true,
+	"buckets.get": true,
+}
+
+// GCS returns the estimate for operations calls of a GCS JSON API method,
+// such as objects.insert.
+func GCS(method string, operations int64) Estimate {
+	switch {
+	case strings.HasSuffix(method, ".delete"):
+		return Estimate{PricingClass: "gcs.free", Units: operations}
+	case gcsClassB[method]:
+		return Estimate{PricingClass: "gcs.class_b", Units: operations, USD: float64(operations) * gcsClassBPerOperation}
+	default:
+		return Estimate{PricingClass: "gcs.class_a", Units: operations, USD: float64(operations) * gcsClassAPerOperation}
+	}
+}
+
+// PubSub returns the estimate for a Pub/Sub publish or delivery of
+// messageBytes, the size of the data plus attributes. Pub/Sub bills
+// throughput with a 1000-byte minimum per request.
+func PubSub(messageBytes int64) Estimate {
+	units := max(messageBytes, pubsubMinBytes)
+	return Estimate{PricingClass: "pubsub.throughput", Units: units, USD: float64(units) * pubsubPerByte}
+}
+
+// Recorder records estimates on spans and in the cloud.cost.estimated
+// counter.
+type Recorder struct {
+	cost metric.Float64Counter
+}
+
+// NewRecorder returns a Recorder.
+func NewRecorder() *Recorder {
+	cost, err := otel.Meter(ScopeName).Float64Counter("cloud.cost.estimated",
+		metric.WithDescription("Estimated cost of cloud API calls, in US dollars"),
+		metric.WithUnit("{USD}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &Recorder{cost: cost}
+}
+
+// EnabledFromEnv reports whether CLOUD_COST_ESTIMATES is true.
+func EnabledFromEnv() bool {
+	enabled, _ := strconv.ParseBool(os.Getenv("CLOUD_COST_ESTIMATES"))
+	return enabled
+}
+
+// NewRecorderFromEnv returns a Recorder if CLOUD_COST_ESTIMATES is true, and
+// nil otherwise.
+func NewRecorderFromEnv() *Recorder {
+	if !EnabledFromEnv() {
+		return nil
+	}
+	return NewRecorder()
+}
+
+// Record sets the estimate on span and adds its cost to the counter with
+// attrs, such as cloud.provider and the operation, plus the pricing class.
+// A nil Recorder records nothing.
+func (r *Recorder) Record(ctx context.Context, span trace.Span, est Estimate, attrs ...attribute.KeyValue) {
+	if r == nil {
+		return
+	}
+	span.SetAttributes(
+		PricingClassKey.String(est.PricingClass),
+		BillableUnitsKey.Int64(est.Units),
+		EstimatedUSDKey.Float64(est.USD),
+	)
+	if r.cost != nil {
+		r.cost.Add(ctx, est.USD, metric.WithAttributes(append(attrs[:len(attrs):len(attrs)], PricingClassKey.String(est.PricingClass))...))
+	}
+}
@@ -0,0 +1,239 @@
+// Package connmetrics records what an HTTP client spends on connections, from
+// httptrace callbacks: DNS lookup and TLS handshake durations, how often a
+// request reuses a pooled connection, and time to first byte. otelhttptrace
+// puts the same events on one request's client span; these are their
+// aggregates, so a dependency that got slow to resolve or to connect can be
+// told from one that got slow to answer.
+//
+// It is a transport, under the client's instrumentation:
+//
+//	client := httpagent.NewClient(&http.Client{
+//	    Transport: connmetrics.NewTransport(http.DefaultTransport, connmetrics.Config{}),
+//	})
+//
+// Share one client, or at least its transport, between requests: a client
+// per request has a connection pool per request, and never reuses a
+// connection.
+package connmetrics
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ScopeName is the instrumentation scope of the connection metrics.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/connmetrics"
+
+// The instrument names. Each has server.address and server.port.
+const (
+	// DNSDurationName is a histogram of DNS lookups, with error.type if the
+	// lookup failed. Unit s.
+	DNSDurationName = "dns.lookup.duration"
+	// TLSDurationName is a histogram of TLS handshakes, with error.type if
+	// the handshake failed. Unit s.
+	TLSDurationName = "http.client.tls.handshake.duration"
+	// ConnectionsName counts the connections requests got, by ReusedKey.
+	// Reused over all is the reuse ratio. Unit {connection}.
+	ConnectionsName = "http.client.connection.acquired"
+	// TimeToFirstByteName is a histogram of the time from the start of a
+	// request, connection setup included, to the first byte of its response,
+	// by http.request.method. Unit s.
+	TimeToFirstByteName = "http.client.time_to_first_byte"
+)
+
+// ReusedKey is whether a request got a connection from the pool, rather
+// than a new one.
+const ReusedKey = attribute.Key("http.connection.reused")
+
+// Bucket boundaries, in seconds. The SDK's defaults are for milliseconds,
+// and would put every lookup and handshake in the first bucket.
+var (
+	setupBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	ttfbBuckets  = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+)
+
+// Config configures NewTransport.
+type Config struct {
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+type instruments struct {
+	dns         metric.Float64Histogram
+	tls         metric.Float64Histogram
+	connections metric.Int64Counter
+	ttfb        metric.Float64Histogram
+}
+
+// Transport is an http.RoundTripper that records the connection metrics of
+// the requests it sends through its base transport.
+type Transport struct {
+	base http.RoundTripper
+	inst instruments
+}
+
+// NewTransport returns a Transport that sends requests through base, or
+// http.DefaultTransport if base is nil. The metrics come from httptrace
+// hooks added to each request's context; hooks already there, such as
+// otelhttptrace's, still run.
+func NewTransport(base http.RoundTripper, cfg Config) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := cfg.MeterProvider.Meter(ScopeName)
+	t := &Transport{base: base}
+	var err error
+	if t.inst.dns, err = meter.Float64Histogram(DNSDurationName,
+		metric.WithDescription("Duration of DNS lookups for HTTP client connections"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(setupBuckets...)); err != nil {
+		otel.Handle(err)
+	}
+	if t.inst.tls, err = meter.Float64Histogram(TLSDurationName,
+		metric.WithDescription("Duration of TLS handshakes for HTTP client connections"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(setupBuckets...)); err != nil {
+		otel.Handle(err)
+	}
+	if t.inst.connections, err = meter.Int64Counter(ConnectionsName,
+		metric.WithDescription("Connections HTTP client requests got, new or reused"),
+		metric.WithUnit("{connection}")); err != nil {
+		otel.Handle(err)
+	}
+	if t.inst.ttfb, err = meter.Float64Histogram(TimeToFirstByteName,
+		metric.WithDescription("Time from the start of HTTP client requests to the first byte of their responses"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(ttfbBuckets...)); err != nil {
+		otel.Handle(err)
+	}
+	return t
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	rec := &recording{
+		inst:   &t.inst,
+		ctx:    r.Context(),
+		server: serverAttrs(r.URL),
+		method: semconv.HTTPRequestMethodKey.String(r.Method),
+		start:  time.Now(),
+	}
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), rec.clientTrace()))
+	return t.base.RoundTrip(r)
+}
+
+// recording is one request's trace. The transport dials on a goroutine of
+// its own, and may finish a dial after the request that started it got
+// another connection and returned, so the hooks lock.
+type recording struct {
+	inst   *instruments
+	ctx    context.Context
+	server []attribute.KeyValue
+	method attribute.KeyValue
+	start  time.Time
+
+	mu       sync.Mutex
+	dnsStart time.Time
+	tlsStart time.Time
+}
+
+func (rec *recording) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			rec.mu.Lock()
+			rec.dnsStart = time.Now()
+			rec.mu.Unlock()
+		},
+		DNSDone: func(info httptrace.DNSDoneInfo) {
+			rec.mu.Lock()
+			start := rec.dnsStart
+			rec.mu.Unlock()
+			rec.recordDuration(rec.inst.dns, start, info.Err)
+		},
+		TLSHandshakeStart: func() {
+			rec.mu.Lock()
+			rec.tlsStart = time.Now()
+			rec.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			rec.mu.Lock()
+			start := rec.tlsStart
+			rec.mu.Unlock()
+			rec.recordDuration(rec.inst.tls, start, err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			if rec.inst.connections != nil {
+				rec.inst.connections.Add(rec.ctx, 1,
+					metric.WithAttributes(append(rec.server, ReusedKey.Bool(info.Reused))...))
+			}
+		},
+		GotFirstResponseByte: func() {
+			if rec.inst.ttfb != nil {
+				rec.inst.ttfb.Record(rec.ctx, time.Since(rec.start).Seconds(),
+					metric.WithAttributes(append(rec.server, rec.method)...))
+			}
+		},
+	}
+}
+
+func (rec *recording) recordDuration(h metric.Float64Histogram, start time.Time, err error) {
+	if h == nil || start.IsZero() {
+		return
+	}
+	attrs := rec.server
+	if err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(errorType(err)))
+	}
+	h.Record(rec.ctx, time.Since(start).Seconds(), metric.WithAttributes(attrs...))
+}
+
+// serverAttrs returns server.address and server.port of the request's URL,
+// with the scheme's default port if it has none.
+func serverAttrs(u *url.URL) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{semconv.ServerAddress(u.Hostname())}
+	port := u.Port()
+	if port == "" {
+		switch u.Scheme {
+		case "https":
+			port = "443"
+		case "http":
+			port = "80"
+		}
+	}
+	if p, err := strconv.Atoi(port); err == nil {
+		attrs = append(attrs, semconv.ServerPort(p))
+	}
+	// A full slice, so appends in the hooks copy it
+	return attrs[:len(attrs):len(attrs)]
+}
+
+// errorType is a low-cardinality error.type: "timeout", "dns_not_found", or
+// the error's Go type.
+func errorType(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		return "dns_not_found"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return fmt.Sprintf("%T", err)
+}
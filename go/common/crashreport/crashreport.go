@@ -0,0 +1,312 @@
+// Package crashreport writes a crash report when the process panics or is
+// aborted, listing the traces it was working on, so a crash can be matched to
+// the traces that led up to it.
+//
+// The Handler is a SpanProcessor that keeps the last Config.Size local root
+// spans, one per trace this process started or continued, in a ring buffer.
+// When a goroutine panics through Recover, or the process receives SIGABRT or
+// SIGQUIT while WatchSignals is on, it writes a JSON report with the panic or
+// signal, the stacks, and the traces in the ring, still active or not. It
+// then flushes the TracerProvider, so the spans the report names reach the
+// backend before the process exits.
+//
+//	crash, err := crashreport.Register(otel.GetTracerProvider(), crashreport.Config{
+//		OnReport: func(path string, r crashreport.Report) { log.Printf("crash report: %s", path) },
+//	})
+//	defer crash.WatchSignals()()
+//
+//	go func() {
+//		defer crash.Recover(ctx)
+//		work(ctx)
+//	}()
+package crashreport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultSize is the number of traces kept when Config.Size is 0.
+const DefaultSize = 32
+
+// DefaultFlushTimeout bounds the flush after a report when
+// Config.FlushTimeout is 0.
+const DefaultFlushTimeout = 2 * time.Second
+
+// Config configures a Handler.
+type Config struct {
+	// Size is the number of traces kept for the report.
+	Size int
+	// Dir is the directory reports are written to, os.TempDir() by default.
+	Dir string
+	// FlushTimeout bounds the TracerProvider flush after a report.
+	FlushTimeout time.Duration
+	// OnReport is called with the path of each report written, for example
+	// to log it. The process is about to exit, so it must not block.
+	OnReport func(path string, r Report)
+}
+
+// Trace is a trace the process was working on, by its local root span.
+type Trace struct {
+	TraceID string     `json:"trace_id"`
+	Name    string     `json:"name"`
+	Start   time.Time  `json:"start"`
+	End     *time.Time `json:"end,omitempty"`
+	// Active is true if the span hadn't ended when the report was written.
+	Active bool `json:"active"`
+}
+
+// Report is what a crash report file holds.
+type Report struct {
+	Time time.Time `json:"time"`
+	PID  int       `json:"pid"`
+	// Reason is "panic", or the name of the signal received.
+	Reason string `json:"reason"`
+	Panic  string `json:"panic,omitempty"`
+	// TraceID is the trace of the context passed to Recover, when it had a
+	// span: the trace the panic happened in.
+	TraceID string `json:"trace_id,omitempty"`
+	// Traces are the traces in the ring, most recent first.
+	Traces []Trace `json:"traces"`
+	// Stack is the panicking goroutine's stack, or every goroutine's for a
+	// signal.
+	Stack string `json:"stack"`
+}
+
+type entry struct {
+	traceID trace.TraceID
+	spanID  trace.SpanID
+	name    string
+	start   time.Time
+	end     time.Time
+}
+
+// Handler records recent traces and writes crash reports. Create it with
+// Register.
+type Handler struct {
+	cfg Config
+	tp  *sdktrace.TracerProvider
+
+	mu    sync.Mutex
+	ring  []entry
+	next  int
+	slots map[trace.SpanID]int
+
+	// reported is set by the first report; a panic re-raised through
+	// several Recovers is reported once
+	reported atomic.Bool
+}
+
+// Register adds a Handler configured by cfg to tp. tp is usually
+// otel.GetTracerProvider() after the provider has been set up. It must be an
+// SDK TracerProvider.
+func Register(tp trace.TracerProvider, cfg Config) (*Handler, error) {
+	sdkTP, ok := tp.(*sdktrace.TracerProvider)
+	if !ok {
+		return nil, errors.New("crashreport: tracer provider is not an SDK TracerProvider")
+	}
+	if cfg.Size <= 0 {
+		cfg.Size = DefaultSize
+	}
+	if cfg.Dir == "" {
+		cfg.Dir = os.TempDir()
+	}
+	if cfg.FlushTimeout <= 0 {
+		cfg.FlushTimeout = DefaultFlushTimeout
+	}
+	h := &Handler{
+		cfg:   cfg,
+		tp:    sdkTP,
+		ring:  make([]entry, 0, cfg.Size),
+		slots: make(map[trace.SpanID]int, cfg.Size),
+	}
+	sdkTP.RegisterSpanProcessor(h)
+	return h, nil
+}
+
+// OnStart records local root spans: spans without a parent, or whose parent
+// is in another process. Child spans are left out, so the ring holds traces
+// rather than the database calls within them.
+func (h *Handler) OnStart(_ context.Context, s sdktrace.ReadWriteSpan) {
+	if parent := s.Parent(); parent.IsValid() && !parent.IsRemote() {
+		return
+	}
+	sc := s.SpanContext()
+	e := entry{traceID: sc.TraceID(), spanID: sc.SpanID(), name: s.Name(), start: s.StartTime()}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.ring) < cap(h.ring) {
+		h.ring = append(h.ring, e)
+	} else {
+		delete(h.slots, h.ring[h.next].spanID)
+		h.ring[h.next] = e
+	}
+	h.slots[e.spanID] = h.next
+	h.next = (h.next + 1) % cap(h.ring)
+}
+
+// OnEnd records when a local root span ended.
+func (h *Handler) OnEnd(s sdktrace.ReadOnlySpan) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if i, ok := h.slots[s.SpanContext().SpanID()]; ok {
+		h.ring[i].end = s.EndTime()
+		delete(h.slots, s.SpanContext().SpanID())
+	}
+}
+
+// Shutdown does nothing.
+func (*Handler) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (*Handler) ForceFlush(context.Context) error { return nil }
+
+// Recover writes a crash report if the goroutine is panicking, and lets the
+// panic continue. Defer it first in every goroutine the process starts:
+// a panic in a goroutine without it crashes the process with no report.
+//
+// If ctx has a span, it gets status Error, and the report names its trace. Deferred after the span is started, so it runs
+// before the span ends, Recover marks the span the panic happened in:
+//
+//	ctx, span := tracer.Start(ctx, "job.process")
+//	defer span.End()
+//	defer crash.Recover(ctx)
+func (h *Handler) Recover(ctx context.Context) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := debug.Stack()
+	span := trace.SpanFromContext(ctx)
+	// The SDK's span.End adds the exception event itself when it runs
+	// during a panic, so only the status is set here
+	span.SetStatus(codes.Error, fmt.Sprint(r))
+	if !h.reported.Swap(true) {
+		rep := h.report("panic", stack)
+		rep.Panic = fmt.Sprint(r)
+		if sc := span.SpanContext(); sc.IsValid() {
+			rep.TraceID = sc.TraceID().String()
+		}
+		h.write(rep)
+	}
+	h.flush()
+	panic(r)
+}
+
+// Go runs fn in a new goroutine that defers Recover(ctx).
+func (h *Handler) Go(ctx context.Context, fn func(context.Context)) {
+	go func() {
+		defer h.Recover(ctx)
+		fn(ctx)
+	}()
+}
+
+// WatchSignals writes a crash report when the process receives one of sigs,
+// SIGABRT and SIGQUIT by default, then re-raises the signal, so the Go
+// runtime still dumps the goroutines and exits as it would have. The returned
+// func stops watching.
+//
+// Runtime fatal errors, such as concurrent map writes, and SIGKILL can't be
+// caught, so they leave no report.
+func (h *Handler) WatchSignals(sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGABRT, syscall.SIGQUIT}
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+	go func() {
+		select {
+		case sig := <-ch:
+			if !h.reported.Swap(true) {
+				h.write(h.report(sig.String(), allStacks()))
+			}
+			h.flush()
+			signal.Reset(sig)
+			if p, err := os.FindProcess(os.Getpid()); err == nil {
+				_ = p.Signal(sig)
+			}
+		case <-done:
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+func (h *Handler) report(reason string, stack []byte) Report {
+	now := time.Now()
+	rep := Report{Time: now, PID: os.Getpid(), Reason: reason, Stack: string(stack)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// Walk back from the most recently started
+	for i := 1; i <= len(h.ring); i++ {
+		e := h.ring[(h.next-i+len(h.ring))%len(h.ring)]
+		t := Trace{TraceID: e.traceID.String(), Name: e.name, Start: e.start, Active: e.end.IsZero()}
+		if !t.Active {
+			end := e.end
+			t.End = &end
+		}
+		rep.Traces = append(rep.Traces, t)
+	}
+	return rep
+}
+
+func (h *Handler) write(rep Report) {
+	data, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	path := filepath.Join(h.cfg.Dir, fmt.Sprintf("crash-%d-%d.json", rep.PID, rep.Time.UnixNano()))
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		otel.Handle(fmt.Errorf("crashreport: %w", err))
+		return
+	}
+	if h.cfg.OnReport != nil {
+		h.cfg.OnReport(path, rep)
+	}
+}
+
+func (h *Handler) flush() {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.FlushTimeout)
+	defer cancel()
+	if err := h.tp.ForceFlush(ctx); err != nil {
+		otel.Handle(err)
+	}
+}
+
+// allStacks returns the stacks of all goroutines, growing the buffer until
+// they fit.
+func allStacks() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
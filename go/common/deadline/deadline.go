@@ -0,0 +1,153 @@
+// Package deadline gives requests a deadline and records the ones that miss
+// it on the request span and in a counter.
+//
+// A deadline only helps if it reaches the calls that take the time. Pass the
+// request context to every database, Redis and HTTP call: the database driver
+// then cancels the query, the Redis client stops waiting for the reply, and
+// the HTTP client abandons the outbound request when the deadline passes,
+// instead of finishing work whose result nobody will read. A call made with
+// context.Background() keeps running, and shows up as a handler that returned
+// long after its deadline: see request.timeout.overrun below.
+//
+// Run the middleware inside the HTTP instrumentation so the server span
+// already exists:
+//
+//	timeout := deadline.Middleware(2 * time.Second)
+//	mux.Handle("GET /users", timeout(http.HandlerFunc(listUsers)))
+//
+// Other frameworks call Start and the function it returns directly.
+package deadline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the timeout counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/deadline"
+
+// DefaultTimeout is the timeout used when REQUEST_TIMEOUT is not set.
+const DefaultTimeout = 5 * time.Second
+
+// TimeoutFromEnv returns the duration in the environment variable key, such
+// as REQUEST_TIMEOUT=2s, or fallback if it is unset or not a positive
+// duration.
+func TimeoutFromEnv(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
+
+var timeoutCounter = sync.OnceValue(func() metric.Int64Counter {
+	c, err := otel.Meter(ScopeName).Int64Counter("http.server.request.timeouts",
+		metric.WithDescription("Requests whose handler was still running at the deadline"),
+		metric.WithUnit("{request}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return c
+})
+
+// Start returns ctx with a deadline timeout from now, or the deadline ctx
+// already has if that is earlier, and sets http.server.request.timeout on the
+// span in ctx to the time left.
+//
+// Call done once the handler has returned. If the deadline passed, done adds
+// a request.timeout event to the span, sets its status to Error, counts the
+// timeout with metricAttrs, and returns true. Either way it releases the
+// deadline's timer.
+//
+// Starts nest: a route's shorter deadline inside a server-wide one is the one
+// that fires, and only its done records the timeout.
+func Start(ctx context.Context, timeout time.Duration) (_ context.Context, done func(metricAttrs ...attribute.KeyValue) bool) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	dl, _ := ctx.Deadline()
+	budget := dl.Sub(start)
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Float64("http.server.request.timeout", budget.Seconds()))
+
+	return ctx, func(metricAttrs ...attribute.KeyValue) bool {
+		defer cancel()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return false
+		}
+
+		// How long the handler ran past the deadline. Near zero means every
+		// call gave up at the deadline; more means one didn't get the context
+		overrun := time.Since(dl)
+		span.AddEvent("request.timeout", trace.WithAttributes(
+			attribute.Float64("http.server.request.timeout", budget.Seconds()),
+			attribute.Float64("request.timeout.overrun", overrun.Seconds()),
+		))
+		span.SetAttributes(attribute.String("error.type", "timeout"))
+		span.SetStatus(codes.Error, "request deadline exceeded")
+		if c := timeoutCounter(); c != nil {
+			c.Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(metricAttrs...))
+		}
+		return true
+	}
+}
+
+// Middleware returns middleware that gives each request a deadline of
+// timeout. If the deadline passes and the handler has written nothing, the
+// client gets a 503.
+//
+// Don't use it on streaming routes, such as Server-Sent Events: their
+// requests are meant to outlive any deadline.
+func Middleware(timeout time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, done := Start(r.Context(), timeout)
+			tw := &trackingWriter{ResponseWriter: w}
+			next.ServeHTTP(tw, r.WithContext(ctx))
+
+			attrs := []attribute.KeyValue{attribute.String("http.request.method", r.Method)}
+			if r.Pattern != "" {
+				attrs = append(attrs, attribute.String("http.route", r.Pattern))
+			}
+			if done(attrs...) && !tw.wroteHeader {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				io.WriteString(w, `{"error":"request timed out","timeout_seconds":`+
+					strconv.FormatFloat(timeout.Seconds(), 'f', -1, 64)+"}\n")
+			}
+		})
+	}
+}
+
+// trackingWriter records whether the handler started the response.
+type trackingWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *trackingWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *trackingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *trackingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,280 @@
+// Package errclass sorts cloud SDK errors into a few categories, so failures
+// from AWS and Google Cloud calls can be compared and alerted on the same way.
+//
+// Every SDK reports a throttled or unauthorized call differently: AWS with an
+// error code such as ThrottlingException, Google APIs with an HTTP status and
+// a reason such as rateLimitExceeded, or a gRPC status. Classify maps all of
+// them to a Category, and Recorder puts it on the span as error.category and
+// counts it:
+//
+//	errs := errclass.NewRecorder()
+//	if err != nil {
+//	    span.RecordError(err)
+//	    errs.Record(ctx, span, err, attribute.String("cloud.provider", "aws"))
+//	}
+//
+// The package reads errors through the methods SDK error types implement, so
+// it does not depend on any cloud SDK. Errors it cannot read, such as the
+// reasons of a googleapi.Error, are classified by a Detector.
+package errclass
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ScopeName is the instrumentation scope of the error counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/errclass"
+
+// AttributeKey is the span attribute and counter attribute for the category.
+const AttributeKey = attribute.Key("error.category")
+
+// Category is the kind of failure behind an error.
+type Category string
+
+const (
+	// Throttled means the request rate was too high. Retrying after a wait
+	// succeeds.
+	Throttled Category = "throttled"
+	// Quota means a quota or limit was used up. Retrying succeeds only once
+	// the quota resets or is raised.
+	Quota Category = "quota"
+	// Auth means the credentials were missing, invalid, expired or lacked
+	// permission.
+	Auth Category = "auth"
+	// Transient means the service or network failed briefly. A retry is
+	// likely to succeed.
+	Transient Category = "transient"
+	// Permanent means the request itself was wrong, or the error is not
+	// recognized. Retrying fails the same way.
+	Permanent Category = "permanent"
+)
+
+// Retryable reports whether retrying soon can succeed.
+func (c Category) Retryable() bool {
+	return c == Throttled || c == Transient
+}
+
+// A Detector classifies errors the built-in rules cannot read. It returns
+// false to leave err to the built-in rules.
+type Detector func(err error) (Category, bool)
+
+// AWS error codes, from the codes the AWS SDK retryer treats as throttling
+// or transient, plus the common quota and auth codes.
+var awsCodes = map[string]Category{
+	"Throttling":                             Throttled,
+	"ThrottlingException":                    Throttled,
+	"ThrottledException":                     Throttled,
+	"RequestThrottled":                       Throttled,
+	"RequestThrottledException":              Throttled,
+	"TooManyRequestsException":               Throttled,
+	"ProvisionedThroughputExceededException": Throttled,
+	"TransactionInProgressException":         Throttled,
+	"RequestLimitExceeded":                   Throttled,
+	"BandwidthLimitExceeded":                 Throttled,
+	"SlowDown":                               Throttled,
+	"PriorRequestNotComplete":                Throttled,
+	"EC2ThrottledException":                  Throttled,
+	// The SDK retries LimitExceededException as throttling, and most
+	// services use it for rate limits
+	"LimitExceededException": Throttled,
+
+	"ServiceQuotaExceededException": Quota,
+	"QuotaExceededException":        Quota,
+	"OverLimit":                     Quota,
+	"TooManyBuckets":                Quota,
+
+	"AccessDenied":                  Auth,
+	"AccessDeniedException":         Auth,
+	"UnrecognizedClientException":   Auth,
+	"InvalidClientTokenId":          Auth,
+	"InvalidAccessKeyId":            Auth,
+	"SignatureDoesNotMatch":         Auth,
+	"InvalidSignatureException":     Auth,
+	"IncompleteSignature":           Auth,
+	"MissingAuthenticationToken":    Auth,
+	"ExpiredToken":                  Auth,
+	"ExpiredTokenException":         Auth,
+	"RequestExpired":                Auth,
+	"AuthFailure":                   Auth,
+	"UnauthorizedOperation":         Auth,
+	"NotAuthorized":                 Auth,
+	"KMS.AccessDeniedException":     Auth,
+	"KMSAccessDeniedException":      Auth,
+	"AWS.SimpleQueueService.Denied": Auth,
+
+	"RequestTimeout":              Transient,
+	"RequestTimeoutException":     Transient,
+	"InternalError":               Transient,
+	"InternalFailure":             Transient,
+	"InternalServerError":         Transient,
+	"InternalServerException":     Transient,
+	"ServiceUnavailable":          Transient,
+	"ServiceUnavailableException": Transient,
+}
+
+// Google API reasons: the errors[].reason of JSON API errors, and the
+// ErrorInfo reason of newer errors.
+var googleReasons = map[string]Category{
+	"rateLimitExceeded":     Throttled,
+	"userRateLimitExceeded": Throttled,
+	"RATE_LIMIT_EXCEEDED":   Throttled,
+
+	"quotaExceeded":           Quota,
+	"dailyLimitExceeded":      Quota,
+	"RESOURCE_QUOTA_EXCEEDED": Quota,
+
+	"authError":                       Auth,
+	"forbidden":                       Auth,
+	"insufficientPermissions":         Auth,
+	"accountDisabled":                 Auth,
+	"ACCESS_TOKEN_EXPIRED":            Auth,
+	"ACCESS_TOKEN_SCOPE_INSUFFICIENT": Auth,
+	"IAM_PERMISSION_DENIED":           Auth,
+	"API_KEY_INVALID":                 Auth,
+	"CREDENTIALS_MISSING":             Auth,
+
+	"backendError":  Transient,
+	"internalError": Transient,
+}
+
+// FromReason returns the category of a Google API error reason, such as
+// rateLimitExceeded or RATE_LIMIT_EXCEEDED.
+func FromReason(reason string) (Category, bool) {
+	c, ok := googleReasons[reason]
+	return c, ok
+}
+
+// FromHTTPStatus returns the category of an HTTP error status.
+func FromHTTPStatus(code int) Category {
+	switch {
+	case code == http.StatusTooManyRequests:
+		return Throttled
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return Auth
+	case code == http.StatusRequestTimeout || code >= 500:
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// FromGRPCCode returns the category of a gRPC status code.
+func FromGRPCCode(code codes.Code) Category {
+	switch code {
+	case codes.ResourceExhausted:
+		// Google uses it for used-up quota; rate limits carry a
+		// RATE_LIMIT_EXCEEDED reason, which Classify checks first
+		return Quota
+	case codes.Unauthenticated, codes.PermissionDenied:
+		return Auth
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted, codes.Internal, codes.Unknown:
+		return Transient
+	default:
+		return Permanent
+	}
+}
+
+// Classify returns the category of err, or "" for a nil error. Detectors are
+// tried first, in order.
+func Classify(err error, detectors ...Detector) Category {
+	if err == nil {
+		return ""
+	}
+	for _, d := range detectors {
+		if c, ok := d(err); ok {
+			return c
+		}
+	}
+
+	// AWS SDK API errors (smithy.APIError)
+	var awsErr interface{ ErrorCode() string }
+	if errors.As(err, &awsErr) {
+		if c, ok := awsCodes[awsErr.ErrorCode()]; ok {
+			return c
+		}
+	}
+	// Google API errors (apierror.APIError) with an ErrorInfo reason
+	var reasonErr interface{ Reason() string }
+	if errors.As(err, &reasonErr) {
+		if c, ok := FromReason(reasonErr.Reason()); ok {
+			return c
+		}
+	}
+	if st, ok := status.FromError(err); ok && st.Code() != codes.OK {
+		return FromGRPCCode(st.Code())
+	}
+	// AWS SDK response errors
+	var awsHTTPErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &awsHTTPErr) && awsHTTPErr.HTTPStatusCode() >= 400 {
+		return FromHTTPStatus(awsHTTPErr.HTTPStatusCode())
+	}
+	// Google API errors over HTTP; HTTPCode is -1 for gRPC errors
+	var googleHTTPErr interface{ HTTPCode() int }
+	if errors.As(err, &googleHTTPErr) && googleHTTPErr.HTTPCode() >= 400 {
+		return FromHTTPStatus(googleHTTPErr.HTTPCode())
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		return Transient
+	}
+	if errors.Is(err, context.Canceled) {
+		// The caller gave up; retrying is up to the caller
+		return Permanent
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return Transient
+	}
+	return Permanent
+}
+
+// Recorder records the category of errors on spans and in the
+// cloud.client.errors counter.
+type Recorder struct {
+	detectors []Detector
+	errors    metric.Int64Counter
+}
+
+// NewRecorder returns a Recorder that classifies with detectors before the
+// built-in rules.
+func NewRecorder(detectors ...Detector) *Recorder {
+	counter, err := otel.Meter(ScopeName).Int64Counter("cloud.client.errors",
+		metric.WithDescription("Failed cloud SDK calls by error category"),
+		metric.WithUnit("{error}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &Recorder{detectors: detectors, errors: counter}
+}
+
+// Classify returns the category of err, trying the Recorder's detectors
+// first.
+func (r *Recorder) Classify(err error) Category {
+	return Classify(err, r.detectors...)
+}
+
+// Record sets error.category on span and counts the error with attrs, such
+// as cloud.provider and the operation. It returns the category, or "" and
+// records nothing for a nil error.
+func (r *Recorder) Record(ctx context.Context, span trace.Span, err error, attrs ...attribute.KeyValue) Category {
+	c := r.Classify(err)
+	if c == "" {
+		return c
+	}
+	span.SetAttributes(AttributeKey.String(string(c)))
+	if r.errors != nil {
+		r.errors.Add(ctx, 1, metric.WithAttributes(append(attrs[:len(attrs):len(attrs)], AttributeKey.String(string(c)))...))
+	}
+	return c
+}
@@ -0,0 +1,41 @@
+// Package lazyattr builds span attributes and events only for spans that are
+// recorded.
+//
+// A span the sampler dropped is not recording: its SetAttributes and AddEvent
+// do nothing. The attributes passed to them are still built first, and
+// building them is often the expensive part: formatting an error message,
+// walking the stack, copying a request's strings. With a 10% sampling ratio,
+// nine requests in ten pay for attributes nobody will see. Set and Event take
+// a function instead, and only call it if the span is recording:
+//
+//	lazyattr.Event(span, "users.rejected", func() []attribute.KeyValue {
+//		return []attribute.KeyValue{attribute.String("error.message", err.Error())}
+//	})
+//
+// The closure doesn't escape, so the unsampled path doesn't allocate. For
+// work that isn't a single call, check span.IsRecording() directly.
+//
+// Attributes passed to tracer.Start are different: samplers can decide on
+// them, so they have to be built before the decision is known.
+package lazyattr
+
+import (
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Set sets the attributes build returns on span, calling build only if span
+// is recording.
+func Set(span trace.Span, build func() []attribute.KeyValue) {
+	if span.IsRecording() {
+		span.SetAttributes(build()...)
+	}
+}
+
+// Event adds an event with the attributes build returns to span, calling
+// build only if span is recording.
+func Event(span trace.Span, name string, build func() []attribute.KeyValue) {
+	if span.IsRecording() {
+		span.AddEvent(name, trace.WithAttributes(build()...))
+	}
+}
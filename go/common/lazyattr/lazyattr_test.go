@@ -0,0 +1,112 @@
+package lazyattr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestBuildOnlyWhenRecording(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		sampler sdktrace.Sampler
+		want    bool
+	}{
+		{"sampled", sdktrace.AlwaysSample(), true},
+		{"sampled out", sdktrace.NeverSample(), false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(tt.sampler), sdktrace.WithSpanProcessor(sr))
+			_, span := tp.Tracer("test").Start(context.Background(), "op")
+
+			built := 0
+			build := func() []attribute.KeyValue {
+				built++
+				return []attribute.KeyValue{attribute.String("k", "v")}
+			}
+			Set(span, build)
+			Event(span, "e", build)
+			span.End()
+
+			if got := built == 2; got != tt.want {
+				t.Fatalf("built %d times, want built: %v", built, tt.want)
+			}
+			if !tt.want {
+				return
+			}
+			ended := sr.Ended()[0]
+			if len(ended.Attributes()) != 1 || len(ended.Events()) != 1 || ended.Events()[0].Name != "e" {
+				t.Errorf("got attributes %v and events %v, want k=v and an e event", ended.Attributes(), ended.Events())
+			}
+		})
+	}
+}
+
+// unsampledSpan returns a span from a provider that samples nothing, as
+// nine requests in ten get with a 10% ratio.
+func unsampledSpan(b *testing.B) trace.Span {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample()))
+	_, span := tp.Tracer("bench").Start(context.Background(), "op")
+	b.Cleanup(func() { span.End() })
+	return span
+}
+
+var errBench = fmt.Errorf("update user %s: %w", "3f9a2c1e-5b7d-4e8f-9a1b-2c3d4e5f6a7b", errors.New("dial tcp 10.0.0.5:6379: connection refused"))
+
+// BenchmarkEvent compares an event built eagerly, as the users service's
+// cache.error event was, with one built by Event, on a sampled-out span:
+//
+//	go test -run '^$' -bench . -benchmem ./lazyattr
+func BenchmarkEvent(b *testing.B) {
+	span := unsampledSpan(b)
+	b.Run("eager", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			span.AddEvent("cache.error", trace.WithAttributes(
+				attribute.String("error.message", errBench.Error()),
+			))
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Event(span, "cache.error", func() []attribute.KeyValue {
+				return []attribute.KeyValue{attribute.String("error.message", errBench.Error())}
+			})
+		}
+	})
+}
+
+// BenchmarkSet compares attributes formatted eagerly with attributes set by
+// Set, on a sampled-out span.
+func BenchmarkSet(b *testing.B) {
+	span := unsampledSpan(b)
+	status := 503
+	b.Run("eager", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			span.SetAttributes(
+				attribute.String("http.status_text", fmt.Sprintf("HTTP status code: %d", status)),
+				attribute.String("error.message", errBench.Error()),
+			)
+		}
+	})
+	b.Run("lazy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			Set(span, func() []attribute.KeyValue {
+				return []attribute.KeyValue{
+					attribute.String("http.status_text", fmt.Sprintf("HTTP status code: %d", status)),
+					attribute.String("error.message", errBench.Error()),
+				}
+			})
+		}
+	})
+}
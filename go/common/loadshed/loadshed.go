@@ -0,0 +1,272 @@
+// Package loadshed rejects requests early when a server is overloaded, so the
+// requests it does accept still finish in time. It watches two signals it
+// also exports as metrics: requests in flight, and the p99 latency of the
+// requests it let through. Over Config.MaxInFlight, every new request is
+// shed. Over Config.TargetP99, a growing share of requests is shed, and the
+// share shrinks again once the p99 is back under target.
+//
+// The middleware runs inside the route span, so a shed request has a
+// loadshed.rejected event on it:
+//
+//	shedder := loadshed.New(loadshed.ConfigFromEnv())
+//	mux.Handle("GET /users", shedder.Middleware(http.HandlerFunc(listUsers)))
+//
+// Share one Shedder between the routes it protects: they compete for the
+// same CPU, connections and database. Leave out routes that are slow on
+// purpose, such as streams, whose latency would shed the others.
+package loadshed
+
+import (
+	"context"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the load shedding metrics.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/loadshed"
+
+// ReasonKey is why a request was shed: ReasonInFlight or ReasonLatency.
+const ReasonKey = attribute.Key("loadshed.reason")
+
+const (
+	// ReasonInFlight means Config.MaxInFlight requests were in flight.
+	ReasonInFlight = "in_flight"
+	// ReasonLatency means the p99 latency was over Config.TargetP99, and
+	// the request was among the share being shed.
+	ReasonLatency = "latency"
+)
+
+// Defaults for ConfigFromEnv and New.
+const (
+	DefaultMaxInFlight = 64
+	DefaultTargetP99   = time.Second
+	DefaultInterval    = time.Second
+	DefaultMaxDropRate = 0.9
+)
+
+// The drop rate goes up faster than it comes down, so an overload is met
+// within a few intervals, and the load returns gradually.
+const (
+	dropRateIncrease = 0.1
+	dropRateDecrease = 0.05
+	// minSamples is how many requests an interval needs for its p99 to
+	// raise the drop rate, so one slow request on an idle server doesn't.
+	minSamples = 20
+	// maxSamples bounds the latencies kept per interval.
+	maxSamples = 10000
+)
+
+// Config configures a Shedder.
+type Config struct {
+	// MaxInFlight is the number of requests in flight over which new ones
+	// are shed. 0 means no limit.
+	MaxInFlight int
+	// TargetP99 is the p99 latency over which a share of requests is shed.
+	// 0 turns latency shedding off.
+	TargetP99 time.Duration
+	// Interval is how often the p99 is computed and the drop rate adjusted.
+	// It defaults to DefaultInterval.
+	Interval time.Duration
+	// MaxDropRate caps the share of requests shed for latency, so some still
+	// get through and show when the latency recovers. It defaults to
+	// DefaultMaxDropRate.
+	MaxDropRate float64
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+// ConfigFromEnv returns a Config with MaxInFlight from LOADSHED_MAX_IN_FLIGHT
+// and TargetP99 from LOADSHED_TARGET_P99, such as LOADSHED_TARGET_P99=300ms,
+// or the defaults if they are unset or invalid. 0 turns either off.
+func ConfigFromEnv() Config {
+	cfg := Config{MaxInFlight: DefaultMaxInFlight, TargetP99: DefaultTargetP99}
+	if n, err := strconv.Atoi(os.Getenv("LOADSHED_MAX_IN_FLIGHT")); err == nil && n >= 0 {
+		cfg.MaxInFlight = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("LOADSHED_TARGET_P99")); err == nil && d >= 0 {
+		cfg.TargetP99 = d
+	}
+	return cfg
+}
+
+// Shedder decides which requests to shed. Create it with New.
+type Shedder struct {
+	cfg      Config
+	inFlight atomic.Int64
+	rejected metric.Int64Counter
+
+	mu sync.Mutex
+	// samples are the latencies of the requests let through since the last
+	// evaluation, in seconds
+	samples  []float64
+	lastEval time.Time
+	p99      float64
+	dropRate float64
+}
+
+// New returns a Shedder, and registers its gauges.
+func New(cfg Config) *Shedder {
+	if cfg.Interval <= 0 {
+		cfg.Interval = DefaultInterval
+	}
+	if cfg.MaxDropRate <= 0 || cfg.MaxDropRate > 1 {
+		cfg.MaxDropRate = DefaultMaxDropRate
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	s := &Shedder{cfg: cfg, lastEval: time.Now()}
+
+	meter := cfg.MeterProvider.Meter(ScopeName)
+	var err error
+	if s.rejected, err = meter.Int64Counter("http.server.loadshed.rejected",
+		metric.WithDescription("Requests shed, by reason"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	s.registerGauges(meter)
+	return s
+}
+
+// Middleware sheds requests to next while the server is overloaded, with a
+// 503 and Retry-After: 1. It measures the latency of the requests it lets
+// through, which is what the p99 is computed from.
+func (s *Shedder) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := s.inFlight.Add(1)
+		defer s.inFlight.Add(-1)
+
+		if reason, p99, dropRate := s.admit(n); reason != "" {
+			s.reject(w, r, reason, n, p99, dropRate)
+			return
+		}
+		start := time.Now()
+		next.ServeHTTP(w, r)
+		s.observe(time.Since(start))
+	})
+}
+
+// admit returns why a request should be shed, or "" to let it through, with
+// the p99 and drop rate it was decided on. n is the requests in flight,
+// this one included.
+func (s *Shedder) admit(n int64) (reason string, p99, dropRate float64) {
+	s.mu.Lock()
+	if now := time.Now(); now.Sub(s.lastEval) >= s.cfg.Interval {
+		s.evaluate(now)
+	}
+	p99, dropRate = s.p99, s.dropRate
+	s.mu.Unlock()
+
+	switch {
+	case s.cfg.MaxInFlight > 0 && n > int64(s.cfg.MaxInFlight):
+		return ReasonInFlight, p99, dropRate
+	case dropRate > 0 && rand.Float64() < dropRate:
+		return ReasonLatency, p99, dropRate
+	}
+	return "", p99, dropRate
+}
+
+// evaluate computes the p99 of the interval that ended at now, and moves the
+// drop rate up or down one step. s.mu must be held.
+func (s *Shedder) evaluate(now time.Time) {
+	s.lastEval = now
+	s.p99 = 0
+	if len(s.samples) > 0 {
+		slices.Sort(s.samples)
+		s.p99 = s.samples[int(math.Ceil(0.99*float64(len(s.samples))))-1]
+	}
+	overloaded := s.cfg.TargetP99 > 0 && len(s.samples) >= minSamples &&
+		s.p99 > s.cfg.TargetP99.Seconds()
+	if overloaded {
+		s.dropRate = min(s.dropRate+dropRateIncrease, s.cfg.MaxDropRate)
+	} else {
+		s.dropRate = max(s.dropRate-dropRateDecrease, 0)
+	}
+	s.samples = s.samples[:0]
+}
+
+func (s *Shedder) observe(d time.Duration) {
+	s.mu.Lock()
+	if len(s.samples) < maxSamples {
+		s.samples = append(s.samples, d.Seconds())
+	}
+	s.mu.Unlock()
+}
+
+// reject answers a shed request, and records it on the route span and in the
+// rejected counter.
+func (s *Shedder) reject(w http.ResponseWriter, r *http.Request, reason string, inFlight int64, p99, dropRate float64) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+	span.AddEvent("loadshed.rejected", trace.WithAttributes(
+		ReasonKey.String(reason),
+		attribute.Int64("loadshed.in_flight", inFlight),
+		attribute.Float64("loadshed.latency.p99", p99),
+		attribute.Float64("loadshed.drop_rate", dropRate),
+	))
+	span.SetAttributes(attribute.String("error.type", "load_shed"))
+
+	if s.rejected != nil {
+		attrs := []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(r.Method), ReasonKey.String(reason)}
+		// The pattern without its method: "GET /users/{id}" is /users/{id}
+		if i := strings.IndexByte(r.Pattern, '/'); i >= 0 {
+			attrs = append(attrs, semconv.HTTPRoute(r.Pattern[i:]))
+		}
+		s.rejected.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Retry-After", "1")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write([]byte(`{"error":"server overloaded","loadshed_reason":"` + reason + `"}` + "\n"))
+}
+
+func (s *Shedder) registerGauges(meter metric.Meter) {
+	inFlight, err := meter.Int64ObservableGauge("http.server.loadshed.in_flight",
+		metric.WithDescription("Requests in flight through the shedder"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	p99, err := meter.Float64ObservableGauge("http.server.loadshed.latency.p99",
+		metric.WithDescription("p99 latency of the last interval, as the shedder computed it"),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	dropRate, err := meter.Float64ObservableGauge("http.server.loadshed.drop_rate",
+		metric.WithDescription("Share of requests shed for latency"),
+		metric.WithUnit("1"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s.mu.Lock()
+		p, d := s.p99, s.dropRate
+		s.mu.Unlock()
+		o.ObserveInt64(inFlight, s.inFlight.Load())
+		o.ObserveFloat64(p99, p)
+		o.ObserveFloat64(dropRate, d)
+		return nil
+	}, inFlight, p99, dropRate)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
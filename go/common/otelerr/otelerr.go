@@ -0,0 +1,141 @@
+// Package otelerr records errors on spans the way the OpenTelemetry semantic
+// conventions describe exceptions, with the stack trace of where the error
+// came from rather than of where it was recorded.
+//
+// By the time a handler records an error, the function that failed has
+// returned, and a stack trace taken then shows the handler. Wrap the error
+// where it happens, and Record puts that stack on the span:
+//
+//	if err != nil {
+//	    return otelerr.Wrap(err)
+//	}
+//	...
+//	if err != nil {
+//	    otelerr.Record(r.Context(), err, attribute.String("operation", "create_user"))
+//	    http.Error(w, "internal server error", otelerr.HTTPStatus(err))
+//	}
+//
+// HTTPStatus and GRPCCode map errors to response statuses, from a status
+// attached with WithHTTPStatus, a gRPC status, or a context error.
+package otelerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxFrames bounds the stack Wrap keeps.
+const maxFrames = 32
+
+// stackError is an error with the stack of the Wrap or Errorf call that
+// made it. Only program counters are kept; they are resolved to functions
+// and lines when the stack is recorded, which errors on unsampled requests
+// never are.
+type stackError struct {
+	err error
+	pcs []uintptr
+}
+
+func (e *stackError) Error() string { return e.err.Error() }
+func (e *stackError) Unwrap() error { return e.err }
+
+// Wrap returns err with the stack of its caller, or err itself if it is nil
+// or already carries a stack: the deepest stack is the one that says where
+// the error happened. The result matches err with errors.Is and errors.As.
+func Wrap(err error) error {
+	if err == nil {
+		return nil
+	}
+	return wrap(err, 3)
+}
+
+// Errorf is fmt.Errorf, with the stack of its caller. Wrap errors with %w as
+// usual; if one of them already has a stack, that one is kept.
+func Errorf(format string, args ...any) error {
+	return wrap(fmt.Errorf(format, args...), 3)
+}
+
+// wrap adds the stack above skip frames: runtime.Callers, wrap, and the
+// exported function that called it.
+func wrap(err error, skip int) error {
+	var se *stackError
+	if errors.As(err, &se) {
+		return err
+	}
+	pcs := make([]uintptr, maxFrames)
+	n := runtime.Callers(skip, pcs)
+	return &stackError{err: err, pcs: pcs[:n]}
+}
+
+// Stack returns the stack trace of the deepest error in err's chain that
+// Wrap or Errorf made, in the format of a Go panic, or "" if there is none.
+func Stack(err error) string {
+	var se *stackError
+	if !errors.As(err, &se) {
+		return ""
+	}
+	return formatStack(se.pcs)
+}
+
+func formatStack(pcs []uintptr) string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(pcs)
+	for {
+		f, more := frames.Next()
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+// Type returns the exception.type of err: the type of the error Wrap or
+// Errorf wrapped, the one Stack's trace belongs to, even when err wraps it
+// again with WithHTTPStatus or fmt.Errorf. An error without a stack is its
+// own type.
+func Type(err error) string {
+	var se *stackError
+	if errors.As(err, &se) {
+		err = se.err
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// Record records err on the span in ctx: an exception event with
+// exception.type, exception.message and exception.stacktrace, status Error,
+// and error.type on the span. The stack trace is Wrap's if err has one, and
+// Record's caller's otherwise. attrs are added to the event.
+//
+// Nothing is done for a nil error or a span that isn't recording, so
+// recording an error on an unsampled request costs nothing.
+func Record(ctx context.Context, err error, attrs ...attribute.KeyValue) {
+	if err == nil {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	stack := Stack(err)
+	if stack == "" {
+		pcs := make([]uintptr, maxFrames)
+		stack = formatStack(pcs[:runtime.Callers(2, pcs)])
+	}
+	typ := Type(err)
+	span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(append([]attribute.KeyValue{
+		semconv.ExceptionType(typ),
+		semconv.ExceptionMessage(err.Error()),
+		semconv.ExceptionStacktrace(stack),
+	}, attrs...)...))
+	span.SetStatus(codes.Error, err.Error())
+	span.SetAttributes(semconv.ErrorTypeKey.String(typ))
+}
@@ -0,0 +1,66 @@
+package otelerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"strings"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestType(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "/etc/app.yaml", Err: fs.ErrNotExist}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"plain", pathErr, "*fs.PathError"},
+		{"wrapped", Wrap(pathErr), "*fs.PathError"},
+		{"wrapped, with status", WithHTTPStatus(Wrap(pathErr), http.StatusNotFound), "*fs.PathError"},
+		{"wrapped, then by fmt.Errorf", fmt.Errorf("load config: %w", Wrap(pathErr)), "*fs.PathError"},
+		{"Errorf", Errorf("load config: %w", pathErr), "*fmt.wrapError"},
+		{"no stack, with status", WithHTTPStatus(pathErr, http.StatusNotFound), "*otelerr.statusError"},
+	}
+	for _, tt := range tests {
+		if got := Type(tt.err); got != tt.want {
+			t.Errorf("%s: Type = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// loadConfig fails where Wrap is called, so its stack is the one Record
+// should put on the span.
+func loadConfig() error {
+	return Wrap(errors.New("config not found"))
+}
+
+func TestRecord(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	ctx, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test").Start(context.Background(), "op")
+	Record(ctx, WithHTTPStatus(fmt.Errorf("start: %w", loadConfig()), http.StatusServiceUnavailable))
+	span.End()
+
+	events := sr.Ended()[0].Events()
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	attrs := map[string]string{}
+	for _, kv := range events[0].Attributes {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if got := attrs["exception.type"]; got != "*errors.errorString" {
+		t.Errorf("exception.type is %q, want the type Wrap wrapped", got)
+	}
+	if got := attrs["exception.stacktrace"]; !strings.Contains(got, "otelerr.loadConfig") {
+		t.Errorf("exception.stacktrace doesn't start where Wrap was called:\n%s", got)
+	}
+	if got := attrs["exception.message"]; got != "start: config not found" {
+		t.Errorf("exception.message is %q", got)
+	}
+}
@@ -0,0 +1,152 @@
+package otelerr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// StatusClientClosedRequest is the status HTTPStatus returns for a request
+// the client canceled, nginx's 499. No response reaches the client; it is
+// for the span and the access log.
+const StatusClientClosedRequest = 499
+
+// statusError attaches an HTTP status to an error.
+type statusError struct {
+	err    error
+	status int
+}
+
+func (e *statusError) Error() string   { return e.err.Error() }
+func (e *statusError) Unwrap() error   { return e.err }
+func (e *statusError) HTTPStatus() int { return e.status }
+
+// WithHTTPStatus returns err with the HTTP status a handler should answer it
+// with, for HTTPStatus and GRPCCode. It returns nil if err is nil.
+func WithHTTPStatus(err error, status int) error {
+	if err == nil {
+		return nil
+	}
+	return &statusError{err: err, status: status}
+}
+
+// HTTPStatus returns the HTTP status to answer err with: 200 for nil, the
+// status of an error in its chain with an HTTPStatus() int method, such as
+// one from WithHTTPStatus, the mapping of a gRPC status, 504 for a missed
+// deadline and 499 for a canceled request. Anything else is 500.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	var hs interface{ HTTPStatus() int }
+	if errors.As(err, &hs) {
+		return hs.HTTPStatus()
+	}
+	var gs interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &gs) {
+		return HTTPStatusFromCode(gs.GRPCStatus().Code())
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, context.Canceled):
+		return StatusClientClosedRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// GRPCCode returns the gRPC code to answer err with: OK for nil, the code of
+// a gRPC status in its chain, the mapping of an HTTP status attached with
+// WithHTTPStatus, and DeadlineExceeded or Canceled for context errors.
+// Anything else is Unknown, as grpc-go answers errors without a status.
+func GRPCCode(err error) codes.Code {
+	if err == nil {
+		return codes.OK
+	}
+	var gs interface{ GRPCStatus() *status.Status }
+	if errors.As(err, &gs) {
+		return gs.GRPCStatus().Code()
+	}
+	var hs interface{ HTTPStatus() int }
+	if errors.As(err, &hs) {
+		return CodeFromHTTPStatus(hs.HTTPStatus())
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled
+	}
+	return codes.Unknown
+}
+
+// HTTPStatusFromCode maps a gRPC code to an HTTP status the way grpc-gateway
+// does.
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return StatusClientClosedRequest
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeFromHTTPStatus maps an HTTP status to a gRPC code, the reverse of
+// HTTPStatusFromCode. It describes what the status means, not a failed gRPC
+// transport: gRPC's own mapping, for proxies answering in HTTP, turns a 404
+// into Unimplemented.
+func CodeFromHTTPStatus(status int) codes.Code {
+	switch status {
+	case http.StatusOK:
+		return codes.OK
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case StatusClientClosedRequest:
+		return codes.Canceled
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	}
+	if status >= 200 && status < 300 {
+		return codes.OK
+	}
+	if status >= 400 && status < 500 {
+		return codes.InvalidArgument
+	}
+	return codes.Internal
+}
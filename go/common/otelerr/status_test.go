@@ -0,0 +1,116 @@
+package otelerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestHTTPStatusFromCode(t *testing.T) {
+	tests := []struct {
+		code codes.Code
+		want int
+	}{
+		{codes.OK, http.StatusOK},
+		{codes.Canceled, StatusClientClosedRequest},
+		{codes.Unknown, http.StatusInternalServerError},
+		{codes.InvalidArgument, http.StatusBadRequest},
+		{codes.DeadlineExceeded, http.StatusGatewayTimeout},
+		{codes.NotFound, http.StatusNotFound},
+		{codes.AlreadyExists, http.StatusConflict},
+		{codes.PermissionDenied, http.StatusForbidden},
+		{codes.ResourceExhausted, http.StatusTooManyRequests},
+		{codes.FailedPrecondition, http.StatusBadRequest},
+		{codes.Aborted, http.StatusConflict},
+		{codes.OutOfRange, http.StatusBadRequest},
+		{codes.Unimplemented, http.StatusNotImplemented},
+		{codes.Internal, http.StatusInternalServerError},
+		{codes.Unavailable, http.StatusServiceUnavailable},
+		{codes.DataLoss, http.StatusInternalServerError},
+		{codes.Unauthenticated, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatusFromCode(tt.code); got != tt.want {
+			t.Errorf("HTTPStatusFromCode(%v) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestCodeFromHTTPStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   codes.Code
+	}{
+		{http.StatusOK, codes.OK},
+		{http.StatusCreated, codes.OK},
+		{http.StatusNoContent, codes.OK},
+		{http.StatusBadRequest, codes.InvalidArgument},
+		{http.StatusUnauthorized, codes.Unauthenticated},
+		{http.StatusForbidden, codes.PermissionDenied},
+		// What the status means, not gRPC's Unimplemented for a proxy's 404
+		{http.StatusNotFound, codes.NotFound},
+		{http.StatusConflict, codes.AlreadyExists},
+		{http.StatusUnprocessableEntity, codes.InvalidArgument},
+		{http.StatusTooManyRequests, codes.ResourceExhausted},
+		{StatusClientClosedRequest, codes.Canceled},
+		{http.StatusInternalServerError, codes.Internal},
+		{http.StatusNotImplemented, codes.Unimplemented},
+		{http.StatusBadGateway, codes.Unavailable},
+		{http.StatusServiceUnavailable, codes.Unavailable},
+		{http.StatusGatewayTimeout, codes.DeadlineExceeded},
+		{http.StatusMovedPermanently, codes.Internal},
+	}
+	for _, tt := range tests {
+		if got := CodeFromHTTPStatus(tt.status); got != tt.want {
+			t.Errorf("CodeFromHTTPStatus(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+}
+
+// TestStatusRoundTrip checks that the statuses HTTPStatusFromCode returns map
+// back to a code that maps to the same status, so an error crossing from
+// gRPC to HTTP and back is answered the same way.
+func TestStatusRoundTrip(t *testing.T) {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		status := HTTPStatusFromCode(c)
+		if got := HTTPStatusFromCode(CodeFromHTTPStatus(status)); got != status {
+			t.Errorf("%v: %d maps to %v, which maps to %d", c, status, CodeFromHTTPStatus(status), got)
+		}
+	}
+}
+
+func TestHTTPStatusAndGRPCCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   codes.Code
+	}{
+		{"nil", nil, http.StatusOK, codes.OK},
+		{"plain", errors.New("boom"), http.StatusInternalServerError, codes.Unknown},
+		{"with status", WithHTTPStatus(errors.New("no such user"), http.StatusNotFound), http.StatusNotFound, codes.NotFound},
+		{"with status, wrapped", fmt.Errorf("get: %w", Wrap(WithHTTPStatus(errors.New("taken"), http.StatusConflict))), http.StatusConflict, codes.AlreadyExists},
+		{"grpc status", status.Error(codes.PermissionDenied, "denied"), http.StatusForbidden, codes.PermissionDenied},
+		{"deadline", fmt.Errorf("query: %w", context.DeadlineExceeded), http.StatusGatewayTimeout, codes.DeadlineExceeded},
+		{"canceled", context.Canceled, StatusClientClosedRequest, codes.Canceled},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.err); got != tt.status {
+			t.Errorf("%s: HTTPStatus = %d, want %d", tt.name, got, tt.status)
+		}
+		if got := GRPCCode(tt.err); got != tt.code {
+			t.Errorf("%s: GRPCCode = %v, want %v", tt.name, got, tt.code)
+		}
+	}
+}
+
+func TestWithHTTPStatusNil(t *testing.T) {
+	if err := WithHTTPStatus(nil, http.StatusNotFound); err != nil {
+		t.Errorf("WithHTTPStatus(nil) = %v, want nil", err)
+	}
+}
@@ -0,0 +1,161 @@
+// Package pathnorm replaces the variable parts of a URL path, such as IDs and
+// dates, with placeholders, so a path can stand in for a route template in
+// span names and metric attributes when the router doesn't expose one:
+//
+//	pathnorm.Normalize("/users/42/orders/2024-01-31") // "/users/:id/orders/:date"
+//
+// Middlewares call it on every request, so it makes a single pass over the
+// path and allocates only when it replaces something.
+package pathnorm
+
+import "strings"
+
+// Normalize replaces each path segment that is
+//
+//   - a UUID with :uuid; a UUID inside a segment, as in "order-<uuid>", is
+//     replaced in place
+//   - all digits, including Unix timestamps, with :id
+//   - a date (YYYY-MM-DD) with :date
+//   - 32 hex digits (a GUID without dashes) with :guid
+//   - a language code ("en" or "en-US") with :lang
+//
+// and trims a trailing slash.
+func Normalize(path string) string {
+	path = strings.TrimSuffix(path, "/")
+
+	var b *strings.Builder
+	start := 0
+	for start <= len(path) {
+		end := strings.IndexByte(path[start:], '/')
+		if end < 0 {
+			end = len(path)
+		} else {
+			end += start
+		}
+		seg := path[start:end]
+
+		repl, changed := normalizeSegment(seg)
+		if changed && b == nil {
+			b = &strings.Builder{}
+			b.Grow(len(path))
+			b.WriteString(path[:start])
+		}
+		if b != nil {
+			b.WriteString(repl)
+			if end < len(path) {
+				b.WriteByte('/')
+			}
+		}
+		start = end + 1
+	}
+
+	if b == nil {
+		return path
+	}
+	return b.String()
+}
+
+func normalizeSegment(seg string) (string, bool) {
+	switch {
+	case seg == "":
+		return seg, false
+	case isDigits(seg):
+		return ":id", true
+	case isUUID(seg):
+		return ":uuid", true
+	case isDate(seg):
+		return ":date", true
+	case len(seg) == 32 && isHex(seg):
+		return ":guid", true
+	case isLang(seg):
+		return ":lang", true
+	}
+	if len(seg) > 36 {
+		return replaceUUIDs(seg)
+	}
+	return seg, false
+}
+
+// replaceUUIDs replaces the UUIDs inside a longer segment.
+func replaceUUIDs(seg string) (string, bool) {
+	var b strings.Builder
+	last := 0
+	for i := 0; i+36 <= len(seg); {
+		if isUUID(seg[i : i+36]) {
+			b.WriteString(seg[last:i])
+			b.WriteString(":uuid")
+			i += 36
+			last = i
+			continue
+		}
+		i++
+	}
+	if last == 0 {
+		return seg, false
+	}
+	b.WriteString(seg[last:])
+	return b.String(), true
+}
+
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < 36; i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexByte(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func isDate(s string) bool {
+	return len(s) == 10 && s[4] == '-' && s[7] == '-' &&
+		isDigits(s[:4]) && isDigits(s[5:7]) && isDigits(s[8:])
+}
+
+func isLang(s string) bool {
+	switch len(s) {
+	case 2:
+		return isLower(s[0]) && isLower(s[1])
+	case 5:
+		return isLower(s[0]) && isLower(s[1]) && s[2] == '-' && isUpper(s[3]) && isUpper(s[4])
+	}
+	return false
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isHexByte(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHexByte(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func isLower(c byte) bool { return 'a' <= c && c <= 'z' }
+
+func isUpper(c byte) bool { return 'A' <= c && c <= 'Z' }
@@ -0,0 +1,164 @@
+package pathnorm
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users", "/users"},
+		{"/users/", "/users"},
+		{"/", ""},
+		{"", ""},
+		{"/users/42", "/users/:id"},
+		{"/users/42/orders/2024-01-31", "/users/:id/orders/:date"},
+		{"/events/1718000000", "/events/:id"},
+		{"/events/1718000000123", "/events/:id"},
+		{"/orders/3f9a2c1e-5b7d-4e8f-9a1b-2c3d4e5f6a7b", "/orders/:uuid"},
+		{"/orders/order-3f9a2c1e-5b7d-4e8f-9a1b-2c3d4e5f6a7b", "/orders/order-:uuid"},
+		{"/sessions/3f9a2c1e5b7d4e8f9a1b2c3d4e5f6a7b", "/sessions/:guid"},
+		{"/en-US/docs", "/:lang/docs"},
+		{"/users/v2", "/users/v2"},
+		{"/users/EN", "/users/EN"},
+
+		// Behaviour that changed from the regular expressions it replaced
+		{"/en/docs", "/:lang/docs"},
+		{"/a/1/2", "/a/:id/:id"},
+	}
+	for _, tt := range tests {
+		if got := Normalize(tt.path); got != tt.want {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+// TestNormalizeRegexDifferences documents where Normalize differs from the
+// regular expressions it replaced.
+func TestNormalizeRegexDifferences(t *testing.T) {
+	tests := []struct {
+		path      string
+		regex     string
+		normalize string
+	}{
+		// The language expression consumed the slash after the code
+		{"/en/docs", "/:langdocs", "/:lang/docs"},
+		// The ID expression consumed the slash the next ID started with
+		{"/a/1/2", "/a/:id/2", "/a/:id/:id"},
+	}
+	for _, tt := range tests {
+		if got := regexChain(tt.path); got != tt.regex {
+			t.Errorf("regexChain(%q) = %q, want %q", tt.path, got, tt.regex)
+		}
+		if got := Normalize(tt.path); got != tt.normalize {
+			t.Errorf("Normalize(%q) = %q, want %q", tt.path, got, tt.normalize)
+		}
+	}
+}
+
+func TestNormalizeNoAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(100, func() {
+		Normalize("/api/users/profile")
+	})
+	if allocs != 0 {
+		t.Errorf("Normalize allocated %v times on a path with nothing to replace, want 0", allocs)
+	}
+}
+
+// benchPaths are a path with an ID and a UUID, and one with nothing to
+// replace.
+var benchPaths = []struct {
+	name string
+	path string
+}{
+	{"id and uuid", "/users/42/orders/3f9a2c1e-5b7d-4e8f-9a1b-2c3d4e5f6a7b"},
+	{"unchanged", "/api/users/profile"},
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	for _, bp := range benchPaths {
+		b.Run(bp.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				Normalize(bp.path)
+			}
+		})
+	}
+}
+
+// BenchmarkRegexChain is the chain of regular expressions Normalize
+// replaced, compiled once.
+func BenchmarkRegexChain(b *testing.B) {
+	for _, bp := range benchPaths {
+		b.Run(bp.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				regexChain(bp.path)
+			}
+		})
+	}
+}
+
+// BenchmarkRegexChainCompiledPerCall is the chain as the middlewares ran it,
+// compiling the expressions on every call.
+func BenchmarkRegexChainCompiledPerCall(b *testing.B) {
+	for _, bp := range benchPaths {
+		b.Run(bp.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				regexChainCompiledPerCall(bp.path)
+			}
+		})
+	}
+}
+
+var (
+	uuidRegex      = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	numericIDRegex = regexp.MustCompile(`/\d+(/|$)`)
+	dateRegex      = regexp.MustCompile(`/\d{4}-\d{2}-\d{2}(/|$)`)
+	timestampRegex = regexp.MustCompile(`/\d{10,13}(/|$)`)
+	guidRegex      = regexp.MustCompile(`/[0-9a-fA-F]{32}(/|$)`)
+	langRegex      = regexp.MustCompile(`/[a-z]{2}(-[A-Z]{2})?(/|$)`)
+)
+
+// regexChain is the normalizePath the fasthttp and iris middlewares had
+// before Normalize, with the expressions compiled once.
+func regexChain(path string) string {
+	path = uuidRegex.ReplaceAllString(path, ":uuid")
+	path = numericIDRegex.ReplaceAllString(path, "/:id$1")
+	path = dateRegex.ReplaceAllString(path, "/:date$1")
+	path = timestampRegex.ReplaceAllString(path, "/:timestamp$1")
+	path = guidRegex.ReplaceAllString(path, "/:guid$1")
+	path = langRegex.ReplaceAllString(path, "/:lang$1")
+	return strings.TrimSuffix(path, "/")
+}
+
+// regexChainCompiledPerCall is the normalizePath the fasthttp and iris
+// middlewares had before Normalize, as it was.
+func regexChainCompiledPerCall(path string) string {
+	uuidRegex := regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+	path = uuidRegex.ReplaceAllString(path, ":uuid")
+
+	numericIDRegex := regexp.MustCompile(`/\d+(/|$)`)
+	path = numericIDRegex.ReplaceAllString(path, "/:id$1")
+
+	dateRegex := regexp.MustCompile(`/\d{4}-\d{2}-\d{2}(/|$)`)
+	path = dateRegex.ReplaceAllString(path, "/:date$1")
+
+	timestampRegex := regexp.MustCompile(`/\d{10,13}(/|$)`)
+	path = timestampRegex.ReplaceAllString(path, "/:timestamp$1")
+
+	guidRegex := regexp.MustCompile(`/[0-9a-fA-F]{32}(/|$)`)
+	path = guidRegex.ReplaceAllString(path, "/:guid$1")
+
+	langRegex := regexp.MustCompile(`/[a-z]{2}(-[A-Z]{2})?(/|$)`)
+	path = langRegex.ReplaceAllString(path, "/:lang$1")
+
+	path = strings.TrimSuffix(path, "/")
+
+	return path
+}
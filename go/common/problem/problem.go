@@ -0,0 +1,231 @@
+// Package problem answers failed requests with RFC 7807 problem details that
+// carry the request's trace ID, and sets the traceresponse and Server-Timing
+// headers on every response. A user who reports an error, or support reading
+// a HAR file, then has the trace ID to paste into Last9.
+//
+// The middleware rewrites the error responses handlers already write, with
+// http.Error or a JSON {"error": "..."} body, so handlers don't change:
+//
+//	HTTP/1.1 404 Not Found
+//	Content-Type: application/problem+json
+//	Traceresponse: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+//	Server-Timing: traceparent;desc="00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+//
+//	{"type":"about:blank","title":"Not Found","status":404,"detail":"user not found",
+//	 "instance":"/users/42","trace_id":"4bf92f3577b34da6a3ce929d0e0e4736"}
+//
+// Run it inside the HTTP instrumentation, so the server span exists:
+//
+//	mux.Handle("GET /users/{id}", problem.Middleware(http.HandlerFunc(getUser)))
+//
+// Other frameworks call SetTraceHeaders, and FromResponse and Write for the
+// error responses they capture.
+package problem
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ContentType is the media type of problem details.
+const ContentType = "application/problem+json"
+
+// maxBody is how much of a handler's error body is kept to find its message.
+const maxBody = 4 << 10
+
+// Details is an RFC 7807 problem details object, with the trace ID as an
+// extension member.
+type Details struct {
+	// Type is a URI for the kind of problem. "about:blank" means the
+	// status code says it all.
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	// Detail is the message for this occurrence, such as "user not found".
+	Detail string `json:"detail,omitempty"`
+	// Instance is the path of the request that failed.
+	Instance string `json:"instance,omitempty"`
+	// TraceID is the ID of the trace of the request, empty if there is none.
+	TraceID string `json:"trace_id,omitempty"`
+	// Extensions are more members, such as the timeout_seconds of a
+	// request that timed out. They can't replace the members above.
+	Extensions map[string]any `json:"-"`
+}
+
+// MarshalJSON writes the extension members after the standard ones.
+func (d Details) MarshalJSON() ([]byte, error) {
+	type details Details
+	b, err := json.Marshal(details(d))
+	if err != nil || len(d.Extensions) == 0 {
+		return b, err
+	}
+	var std map[string]json.RawMessage
+	if err := json.Unmarshal(b, &std); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(d.Extensions))
+	for k := range d.Extensions {
+		if _, ok := std[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	slices.Sort(keys)
+	b = b[:len(b)-1] // the closing brace
+	for _, k := range keys {
+		kb, _ := json.Marshal(k)
+		vb, err := json.Marshal(d.Extensions[k])
+		if err != nil {
+			return nil, err
+		}
+		b = append(append(append(append(b, ','), kb...), ':'), vb...)
+	}
+	return append(b, '}'), nil
+}
+
+// New returns the problem details of a status, for the request r.
+func New(r *http.Request, status int, detail string) Details {
+	d := Details{
+		Type:     "about:blank",
+		Title:    http.StatusText(status),
+		Status:   status,
+		Detail:   detail,
+		Instance: r.URL.Path,
+	}
+	if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+		d.TraceID = sc.TraceID().String()
+	}
+	return d
+}
+
+// FromResponse returns the problem details of an error response a handler
+// wrote for r. The detail is the "error" (or "message") member of a JSON
+// body, whose other members become extensions, or else the text of the body.
+func FromResponse(r *http.Request, status int, body []byte) Details {
+	body = bytes.TrimSpace(body)
+	var obj map[string]any
+	if json.Unmarshal(body, &obj) == nil {
+		var detail string
+		for _, key := range []string{"error", "message"} {
+			if s, ok := obj[key].(string); ok {
+				detail = s
+				delete(obj, key)
+				break
+			}
+		}
+		d := New(r, status, detail)
+		if len(obj) > 0 {
+			d.Extensions = obj
+		}
+		return d
+	}
+	return New(r, status, string(body))
+}
+
+// Write answers with d.
+func Write(w http.ResponseWriter, d Details) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		b, _ = json.Marshal(Details{Type: d.Type, Title: d.Title, Status: d.Status, TraceID: d.TraceID})
+	}
+	h := w.Header()
+	h.Set("Content-Type", ContentType)
+	h.Del("Content-Length")
+	// http.Error sets it, but the body is JSON now
+	h.Del("X-Content-Type-Options")
+	w.WriteHeader(d.Status)
+	_, _ = w.Write(append(b, '\n'))
+}
+
+// IsProblem reports whether h is already the header of problem details, which
+// are passed through as they are.
+func IsProblem(h http.Header) bool {
+	return strings.HasPrefix(h.Get("Content-Type"), ContentType)
+}
+
+// SetTraceHeaders sets the traceresponse header of W3C Trace Context Level 2,
+// and the Server-Timing traceparent entry browsers expose to JavaScript, to
+// the span in ctx. It sets neither if ctx has no span. The sampled flag tells
+// whether the trace was recorded, and so can be found.
+func SetTraceHeaders(ctx context.Context, h http.Header) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+	tp := "00-" + sc.TraceID().String() + "-" + sc.SpanID().String() + "-" + sc.TraceFlags().String()
+	h.Set("traceresponse", tp)
+	h.Add("Server-Timing", `traceparent;desc="`+tp+`"`)
+}
+
+// Middleware sets the trace headers on every response of next, and replaces
+// its error responses, those with a status of 400 or more, with problem
+// details. Responses that are already problem details pass through.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetTraceHeaders(r.Context(), w.Header())
+		pw := &responseWriter{ResponseWriter: w}
+		next.ServeHTTP(pw, r)
+		if pw.captured != nil {
+			Write(w, FromResponse(r, pw.status, pw.captured.Bytes()))
+		}
+	})
+}
+
+// responseWriter holds back an error response, keeping the start of its
+// body, so Middleware can answer with problem details instead.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+	status      int
+	// captured is the error body, nil if the response isn't an error
+	captured *bytes.Buffer
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	if code >= http.StatusBadRequest && !IsProblem(w.Header()) {
+		w.status = code
+		w.captured = new(bytes.Buffer)
+		return
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.captured == nil {
+		return w.ResponseWriter.Write(b)
+	}
+	if room := maxBody - w.captured.Len(); room > 0 {
+		w.captured.Write(b[:min(len(b), room)])
+	}
+	return len(b), nil
+}
+
+// Flush flushes the response, unless it's an error being held back: flushing
+// would send it as it is.
+func (w *responseWriter) Flush() {
+	_ = w.FlushError()
+}
+
+func (w *responseWriter) FlushError() error {
+	if w.captured != nil {
+		return nil
+	}
+	return http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,193 @@
+// Package ratelimit limits request rates with token buckets, and makes the
+// throttling visible: requests the limiter rejects get ratelimit.limited=true
+// and a ratelimit.rejected event on their span, and the tokens left in each
+// bucket are observable gauges, so a limiter running dry shows before
+// clients see 429s.
+//
+//	limiter := ratelimit.New(ratelimit.Config{Name: "api", Rate: 10, Burst: 20})
+//	mux.Handle("GET /users", limiter.Middleware(http.HandlerFunc(listUsers)))
+//
+// Other frameworks call Allow and write the 429 themselves. Each Limiter is
+// one bucket, shared by every request it sees, in one process: replicas each
+// allow the full rate.
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// ScopeName is the instrumentation scope of the limiter metrics.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/ratelimit"
+
+// The instrument names. All of them have NameKey.
+const (
+	// RequestsName counts requests the limiter decided on, by LimitedKey and
+	// the caller's attributes. Unit {request}.
+	RequestsName = "ratelimit.requests"
+	// TokensName is a gauge of the tokens left in the bucket. Each request
+	// takes one. Unit {token}.
+	TokensName = "ratelimit.tokens.available"
+	// BurstName is a gauge of Config.Burst, the most tokens the bucket
+	// holds. Unit {token}.
+	BurstName = "ratelimit.tokens.limit"
+)
+
+// Attribute keys.
+const (
+	// NameKey is Config.Name.
+	NameKey = attribute.Key("ratelimit.name")
+	// LimitedKey is true on the spans of rejected requests, and false on
+	// those of allowed ones.
+	LimitedKey = attribute.Key("ratelimit.limited")
+	// RetryAfterKey is when a rejected request could have been allowed, in
+	// seconds.
+	RetryAfterKey = attribute.Key("ratelimit.retry_after")
+)
+
+// Config configures New.
+type Config struct {
+	// Name tells limiters apart in spans and metrics.
+	Name string
+	// Rate is the number of requests allowed per second, on average.
+	Rate float64
+	// Burst is the number of requests allowed at once, after a quiet period.
+	Burst int
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+// ConfigFromEnv returns a Config named name with Rate from the variable
+// prefix+"_RPS" and Burst from prefix+"_BURST", such as RATE_LIMIT_RPS=10
+// and RATE_LIMIT_BURST=20, or rps and burst if they are unset or invalid.
+func ConfigFromEnv(name, prefix string, rps float64, burst int) Config {
+	cfg := Config{Name: name, Rate: rps, Burst: burst}
+	if r, err := strconv.ParseFloat(os.Getenv(prefix+"_RPS"), 64); err == nil && r > 0 {
+		cfg.Rate = r
+	}
+	if b, err := strconv.Atoi(os.Getenv(prefix + "_BURST")); err == nil && b > 0 {
+		cfg.Burst = b
+	}
+	return cfg
+}
+
+// Limiter is a token bucket with instrumentation.
+type Limiter struct {
+	cfg      Config
+	bucket   *rate.Limiter
+	name     attribute.KeyValue
+	requests metric.Int64Counter
+}
+
+// New returns a Limiter with a full bucket, and registers its gauges.
+func New(cfg Config) *Limiter {
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	l := &Limiter{
+		cfg:    cfg,
+		bucket: rate.NewLimiter(rate.Limit(cfg.Rate), cfg.Burst),
+		name:   NameKey.String(cfg.Name),
+	}
+	meter := cfg.MeterProvider.Meter(ScopeName)
+	var err error
+	if l.requests, err = meter.Int64Counter(RequestsName,
+		metric.WithDescription("Requests the rate limiter allowed or rejected"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	tokens, err := meter.Float64ObservableGauge(TokensName,
+		metric.WithDescription("Tokens left in the rate limiter's bucket"),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	burst, err := meter.Int64ObservableGauge(BurstName,
+		metric.WithDescription("Most tokens the rate limiter's bucket holds"),
+		metric.WithUnit("{token}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	if _, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		set := metric.WithAttributes(l.name)
+		o.ObserveFloat64(tokens, l.bucket.Tokens(), set)
+		o.ObserveInt64(burst, int64(cfg.Burst), set)
+		return nil
+	}, tokens, burst); err != nil {
+		otel.Handle(err)
+	}
+	return l
+}
+
+// Allow takes a token for a request, and reports whether there was one. If
+// not, retryAfter is when there will be.
+//
+// It sets ratelimit.name and ratelimit.limited on the span in ctx, and a
+// rejected request gets a ratelimit.rejected event with the limiter's rate,
+// burst and retry-after. The span status is left unset, as for any 4xx.
+// The request is counted with metricAttrs, such as http.route.
+func (l *Limiter) Allow(ctx context.Context, metricAttrs ...attribute.KeyValue) (ok bool, retryAfter time.Duration) {
+	now := time.Now()
+	r := l.bucket.ReserveN(now, 1)
+	if !r.OK() {
+		// A burst of 0 allows nothing
+		retryAfter = time.Duration(math.MaxInt64)
+	} else if retryAfter = r.DelayFrom(now); retryAfter > 0 {
+		// Give the token back: the request isn't going to wait for it
+		r.CancelAt(now)
+	}
+	ok = r.OK() && retryAfter == 0
+
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(l.name, LimitedKey.Bool(!ok))
+	if !ok {
+		span.AddEvent("ratelimit.rejected", trace.WithAttributes(
+			l.name,
+			attribute.Float64("ratelimit.rate", l.cfg.Rate),
+			attribute.Int("ratelimit.burst", l.cfg.Burst),
+			RetryAfterKey.Float64(retryAfter.Seconds()),
+		))
+	}
+	if l.requests != nil {
+		attrs := append([]attribute.KeyValue{l.name, LimitedKey.Bool(!ok)}, metricAttrs...)
+		l.requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	return ok, retryAfter
+}
+
+// RetryAfterSeconds is the Retry-After header value for retryAfter: whole
+// seconds, rounded up.
+func RetryAfterSeconds(retryAfter time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(retryAfter.Seconds())), 10)
+}
+
+// Middleware answers requests the limiter rejects with 429 and a Retry-After
+// header, instead of calling next. Run it inside the HTTP instrumentation so
+// the server span already exists.
+func (l *Limiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ok, retryAfter := l.Allow(r.Context(), attribute.String("http.request.method", r.Method))
+		if ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", RetryAfterSeconds(retryAfter))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]any{
+			"error":               "rate limit exceeded",
+			"retry_after_seconds": retryAfter.Seconds(),
+		})
+	})
+}
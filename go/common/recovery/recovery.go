@@ -0,0 +1,158 @@
+// Package recovery recovers panics in HTTP handlers and records them the way
+// the OpenTelemetry semantic conventions describe exceptions: an exception
+// event on the server span with exception.type, exception.message and
+// exception.stacktrace, status Error, and a 500 response. Every panic also
+// increments the panics counter, exported to Prometheus as panics_total, so
+// panics can be alerted on without searching traces.
+//
+// For net/http routers, add the middleware inside the HTTP instrumentation,
+// so the server span exists when a panic is recorded:
+//
+//	r := chi.NewRouter()
+//	r.Use(recovery.Middleware(func(r *http.Request) string {
+//		return chi.RouteContext(r.Context()).RoutePattern()
+//	}))
+//	handler := chiagent.Use(r)
+//
+// Frameworks with their own handler types recover the panic themselves and
+// pass it to Recorder.Record.
+package recovery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the panics counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/recovery"
+
+// Recorder records recovered panics. Create it with New.
+type Recorder struct {
+	panics metric.Int64Counter
+}
+
+// New returns a Recorder that counts panics with mp, or with the global
+// MeterProvider if mp is nil.
+func New(mp metric.MeterProvider) *Recorder {
+	if mp == nil {
+		mp = otel.GetMeterProvider()
+	}
+	panics, err := mp.Meter(ScopeName).Int64Counter("panics",
+		metric.WithDescription("Panics recovered in request handlers, by exception.type"),
+		metric.WithUnit("{panic}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &Recorder{panics: panics}
+}
+
+// Record records v, a value recovered from a panic, on the span in ctx and
+// in the panics counter. stack is the panicking goroutine's stack, from
+// debug.Stack(), taken in the deferred function that recovered v: later, the
+// frames that panicked are gone. attrs are added to the counter, such as
+// http.request.method and http.route; they must have few distinct values.
+//
+// Record returns the exception type, which callers also set as error.type.
+// It doesn't answer the request: writing the 500 is up to the caller.
+func (r *Recorder) Record(ctx context.Context, v any, stack []byte, attrs ...attribute.KeyValue) string {
+	typ, msg := Describe(v)
+	span := trace.SpanFromContext(ctx)
+	if span.IsRecording() {
+		span.AddEvent(semconv.ExceptionEventName, trace.WithAttributes(
+			semconv.ExceptionType(typ),
+			semconv.ExceptionMessage(msg),
+			semconv.ExceptionStacktrace(string(stack)),
+		))
+		span.SetStatus(codes.Error, msg)
+	}
+	if r.panics != nil {
+		attrs = append(attrs, semconv.ExceptionType(typ))
+		r.panics.Add(ctx, 1, metric.WithAttributes(attrs...))
+	}
+	return typ
+}
+
+// Describe returns the type and message of a recovered panic value. For an
+// error, the type is the error's, so panic(err) and a runtime error such as
+// a nil map write are told apart from panic("message").
+func Describe(v any) (typ, msg string) {
+	if err, ok := v.(error); ok {
+		return fmt.Sprintf("%T", err), err.Error()
+	}
+	return fmt.Sprintf("%T", v), fmt.Sprint(v)
+}
+
+// Middleware returns net/http middleware that recovers panics in next,
+// records them with a Recorder using the global MeterProvider, and answers
+// 500. route returns the route the request matched, for the counter; it may
+// be nil, and it returns "" for requests that matched none.
+//
+// If the handler had already written the response headers, the status can't
+// change any more: the response is aborted with http.ErrAbortHandler
+// instead, so the client sees a broken response rather than a truncated one
+// that looks complete. A panic with http.ErrAbortHandler itself is how
+// handlers abort on purpose, and isn't recorded.
+func Middleware(route func(*http.Request) string) func(http.Handler) http.Handler {
+	rec := New(nil)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			rw := &responseWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if err, ok := v.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+					panic(v)
+				}
+				stack := debug.Stack()
+				attrs := []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(req.Method)}
+				if route != nil {
+					if rt := route(req); rt != "" {
+						attrs = append(attrs, semconv.HTTPRoute(rt))
+					}
+				}
+				typ := rec.Record(req.Context(), v, stack, attrs...)
+				trace.SpanFromContext(req.Context()).SetAttributes(semconv.ErrorTypeKey.String(typ))
+				if rw.wroteHeader {
+					panic(http.ErrAbortHandler)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusInternalServerError)
+				_, _ = w.Write([]byte(`{"error":"internal server error"}` + "\n"))
+			}()
+			next.ServeHTTP(rw, req)
+		})
+	}
+}
+
+// responseWriter notes whether the response headers were written. Unwrap
+// lets http.ResponseController reach the Flusher and Hijacker underneath.
+type responseWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.wroteHeader = true
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
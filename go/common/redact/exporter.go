@@ -0,0 +1,79 @@
+package redact
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporter redacts span and span event attributes before passing spans to
+// the wrapped exporter.
+//
+// Redaction is done at export rather than in a SpanProcessor because
+// attributes can be set at any point while a span is open, and a processor
+// only sees a read-only span once it has ended. Exporting also happens off
+// the request path when the exporter is used with a batcher.
+type Exporter struct {
+	next     sdktrace.SpanExporter
+	redactor *Redactor
+}
+
+var _ sdktrace.SpanExporter = (*Exporter)(nil)
+
+// NewExporter returns an Exporter that redacts spans with r before sending
+// them to next.
+func NewExporter(next sdktrace.SpanExporter, r *Redactor) *Exporter {
+	return &Exporter{next: next, redactor: r}
+}
+
+// ExportSpans redacts spans and exports them with the wrapped exporter.
+// Spans with nothing to redact are passed through as-is.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	out := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, s := range spans {
+		out[i] = e.redactSpan(s)
+	}
+	return e.next.ExportSpans(ctx, out)
+}
+
+// Shutdown shuts down the wrapped exporter.
+func (e *Exporter) Shutdown(ctx context.Context) error {
+	return e.next.Shutdown(ctx)
+}
+
+func (e *Exporter) redactSpan(s sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attrs, attrsChanged := e.redactor.Attributes(s.Attributes())
+
+	events := s.Events()
+	eventsChanged := false
+	for i, ev := range events {
+		evAttrs, changed := e.redactor.Attributes(ev.Attributes)
+		if !changed {
+			continue
+		}
+		if !eventsChanged {
+			events = append([]sdktrace.Event(nil), events...)
+			eventsChanged = true
+		}
+		events[i].Attributes = evAttrs
+	}
+
+	if !attrsChanged && !eventsChanged {
+		return s
+	}
+	return &redactedSpan{ReadOnlySpan: s, attrs: attrs, events: events}
+}
+
+// redactedSpan overrides the attributes and events of a span. Embedding the
+// original span provides every other field, including the unexported method
+// that ReadOnlySpan requires.
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attrs  []attribute.KeyValue
+	events []sdktrace.Event
+}
+
+func (s *redactedSpan) Attributes() []attribute.KeyValue { return s.attrs }
+
+func (s *redactedSpan) Events() []sdktrace.Event { return s.events }
@@ -0,0 +1,195 @@
+// Package redact masks sensitive span attribute values before they are
+// exported.
+//
+// Attributes are often set from request data: SQL statements with their
+// literal values, URLs with tokens in the query string, or the names of the
+// secrets a service reads. A Redactor applies a list of Rules to those
+// values, and Exporter runs it on every span just before export, so no
+// instrumentation needs to change:
+//
+//	r, _ := redact.New(redact.DefaultRules...)
+//	sdktrace.NewTracerProvider(sdktrace.WithBatcher(redact.NewExporter(exporter, r)))
+//
+// Rules can also be loaded from JSON with RulesFromEnv.
+package redact
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Mask replaces redacted values when a Rule has no Replacement.
+const Mask = "[REDACTED]"
+
+// Rule masks the value of a string attribute.
+//
+// With no Pattern the whole value is replaced. With a Pattern, each match is
+// replaced and the rest of the value is kept; Replacement may refer to
+// capture groups as ${1}.
+type Rule struct {
+	// Key is the attribute key the rule applies to. An empty Key applies the
+	// rule to every string attribute.
+	Key         string `json:"key"`
+	Pattern     string `json:"pattern,omitempty"`
+	Replacement string `json:"replacement,omitempty"`
+}
+
+// DefaultRules mask literal values in SQL statements and query parameter
+// values in URLs. Keys and paths are kept so spans stay readable.
+var DefaultRules = []Rule{
+	// 'quoted strings' and numbers become ?, as in a prepared statement
+	{Key: "db.statement", Pattern: `'(?:[^']|'')*'`, Replacement: "?"},
+	{Key: "db.statement", Pattern: `([^\w$.?])\d+(?:\.\d+)?\b`, Replacement: "${1}?"},
+	{Key: "db.query.text", Pattern: `'(?:[^']|'')*'`, Replacement: "?"},
+	{Key: "db.query.text", Pattern: `([^\w$.?])\d+(?:\.\d+)?\b`, Replacement: "${1}?"},
+	{Key: "http.url", Pattern: `([?&][^=&#]+)=[^&#]*`, Replacement: "${1}=" + Mask},
+	{Key: "url.full", Pattern: `([?&][^=&#]+)=[^&#]*`, Replacement: "${1}=" + Mask},
+	{Key: "url.query", Pattern: `((?:^|&)[^=&]+)=[^&]*`, Replacement: "${1}=" + Mask},
+}
+
+type compiledRule struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// Redactor applies Rules to attribute values. It is safe for concurrent use.
+type Redactor struct {
+	byKey map[attribute.Key][]compiledRule
+	any   []compiledRule
+}
+
+// New compiles rules into a Redactor. Rules for the same key are applied in
+// order, after the rules with an empty Key.
+func New(rules ...Rule) (*Redactor, error) {
+	r := &Redactor{byKey: make(map[attribute.Key][]compiledRule)}
+	for _, rule := range rules {
+		cr := compiledRule{replacement: rule.Replacement}
+		if cr.replacement == "" {
+			cr.replacement = Mask
+		}
+		if rule.Pattern != "" {
+			re, err := regexp.Compile(rule.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("redact: rule for %q: %w", rule.Key, err)
+			}
+			cr.re = re
+		}
+		if rule.Key == "" {
+			r.any = append(r.any, cr)
+		} else {
+			k := attribute.Key(rule.Key)
+			r.byKey[k] = append(r.byKey[k], cr)
+		}
+	}
+	return r, nil
+}
+
+// Value returns v with the rules for key applied.
+func (r *Redactor) Value(key, v string) string {
+	return r.apply(attribute.Key(key), v)
+}
+
+func (r *Redactor) apply(key attribute.Key, v string) string {
+	for _, rules := range [][]compiledRule{r.any, r.byKey[key]} {
+		for _, cr := range rules {
+			if cr.re == nil {
+				return cr.replacement
+			}
+			v = cr.re.ReplaceAllString(v, cr.replacement)
+		}
+	}
+	return v
+}
+
+// Attributes returns attrs with string and string slice values redacted.
+// attrs is returned unchanged, and the second result is false, when no value
+// was changed.
+func (r *Redactor) Attributes(attrs []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	var out []attribute.KeyValue
+	for i, kv := range attrs {
+		redacted, changed := r.keyValue(kv)
+		if !changed {
+			if out != nil {
+				out = append(out, kv)
+			}
+			continue
+		}
+		if out == nil {
+			out = make([]attribute.KeyValue, i, len(attrs))
+			copy(out, attrs[:i])
+		}
+		out = append(out, redacted)
+	}
+	if out == nil {
+		return attrs, false
+	}
+	return out, true
+}
+
+func (r *Redactor) keyValue(kv attribute.KeyValue) (attribute.KeyValue, bool) {
+	if len(r.any) == 0 && len(r.byKey[kv.Key]) == 0 {
+		return kv, false
+	}
+	switch kv.Value.Type() {
+	case attribute.STRING:
+		v := kv.Value.AsString()
+		if rv := r.apply(kv.Key, v); rv != v {
+			return kv.Key.String(rv), true
+		}
+	case attribute.STRINGSLICE:
+		vs := kv.Value.AsStringSlice()
+		changed := false
+		for i, v := range vs {
+			if rv := r.apply(kv.Key, v); rv != v {
+				vs[i] = rv
+				changed = true
+			}
+		}
+		if changed {
+			return kv.Key.StringSlice(vs), true
+		}
+	}
+	return kv, false
+}
+
+// ParseRules decodes a JSON array of rules, for example:
+//
+//	[{"key": "aws.secretsmanager.secret.id"},
+//	 {"key": "url.path", "pattern": "(/secrets/)[^/]+", "replacement": "${1}[REDACTED]"}]
+func ParseRules(data []byte) ([]Rule, error) {
+	var rules []Rule
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("redact: invalid rules: %w", err)
+	}
+	return rules, nil
+}
+
+// RulesFromEnv loads rules from the file named by REDACT_RULES_FILE and from
+// the JSON in REDACT_RULES, in that order. It returns no rules if neither is
+// set.
+func RulesFromEnv() ([]Rule, error) {
+	var rules []Rule
+	if path := os.Getenv("REDACT_RULES_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("redact: %w", err)
+		}
+		fileRules, err := ParseRules(data)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, fileRules...)
+	}
+	if v := os.Getenv("REDACT_RULES"); v != "" {
+		envRules, err := ParseRules([]byte(v))
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, envRules...)
+	}
+	return rules, nil
+}
@@ -0,0 +1,116 @@
+package resilience
+
+import (
+	"sync"
+	"time"
+)
+
+// State is a circuit breaker state.
+type State int
+
+const (
+	// Closed lets calls through and counts consecutive failures.
+	Closed State = iota
+	// HalfOpen lets one trial call through; its result closes or reopens
+	// the breaker.
+	HalfOpen
+	// Open rejects calls until OpenTimeout has passed.
+	Open
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case HalfOpen:
+		return "half_open"
+	case Open:
+		return "open"
+	}
+	return "unknown"
+}
+
+type breaker struct {
+	threshold   int
+	openTimeout time.Duration
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether a call may go ahead and whether it is the trial
+// call, and the state before and after the check: an open breaker past its
+// timeout becomes half-open.
+func (b *breaker) allow(now time.Time) (ok, trial bool, state, from State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+	switch b.state {
+	case Open:
+		if now.Sub(b.openedAt) < b.openTimeout {
+			return false, false, b.state, from
+		}
+		b.state = HalfOpen
+		b.trial = true
+		return true, true, b.state, from
+	case HalfOpen:
+		if b.trial {
+			return false, false, b.state, from
+		}
+		b.trial = true
+		return true, true, b.state, from
+	}
+	return true, false, b.state, from
+}
+
+// done records the result of an allowed call, and returns the state before
+// and after. Only the trial call decides a half-open breaker; a call let
+// through before the breaker opened changes nothing once it has.
+func (b *breaker) done(trial, ok bool, now time.Time) (state, from State) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	from = b.state
+	switch {
+	case trial && b.state == HalfOpen:
+		b.trial = false
+		if ok {
+			b.state = Closed
+			b.failures = 0
+		} else {
+			b.state = Open
+			b.openedAt = now
+		}
+	case !trial && b.state == Closed:
+		if ok {
+			b.failures = 0
+			break
+		}
+		b.failures++
+		if b.failures >= b.threshold {
+			b.state = Open
+			b.openedAt = now
+		}
+	}
+	return b.state, from
+}
+
+// abandon records an allowed call that ended without a result, such as one
+// its caller canceled. A trial call frees the way for the next one.
+func (b *breaker) abandon(trial bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if trial && b.state == HalfOpen {
+		b.trial = false
+	}
+}
+
+func (b *breaker) current() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
@@ -0,0 +1,263 @@
+// Package resilience retries calls to a dependency with exponential backoff
+// behind a circuit breaker, and traces both, so a degraded third-party API
+// shows up in traces as retries and an open breaker rather than as slow or
+// failed requests:
+//
+//	jokeAPI := resilience.New(resilience.Config{Name: "joke-api"})
+//
+//	err := jokeAPI.Do(ctx, func(ctx context.Context) error {
+//	    resp, err := client.Do(req.WithContext(ctx))
+//	    if err != nil {
+//	        return err
+//	    }
+//	    defer resp.Body.Close()
+//	    return resilience.CheckStatus(resp.StatusCode)
+//	})
+//
+// Do runs under a span named after the dependency, with a child span per
+// attempt; the client span of the call, such as otelhttp's, is a child of the
+// attempt span. Breaker transitions are events on the attempt span that
+// caused them, and the breaker state is reported as the circuit_breaker.state
+// gauge.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans and metrics.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/resilience"
+
+// ErrOpen is returned by Do, without calling the dependency, while the
+// breaker is open.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// Config configures a Policy. Zero fields take the defaults.
+type Config struct {
+	// Name names the dependency, in span names and as circuit_breaker.name.
+	Name string
+	// MaxAttempts is the number of calls Do makes, the first included.
+	// Defaults to 3.
+	MaxAttempts int
+	// InitialBackoff is the longest wait before the first retry. The longest
+	// wait doubles on each retry, up to MaxBackoff, and the actual wait is
+	// random below it, so retries from many requests don't arrive together.
+	// Defaults to 100ms and 2s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// FailureThreshold is the number of consecutive failed calls that opens
+	// the breaker. Defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before it lets a trial
+	// call through. Defaults to 30s.
+	OpenTimeout time.Duration
+}
+
+// Policy retries and breaks calls to one dependency. It is safe for
+// concurrent use; share one per dependency, so all requests see the same
+// breaker.
+type Policy struct {
+	cfg     Config
+	breaker *breaker
+	tracer  trace.Tracer
+	changes metric.Int64Counter
+	attrs   attribute.Set
+	// now is the breaker's clock, replaced in tests
+	now func() time.Time
+}
+
+// New returns a Policy for the dependency and registers its state gauge.
+// Instrument errors are reported to the OpenTelemetry error handler.
+func New(cfg Config) *Policy {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 3
+	}
+	if cfg.InitialBackoff <= 0 {
+		cfg.InitialBackoff = 100 * time.Millisecond
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = 2 * time.Second
+	}
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = 5
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+
+	p := &Policy{
+		cfg:     cfg,
+		breaker: &breaker{threshold: cfg.FailureThreshold, openTimeout: cfg.OpenTimeout},
+		tracer:  otel.Tracer(ScopeName),
+		attrs:   attribute.NewSet(attribute.String("circuit_breaker.name", cfg.Name)),
+		now:     time.Now,
+	}
+
+	meter := otel.Meter(ScopeName)
+	var err error
+	p.changes, err = meter.Int64Counter("circuit_breaker.state_changes",
+		metric.WithDescription("Circuit breaker state transitions, by the state entered"),
+		metric.WithUnit("{transition}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	gauge, err := meter.Int64ObservableGauge("circuit_breaker.state",
+		metric.WithDescription("Circuit breaker state: 0 closed, 1 half-open, 2 open"))
+	if err != nil {
+		otel.Handle(err)
+		return p
+	}
+	if _, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveInt64(gauge, int64(p.State()), metric.WithAttributeSet(p.attrs))
+		return nil
+	}, gauge); err != nil {
+		otel.Handle(err)
+	}
+	return p
+}
+
+// State returns the current breaker state.
+func (p *Policy) State() State {
+	return p.breaker.current()
+}
+
+// Do calls op until it succeeds, returns a Permanent error, or has been
+// called MaxAttempts times, waiting between attempts. It returns the last
+// error, or ErrOpen if the breaker rejected the call. op must respect ctx.
+func (p *Policy) Do(ctx context.Context, op func(ctx context.Context) error) (err error) {
+	ctx, span := p.tracer.Start(ctx, p.cfg.Name,
+		trace.WithAttributes(
+			attribute.String("circuit_breaker.name", p.cfg.Name),
+			attribute.Int("resilience.max_attempts", p.cfg.MaxAttempts),
+		))
+	attempts := 0
+	defer func() {
+		span.SetAttributes(attribute.Int("resilience.attempts", attempts))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	var wait time.Duration
+	for attempts < p.cfg.MaxAttempts {
+		if attempts > 0 {
+			wait = p.backoff(attempts)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return errors.Join(err, ctx.Err())
+			case <-timer.C:
+			}
+		}
+		attempts++
+		err = p.attempt(ctx, attempts, wait, op)
+		if err == nil || errors.Is(err, ErrOpen) || isPermanent(err) || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+func (p *Policy) attempt(ctx context.Context, n int, wait time.Duration, op func(ctx context.Context) error) (err error) {
+	ctx, span := p.tracer.Start(ctx, p.cfg.Name+" attempt",
+		trace.WithAttributes(
+			attribute.Int("resilience.attempt", n),
+			attribute.Float64("resilience.backoff", wait.Seconds()),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	allowed, trial, state, from := p.breaker.allow(p.now())
+	p.transitioned(ctx, span, from, state)
+	span.SetAttributes(attribute.String("circuit_breaker.state", state.String()))
+	if !allowed {
+		return ErrOpen
+	}
+
+	err = op(ctx)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which says nothing about the dependency
+		p.breaker.abandon(trial)
+		return err
+	}
+	// A permanent error is an answer from a working dependency, such as a
+	// 404, so it doesn't count toward opening the breaker
+	state, from = p.breaker.done(trial, err == nil || isPermanent(err), p.now())
+	p.transitioned(ctx, span, from, state)
+	return err
+}
+
+// transitioned records a breaker transition, if there was one.
+func (p *Policy) transitioned(ctx context.Context, span trace.Span, from, to State) {
+	if from == to {
+		return
+	}
+	span.AddEvent("circuit_breaker.state_change", trace.WithAttributes(
+		attribute.String("circuit_breaker.state.previous", from.String()),
+		attribute.String("circuit_breaker.state", to.String()),
+	))
+	if p.changes != nil {
+		p.changes.Add(ctx, 1, metric.WithAttributeSet(p.attrs),
+			metric.WithAttributes(attribute.String("circuit_breaker.state", to.String())))
+	}
+}
+
+// backoff returns the wait before retry n, with full jitter.
+func (p *Policy) backoff(n int) time.Duration {
+	ceiling := p.cfg.InitialBackoff << (n - 1)
+	if ceiling > p.cfg.MaxBackoff || ceiling <= 0 {
+		ceiling = p.cfg.MaxBackoff
+	}
+	return rand.N(ceiling) + 1
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying. Do returns it after the first
+// attempt, and the breaker doesn't count it as a failure.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+func isPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+// CheckStatus returns nil for a status below 400. 429 and 5xx are retried
+// and count toward opening the breaker; other 4xx are Permanent.
+func CheckStatus(code int) error {
+	if code < 400 {
+		return nil
+	}
+	err := fmt.Errorf("unexpected status %d %s", code, http.StatusText(code))
+	if code == http.StatusTooManyRequests || code >= 500 {
+		return err
+	}
+	return Permanent(err)
+}
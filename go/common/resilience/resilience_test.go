@@ -0,0 +1,216 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// clock is a fake clock for the breaker, moved on by hand.
+type clock struct{ t time.Time }
+
+func newClock() *clock                   { return &clock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)} }
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+var errDown = errors.New("dependency down")
+
+// step is one call on a breaker with a threshold of 3 and an open timeout
+// of 10s: after moving the clock on by advance, allow is checked, and an
+// allowed call is finished with ok unless pending is set, which leaves it
+// in flight.
+type step struct {
+	advance time.Duration
+	ok      bool
+	pending bool
+	allowed bool
+	state   State
+}
+
+func TestBreaker(t *testing.T) {
+	fail := step{allowed: true, state: Closed}
+	succeed := step{ok: true, allowed: true, state: Closed}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"opens at the threshold", []step{fail, fail, {allowed: true, state: Open}}},
+		{"rejects while open", []step{
+			fail, fail, {allowed: true, state: Open},
+			{advance: 9 * time.Second, state: Open},
+		}},
+		{"success resets the failure count", []step{
+			fail, fail, succeed, fail, fail,
+			{allowed: true, state: Open},
+		}},
+		{"trial success closes", []step{
+			fail, fail, {allowed: true, state: Open},
+			{advance: 10 * time.Second, ok: true, allowed: true, state: Closed},
+			fail, fail,
+		}},
+		{"trial failure reopens", []step{
+			fail, fail, {allowed: true, state: Open},
+			{advance: 10 * time.Second, allowed: true, state: Open},
+			{advance: 9 * time.Second, state: Open},
+			{advance: time.Second, ok: true, allowed: true, state: Closed},
+		}},
+		{"one trial call at a time", []step{
+			fail, fail, {allowed: true, state: Open},
+			{advance: 10 * time.Second, pending: true, allowed: true, state: HalfOpen},
+			{state: HalfOpen},
+			{advance: time.Minute, state: HalfOpen},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newClock()
+			b := &breaker{threshold: 3, openTimeout: 10 * time.Second}
+			for i, s := range tt.steps {
+				c.advance(s.advance)
+				allowed, trial, _, _ := b.allow(c.now())
+				if allowed != s.allowed {
+					t.Fatalf("step %d: allowed = %v, want %v", i, allowed, s.allowed)
+				}
+				if allowed && !s.pending {
+					b.done(trial, s.ok, c.now())
+				}
+				if got := b.current(); got != s.state {
+					t.Fatalf("step %d: state = %v, want %v", i, got, s.state)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerAbandonedTrial(t *testing.T) {
+	c := newClock()
+	b := &breaker{threshold: 1, openTimeout: time.Second}
+	_, trial, _, _ := b.allow(c.now())
+	b.done(trial, false, c.now())
+
+	c.advance(time.Second)
+	if _, trial, _, _ = b.allow(c.now()); !trial {
+		t.Fatal("first call after the timeout isn't the trial")
+	}
+	b.abandon(trial)
+	if ok, trial, _, _ := b.allow(c.now()); !ok || !trial {
+		t.Errorf("allow after an abandoned trial = %v, %v, want another trial", ok, trial)
+	}
+}
+
+func newTestPolicy(cfg Config) (*Policy, *clock) {
+	c := newClock()
+	p := New(cfg)
+	p.now = c.now
+	return p, c
+}
+
+func TestDo(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []error
+		wantErr error
+		calls   int
+	}{
+		{"first call succeeds", []error{nil}, nil, 1},
+		{"retries until success", []error{errDown, errDown, nil}, nil, 3},
+		{"gives up after MaxAttempts", []error{errDown, errDown, errDown, errDown, nil}, errDown, 4},
+		{"permanent error isn't retried", []error{Permanent(errDown), nil}, errDown, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, _ := newTestPolicy(Config{Name: "test", MaxAttempts: 4, InitialBackoff: time.Millisecond, FailureThreshold: 10})
+			calls := 0
+			err := p.Do(context.Background(), func(context.Context) error {
+				calls++
+				return tt.results[calls-1]
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do = %v, want %v", err, tt.wantErr)
+			}
+			if calls != tt.calls {
+				t.Errorf("op called %d times, want %d", calls, tt.calls)
+			}
+		})
+	}
+}
+
+// TestDoStopsWhenOpen checks that Do stops retrying as soon as its own
+// failures open the breaker, rejects calls without running op while it is
+// open, and lets one through once the timeout has passed.
+func TestDoStopsWhenOpen(t *testing.T) {
+	p, c := newTestPolicy(Config{
+		Name:             "test",
+		MaxAttempts:      5,
+		InitialBackoff:   time.Millisecond,
+		FailureThreshold: 2,
+		OpenTimeout:      10 * time.Second,
+	})
+	sr := tracetest.NewSpanRecorder()
+	p.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	ctx := context.Background()
+	calls := 0
+	failing := func(context.Context) error { calls++; return errDown }
+
+	if err := p.Do(ctx, failing); !errors.Is(err, ErrOpen) {
+		t.Fatalf("Do = %v, want ErrOpen once the breaker opens", err)
+	}
+	if calls != 2 {
+		t.Errorf("op called %d times, want 2: the attempts that opened the breaker", calls)
+	}
+	// The third attempt is rejected, and there is no fourth
+	spans := sr.Ended()
+	attempts := attribute.NewSet(spans[len(spans)-1].Attributes()...)
+	if n, _ := attempts.Value("resilience.attempts"); n.AsInt64() != 3 {
+		t.Errorf("Do made %d attempts, want 3", n.AsInt64())
+	}
+	if p.State() != Open {
+		t.Fatalf("state = %v, want open", p.State())
+	}
+
+	c.advance(9 * time.Second)
+	if err := p.Do(ctx, failing); !errors.Is(err, ErrOpen) || calls != 2 {
+		t.Errorf("Do while open = %v after %d calls, want ErrOpen without calling op", err, calls)
+	}
+
+	c.advance(time.Second)
+	if err := p.Do(ctx, func(context.Context) error { calls++; return nil }); err != nil || calls != 3 {
+		t.Errorf("Do after the timeout = %v after %d calls, want a successful trial", err, calls)
+	}
+	if p.State() != Closed {
+		t.Errorf("state = %v, want closed after the trial succeeded", p.State())
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p := New(Config{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second})
+	tests := []struct {
+		retry   int
+		ceiling time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		// Past the shift width, not negative
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		seen := map[time.Duration]bool{}
+		for i := 0; i < 100; i++ {
+			d := p.backoff(tt.retry)
+			if d <= 0 || d > tt.ceiling {
+				t.Fatalf("backoff(%d) = %v, want in (0, %v]", tt.retry, d, tt.ceiling)
+			}
+			seen[d] = true
+		}
+		if len(seen) < 2 {
+			t.Errorf("backoff(%d) returned the same wait 100 times, want it jittered", tt.retry)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Package routefilter keeps the requests of health checks, readiness probes
+// and metric scrapes out of traces. Probes hit a service every few seconds
+// on every replica, so their spans can outnumber those of real traffic while
+// saying nothing about it.
+//
+// A Filter holds the excluded routes. Instrumentation that takes a request
+// filter, such as otelhttp and otelgin, gets Filter.Request and starts no
+// span for them:
+//
+//	probes := routefilter.FromEnv() // /health, /ready, /metrics
+//	handler := otelhttp.NewHandler(mux, "server", otelhttp.WithFilter(probes.Request))
+//
+// Where the application builds its own TracerProvider, Filter.Sampler drops
+// the server spans of excluded routes for every instrumentation at once:
+//
+//	sdktrace.NewTracerProvider(sdktrace.WithSampler(probes.Sampler(sdktrace.ParentBased(sdktrace.AlwaysSample()))))
+package routefilter
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DefaultRoutes are the routes excluded when none are configured.
+var DefaultRoutes = []string{"/health", "/ready", "/metrics"}
+
+// EnvVar is the variable FromEnv reads: a comma-separated list of routes.
+const EnvVar = "OTEL_TRACES_EXCLUDED_ROUTES"
+
+// pathKeys are the attributes a server span's route or path may be in,
+// by semconv version
+var pathKeys = []attribute.Key{"http.route", "url.path", "http.target"}
+
+// Filter matches requests by their path against a set of excluded routes.
+// Matching is exact, ignoring a trailing slash; the query is not part of the
+// path. A nil *Filter excludes nothing.
+type Filter struct {
+	routes map[string]struct{}
+}
+
+// New returns a Filter excluding routes, or DefaultRoutes if none are given.
+func New(routes ...string) *Filter {
+	if len(routes) == 0 {
+		routes = DefaultRoutes
+	}
+	return newFilter(routes)
+}
+
+// FromEnv returns a Filter excluding the routes in OTEL_TRACES_EXCLUDED_ROUTES,
+// or DefaultRoutes if it is unset. Set it empty to trace every route.
+func FromEnv() *Filter {
+	v, ok := os.LookupEnv(EnvVar)
+	if !ok {
+		return New()
+	}
+	return newFilter(strings.Split(v, ","))
+}
+
+func newFilter(routes []string) *Filter {
+	f := &Filter{routes: make(map[string]struct{}, len(routes))}
+	for _, r := range routes {
+		if r = normalize(strings.TrimSpace(r)); r != "" {
+			f.routes[r] = struct{}{}
+		}
+	}
+	return f
+}
+
+// Routes returns the excluded routes, in no particular order.
+func (f *Filter) Routes() []string {
+	if f == nil {
+		return nil
+	}
+	routes := make([]string, 0, len(f.routes))
+	for r := range f.routes {
+		routes = append(routes, r)
+	}
+	return routes
+}
+
+// Excluded reports whether path is one of the excluded routes.
+func (f *Filter) Excluded(path string) bool {
+	if f == nil || len(f.routes) == 0 {
+		return false
+	}
+	if i := strings.IndexByte(path, '?'); i >= 0 {
+		path = path[:i]
+	}
+	_, ok := f.routes[normalize(path)]
+	return ok
+}
+
+// Request reports whether r should be traced, that is whether its path is
+// not excluded. It has the signature of otelhttp.Filter and otelgin.Filter.
+func (f *Filter) Request(r *http.Request) bool {
+	return !f.Excluded(r.URL.Path)
+}
+
+// Sampler returns a Sampler that drops server spans whose http.route, url.path
+// or http.target start attribute is an excluded route, and leaves every
+// other decision to base. Wrap the provider's whole sampler, parent-based
+// part included, so probes are dropped even if they send a sampled
+// traceparent. Spans started under a dropped span follow it with a
+// parent-based base.
+func (f *Filter) Sampler(base sdktrace.Sampler) sdktrace.Sampler {
+	return sampler{filter: f, base: base}
+}
+
+type sampler struct {
+	filter *Filter
+	base   sdktrace.Sampler
+}
+
+func (s sampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	if p.Kind == trace.SpanKindServer {
+		for _, kv := range p.Attributes {
+			for _, k := range pathKeys {
+				if kv.Key == k && s.filter.Excluded(kv.Value.AsString()) {
+					return sdktrace.SamplingResult{
+						Decision:   sdktrace.Drop,
+						Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+					}
+				}
+			}
+		}
+	}
+	return s.base.ShouldSample(p)
+}
+
+func (s sampler) Description() string {
+	return "RouteFilter{" + s.base.Description() + "}"
+}
+
+// normalize drops a trailing slash, except from the root.
+func normalize(path string) string {
+	if len(path) > 1 {
+		path = strings.TrimSuffix(path, "/")
+	}
+	return path
+}
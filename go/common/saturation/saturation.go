@@ -0,0 +1,280 @@
+// Package saturation records how close an HTTP server is to its capacity,
+// per route: requests in flight, time spent queued for a worker, worker
+// utilization, and how much of each request was spent paused by the garbage
+// collector. It is one middleware, added once around the whole router, and
+// its instruments back a ready-made dashboard, so their names, units and
+// attributes are a contract: see the Name constants.
+//
+//	mux := nethttp.NewServeMux()
+//	// ... register routes ...
+//	handler := saturation.Middleware(saturation.ConfigFromEnv(), saturation.ServeMuxRoute(mux))(mux)
+//
+// The middleware also bounds concurrency. At most Config.Workers requests
+// are served at once; the others wait for a worker for up to
+// Config.QueueTimeout, then get a 503. The wait is the queue time, and busy
+// workers over Config.Workers the utilization. A server without a limit
+// still has one, in CPU, memory or connection pool size; a limit makes it
+// visible before latency does.
+package saturation
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// ScopeName is the instrumentation scope of the saturation metrics.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/saturation"
+
+// The instrument names. Dashboards and alerts query them by name, so they
+// don't change: a rename is a new instrument.
+const (
+	// ActiveRequestsName is an UpDownCounter of the requests being served or
+	// queued, by http.request.method and http.route. Unit {request}.
+	ActiveRequestsName = "http.server.route.active_requests"
+	// QueueDurationName is a histogram of the time each request waited for a
+	// worker, by http.request.method and http.route. Unit s.
+	QueueDurationName = "http.server.request.queue.duration"
+	// QueueRejectedName counts requests that got no worker, by
+	// http.request.method, http.route and saturation.rejected_by. Unit
+	// {request}.
+	QueueRejectedName = "http.server.request.queue.rejected"
+	// WorkerUtilizationName is a gauge of busy workers over Config.Workers,
+	// from 0 to 1. Unit 1.
+	WorkerUtilizationName = "http.server.worker.utilization"
+	// WorkerLimitName is a gauge of Config.Workers. Unit {worker}.
+	WorkerLimitName = "http.server.worker.limit"
+	// GCPauseName is a histogram of the time each request's server spent
+	// stopped for garbage collection while the request was served, by
+	// http.request.method and http.route. Unit s.
+	GCPauseName = "http.server.request.gc_pause.duration"
+)
+
+// RejectedByKey is why a request got no worker: RejectedQueueTimeout or
+// RejectedCanceled.
+const RejectedByKey = attribute.Key("saturation.rejected_by")
+
+const (
+	// RejectedQueueTimeout means no worker was free within
+	// Config.QueueTimeout. The client got a 503.
+	RejectedQueueTimeout = "queue_timeout"
+	// RejectedCanceled means the client went away while the request was
+	// queued.
+	RejectedCanceled = "canceled"
+)
+
+// Defaults for ConfigFromEnv.
+const (
+	DefaultWorkers      = 128
+	DefaultQueueTimeout = time.Second
+)
+
+// Config configures Middleware.
+type Config struct {
+	// Workers is the number of requests served at once. 0 means no limit:
+	// requests are never queued, and the worker gauges aren't reported.
+	Workers int
+	// QueueTimeout is how long a request waits for a worker before it is
+	// answered with 503.
+	QueueTimeout time.Duration
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+// ConfigFromEnv returns a Config with Workers from MAX_CONCURRENT_REQUESTS
+// and QueueTimeout from QUEUE_TIMEOUT, such as QUEUE_TIMEOUT=500ms, or the
+// defaults if they are unset or invalid.
+func ConfigFromEnv() Config {
+	cfg := Config{Workers: DefaultWorkers, QueueTimeout: DefaultQueueTimeout}
+	if n, err := strconv.Atoi(os.Getenv("MAX_CONCURRENT_REQUESTS")); err == nil && n >= 0 {
+		cfg.Workers = n
+	}
+	if d, err := time.ParseDuration(os.Getenv("QUEUE_TIMEOUT")); err == nil && d > 0 {
+		cfg.QueueTimeout = d
+	}
+	return cfg
+}
+
+// ServeMuxRoute returns a route function for Middleware that looks the
+// request up in mux, an http.ServeMux or anything with its Handler method.
+// The pattern's method and host are dropped, so "GET /users/{id}" gives
+// http.route /users/{id}.
+func ServeMuxRoute(mux interface {
+	Handler(*http.Request) (http.Handler, string)
+}) func(*http.Request) string {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		if i := strings.IndexByte(pattern, '/'); i >= 0 {
+			return pattern[i:]
+		}
+		return ""
+	}
+}
+
+type instruments struct {
+	active   metric.Int64UpDownCounter
+	queue    metric.Float64Histogram
+	rejected metric.Int64Counter
+	gcPause  metric.Float64Histogram
+}
+
+// Middleware returns middleware that records the saturation metrics, and
+// limits concurrency to cfg.Workers. route returns the route a request will
+// match, before the router has run, or "" for none; requests without a route
+// are recorded without http.route, so paths probed by scanners don't each
+// make a series.
+//
+// Add it outermost, around the router and its instrumentation: the queue
+// time is then left out of the server spans and http.server.request.duration,
+// which measure the handler only.
+func Middleware(cfg Config, route func(*http.Request) string) func(http.Handler) http.Handler {
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	meter := cfg.MeterProvider.Meter(ScopeName)
+	var inst instruments
+	var err error
+	if inst.active, err = meter.Int64UpDownCounter(ActiveRequestsName,
+		metric.WithDescription("Requests being served or queued for a worker"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	if inst.queue, err = meter.Float64Histogram(QueueDurationName,
+		metric.WithDescription("Time requests waited for a worker"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	if inst.rejected, err = meter.Int64Counter(QueueRejectedName,
+		metric.WithDescription("Requests that got no worker"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	if inst.gcPause, err = meter.Float64Histogram(GCPauseName,
+		metric.WithDescription("Time the server was stopped for garbage collection while a request was served"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+
+	var workers chan struct{}
+	if cfg.Workers > 0 {
+		workers = make(chan struct{}, cfg.Workers)
+		registerWorkerGauges(meter, workers)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			attrs := []attribute.KeyValue{semconv.HTTPRequestMethodKey.String(r.Method)}
+			if route != nil {
+				if rt := route(r); rt != "" {
+					attrs = append(attrs, semconv.HTTPRoute(rt))
+				}
+			}
+			set := metric.WithAttributeSet(attribute.NewSet(attrs...))
+
+			if inst.active != nil {
+				inst.active.Add(ctx, 1, set)
+				defer inst.active.Add(ctx, -1, set)
+			}
+
+			if workers != nil {
+				waited, rejectedBy := acquire(ctx, workers, cfg.QueueTimeout)
+				if inst.queue != nil {
+					inst.queue.Record(ctx, waited.Seconds(), set)
+				}
+				if rejectedBy != "" {
+					if inst.rejected != nil {
+						inst.rejected.Add(ctx, 1, metric.WithAttributes(append(attrs, RejectedByKey.String(rejectedBy))...))
+					}
+					if rejectedBy == RejectedQueueTimeout {
+						w.Header().Set("Content-Type", "application/json")
+						w.Header().Set("Retry-After", "1")
+						w.WriteHeader(http.StatusServiceUnavailable)
+						_, _ = w.Write([]byte(`{"error":"server busy"}` + "\n"))
+					}
+					return
+				}
+				defer func() { <-workers }()
+			}
+
+			pauseBefore := gcPauseTime()
+			next.ServeHTTP(w, r)
+			if inst.gcPause != nil {
+				inst.gcPause.Record(ctx, gcPauseTime()-pauseBefore, set)
+			}
+		})
+	}
+}
+
+// acquire takes a worker from workers, waiting at most timeout. It returns
+// how long it waited, and why it got none, or "" if it got one.
+func acquire(ctx context.Context, workers chan struct{}, timeout time.Duration) (time.Duration, string) {
+	// Most requests get a worker right away; skip the timer for them
+	select {
+	case workers <- struct{}{}:
+		return 0, ""
+	default:
+	}
+	start := time.Now()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case workers <- struct{}{}:
+		return time.Since(start), ""
+	case <-timer.C:
+		return time.Since(start), RejectedQueueTimeout
+	case <-ctx.Done():
+		return time.Since(start), RejectedCanceled
+	}
+}
+
+func registerWorkerGauges(meter metric.Meter, workers chan struct{}) {
+	utilization, err := meter.Float64ObservableGauge(WorkerUtilizationName,
+		metric.WithDescription("Busy workers over the worker limit"),
+		metric.WithUnit("1"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	limit, err := meter.Int64ObservableGauge(WorkerLimitName,
+		metric.WithDescription("Requests served at once before new ones are queued"),
+		metric.WithUnit("{worker}"))
+	if err != nil {
+		otel.Handle(err)
+		return
+	}
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		o.ObserveFloat64(utilization, float64(len(workers))/float64(cap(workers)))
+		o.ObserveInt64(limit, int64(cap(workers)))
+		return nil
+	}, utilization, limit)
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// gcPauseMetric is the CPU time the process spent stopped by the garbage
+// collector: its pause time multiplied by GOMAXPROCS, since every P is
+// stopped. It is updated at the end of each pause.
+const gcPauseMetric = "/cpu/classes/gc/pause:cpu-seconds"
+
+// gcPauseTime returns the wall time the process has been stopped for
+// garbage collection since it started, in seconds.
+func gcPauseTime() float64 {
+	sample := [1]metrics.Sample{{Name: gcPauseMetric}}
+	metrics.Read(sample[:])
+	if sample[0].Value.Kind() != metrics.KindFloat64 {
+		return 0
+	}
+	return sample[0].Value.Float64() / float64(runtime.GOMAXPROCS(0))
+}
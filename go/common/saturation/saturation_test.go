@@ -0,0 +1,144 @@
+package saturation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// TestInstrumentContract pins the names, units and attribute keys of the
+// instruments the saturation dashboard queries. A change that fails it
+// breaks the dashboard: add a new instrument instead.
+func TestInstrumentContract(t *testing.T) {
+	want := map[string]struct {
+		unit string
+		keys []string
+	}{
+		"http.server.route.active_requests":     {"{request}", []string{"http.request.method", "http.route"}},
+		"http.server.request.queue.duration":    {"s", []string{"http.request.method", "http.route"}},
+		"http.server.request.queue.rejected":    {"{request}", []string{"http.request.method", "http.route", "saturation.rejected_by"}},
+		"http.server.worker.utilization":        {"1", nil},
+		"http.server.worker.limit":              {"{worker}", nil},
+		"http.server.request.gc_pause.duration": {"s", []string{"http.request.method", "http.route"}},
+	}
+
+	reader := sdkmetric.NewManualReader()
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+
+	// One worker, held by a slow request, so a second request times out in
+	// the queue and every instrument records
+	release := make(chan struct{})
+	started := make(chan struct{})
+	handler := Middleware(Config{Workers: 1, QueueTimeout: 10 * time.Millisecond, MeterProvider: mp},
+		func(*http.Request) string { return "/users/{id}" },
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/users/slow" {
+			close(started)
+			<-release
+		}
+	}))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users/slow", nil))
+	}()
+	<-started
+	rejected := httptest.NewRecorder()
+	handler.ServeHTTP(rejected, httptest.NewRequest(http.MethodGet, "/users/1", nil))
+	close(release)
+	<-done
+	if rejected.Code != http.StatusServiceUnavailable {
+		t.Fatalf("queued request got %d, want %d", rejected.Code, http.StatusServiceUnavailable)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]metricdata.Metrics{}
+	for _, sm := range rm.ScopeMetrics {
+		if sm.Scope.Name != ScopeName {
+			t.Errorf("scope %q, want %q", sm.Scope.Name, ScopeName)
+		}
+		for _, m := range sm.Metrics {
+			got[m.Name] = m
+		}
+	}
+
+	for name, w := range want {
+		m, ok := got[name]
+		if !ok {
+			t.Errorf("no instrument %s", name)
+			continue
+		}
+		if m.Unit != w.unit {
+			t.Errorf("%s has unit %q, want %q", name, m.Unit, w.unit)
+		}
+		for _, keys := range attributeKeys(t, m) {
+			if !equal(keys, w.keys) {
+				t.Errorf("%s has attributes %v, want %v", name, keys, w.keys)
+			}
+		}
+	}
+	for name := range got {
+		if _, ok := want[name]; !ok {
+			t.Errorf("instrument %s isn't in the contract; add it to the test and the dashboard", name)
+		}
+	}
+}
+
+// attributeKeys returns the sorted attribute keys of each data point of m.
+func attributeKeys(t *testing.T, m metricdata.Metrics) [][]string {
+	var sets []attribute.Set
+	switch data := m.Data.(type) {
+	case metricdata.Sum[int64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Gauge[int64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Gauge[float64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	case metricdata.Histogram[float64]:
+		for _, dp := range data.DataPoints {
+			sets = append(sets, dp.Attributes)
+		}
+	default:
+		t.Fatalf("%s has unexpected data %T", m.Name, m.Data)
+	}
+	if len(sets) == 0 {
+		t.Errorf("%s has no data points", m.Name)
+	}
+	keys := make([][]string, len(sets))
+	for i, set := range sets {
+		for _, kv := range set.ToSlice() {
+			keys[i] = append(keys[i], string(kv.Key))
+		}
+		sort.Strings(keys[i])
+	}
+	return keys
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
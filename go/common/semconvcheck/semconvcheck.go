@@ -0,0 +1,284 @@
+// Package semconvcheck reports span attributes that don't match the semantic
+// conventions version the span declares, to guide a semconv migration.
+//
+// During a migration, spans from different instrumentations follow different
+// versions of the conventions: one sets http.method, the next
+// http.request.method. Dashboards and alerts written for one miss the other.
+// The SpanProcessor checks every ended span against the version in its
+// instrumentation scope's schema URL, or Config.Target if the scope declares
+// none, and reports two kinds of mismatch:
+//
+//   - deprecated: a key the declared version has renamed, such as
+//     http.method on a span declaring 1.26.0.
+//   - newer: a key from a later version than the declared one, such as
+//     http.request.method on a span declaring 1.20.0.
+//
+// Each mismatch is counted by semconv.attribute.mismatches, and passed to
+// Config.OnMismatch the first time it's seen for a scope.
+//
+//	semconvcheck.Register(otel.GetTracerProvider(), semconvcheck.Config{
+//		Target: "1.26.0",
+//		OnMismatch: func(m semconvcheck.Mismatch) { log.Print(m) },
+//	})
+package semconvcheck
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the mismatch counter.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/semconvcheck"
+
+// Kinds of Mismatch.
+const (
+	Deprecated = "deprecated"
+	Newer      = "newer"
+)
+
+// rename is an attribute key replaced in version Since.
+type rename struct {
+	Old, New string
+	Since    version
+}
+
+// renames lists the renames most instrumentations are caught between. Since
+// is the first go.opentelemetry.io/otel/semconv package with the new key.
+var renames = []rename{
+	{"http.method", "http.request.method", version{1, 21, 0}},
+	{"http.status_code", "http.response.status_code", version{1, 21, 0}},
+	{"http.url", "url.full", version{1, 21, 0}},
+	{"http.target", "url.path", version{1, 21, 0}},
+	{"http.scheme", "url.scheme", version{1, 21, 0}},
+	{"http.flavor", "network.protocol.version", version{1, 21, 0}},
+	{"http.client_ip", "client.address", version{1, 21, 0}},
+	{"http.request_content_length", "http.request.body.size", version{1, 21, 0}},
+	{"http.response_content_length", "http.response.body.size", version{1, 21, 0}},
+	{"http.user_agent", "user_agent.original", version{1, 19, 0}},
+	{"net.host.name", "server.address", version{1, 21, 0}},
+	{"net.host.port", "server.port", version{1, 21, 0}},
+	// On client spans; a server span's net.peer.name became client.address
+	{"net.peer.name", "server.address", version{1, 21, 0}},
+	{"net.sock.peer.addr", "network.peer.address", version{1, 22, 0}},
+	{"net.sock.peer.port", "network.peer.port", version{1, 22, 0}},
+	{"db.statement", "db.query.text", version{1, 26, 0}},
+	{"db.operation", "db.operation.name", version{1, 26, 0}},
+	{"db.sql.table", "db.collection.name", version{1, 26, 0}},
+	{"db.name", "db.namespace", version{1, 26, 0}},
+	{"db.system", "db.system.name", version{1, 30, 0}},
+	{"messaging.operation", "messaging.operation.type", version{1, 26, 0}},
+	{"code.function", "code.function.name", version{1, 30, 0}},
+	{"code.filepath", "code.file.path", version{1, 30, 0}},
+	{"code.lineno", "code.line.number", version{1, 30, 0}},
+}
+
+var byOld, byNew = func() (map[string]rename, map[string]rename) {
+	old, nw := make(map[string]rename), make(map[string]rename)
+	for _, r := range renames {
+		old[r.Old] = r
+		// server.address replaces two keys; either rename dates it
+		if _, ok := nw[r.New]; !ok {
+			nw[r.New] = r
+		}
+	}
+	return old, nw
+}()
+
+// Mismatch is an attribute key that doesn't match the version its span
+// declares.
+type Mismatch struct {
+	// Scope is the instrumentation scope of the span, such as
+	// go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin.
+	Scope string
+	// Declared is the semconv version the span was checked against, and
+	// FromSchemaURL whether it came from the scope's schema URL rather than
+	// Config.Target.
+	Declared      string
+	FromSchemaURL bool
+	// Kind is Deprecated or Newer.
+	Kind string
+	// Key is the attribute key the span set, and Expected the key the
+	// declared version uses instead.
+	Key, Expected string
+	// Since is the version that renamed Expected to Key or Key to Expected.
+	Since string
+}
+
+func (m Mismatch) String() string {
+	declared := m.Declared + " (Target)"
+	if m.FromSchemaURL {
+		declared = m.Declared + " (schema URL)"
+	}
+	if m.Kind == Deprecated {
+		return fmt.Sprintf("semconv: %s declares %s but sets %s, renamed to %s in %s",
+			m.Scope, declared, m.Key, m.Expected, m.Since)
+	}
+	return fmt.Sprintf("semconv: %s declares %s but sets %s, which replaced %s only in %s",
+		m.Scope, declared, m.Key, m.Expected, m.Since)
+}
+
+// Config configures the SpanProcessor.
+type Config struct {
+	// Target is the version spans are checked against when their scope
+	// declares no schema URL, such as "1.26.0". Leave it empty to check only
+	// scopes that declare one.
+	Target string
+	// OnMismatch, if set, is called the first time each mismatch is seen for
+	// a scope, such as to log it. It must not block.
+	OnMismatch func(Mismatch)
+}
+
+// SpanProcessor checks the attribute keys of ended spans.
+type SpanProcessor struct {
+	target     version
+	onMismatch func(Mismatch)
+	counter    metric.Int64Counter
+	seen       sync.Map // Mismatch -> struct{}
+}
+
+var _ sdktrace.SpanProcessor = (*SpanProcessor)(nil)
+
+// New returns a SpanProcessor. The mismatch counter is created with the
+// global MeterProvider, so call New after it has been set up.
+func New(cfg Config) (*SpanProcessor, error) {
+	p := &SpanProcessor{onMismatch: cfg.OnMismatch}
+	if cfg.Target != "" {
+		v, ok := parseVersion(cfg.Target)
+		if !ok {
+			return nil, fmt.Errorf("semconvcheck: invalid target version %q", cfg.Target)
+		}
+		p.target = v
+	}
+	counter, err := otel.Meter(ScopeName).Int64Counter("semconv.attribute.mismatches",
+		metric.WithDescription("Span attributes that don't match the semantic conventions version the span declares"),
+		metric.WithUnit("{attribute}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	p.counter = counter
+	return p, nil
+}
+
+// OnStart does nothing; the attributes are checked once the span has ended.
+func (*SpanProcessor) OnStart(context.Context, sdktrace.ReadWriteSpan) {}
+
+// OnEnd checks the span's attribute keys against its declared version.
+func (p *SpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	scope := s.InstrumentationScope()
+	declared, fromURL := p.target, false
+	if v, ok := versionFromSchemaURL(scope.SchemaURL); ok {
+		declared, fromURL = v, true
+	}
+	if declared.isZero() {
+		return
+	}
+
+	for _, kv := range s.Attributes() {
+		key := string(kv.Key)
+		var m Mismatch
+		if r, ok := byOld[key]; ok && !declared.less(r.Since) {
+			m = Mismatch{Kind: Deprecated, Key: key, Expected: r.New, Since: r.Since.String()}
+		} else if r, ok := byNew[key]; ok && declared.less(r.Since) {
+			m = Mismatch{Kind: Newer, Key: key, Expected: r.Old, Since: r.Since.String()}
+		} else {
+			continue
+		}
+		m.Scope, m.Declared, m.FromSchemaURL = scope.Name, declared.String(), fromURL
+		p.report(m)
+	}
+}
+
+func (p *SpanProcessor) report(m Mismatch) {
+	if p.counter != nil {
+		p.counter.Add(context.Background(), 1, metric.WithAttributes(
+			attribute.String("otel.scope.name", m.Scope),
+			attribute.String("semconv.mismatch.kind", m.Kind),
+			attribute.String("semconv.attribute.key", m.Key),
+			attribute.String("semconv.schema.version", m.Declared),
+		))
+	}
+	if p.onMismatch == nil {
+		return
+	}
+	if _, loaded := p.seen.LoadOrStore(m, struct{}{}); !loaded {
+		p.onMismatch(m)
+	}
+}
+
+// Shutdown does nothing.
+func (*SpanProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (*SpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// Register adds a SpanProcessor configured by cfg to tp. tp is usually
+// otel.GetTracerProvider() after the provider has been set up, for example
+// after agent.Start(). It must be an SDK TracerProvider.
+func Register(tp trace.TracerProvider, cfg Config) error {
+	sdkTP, ok := tp.(*sdktrace.TracerProvider)
+	if !ok {
+		return errors.New("semconvcheck: tracer provider is not an SDK TracerProvider")
+	}
+	p, err := New(cfg)
+	if err != nil {
+		return err
+	}
+	sdkTP.RegisterSpanProcessor(p)
+	return nil
+}
+
+// version is a semconv version, such as 1.26.0.
+type version struct{ major, minor, patch int }
+
+func (v version) isZero() bool { return v == version{} }
+
+func (v version) less(o version) bool {
+	if v.major != o.major {
+		return v.major < o.major
+	}
+	if v.minor != o.minor {
+		return v.minor < o.minor
+	}
+	return v.patch < o.patch
+}
+
+func (v version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.major, v.minor, v.patch)
+}
+
+// versionFromSchemaURL returns the version of a schema URL such as
+// https://opentelemetry.io/schemas/1.26.0.
+func versionFromSchemaURL(url string) (version, bool) {
+	i := strings.LastIndexByte(url, '/')
+	if i < 0 {
+		return version{}, false
+	}
+	return parseVersion(url[i+1:])
+}
+
+func parseVersion(s string) (version, bool) {
+	parts := strings.Split(s, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return version{}, false
+	}
+	var n [3]int
+	for i, p := range parts {
+		v, err := strconv.Atoi(p)
+		if err != nil || v < 0 {
+			return version{}, false
+		}
+		n[i] = v
+	}
+	return version{n[0], n[1], n[2]}, true
+}
@@ -0,0 +1,125 @@
+// Package spanname names HTTP server spans by a strategy chosen with the
+// HTTP_SPAN_NAME_STRATEGY environment variable, so the custom middlewares of
+// the examples name spans the same way and can be switched together.
+//
+// The default, method_route, gives names such as "GET /users/:id": one name
+// per endpoint, as the OpenTelemetry HTTP conventions recommend. Span names
+// are grouped on, so a name with an ID or other request data in it gives
+// every request its own group, and dashboards and alerts built on names stop
+// working. The target strategy does that, and is meant for debugging only.
+//
+// Changing the strategy renames spans, which breaks alerts and dashboards
+// that filter on the old names. During a migration the name a middleware
+// used before is kept as the http.span_name.legacy attribute, so they can be
+// moved over to the new names first:
+//
+//	namer := spanname.FromEnv()
+//	name, attrs := namer.Name(spanname.Request{
+//	    Method: r.Method,
+//	    Route:  route,
+//	    Target: r.URL.Path,
+//	    Legacy: r.Method + " " + r.URL.Path,
+//	})
+//	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+package spanname
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// EnvStrategy selects the Strategy.
+const EnvStrategy = "HTTP_SPAN_NAME_STRATEGY"
+
+// EnvLegacy turns the legacy name attribute off when set to false.
+const EnvLegacy = "HTTP_SPAN_NAME_LEGACY"
+
+// LegacyKey is the attribute holding the name a middleware used before it
+// named spans by strategy.
+const LegacyKey = attribute.Key("http.span_name.legacy")
+
+// Strategy is how a server span is named.
+type Strategy string
+
+const (
+	// MethodRoute names spans "{method} {route}", such as "GET /users/:id".
+	// It is the default.
+	MethodRoute Strategy = "method_route"
+	// Route names spans by route alone, such as "/users/:id", for backends
+	// that already group by http.request.method.
+	Route Strategy = "route"
+	// Target names spans "{method} {path}", such as "GET /users/42". It has
+	// one name per resource, so use it only to debug locally.
+	Target Strategy = "target"
+)
+
+// Parse returns the Strategy called s. An empty s is MethodRoute.
+func Parse(s string) (Strategy, error) {
+	switch st := Strategy(strings.ToLower(strings.TrimSpace(s))); st {
+	case "":
+		return MethodRoute, nil
+	case MethodRoute, Route, Target:
+		return st, nil
+	default:
+		return "", fmt.Errorf("unknown span name strategy %q; use %s, %s or %s", s, MethodRoute, Route, Target)
+	}
+}
+
+// Namer names server spans by its Strategy.
+type Namer struct {
+	Strategy Strategy
+	// Legacy adds the LegacyKey attribute to spans whose name changed.
+	Legacy bool
+}
+
+// FromEnv returns the Namer set by HTTP_SPAN_NAME_STRATEGY and
+// HTTP_SPAN_NAME_LEGACY. An unknown strategy is reported to the OpenTelemetry
+// error handler and falls back to MethodRoute, so a typo can't turn on
+// high-cardinality names.
+func FromEnv() Namer {
+	st, err := Parse(os.Getenv(EnvStrategy))
+	if err != nil {
+		otel.Handle(err)
+		st = MethodRoute
+	}
+	return Namer{Strategy: st, Legacy: os.Getenv(EnvLegacy) != "false"}
+}
+
+// Request is what a span is named from.
+type Request struct {
+	Method string
+	// Route is the matched route template, such as /users/:id. It is empty
+	// when no route matched.
+	Route string
+	// Target is the request path.
+	Target string
+	// Legacy is the name the middleware used before it named spans by
+	// strategy. Leave it empty if there was none.
+	Legacy string
+}
+
+// Name returns the span name for r, and the attributes to start the span
+// with. Without a route, MethodRoute and Route name the span by method
+// alone, as the path could hold IDs.
+func (n Namer) Name(r Request) (string, []attribute.KeyValue) {
+	var name string
+	switch {
+	case n.Strategy == Target:
+		name = r.Method + " " + r.Target
+	case r.Route == "":
+		name = r.Method
+	case n.Strategy == Route:
+		name = r.Route
+	default:
+		name = r.Method + " " + r.Route
+	}
+
+	if n.Legacy && r.Legacy != "" && r.Legacy != name {
+		return name, []attribute.KeyValue{LegacyKey.String(r.Legacy)}
+	}
+	return name, nil
+}
@@ -0,0 +1,163 @@
+// Package testrun marks the traffic of integration test runs, so it can be
+// told apart from real traffic in a shared environment.
+//
+// A test run gets a unique ID that travels as W3C baggage on every request
+// the tests send. Wrap the tests' HTTP client transport with NewTransport:
+//
+//	runID := testrun.NewRunID()
+//	client := &http.Client{Transport: testrun.NewTransport(otelhttp.NewTransport(http.DefaultTransport), runID)}
+//
+// and register the SpanProcessor in the services under test:
+//
+//	agent.Start()
+//	testrun.Register(otel.GetTracerProvider())
+//
+// Every span started for a test request then carries test.run_id, the
+// test.case.name of the test that sent it when known, and
+// user_agent.synthetic.type=test. Filtering on user_agent.synthetic.type
+// hides all test traffic; filtering on test.run_id shows a single run.
+package testrun
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// RunIDKey is the baggage member and span attribute holding the run ID.
+	RunIDKey = "test.run_id"
+	// CaseKey is the baggage member and span attribute holding the name of
+	// the test that sent the request.
+	CaseKey = "test.case.name"
+)
+
+// maxValueLen caps copied values so a client can't inflate every span.
+const maxValueLen = 128
+
+// NewRunID returns a run ID that sorts by start time, such as
+// 20261018-150405-3f9a2c1e.
+func NewRunID() string {
+	b := make([]byte, 4)
+	rand.Read(b)
+	return time.Now().UTC().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
+
+// ContextWithRun returns a copy of ctx whose baggage carries runID.
+func ContextWithRun(ctx context.Context, runID string) context.Context {
+	return withMember(ctx, RunIDKey, runID)
+}
+
+// ContextWithCase returns a copy of ctx whose baggage carries the name of
+// the current test, so the services' spans can be traced back to it.
+func ContextWithCase(ctx context.Context, name string) context.Context {
+	return withMember(ctx, CaseKey, name)
+}
+
+// RunID returns the run ID in ctx's baggage, or "" outside a test run.
+func RunID(ctx context.Context) string {
+	return baggage.FromContext(ctx).Member(RunIDKey).Value()
+}
+
+func withMember(ctx context.Context, key, value string) context.Context {
+	// NewMemberRaw percent-encodes the value, so test names may have spaces
+	member, err := baggage.NewMemberRaw(key, value)
+	if err != nil {
+		return ctx
+	}
+	bag, err := baggage.FromContext(ctx).SetMember(member)
+	if err != nil {
+		return ctx
+	}
+	return baggage.ContextWithBaggage(ctx, bag)
+}
+
+// Transport adds the run ID to the baggage of every request it sends.
+type Transport struct {
+	base  http.RoundTripper
+	runID string
+}
+
+// NewTransport returns a Transport that sends requests with base. When base
+// is an otelhttp transport, the run ID is also in the context of its client
+// span, so the span is tagged too.
+func NewTransport(base http.RoundTripper, runID string) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{base: base, runID: runID}
+}
+
+// RoundTrip adds the run ID to the request's baggage, and writes the baggage
+// header in case base does not propagate it.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if RunID(ctx) == "" {
+		ctx = ContextWithRun(ctx, t.runID)
+	}
+	req = req.Clone(ctx)
+	propagation.Baggage{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	return t.base.RoundTrip(req)
+}
+
+// SpanProcessor tags the spans of test requests. A span is a test span when
+// its parent context's baggage carries a run ID.
+type SpanProcessor struct{}
+
+var _ sdktrace.SpanProcessor = SpanProcessor{}
+
+// OnStart sets test.run_id, test.case.name and user_agent.synthetic.type on
+// spans started within a test run.
+func (SpanProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	bag := baggage.FromContext(parent)
+	runID := bag.Member(RunIDKey).Value()
+	if runID == "" {
+		return
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String(RunIDKey, truncate(runID)),
+		semconv.UserAgentSyntheticTypeTest,
+	}
+	if name := bag.Member(CaseKey).Value(); name != "" {
+		attrs = append(attrs, attribute.String(CaseKey, truncate(name)))
+	}
+	s.SetAttributes(attrs...)
+}
+
+// OnEnd does nothing; attributes can't be changed once a span has ended.
+func (SpanProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+// Shutdown does nothing.
+func (SpanProcessor) Shutdown(context.Context) error { return nil }
+
+// ForceFlush does nothing.
+func (SpanProcessor) ForceFlush(context.Context) error { return nil }
+
+// Register adds a SpanProcessor to tp. tp is usually otel.GetTracerProvider()
+// after the provider has been set up, for example after agent.Start(). It
+// must be an SDK TracerProvider.
+func Register(tp trace.TracerProvider) error {
+	sdkTP, ok := tp.(*sdktrace.TracerProvider)
+	if !ok {
+		return errors.New("testrun: tracer provider is not an SDK TracerProvider")
+	}
+	sdkTP.RegisterSpanProcessor(SpanProcessor{})
+	return nil
+}
+
+func truncate(v string) string {
+	if len(v) > maxValueLen {
+		return v[:maxValueLen]
+	}
+	return v
+}
@@ -0,0 +1,121 @@
+package traceexport
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// rotatingFile is an append-only file that is moved aside to path.1 once a
+// write would take it past maxBytes. Older files move up to path.<backups>;
+// the oldest is removed.
+type rotatingFile struct {
+	path     string
+	maxBytes int64
+	backups  int
+
+	mu   sync.Mutex
+	f    *os.File
+	size int64
+}
+
+func openRotatingFile(path string, maxBytes int64, backups int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxBytes: maxBytes, backups: backups}
+	if err := r.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open(flag int) error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|flag, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write writes p to the current file. A p larger than maxBytes still goes
+// into one file, on its own.
+//
+// If rotating fails, p is still written, past maxBytes, to the file at path,
+// and the rotation error is returned; the next Write tries to rotate again.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return 0, os.ErrClosed
+	}
+	var rotateErr error
+	if r.size > 0 && r.size+int64(len(p)) > r.maxBytes {
+		rotateErr = r.rotate()
+		if r.f == nil {
+			return 0, rotateErr
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	if err == nil {
+		err = rotateErr
+	}
+	return n, err
+}
+
+// rotate moves the current file aside and opens a new one. If closing or
+// moving fails, it reopens the file at path for appending, so that one
+// failed rotation doesn't fail every later Write; r.f is nil only if that
+// fails too.
+func (r *rotatingFile) rotate() error {
+	err := r.f.Close()
+	r.f = nil
+	if err == nil {
+		err = r.shift()
+	}
+	if err != nil {
+		if openErr := r.open(os.O_APPEND); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	return r.open(os.O_TRUNC)
+}
+
+// shift moves path to path.1, path.1 to path.2 and so on, dropping the
+// oldest backup. With no backups, path is removed.
+func (r *rotatingFile) shift() error {
+	if r.backups == 0 {
+		if err := os.Remove(r.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	for i := r.backups - 1; i >= 1; i-- {
+		src := fmt.Sprintf("%s.%d", r.path, i)
+		if err := os.Rename(src, fmt.Sprintf("%s.%d", r.path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := os.Rename(r.path, r.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Close closes the current file. Writes after Close fail.
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,99 @@
+package traceexport
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func write(t *testing.T, r *rotatingFile, s string) error {
+	t.Helper()
+	n, err := r.Write([]byte(s))
+	if n != len(s) {
+		t.Fatalf("Write(%q) wrote %d bytes: %v", s, n, err)
+	}
+	return err
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	r, err := openRotatingFile(path, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	for _, s := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		if err := write(t, r, s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, want := range map[string]string{
+		path:        "dddddd\n",
+		path + ".1": "cccccc\n",
+		path + ".2": "bbbbbb\n",
+	} {
+		if got := readFile(t, name); got != want {
+			t.Errorf("%s has %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want the oldest backup dropped", filepath.Base(path))
+	}
+}
+
+// TestRotatingFileRenameFails checks that a rotation that can't move the
+// backups keeps writing to the current file, and rotates once it can.
+func TestRotatingFileRenameFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.jsonl")
+	r, err := openRotatingFile(path, 8, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	// path.1 can't be moved onto a directory that isn't empty
+	if err := os.WriteFile(path+".1", []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	blocker := path + ".2"
+	if err := os.MkdirAll(filepath.Join(blocker, "x"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := write(t, r, "aaaaaa\n"); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"bbbbbb\n", "cccccc\n"} {
+		err := write(t, r, s)
+		if err == nil || errors.Is(err, os.ErrClosed) {
+			t.Fatalf("Write(%q) = %v, want the rename error", s, err)
+		}
+	}
+	if got, want := readFile(t, path), "aaaaaa\nbbbbbb\ncccccc\n"; got != want {
+		t.Fatalf("%s has %q, want every write in it: %q", filepath.Base(path), got, want)
+	}
+
+	if err := os.RemoveAll(blocker); err != nil {
+		t.Fatal(err)
+	}
+	if err := write(t, r, "dddddd\n"); err != nil {
+		t.Fatalf("Write after the blocker is gone: %v", err)
+	}
+	if got := readFile(t, path); got != "dddddd\n" {
+		t.Errorf("%s has %q after rotating, want %q", filepath.Base(path), got, "dddddd\n")
+	}
+	if got := readFile(t, path+".1"); got != "aaaaaa\nbbbbbb\ncccccc\n" {
+		t.Errorf("%s.1 has %q", filepath.Base(path), got)
+	}
+}
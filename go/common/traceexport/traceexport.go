@@ -0,0 +1,194 @@
+// Package traceexport sends spans to more than one exporter at once, so what
+// an example exports can be read on the console or in a file while it is
+// still pushed over OTLP, without running a collector:
+//
+//	OTEL_TRACE_EXPORTERS=otlp,stdout,file go run .
+//
+// Each exporter gets its own BatchSpanProcessor on the TracerProvider, so a
+// slow or failing one doesn't hold the others back.
+//
+//	agent.Start()
+//	shutdown, err := traceexport.Register(otel.GetTracerProvider(), traceexport.ConfigFromEnv())
+//	defer shutdown(context.Background())
+//
+// "otlp" is the exporter the provider was built with, such as go-agent's;
+// Register only adds the others.
+package traceexport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The exporter names in OTEL_TRACE_EXPORTERS.
+const (
+	// OTLP is the provider's own OTLP exporter.
+	OTLP = "otlp"
+	// Stdout prints each span as indented JSON.
+	Stdout = "stdout"
+	// File appends each span as a line of JSON to Config.File, rotated at
+	// Config.FileMaxBytes.
+	File = "file"
+)
+
+// Defaults of the file exporter.
+const (
+	DefaultFile         = "traces.jsonl"
+	DefaultFileMaxBytes = 10 << 20
+	DefaultFileBackups  = 3
+)
+
+// Config configures Register.
+type Config struct {
+	// Exporters are the names of the exporters spans go to.
+	Exporters []string
+	// Stdout is where the stdout exporter writes, os.Stdout by default.
+	Stdout io.Writer
+	// File is the path the file exporter writes to, DefaultFile by default.
+	File string
+	// FileMaxBytes is the size at which File is rotated,
+	// DefaultFileMaxBytes by default.
+	FileMaxBytes int64
+	// FileBackups is the number of rotated files kept, as File.1 (the
+	// newest) to File.<FileBackups>. 0 keeps DefaultFileBackups; below 0
+	// keeps none.
+	FileBackups int
+}
+
+// ConfigFromEnv returns the Config set by OTEL_TRACE_EXPORTERS, a
+// comma-separated list of exporter names, "otlp" if unset, and for the file
+// exporter OTEL_TRACE_FILE, OTEL_TRACE_FILE_MAX_BYTES and
+// OTEL_TRACE_FILE_BACKUPS, where 0 keeps no rotated files.
+func ConfigFromEnv() Config {
+	cfg := Config{Exporters: []string{OTLP}, File: os.Getenv("OTEL_TRACE_FILE")}
+	if v := os.Getenv("OTEL_TRACE_EXPORTERS"); v != "" {
+		cfg.Exporters = nil
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				cfg.Exporters = append(cfg.Exporters, name)
+			}
+		}
+	}
+	if n, err := strconv.ParseInt(os.Getenv("OTEL_TRACE_FILE_MAX_BYTES"), 10, 64); err == nil && n > 0 {
+		cfg.FileMaxBytes = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("OTEL_TRACE_FILE_BACKUPS")); err == nil {
+		cfg.FileBackups = n
+		if n == 0 {
+			cfg.FileBackups = -1
+		}
+	}
+	return cfg
+}
+
+// Has reports whether the exporter name is in cfg.Exporters.
+func (cfg Config) Has(name string) bool {
+	for _, n := range cfg.Exporters {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Register adds a BatchSpanProcessor for each exporter in cfg other than
+// OTLP to tp. tp is usually otel.GetTracerProvider() after the provider has
+// been set up, for example after agent.Start(). It must be an SDK
+// TracerProvider. An unknown exporter name is an error, and nothing is
+// registered.
+//
+// The returned function flushes and shuts down the added processors and
+// closes the file. Shutting down tp also shuts the processors down, but
+// leaves the file open.
+func Register(tp trace.TracerProvider, cfg Config) (func(context.Context) error, error) {
+	sdkTP, ok := tp.(*sdktrace.TracerProvider)
+	if !ok {
+		return nil, errors.New("traceexport: tracer provider is not an SDK TracerProvider")
+	}
+
+	var exporters []sdktrace.SpanExporter
+	var file *rotatingFile
+	seen := make(map[string]bool)
+	for _, name := range cfg.Exporters {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		switch name {
+		case OTLP:
+			// Already on the provider
+		case Stdout:
+			w := cfg.Stdout
+			if w == nil {
+				w = os.Stdout
+			}
+			exp, err := stdouttrace.New(stdouttrace.WithWriter(w), stdouttrace.WithPrettyPrint())
+			if err != nil {
+				return nil, fmt.Errorf("traceexport: stdout exporter: %w", err)
+			}
+			exporters = append(exporters, exp)
+		case File:
+			var err error
+			file, err = openRotatingFile(cfg.file())
+			if err != nil {
+				return nil, fmt.Errorf("traceexport: file exporter: %w", err)
+			}
+			// One line per span: the encoder writes each span with a
+			// single Write, so rotation never splits one
+			exp, err := stdouttrace.New(stdouttrace.WithWriter(file))
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("traceexport: file exporter: %w", err)
+			}
+			exporters = append(exporters, exp)
+		default:
+			if file != nil {
+				file.Close()
+			}
+			return nil, fmt.Errorf("traceexport: unknown exporter %q in OTEL_TRACE_EXPORTERS", name)
+		}
+	}
+
+	processors := make([]sdktrace.SpanProcessor, len(exporters))
+	for i, exp := range exporters {
+		processors[i] = sdktrace.NewBatchSpanProcessor(exp)
+		sdkTP.RegisterSpanProcessor(processors[i])
+	}
+
+	return func(ctx context.Context) error {
+		var errs []error
+		for _, p := range processors {
+			errs = append(errs, p.Shutdown(ctx))
+		}
+		if file != nil {
+			errs = append(errs, file.Close())
+		}
+		return errors.Join(errs...)
+	}, nil
+}
+
+// file returns the file exporter's settings, with defaults filled in.
+func (cfg Config) file() (path string, maxBytes int64, backups int) {
+	path, maxBytes, backups = cfg.File, cfg.FileMaxBytes, cfg.FileBackups
+	if path == "" {
+		path = DefaultFile
+	}
+	if maxBytes <= 0 {
+		maxBytes = DefaultFileMaxBytes
+	}
+	if backups == 0 {
+		backups = DefaultFileBackups
+	} else if backups < 0 {
+		backups = 0
+	}
+	return path, maxBytes, backups
+}
@@ -0,0 +1,377 @@
+// Package contract verifies that a users API provider honors the contract
+// every framework example shares, and traces each check.
+//
+// The contract is the HTTP behavior of the users adapters: the routes, the
+// status codes StatusCode maps errors to, and the JSON bodies. Verify runs
+// the interactions in order against a running provider:
+//
+//	v := contract.NewVerifier("http://localhost:8080", client, runID)
+//	results := v.Verify(ctx)
+//
+// The suite and every interaction get a span tagged test.run_id, and the run
+// ID and the interaction name travel to the provider as W3C baggage. A
+// provider that registers the testrun span processor tags its own spans with
+// them, so a failing interaction leads straight to the provider's trace for
+// it.
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"github.com/last9/opentelemetry-examples/go/common/users"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.27.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the verification spans.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/users/contract"
+
+// RunIDKey is the span attribute and baggage member holding the run ID.
+const RunIDKey = testrun.RunIDKey
+
+// SuiteName is the test.suite.name of the suite span.
+const SuiteName = "users-api-contract"
+
+// maxBodyExcerpt caps the response body kept on a failed interaction.
+const maxBodyExcerpt = 512
+
+// state is what interactions learn from earlier ones, such as the ID of the
+// user they created.
+type state struct {
+	userID string
+	email  string
+}
+
+// interaction is one request and the response the contract requires.
+type interaction struct {
+	// Name describes the interaction, such as "get unknown user".
+	Name   string
+	Method string
+	// Path returns the request path; it may use state from earlier
+	// interactions.
+	Path func(s *state) string
+	// Body returns the JSON request body, or nil for none.
+	Body func(s *state) any
+	// Status is the required response status.
+	Status int
+	// Check validates the response body, and may record state for later
+	// interactions. Nil checks nothing beyond the status.
+	Check func(s *state, body []byte) error
+}
+
+// interactions returns the users API contract, in the order it runs. Each
+// run creates, reads, updates and deletes its own user, with an email made
+// unique by the run ID.
+func interactions() []interaction {
+	return []interaction{
+		{
+			Name:   "create user",
+			Method: http.MethodPost,
+			Path:   fixedPath("/users"),
+			Body: func(s *state) any {
+				return users.CreateInput{Name: "Contract Test", Email: s.email}
+			},
+			Status: http.StatusCreated,
+			Check: func(s *state, body []byte) error {
+				u, err := decodeUser(body)
+				if err != nil {
+					return err
+				}
+				if u.Email != s.email {
+					return fmt.Errorf("email: want %q, got %q", s.email, u.Email)
+				}
+				s.userID = u.ID
+				return nil
+			},
+		},
+		{
+			Name:   "create user with duplicate email",
+			Method: http.MethodPost,
+			Path:   fixedPath("/users"),
+			Body: func(s *state) any {
+				return users.CreateInput{Name: "Contract Test", Email: s.email}
+			},
+			Status: http.StatusConflict,
+			Check:  expectError,
+		},
+		{
+			Name:   "create user without email",
+			Method: http.MethodPost,
+			Path:   fixedPath("/users"),
+			Body:   func(*state) any { return users.CreateInput{Name: "Contract Test"} },
+			Status: http.StatusBadRequest,
+			Check:  expectError,
+		},
+		{
+			Name:   "get user",
+			Method: http.MethodGet,
+			Path:   userPath,
+			Status: http.StatusOK,
+			Check: func(s *state, body []byte) error {
+				u, err := decodeUser(body)
+				if err != nil {
+					return err
+				}
+				if u.ID != s.userID {
+					return fmt.Errorf("id: want %q, got %q", s.userID, u.ID)
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "get user with malformed id",
+			Method: http.MethodGet,
+			Path:   fixedPath("/users/not-a-uuid"),
+			Status: http.StatusBadRequest,
+			Check:  expectError,
+		},
+		{
+			Name:   "list users",
+			Method: http.MethodGet,
+			Path:   fixedPath("/users"),
+			Status: http.StatusOK,
+			Check: func(s *state, body []byte) error {
+				var list []users.User
+				if err := json.Unmarshal(body, &list); err != nil {
+					return fmt.Errorf("body is not a list of users: %w", err)
+				}
+				for _, u := range list {
+					if u.ID == s.userID {
+						return nil
+					}
+				}
+				return fmt.Errorf("created user %q missing from list", s.userID)
+			},
+		},
+		{
+			Name:   "update user",
+			Method: http.MethodPut,
+			Path:   userPath,
+			Body:   func(*state) any { return map[string]string{"name": "Contract Test Updated"} },
+			Status: http.StatusOK,
+			Check: func(s *state, body []byte) error {
+				u, err := decodeUser(body)
+				if err != nil {
+					return err
+				}
+				if u.Name != "Contract Test Updated" || u.Email != s.email {
+					return fmt.Errorf("want updated name and unchanged email, got %+v", *u)
+				}
+				return nil
+			},
+		},
+		{
+			Name:   "update user with no fields",
+			Method: http.MethodPut,
+			Path:   userPath,
+			Body:   func(*state) any { return map[string]string{} },
+			Status: http.StatusBadRequest,
+			Check:  expectError,
+		},
+		{
+			Name:   "delete user",
+			Method: http.MethodDelete,
+			Path:   userPath,
+			Status: http.StatusNoContent,
+		},
+		{
+			Name:   "get deleted user",
+			Method: http.MethodGet,
+			Path:   userPath,
+			Status: http.StatusNotFound,
+			Check:  expectError,
+		},
+	}
+}
+
+func fixedPath(p string) func(*state) string {
+	return func(*state) string { return p }
+}
+
+// userPath is the path of the user created by the run. If creation failed,
+// it is a well-formed ID that matches no user, so later interactions still
+// run and fail on their own terms.
+func userPath(s *state) string {
+	if s.userID == "" {
+		return "/users/00000000-0000-0000-0000-000000000000"
+	}
+	return "/users/" + s.userID
+}
+
+func decodeUser(body []byte) (*users.User, error) {
+	var u users.User
+	if err := json.Unmarshal(body, &u); err != nil {
+		return nil, fmt.Errorf("body is not a user: %w", err)
+	}
+	if u.ID == "" || u.Name == "" || u.Email == "" {
+		return nil, fmt.Errorf("user is missing fields: %+v", u)
+	}
+	return &u, nil
+}
+
+// expectError checks for the {"error": "..."} body of ErrorBody.
+func expectError(_ *state, body []byte) error {
+	var e map[string]string
+	if err := json.Unmarshal(body, &e); err != nil || e["error"] == "" {
+		return fmt.Errorf(`body is not {"error": "..."}: %s`, excerpt(body))
+	}
+	return nil
+}
+
+// Result is the outcome of one interaction.
+type Result struct {
+	Interaction string
+	Passed      bool
+	// Status is the response status, or 0 if the request failed.
+	Status int
+	// Err says why the interaction failed.
+	Err error
+	// TraceID and SpanID locate the interaction's span in the tracing
+	// backend. All interactions of a run share the suite's trace.
+	TraceID string
+	SpanID  string
+}
+
+// Verifier runs the contract against a provider.
+type Verifier struct {
+	baseURL      string
+	client       *http.Client
+	runID        string
+	interactions []interaction
+	tracer       trace.Tracer
+}
+
+// NewVerifier returns a Verifier for the provider at baseURL. The client
+// should be instrumented, such as with otelhttp, so the run's spans and
+// baggage reach the provider.
+func NewVerifier(baseURL string, client *http.Client, runID string) *Verifier {
+	return &Verifier{
+		baseURL:      strings.TrimSuffix(baseURL, "/"),
+		client:       client,
+		runID:        runID,
+		interactions: interactions(),
+		tracer:       otel.Tracer(ScopeName),
+	}
+}
+
+// Verify runs every interaction in order under a suite span, and returns
+// their results.
+func (v *Verifier) Verify(ctx context.Context) []Result {
+	ctx = testrun.ContextWithRun(ctx, v.runID)
+	ctx, span := v.tracer.Start(ctx, "contract "+SuiteName, trace.WithAttributes(
+		semconv.TestSuiteName(SuiteName),
+		attribute.String(RunIDKey, v.runID),
+		attribute.String("contract.provider.url", v.baseURL),
+	))
+	defer span.End()
+
+	s := &state{email: fmt.Sprintf("contract-%s@example.com", v.runID)}
+	results := make([]Result, 0, len(v.interactions))
+	failed := 0
+	for _, in := range v.interactions {
+		r := v.run(ctx, s, in)
+		if !r.Passed {
+			failed++
+		}
+		results = append(results, r)
+	}
+
+	span.SetAttributes(
+		attribute.Int("contract.interactions", len(results)),
+		attribute.Int("contract.interactions.failed", failed),
+	)
+	if failed > 0 {
+		span.SetAttributes(semconv.TestSuiteRunStatusFailure)
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d interactions failed", failed, len(results)))
+	} else {
+		span.SetAttributes(semconv.TestSuiteRunStatusSuccess)
+	}
+	return results
+}
+
+// run sends one interaction under its own span and checks the response.
+func (v *Verifier) run(ctx context.Context, s *state, in interaction) Result {
+	path := in.Path(s)
+	ctx = testrun.ContextWithCase(ctx, in.Name)
+	ctx, span := v.tracer.Start(ctx, "contract "+in.Name, trace.WithAttributes(
+		semconv.TestCaseName(in.Name),
+		attribute.String(RunIDKey, v.runID),
+		attribute.String("contract.request", in.Method+" "+path),
+		attribute.Int("contract.expected_status", in.Status),
+	))
+	defer span.End()
+
+	result := Result{
+		Interaction: in.Name,
+		TraceID:     span.SpanContext().TraceID().String(),
+		SpanID:      span.SpanContext().SpanID().String(),
+	}
+	status, body, err := v.send(ctx, in, s, path)
+	result.Status = status
+	if err == nil && status != in.Status {
+		err = fmt.Errorf("status: want %d, got %d", in.Status, status)
+	}
+	if err == nil && in.Check != nil {
+		err = in.Check(s, body)
+	}
+	span.SetAttributes(attribute.Int("contract.actual_status", status))
+
+	if err != nil {
+		result.Err = err
+		span.SetAttributes(semconv.TestCaseResultStatusFail)
+		span.AddEvent("contract.mismatch", trace.WithAttributes(
+			attribute.String("contract.mismatch.reason", err.Error()),
+			attribute.String("contract.response.body", excerpt(body)),
+		))
+		span.SetStatus(codes.Error, err.Error())
+		return result
+	}
+	result.Passed = true
+	span.SetAttributes(semconv.TestCaseResultStatusPass)
+	return result
+}
+
+func (v *Verifier) send(ctx context.Context, in interaction, s *state, path string) (int, []byte, error) {
+	var reqBody io.Reader
+	if in.Body != nil {
+		b, err := json.Marshal(in.Body(s))
+		if err != nil {
+			return 0, nil, err
+		}
+		reqBody = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, in.Method, v.baseURL+path, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	if reqBody != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("read body: %w", err)
+	}
+	return resp.StatusCode, body, nil
+}
+
+func excerpt(body []byte) string {
+	if len(body) > maxBodyExcerpt {
+		return string(body[:maxBodyExcerpt]) + "..."
+	}
+	return string(body)
+}
@@ -0,0 +1,298 @@
+package users
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/lazyattr"
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope for spans created by Service.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/common/users"
+
+const (
+	listCacheKey = "users"
+	cacheTTL     = 5 * time.Minute
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Service implements the users CRUD operations on Postgres with a Redis
+// read-through cache.
+//
+// The *sql.DB and Redis client are expected to be instrumented by the caller
+// (go-agent, otelsql, redisotel, ...), so every query and cache command shows
+// up as a child of the span Service starts for the operation.
+type Service struct {
+	db     *sql.DB
+	cache  redis.Cmdable
+	tracer trace.Tracer
+}
+
+// NewService returns a Service backed by db and cache. cache may be nil, in
+// which case every read goes to the database.
+func NewService(db *sql.DB, cache redis.Cmdable) *Service {
+	return &Service{
+		db:     db,
+		cache:  cache,
+		tracer: otel.Tracer(ScopeName),
+	}
+}
+
+// EnsureSchema creates the users table if it does not exist.
+func (s *Service) EnsureSchema(ctx context.Context) error {
+	ctx, span := s.start(ctx, "users.EnsureSchema")
+	defer span.End()
+
+	// pgcrypto provides gen_random_uuid on Postgres < 13.
+	if _, err := s.db.ExecContext(ctx, `CREATE EXTENSION IF NOT EXISTS pgcrypto`); err != nil {
+		return fail(span, fmt.Errorf("create extension: %w", err))
+	}
+	_, err := s.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS users (
+		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+		name TEXT NOT NULL,
+		email TEXT NOT NULL UNIQUE
+	)`)
+	if err != nil {
+		return fail(span, fmt.Errorf("create users table: %w", err))
+	}
+	return nil
+}
+
+// List returns all users ordered by name.
+func (s *Service) List(ctx context.Context) ([]User, error) {
+	ctx, span := s.start(ctx, "users.List")
+	defer span.End()
+
+	var users []User
+	if s.getCached(ctx, span, listCacheKey, &users) {
+		return users, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT id::text, name, email FROM users ORDER BY name ASC`)
+	if err != nil {
+		return nil, fail(span, fmt.Errorf("query users: %w", err))
+	}
+	defer rows.Close()
+
+	users = []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email); err != nil {
+			return nil, fail(span, fmt.Errorf("scan user: %w", err))
+		}
+		users = append(users, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fail(span, fmt.Errorf("iterate users: %w", err))
+	}
+
+	span.SetAttributes(attribute.Int("users.count", len(users)))
+	s.setCached(ctx, listCacheKey, users)
+	return users, nil
+}
+
+// Get returns the user with the given ID.
+func (s *Service) Get(ctx context.Context, id string) (*User, error) {
+	ctx, span := s.start(ctx, "users.Get", attribute.String("user.id", id))
+	defer span.End()
+
+	if !uuidPattern.MatchString(id) {
+		return nil, fail(span, fmt.Errorf("%w: malformed id %q", ErrInvalidInput, id))
+	}
+
+	var u User
+	if s.getCached(ctx, span, userCacheKey(id), &u) {
+		return &u, nil
+	}
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT id::text, name, email FROM users WHERE id = $1::uuid`, id,
+	).Scan(&u.ID, &u.Name, &u.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fail(span, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fail(span, fmt.Errorf("query user: %w", err))
+	}
+
+	s.setCached(ctx, userCacheKey(id), u)
+	return &u, nil
+}
+
+// Create inserts a new user and returns it with its generated ID.
+func (s *Service) Create(ctx context.Context, in CreateInput) (*User, error) {
+	ctx, span := s.start(ctx, "users.Create")
+	defer span.End()
+
+	if err := in.Validate(); err != nil {
+		return nil, fail(span, fmt.Errorf("%w: name and email are required", err))
+	}
+
+	u := User{Name: in.Name, Email: in.Email}
+	err := s.db.QueryRowContext(ctx,
+		`INSERT INTO users (name, email) VALUES ($1, $2) RETURNING id::text`,
+		in.Name, in.Email,
+	).Scan(&u.ID)
+	if err != nil {
+		return nil, fail(span, classify(fmt.Errorf("insert user: %w", err)))
+	}
+
+	span.SetAttributes(attribute.String("user.id", u.ID))
+	s.invalidate(ctx, listCacheKey)
+	return &u, nil
+}
+
+// Update changes the non-nil fields of in on the user with the given ID.
+func (s *Service) Update(ctx context.Context, id string, in UpdateInput) (*User, error) {
+	ctx, span := s.start(ctx, "users.Update", attribute.String("user.id", id))
+	defer span.End()
+
+	if !uuidPattern.MatchString(id) {
+		return nil, fail(span, fmt.Errorf("%w: malformed id %q", ErrInvalidInput, id))
+	}
+
+	set := make([]string, 0, 2)
+	args := make([]any, 0, 3)
+	if in.Name != nil {
+		args = append(args, *in.Name)
+		set = append(set, fmt.Sprintf("name = $%d", len(args)))
+	}
+	if in.Email != nil {
+		args = append(args, *in.Email)
+		set = append(set, fmt.Sprintf("email = $%d", len(args)))
+	}
+	if len(set) == 0 {
+		return nil, fail(span, fmt.Errorf("%w: nothing to update", ErrInvalidInput))
+	}
+	args = append(args, id)
+	span.SetAttributes(attribute.Int("users.updated_fields", len(set)))
+
+	query := fmt.Sprintf(`UPDATE users SET %s WHERE id = $%d::uuid RETURNING id::text, name, email`,
+		strings.Join(set, ", "), len(args))
+
+	var u User
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(&u.ID, &u.Name, &u.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fail(span, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fail(span, classify(fmt.Errorf("update user: %w", err)))
+	}
+
+	s.invalidate(ctx, userCacheKey(id), listCacheKey)
+	return &u, nil
+}
+
+// Delete removes the user with the given ID.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	ctx, span := s.start(ctx, "users.Delete", attribute.String("user.id", id))
+	defer span.End()
+
+	if !uuidPattern.MatchString(id) {
+		return fail(span, fmt.Errorf("%w: malformed id %q", ErrInvalidInput, id))
+	}
+
+	res, err := s.db.ExecContext(ctx, `DELETE FROM users WHERE id = $1::uuid`, id)
+	if err != nil {
+		return fail(span, fmt.Errorf("delete user: %w", err))
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fail(span, ErrNotFound)
+	}
+
+	s.invalidate(ctx, userCacheKey(id), listCacheKey)
+	return nil
+}
+
+func (s *Service) start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// getCached loads key into dst and records the outcome as cache.hit on span.
+// A Redis error is treated as a miss so the request still succeeds.
+func (s *Service) getCached(ctx context.Context, span trace.Span, key string, dst any) bool {
+	if s.cache == nil {
+		return false
+	}
+	data, err := s.cache.Get(ctx, key).Bytes()
+	hit := err == nil && json.Unmarshal(data, dst) == nil
+	span.SetAttributes(attribute.Bool("cache.hit", hit))
+	if err != nil && !errors.Is(err, redis.Nil) {
+		lazyattr.Event(span, "cache.error", func() []attribute.KeyValue {
+			return []attribute.KeyValue{attribute.String("error.message", err.Error())}
+		})
+	}
+	return hit
+}
+
+func (s *Service) setCached(ctx context.Context, key string, v any) {
+	if s.cache == nil {
+		return
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	s.cache.Set(ctx, key, data, cacheTTL)
+}
+
+func (s *Service) invalidate(ctx context.Context, keys ...string) {
+	if s.cache == nil {
+		return
+	}
+	s.cache.Del(ctx, keys...)
+}
+
+func userCacheKey(id string) string {
+	return "user:" + id
+}
+
+// classify maps driver errors onto the package's sentinel errors. Both lib/pq
+// and pgx expose the Postgres error code through SQLState.
+func classify(err error) error {
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) && pgErr.SQLState() == "23505" {
+		return fmt.Errorf("%w: %w", ErrConflict, err)
+	}
+	return err
+}
+
+// fail records err on span. Client errors are added as an event but leave the
+// span status unset, since the service behaved correctly. Server errors are
+// returned with the stack of the operation that failed, for the adapter to
+// record on the request span with otelerr.Record. Nothing is built for a span
+// that isn't recording: rejected requests are common, and most of them are
+// sampled out.
+func fail(span trace.Span, err error) error {
+	server := StatusCode(err) >= 500
+	if span.IsRecording() {
+		if server {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		} else {
+			span.AddEvent("users.rejected", trace.WithAttributes(
+				attribute.String("error.message", err.Error()),
+			))
+		}
+	}
+	if server {
+		return otelerr.Wrap(err)
+	}
+	return err
+}
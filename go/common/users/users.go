@@ -0,0 +1,75 @@
+// Package users is the users domain shared by the Go framework examples.
+//
+// Each framework example (gin, chi, fasthttp, iris, gorilla-mux, beego) keeps
+// only a thin adapter that parses the request, calls Service and writes the
+// response, so behavior and telemetry are identical across examples.
+package users
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// User is the users table row.
+type User struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// CreateInput is the request body for creating a user.
+type CreateInput struct {
+	Name  string `json:"name" form:"name"`
+	Email string `json:"email" form:"email"`
+}
+
+// UpdateInput is the request body for updating a user. Nil fields are left
+// unchanged.
+type UpdateInput struct {
+	Name  *string `json:"name" form:"name"`
+	Email *string `json:"email" form:"email"`
+}
+
+var (
+	// ErrNotFound is returned when no user matches the given ID.
+	ErrNotFound = errors.New("user not found")
+	// ErrInvalidInput is returned when the request is missing required fields
+	// or carries a malformed ID.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrConflict is returned when the email is already in use.
+	ErrConflict = errors.New("email already exists")
+)
+
+// Validate checks that the required fields are present.
+func (in CreateInput) Validate() error {
+	if strings.TrimSpace(in.Name) == "" || strings.TrimSpace(in.Email) == "" {
+		return ErrInvalidInput
+	}
+	return nil
+}
+
+// StatusCode maps a Service error to the HTTP status adapters should return.
+func StatusCode(err error) int {
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// ErrorBody is the JSON error payload every adapter returns.
+func ErrorBody(err error) map[string]string {
+	if StatusCode(err) == http.StatusInternalServerError {
+		// Don't leak driver errors to clients; the span has the details.
+		return map[string]string{"error": "internal server error"}
+	}
+	return map[string]string{"error": err.Error()}
+}
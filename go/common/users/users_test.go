@@ -0,0 +1,143 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestStatusCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, http.StatusOK},
+		{"not found", ErrNotFound, http.StatusNotFound},
+		{"invalid input", ErrInvalidInput, http.StatusBadRequest},
+		{"conflict", ErrConflict, http.StatusConflict},
+		{"wrapped", fmt.Errorf("%w: malformed id %q", ErrInvalidInput, "x"), http.StatusBadRequest},
+		{"wrapped with a stack", otelerr.Wrap(ErrNotFound), http.StatusNotFound},
+		{"driver error", errors.New("connection refused"), http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		if got := StatusCode(tt.err); got != tt.want {
+			t.Errorf("%s: StatusCode(%v) = %d, want %d", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestErrorBody(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"client error", fmt.Errorf("%w: nothing to update", ErrInvalidInput), "invalid input: nothing to update"},
+		{"not found", ErrNotFound, "user not found"},
+		// Driver errors stay on the span
+		{"server error", errors.New(`pq: password authentication failed for user "app"`), "internal server error"},
+	}
+	for _, tt := range tests {
+		body := ErrorBody(tt.err)
+		if len(body) != 1 || body["error"] != tt.want {
+			t.Errorf("%s: ErrorBody(%v) = %v, want error: %q", tt.name, tt.err, body, tt.want)
+		}
+	}
+}
+
+func TestCreateInputValidate(t *testing.T) {
+	tests := []struct {
+		in   CreateInput
+		want error
+	}{
+		{CreateInput{Name: "Ada", Email: "ada@example.com"}, nil},
+		{CreateInput{Email: "ada@example.com"}, ErrInvalidInput},
+		{CreateInput{Name: "Ada"}, ErrInvalidInput},
+		{CreateInput{Name: "  ", Email: "ada@example.com"}, ErrInvalidInput},
+		{CreateInput{Name: "Ada", Email: "\t"}, ErrInvalidInput},
+	}
+	for _, tt := range tests {
+		if got := tt.in.Validate(); !errors.Is(got, tt.want) {
+			t.Errorf("%+v.Validate() = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+type pgError string
+
+func (e pgError) Error() string    { return "pq: " + string(e) }
+func (e pgError) SQLState() string { return string(e) }
+
+func TestClassify(t *testing.T) {
+	if err := classify(fmt.Errorf("insert user: %w", pgError("23505"))); !errors.Is(err, ErrConflict) {
+		t.Errorf("unique violation: got %v, want ErrConflict", err)
+	}
+	if err := classify(fmt.Errorf("insert user: %w", pgError("23502"))); StatusCode(err) != http.StatusInternalServerError {
+		t.Errorf("not null violation: got %v, want a server error", err)
+	}
+}
+
+// TestServiceRejects checks the requests Service turns away before it
+// touches the database, which is nil here, and that a rejection leaves the
+// span status unset.
+func TestServiceRejects(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	s := NewService(nil, nil)
+	s.tracer = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+	ctx := context.Background()
+	name := "Ada"
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{"get malformed id", func() error { _, err := s.Get(ctx, "42"); return err }},
+		{"update malformed id", func() error { _, err := s.Update(ctx, "42", UpdateInput{Name: &name}); return err }},
+		{"update nothing", func() error {
+			_, err := s.Update(ctx, "3f9a2c1e-5b7d-4e8f-9a1b-2c3d4e5f6a7b", UpdateInput{})
+			return err
+		}},
+		{"delete malformed id", func() error { return s.Delete(ctx, "../users") }},
+		{"create without email", func() error { _, err := s.Create(ctx, CreateInput{Name: name}); return err }},
+	}
+	for _, tt := range tests {
+		if err := tt.call(); StatusCode(err) != http.StatusBadRequest {
+			t.Errorf("%s: got %v, want ErrInvalidInput", tt.name, err)
+		}
+	}
+
+	spans := sr.Ended()
+	if len(spans) != len(tests) {
+		t.Fatalf("got %d spans, want %d", len(spans), len(tests))
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Unset {
+			t.Errorf("%s has status %v, want Unset for a client error", span.Name(), span.Status().Code)
+		}
+		if events := span.Events(); len(events) != 1 || events[0].Name != "users.rejected" {
+			t.Errorf("%s has events %v, want one users.rejected", span.Name(), events)
+		}
+	}
+}
+
+func TestFailServerError(t *testing.T) {
+	sr := tracetest.NewSpanRecorder()
+	_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test").Start(context.Background(), "op")
+	err := fail(span, errors.New("connection refused"))
+	span.End()
+
+	if otelerr.Stack(err) == "" {
+		t.Error("server error has no stack for otelerr.Record")
+	}
+	if got := sr.Ended()[0].Status().Code; got != codes.Error {
+		t.Errorf("span status is %v, want Error", got)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/errgroup"
+)
+
+// maxItems stays below the SDK's default limit of 128 links per span, so
+// the aggregate span keeps a link to every worker.
+const maxItems = 64
+
+// quote is one worker's result.
+type quote struct {
+	Item  int     `json:"item"`
+	Price float64 `json:"price"`
+	// span is the worker's span, for the aggregate span to link to.
+	span trace.SpanContext
+}
+
+// fanoutHandler prices ?items= items, default 8, in parallel, at most
+// ?parallel= at a time, default 4, then totals them:
+//
+//	GET /fanout                  request span
+//	├── fanout.worker            child, one per item, run concurrently
+//	├── ...
+//	└── fanin.aggregate          child, linked to every fanout.worker
+//
+// ?fail=<item> makes that item's worker fail, which cancels the others.
+func fanoutHandler(w http.ResponseWriter, r *http.Request) {
+	items := min(max(queryInt(r, "items", 8), 1), maxItems)
+	parallel := min(max(queryInt(r, "parallel", 4), 1), items)
+	fail := queryInt(r, "fail", -1)
+
+	// Each worker's span is a child of the request span: the request is
+	// what started it, and waits for it
+	quotes := make([]quote, items)
+	g, ctx := errgroup.WithContext(r.Context())
+	g.SetLimit(parallel)
+	for i := range items {
+		g.Go(func() error {
+			q, err := priceItem(ctx, i, i == fail)
+			quotes[i] = q
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	total := aggregate(r.Context(), quotes)
+	writeJSON(w, map[string]any{
+		"trace_id": trace.SpanContextFromContext(r.Context()).TraceID().String(),
+		"items":    items,
+		"parallel": parallel,
+		"total":    total,
+		"quotes":   quotes,
+	})
+}
+
+// priceItem looks up one item's price, under a fanout.worker span.
+func priceItem(ctx context.Context, item int, fail bool) (quote, error) {
+	ctx, span := tracer.Start(ctx, "fanout.worker", trace.WithAttributes(
+		attribute.Int("fanout.item", item),
+	))
+	defer span.End()
+	q := quote{Item: item, span: span.SpanContext()}
+
+	// Stands in for a call to a pricing service
+	select {
+	case <-time.After(time.Duration(20+rand.Intn(80)) * time.Millisecond):
+	case <-ctx.Done():
+		// Another worker failed; this one's result would be thrown away
+		span.SetAttributes(attribute.Bool("fanout.canceled", true))
+		span.SetStatus(codes.Error, "canceled")
+		return q, ctx.Err()
+	}
+	if fail {
+		err := fmt.Errorf("price item %d: pricing service unavailable", item)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return q, err
+	}
+	q.Price = float64(100+rand.Intn(9900)) / 100
+	span.SetAttributes(attribute.Float64("fanout.price", q.Price))
+	return q, nil
+}
+
+// aggregate totals the quotes under a fanin.aggregate span. The span is a
+// child of the request, which started it, and has a link to each worker
+// span whose result it used. The workers aren't its parents: a span has
+// one parent, and the workers ran beside it, not above it. The links record
+// that its input came from them.
+func aggregate(ctx context.Context, quotes []quote) float64 {
+	links := make([]trace.Link, len(quotes))
+	for i, q := range quotes {
+		links[i] = trace.Link{
+			SpanContext: q.span,
+			Attributes:  []attribute.KeyValue{attribute.Int("fanout.item", q.Item)},
+		}
+	}
+	_, span := tracer.Start(ctx, "fanin.aggregate",
+		trace.WithLinks(links...),
+		trace.WithAttributes(attribute.Int("fanin.inputs", len(quotes))),
+	)
+	defer span.End()
+
+	var total float64
+	for _, q := range quotes {
+		total += q.Price
+	}
+	span.SetAttributes(attribute.Float64("fanin.total", total))
+	return total
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get(key)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
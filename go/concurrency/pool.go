@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// job is a unit of work queued by POST /jobs.
+type job struct {
+	index int
+	// enqueued is the span that queued the job.
+	enqueued trace.SpanContext
+	// child runs the job in the enqueuing span's trace, as its child,
+	// instead of in a trace of its own linked to it.
+	child bool
+}
+
+// pool runs queued jobs on a fixed number of workers.
+type pool struct {
+	jobs chan job
+	wg   sync.WaitGroup
+}
+
+func newPool(workers, queue int) *pool {
+	p := &pool{jobs: make(chan job, queue)}
+	for range workers {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				p.process(j)
+			}
+		}()
+	}
+	return p
+}
+
+// close stops taking jobs and waits for the queued ones to finish.
+func (p *pool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// enqueueHandler queues ?count= jobs, default 3, each under its own
+// job.enqueue span, and returns 202 before they run:
+//
+//	POST /jobs                   request span, trace A
+//	├── job.enqueue              producer, one per job
+//	└── ...
+//
+//	job.process                  consumer, root of trace B, linked to its job.enqueue
+//
+// With ?trace=child, each job.process is a child of its job.enqueue, in
+// trace A, instead.
+func (p *pool) enqueueHandler(w http.ResponseWriter, r *http.Request) {
+	count := min(max(queryInt(r, "count", 3), 1), 100)
+	child := r.URL.Query().Get("trace") == "child"
+
+	queued := 0
+	for i := range count {
+		_, span := tracer.Start(r.Context(), "job.enqueue",
+			trace.WithSpanKind(trace.SpanKindProducer),
+			trace.WithAttributes(attribute.Int("job.index", i)),
+		)
+		select {
+		case p.jobs <- job{index: i, enqueued: span.SpanContext(), child: child}:
+			queued++
+		default:
+			span.SetAttributes(attribute.Bool("job.dropped", true))
+		}
+		span.End()
+	}
+	if queued == 0 {
+		http.Error(w, "queue full", http.StatusServiceUnavailable)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, map[string]any{
+		"trace_id": trace.SpanContextFromContext(r.Context()).TraceID().String(),
+		"queued":   queued,
+		"dropped":  count - queued,
+		"trace":    map[bool]string{false: "link", true: "child"}[child],
+	})
+}
+
+// process runs a job. By default it starts a new trace linked to the span
+// that queued it: the job outlives the request, and waits in the queue for
+// an unknown time, so as a child it would stretch the request's trace far
+// past its response. The link still leads from one trace to the other.
+func (p *pool) process(j job) {
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.Int("job.index", j.index)),
+	}
+	ctx := context.Background()
+	if j.child {
+		ctx = trace.ContextWithSpanContext(ctx, j.enqueued)
+	} else {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: j.enqueued}))
+	}
+	ctx, span := tracer.Start(ctx, "job.process", opts...)
+	defer span.End()
+
+	_, step := tracer.Start(ctx, "job.work")
+	time.Sleep(time.Duration(50+rand.Intn(150)) * time.Millisecond)
+	step.End()
+}
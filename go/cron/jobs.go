@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The example's jobs. Each stands in for real work with sleeps, and
+// misbehaves in its own way: one fails now and then, one sometimes runs
+// past its next run, one panics.
+
+var errUpstream = errors.New("upstream returned 503")
+
+// cleanupSessions deletes expired sessions. It fails one run in four.
+func cleanupSessions(ctx context.Context) error {
+	return step(ctx, "delete expired sessions", 100*time.Millisecond, func(span trace.Span) error {
+		if rand.IntN(4) == 0 {
+			return fmt.Errorf("delete expired sessions: %w", errUpstream)
+		}
+		span.SetAttributes(attribute.Int("sessions.deleted", rand.IntN(500)))
+		return nil
+	})
+}
+
+// syncInventory pulls the inventory from a supplier, page by page. A run
+// takes 2 to 8 pages of a second each, so on a 5s schedule it sometimes
+// overruns, and the next run is skipped.
+func syncInventory(ctx context.Context) error {
+	pages := 2 + rand.IntN(7)
+	for page := 1; page <= pages; page++ {
+		err := step(ctx, "fetch page", time.Second, func(span trace.Span) error {
+			span.SetAttributes(attribute.Int("inventory.page", page))
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int("inventory.pages", pages))
+	return nil
+}
+
+// rebuildReport panics, to show a panic on the run's span.
+func rebuildReport(ctx context.Context) error {
+	var totals map[string]int
+	return step(ctx, "aggregate", 200*time.Millisecond, func(trace.Span) error {
+		totals["orders"]++ // nil map
+		return nil
+	})
+}
+
+// step runs fn under a child span of the run's, after waiting delay, or
+// until ctx is canceled.
+func step(ctx context.Context, name string, delay time.Duration, fn func(trace.Span) error) (err error) {
+	ctx, span := otel.Tracer(scopeName).Start(ctx, name)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return fmt.Errorf("%s: %w", name, context.Cause(ctx))
+	}
+	return fn(span)
+}
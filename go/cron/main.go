@@ -0,0 +1,119 @@
+// Scheduler that runs jobs on cron schedules with robfig/cron, tracing each
+// run as a trace of its own and measuring its duration and outcome.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// telemetry holds the providers, so they can be flushed on shutdown.
+type telemetry struct {
+	tp *sdktrace.TracerProvider
+	mp *sdkmetric.MeterProvider
+}
+
+// initTelemetry sets up tracing and metrics, exported over OTLP/HTTP as
+// configured by the OTEL_EXPORTER_OTLP_* variables.
+func initTelemetry(ctx context.Context) (*telemetry, error) {
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP metric exporter: %w", err)
+	}
+
+	// resource.Default() reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	res := resource.Default()
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	return &telemetry{tp: tp, mp: mp}, nil
+}
+
+// shutdown exports what's left, then shuts the providers down.
+func (t *telemetry) shutdown(ctx context.Context) error {
+	return errors.Join(
+		t.tp.Shutdown(ctx),
+		t.mp.Shutdown(ctx),
+	)
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	tel, err := initTelemetry(context.Background())
+	if err != nil {
+		log.Fatalf("init telemetry: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := tel.shutdown(ctx); err != nil {
+			log.Printf("telemetry shutdown: %v", err)
+		}
+	}()
+
+	// Canceled on SIGINT or SIGTERM, which cuts the runs in progress short
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	s, err := newScheduler(ctx)
+	if err != nil {
+		log.Printf("create scheduler: %v", err)
+		return
+	}
+	jobs := []struct {
+		name, spec string
+		fn         func(context.Context) error
+	}{
+		{"cleanup-sessions", getenv("CLEANUP_SCHEDULE", "*/10 * * * * *"), cleanupSessions},
+		{"sync-inventory", getenv("SYNC_SCHEDULE", "@every 5s"), syncInventory},
+		{"rebuild-report", getenv("REPORT_SCHEDULE", "0 * * * * *"), rebuildReport},
+	}
+	for _, j := range jobs {
+		if err := s.add(j.name, j.spec, j.fn); err != nil {
+			log.Printf("%v", err)
+			return
+		}
+		log.Printf("Scheduled %s on %q", j.name, j.spec)
+	}
+
+	s.start()
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	stopCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := s.stop(stopCtx); err != nil {
+		log.Printf("stop scheduler: %v", err)
+	}
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/last9/opentelemetry-examples/go/cron"
+
+// scheduler runs jobs on cron schedules, each run under a root span of its
+// own and measured by job.run.duration.
+type scheduler struct {
+	cron *cron.Cron
+	// ctx is the context jobs run in. It's canceled on shutdown, so a job
+	// in progress can stop early.
+	ctx context.Context
+
+	tracer      trace.Tracer
+	duration    metric.Float64Histogram
+	skipped     metric.Int64Counter
+	lastSuccess metric.Int64Gauge
+}
+
+func newScheduler(ctx context.Context) (*scheduler, error) {
+	meter := otel.Meter(scopeName)
+	duration, err := meter.Float64Histogram("job.run.duration",
+		metric.WithDescription("Duration of job runs, by job and outcome"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	skipped, err := meter.Int64Counter("job.run.skipped",
+		metric.WithDescription("Runs skipped because the previous run of the job was still in progress"),
+		metric.WithUnit("{run}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	lastSuccess, err := meter.Int64Gauge("job.run.last_success",
+		metric.WithDescription("Unix time the job last completed successfully"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &scheduler{
+		// Schedules have a seconds field, so the example runs often enough
+		// to watch
+		cron:        cron.New(cron.WithSeconds()),
+		ctx:         ctx,
+		tracer:      otel.Tracer(scopeName),
+		duration:    duration,
+		skipped:     skipped,
+		lastSuccess: lastSuccess,
+	}, nil
+}
+
+// add schedules fn as the job name, on spec: six fields, seconds first, or
+// a descriptor such as @every 30s.
+func (s *scheduler) add(name, spec string, fn func(context.Context) error) error {
+	if _, err := s.cron.AddJob(spec, &tracedJob{s: s, name: name, spec: spec, fn: fn}); err != nil {
+		return fmt.Errorf("schedule %s on %q: %w", name, spec, err)
+	}
+	return nil
+}
+
+func (s *scheduler) start() {
+	s.cron.Start()
+}
+
+// stop stops scheduling runs, and waits for the runs in progress to end,
+// or for ctx to be done.
+func (s *scheduler) stop(ctx context.Context) error {
+	select {
+	case <-s.cron.Stop().Done():
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("runs still in progress: %w", ctx.Err())
+	}
+}
+
+// tracedJob is a cron.Job that runs fn under a root span. A run that comes
+// due while the previous one is still in progress is skipped, like with
+// cron.SkipIfStillRunning, and recorded as a job.run.skipped event on the
+// span of the run in progress, the one that overran.
+type tracedJob struct {
+	s    *scheduler
+	name string
+	spec string
+	fn   func(context.Context) error
+
+	mu sync.Mutex
+	// running is the span of the run in progress, if any
+	running trace.Span
+	skips   int
+}
+
+func (j *tracedJob) Run() {
+	jobName := attribute.String("job.name", j.name)
+
+	j.mu.Lock()
+	if j.running != nil {
+		j.skips++
+		j.running.AddEvent("job.run.skipped", trace.WithAttributes(
+			attribute.Int("job.run.skipped_count", j.skips),
+		))
+		j.mu.Unlock()
+		j.s.skipped.Add(j.s.ctx, 1, metric.WithAttributes(jobName))
+		log.Printf("%s: skipped, the previous run is still in progress", j.name)
+		return
+	}
+	// Every run starts a trace of its own: nothing caused it but the clock
+	ctx, span := j.s.tracer.Start(j.s.ctx, j.name,
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			jobName,
+			attribute.String("job.schedule", j.spec),
+		))
+	j.running = span
+	j.skips = 0
+	j.mu.Unlock()
+
+	start := time.Now()
+	err := j.call(ctx, span)
+	outcome := "success"
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Cut short by the shutdown
+		outcome = "interrupted"
+	case err != nil:
+		outcome = "failure"
+	}
+	if err != nil {
+		log.Printf("%s: %v", j.name, err)
+	}
+
+	j.mu.Lock()
+	span.SetAttributes(
+		attribute.String("job.outcome", outcome),
+		attribute.Int("job.run.skipped_count", j.skips),
+	)
+	span.End()
+	j.running = nil
+	j.mu.Unlock()
+
+	j.s.duration.Record(ctx, time.Since(start).Seconds(),
+		metric.WithAttributes(jobName, attribute.String("job.outcome", outcome)))
+	if err == nil {
+		j.s.lastSuccess.Record(ctx, time.Now().Unix(), metric.WithAttributes(jobName))
+	}
+}
+
+// call runs fn, and records its error on span. A panic is turned into an
+// error, recorded with its stack: cron would otherwise crash the process,
+// or with cron.Recover, log it off the trace.
+func (j *tracedJob) call(ctx context.Context, span trace.Span) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		if err != nil {
+			span.RecordError(err, trace.WithStackTrace(true))
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}()
+	return j.fn(ctx)
+}
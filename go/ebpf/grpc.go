@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ordersHealthServer implements the standard gRPC health service, so the
+// example needs no generated code. Its check runs a query, which puts a
+// database/sql span under the gRPC server span.
+type ordersHealthServer struct {
+	healthpb.UnimplementedHealthServer
+}
+
+func (ordersHealthServer) Check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	if req.Service != "" && req.Service != "orders" {
+		return nil, status.Errorf(codes.NotFound, "unknown service %q", req.Service)
+	}
+
+	var pending int
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders WHERE status = 'pending'").Scan(&pending)
+	if err != nil {
+		return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+	}
+	return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+}
+
+// grpcClient calls this process's own gRPC server, so one HTTP request
+// produces a gRPC client span and a server span, over HTTP/2.
+var grpcClient healthpb.HealthClient
+
+// startGRPC serves the health service on addr and connects grpcClient to it.
+func startGRPC(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, ordersHealthServer{})
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			log.Printf("gRPC server error: %v", err)
+		}
+	}()
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return err
+	}
+	grpcClient = healthpb.NewHealthClient(conn)
+	return nil
+}
+
+func grpcCallHandler(w http.ResponseWriter, r *http.Request) {
+	service := r.URL.Query().Get("service")
+	if service == "" {
+		service = "orders"
+	}
+
+	// eBPF traces the client call, and the server side in the same process
+	ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+	defer cancel()
+	start := time.Now()
+	resp, err := grpcClient.Check(ctx, &healthpb.HealthCheckRequest{Service: service})
+	if err != nil {
+		code := http.StatusBadGateway
+		if status.Code(err) == codes.NotFound {
+			code = http.StatusNotFound
+		}
+		http.Error(w, fmt.Sprintf("gRPC call failed: %v", err), code)
+		return
+	}
+
+	response := map[string]interface{}{
+		"message":     "gRPC call completed",
+		"method":      "/grpc.health.v1.Health/Check",
+		"service":     service,
+		"status":      resp.Status.String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	sdk "go.opentelemetry.io/auto/sdk"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracer creates the manual spans that carry business attributes in hybrid
+// mode. In the default, pure eBPF mode it is a no-op tracer, so the traces
+// contain only what the auto-instrumentation captures.
+var tracer trace.Tracer = noop.NewTracerProvider().Tracer("")
+
+// initInstrumentationMode sets up the tracer for INSTRUMENTATION_MODE:
+//
+//   - ebpf, the default, leaves the no-op tracer
+//   - hybrid uses the TracerProvider of go.opentelemetry.io/auto/sdk
+//
+// The auto SDK doesn't export anything itself. The eBPF auto-instrumentation
+// hooks into it, like it hooks into net/http and database/sql, and sends its
+// spans along with its own, parented under the span found in the context
+// they were started from. Without the auto-instrumentation attached, its
+// spans are dropped.
+func initInstrumentationMode() (string, error) {
+	switch mode := os.Getenv("INSTRUMENTATION_MODE"); mode {
+	case "", "ebpf":
+		return "ebpf", nil
+	case "hybrid":
+		tracer = sdk.TracerProvider().Tracer("go-ebpf-demo")
+		return mode, nil
+	default:
+		return "", fmt.Errorf("INSTRUMENTATION_MODE %q: want ebpf or hybrid", mode)
+	}
+}
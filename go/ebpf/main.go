@@ -7,10 +7,15 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/http/httptrace"
 	"os"
+	"strconv"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // User represents a user model
@@ -33,15 +38,37 @@ type Order struct {
 
 var db *sql.DB
 
+// instrumentationMode is ebpf or hybrid, from INSTRUMENTATION_MODE.
+var instrumentationMode string
+
 func main() {
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Pure eBPF, or eBPF plus manual spans with business attributes
+	var err error
+	instrumentationMode, err = initInstrumentationMode()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	// Initialize SQLite database
 	initDB()
 
+	// Redis cache in front of user lookups, if REDIS_ADDR is set
+	initCache()
+
+	// gRPC server, called by /api/grpc over a loopback connection
+	grpcPort := os.Getenv("GRPC_PORT")
+	if grpcPort == "" {
+		grpcPort = "9090"
+	}
+	if err := startGRPC(":" + grpcPort); err != nil {
+		log.Fatalf("Failed to start gRPC server: %v", err)
+	}
+
 	// Setup routes - eBPF will auto-instrument all these!
 	http.HandleFunc("/", homeHandler)
 	http.HandleFunc("/health", healthHandler)
@@ -50,12 +77,14 @@ func main() {
 	http.HandleFunc("/api/orders", ordersHandler)
 	http.HandleFunc("/api/orders/create", createOrderHandler)
 	http.HandleFunc("/api/external", externalCallHandler)
+	http.HandleFunc("/api/external/reuse", externalReuseHandler)
+	http.HandleFunc("/api/grpc", grpcCallHandler)
 	http.HandleFunc("/api/chain", chainedCallHandler)
 	http.HandleFunc("/api/slow", slowHandler)
 	http.HandleFunc("/api/error", errorHandler)
 
 	log.Printf("Server starting on port %s", port)
-	log.Printf("eBPF will auto-instrument: net/http, database/sql")
+	log.Printf("eBPF will auto-instrument: net/http, database/sql, gRPC (mode: %s)", instrumentationMode)
 	log.Fatal(http.ListenAndServe(":"+port, nil))
 }
 
@@ -139,18 +168,23 @@ func homeHandler(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"message": "Go eBPF Auto-Instrumentation Demo",
 		"endpoints": map[string]string{
-			"GET  /health":            "Health check",
-			"GET  /api/users":         "List all users (DB query)",
-			"GET  /api/users/{id}":    "Get user by ID (DB query)",
-			"GET  /api/orders":        "List all orders (DB query with JOIN)",
-			"POST /api/orders/create": "Create order (DB insert)",
-			"GET  /api/external":      "External HTTP call",
-			"GET  /api/chain":         "Chained service calls",
-			"GET  /api/slow":          "Slow endpoint (500ms)",
-			"GET  /api/error":         "Error endpoint (500)",
+			"GET  /health":             "Health check",
+			"GET  /api/users":          "List all users (DB query)",
+			"GET  /api/users/{id}":     "Get user by ID (DB query)",
+			"GET  /api/orders":         "List all orders (DB query with JOIN)",
+			"POST /api/orders/create":  "Create order (DB insert)",
+			"GET  /api/external":       "External HTTP call",
+			"GET  /api/external/reuse": "External HTTPS calls over a reused connection",
+			"GET  /api/grpc":           "gRPC call to the in-process health service",
+			"GET  /api/chain":          "Chained service calls",
+			"GET  /api/slow":           "Slow endpoint (500ms)",
+			"GET  /api/error":          "Error endpoint (500)",
 		},
-		"instrumentation": "eBPF (zero-code)",
-		"traces_include":  []string{"HTTP requests", "SQL queries", "External calls"},
+		"instrumentation": map[string]string{
+			"ebpf":   "eBPF (zero-code)",
+			"hybrid": "eBPF + manual spans (hybrid)",
+		}[instrumentationMode],
+		"traces_include": []string{"HTTP requests", "SQL queries", "External calls", "gRPC calls"},
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -214,6 +248,15 @@ func userByIDHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Cache-aside: a hit skips both queries below
+	cacheKey := "user:" + id
+	if cached, ok := cacheGet(r.Context(), cacheKey); ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Cache", cacheStatus(true))
+		w.Write(cached)
+		return
+	}
+
 	// eBPF will trace this query with parameter
 	var user User
 	err := db.QueryRow("SELECT id, name, email, created_at FROM users WHERE id = ?", id).
@@ -245,8 +288,12 @@ func userByIDHandler(w http.ResponseWriter, r *http.Request) {
 			"user":   user,
 			"orders": orders,
 		}
+		body, _ := json.Marshal(response)
+		cacheSet(r.Context(), cacheKey, body)
+
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(response)
+		w.Header().Set("X-Cache", cacheStatus(false))
+		w.Write(body)
 		return
 	}
 
@@ -308,25 +355,46 @@ func createOrderHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// In hybrid mode, the business attributes eBPF can't see. Started from
+	// the request's context, so the auto-instrumentation parents it under
+	// its server span, and the queries below, given ctx, under this span
+	ctx, span := tracer.Start(r.Context(), "order.create", trace.WithAttributes(
+		attribute.String("enduser.id", strconv.Itoa(input.UserID)),
+		attribute.String("order.product", input.Product),
+		attribute.Float64("order.value", input.Amount),
+		attribute.String("order.currency", "USD"),
+	))
+	defer span.End()
+
 	// Verify user exists - traced query
 	var userID int
-	err := db.QueryRow("SELECT id FROM users WHERE id = ?", input.UserID).Scan(&userID)
+	err := db.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ?", input.UserID).Scan(&userID)
 	if err == sql.ErrNoRows {
+		span.SetStatus(codes.Error, "user not found")
 		http.Error(w, "User not found", http.StatusNotFound)
 		return
 	}
 
 	// Insert order - traced query
-	result, err := db.Exec(
+	result, err := db.ExecContext(ctx,
 		"INSERT INTO orders (user_id, product, amount, status) VALUES (?, ?, ?, 'pending')",
 		input.UserID, input.Product, input.Amount,
 	)
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "insert order")
 		http.Error(w, fmt.Sprintf("Failed to create order: %v", err), http.StatusInternalServerError)
 		return
 	}
 
+	// The cached user lookup includes the user's orders
+	cacheDelete(ctx, "user:"+strconv.Itoa(input.UserID))
+
 	orderID, _ := result.LastInsertId()
+	span.SetAttributes(
+		attribute.Int64("order.id", orderID),
+		attribute.String("order.status", "pending"),
+	)
 
 	response := map[string]interface{}{
 		"message":  "Order created successfully",
@@ -364,27 +432,105 @@ func externalCallHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// externalClient is shared, so its connections are kept alive and reused
+// across requests, and negotiate HTTP/2 with servers that support it.
+var externalClient = &http.Client{
+	Timeout:   5 * time.Second,
+	Transport: http.DefaultTransport.(*http.Transport).Clone(),
+}
+
+func externalReuseHandler(w http.ResponseWriter, r *http.Request) {
+	calls, err := strconv.Atoi(r.URL.Query().Get("calls"))
+	if err != nil || calls < 1 {
+		calls = 3
+	}
+	calls = min(calls, 10)
+
+	// Sequential calls to the same host: the first one dials, the rest
+	// reuse its connection. eBPF traces each one as its own client span
+	type callResult struct {
+		Status     int    `json:"status"`
+		Proto      string `json:"proto"`
+		Reused     bool   `json:"reused"`
+		DurationMs int64  `json:"duration_ms"`
+		Error      string `json:"error,omitempty"`
+	}
+	results := make([]callResult, 0, calls)
+	for range calls {
+		var res callResult
+		trace := &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) { res.Reused = info.Reused },
+		}
+		ctx := httptrace.WithClientTrace(r.Context(), trace)
+		req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://httpbin.org/get", nil)
+
+		start := time.Now()
+		resp, err := externalClient.Do(req)
+		res.DurationMs = time.Since(start).Milliseconds()
+		if err != nil {
+			res.Error = err.Error()
+			results = append(results, res)
+			continue
+		}
+		// Drain the body, or the connection can't be reused
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		res.Status = resp.StatusCode
+		res.Proto = resp.Proto
+		results = append(results, res)
+	}
+
+	response := map[string]interface{}{
+		"message":      "External API calls completed",
+		"external_url": "https://httpbin.org/get",
+		"calls":        results,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 func chainedCallHandler(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	// In hybrid mode, one span for the statistics, with their values, and
+	// one for the exchange rate call
+	ctx, span := tracer.Start(r.Context(), "chain.stats")
+
 	// Step 1: Query database
 	var userCount int
-	db.QueryRow("SELECT COUNT(*) FROM users").Scan(&userCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&userCount)
 
 	// Step 2: Query orders
 	var orderCount int
-	db.QueryRow("SELECT COUNT(*) FROM orders").Scan(&orderCount)
+	db.QueryRowContext(ctx, "SELECT COUNT(*) FROM orders").Scan(&orderCount)
 
 	// Step 3: Calculate totals
 	var totalAmount float64
-	db.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM orders WHERE status = 'completed'").Scan(&totalAmount)
+	db.QueryRowContext(ctx, "SELECT COALESCE(SUM(amount), 0) FROM orders WHERE status = 'completed'").Scan(&totalAmount)
+
+	span.SetAttributes(
+		attribute.Int("stats.user_count", userCount),
+		attribute.Int("stats.order_count", orderCount),
+		attribute.Float64("stats.completed_total", totalAmount),
+	)
+	span.End()
 
 	// Step 4: External call for exchange rate (simulated)
+	ctx, span = tracer.Start(r.Context(), "chain.exchange_rate", trace.WithAttributes(
+		attribute.String("exchange_rate.currency_pair", "USD/EUR"),
+	))
 	client := &http.Client{Timeout: 3 * time.Second}
-	resp, _ := client.Get("https://httpbin.org/delay/1")
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, "https://httpbin.org/delay/1", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "exchange rate call failed")
+	}
 	if resp != nil {
 		resp.Body.Close()
 	}
+	span.End()
 
 	response := map[string]interface{}{
 		"message": "Chained operations completed",
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// cache is the Redis client for the cache-aside layer in front of user
+// lookups. It is nil when REDIS_ADDR isn't set, and caching is off.
+var cache *redis.Client
+
+var cacheTTL = 30 * time.Second
+
+// initCache connects to REDIS_ADDR, if set. An unreachable Redis isn't fatal:
+// lookups fall back to the database until it comes up.
+func initCache() {
+	addr := os.Getenv("REDIS_ADDR")
+	if addr == "" {
+		log.Println("REDIS_ADDR not set, caching disabled")
+		return
+	}
+	if v := os.Getenv("REDIS_TTL"); v != "" {
+		ttl, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("REDIS_TTL: %v", err)
+		}
+		cacheTTL = ttl
+	}
+
+	cache = redis.NewClient(&redis.Options{Addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := cache.Ping(ctx).Err(); err != nil {
+		log.Printf("Redis at %s not reachable yet: %v", addr, err)
+		return
+	}
+	log.Printf("Redis cache at %s, TTL %s", addr, cacheTTL)
+}
+
+// cacheGet returns the cached value for key. Errors count as misses.
+func cacheGet(ctx context.Context, key string) ([]byte, bool) {
+	if cache == nil {
+		return nil, false
+	}
+	val, err := cache.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("Redis GET %s: %v", key, err)
+		}
+		return nil, false
+	}
+	return val, true
+}
+
+func cacheSet(ctx context.Context, key string, val []byte) {
+	if cache == nil {
+		return
+	}
+	if err := cache.Set(ctx, key, val, cacheTTL).Err(); err != nil {
+		log.Printf("Redis SET %s: %v", key, err)
+	}
+}
+
+func cacheDelete(ctx context.Context, key string) {
+	if cache == nil {
+		return
+	}
+	if err := cache.Del(ctx, key).Err(); err != nil {
+		log.Printf("Redis DEL %s: %v", key, err)
+	}
+}
+
+// cacheStatus is the X-Cache header value for a lookup.
+func cacheStatus(hit bool) string {
+	switch {
+	case cache == nil:
+		return "disabled"
+	case hit:
+		return "hit"
+	default:
+		return "miss"
+	}
+}
@@ -0,0 +1,331 @@
+package last9
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Doer is implemented by *fasthttp.Client and *fasthttp.HostClient.
+type Doer interface {
+	Do(req *fasthttp.Request, resp *fasthttp.Response) error
+	DoTimeout(req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error
+	DoDeadline(req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error
+}
+
+// Client traces outbound requests made with a fasthttp client.
+//
+// fasthttp requests carry no context, so every method takes the parent
+// context explicitly:
+//
+//	client := last9.NewClient(&fasthttp.Client{})
+//	err := client.Do(ctx, req, resp)
+type Client struct {
+	doer        Doer
+	tracer      trace.Tracer
+	propagators propagation.TextMapPropagator
+	duration    metric.Float64Histogram
+}
+
+// NewClient instruments c. Connection metrics are collected by wrapping c's
+// dialer, so NewClient must be called before c makes its first request.
+func NewClient(c *fasthttp.Client, opts ...Option) *Client {
+	cfg := newClientConfig(opts)
+	m := newConnMetrics(cfg.MeterProvider)
+	if c.Dial != nil {
+		c.Dial = m.wrapDial(c.Dial)
+	} else {
+		c.DialTimeout = m.wrapDialTimeout(c.DialTimeout)
+	}
+	return newClient(c, cfg)
+}
+
+// NewHostClient instruments a HostClient. In addition to the metrics recorded
+// by NewClient, it reports the HostClient's pending request count.
+func NewHostClient(c *fasthttp.HostClient, opts ...Option) *Client {
+	cfg := newClientConfig(opts)
+	m := newConnMetrics(cfg.MeterProvider)
+	if c.Dial != nil {
+		c.Dial = m.wrapDial(c.Dial)
+	} else {
+		c.DialTimeout = m.wrapDialTimeout(c.DialTimeout)
+	}
+	m.observePending(c)
+	return newClient(c, cfg)
+}
+
+func newClientConfig(opts []Option) *Config {
+	cfg := &Config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	if cfg.TracerProvider == nil {
+		cfg.TracerProvider = otel.GetTracerProvider()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	if cfg.Propagators == nil {
+		cfg.Propagators = otel.GetTextMapPropagator()
+	}
+	return cfg
+}
+
+func newClient(doer Doer, cfg *Config) *Client {
+	meter := cfg.MeterProvider.Meter(ScopeName, metric.WithInstrumentationVersion(SemVersion()))
+	duration, err := meter.Float64Histogram("http.client.request.duration",
+		metric.WithDescription("Duration of HTTP client requests"),
+		metric.WithUnit("s"))
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return &Client{
+		doer: doer,
+		tracer: cfg.TracerProvider.Tracer(
+			ScopeName,
+			trace.WithInstrumentationVersion(SemVersion()),
+		),
+		propagators: cfg.Propagators,
+		duration:    duration,
+	}
+}
+
+// Do performs the request with a client span that is a child of the span in
+// ctx.
+func (c *Client) Do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.Do(req, resp)
+	})
+}
+
+// DoTimeout is Do with a timeout.
+func (c *Client) DoTimeout(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, timeout time.Duration) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.DoTimeout(req, resp, timeout)
+	})
+}
+
+// DoDeadline is Do with a deadline.
+func (c *Client) DoDeadline(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, deadline time.Time) error {
+	return c.do(ctx, req, resp, func() error {
+		return c.doer.DoDeadline(req, resp, deadline)
+	})
+}
+
+func (c *Client) do(ctx context.Context, req *fasthttp.Request, resp *fasthttp.Response, call func() error) error {
+	method := string(req.Header.Method())
+	attrs := httpClientAttributes(req)
+
+	ctx, span := c.tracer.Start(ctx, "HTTP "+method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attrs...),
+		trace.WithAttributes(semconv.URLFull(req.URI().String())),
+	)
+	defer span.End()
+
+	c.propagators.Inject(ctx, requestHeaderCarrier{h: &req.Header})
+
+	start := time.Now()
+	err := call()
+	elapsed := time.Since(start).Seconds()
+
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		errType := semconv.ErrorTypeKey.String(errorType(err))
+		span.SetAttributes(errType)
+		c.duration.Record(ctx, elapsed, metric.WithAttributes(append(attrs, errType)...))
+		return err
+	}
+
+	status := resp.StatusCode()
+	metricAttrs := append(attrs, semconv.HTTPResponseStatusCode(status))
+	span.SetAttributes(
+		semconv.HTTPResponseStatusCode(status),
+		semconv.HTTPResponseBodySize(len(resp.Body())),
+	)
+	// Only 4xx and 5xx are errors for a client span; 1xx-3xx leave the
+	// status unset.
+	if status >= 400 {
+		errType := semconv.ErrorTypeKey.String(strconv.Itoa(status))
+		span.SetStatus(codes.Error, "HTTP status code: "+strconv.Itoa(status))
+		span.SetAttributes(errType)
+		metricAttrs = append(metricAttrs, errType)
+	}
+	c.duration.Record(ctx, elapsed, metric.WithAttributes(metricAttrs...))
+	return nil
+}
+
+// httpClientAttributes returns the low-cardinality request attributes shared
+// by the span and the duration metric. url.full is added to the span only.
+func httpClientAttributes(req *fasthttp.Request) []attribute.KeyValue {
+	uri := req.URI()
+	attrs := []attribute.KeyValue{
+		semconv.HTTPRequestMethodKey.String(string(req.Header.Method())),
+	}
+	host, port := splitHostPort(string(uri.Host()), string(uri.Scheme()))
+	if host != "" {
+		attrs = append(attrs, semconv.ServerAddress(host))
+	}
+	if port > 0 {
+		attrs = append(attrs, semconv.ServerPort(port))
+	}
+	return attrs
+}
+
+func splitHostPort(hostport, scheme string) (string, int) {
+	host, portStr, err := net.SplitHostPort(hostport)
+	if err != nil {
+		host = hostport
+		switch scheme {
+		case "https":
+			return host, 443
+		case "http":
+			return host, 80
+		}
+		return host, 0
+	}
+	port, _ := strconv.Atoi(portStr)
+	return host, port
+}
+
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, fasthttp.ErrTimeout), errors.Is(err, fasthttp.ErrDialTimeout):
+		return "timeout"
+	case errors.Is(err, fasthttp.ErrNoFreeConns):
+		return "no_free_conns"
+	case errors.Is(err, fasthttp.ErrConnectionClosed):
+		return "connection_closed"
+	}
+	return "_OTHER"
+}
+
+// requestHeaderCarrier adapts fasthttp request headers to TextMapCarrier.
+type requestHeaderCarrier struct {
+	h *fasthttp.RequestHeader
+}
+
+func (c requestHeaderCarrier) Get(key string) string {
+	return string(c.h.Peek(key))
+}
+
+func (c requestHeaderCarrier) Set(key, value string) {
+	c.h.Set(key, value)
+}
+
+func (c requestHeaderCarrier) Keys() []string {
+	var keys []string
+	c.h.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+	return keys
+}
+
+// connMetrics tracks connections opened by a client's dialer.
+type connMetrics struct {
+	meter       metric.Meter
+	open        metric.Int64UpDownCounter
+	connections metric.Int64Counter
+	lifetime    metric.Float64Histogram
+}
+
+func newConnMetrics(mp metric.MeterProvider) *connMetrics {
+	m := &connMetrics{meter: mp.Meter(ScopeName, metric.WithInstrumentationVersion(SemVersion()))}
+
+	var err error
+	if m.open, err = m.meter.Int64UpDownCounter("http.client.open_connections",
+		metric.WithDescription("Number of connections currently open"),
+		metric.WithUnit("{connection}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.connections, err = m.meter.Int64Counter("fasthttp.client.dials",
+		metric.WithDescription("Number of connection attempts, by outcome"),
+		metric.WithUnit("{connection}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.lifetime, err = m.meter.Float64Histogram("http.client.connection.duration",
+		metric.WithDescription("Duration a connection stayed open"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+func (m *connMetrics) wrapDial(dial fasthttp.DialFunc) fasthttp.DialFunc {
+	return func(addr string) (net.Conn, error) {
+		conn, err := dial(addr)
+		return m.track(addr, conn, err)
+	}
+}
+
+func (m *connMetrics) wrapDialTimeout(dial fasthttp.DialFuncWithTimeout) fasthttp.DialFuncWithTimeout {
+	if dial == nil {
+		dial = fasthttp.DialTimeout
+	}
+	return func(addr string, timeout time.Duration) (net.Conn, error) {
+		conn, err := dial(addr, timeout)
+		return m.track(addr, conn, err)
+	}
+}
+
+func (m *connMetrics) track(addr string, conn net.Conn, err error) (net.Conn, error) {
+	ctx := context.Background()
+	host, port := splitHostPort(addr, "")
+	attrs := []attribute.KeyValue{semconv.ServerAddress(host), semconv.ServerPort(port)}
+
+	if err != nil {
+		m.connections.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("outcome", "error"))...))
+		return nil, err
+	}
+	m.connections.Add(ctx, 1, metric.WithAttributes(append(attrs, attribute.String("outcome", "ok"))...))
+	m.open.Add(ctx, 1, metric.WithAttributes(attrs...))
+	return &trackedConn{Conn: conn, metrics: m, attrs: attrs, opened: time.Now()}, nil
+}
+
+// observePending reports the number of requests waiting on a HostClient.
+func (m *connMetrics) observePending(c *fasthttp.HostClient) {
+	attrs := metric.WithAttributes(semconv.ServerAddress(c.Addr))
+	_, err := m.meter.Int64ObservableGauge("fasthttp.client.pending_requests",
+		metric.WithDescription("Requests in flight on the HostClient"),
+		metric.WithUnit("{request}"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(c.PendingRequests()), attrs)
+			return nil
+		}))
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// trackedConn records connection metrics when fasthttp closes the
+// connection, whether because it went idle or because the server closed it.
+type trackedConn struct {
+	net.Conn
+	metrics *connMetrics
+	attrs   []attribute.KeyValue
+	opened  time.Time
+	once    sync.Once
+}
+
+func (c *trackedConn) Close() error {
+	c.once.Do(func() {
+		ctx := context.Background()
+		c.metrics.open.Add(ctx, -1, metric.WithAttributes(c.attrs...))
+		c.metrics.lifetime.Record(ctx, time.Since(c.opened).Seconds(), metric.WithAttributes(c.attrs...))
+	})
+	return c.Conn.Close()
+}
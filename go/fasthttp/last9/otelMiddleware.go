@@ -1,18 +1,28 @@
 package last9
 
 import (
+	"context"
 	"fmt"
 	"net"
-	"regexp"
-	"strings"
-
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fasthttp/router"
+	"github.com/last9/opentelemetry-examples/go/common/pathnorm"
+	"github.com/last9/opentelemetry-examples/go/common/recovery"
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
 	"github.com/valyala/fasthttp"
 	"go.opentelemetry.io/otel/attribute"
 
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	// The metrics use the stable HTTP names, as the client's do
+	metricconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -22,9 +32,11 @@ const (
 	ScopeName = "go.opentelemetry.io/contrib/instrumentation/github.com/valyala/fasthttp/otelfasthttp"
 )
 
-// Config represents the configuration for the middleware.
+// Config represents the configuration for the middleware and the client.
+// Filters are only used by the middleware.
 type Config struct {
 	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
 	Propagators    propagation.TextMapPropagator
 	Filters        []Filter
 }
@@ -35,11 +47,33 @@ type Filter func(*fasthttp.RequestCtx) bool
 // Option is a function that can be used to configure the middleware.
 type Option func(*Config)
 
-// Middleware returns middleware that will trace incoming requests.
-// The service parameter should describe the name of the (virtual)
-// server handling the request.
-func OtelMiddleware(service string) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
+// OtelMiddleware returns middleware that will trace incoming requests and
+// record their duration and body sizes. The service parameter should
+// describe the name of the (virtual) server handling the request.
+//
+// A panic in a handler is recovered by the shared recovery package: the span
+// gets an exception event with the stack trace and status Error, the panic is
+// counted in panics_total, and the client gets a 500.
+//
+// Wrap a fasthttp/router Router with SaveMatchedRoutePath set, and spans and
+// metrics use the route the request matched, such as /users/{id}:
+//
+//	r := router.New()
+//	r.SaveMatchedRoutePath = true
+//	fasthttp.ListenAndServe(":8080", last9.OtelMiddleware("users")(r.Handler))
+//
+// The route is only known once the router has run, so the span is started
+// with the path normalized by pathnorm, and renamed after the handler
+// returns. Samplers see the normalized name. Requests that matched no route,
+// or that were served by another router, keep it, and their metrics have no
+// http.route.
+//
+// Handlers get the request's trace context from ContextFromRequest.
+func OtelMiddleware(service string, opts ...Option) func(fasthttp.RequestHandler) fasthttp.RequestHandler {
 	cfg := Config{}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
 	if cfg.TracerProvider == nil {
 		cfg.TracerProvider = otel.GetTracerProvider()
 	}
@@ -47,9 +81,16 @@ func OtelMiddleware(service string) func(fasthttp.RequestHandler) fasthttp.Reque
 		ScopeName,
 		trace.WithInstrumentationVersion(SemVersion()),
 	)
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	metrics := newServerMetrics(cfg.MeterProvider)
+	panics := recovery.New(cfg.MeterProvider)
 	if cfg.Propagators == nil {
 		cfg.Propagators = otel.GetTextMapPropagator()
 	}
+	// Spans are named by HTTP_SPAN_NAME_STRATEGY, "GET /users/{id}" by default
+	namer := spanname.FromEnv()
 	return func(next fasthttp.RequestHandler) fasthttp.RequestHandler {
 		return func(ctx *fasthttp.RequestCtx) {
 			for _, f := range cfg.Filters {
@@ -59,61 +100,252 @@ func OtelMiddleware(service string) func(fasthttp.RequestHandler) fasthttp.Reque
 					return
 				}
 			}
+			begin := time.Now()
 			ctx.SetUserValue(TracerKey, tracer)
 			carrier := fasthttpCarrier{ctx: ctx}
 			propagatedCtx := cfg.Propagators.Extract(ctx, carrier)
-			route := ctx.Path()
-			opts := []trace.SpanStartOption{
-				trace.WithAttributes(httpServerAttributes(service, ctx)...),
-				trace.WithSpanKind(trace.SpanKindServer),
+			// The router runs after this middleware, so the route isn't
+			// known yet; the normalized path stands in for it
+			method := methodString(ctx.Method())
+			path := string(ctx.Path())
+			normalized := pathnorm.Normalize(path)
+			legacy := normalized
+			if legacy == "" {
+				legacy = fmt.Sprintf("HTTP %s route not found", method)
 			}
-			spanName := normalizePath(string(route))
-			if spanName == "" {
-				spanName = fmt.Sprintf("HTTP %s route not found", string(ctx.Method()))
-			}
-			spanCtx, span := tracer.Start(propagatedCtx, spanName, opts...)
+			spanName, nameAttrs := namer.Name(spanname.Request{
+				Method: method,
+				Route:  normalized,
+				Target: path,
+				Legacy: legacy,
+			})
+
+			start := startPool.Get().(*spanStart)
+			start.attrs = appendServerAttributes(start.attrs, service, method, ctx)
+			start.attrs = append(start.attrs, nameAttrs...)
+			start.opts = append(start.opts, serverSpanKind, trace.WithAttributes(start.attrs...))
+			spanCtx, span := tracer.Start(propagatedCtx, spanName, start.opts...)
+			start.release()
 			defer span.End()
 
 			// Inject the span context back into the request headers
 			cfg.Propagators.Inject(spanCtx, carrier)
+			ctx.SetUserValue(spanContextKey, spanCtx)
 
-			// Call the next handler
-			next(ctx)
+			// Call the next handler. A panic is answered with a 500 instead of
+			// taking the server down
+			errType := serve(next, ctx, spanCtx, panics, method)
 
 			status := ctx.Response.StatusCode()
-			span.SetStatus(httpStatusCodeToSpanStatus(status))
-			if status > 0 {
-				span.SetAttributes(semconv.HTTPStatusCode(status))
+			if errType == "" && status >= fasthttp.StatusInternalServerError {
+				errType = strconv.Itoa(status)
+			}
+			responseSize, sized := responseBodySize(ctx)
+			route, matched := ctx.UserValue(router.MatchedRoutePathParam).(string)
+			// Formatting the status description and boxing the attributes
+			// allocate, so skip them for spans the sampler dropped
+			if span.IsRecording() {
+				if matched {
+					spanName, nameAttrs = namer.Name(spanname.Request{
+						Method: method,
+						Route:  route,
+						Target: path,
+						Legacy: legacy,
+					})
+					span.SetName(spanName)
+					span.SetAttributes(semconv.HTTPRoute(route))
+					span.SetAttributes(nameAttrs...)
+				}
+				span.SetStatus(httpStatusCodeToSpanStatus(status))
+				if status > 0 {
+					span.SetAttributes(semconv.HTTPStatusCode(status))
+				}
+				if sized {
+					span.SetAttributes(semconv.HTTPResponseBodySizeKey.Int(responseSize))
+				}
+				if errType != "" {
+					span.SetAttributes(metricconv.ErrorTypeKey.String(errType))
+				}
 			}
+
+			attrs := []attribute.KeyValue{
+				metricconv.HTTPRequestMethodKey.String(method),
+				metricconv.HTTPResponseStatusCode(status),
+				metricconv.URLScheme(schemeString(ctx.URI().Scheme())),
+			}
+			// Unmatched paths, such as scanners probing for files, would
+			// make a series each, so they get no route
+			if matched {
+				attrs = append(attrs, metricconv.HTTPRoute(route))
+			}
+			if errType != "" {
+				attrs = append(attrs, metricconv.ErrorTypeKey.String(errType))
+			}
+			metrics.record(spanCtx, time.Since(begin), ctx, responseSize, sized, metric.WithAttributes(attrs...))
 		}
 	}
 }
 
-// httpServerAttributes returns a set of span attributes for HTTP server requests
-func httpServerAttributes(service string, ctx *fasthttp.RequestCtx) []attribute.KeyValue {
-	attrs := []attribute.KeyValue{
-		semconv.ServiceNameKey.String(service),
-		semconv.HTTPMethodKey.String(string(ctx.Method())),
-		semconv.HTTPTargetKey.String(string(ctx.RequestURI())),
-		semconv.HTTPURLKey.String(ctx.URI().String()),
-		semconv.HTTPSchemeKey.String(string(ctx.URI().Scheme())),
+// serverMetrics are the metrics OtelMiddleware records for each request, as
+// otelhttp does. The count of the duration histogram is the number of
+// requests. An instrument that fails to be created is nil and not recorded.
+type serverMetrics struct {
+	duration     metric.Float64Histogram
+	requestSize  metric.Int64Histogram
+	responseSize metric.Int64Histogram
+}
+
+func newServerMetrics(mp metric.MeterProvider) *serverMetrics {
+	meter := mp.Meter(ScopeName, metric.WithInstrumentationVersion(SemVersion()))
+	m := &serverMetrics{}
+	var err error
+	if m.duration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
 	}
+	if m.requestSize, err = meter.Int64Histogram("http.server.request.body.size",
+		metric.WithDescription("Size of HTTP server request bodies"),
+		metric.WithUnit("By")); err != nil {
+		otel.Handle(err)
+	}
+	if m.responseSize, err = meter.Int64Histogram("http.server.response.body.size",
+		metric.WithDescription("Size of HTTP server response bodies"),
+		metric.WithUnit("By")); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
 
-	if host := string(ctx.Host()); host != "" {
-		attrs = append(attrs, semconv.ServerAddressKey.String(host))
+func (m *serverMetrics) record(spanCtx context.Context, elapsed time.Duration, ctx *fasthttp.RequestCtx, responseSize int, sized bool, attrs metric.RecordOption) {
+	if m.duration != nil {
+		m.duration.Record(spanCtx, elapsed.Seconds(), attrs)
+	}
+	// A request without Content-Length is streamed or empty: its size isn't
+	// known without reading it
+	if n := ctx.Request.Header.ContentLength(); n >= 0 && m.requestSize != nil {
+		m.requestSize.Record(spanCtx, int64(n), attrs)
+	}
+	if sized && m.responseSize != nil {
+		m.responseSize.Record(spanCtx, int64(responseSize), attrs)
 	}
+}
 
-	if ua := string(ctx.UserAgent()); ua != "" {
-		attrs = append(attrs, semconv.UserAgentOriginalKey.String(ua))
+// responseBodySize returns the size of the response body, or false if the
+// body is a stream of unknown length.
+func responseBodySize(ctx *fasthttp.RequestCtx) (int, bool) {
+	if !ctx.Response.IsBodyStream() {
+		return len(ctx.Response.Body()), true
+	}
+	if n := ctx.Response.Header.ContentLength(); n >= 0 {
+		return n, true
 	}
+	return 0, false
+}
 
-	if ctx.RemoteIP() != nil {
-		attrs = append(attrs, semconv.NetworkTypeIpv4.Key.String(ctx.RemoteIP().String()))
+// serve calls next, and recovers a panic in it. fasthttp doesn't recover
+// panics, so one would take the whole server down. The panic is recorded by
+// rec on the span in spanCtx as an exception event, with the stack of the
+// handler that panicked, and counted in panics_total; the client gets a 500.
+// serve returns the panic's exception type, for error.type, or "" if next
+// returned normally.
+func serve(next fasthttp.RequestHandler, ctx *fasthttp.RequestCtx, spanCtx context.Context, rec *recovery.Recorder, method string) (errType string) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		// The stack has to be taken here, while the handler's frames are
+		// still on it
+		stack := debug.Stack()
+		attrs := []attribute.KeyValue{metricconv.HTTPRequestMethodKey.String(method)}
+		// The router sets the route before calling the handler
+		if route, ok := ctx.UserValue(router.MatchedRoutePathParam).(string); ok {
+			attrs = append(attrs, metricconv.HTTPRoute(route))
+		}
+		errType = rec.Record(spanCtx, r, stack, attrs...)
+		ctx.Response.Reset()
+		ctx.Error(fasthttp.StatusMessage(fasthttp.StatusInternalServerError), fasthttp.StatusInternalServerError)
+	}()
+	next(ctx)
+	return ""
+}
+
+// ContextFromRequest returns the context of the request's server span, for
+// handlers to start spans under it. Outside OtelMiddleware, it returns ctx
+// itself: a RequestCtx is a context.Context, without a span.
+func ContextFromRequest(ctx *fasthttp.RequestCtx) context.Context {
+	if spanCtx, ok := ctx.UserValue(spanContextKey).(context.Context); ok {
+		return spanCtx
+	}
+	return ctx
+}
+
+// spanContextKey is the user value key ContextFromRequest reads.
+const spanContextKey = "last9.span_context"
+
+// serverSpanKind is allocated once rather than per request.
+var serverSpanKind = trace.WithSpanKind(trace.SpanKindServer)
+
+// spanStart holds the attributes and options a request's span is started
+// with. At tens of thousands of requests per second, allocating them for
+// every request shows up in GC time, so they're reused through startPool.
+// That is safe because the SDK copies the attributes into the span when it
+// starts; a TracerProvider that kept the slice would see it overwritten.
+type spanStart struct {
+	attrs []attribute.KeyValue
+	opts  []trace.SpanStartOption
+}
+
+var startPool = sync.Pool{
+	New: func() any {
+		return &spanStart{
+			attrs: make([]attribute.KeyValue, 0, 16),
+			opts:  make([]trace.SpanStartOption, 0, 2),
+		}
+	},
+}
+
+// release clears s, so pooled slices don't keep attribute values alive, and
+// puts it back in the pool.
+func (s *spanStart) release() {
+	clear(s.attrs)
+	clear(s.opts)
+	s.attrs = s.attrs[:0]
+	s.opts = s.opts[:0]
+	startPool.Put(s)
+}
+
+// appendServerAttributes appends the span attributes of an HTTP server
+// request to attrs. Values copied out of the request are strings the span
+// keeps, so they are allocated; the rest aren't.
+func appendServerAttributes(attrs []attribute.KeyValue, service, method string, ctx *fasthttp.RequestCtx) []attribute.KeyValue {
+	attrs = append(attrs,
+		semconv.ServiceNameKey.String(service),
+		semconv.HTTPMethodKey.String(method),
+		semconv.HTTPTargetKey.String(string(ctx.RequestURI())),
+		semconv.HTTPURLKey.String(string(ctx.URI().FullURI())),
+		semconv.HTTPSchemeKey.String(schemeString(ctx.URI().Scheme())),
+	)
+
+	if host := ctx.Host(); len(host) > 0 {
+		attrs = append(attrs, semconv.ServerAddressKey.String(string(host)))
+	}
+
+	if ua := ctx.UserAgent(); len(ua) > 0 {
+		attrs = append(attrs, semconv.UserAgentOriginalKey.String(string(ua)))
 	}
 
 	if remoteAddr, ok := ctx.RemoteAddr().(*net.TCPAddr); ok {
-		attrs = append(attrs, semconv.NetSockPeerAddrKey.String(remoteAddr.IP.String()))
-		attrs = append(attrs, semconv.NetSockPeerPortKey.Int(remoteAddr.Port))
+		if remoteAddr.IP.To4() != nil {
+			attrs = append(attrs, semconv.NetworkTypeIpv4)
+		} else {
+			attrs = append(attrs, semconv.NetworkTypeIpv6)
+		}
+		attrs = append(attrs,
+			semconv.NetSockPeerAddrKey.String(remoteAddr.IP.String()),
+			semconv.NetSockPeerPortKey.Int(remoteAddr.Port),
+		)
 	}
 
 	// Add content length if available
@@ -121,12 +353,39 @@ func httpServerAttributes(service string, ctx *fasthttp.RequestCtx) []attribute.
 		attrs = append(attrs, semconv.HTTPRequestContentLengthKey.Int(length))
 	}
 
-	// Add user agent if available
-	if userAgent := string(ctx.UserAgent()); userAgent != "" {
-		attrs = append(attrs, semconv.UserAgentOriginalKey.String(userAgent))
+	return attrs
+}
+
+// methodString returns the standard methods as constants, so they don't
+// allocate.
+func methodString(b []byte) string {
+	switch string(b) {
+	case fasthttp.MethodGet:
+		return fasthttp.MethodGet
+	case fasthttp.MethodPost:
+		return fasthttp.MethodPost
+	case fasthttp.MethodPut:
+		return fasthttp.MethodPut
+	case fasthttp.MethodPatch:
+		return fasthttp.MethodPatch
+	case fasthttp.MethodDelete:
+		return fasthttp.MethodDelete
+	case fasthttp.MethodHead:
+		return fasthttp.MethodHead
+	case fasthttp.MethodOptions:
+		return fasthttp.MethodOptions
 	}
+	return string(b)
+}
 
-	return attrs
+func schemeString(b []byte) string {
+	switch string(b) {
+	case "http":
+		return "http"
+	case "https":
+		return "https"
+	}
+	return string(b)
 }
 
 // fasthttpCarrier is a type that adapts fasthttp request to TextMapCarrier.
@@ -172,6 +431,15 @@ func WithTracerProvider(provider trace.TracerProvider) Option {
 	}
 }
 
+// WithMeterProvider specifies a meter provider to use for the client's
+// request and connection metrics. If none is specified, the global provider
+// is used.
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(cfg *Config) {
+		cfg.MeterProvider = provider
+	}
+}
+
 // WithPropagators specifies propagators to use for extracting
 // information from the HTTP requests. If none are specified, global
 // ones will be used.
@@ -194,34 +462,3 @@ func WithFilter(f Filter) Option {
 func SemVersion() string {
 	return "0.0.1"
 }
-
-func normalizePath(path string) string {
-	// Replace UUIDs
-	uuidRegex := regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
-	path = uuidRegex.ReplaceAllString(path, ":uuid")
-
-	// Replace numeric IDs
-	numericIDRegex := regexp.MustCompile(`/\d+(/|$)`)
-	path = numericIDRegex.ReplaceAllString(path, "/:id$1")
-
-	// Replace date patterns (YYYY-MM-DD)
-	dateRegex := regexp.MustCompile(`/\d{4}-\d{2}-\d{2}(/|$)`)
-	path = dateRegex.ReplaceAllString(path, "/:date$1")
-
-	// Replace timestamps (Unix epoch)
-	timestampRegex := regexp.MustCompile(`/\d{10,13}(/|$)`)
-	path = timestampRegex.ReplaceAllString(path, "/:timestamp$1")
-
-	// Replace GUIDs (without dashes)
-	guidRegex := regexp.MustCompile(`/[0-9a-fA-F]{32}(/|$)`)
-	path = guidRegex.ReplaceAllString(path, "/:guid$1")
-
-	// Replace language codes (e.g., en-US, fr, de-DE)
-	langRegex := regexp.MustCompile(`/[a-z]{2}(-[A-Z]{2})?(/|$)`)
-	path = langRegex.ReplaceAllString(path, "/:lang$1")
-
-	// Remove trailing slash if present
-	path = strings.TrimSuffix(path, "/")
-
-	return path
-}
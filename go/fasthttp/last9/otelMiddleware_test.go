@@ -0,0 +1,105 @@
+package last9
+
+import (
+	"net"
+	"testing"
+
+	"github.com/fasthttp/router"
+	"github.com/valyala/fasthttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// maxAllocs is the most allocations a request through OtelMiddleware may
+// take, without and with the router: 28 and 37 as measured by
+// BenchmarkOtelMiddleware, with room for a GC emptying the pool.
+// TestOtelMiddlewareAllocs fails when a change goes over it; lower it when a
+// change saves some.
+var maxAllocs = map[string]float64{
+	"handler": 30,
+	"router":  39,
+}
+
+// newBenchHandler returns the middleware around a handler that writes a
+// small body, with a sampling tracer provider and a meter provider that
+// aggregates but doesn't export. With withRouter, the handler is behind a
+// fasthttp/router that saves the matched route.
+func newBenchHandler(withRouter bool) fasthttp.RequestHandler {
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.AlwaysSample()))
+	mp := sdkmetric.NewMeterProvider(sdkmetric.WithReader(sdkmetric.NewManualReader()))
+	handler := func(ctx *fasthttp.RequestCtx) {
+		ctx.SetBodyString(`{"id":"42"}`)
+	}
+	if withRouter {
+		r := router.New()
+		r.SaveMatchedRoutePath = true
+		r.GET("/users/{id}", handler)
+		handler = r.Handler
+	}
+	return OtelMiddleware("bench",
+		WithTracerProvider(tp),
+		WithMeterProvider(mp),
+		WithPropagators(propagation.TraceContext{}),
+	)(handler)
+}
+
+// newBenchRequest returns a GET with a sampled traceparent header, as a
+// request from an instrumented client arrives.
+func newBenchRequest() *fasthttp.RequestCtx {
+	var req fasthttp.Request
+	req.Header.SetMethod(fasthttp.MethodGet)
+	req.SetRequestURI("http://localhost:8080/users/42")
+	req.Header.Set("User-Agent", "bench")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := &fasthttp.RequestCtx{}
+	ctx.Init(&req, &net.TCPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 52000}, nil)
+	return ctx
+}
+
+// serveBench serves ctx with h, and resets what the previous request left
+// on it.
+func serveBench(h fasthttp.RequestHandler, ctx *fasthttp.RequestCtx) {
+	ctx.Response.Reset()
+	ctx.ResetUserValues()
+	h(ctx)
+}
+
+// BenchmarkOtelMiddleware measures the middleware's per-request cost:
+//
+//	go test -run '^$' -bench OtelMiddleware -benchmem ./last9
+//
+// The request is reused, so only the middleware, the SDK and the router
+// allocate.
+func BenchmarkOtelMiddleware(b *testing.B) {
+	for _, bc := range []struct {
+		name   string
+		router bool
+	}{
+		{"handler", false},
+		{"router", true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			h := newBenchHandler(bc.router)
+			ctx := newBenchRequest()
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				serveBench(h, ctx)
+			}
+		})
+	}
+}
+
+func TestOtelMiddlewareAllocs(t *testing.T) {
+	for name, max := range maxAllocs {
+		h := newBenchHandler(name == "router")
+		ctx := newBenchRequest()
+		allocs := testing.AllocsPerRun(100, func() {
+			serveBench(h, ctx)
+		})
+		if allocs > max {
+			t.Errorf("%s: a request took %v allocations, want at most %v", name, allocs, max)
+		}
+	}
+}
@@ -1,145 +1,90 @@
 package users
 
 import (
-	"context"
 	"encoding/json"
-	"strconv"
+	"fasthttp_example/last9"
+	"fmt"
 
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 	"github.com/valyala/fasthttp"
-	"go.opentelemetry.io/otel/attribute"
-	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
+// UsersHandler adapts the shared users service to fasthttp.
 type UsersHandler struct {
-	controller *UsersController // Changed from UsersControllers to UsersController
-	tracer     oteltrace.Tracer
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController, t oteltrace.Tracer) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
-		tracer:     t,
+		service: s,
 	}
 }
 
 func (u *UsersHandler) GetUsers(ctx *fasthttp.RequestCtx) {
-	traceCtx, span := u.tracer.Start(context.Background(), "GetUsers")
-	defer span.End()
-
-	users, err := u.controller.GetUsers(traceCtx)
+	users, err := u.service.List(last9.ContextFromRequest(ctx))
 	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to fetch users"}`)
+		writeError(ctx, err)
 		return
 	}
-
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.SetContentType("application/json")
-	if err := json.NewEncoder(ctx).Encode(users); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to encode users"}`)
-	}
+	writeJSON(ctx, fasthttp.StatusOK, users)
 }
 
 func (u *UsersHandler) GetUser(ctx *fasthttp.RequestCtx) {
-	traceCtx, span := u.tracer.Start(context.Background(), "GetUser", oteltrace.WithAttributes(
-		attribute.String("user.id", string(ctx.QueryArgs().Peek("id"))),
-	))
-	defer span.End()
-
-	id := string(ctx.QueryArgs().Peek("id"))
-	user, err := u.controller.GetUser(traceCtx, id)
+	user, err := u.service.Get(last9.ContextFromRequest(ctx), pathID(ctx))
 	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
-		ctx.SetBodyString(`{"message": "User not found"}`)
+		writeError(ctx, err)
 		return
 	}
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.SetContentType("application/json")
-	if err := json.NewEncoder(ctx).Encode(user); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to encode user"}`)
-	}
+	writeJSON(ctx, fasthttp.StatusOK, user)
 }
 
 func (u *UsersHandler) CreateUser(ctx *fasthttp.RequestCtx) {
-	traceCtx, span := u.tracer.Start(context.Background(), "CreateUser")
-	defer span.End()
-
-	var newUser User
-	if err := json.Unmarshal(ctx.PostBody(), &newUser); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusBadRequest)
-		ctx.SetBodyString(`{"error": "Invalid input data"}`)
+	var in commonusers.CreateInput
+	if err := json.Unmarshal(ctx.PostBody(), &in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-
-	err := u.controller.CreateUser(traceCtx, &newUser)
+	user, err := u.service.Create(last9.ContextFromRequest(ctx), in)
 	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to create user"}`)
+		writeError(ctx, err)
 		return
 	}
-
-	ctx.SetStatusCode(fasthttp.StatusCreated)
+	writeJSON(ctx, fasthttp.StatusCreated, user)
 }
 
 func (u *UsersHandler) UpdateUser(ctx *fasthttp.RequestCtx) {
-	traceCtx, span := u.tracer.Start(context.Background(), "UpdateUser", oteltrace.WithAttributes(
-		attribute.String("user.id", string(ctx.QueryArgs().Peek("id"))),
-	))
-	defer span.End()
-
-	id := string(ctx.QueryArgs().Peek("id"))
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusBadRequest)
-		ctx.SetBodyString(`{"message": "Invalid ID"}`)
+	var in commonusers.UpdateInput
+	if err := json.Unmarshal(ctx.PostBody(), &in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-
-	var updateData struct {
-		Name string `json:"name"`
-	}
-	if err := json.Unmarshal(ctx.PostBody(), &updateData); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusBadRequest)
-		ctx.SetBodyString(`{"message": "Invalid input data"}`)
+	user, err := u.service.Update(last9.ContextFromRequest(ctx), pathID(ctx), in)
+	if err != nil {
+		writeError(ctx, err)
 		return
 	}
+	writeJSON(ctx, fasthttp.StatusOK, user)
+}
 
-	user := u.controller.UpdateUser(traceCtx, int(idInt), updateData.Name)
-	if user == nil {
-		ctx.SetStatusCode(fasthttp.StatusNotFound)
-		ctx.SetBodyString(`{"message": "User not found"}`)
+func (u *UsersHandler) DeleteUser(ctx *fasthttp.RequestCtx) {
+	if err := u.service.Delete(last9.ContextFromRequest(ctx), pathID(ctx)); err != nil {
+		writeError(ctx, err)
 		return
 	}
-
-	ctx.SetStatusCode(fasthttp.StatusOK)
-	ctx.SetContentType("application/json")
-	if err := json.NewEncoder(ctx).Encode(user); err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to encode user"}`)
-	}
+	ctx.SetStatusCode(fasthttp.StatusNoContent)
 }
 
-func (u *UsersHandler) DeleteUser(ctx *fasthttp.RequestCtx) {
-	traceCtx, span := u.tracer.Start(context.Background(), "DeleteUser", oteltrace.WithAttributes(
-		attribute.String("user.id", string(ctx.QueryArgs().Peek("id"))),
-	))
-	defer span.End()
+// pathID returns the {id} parameter set by fasthttp/router.
+func pathID(ctx *fasthttp.RequestCtx) string {
+	return fmt.Sprint(ctx.UserValue("id"))
+}
 
-	id := string(ctx.QueryArgs().Peek("id"))
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusBadRequest)
-		ctx.SetBodyString(`{"message": "Invalid ID"}`)
-		return
-	}
+func writeJSON(ctx *fasthttp.RequestCtx, status int, v any) {
+	ctx.SetStatusCode(status)
+	ctx.SetContentType("application/json")
+	json.NewEncoder(ctx).Encode(v)
+}
 
-	err = u.controller.DeleteUser(traceCtx, int(idInt))
-	if err != nil {
-		ctx.SetStatusCode(fasthttp.StatusInternalServerError)
-		ctx.SetBodyString(`{"error": "Failed to delete user"}`)
-		return
-	}
-	ctx.SetStatusCode(fasthttp.StatusNoContent)
+func writeError(ctx *fasthttp.RequestCtx, err error) {
+	writeJSON(ctx, commonusers.StatusCode(err), commonusers.ErrorBody(err))
 }
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	"github.com/last9/opentelemetry-examples/go/common/cloudcost"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// cloudCosts estimates the cost of Storage and Pub/Sub calls. It is nil, and
+// records nothing, unless CLOUD_COST_ESTIMATES is true.
+var cloudCosts = cloudcost.NewRecorderFromEnv()
+
+// recordCost puts est on span and counts it for the service and method, such
+// as "storage" and "objects.insert".
+func recordCost(ctx context.Context, span trace.Span, est cloudcost.Estimate, service, method string) {
+	cloudCosts.Record(ctx, span, est,
+		semconv.CloudProviderGCP,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+	)
+}
+
+// pubsubMessageSize is the billed size of a message: its data plus the keys
+// and values of its attributes.
+func pubsubMessageSize(data []byte, attrs map[string]string) int64 {
+	size := int64(len(data))
+	for k, v := range attrs {
+		size += int64(len(k) + len(v))
+	}
+	return size
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/last9/opentelemetry-examples/go/common/errclass"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/googleapi"
+)
+
+// cloudErrors classifies the errors of Storage, Pub/Sub and Content API
+// calls.
+var cloudErrors = errclass.NewRecorder(googleAPIReason)
+
+// googleAPIReason classifies JSON API errors by their errors[].reason, which
+// tells a 403 for a used-up quota from a 403 for missing permissions, and
+// by their status code when no reason is known.
+func googleAPIReason(err error) (errclass.Category, bool) {
+	var apiErr *googleapi.Error
+	if !errors.As(err, &apiErr) {
+		return "", false
+	}
+	for _, item := range apiErr.Errors {
+		if c, ok := errclass.FromReason(item.Reason); ok {
+			return c, true
+		}
+	}
+	if apiErr.Code >= 400 {
+		return errclass.FromHTTPStatus(apiErr.Code), true
+	}
+	return "", false
+}
+
+// recordCloudError sets error.category on span and counts the error for the
+// service and method, such as "pubsub" and "Publish".
+func recordCloudError(ctx context.Context, span trace.Span, err error, service, method string) errclass.Category {
+	return cloudErrors.Record(ctx, span, err,
+		semconv.CloudProviderGCP,
+		semconv.RPCService(service),
+		semconv.RPCMethod(method),
+	)
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"context"
 	"fmt"
+	"io"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 	"time"
@@ -11,10 +13,15 @@ import (
 	"cloud.google.com/go/pubsub"
 	"cloud.google.com/go/storage"
 	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/cloudcost"
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
 	"go.opentelemetry.io/contrib/detectors/gcp"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
@@ -39,44 +46,45 @@ func getServiceName() string {
 	return serviceName
 }
 
-func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
-	serviceName := getServiceName()
-	exporter, err := otlptracehttp.New(ctx)
-	if err != nil {
-		log.Fatalf("failed to create otlp http exporter: %v", err)
+func getProjectID() string {
+	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
+	if projectID == "" {
+		projectID = "demo-project"
 	}
+	return projectID
+}
 
-	// Use GCP resource detector if running on GCP, otherwise fallback to basic resource
-	var res *resource.Resource
+// newResource describes this service. It uses the GCP resource detector when
+// running on GCP, and a basic resource otherwise.
+func newResource(ctx context.Context) *resource.Resource {
+	serviceName := getServiceName()
+	opts := []resource.Option{
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithOS(),
+		resource.WithContainer(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+	}
 	if os.Getenv("GOOGLE_CLOUD_PROJECT") != "" && os.Getenv("STORAGE_EMULATOR_HOST") == "" {
-		res, err = resource.New(ctx,
-			resource.WithDetectors(gcp.NewDetector()),
-			resource.WithFromEnv(),
-			resource.WithTelemetrySDK(),
-			resource.WithProcess(),
-			resource.WithOS(),
-			resource.WithContainer(),
-			resource.WithHost(),
-			resource.WithAttributes(
-				semconv.ServiceNameKey.String(serviceName),
-			),
-		)
-	} else {
-		res, err = resource.New(ctx,
-			resource.WithFromEnv(),
-			resource.WithTelemetrySDK(),
-			resource.WithProcess(),
-			resource.WithOS(),
-			resource.WithContainer(),
-			resource.WithHost(),
-			resource.WithAttributes(
-				semconv.ServiceNameKey.String(serviceName),
-			),
-		)
+		opts = append([]resource.Option{resource.WithDetectors(gcp.NewDetector())}, opts...)
 	}
+
+	res, err := resource.New(ctx, opts...)
 	if err != nil {
 		log.Fatalf("failed to create resource: %v", err)
 	}
+	return res
+}
+
+func initTracerProvider(ctx context.Context, res *resource.Resource) *sdktrace.TracerProvider {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp http exporter: %v", err)
+	}
 
 	tp := sdktrace.NewTracerProvider(
 		sdktrace.WithBatcher(exporter),
@@ -89,6 +97,21 @@ func initTracerProvider(ctx context.Context) *sdktrace.TracerProvider {
 	return tp
 }
 
+func initMeterProvider(ctx context.Context, res *resource.Resource) *sdkmetric.MeterProvider {
+	exporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp metric http exporter: %v", err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetMeterProvider(mp)
+	return mp
+}
+
 func newGCPClients(ctx context.Context) (*storage.Client, *pubsub.Client) {
 	var opts []option.ClientOption
 
@@ -96,6 +119,11 @@ func newGCPClients(ctx context.Context) (*storage.Client, *pubsub.Client) {
 	if storageHost := os.Getenv("STORAGE_EMULATOR_HOST"); storageHost != "" {
 		opts = append(opts, option.WithEndpoint("http://"+storageHost+"/storage/v1/"))
 		opts = append(opts, option.WithoutAuthentication())
+		if rate := uploadFailureRate(); rate > 0 {
+			opts = append(opts, option.WithHTTPClient(&http.Client{
+				Transport: &flakyTransport{base: http.DefaultTransport, failureRate: rate},
+			}))
+		}
 	}
 
 	storageClient, err := storage.NewClient(ctx, opts...)
@@ -111,12 +139,7 @@ func newGCPClients(ctx context.Context) (*storage.Client, *pubsub.Client) {
 		pubsubOpts = append(pubsubOpts, option.WithoutAuthentication())
 	}
 
-	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
-	if projectID == "" {
-		projectID = "demo-project"
-	}
-
-	pubsubClient, err := pubsub.NewClient(ctx, projectID, pubsubOpts...)
+	pubsubClient, err := pubsub.NewClient(ctx, getProjectID(), pubsubOpts...)
 	if err != nil {
 		log.Fatalf("failed to create pubsub client: %v", err)
 	}
@@ -205,6 +228,7 @@ func createPromotion(ctx context.Context, merchantID int64, tracer trace.Tracer)
 	if err != nil {
 		span.RecordError(err)
 		span.SetAttributes(semconv.HTTPResponseStatusCodeKey.Int(400))
+		recordCloudError(ctx, span, err, "content", "promotions.create")
 		return nil, fmt.Errorf("content.promotions.create call failed: %w", err)
 	}
 
@@ -233,23 +257,59 @@ func demo(ctx context.Context, bucket, objectName, topicName, subscriptionName s
 	storageSpanCtx := trace.SpanContextFromContext(storageCtx)
 	log.Printf("Storage trace ID: %s, Span ID: %s", storageSpanCtx.TraceID().String(), storageSpanCtx.SpanID().String())
 	
+	storageEvents := storageEventsConfigFromEnv()
+	if storageEvents.enabled() {
+		if err := ensureBucketNotification(storageCtx, storageClient, bucket, storageEvents); err != nil {
+			storageSpan.RecordError(err)
+			recordCloudError(storageCtx, storageSpan, err, "storage", "notifications")
+			storageSpan.End()
+			return fmt.Errorf("bucket notification setup failed: %w", err)
+		}
+	}
+
 	bucketHandle := storageClient.Bucket(bucket)
 	objectHandle := bucketHandle.Object(objectName)
 	
 	writer := objectHandle.NewWriter(storageCtx)
+	// Storage notifications carry no trace context. Store it in the object
+	// metadata, which the notification payload includes
+	writer.Metadata = map[string]string{}
+	otel.GetTextMapPropagator().Inject(storageCtx, propagation.MapCarrier(writer.Metadata))
 	if _, err := writer.Write([]byte("hello from otel gcp example")); err != nil {
 		writer.Close()
 		storageSpan.RecordError(err)
+		recordCloudError(storageCtx, storageSpan, err, "storage", "objects.insert")
 		storageSpan.End()
 		return fmt.Errorf("storage write failed: %w", err)
 	}
 	if err := writer.Close(); err != nil {
 		storageSpan.RecordError(err)
+		recordCloudError(storageCtx, storageSpan, err, "storage", "objects.insert")
 		storageSpan.End()
 		return fmt.Errorf("storage close failed: %w", err)
 	}
+	objectAttrs := writer.Attrs()
+	storageSpan.SetAttributes(
+		attribute.String("gcp.gcs.bucket", bucket),
+		attribute.String("gcp.gcs.object", objectName),
+		attribute.Int64("gcp.gcs.object.generation", objectAttrs.Generation),
+	)
+	recordCost(storageCtx, storageSpan, cloudcost.GCS("objects.insert", 1), "storage", "objects.insert")
 	storageSpan.End()
 
+	// Large object: resumable upload with a span per chunk
+	if largeUpload := largeUploadConfigFromEnv(); largeUpload.Size > 0 {
+		if err := uploadLargeObject(ctx, tracer, storageClient, bucket, "large-"+objectName, largeUpload); err != nil {
+			return err
+		}
+	}
+
+	if storageEvents.enabled() {
+		if err := publishFinalizeShim(ctx, pubsubClient, storageEvents.Topic, objectAttrs); err != nil {
+			return err
+		}
+	}
+
 	// Pub/Sub Publish: inject trace context for downstream correlation
 	publishCtx, publishSpan := tracer.Start(ctx, "publish message to Pub/Sub", trace.WithSpanKind(trace.SpanKindProducer))
 	publishSpan.SetAttributes(
@@ -266,9 +326,11 @@ func demo(ctx context.Context, bucket, objectName, topicName, subscriptionName s
 	result := topic.Publish(publishCtx, msg)
 	if _, err := result.Get(publishCtx); err != nil {
 		publishSpan.RecordError(err)
+		recordCloudError(publishCtx, publishSpan, err, "pubsub", "Publish")
 		publishSpan.End()
 		return fmt.Errorf("pubsub publish failed: %w", err)
 	}
+	recordCost(publishCtx, publishSpan, cloudcost.PubSub(pubsubMessageSize(msg.Data, msg.Attributes)), "pubsub", "Publish")
 	publishSpan.End()
 
 	// Pub/Sub Subscribe: receive message and extract context
@@ -288,6 +350,7 @@ func demo(ctx context.Context, bucket, objectName, topicName, subscriptionName s
 		// Extract trace context from message
 		msgCtx := extractFromPubSub(ctx, msg)
 		msgCtx, span := tracer.Start(msgCtx, "process Pub/Sub message", trace.WithSpanKind(trace.SpanKindConsumer))
+		recordCost(msgCtx, span, cloudcost.PubSub(pubsubMessageSize(msg.Data, msg.Attributes)), "pubsub", "StreamingPull")
 		
 		// Simulate work
 		time.Sleep(50 * time.Millisecond)
@@ -299,24 +362,42 @@ func demo(ctx context.Context, bucket, objectName, topicName, subscriptionName s
 
 	if err != nil && !strings.Contains(err.Error(), "context deadline exceeded") {
 		subscribeSpan.RecordError(err)
+		recordCloudError(subscribeCtx, subscribeSpan, err, "pubsub", "StreamingPull")
 		subscribeSpan.End()
 		return fmt.Errorf("pubsub receive failed: %w", err)
 	}
 	subscribeSpan.End()
 
+	// Storage events: process the OBJECT_FINALIZE notification for the upload
+	if storageEvents.enabled() {
+		if err := consumeStorageEvents(ctx, pubsubClient, tracer, storageEvents.Subscription, bucket, objectName, objectAttrs.Generation); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
-// TracingMiddleware creates a span for each inbound HTTP request
+// TracingMiddleware creates a span for each inbound HTTP request. Spans are
+// named by HTTP_SPAN_NAME_STRATEGY, "POST /demo" by default; see the
+// spanname package.
 func TracingMiddleware() gin.HandlerFunc {
+	namer := spanname.FromEnv()
 	return func(c *gin.Context) {
 		tracer := otel.Tracer(getServiceName())
-		spanName := fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path)
+		// Spans used to be named by the raw path, kept as http.span_name.legacy
+		spanName, nameAttrs := namer.Name(spanname.Request{
+			Method: c.Request.Method,
+			Route:  c.FullPath(),
+			Target: c.Request.URL.Path,
+			Legacy: fmt.Sprintf("%s %s", c.Request.Method, c.Request.URL.Path),
+		})
 
 		ctx, span := tracer.Start(
 			c.Request.Context(),
 			spanName,
 			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(nameAttrs...),
 		)
 		defer span.End()
 
@@ -346,6 +427,14 @@ type promotionRequest struct {
 	MerchantID int64 `json:"merchant_id"`
 }
 
+type promotionBatchRequest struct {
+	MerchantID int64 `json:"merchant_id"`
+	// Count is the number of promotions to create.
+	Count int `json:"count"`
+	// InvalidEntries is how many of them the API should reject.
+	InvalidEntries int `json:"invalid_entries"`
+}
+
 func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 	r := gin.Default()
 	r.Use(TracingMiddleware())
@@ -396,6 +485,12 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 			c.JSON(500, gin.H{"error": fmt.Sprintf("failed to create emulator resources: %v", err)})
 			return
 		}
+		if storageEvents := storageEventsConfigFromEnv(); storageEvents.enabled() {
+			if err := createEmulatorResources(c.Request.Context(), bucket, storageEvents.Topic, storageEvents.Subscription); err != nil {
+				c.JSON(500, gin.H{"error": fmt.Sprintf("failed to create storage event resources: %v", err)})
+				return
+			}
+		}
 
 		tracer := tp.Tracer(getServiceName())
 		if err := demo(c.Request.Context(), bucket, objectName, topicName, subscriptionName, tracer); err != nil {
@@ -446,6 +541,45 @@ func startServer(ctx context.Context, tp *sdktrace.TracerProvider) error {
 		})
 	})
 
+	r.POST("/promotions/batch", func(c *gin.Context) {
+		req := promotionBatchRequest{Count: 12, InvalidEntries: 2}
+		if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+			c.JSON(400, gin.H{"error": "invalid request body"})
+			return
+		}
+		if req.Count <= 0 || req.InvalidEntries < 0 || req.InvalidEntries > req.Count {
+			c.JSON(400, gin.H{"error": "count must be positive and invalid_entries between 0 and count"})
+			return
+		}
+		merchantID := req.MerchantID
+		if merchantID == 0 {
+			merchantID = merchantIDFromEnv()
+		}
+
+		tracer := tp.Tracer(getServiceName())
+		results, err := createPromotionsBatch(c.Request.Context(), tracer, merchantID, demoPromotions(req.Count, req.InvalidEntries), promotionBatchConfigFromEnv())
+		if err != nil {
+			c.JSON(500, gin.H{"error": err.Error()})
+			return
+		}
+
+		created := 0
+		for _, r := range results {
+			if r.Outcome == entryOutcomeCreated {
+				created++
+			}
+		}
+		// 200 even with failed entries: as with custombatch, the outcome of
+		// each entry is in the body
+		c.JSON(200, gin.H{
+			"status":      "ok",
+			"merchant_id": merchantID,
+			"created":     created,
+			"failed":      len(results) - created,
+			"entries":     results,
+		})
+	})
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -508,15 +642,27 @@ func setupEmulatorResources(ctx context.Context) error {
 	topicName := os.Getenv("PUBSUB_TOPIC")
 	subscriptionName := os.Getenv("PUBSUB_SUBSCRIPTION")
 
-	return createEmulatorResources(ctx, bucket, topicName, subscriptionName)
+	if err := createEmulatorResources(ctx, bucket, topicName, subscriptionName); err != nil {
+		return err
+	}
+
+	// The storage notification topic and subscription, when configured
+	storageEvents := storageEventsConfigFromEnv()
+	if !storageEvents.enabled() {
+		return nil
+	}
+	return createEmulatorResources(ctx, bucket, storageEvents.Topic, storageEvents.Subscription)
 }
 
 func main() {
 	ctx := context.Background()
 
-	tp := initTracerProvider(ctx)
+	res := newResource(ctx)
+	tp := initTracerProvider(ctx, res)
+	mp := initMeterProvider(ctx, res)
 	defer func() {
 		_ = tp.Shutdown(context.Background())
+		_ = mp.Shutdown(context.Background())
 	}()
 
 	// Setup emulator resources if needed
@@ -531,6 +677,13 @@ func main() {
 		return
 	}
 
+	if os.Getenv("RUN_WORKER") == "true" {
+		if err := runWorker(ctx, tp); err != nil {
+			log.Fatalf("worker error: %v", err)
+		}
+		return
+	}
+
 	// One-shot CLI demo mode
 	bucket := mustGetenv("GCS_BUCKET")
 	objectName := os.Getenv("GCS_OBJECT_NAME")
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/errclass"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/content/v2.1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+)
+
+// Outcomes of a batch entry, on the promotion.entry event and the entries
+// counter.
+const (
+	entryOutcomeCreated = "created"
+	entryOutcomeFailed  = "failed"
+)
+
+const defaultMerchantID = 123456789
+
+// promotionBatchConfig controls batch promotion creation.
+type promotionBatchConfig struct {
+	// BatchSize is the most entries sent together.
+	BatchSize int
+	// MaxAttempts is the most attempts per entry, counting the first.
+	MaxAttempts int
+	// MaxRetryWait caps the wait before a retry, including a Retry-After
+	// sent by the API.
+	MaxRetryWait time.Duration
+	// MockQuotaRate is the fraction of mock requests that fail with a quota
+	// error. It applies only without credentials.
+	MockQuotaRate float64
+}
+
+func promotionBatchConfigFromEnv() promotionBatchConfig {
+	cfg := promotionBatchConfig{
+		BatchSize:     10,
+		MaxAttempts:   4,
+		MaxRetryWait:  getEnvDuration("PROMOTION_MAX_RETRY_WAIT", 30*time.Second),
+		MockQuotaRate: 0.2,
+	}
+	if n, err := strconv.Atoi(os.Getenv("PROMOTION_BATCH_SIZE")); err == nil && n > 0 {
+		cfg.BatchSize = n
+	}
+	if n, err := strconv.Atoi(os.Getenv("PROMOTION_MAX_ATTEMPTS")); err == nil && n > 0 {
+		cfg.MaxAttempts = n
+	}
+	if r, err := strconv.ParseFloat(os.Getenv("PROMOTION_MOCK_QUOTA_RATE"), 64); err == nil {
+		cfg.MockQuotaRate = r
+	}
+	return cfg
+}
+
+// merchantIDFromEnv returns GOOGLE_MERCHANT_ID, or the demo merchant ID.
+func merchantIDFromEnv() int64 {
+	if id, err := strconv.ParseInt(os.Getenv("GOOGLE_MERCHANT_ID"), 10, 64); err == nil {
+		return id
+	}
+	return defaultMerchantID
+}
+
+// promotionEntryResult is the outcome of one batch entry, as a custombatch
+// response entry would report it.
+type promotionEntryResult struct {
+	BatchID     int    `json:"batch_id"`
+	PromotionID string `json:"promotion_id"`
+	Outcome     string `json:"outcome"`
+	Attempts    int    `json:"attempts"`
+	Error       string `json:"error,omitempty"`
+	// ErrorCategory is the errclass category of Error.
+	ErrorCategory errclass.Category `json:"error_category,omitempty"`
+
+	errCode   int
+	errReason string
+}
+
+// promotionBatchTelemetry holds the batch instruments.
+type promotionBatchTelemetry struct {
+	entries         metric.Int64Counter
+	partialFailures metric.Int64Counter
+	quotaRetries    metric.Int64Counter
+}
+
+func newPromotionBatchTelemetry() (*promotionBatchTelemetry, error) {
+	meter := otel.Meter(getServiceName())
+
+	entries, err := meter.Int64Counter("content.promotions.batch.entries",
+		metric.WithDescription("Promotion batch entries by outcome"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	partialFailures, err := meter.Int64Counter("content.promotions.batch.partial_failures",
+		metric.WithDescription("Promotion batches where some entries failed and others were created"),
+		metric.WithUnit("{batch}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	quotaRetries, err := meter.Int64Counter("content.promotions.quota_retries",
+		metric.WithDescription("Promotion entries retried after a quota error"),
+		metric.WithUnit("{retry}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &promotionBatchTelemetry{entries: entries, partialFailures: partialFailures, quotaRetries: quotaRetries}, nil
+}
+
+// newContentService returns a Content API service. Without credentials it
+// sends requests to mockContentTransport instead of the API, so the batch
+// path, including error parsing and retries, runs the real client code.
+func newContentService(ctx context.Context, cfg promotionBatchConfig) (*content.APIService, bool, error) {
+	if os.Getenv("GOOGLE_APPLICATION_CREDENTIALS") == "" {
+		service, err := content.NewService(ctx, option.WithHTTPClient(&http.Client{
+			Transport: &mockContentTransport{quotaRate: cfg.MockQuotaRate},
+		}))
+		return service, true, err
+	}
+	service, err := content.NewService(ctx)
+	return service, false, err
+}
+
+// createPromotionsBatch creates promotions in batches of cfg.BatchSize.
+//
+// Promotions have no custombatch method in Content API v2.1, so each batch
+// sends its entries as concurrent promotions.create calls, and reports them
+// the way custombatch does: every entry gets its own outcome, and a batch
+// succeeds even when some of its entries fail. Each batch is a span with a
+// promotion.entry event per entry.
+func createPromotionsBatch(ctx context.Context, tracer trace.Tracer, merchantID int64, promotions []*content.Promotion, cfg promotionBatchConfig) ([]promotionEntryResult, error) {
+	telemetry, err := newPromotionBatchTelemetry()
+	if err != nil {
+		return nil, fmt.Errorf("create batch telemetry: %w", err)
+	}
+	service, mock, err := newContentService(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create content service: %w", err)
+	}
+	if mock {
+		log.Println("No credentials found, sending promotions to the mock Content API")
+	}
+
+	results := make([]promotionEntryResult, 0, len(promotions))
+	for start, index := 0, 0; start < len(promotions); start, index = start+cfg.BatchSize, index+1 {
+		end := min(start+cfg.BatchSize, len(promotions))
+		results = append(results, sendPromotionBatch(ctx, tracer, telemetry, service, merchantID, promotions[start:end], start, index, mock, cfg)...)
+	}
+	return results, nil
+}
+
+// sendPromotionBatch sends one batch. batchIDBase is the batch ID of its
+// first entry, so batch IDs are unique across batches.
+func sendPromotionBatch(ctx context.Context, tracer trace.Tracer, telemetry *promotionBatchTelemetry, service *content.APIService, merchantID int64, promotions []*content.Promotion, batchIDBase, index int, mock bool, cfg promotionBatchConfig) []promotionEntryResult {
+	ctx, span := tracer.Start(ctx, "content.promotions.batch", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.Int64("content.merchant_id", merchantID),
+		attribute.Int("content.batch.index", index),
+		attribute.Int("content.batch.size", len(promotions)),
+		attribute.Bool("content.mock", mock),
+	)
+
+	results := make([]promotionEntryResult, len(promotions))
+	var wg sync.WaitGroup
+	for i, promotion := range promotions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = createPromotionEntry(ctx, span, telemetry, service, merchantID, batchIDBase+i, promotion, cfg)
+		}()
+	}
+	wg.Wait()
+
+	// Events are added after all entries finish, so they are in batch ID order
+	created, failed := 0, 0
+	for _, r := range results {
+		attrs := []attribute.KeyValue{
+			attribute.Int("content.batch.entry.batch_id", r.BatchID),
+			attribute.String("content.promotion.id", r.PromotionID),
+			attribute.String("content.batch.entry.outcome", r.Outcome),
+			attribute.Int("content.batch.entry.attempts", r.Attempts),
+		}
+		if r.Outcome == entryOutcomeCreated {
+			created++
+		} else {
+			failed++
+			attrs = append(attrs,
+				attribute.Int("content.batch.entry.error.code", r.errCode),
+				attribute.String("content.batch.entry.error.reason", r.errReason),
+				attribute.String("content.batch.entry.error.message", r.Error),
+				errclass.AttributeKey.String(string(r.ErrorCategory)),
+			)
+		}
+		span.AddEvent("promotion.entry", trace.WithAttributes(attrs...))
+		telemetry.entries.Add(ctx, 1, metric.WithAttributes(attribute.String("content.batch.entry.outcome", r.Outcome)))
+	}
+
+	partial := created > 0 && failed > 0
+	span.SetAttributes(
+		attribute.Int("content.batch.created", created),
+		attribute.Int("content.batch.failed", failed),
+		attribute.Bool("content.batch.partial_failure", partial),
+	)
+	switch {
+	case partial:
+		telemetry.partialFailures.Add(ctx, 1)
+	case failed > 0:
+		// Only a batch where nothing was created is an error; a partial
+		// failure is reported per entry
+		span.SetStatus(codes.Error, "all batch entries failed")
+	}
+	log.Printf("Promotion batch %d: %d created, %d failed", index, created, failed)
+	return results
+}
+
+// createPromotionEntry creates one promotion, retrying quota errors after the
+// wait the API asks for.
+func createPromotionEntry(ctx context.Context, batchSpan trace.Span, telemetry *promotionBatchTelemetry, service *content.APIService, merchantID int64, batchID int, promotion *content.Promotion, cfg promotionBatchConfig) promotionEntryResult {
+	result := promotionEntryResult{BatchID: batchID, PromotionID: promotion.Id}
+	for {
+		result.Attempts++
+		_, err := service.Promotions.Create(merchantID, promotion).Context(ctx).Do()
+		if err == nil {
+			result.Outcome = entryOutcomeCreated
+			result.Error, result.errCode, result.errReason, result.ErrorCategory = "", 0, "", ""
+			return result
+		}
+
+		result.Outcome = entryOutcomeFailed
+		result.Error = err.Error()
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) {
+			result.errCode = apiErr.Code
+			result.Error = apiErr.Message
+			if len(apiErr.Errors) > 0 {
+				result.errReason = apiErr.Errors[0].Reason
+			}
+		}
+		result.ErrorCategory = cloudErrors.Classify(err)
+		if !isQuotaError(result.ErrorCategory) || apiErr == nil || result.Attempts >= cfg.MaxAttempts {
+			return result
+		}
+
+		wait, source := retryWait(apiErr, result.Attempts, cfg.MaxRetryWait)
+		batchSpan.AddEvent("promotion.entry.retry", trace.WithAttributes(
+			attribute.Int("content.batch.entry.batch_id", batchID),
+			attribute.Int("content.batch.entry.attempt", result.Attempts),
+			attribute.String("content.batch.entry.error.reason", result.errReason),
+			errclass.AttributeKey.String(string(result.ErrorCategory)),
+			attribute.Float64("content.retry.wait", wait.Seconds()),
+			attribute.String("content.retry.wait_source", source),
+		))
+		telemetry.quotaRetries.Add(ctx, 1)
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			result.Error = ctx.Err().Error()
+			return result
+		}
+	}
+}
+
+// isQuotaError reports whether an error of category c is a quota or rate
+// limit error: a 429, or a 403 with a quota or rate limit reason.
+func isQuotaError(c errclass.Category) bool {
+	return c == errclass.Throttled || c == errclass.Quota
+}
+
+// retryWait returns how long to wait before retrying, and where the wait came
+// from. A Retry-After header, in seconds or as an HTTP date, wins over
+// exponential backoff. Either is capped at maxWait.
+func retryWait(err *googleapi.Error, attempt int, maxWait time.Duration) (time.Duration, string) {
+	wait, source := time.Second<<(attempt-1), "backoff"
+	if v := err.Header.Get("Retry-After"); v != "" {
+		if secs, parseErr := strconv.Atoi(v); parseErr == nil {
+			wait, source = time.Duration(secs)*time.Second, "retry_after"
+		} else if at, parseErr := http.ParseTime(v); parseErr == nil {
+			wait, source = time.Until(at), "retry_after"
+		}
+	}
+	return max(min(wait, maxWait), 0), source
+}
+
+// demoPromotions returns count promotions. The first invalid of them have no
+// long title, which the API rejects, so a batch shows a partial failure.
+func demoPromotions(count, invalid int) []*content.Promotion {
+	now := time.Now()
+	promotions := make([]*content.Promotion, count)
+	for i := range promotions {
+		promotions[i] = &content.Promotion{
+			LongTitle:             fmt.Sprintf("OpenTelemetry Demo Promotion %d", i+1),
+			PromotionId:           fmt.Sprintf("otel-demo-%d-%d", now.Unix(), i+1),
+			Id:                    fmt.Sprintf("online:en:US:otel-demo-%d-%d", now.Unix(), i+1),
+			ContentLanguage:       "en",
+			TargetCountry:         "US",
+			GenericRedemptionCode: "OTELDEMO",
+			OfferType:             "GENERIC_CODE",
+			RedemptionChannel:     []string{"ONLINE"},
+			ProductApplicability:  "ALL_PRODUCTS",
+			PercentOff:            10,
+			CouponValueType:       "PERCENT_OFF",
+			PromotionEffectiveTimePeriod: &content.TimePeriod{
+				StartTime: now.Format(time.RFC3339),
+				EndTime:   now.Add(30 * 24 * time.Hour).Format(time.RFC3339),
+			},
+		}
+		if i < invalid {
+			promotions[i].LongTitle = ""
+		}
+	}
+	return promotions
+}
+
+// mockContentTransport answers promotions.create like the Content API: a
+// promotion without a long title gets a 400, and a fraction of requests get a
+// 429 with a Retry-After header.
+type mockContentTransport struct {
+	quotaRate float64
+}
+
+func (t *mockContentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var promotion content.Promotion
+	if req.Body != nil {
+		defer req.Body.Close()
+		if err := json.NewDecoder(req.Body).Decode(&promotion); err != nil {
+			return mockContentError(req, http.StatusBadRequest, "parseError", "invalid promotion JSON", nil), nil
+		}
+	}
+
+	// Simulate API latency
+	time.Sleep(time.Duration(20+rand.Intn(60)) * time.Millisecond)
+
+	if rand.Float64() < t.quotaRate {
+		return mockContentError(req, http.StatusTooManyRequests, "rateLimitExceeded", "quota exceeded for promotions.create",
+			http.Header{"Retry-After": []string{"1"}}), nil
+	}
+	if promotion.LongTitle == "" {
+		return mockContentError(req, http.StatusBadRequest, "invalid", "[promotion.long_title] required", nil), nil
+	}
+
+	body, _ := json.Marshal(promotion)
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": []string{"application/json"}},
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}, nil
+}
+
+func mockContentError(req *http.Request, code int, reason, message string, header http.Header) *http.Response {
+	body, _ := json.Marshal(map[string]any{
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+			"errors":  []map[string]string{{"reason": reason, "message": message}},
+		},
+	})
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Set("Content-Type", "application/json")
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", code, http.StatusText(code)),
+		StatusCode: code,
+		Header:     header,
+		Body:       io.NopCloser(bytes.NewReader(body)),
+		Request:    req,
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/storage"
+	"github.com/last9/opentelemetry-examples/go/common/cloudcost"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	defaultChunkSize = 2 << 20
+	// Chunk sizes are rounded up to a multiple of this by the client.
+	chunkSizeAlignment = 256 << 10
+)
+
+// largeUploadConfig controls the resumable upload of a large object. It is
+// off unless Size is set.
+type largeUploadConfig struct {
+	Size      int64
+	ChunkSize int
+}
+
+func largeUploadConfigFromEnv() largeUploadConfig {
+	size, _ := strconv.ParseInt(os.Getenv("GCS_LARGE_OBJECT_SIZE"), 10, 64)
+	chunkSize, err := strconv.Atoi(os.Getenv("GCS_CHUNK_SIZE"))
+	if err != nil || chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	return largeUploadConfig{Size: size, ChunkSize: chunkSize}
+}
+
+// chunkTracker turns the writer's progress callbacks into one span per chunk.
+// A chunk span starts when the previous chunk is acknowledged and ends when
+// its own is, so it covers buffering the chunk and every attempt to send it.
+type chunkTracker struct {
+	ctx    context.Context
+	tracer trace.Tracer
+	total  int64
+
+	mu      sync.Mutex
+	span    trace.Span
+	index   int
+	offset  int64
+	retries int
+	// totalRetries counts retries over all chunks.
+	totalRetries int
+}
+
+func (t *chunkTracker) startChunk() {
+	_, t.span = t.tracer.Start(t.ctx, "upload chunk", trace.WithAttributes(
+		attribute.Int("gcp.gcs.upload.chunk.index", t.index),
+		attribute.Int64("gcp.gcs.upload.chunk.offset", t.offset),
+	))
+	t.retries = 0
+}
+
+func (t *chunkTracker) endChunk(uploaded int64) {
+	t.span.SetAttributes(
+		attribute.Int64("gcp.gcs.upload.chunk.size", uploaded-t.offset),
+		attribute.Int("gcp.gcs.upload.chunk.retry_attempts", t.retries),
+	)
+	t.span.End()
+	t.span = nil
+	t.index++
+	t.offset = uploaded
+}
+
+// progress is the writer's ProgressFunc. It is called after each chunk with
+// the number of bytes uploaded so far.
+func (t *chunkTracker) progress(uploaded int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.span == nil {
+		return
+	}
+	t.endChunk(uploaded)
+	if uploaded < t.total {
+		t.startChunk()
+	}
+}
+
+// shouldRetry is the writer's retry error func. It keeps the client's default
+// decision and records every retry on the current chunk.
+func (t *chunkTracker) shouldRetry(err error) bool {
+	retry := storage.ShouldRetry(err)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if retry && t.span != nil {
+		t.retries++
+		t.totalRetries++
+		t.span.AddEvent("chunk.retry", trace.WithAttributes(
+			attribute.Int("gcp.gcs.upload.chunk.retry_attempt", t.retries),
+			attribute.String("error", err.Error()),
+		))
+	}
+	return retry
+}
+
+// finish ends a chunk left open when the upload stopped, and returns the
+// number of chunks and retries.
+func (t *chunkTracker) finish(err error) (chunks, retries int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.span != nil {
+		if err != nil {
+			t.span.RecordError(err)
+			t.span.SetStatus(codes.Error, "chunk upload failed")
+			t.span.SetAttributes(attribute.Int("gcp.gcs.upload.chunk.retry_attempts", t.retries))
+			t.span.End()
+			t.span = nil
+		} else {
+			t.endChunk(t.total)
+		}
+	}
+	return t.index, t.totalRetries
+}
+
+// uploadLargeObject writes size bytes of generated data to the object with a
+// resumable upload, under an upload span with one child span per chunk.
+//
+// A Writer with a non-zero ChunkSize uses a resumable upload session: each
+// chunk is a separate request, and a failed chunk is retried on its own
+// instead of restarting the whole object.
+func uploadLargeObject(ctx context.Context, tracer trace.Tracer, storageClient *storage.Client, bucket, objectName string, cfg largeUploadConfig) error {
+	ctx, span := tracer.Start(ctx, "resumable upload to GCS", trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("gcp.gcs.bucket", bucket),
+		attribute.String("gcp.gcs.object", objectName),
+		attribute.Int64("gcp.gcs.upload.size", cfg.Size),
+		attribute.Int("gcp.gcs.upload.chunk_size", alignChunkSize(cfg.ChunkSize)),
+	)
+
+	tracker := &chunkTracker{ctx: ctx, tracer: tracer, total: cfg.Size}
+
+	// Uploads without preconditions are not idempotent, so the client does
+	// not retry them by default. RetryAlways lets failed chunks be retried
+	objectHandle := storageClient.Bucket(bucket).Object(objectName).Retryer(
+		storage.WithPolicy(storage.RetryAlways),
+		storage.WithErrorFunc(tracker.shouldRetry),
+	)
+	writer := objectHandle.NewWriter(ctx)
+	writer.ChunkSize = cfg.ChunkSize
+	writer.ContentType = "application/octet-stream"
+	writer.ProgressFunc = tracker.progress
+
+	start := time.Now()
+	tracker.mu.Lock()
+	tracker.startChunk()
+	tracker.mu.Unlock()
+
+	// Generated data, so a large object needs no file on disk
+	_, err := io.CopyN(writer, rand.New(rand.NewSource(start.UnixNano())), cfg.Size)
+	if closeErr := writer.Close(); err == nil {
+		err = closeErr
+	}
+	elapsed := time.Since(start)
+
+	chunks, retries := tracker.finish(err)
+	span.SetAttributes(
+		attribute.Int("gcp.gcs.upload.chunks", chunks),
+		attribute.Int("gcp.gcs.upload.retries", retries),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "resumable upload failed")
+		recordCloudError(ctx, span, err, "storage", "objects.insert")
+		return fmt.Errorf("resumable upload failed: %w", err)
+	}
+
+	// Throughput includes retries, so a flaky network shows up as a drop here
+	span.SetAttributes(
+		attribute.Int64("gcp.gcs.object.generation", writer.Attrs().Generation),
+		attribute.Float64("gcp.gcs.upload.duration", elapsed.Seconds()),
+		attribute.Float64("gcp.gcs.upload.throughput", float64(cfg.Size)/elapsed.Seconds()),
+	)
+	// Starting the session and every chunk request, retries included, are
+	// counted as Class A operations, an upper bound
+	recordCost(ctx, span, cloudcost.GCS("objects.insert", int64(1+chunks+retries)), "storage", "objects.insert")
+	return nil
+}
+
+func alignChunkSize(n int) int {
+	return (n + chunkSizeAlignment - 1) / chunkSizeAlignment * chunkSizeAlignment
+}
+
+// flakyTransport fails a fraction of resumable upload chunk requests with a
+// 503, as a flaky network or an overloaded frontend would. Only chunk
+// requests fail; starting the upload session always succeeds.
+type flakyTransport struct {
+	base        http.RoundTripper
+	failureRate float64
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Chunk requests carry a Content-Range header; the session start does not
+	if req.Header.Get("Content-Range") != "" && rand.Float64() < t.failureRate {
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			Status:     "503 Service Unavailable",
+			StatusCode: http.StatusServiceUnavailable,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("simulated chunk failure")),
+			Request:    req,
+		}, nil
+	}
+	return t.base.RoundTrip(req)
+}
+
+// uploadFailureRate returns GCS_UPLOAD_FAILURE_RATE. It applies only with the
+// emulator; against Google Cloud the client uses its own authenticated
+// transport.
+func uploadFailureRate() float64 {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		return 0
+	}
+	rate, err := strconv.ParseFloat(os.Getenv("GCS_UPLOAD_FAILURE_RATE"), 64)
+	if err != nil {
+		return 0
+	}
+	return rate
+}
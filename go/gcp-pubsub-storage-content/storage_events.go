@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"cloud.google.com/go/storage"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes Cloud Storage sets on every Pub/Sub notification message. See
+// https://cloud.google.com/storage/docs/pubsub-notifications#attributes
+const (
+	gcsAttrNotificationConfig  = "notificationConfig"
+	gcsAttrEventType           = "eventType"
+	gcsAttrPayloadFormat       = "payloadFormat"
+	gcsAttrBucketID            = "bucketId"
+	gcsAttrObjectID            = "objectId"
+	gcsAttrObjectGeneration    = "objectGeneration"
+	gcsAttrEventTime           = "eventTime"
+	gcsAttrOverwroteGeneration = "overwroteGeneration"
+)
+
+const storageEventsReceiveTimeout = 10 * time.Second
+
+// storageEventsConfig names the topic Cloud Storage notifies and the
+// subscription the demo reads storage events from. Storage events are off
+// unless both are set.
+type storageEventsConfig struct {
+	Topic        string
+	Subscription string
+}
+
+func storageEventsConfigFromEnv() storageEventsConfig {
+	return storageEventsConfig{
+		Topic:        os.Getenv("GCS_NOTIFICATION_TOPIC"),
+		Subscription: os.Getenv("GCS_NOTIFICATION_SUBSCRIPTION"),
+	}
+}
+
+func (c storageEventsConfig) enabled() bool {
+	return c.Topic != "" && c.Subscription != ""
+}
+
+// gcsObject is the part of the JSON_API_V1 payload the consumer reads: the
+// object resource as the JSON API returns it.
+type gcsObject struct {
+	Bucket      string            `json:"bucket"`
+	Name        string            `json:"name"`
+	Generation  string            `json:"generation"`
+	Size        string            `json:"size"`
+	ContentType string            `json:"contentType"`
+	Metadata    map[string]string `json:"metadata"`
+}
+
+// ensureBucketNotification configures the bucket to publish OBJECT_FINALIZE
+// events to the topic, unless it already does. The Cloud Storage service
+// agent needs roles/pubsub.publisher on the topic.
+//
+// fake-gcs-server has no notifications API, so with the emulator
+// publishFinalizeShim publishes the events instead.
+func ensureBucketNotification(ctx context.Context, storageClient *storage.Client, bucket string, cfg storageEventsConfig) error {
+	if os.Getenv("STORAGE_EMULATOR_HOST") != "" {
+		return nil
+	}
+
+	bucketHandle := storageClient.Bucket(bucket)
+	existing, err := bucketHandle.Notifications(ctx)
+	if err != nil {
+		return fmt.Errorf("list notifications: %w", err)
+	}
+	for _, n := range existing {
+		if n.TopicID == cfg.Topic && n.TopicProjectID == getProjectID() {
+			return nil
+		}
+	}
+
+	n, err := bucketHandle.AddNotification(ctx, &storage.Notification{
+		TopicProjectID: getProjectID(),
+		TopicID:        cfg.Topic,
+		EventTypes:     []string{storage.ObjectFinalizeEvent},
+		PayloadFormat:  storage.JSONPayload,
+	})
+	if err != nil {
+		return fmt.Errorf("add notification: %w", err)
+	}
+	log.Printf("Bucket '%s' now notifies topic '%s' (notification %s)", bucket, cfg.Topic, n.ID)
+	return nil
+}
+
+// publishFinalizeShim publishes the OBJECT_FINALIZE message Cloud Storage
+// would publish for attrs: the same attributes, and the object resource as
+// the JSON_API_V1 payload. It runs only against the emulator.
+//
+// Like a real notification, the message carries no trace context
+// attributes. Trace context reaches the consumer only through the object's
+// metadata.
+func publishFinalizeShim(ctx context.Context, pubsubClient *pubsub.Client, topicName string, attrs *storage.ObjectAttrs) error {
+	if os.Getenv("STORAGE_EMULATOR_HOST") == "" {
+		return nil
+	}
+
+	generation := strconv.FormatInt(attrs.Generation, 10)
+	payload, err := json.Marshal(gcsObject{
+		Bucket:      attrs.Bucket,
+		Name:        attrs.Name,
+		Generation:  generation,
+		Size:        strconv.FormatInt(attrs.Size, 10),
+		ContentType: attrs.ContentType,
+		Metadata:    attrs.Metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal object payload: %w", err)
+	}
+
+	result := pubsubClient.Topic(topicName).Publish(ctx, &pubsub.Message{
+		Data: payload,
+		Attributes: map[string]string{
+			gcsAttrNotificationConfig: fmt.Sprintf("projects/_/buckets/%s/notificationConfigs/emulator-shim", attrs.Bucket),
+			gcsAttrEventType:          storage.ObjectFinalizeEvent,
+			gcsAttrPayloadFormat:      storage.JSONPayload,
+			gcsAttrBucketID:           attrs.Bucket,
+			gcsAttrObjectID:           attrs.Name,
+			gcsAttrObjectGeneration:   generation,
+			gcsAttrEventTime:          attrs.Updated.UTC().Format(time.RFC3339Nano),
+		},
+	})
+	if _, err := result.Get(ctx); err != nil {
+		return fmt.Errorf("publish finalize shim: %w", err)
+	}
+	return nil
+}
+
+// consumeStorageEvents receives storage events until it has processed the
+// OBJECT_FINALIZE event for bucket/objectName at generation, or the receive
+// timeout passes.
+func consumeStorageEvents(ctx context.Context, pubsubClient *pubsub.Client, tracer trace.Tracer, subscriptionName, bucket, objectName string, generation int64) error {
+	receiveCtx, cancel := context.WithTimeout(ctx, storageEventsReceiveTimeout)
+	defer cancel()
+
+	want := strconv.FormatInt(generation, 10)
+	err := pubsubClient.Subscription(subscriptionName).Receive(receiveCtx, func(_ context.Context, msg *pubsub.Message) {
+		processStorageEvent(tracer, subscriptionName, msg)
+		msg.Ack()
+
+		if msg.Attributes[gcsAttrEventType] == storage.ObjectFinalizeEvent &&
+			msg.Attributes[gcsAttrBucketID] == bucket &&
+			msg.Attributes[gcsAttrObjectID] == objectName &&
+			msg.Attributes[gcsAttrObjectGeneration] == want {
+			cancel()
+		}
+	})
+	if err != nil && receiveCtx.Err() == nil {
+		return fmt.Errorf("storage events receive failed: %w", err)
+	}
+	if receiveCtx.Err() == context.DeadlineExceeded {
+		log.Printf("No OBJECT_FINALIZE event for gs://%s/%s#%s within %s", bucket, objectName, want, storageEventsReceiveTimeout)
+	}
+	return nil
+}
+
+// processStorageEvent handles one notification under a consumer span.
+//
+// Storage events start a new trace: the upload that caused the event may have
+// happened anywhere, long before. When the uploader stored its trace context
+// in the object metadata, the span links back to the upload span.
+func processStorageEvent(tracer trace.Tracer, subscriptionName string, msg *pubsub.Message) {
+	eventType := msg.Attributes[gcsAttrEventType]
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemGCPPubsub,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingDestinationNameKey.String(subscriptionName),
+		semconv.MessagingMessageID(msg.ID),
+		attribute.String("gcp.gcs.event_type", eventType),
+		attribute.String("gcp.gcs.bucket", msg.Attributes[gcsAttrBucketID]),
+		attribute.String("gcp.gcs.object", msg.Attributes[gcsAttrObjectID]),
+		attribute.String("gcp.gcs.notification_config", msg.Attributes[gcsAttrNotificationConfig]),
+	}
+	if gen, err := strconv.ParseInt(msg.Attributes[gcsAttrObjectGeneration], 10, 64); err == nil {
+		attrs = append(attrs, attribute.Int64("gcp.gcs.object.generation", gen))
+	}
+	// Set when the upload replaced an existing object
+	if gen, err := strconv.ParseInt(msg.Attributes[gcsAttrOverwroteGeneration], 10, 64); err == nil {
+		attrs = append(attrs, attribute.Int64("gcp.gcs.object.overwrote_generation", gen))
+	}
+	if eventTime, err := time.Parse(time.RFC3339Nano, msg.Attributes[gcsAttrEventTime]); err == nil {
+		attrs = append(attrs, attribute.Float64("gcp.gcs.event.delay", time.Since(eventTime).Seconds()))
+	}
+
+	var obj gcsObject
+	objErr := json.Unmarshal(msg.Data, &obj)
+	if objErr == nil {
+		if size, err := strconv.ParseInt(obj.Size, 10, 64); err == nil {
+			attrs = append(attrs, attribute.Int64("gcp.gcs.object.size", size))
+		}
+		if obj.ContentType != "" {
+			attrs = append(attrs, attribute.String("gcp.gcs.object.content_type", obj.ContentType))
+		}
+	}
+
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	}
+	uploadCtx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.MapCarrier(obj.Metadata))
+	if upload := trace.SpanContextFromContext(uploadCtx); upload.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{
+			SpanContext: upload,
+			Attributes:  []attribute.KeyValue{attribute.String("link.type", "object_upload")},
+		}))
+	}
+	_, span := tracer.Start(context.Background(), "process "+eventType, opts...)
+	defer span.End()
+	span.SetAttributes(attribute.Bool("gcp.gcs.upload_trace_context.present", trace.SpanContextFromContext(uploadCtx).IsValid()))
+
+	if objErr != nil {
+		span.RecordError(objErr)
+		span.SetStatus(codes.Error, "invalid notification payload")
+		return
+	}
+	// Only finalized objects are processed. Other event types are acked and
+	// skipped, so a notification config with more event types is harmless
+	if eventType != storage.ObjectFinalizeEvent {
+		span.AddEvent("storage_event.skipped")
+		return
+	}
+
+	// Simulate processing the new object
+	time.Sleep(50 * time.Millisecond)
+	log.Printf("Processed %s for gs://%s/%s#%s", eventType, obj.Bucket, obj.Name, obj.Generation)
+}
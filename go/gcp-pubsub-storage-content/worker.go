@@ -0,0 +1,438 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	pubsubapi "cloud.google.com/go/pubsub/apiv1"
+	"cloud.google.com/go/pubsub/apiv1/pubsubpb"
+	"github.com/last9/opentelemetry-examples/go/common/cloudcost"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Why a message was counted as at risk of redelivery.
+const (
+	// riskExtensionLimit means processing outlived WORKER_MAX_EXTENSION, so
+	// the deadline is no longer extended.
+	riskExtensionLimit = "extension_limit"
+	// riskExtensionFailed means a ModifyAckDeadline call failed.
+	riskExtensionFailed = "extension_failed"
+	// riskDeadlinePassed means the ack was sent after the deadline.
+	riskDeadlinePassed = "deadline_passed"
+)
+
+// workerConfig controls the worker mode. Processing time is simulated: most
+// messages take ProcessingTime, and a SlowRate fraction take SlowTime.
+type workerConfig struct {
+	Subscription   string
+	Topic          string
+	PublishEvery   time.Duration
+	MaxOutstanding int
+	ProcessingTime time.Duration
+	SlowRate       float64
+	SlowTime       time.Duration
+	// ExtendMargin is how long before the deadline it is extended.
+	ExtendMargin time.Duration
+	// MaxExtension is how long a message is kept leased in total.
+	MaxExtension time.Duration
+}
+
+func workerConfigFromEnv() workerConfig {
+	slowRate, err := strconv.ParseFloat(os.Getenv("WORKER_SLOW_RATE"), 64)
+	if err != nil {
+		slowRate = 0.2
+	}
+	maxOutstanding, err := strconv.Atoi(os.Getenv("WORKER_MAX_OUTSTANDING"))
+	if err != nil || maxOutstanding <= 0 {
+		maxOutstanding = 10
+	}
+	return workerConfig{
+		Subscription:   mustGetenv("PUBSUB_SUBSCRIPTION"),
+		Topic:          os.Getenv("PUBSUB_TOPIC"),
+		PublishEvery:   getEnvDuration("WORKER_PUBLISH_INTERVAL", 0),
+		MaxOutstanding: maxOutstanding,
+		ProcessingTime: getEnvDuration("WORKER_PROCESSING_TIME", 200*time.Millisecond),
+		SlowRate:       slowRate,
+		SlowTime:       getEnvDuration("WORKER_SLOW_PROCESSING_TIME", 25*time.Second),
+		ExtendMargin:   getEnvDuration("WORKER_EXTEND_MARGIN", 3*time.Second),
+		MaxExtension:   getEnvDuration("WORKER_MAX_EXTENSION", 20*time.Second),
+	}
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
+
+// ackTelemetry holds the slow-consumer instruments.
+type ackTelemetry struct {
+	timeToAck      metric.Float64Histogram
+	extensions     metric.Int64Counter
+	redeliveryRisk metric.Int64Counter
+}
+
+func newAckTelemetry() (*ackTelemetry, error) {
+	meter := otel.Meter(getServiceName())
+
+	timeToAck, err := meter.Float64Histogram("messaging.gcp_pubsub.time_to_ack",
+		metric.WithDescription("Time from receiving a message to acking it"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	extensions, err := meter.Int64Counter("messaging.gcp_pubsub.ack_deadline.extensions",
+		metric.WithDescription("Ack deadline extensions sent for messages still being processed"),
+		metric.WithUnit("{extension}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	redeliveryRisk, err := meter.Int64Counter("messaging.gcp_pubsub.redelivery_risk",
+		metric.WithDescription("Messages at risk of redelivery because they were not acked within their ack deadline"),
+		metric.WithUnit("{message}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &ackTelemetry{timeToAck: timeToAck, extensions: extensions, redeliveryRisk: redeliveryRisk}, nil
+}
+
+// newSubscriberClient returns a low-level subscriber client. The worker pulls
+// and extends deadlines itself, rather than using Subscription.Receive, so
+// every extension is visible on the message's span.
+func newSubscriberClient(ctx context.Context) (*pubsubapi.SubscriberClient, error) {
+	var opts []option.ClientOption
+	if host := os.Getenv("PUBSUB_EMULATOR_HOST"); host != "" {
+		opts = append(opts,
+			option.WithEndpoint(host),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		)
+	}
+	return pubsubapi.NewSubscriberClient(ctx, opts...)
+}
+
+// worker processes messages from one subscription and keeps their ack
+// deadlines extended while they are processed.
+type worker struct {
+	cfg         workerConfig
+	client      *pubsubapi.SubscriberClient
+	tracer      trace.Tracer
+	telemetry   *ackTelemetry
+	subPath     string
+	ackDeadline time.Duration
+}
+
+// runWorker pulls from PUBSUB_SUBSCRIPTION until interrupted. With
+// WORKER_PUBLISH_INTERVAL set it also publishes a test message to
+// PUBSUB_TOPIC at that interval.
+func runWorker(ctx context.Context, tp *sdktrace.TracerProvider) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg := workerConfigFromEnv()
+	client, err := newSubscriberClient(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to create subscriber client: %w", err)
+	}
+	defer client.Close()
+
+	telemetry, err := newAckTelemetry()
+	if err != nil {
+		return fmt.Errorf("failed to create instruments: %w", err)
+	}
+
+	w := &worker{
+		cfg:       cfg,
+		client:    client,
+		tracer:    tp.Tracer(getServiceName()),
+		telemetry: telemetry,
+		subPath:   fmt.Sprintf("projects/%s/subscriptions/%s", getProjectID(), cfg.Subscription),
+	}
+
+	sub, err := client.GetSubscription(ctx, &pubsubpb.GetSubscriptionRequest{Subscription: w.subPath})
+	if err != nil {
+		return fmt.Errorf("failed to get subscription: %w", err)
+	}
+	w.ackDeadline = time.Duration(sub.GetAckDeadlineSeconds()) * time.Second
+	if w.ackDeadline == 0 {
+		w.ackDeadline = 10 * time.Second
+	}
+	if w.cfg.ExtendMargin >= w.ackDeadline {
+		w.cfg.ExtendMargin = w.ackDeadline / 2
+	}
+
+	if cfg.PublishEvery > 0 && cfg.Topic != "" {
+		go w.publishLoop(ctx)
+	}
+
+	log.Printf("worker pulling from %s (ack deadline %s, max extension %s)", w.subPath, w.ackDeadline, cfg.MaxExtension)
+	w.pullLoop(ctx)
+	log.Println("worker stopped")
+	return nil
+}
+
+// pullLoop pulls as many messages as there are free processing slots, and
+// waits for in-flight messages when ctx is done.
+func (w *worker) pullLoop(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	slots := make(chan struct{}, w.cfg.MaxOutstanding)
+	for ctx.Err() == nil {
+		free := cap(slots) - len(slots)
+		if free == 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(100 * time.Millisecond):
+			}
+			continue
+		}
+
+		resp, err := w.client.Pull(ctx, &pubsubpb.PullRequest{
+			Subscription: w.subPath,
+			MaxMessages:  int32(free),
+		})
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("pull failed: %v", err)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+
+		for _, rm := range resp.GetReceivedMessages() {
+			slots <- struct{}{}
+			wg.Add(1)
+			go func(rm *pubsubpb.ReceivedMessage) {
+				defer wg.Done()
+				defer func() { <-slots }()
+				// Finish in-flight messages on shutdown instead of letting
+				// them be redelivered
+				w.handle(context.WithoutCancel(ctx), rm, time.Now())
+			}(rm)
+		}
+	}
+}
+
+// handle processes one message under a consumer span. The span records how
+// long the message took to ack against its ack deadline:
+//
+//	process <subscription>
+//	  ack_deadline.extended                 (one per extension)
+//	  ack_deadline.extension_limit_reached  (WORKER_MAX_EXTENSION passed)
+//	  redelivery_risk                       (reason)
+//	  messaging.gcp_pubsub.time_to_ack, messaging.gcp_pubsub.ack_deadline.exceeded
+func (w *worker) handle(ctx context.Context, rm *pubsubpb.ReceivedMessage, receivedAt time.Time) {
+	msg := rm.GetMessage()
+	msgCtx := otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(msg.GetAttributes()))
+
+	attrs := []attribute.KeyValue{
+		semconv.MessagingSystemGCPPubsub,
+		semconv.MessagingOperationTypeDeliver,
+		semconv.MessagingDestinationName(w.cfg.Subscription),
+		semconv.MessagingMessageID(msg.GetMessageId()),
+		semconv.MessagingGCPPubsubMessageAckDeadline(int(w.ackDeadline.Seconds())),
+	}
+	if n := rm.GetDeliveryAttempt(); n > 0 {
+		// Only set when the subscription has a dead-letter policy
+		attrs = append(attrs, semconv.MessagingGCPPubsubMessageDeliveryAttempt(int(n)))
+	}
+	if pt := msg.GetPublishTime(); pt != nil {
+		attrs = append(attrs, attribute.Float64("messaging.gcp_pubsub.message.age", receivedAt.Sub(pt.AsTime()).Seconds()))
+	}
+	msgCtx, span := w.tracer.Start(msgCtx, "process "+w.cfg.Subscription,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+	recordCost(msgCtx, span, cloudcost.PubSub(pubsubMessageSize(msg.GetData(), msg.GetAttributes())), "pubsub", "StreamingPull")
+
+	l := &lease{w: w, span: span, ackID: rm.GetAckId(), receivedAt: receivedAt, deadline: receivedAt.Add(w.ackDeadline)}
+	done := make(chan struct{})
+	leaseDone := make(chan struct{})
+	go func() {
+		defer close(leaseDone)
+		l.keepAlive(msgCtx, done)
+	}()
+
+	w.process(msgCtx)
+
+	close(done)
+	<-leaseDone
+
+	timeToAck := time.Since(receivedAt)
+	exceeded := time.Now().After(l.deadline)
+	if exceeded {
+		// The message may already have been sent to another subscriber
+		l.markAtRisk(msgCtx, riskDeadlinePassed)
+	}
+
+	err := w.client.Acknowledge(msgCtx, &pubsubpb.AcknowledgeRequest{
+		Subscription: w.subPath,
+		AckIds:       []string{rm.GetAckId()},
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "ack failed")
+		recordCloudError(msgCtx, span, err, "pubsub", "Acknowledge")
+	}
+
+	span.SetAttributes(
+		attribute.Float64("messaging.gcp_pubsub.time_to_ack", timeToAck.Seconds()),
+		attribute.Float64("messaging.gcp_pubsub.ack_deadline.used_ratio", timeToAck.Seconds()/w.ackDeadline.Seconds()),
+		attribute.Int("messaging.gcp_pubsub.ack_deadline.extensions", l.extensions),
+		attribute.Bool("messaging.gcp_pubsub.ack_deadline.exceeded", exceeded),
+		attribute.Bool("messaging.gcp_pubsub.redelivery_risk", l.atRisk),
+	)
+	w.telemetry.timeToAck.Record(msgCtx, timeToAck.Seconds(), metric.WithAttributes(
+		semconv.MessagingDestinationName(w.cfg.Subscription),
+		attribute.Bool("messaging.gcp_pubsub.ack_deadline.exceeded", exceeded),
+	))
+	log.Printf("message %s acked after %s (deadline %s, %d extensions, at risk %t)",
+		msg.GetMessageId(), timeToAck.Round(time.Millisecond), w.ackDeadline, l.extensions, l.atRisk)
+}
+
+// process simulates work. A WORKER_SLOW_RATE fraction of messages take
+// WORKER_SLOW_PROCESSING_TIME, longer than the ack deadline.
+func (w *worker) process(ctx context.Context) {
+	d := w.cfg.ProcessingTime
+	if rand.Float64() < w.cfg.SlowRate {
+		d = w.cfg.SlowTime
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("worker.slow", true))
+	}
+	time.Sleep(d)
+}
+
+// lease tracks the ack deadline of one message while it is processed.
+type lease struct {
+	w          *worker
+	span       trace.Span
+	ackID      string
+	receivedAt time.Time
+
+	// Written by keepAlive and read by handle after keepAlive returns
+	deadline   time.Time
+	extensions int
+	atRisk     bool
+}
+
+// keepAlive extends the ack deadline ExtendMargin before it passes, until
+// done is closed or MaxExtension is reached.
+func (l *lease) keepAlive(ctx context.Context, done <-chan struct{}) {
+	cfg := l.w.cfg
+	for {
+		select {
+		case <-done:
+			return
+		case <-time.After(time.Until(l.deadline.Add(-cfg.ExtendMargin))):
+		}
+
+		elapsed := time.Since(l.receivedAt)
+		if elapsed+l.w.ackDeadline > cfg.MaxExtension {
+			l.span.AddEvent("ack_deadline.extension_limit_reached", trace.WithAttributes(
+				attribute.Float64("messaging.gcp_pubsub.elapsed", elapsed.Seconds()),
+				attribute.Float64("messaging.gcp_pubsub.max_extension", cfg.MaxExtension.Seconds()),
+			))
+			l.markAtRisk(ctx, riskExtensionLimit)
+			return
+		}
+
+		err := l.w.client.ModifyAckDeadline(ctx, &pubsubpb.ModifyAckDeadlineRequest{
+			Subscription:       l.w.subPath,
+			AckIds:             []string{l.ackID},
+			AckDeadlineSeconds: int32(l.w.ackDeadline.Seconds()),
+		})
+		if err != nil {
+			l.span.AddEvent("ack_deadline.extension_failed", trace.WithAttributes(
+				attribute.String("exception.message", err.Error()),
+			))
+			l.markAtRisk(ctx, riskExtensionFailed)
+			return
+		}
+
+		l.deadline = time.Now().Add(l.w.ackDeadline)
+		l.extensions++
+		l.span.AddEvent("ack_deadline.extended", trace.WithAttributes(
+			attribute.Int("messaging.gcp_pubsub.ack_deadline.extension", l.extensions),
+			attribute.Float64("messaging.gcp_pubsub.elapsed", elapsed.Seconds()),
+			attribute.Int("messaging.gcp_pubsub.message.ack_deadline", int(l.w.ackDeadline.Seconds())),
+		))
+		l.w.telemetry.extensions.Add(ctx, 1, metric.WithAttributes(
+			semconv.MessagingDestinationName(l.w.cfg.Subscription),
+		))
+	}
+}
+
+// markAtRisk counts the message as at risk of redelivery, once.
+func (l *lease) markAtRisk(ctx context.Context, reason string) {
+	if l.atRisk {
+		return
+	}
+	l.atRisk = true
+	l.span.AddEvent("redelivery_risk", trace.WithAttributes(
+		attribute.String("messaging.gcp_pubsub.redelivery_risk.reason", reason),
+	))
+	l.w.telemetry.redeliveryRisk.Add(ctx, 1, metric.WithAttributes(
+		semconv.MessagingDestinationName(l.w.cfg.Subscription),
+		attribute.String("messaging.gcp_pubsub.redelivery_risk.reason", reason),
+	))
+}
+
+// publishLoop publishes a test message every PublishEvery, so the worker has
+// something to consume.
+func (w *worker) publishLoop(ctx context.Context) {
+	storageClient, pubsubClient := newGCPClients(ctx)
+	defer storageClient.Close()
+	defer pubsubClient.Close()
+	topic := pubsubClient.Topic(w.cfg.Topic)
+	defer topic.Stop()
+
+	ticker := time.NewTicker(w.cfg.PublishEvery)
+	defer ticker.Stop()
+	for n := 1; ; n++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		publishCtx, span := w.tracer.Start(ctx, "publish message to Pub/Sub", trace.WithSpanKind(trace.SpanKindProducer))
+		span.SetAttributes(
+			semconv.MessagingDestinationNameKey.String(w.cfg.Topic),
+			semconv.MessagingSystemKey.String("pubsub"),
+		)
+		msg := &pubsub.Message{Data: []byte(fmt.Sprintf("work item %d", n))}
+		injectIntoPubSub(publishCtx, msg)
+		if _, err := topic.Publish(publishCtx, msg).Get(publishCtx); err != nil {
+			span.RecordError(err)
+			recordCloudError(publishCtx, span, err, "pubsub", "Publish")
+			log.Printf("publish failed: %v", err)
+		} else {
+			recordCost(publishCtx, span, cloudcost.PubSub(pubsubMessageSize(msg.Data, msg.Attributes)), "pubsub", "Publish")
+		}
+		span.End()
+	}
+}
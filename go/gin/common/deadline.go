@@ -0,0 +1,37 @@
+package common
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/deadline"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Deadline gives each request a deadline of timeout, by replacing the
+// request's context. Handlers that pass c.Request.Context() on have their
+// queries, Redis commands and HTTP calls stopped at the deadline.
+//
+// A timeout is recorded on the server span, so register Deadline after the
+// middleware that starts it. If the handler has written nothing by then, the
+// client gets a 503. Registered on a route as well as on the router, the
+// shorter deadline wins.
+func Deadline(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, done := deadline.Start(c.Request.Context(), timeout)
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+
+		attrs := []attribute.KeyValue{attribute.String("http.request.method", c.Request.Method)}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+		if done(attrs...) && !c.Writer.Written() {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+				"error":           "request timed out",
+				"timeout_seconds": timeout.Seconds(),
+			})
+		}
+	}
+}
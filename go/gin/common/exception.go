@@ -1,131 +1,46 @@
 package common
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"runtime"
-	"strings"
-	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/trace"
 )
 
-// RecordExceptionInSpan records detailed exception information in the span
+// RecordExceptionInSpan records an exception with message on the request
+// span, with errInput as key, value pairs, added to the exception event as
+// exception.<key>. It is RecordExceptionWithStack for a message rather than
+// an error.
 func RecordExceptionInSpan(c *gin.Context, message string, errInput ...interface{}) {
-	// Retrieve span from context
-	spanValue, exists := c.Get("span")
-	if !exists {
-		return
-	}
-	
-	span, ok := spanValue.(trace.Span)
-	if !ok {
-		return
-	}
-	
-	// Create error with message
-	err := fmt.Errorf("%s", message)
-	
-	// Record the error in the span
-	span.RecordError(err)
-	span.SetStatus(codes.Error, message)
-	
-	// Add timestamp
-	span.SetAttributes(
-		attribute.String("exception.timestamp", time.Now().UTC().Format(time.RFC3339)),
-		attribute.String("exception.message", message),
-	)
-	
-	// Add custom attributes from errInput
-	var attrs []attribute.KeyValue
-	for i := 0; i < len(errInput); i += 2 {
-		if i+1 < len(errInput) {
-			key := fmt.Sprintf("exception.%v", errInput[i])
-			value := fmt.Sprintf("%v", errInput[i+1])
-			attrs = append(attrs, attribute.String(key, value))
-		}
-	}
-	
-	// Add stack trace information
-	if len(attrs) > 0 {
-		span.SetAttributes(attrs...)
-	}
-	
-	// Add stack trace for debugging (only in development)
-	if os.Getenv("APP_ENV") == "development" {
-		stackTrace := getStackTrace()
-		span.SetAttributes(attribute.String("exception.stack_trace", stackTrace))
-	}
+	RecordExceptionWithStack(c, errors.New(message), errInput...)
 }
 
-// RecordExceptionWithStack records exception with full stack trace
+// RecordExceptionWithStack records err on the request span with
+// otelerr.Record: an exception event with its type, message and stack trace,
+// status Error and error.type. The stack is the one otelerr.Wrap kept, or
+// this call's. additionalInfo are key, value pairs, added to the event as
+// exception.<key>.
+//
+// The span is the one TracingMiddleware stored with c.Set("span").
 func RecordExceptionWithStack(c *gin.Context, err error, additionalInfo ...interface{}) {
 	spanValue, exists := c.Get("span")
 	if !exists {
 		return
 	}
-	
 	span, ok := spanValue.(trace.Span)
-	if !ok {
+	if !ok || !span.IsRecording() {
+		// A sampled-out span drops everything below, so skip building it
 		return
 	}
-	
-	// Record the error
-	span.RecordError(err)
-	span.SetStatus(codes.Error, err.Error())
-	
-	// Add basic exception attributes
-	span.SetAttributes(
-		attribute.String("exception.timestamp", time.Now().UTC().Format(time.RFC3339)),
-		attribute.String("exception.type", fmt.Sprintf("%T", err)),
-		attribute.String("exception.message", err.Error()),
-	)
-	
-	// Add stack trace
-	stackTrace := getStackTrace()
-	span.SetAttributes(attribute.String("exception.stack_trace", stackTrace))
-	
-	// Add additional information
+
 	var attrs []attribute.KeyValue
-	for i := 0; i < len(additionalInfo); i += 2 {
-		if i+1 < len(additionalInfo) {
-			key := fmt.Sprintf("exception.%v", additionalInfo[i])
-			value := fmt.Sprintf("%v", additionalInfo[i+1])
-			attrs = append(attrs, attribute.String(key, value))
-		}
-	}
-	
-	if len(attrs) > 0 {
-		span.SetAttributes(attrs...)
+	for i := 0; i+1 < len(additionalInfo); i += 2 {
+		attrs = append(attrs, attribute.String(
+			fmt.Sprintf("exception.%v", additionalInfo[i]),
+			fmt.Sprintf("%v", additionalInfo[i+1])))
 	}
+	otelerr.Record(trace.ContextWithSpan(c.Request.Context(), span), err, attrs...)
 }
-
-// getStackTrace returns a formatted stack trace
-func getStackTrace() string {
-	var stack []string
-	for i := 1; i < 10; i++ { // Limit to 10 frames
-		pc, file, line, ok := runtime.Caller(i)
-		if !ok {
-			break
-		}
-		
-		fn := runtime.FuncForPC(pc)
-		if fn == nil {
-			continue
-		}
-		
-		// Skip internal Go runtime functions
-		if strings.Contains(fn.Name(), "runtime.") || 
-		   strings.Contains(fn.Name(), "reflect.") ||
-		   strings.Contains(fn.Name(), "gin.") {
-			continue
-		}
-		
-		stack = append(stack, fmt.Sprintf("%s:%d %s", file, line, fn.Name()))
-	}
-	
-	return strings.Join(stack, "\n")
-}
\ No newline at end of file
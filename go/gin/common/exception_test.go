@@ -0,0 +1,44 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// BenchmarkRecordExceptionWithStack records an error with additional info on
+// a sampled and a sampled-out request span. The sampled-out span skips the
+// stack trace and the formatted attributes:
+//
+//	go test -run '^$' -bench RecordException -benchmem ./common
+func BenchmarkRecordExceptionWithStack(b *testing.B) {
+	gin.SetMode(gin.TestMode)
+	err := errors.New("failed to fetch joke")
+	for _, bc := range []struct {
+		name    string
+		sampler sdktrace.Sampler
+	}{
+		{"sampled", sdktrace.AlwaysSample()},
+		{"unsampled", sdktrace.NeverSample()},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSampler(bc.sampler))
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, "/joke", nil)
+			ctx, span := tp.Tracer("bench").Start(c.Request.Context(), "GET /joke")
+			defer span.End()
+			c.Request = c.Request.WithContext(ctx)
+			c.Set("span", span)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				RecordExceptionWithStack(c, err, "url", "https://official-joke-api.appspot.com/random_joke", "attempt", 3)
+			}
+		})
+	}
+}
@@ -0,0 +1,65 @@
+package common
+
+import (
+	"log"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// Names of the instruments RequestMetrics records.
+const (
+	RequestDurationName = "http.server.request.duration"
+	RequestBodySizeName = "http.server.request.body.size"
+)
+
+// RequestMetrics records the duration and body size of each request on the
+// meter named meterName, from the global MeterProvider.
+//
+// Like many instrumentations, it records every attribute it knows of the
+// request, including url.full, user_agent.original and client.address. Each
+// of those has a value per client or per URL, so as metric attributes they
+// create a series each. It's up to the MeterProvider's views to drop them.
+func RequestMetrics(meterName string) gin.HandlerFunc {
+	meter := otel.Meter(meterName)
+	duration, err := meter.Float64Histogram(RequestDurationName,
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		log.Printf("RequestMetrics: %v", err)
+	}
+	bodySize, err := meter.Int64Histogram(RequestBodySizeName,
+		metric.WithDescription("Size of HTTP server request bodies"),
+		metric.WithUnit("By"),
+	)
+	if err != nil {
+		log.Printf("RequestMetrics: %v", err)
+	}
+
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		opt := metric.WithAttributes(
+			attribute.String("http.request.method", c.Request.Method),
+			attribute.String("http.route", c.FullPath()),
+			attribute.Int("http.response.status_code", c.Writer.Status()),
+			attribute.String("url.full", scheme+"://"+c.Request.Host+c.Request.URL.RequestURI()),
+			attribute.String("user_agent.original", c.Request.UserAgent()),
+			attribute.String("client.address", c.ClientIP()),
+		)
+		ctx := c.Request.Context()
+		duration.Record(ctx, time.Since(start).Seconds(), opt)
+		if c.Request.ContentLength > 0 {
+			bodySize.Record(ctx, c.Request.ContentLength, opt)
+		}
+	}
+}
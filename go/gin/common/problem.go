@@ -0,0 +1,94 @@
+package common
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/problem"
+)
+
+// maxProblemBody is how much of a handler's error body is kept to find its
+// message.
+const maxProblemBody = 4 << 10
+
+// Problems answers failed requests with RFC 7807 problem+json that carries
+// the trace ID, and sets the traceresponse and Server-Timing headers on every
+// response. Handlers keep writing c.JSON(status, gin.H{"error": ...}) or
+// c.AbortWithStatus(status): Problems rewrites error responses, those with a
+// status of 400 or more, on the way out.
+//
+// The trace ID is the server span's, so register Problems after the
+// middleware that starts it, and before middleware whose error responses it
+// should rewrite, such as Deadline and RateLimit.
+func Problems() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		problem.SetTraceHeaders(c.Request.Context(), c.Writer.Header())
+		w := c.Writer
+		pw := &problemWriter{ResponseWriter: w}
+		c.Writer = pw
+		// Restored even on a panic, so gin's Recovery can still answer
+		defer func() { c.Writer = w }()
+		c.Next()
+
+		c.Writer = w
+		// An error status with no body, from AbortWithStatus or gin's own
+		// 404 and 405, is answered too
+		if pw.captured != nil || (!w.Written() && w.Status() >= http.StatusBadRequest) {
+			var body []byte
+			if pw.captured != nil {
+				body = pw.captured.Bytes()
+			}
+			problem.Write(w, problem.FromResponse(c.Request, w.Status(), body))
+		}
+	}
+}
+
+// problemWriter holds back an error response, keeping the start of its body,
+// so Problems can answer with problem details instead. gin sends the status
+// with the first write, so that's where an error is caught.
+type problemWriter struct {
+	gin.ResponseWriter
+	// captured is the error body, nil if the response isn't an error
+	captured *bytes.Buffer
+}
+
+func (w *problemWriter) capturing() bool {
+	if w.captured == nil && !w.ResponseWriter.Written() &&
+		w.Status() >= http.StatusBadRequest && !problem.IsProblem(w.Header()) {
+		w.captured = new(bytes.Buffer)
+	}
+	return w.captured != nil
+}
+
+func (w *problemWriter) Write(b []byte) (int, error) {
+	if !w.capturing() {
+		return w.ResponseWriter.Write(b)
+	}
+	if room := maxProblemBody - w.captured.Len(); room > 0 {
+		w.captured.Write(b[:min(len(b), room)])
+	}
+	return len(b), nil
+}
+
+func (w *problemWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *problemWriter) WriteHeaderNow() {
+	if !w.capturing() {
+		w.ResponseWriter.WriteHeaderNow()
+	}
+}
+
+// Written is true once an error is held back, so later middleware, such as
+// Deadline, doesn't answer a second time.
+func (w *problemWriter) Written() bool {
+	return w.captured != nil || w.ResponseWriter.Written()
+}
+
+func (w *problemWriter) Flush() {
+	if w.captured == nil {
+		w.ResponseWriter.Flush()
+	}
+}
@@ -0,0 +1,33 @@
+package common
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/ratelimit"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// RateLimit answers requests limiter rejects with 429 and a Retry-After
+// header. The request span gets ratelimit.limited either way, and a
+// ratelimit.rejected event when it is rejected, so register RateLimit after
+// the middleware that starts it. Registered on a route as well as on the
+// router, a request needs a token from both.
+func RateLimit(limiter *ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		attrs := []attribute.KeyValue{attribute.String("http.request.method", c.Request.Method)}
+		if route := c.FullPath(); route != "" {
+			attrs = append(attrs, attribute.String("http.route", route))
+		}
+		ok, retryAfter := limiter.Allow(c.Request.Context(), attrs...)
+		if ok {
+			c.Next()
+			return
+		}
+		c.Header("Retry-After", ratelimit.RetryAfterSeconds(retryAfter))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":               "rate limit exceeded",
+			"retry_after_seconds": retryAfter.Seconds(),
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package common
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingConfig configures TracingMiddleware.
+type TracingConfig struct {
+	// TracerName names the tracer of the spans the middleware starts.
+	TracerName string
+	// ReuseServerSpan makes the middleware use the server span already in
+	// the request context, such as otelgin's, instead of starting a second
+	// one. Disable it only where nothing else starts server spans.
+	ReuseServerSpan bool
+	// Filter, if set, reports whether a request is traced. Requests it
+	// rejects get no span, as with otelgin.WithFilter.
+	Filter func(*http.Request) bool
+}
+
+// TracingMiddleware makes the request's server span available to handlers
+// as c.Get("span"), which RecordExceptionInSpan and RecordExceptionWithStack
+// read.
+//
+// Examples without otelgin start the server span in a middleware like this
+// one. Copied into a router that also has otelgin, such as
+// ginagent.Default(), that would give every request two nested server spans,
+// and double the request counts derived from them. With ReuseServerSpan set,
+// the middleware only starts a span when the context has no server span of
+// this process.
+//
+// Spans it starts are named by the strategy set with HTTP_SPAN_NAME_STRATEGY,
+// "GET /users/:id" by default; see the spanname package.
+func TracingMiddleware(cfg TracingConfig) gin.HandlerFunc {
+	tracer := otel.Tracer(cfg.TracerName)
+	namer := spanname.FromEnv()
+	var warnOnce sync.Once
+
+	return func(c *gin.Context) {
+		if cfg.Filter != nil && !cfg.Filter(c.Request) {
+			c.Next()
+			return
+		}
+		if existing := trace.SpanFromContext(c.Request.Context()); isLocalServerSpan(existing) {
+			if cfg.ReuseServerSpan {
+				c.Set("span", existing)
+				c.Next()
+				return
+			}
+			warnOnce.Do(func() {
+				log.Printf("TracingMiddleware: the request already has a server span; set ReuseServerSpan to avoid duplicate server spans")
+			})
+		}
+
+		// Before strategies, unmatched requests were named by their path
+		legacy := c.FullPath()
+		if legacy == "" {
+			legacy = c.Request.URL.Path
+		}
+		name, nameAttrs := namer.Name(spanname.Request{
+			Method: c.Request.Method,
+			Route:  c.FullPath(),
+			Target: c.Request.URL.Path,
+			Legacy: c.Request.Method + " " + legacy,
+		})
+		ctx, span := tracer.Start(c.Request.Context(), name,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPRequestMethodKey.String(c.Request.Method),
+				semconv.URLPath(c.Request.URL.Path),
+				semconv.UserAgentOriginal(c.Request.UserAgent()),
+			),
+			trace.WithAttributes(nameAttrs...),
+		)
+		defer span.End()
+
+		c.Request = c.Request.WithContext(ctx)
+		c.Set("span", span)
+		c.Next()
+
+		if route := c.FullPath(); route != "" {
+			span.SetAttributes(semconv.HTTPRoute(route))
+		}
+		span.SetAttributes(semconv.HTTPResponseStatusCode(c.Writer.Status()))
+	}
+}
+
+// isLocalServerSpan reports whether span is a recording server span started
+// in this process. A remote parent extracted from the request headers is not
+// one: it belongs to the client.
+func isLocalServerSpan(span trace.Span) bool {
+	if !span.IsRecording() {
+		return false
+	}
+	ro, ok := span.(sdktrace.ReadOnlySpan)
+	return ok && ro.SpanKind() == trace.SpanKindServer
+}
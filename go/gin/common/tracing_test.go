@@ -0,0 +1,116 @@
+package common
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const remoteTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestTracingMiddlewareServerSpans(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name        string
+		otelgin     bool
+		reuse       bool
+		traceparent string
+		want        int
+	}{
+		{name: "otelgin, reused", otelgin: true, reuse: true, want: 1},
+		{name: "otelgin, not reused", otelgin: true, reuse: false, want: 2},
+		{name: "middleware alone", reuse: true, want: 1},
+		{name: "remote parent", reuse: true, traceparent: remoteTraceparent, want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sr := tracetest.NewSpanRecorder()
+			tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+			setTracerProvider(t, tp)
+
+			r := gin.New()
+			if tt.otelgin {
+				r.Use(otelgin.Middleware("test", otelgin.WithTracerProvider(tp)))
+			} else {
+				// Stands in for a proxy or agent that only extracts the
+				// caller's context, so the context has a remote span
+				r.Use(extractTraceContext)
+			}
+			r.Use(TracingMiddleware(TracingConfig{TracerName: "test", ReuseServerSpan: tt.reuse}))
+
+			var handlerSpan trace.Span
+			r.GET("/users/:id", func(c *gin.Context) {
+				v, _ := c.Get("span")
+				handlerSpan, _ = v.(trace.Span)
+				c.Status(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+			if tt.traceparent != "" {
+				req.Header.Set("traceparent", tt.traceparent)
+			}
+			r.ServeHTTP(httptest.NewRecorder(), req)
+
+			servers := serverSpans(sr.Ended())
+			if len(servers) != tt.want {
+				t.Fatalf("got %d server spans, want %d", len(servers), tt.want)
+			}
+			if handlerSpan == nil || !handlerSpan.SpanContext().IsValid() {
+				t.Fatal(`c.Get("span") has no span`)
+			}
+			// The handler gets the innermost server span
+			if got := handlerSpan.SpanContext().SpanID(); got != servers[0].SpanContext().SpanID() {
+				t.Errorf(`c.Get("span") is span %s, want the innermost server span %s`, got, servers[0].SpanContext().SpanID())
+			}
+
+			if tt.traceparent != "" {
+				remote := trace.SpanContextFromContext(
+					propagation.TraceContext{}.Extract(t.Context(), propagation.HeaderCarrier(req.Header)))
+				span := servers[0]
+				if span.Parent().SpanID() != remote.SpanID() || !span.Parent().IsRemote() {
+					t.Errorf("server span has parent %s, want the remote span %s", span.Parent().SpanID(), remote.SpanID())
+				}
+				if span.SpanContext().TraceID() != remote.TraceID() {
+					t.Errorf("server span is in trace %s, want the caller's %s", span.SpanContext().TraceID(), remote.TraceID())
+				}
+			}
+		})
+	}
+}
+
+// extractTraceContext puts the caller's span context from the traceparent
+// header into the request context, without starting a span.
+func extractTraceContext(c *gin.Context) {
+	ctx := propagation.TraceContext{}.Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+	c.Request = c.Request.WithContext(ctx)
+	c.Next()
+}
+
+// serverSpans returns the server spans of spans, in the order they ended:
+// the innermost first.
+func serverSpans(spans []sdktrace.ReadOnlySpan) []sdktrace.ReadOnlySpan {
+	var out []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.SpanKind() == trace.SpanKindServer {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// setTracerProvider installs tp as the global provider TracingMiddleware
+// takes its tracer from, until the test ends.
+func setTracerProvider(t *testing.T, tp trace.TracerProvider) {
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(tp)
+	t.Cleanup(func() { otel.SetTracerProvider(prev) })
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	httpagent "github.com/last9/go-agent/integrations/http"
+	"github.com/redis/go-redis/v9"
+)
+
+const slowMaxDelay = 30 * time.Second
+
+// upstreamClient calls /upstream. It has no Timeout of its own: the request's
+// deadline is what stops it.
+var upstreamClient = httpagent.NewClient(&http.Client{})
+
+// slowHandler returns a handler that waits ?delay= (default 3s) on Postgres
+// (?via=sql), Redis (?via=redis) or an HTTP call to /upstream (?via=http).
+// Under a shorter route deadline, each of them gives up when the deadline
+// passes, and the client gets a 503 from common.Deadline.
+func slowHandler(sqlDB *sql.DB, rdb *redis.Client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		delay, err := parseDelay(c, 3*time.Second)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		switch via := c.DefaultQuery("via", "sql"); via {
+		case "sql":
+			// lib/pq cancels the query on the server when ctx is done
+			_, err = sqlDB.ExecContext(ctx, "SELECT pg_sleep($1)", delay.Seconds())
+		case "redis":
+			// BLPOP on a key nobody pushes to blocks for delay. go-redis only
+			// stops waiting at the deadline with ContextTimeoutEnabled set
+			err = rdb.BLPop(ctx, delay, "deadline-example:never").Err()
+			if errors.Is(err, redis.Nil) {
+				err = nil
+			}
+		case "http":
+			err = slowCall(ctx, c.Request.Host, delay)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": "via must be sql, redis or http"})
+			return
+		}
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			// Leave the response to common.Deadline
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "slow call failed"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"via": c.DefaultQuery("via", "sql"), "delay": delay.String()})
+	}
+}
+
+// slowCall calls this server's /upstream, which takes delay to answer. The
+// request carries ctx, so the client gives up when ctx's deadline passes.
+func slowCall(ctx context.Context, host string, delay time.Duration) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/upstream?delay="+delay.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// upstreamHandler stands in for a slow dependency: it answers after ?delay=,
+// or stops early if the caller goes away.
+func upstreamHandler(c *gin.Context) {
+	delay, err := parseDelay(c, time.Second)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-c.Request.Context().Done():
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"delay": delay.String()})
+}
+
+func parseDelay(c *gin.Context, fallback time.Duration) (time.Duration, error) {
+	s := c.Query("delay")
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, serr := strconv.ParseFloat(s, 64)
+		if serr != nil {
+			return 0, errors.New("delay must be a duration such as 2s")
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < 0 || d > slowMaxDelay {
+		return 0, errors.New("delay must be between 0 and 30s")
+	}
+	return d, nil
+}
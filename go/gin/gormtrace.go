@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// gormTracerName names the tracer of the preload and migration spans. The
+// query spans come from the GORM OpenTelemetry plugin.
+const gormTracerName = "gin-example/gorm"
+
+// preloadPlugin wraps the preloads of a query in a gorm.Preload span, under
+// the span of the query that loaded the parent rows. Without it the preload
+// queries are children of that span like any other, and a trace doesn't show
+// which queries GORM added, for which associations, or for how many parent
+// rows.
+type preloadPlugin struct{}
+
+func (preloadPlugin) Name() string { return "gin-example:preload" }
+
+// Initialize registers the end hook before gorm:after_query, so the span ends
+// before the OpenTelemetry plugin ends the query span.
+func (preloadPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback().Query()
+	if err := cb.Before("gorm:preload").Register("gin-example:before_preload", startPreload); err != nil {
+		return err
+	}
+	return cb.After("gorm:preload").Before("gorm:after_query").Register("gin-example:after_preload", endPreload)
+}
+
+type preloadCtx struct {
+	context.Context
+	parent context.Context
+}
+
+func startPreload(tx *gorm.DB) {
+	if len(tx.Statement.Preloads) == 0 {
+		return
+	}
+	preloads := make([]string, 0, len(tx.Statement.Preloads))
+	for name := range tx.Statement.Preloads {
+		preloads = append(preloads, name)
+	}
+	sort.Strings(preloads)
+
+	ctx, _ := otel.Tracer(gormTracerName).Start(tx.Statement.Context, "gorm.Preload",
+		trace.WithAttributes(
+			attribute.String("db.collection.name", tx.Statement.Table),
+			attribute.StringSlice("gorm.preload", preloads),
+			attribute.Int64("gorm.preload.parent_rows", tx.Statement.RowsAffected),
+		))
+	tx.Statement.Context = preloadCtx{ctx, tx.Statement.Context}
+}
+
+func endPreload(tx *gorm.DB) {
+	c, ok := tx.Statement.Context.(preloadCtx)
+	if !ok {
+		return
+	}
+	tx.Statement.Context = c.parent
+	span := trace.SpanFromContext(c)
+	if tx.Error != nil && tx.Error != gorm.ErrRecordNotFound {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+	span.End()
+}
+
+// slowQueryPlugin flags queries slower than threshold: their span gets
+// db.slow=true and a db.slow_query event at WARN severity. Use the same
+// threshold for the GORM logger's SlowThreshold, so the logged slow queries
+// match the flagged spans.
+type slowQueryPlugin struct {
+	threshold time.Duration
+}
+
+func (p slowQueryPlugin) Name() string { return "gin-example:slow_query" }
+
+// Initialize registers a timer around each GORM operation. The end hook
+// runs before the OpenTelemetry plugin's, which ends the query span.
+func (p slowQueryPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	ops := []struct {
+		start, end gormRegister
+		name       string
+	}{
+		{cb.Create().Before("gorm:create"), cb.Create().After("gorm:create").Before("otel:after:create"), "create"},
+		{cb.Query().Before("gorm:query"), cb.Query().After("gorm:query").Before("otel:after:select"), "select"},
+		{cb.Update().Before("gorm:update"), cb.Update().After("gorm:update").Before("otel:after:update"), "update"},
+		{cb.Delete().Before("gorm:delete"), cb.Delete().After("gorm:delete").Before("otel:after:delete"), "delete"},
+		{cb.Row().Before("gorm:row"), cb.Row().After("gorm:row").Before("otel:after:row"), "row"},
+		{cb.Raw().Before("gorm:raw"), cb.Raw().After("gorm:raw").Before("otel:after:raw"), "raw"},
+	}
+	for _, op := range ops {
+		if err := op.start.Register("gin-example:slow_query_start:"+op.name, startTimer); err != nil {
+			return err
+		}
+		if err := op.end.Register("gin-example:slow_query_end:"+op.name, p.check); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gormRegister is the part of GORM's unexported callback type used here.
+type gormRegister interface {
+	Register(name string, fn func(*gorm.DB)) error
+}
+
+const queryStartKey = "gin-example:query_start"
+
+func startTimer(tx *gorm.DB) {
+	tx.InstanceSet(queryStartKey, time.Now())
+}
+
+func (p slowQueryPlugin) check(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(queryStartKey)
+	if !ok {
+		return
+	}
+	elapsed := time.Since(v.(time.Time))
+	if elapsed < p.threshold {
+		return
+	}
+
+	span := trace.SpanFromContext(tx.Statement.Context)
+	span.SetAttributes(attribute.Bool("db.slow", true))
+	span.AddEvent("db.slow_query", trace.WithAttributes(
+		attribute.String("log.severity_text", "WARN"),
+		attribute.Int("log.severity_number", 13),
+		attribute.Float64("db.slow.threshold", p.threshold.Seconds()),
+		attribute.Float64("db.client.operation.duration", elapsed.Seconds()),
+	))
+}
+
+// autoMigrate runs AutoMigrate under a gorm.AutoMigrate span, with the DDL
+// statements it issues as child spans.
+func autoMigrate(ctx context.Context, db *gorm.DB, models ...interface{}) error {
+	names := make([]string, 0, len(models))
+	for _, m := range models {
+		names = append(names, fmt.Sprintf("%T", m))
+	}
+	ctx, span := otel.Tracer(gormTracerName).Start(ctx, "gorm.AutoMigrate",
+		trace.WithAttributes(attribute.StringSlice("gorm.migrate.models", names)))
+	defer span.End()
+
+	if err := db.WithContext(ctx).AutoMigrate(models...); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// initMetricsExporter replaces the global meter provider with one that has
+// the example's views, exported as chosen by METRICS_EXPORTER:
+//
+//   - otlp, the default, pushes metrics to OTEL_EXPORTER_OTLP_ENDPOINT every
+//     minute, over the same gRPC exporter as go-agent
+//   - prometheus is read by the OpenTelemetry Prometheus exporter, and the
+//     returned handler serves it, for /metrics
+//
+// go-agent's own meter provider takes no views, so only its runtime metrics
+// stay on it. Call it right after agent.Start, before any instrument is
+// created: instruments stay with the meter provider that was global when
+// they were created.
+func initMetricsExporter() (http.Handler, func(context.Context) error, error) {
+	noop := func(context.Context) error { return nil }
+
+	var reader sdkmetric.Reader
+	var handler http.Handler
+	switch exporter := strings.ToLower(os.Getenv("METRICS_EXPORTER")); exporter {
+	case "", "otlp":
+		// Configured by the OTEL_EXPORTER_OTLP_* variables, like go-agent's
+		exp, err := otlpmetricgrpc.New(context.Background())
+		if err != nil {
+			return nil, noop, fmt.Errorf("create otlp metric exporter: %w", err)
+		}
+		reader = sdkmetric.NewPeriodicReader(exp, sdkmetric.WithInterval(time.Minute))
+	case "prometheus":
+		// A registry of its own, rather than prometheus.DefaultRegisterer, so
+		// /metrics doesn't also serve client_golang's Go collector next to the
+		// OpenTelemetry runtime metrics below
+		registry := prometheus.NewRegistry()
+		exp, err := otelprom.New(otelprom.WithRegisterer(registry))
+		if err != nil {
+			return nil, noop, fmt.Errorf("create prometheus exporter: %w", err)
+		}
+		reader = exp
+		handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+	default:
+		return nil, noop, fmt.Errorf("METRICS_EXPORTER %q: want otlp or prometheus", exporter)
+	}
+
+	// The same service.name and OTEL_RESOURCE_ATTRIBUTES as go-agent's
+	// resource; served as the target_info metric by Prometheus
+	res, err := resource.New(context.Background(),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, noop, fmt.Errorf("create resource: %w", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(reader),
+		sdkmetric.WithResource(res),
+		sdkmetric.WithView(metricView(latencyAggregation())),
+	)
+	otel.SetMeterProvider(mp)
+
+	if handler != nil {
+		// go-agent started the runtime metrics on its own provider, which
+		// still pushes them over OTLP; these are for the scrape
+		if err := runtime.Start(
+			runtime.WithMeterProvider(mp),
+			runtime.WithMinimumReadMemStatsInterval(15*time.Second),
+		); err != nil {
+			log.Printf("failed to start runtime metrics for prometheus: %v", err)
+		}
+	}
+
+	return handler, mp.Shutdown, nil
+}
+
+// metricRenames maps instrument names to the names the organization's
+// dashboards use, from before they were instrumented with OpenTelemetry
+var metricRenames = map[string]string{
+	"http.server.request.duration":  "http_request_duration_seconds",
+	"http.server.request.body.size": "http_request_size_bytes",
+}
+
+// httpServerAttributes are the only attributes kept on the HTTP server
+// histograms: one series per route, method and status
+var httpServerAttributes = []attribute.Key{
+	"http.request.method",
+	"http.route",
+	"http.response.status_code",
+}
+
+// highCardinalityAttributes are dropped from every other histogram. Each has
+// a value per client, per URL or per connection
+var highCardinalityAttributes = []attribute.Key{
+	"url.full",
+	"url.path",
+	"url.query",
+	"user_agent.original",
+	"client.address",
+	"client.port",
+	"network.peer.address",
+	"network.peer.port",
+}
+
+// metricView is the meter provider's only view. It renames the instruments
+// in metricRenames, limits the attributes of every histogram, and gives the
+// histograms in seconds agg, if set. The SDK exports an instrument once per
+// view that matches it, so these are one view rather than one each.
+func metricView(agg sdkmetric.Aggregation) sdkmetric.View {
+	keepHTTP := attribute.NewAllowKeysFilter(httpServerAttributes...)
+	dropHigh := attribute.NewDenyKeysFilter(highCardinalityAttributes...)
+
+	return func(i sdkmetric.Instrument) (sdkmetric.Stream, bool) {
+		s := sdkmetric.Stream{Name: i.Name, Description: i.Description, Unit: i.Unit}
+		name, renamed := metricRenames[i.Name]
+		if renamed {
+			s.Name = name
+		}
+		if i.Kind != sdkmetric.InstrumentKindHistogram {
+			return s, renamed
+		}
+		if strings.HasPrefix(i.Name, "http.server.") {
+			s.AttributeFilter = keepHTTP
+		} else {
+			s.AttributeFilter = dropHigh
+		}
+		if i.Unit == "s" {
+			s.Aggregation = agg
+		}
+		return s, true
+	}
+}
+
+// latencyAggregation returns the aggregation of the histograms in seconds
+// set by LATENCY_HISTOGRAM: nil for explicit, the default, so every
+// histogram keeps its own bucket boundaries, or a base-2 exponential
+// histogram for exponential. Its buckets follow the latencies actually
+// recorded; Prometheus scrapes it as a native histogram.
+func latencyAggregation() sdkmetric.Aggregation {
+	switch v := strings.ToLower(os.Getenv("LATENCY_HISTOGRAM")); v {
+	case "", "explicit":
+		return nil
+	case "exponential":
+		// The SDK defaults: up to 160 buckets per sign, at the finest scale
+		// the recorded range allows
+		return sdkmetric.AggregationBase2ExponentialHistogram{MaxSize: 160, MaxScale: 20}
+	default:
+		log.Printf("unknown LATENCY_HISTOGRAM %q, using explicit", v)
+		return nil
+	}
+}
@@ -2,129 +2,83 @@ package users
 
 import (
 	"gin_example/common"
-	"log"
-	"strconv"
+	"net/http"
 
 	"github.com/gin-gonic/gin"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 )
 
+// UsersHandler adapts the shared users service to Gin.
 type UsersHandler struct {
-	controller *UsersController
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
+		service: s,
 	}
 }
 
 func (u *UsersHandler) GetUsers(c *gin.Context) {
-	users, err := u.controller.GetUsers(c.Request.Context())
+	users, err := u.service.List(c.Request.Context())
 	if err != nil {
-		// Record detailed exception information
-		common.RecordExceptionInSpan(c, "Failed to fetch users",
-			"error_type", "database_error",
-			"operation", "get_users",
-			"details", err.Error())
-		c.JSON(500, gin.H{"error": "Failed to fetch users"})
+		u.fail(c, err, "get_users")
 		return
 	}
-	c.JSON(200, users)
+	c.JSON(http.StatusOK, users)
 }
 
 func (u *UsersHandler) GetUser(c *gin.Context) {
-	id := c.Param("id")
-	user, err := u.controller.GetUser(c.Request.Context(), id)
+	user, err := u.service.Get(c.Request.Context(), c.Param("id"))
 	if err != nil {
-		// Record detailed exception information
-		common.RecordExceptionInSpan(c, "User not found",
-			"error_type", "not_found",
-			"operation", "get_user",
-			"user_id", id,
-			"details", err.Error())
-		c.JSON(404, gin.H{"message": "User not found"})
+		u.fail(c, err, "get_user")
 		return
 	}
-	c.JSON(200, user)
+	c.JSON(http.StatusOK, user)
 }
 
 func (u *UsersHandler) CreateUser(c *gin.Context) {
-	log.Println("here")
-	var newUser User
-	if err := c.ShouldBindJSON(&newUser); err != nil {
-		// Record validation error
-		common.RecordExceptionInSpan(c, "Invalid input data",
-			"error_type", "validation_error",
-			"operation", "create_user",
-			"details", err.Error())
-		c.JSON(400, gin.H{"error": "Invalid input data"})
+	var in commonusers.CreateInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		u.fail(c, commonusers.ErrInvalidInput, "create_user")
 		return
 	}
-	err := u.controller.CreateUser(c.Request.Context(), &newUser)
+	user, err := u.service.Create(c.Request.Context(), in)
 	if err != nil {
-		// Record database error with stack trace
-		common.RecordExceptionWithStack(c, err,
-			"operation", "create_user",
-			"user_name", newUser.Name,
-			"user_email", newUser.Email)
-		c.JSON(500, gin.H{"error": err})
+		u.fail(c, err, "create_user")
 		return
 	}
-	c.JSON(201, nil)
+	c.JSON(http.StatusCreated, user)
 }
 
 func (u *UsersHandler) UpdateUser(c *gin.Context) {
-	id := c.Param("id")
-	idInt, err := strconv.ParseInt(id, 10, 32)
-
-	if err != nil {
-		// Record validation error
-		common.RecordExceptionInSpan(c, "Invalid user ID format",
-			"error_type", "validation_error",
-			"operation", "update_user",
-			"user_id", id,
-			"details", err.Error())
-		c.JSON(400, gin.H{"message": "Invalid ID"})
+	var in commonusers.UpdateInput
+	if err := c.ShouldBindJSON(&in); err != nil {
+		u.fail(c, commonusers.ErrInvalidInput, "update_user")
 		return
 	}
-
-	name := c.PostForm("name")
-	user := u.controller.UpdateUser(int(idInt), name)
-	if user == nil {
-		// Record not found error
-		common.RecordExceptionInSpan(c, "User not found for update",
-			"error_type", "not_found",
-			"operation", "update_user",
-			"user_id", idInt)
-		c.JSON(404, gin.H{"message": "User not found"})
+	user, err := u.service.Update(c.Request.Context(), c.Param("id"), in)
+	if err != nil {
+		u.fail(c, err, "update_user")
 		return
 	}
-	c.JSON(200, user)
+	c.JSON(http.StatusOK, user)
 }
 
 func (u *UsersHandler) DeleteUser(c *gin.Context) {
-	id := c.Param("id")
-	idInt, err := strconv.ParseInt(id, 10, 32)
-
-	if err != nil {
-		// Record validation error
-		common.RecordExceptionInSpan(c, "Invalid user ID format",
-			"error_type", "validation_error",
-			"operation", "delete_user",
-			"user_id", id,
-			"details", err.Error())
-		c.JSON(400, gin.H{"message": "Invalid ID"})
+	if err := u.service.Delete(c.Request.Context(), c.Param("id")); err != nil {
+		u.fail(c, err, "delete_user")
 		return
 	}
+	c.Status(http.StatusNoContent)
+}
 
-	err = u.controller.DeleteUser(c.Request.Context(), int(idInt))
-	if err != nil {
-		// Record database error with stack trace
-		common.RecordExceptionWithStack(c, err,
-			"operation", "delete_user",
-			"user_id", idInt)
-		c.JSON(500, gin.H{"error": "Failed to delete user"})
-		return
+// fail writes the error response. Server errors also get a stack trace on the
+// request span; the service span already carries the error itself.
+func (u *UsersHandler) fail(c *gin.Context, err error, operation string) {
+	status := commonusers.StatusCode(err)
+	if status >= http.StatusInternalServerError {
+		common.RecordExceptionWithStack(c, err, "operation", operation)
 	}
-	c.JSON(204, nil)
+	c.JSON(status, commonusers.ErrorBody(err))
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"gin_example/jobs"
+	"gin_example/last9"
+	"log"
+	"mime"
+	"net/mail"
+	"time"
+)
+
+// emailHandler returns the handler of email jobs, which sends the email in
+// the job's payload through sender. A failed send fails the job; canceling
+// ctx, when shutdown gives up waiting, closes the SMTP connection and the
+// job is requeued.
+func emailHandler(sender *last9.SMTPSender, from string) jobs.Handler {
+	return func(ctx context.Context, job *jobs.Job) error {
+		payload, ok := job.Payload.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid payload type")
+		}
+		to, _ := payload["to"].(string)
+		subject, _ := payload["subject"].(string)
+		body, _ := payload["body"].(string)
+		if _, err := mail.ParseAddress(to); err != nil {
+			return fmt.Errorf("invalid recipient %q: %w", to, err)
+		}
+
+		log.Printf("Sending email to %v: %v", to, subject)
+		msg := newMessage(from, to, subject, body, job.ID)
+		if err := sender.Send(ctx, from, []string{to}, msg); err != nil {
+			return fmt.Errorf("send email: %w", err)
+		}
+		return nil
+	}
+}
+
+// newMessage formats a plain-text email. Its Message-ID is derived from the
+// job's, so a message sent twice by a redelivered job can be recognized.
+func newMessage(from, to, subject, body, jobID string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@gin-redis7-example>\r\n", jobID)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(body)
+	b.WriteString("\r\n")
+	return b.Bytes()
+}
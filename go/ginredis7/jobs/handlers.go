@@ -0,0 +1,102 @@
+package jobs
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultListLimit = 20
+	maxListLimit     = 100
+)
+
+type JobsHandler struct {
+	store     *Store
+	processor *Processor
+}
+
+func NewJobsHandler(store *Store, processor *Processor) *JobsHandler {
+	return &JobsHandler{store: store, processor: processor}
+}
+
+// ListJobs returns the most recent jobs, optionally filtered with ?status=
+// and capped with ?limit=.
+func (h *JobsHandler) ListJobs(c *gin.Context) {
+	status := Status(c.Query("status"))
+	if status != "" && !validStatus(status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid status"})
+		return
+	}
+
+	limit := defaultListLimit
+	if v := c.Query("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxListLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+
+	jobs, err := h.store.List(c.Request.Context(), status, limit)
+	if err != nil {
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list jobs"})
+		return
+	}
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetJob returns the current state of a job.
+func (h *JobsHandler) GetJob(c *gin.Context) {
+	job, err := h.store.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to fetch job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// CancelJob cancels a pending job.
+func (h *JobsHandler) CancelJob(c *gin.Context) {
+	job, err := h.processor.Cancel(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to cancel job")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryJob publishes a failed job again.
+func (h *JobsHandler) RetryJob(c *gin.Context) {
+	job, err := h.processor.Retry(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		h.writeError(c, err, "Failed to retry job")
+		return
+	}
+	c.JSON(http.StatusAccepted, job)
+}
+
+func (h *JobsHandler) writeError(c *gin.Context, err error, msg string) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, ErrInvalidTransition):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.Error(err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
+	}
+}
+
+func validStatus(s Status) bool {
+	for _, st := range Statuses {
+		if st == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+// Package jobs is the email job queue: jobs are published to RabbitMQ,
+// processed by a consumer and their state is kept in Redis so it can be
+// queried through the API.
+package jobs
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type Status string
+
+const (
+	StatusPending  Status = "pending"
+	StatusComplete Status = "complete"
+	StatusFailed   Status = "failed"
+	StatusCanceled Status = "canceled"
+)
+
+// Statuses lists every status, in lifecycle order.
+var Statuses = []Status{StatusPending, StatusComplete, StatusFailed, StatusCanceled}
+
+// transitions lists the statuses each status can move to. Pending jobs can be
+// canceled, and failed jobs go back to pending when they are retried.
+var transitions = map[Status][]Status{
+	StatusPending: {StatusComplete, StatusFailed, StatusCanceled},
+	StatusFailed:  {StatusPending},
+}
+
+func canTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+type Job struct {
+	ID          string      `json:"id"`
+	Type        string      `json:"type"`
+	Queue       string      `json:"queue"`
+	Payload     interface{} `json:"payload"`
+	Status      Status      `json:"status"`
+	Attempts    int         `json:"attempts"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	CompletedAt *time.Time  `json:"completed_at,omitempty"`
+	Error       string      `json:"error,omitempty"`
+	// TraceContext is the W3C trace context of the request that created the
+	// job. Later actions on the job link back to that trace.
+	TraceContext map[string]string `json:"trace_context,omitempty"`
+}
+
+// OriginLink returns a link to the trace that created the job, if it was
+// recorded.
+func (j *Job) OriginLink() (trace.Link, bool) {
+	ctx := propagation.TraceContext{}.Extract(context.Background(), propagation.MapCarrier(j.TraceContext))
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return trace.Link{}, false
+	}
+	return trace.Link{SpanContext: sc}, true
+}
+
+// validate reports whether a decoded job has the fields the consumer needs.
+func (j *Job) validate() error {
+	switch {
+	case j.ID == "":
+		return errors.New("job has no id")
+	case j.Type == "":
+		return errors.New("job has no type")
+	}
+	return nil
+}
+
+func (j *Job) setOrigin(ctx context.Context) {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	if len(carrier) > 0 {
+		j.TraceContext = carrier
+	}
+}
+
+type Handler func(context.Context, *Job) error
+
+var (
+	// ErrNotFound is returned when a job ID is unknown or its state has
+	// expired.
+	ErrNotFound = errors.New("job not found")
+	// ErrInvalidTransition is returned when a job can't move to the
+	// requested status, for example when canceling a job that has already
+	// completed.
+	ErrInvalidTransition = errors.New("invalid job status transition")
+)
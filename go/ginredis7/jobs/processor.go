@@ -0,0 +1,397 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gin_example/last9"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// abortGrace is how long Drain waits, after its deadline, for canceled
+// handlers to return and requeue their messages.
+const abortGrace = 2 * time.Second
+
+type Processor struct {
+	broker   last9.MessageBroker
+	store    *Store
+	handlers map[string]Handler
+
+	// stop is closed by Drain to stop the consumers taking messages
+	stop     chan struct{}
+	stopOnce sync.Once
+	// consumers counts running consumer loops
+	consumers sync.WaitGroup
+	inFlight  atomic.Int64
+	// abortCtx is canceled when Drain's deadline passes, canceling the
+	// contexts of running handlers
+	abortCtx context.Context
+	abort    context.CancelFunc
+}
+
+func NewProcessor(broker last9.MessageBroker, store *Store) *Processor {
+	abortCtx, abort := context.WithCancel(context.Background())
+	return &Processor{
+		broker:   broker,
+		store:    store,
+		handlers: make(map[string]Handler),
+		stop:     make(chan struct{}),
+		abortCtx: abortCtx,
+		abort:    abort,
+	}
+}
+
+func (p *Processor) RegisterHandler(jobType string, handler Handler) {
+	p.handlers[jobType] = handler
+}
+
+// PublishJob saves a pending job and publishes it. The job is saved first so
+// its status can be queried as soon as the ID is returned.
+func (p *Processor) PublishJob(ctx context.Context, queueName string, jobType string, payload interface{}) (*Job, error) {
+	// Create new job
+	job := &Job{
+		ID:        uuid.New().String(),
+		Type:      jobType,
+		Queue:     queueName,
+		Payload:   payload,
+		Attempts:  1,
+		CreatedAt: time.Now(),
+	}
+	job.setOrigin(ctx)
+
+	if err := p.store.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	if err := p.publish(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// publish sends a pending job to its queue. If that fails the job is marked
+// failed, so it can be retried.
+func (p *Processor) publish(ctx context.Context, job *Job) error {
+	// Marshal job to JSON
+	jobBytes, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+
+	// Publish the message
+	err = p.broker.PublishMessage(ctx, job.Queue, jobBytes)
+	if err != nil {
+		err = fmt.Errorf("failed to publish job: %v", err)
+		if serr := p.store.Transition(ctx, job, StatusFailed, err); serr != nil {
+			log.Printf("Failed to update job %s: %v", job.ID, serr)
+		}
+		return err
+	}
+	return nil
+}
+
+// Cancel cancels a pending job. The consumer skips canceled jobs, and a job
+// canceled while its handler is running keeps the canceled status.
+func (p *Processor) Cancel(ctx context.Context, id string) (*Job, error) {
+	return p.act(ctx, "job.cancel", id, func(ctx context.Context, job *Job) error {
+		return p.store.Transition(ctx, job, StatusCanceled, nil)
+	})
+}
+
+// Retry moves a failed job back to pending and publishes it again with the
+// same ID.
+func (p *Processor) Retry(ctx context.Context, id string) (*Job, error) {
+	return p.act(ctx, "job.retry", id, func(ctx context.Context, job *Job) error {
+		job.Attempts++
+		if err := p.store.Transition(ctx, job, StatusPending, nil); err != nil {
+			return err
+		}
+		return p.publish(ctx, job)
+	})
+}
+
+// act runs a user action on a job in its own span. The span is linked to the
+// trace that created the job, so the job's whole history can be followed
+// from any of its traces.
+func (p *Processor) act(ctx context.Context, spanName, id string, fn func(context.Context, *Job) error) (*Job, error) {
+	ctx, span := otel.Tracer("job-processor").Start(ctx, spanName,
+		trace.WithAttributes(attribute.String("job.id", id)))
+	defer span.End()
+
+	job, err := p.store.Get(ctx, id)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	if link, ok := job.OriginLink(); ok {
+		span.AddLink(link)
+	}
+	span.SetAttributes(
+		attribute.String("job.type", job.Type),
+		attribute.String("job.status", string(job.Status)),
+		attribute.Int("job.attempts", job.Attempts),
+	)
+
+	if err := fn(ctx, job); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	return job, nil
+}
+
+func (p *Processor) StartConsumer(ctx context.Context, queueName string) error {
+	msgs, err := p.broker.ConsumeMessages(ctx, queueName)
+	if err != nil {
+		return fmt.Errorf("failed to start consumer: %v", err)
+	}
+
+	p.consumers.Add(1)
+	go func() {
+		defer p.consumers.Done()
+		for {
+			select {
+			case <-p.stop:
+				// Messages delivered but not yet taken stay unacked, and
+				// RabbitMQ requeues them when the channel is closed
+				return
+			case msg, ok := <-msgs:
+				if !ok {
+					return
+				}
+				p.process(msg, queueName)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Drain stops the consumers taking messages and waits for the jobs being
+// processed to finish. If ctx ends first, the handlers' contexts are
+// canceled, and their messages are requeued and the jobs left pending, so
+// another worker picks them up.
+func (p *Processor) Drain(ctx context.Context) error {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("jobs.in_flight", p.inFlight.Load()))
+	p.stopOnce.Do(func() { close(p.stop) })
+
+	done := make(chan struct{})
+	go func() {
+		p.consumers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+	}
+
+	interrupted := p.inFlight.Load()
+	span.AddEvent("jobs.drain_deadline_exceeded", trace.WithAttributes(
+		attribute.Int64("jobs.interrupted", interrupted),
+	))
+	p.abort()
+	select {
+	case <-done:
+	case <-time.After(abortGrace):
+	}
+	return fmt.Errorf("%d jobs still running at the drain deadline: %w", interrupted, ctx.Err())
+}
+
+// process runs one message's job under a process.job span.
+func (p *Processor) process(msg last9.Message, queueName string) {
+	p.inFlight.Add(1)
+	defer p.inFlight.Add(-1)
+
+	// Use the context from the message instead of the parent context
+	jobCtx, jobSpan := otel.Tracer("job-processor").Start(msg.Context, "process.job",
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination", queueName),
+			attribute.String("messaging.destination_kind", "queue"),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.message_id", msg.Original.MessageId),
+			attribute.String("messaging.conversation_id", msg.Original.CorrelationId),
+		))
+
+	var job Job
+	if err := json.Unmarshal(msg.Body, &job); err != nil {
+		jobSpan.RecordError(err)
+		jobSpan.SetStatus(codes.Error, "failed to unmarshal job")
+		p.rejectPoison(jobCtx, msg, queueName, "unmarshal", err)
+		jobSpan.End()
+		return
+	}
+	if err := job.validate(); err != nil {
+		jobSpan.RecordError(err)
+		jobSpan.SetStatus(codes.Error, "invalid job")
+		p.rejectPoison(jobCtx, msg, queueName, "validation", err)
+		jobSpan.End()
+		return
+	}
+
+	jobSpan.SetAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.type", job.Type),
+		attribute.String("job.status", string(job.Status)),
+		attribute.Int("job.attempts", job.Attempts),
+	)
+	// Retried jobs are processed in the trace of the retry request
+	if link, ok := job.OriginLink(); ok && link.SpanContext.TraceID() != jobSpan.SpanContext().TraceID() {
+		jobSpan.AddLink(link)
+	}
+
+	// Skip jobs canceled after they were published
+	if stored, err := p.store.Get(jobCtx, job.ID); err == nil && stored.Status != StatusPending {
+		jobSpan.AddEvent("job.skipped", trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("job.status", string(stored.Status)),
+		))
+		log.Printf("Skipping job %s: status is %s", job.ID, stored.Status)
+		p.broker.AckMessage(jobCtx, msg.Original)
+		jobSpan.End()
+		return
+	}
+
+	if handler, ok := p.handlers[job.Type]; ok {
+		// Cancel the handler if Drain gives up waiting for it
+		handlerCtx, cancel := context.WithCancel(jobCtx)
+		defer cancel()
+		stopAbort := context.AfterFunc(p.abortCtx, cancel)
+		defer stopAbort()
+		// Create handler span as child of job span
+		handlerCtx, handlerSpan := otel.Tracer("job-processor").Start(handlerCtx, "execute.handler",
+			trace.WithAttributes(
+				attribute.String("job.id", job.ID),
+				attribute.String("job.type", job.Type),
+				attribute.String("messaging.system", "rabbitmq"),
+				attribute.String("messaging.destination", queueName),
+				attribute.String("messaging.destination_kind", "queue"),
+				attribute.String("messaging.operation", "process"),
+				attribute.String("messaging.message_id", msg.Original.MessageId),
+				attribute.String("messaging.conversation_id", msg.Original.CorrelationId),
+			))
+
+		err := handler(handlerCtx, &job)
+		if err != nil && p.abortCtx.Err() != nil {
+			// Interrupted by shutdown: hand the job to another worker
+			handlerSpan.RecordError(err)
+			handlerSpan.SetStatus(codes.Error, "interrupted by shutdown")
+			handlerSpan.AddEvent("job.interrupted", trace.WithAttributes(
+				attribute.String("job.id", job.ID),
+			))
+			log.Printf("Requeuing job %s interrupted by shutdown", job.ID)
+			p.broker.NackMessage(handlerCtx, msg.Original, true)
+		} else if err != nil {
+			handlerSpan.RecordError(err)
+			handlerSpan.SetStatus(codes.Error, err.Error())
+			log.Printf("Failed to process job %s: %v", job.ID, err)
+			p.transition(jobCtx, &job, StatusFailed, err)
+			// Use handlerCtx for NackMessage to make it a child of handler span
+			p.broker.NackMessage(handlerCtx, msg.Original, false)
+		} else {
+			handlerSpan.SetStatus(codes.Ok, "job completed successfully")
+			p.transition(jobCtx, &job, StatusComplete, nil)
+			// Use handlerCtx for AckMessage to make it a child of handler span
+			p.broker.AckMessage(handlerCtx, msg.Original)
+		}
+		handlerSpan.End()
+	} else {
+		err := fmt.Errorf("no handler for job type: %s", job.Type)
+		jobSpan.RecordError(err)
+		jobSpan.SetStatus(codes.Error, err.Error())
+		log.Printf("No handler for job type: %s", job.Type)
+		p.transition(jobCtx, &job, StatusFailed, err)
+		p.broker.NackMessage(jobCtx, msg.Original, false)
+	}
+
+	jobSpan.End()
+}
+
+// rejectPoison handles a message that can't be processed as a job. It is
+// requeued until it has failed maxPoisonDeliveries times, then moved to the
+// quarantine list and acked, so it neither blocks the queue nor disappears.
+func (p *Processor) rejectPoison(ctx context.Context, msg last9.Message, queueName, reason string, cause error) {
+	span := trace.SpanFromContext(ctx)
+
+	deliveries, err := p.store.recordPoisonDelivery(ctx, msg.Body)
+	if err != nil {
+		// Without a count the message could be redelivered forever
+		span.RecordError(err)
+		log.Printf("Dropping invalid message: %v", err)
+		p.broker.NackMessage(ctx, msg.Original, false)
+		return
+	}
+	if deliveries < maxPoisonDeliveries {
+		span.AddEvent("job.poison_requeued", trace.WithAttributes(
+			attribute.String("job.poison.reason", reason),
+			attribute.Int64("job.poison.deliveries", deliveries),
+		))
+		p.broker.NackMessage(ctx, msg.Original, true)
+		return
+	}
+
+	ctx, qSpan := otel.Tracer("job-processor").Start(ctx, "job.quarantine",
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination", queueName),
+			attribute.Int("messaging.message_size", len(msg.Body)),
+			attribute.String("job.poison.reason", reason),
+			attribute.Int64("job.poison.deliveries", deliveries),
+			attribute.String(snippetKey, p.store.snippet(msg.Body)),
+			attribute.String("error.message", cause.Error()),
+		))
+	defer qSpan.End()
+
+	size, err := p.store.Quarantine(ctx, &QuarantinedMessage{
+		Queue:         queueName,
+		Reason:        reason,
+		Error:         cause.Error(),
+		Deliveries:    deliveries,
+		Body:          msg.Body,
+		QuarantinedAt: time.Now(),
+	})
+	if err != nil {
+		qSpan.RecordError(err)
+		qSpan.SetStatus(codes.Error, err.Error())
+		log.Printf("Dropping invalid message: %v", err)
+		p.broker.NackMessage(ctx, msg.Original, false)
+		return
+	}
+
+	qSpan.SetAttributes(attribute.Int64("job.quarantine.size", size))
+	log.Printf("Quarantined invalid message from %s after %d deliveries: %v", queueName, deliveries, cause)
+	p.broker.AckMessage(ctx, msg.Original)
+}
+
+// transition records the job's new status. A failure to save it is logged
+// and recorded on the span but does not change how the message is settled.
+func (p *Processor) transition(ctx context.Context, job *Job, to Status, jobErr error) {
+	err := p.store.Transition(ctx, job, to, jobErr)
+	if errors.Is(err, ErrInvalidTransition) {
+		// The job was canceled while its handler was running
+		trace.SpanFromContext(ctx).AddEvent("job.result_discarded", trace.WithAttributes(
+			attribute.String("job.id", job.ID),
+			attribute.String("job.status", string(to)),
+		))
+		log.Printf("Discarding %s result for job %s: %v", to, job.ID, err)
+		return
+	}
+	if err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		log.Printf("Failed to update job %s to %s: %v", job.ID, to, err)
+	}
+}
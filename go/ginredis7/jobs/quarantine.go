@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/redact"
+)
+
+const (
+	// quarantineKey is a list of messages that could not be decoded into a
+	// valid job, newest first. It is trimmed to maxQuarantined entries.
+	quarantineKey  = "jobs:quarantine"
+	maxQuarantined = 1000
+
+	// maxPoisonDeliveries is how many times a bad message is delivered before
+	// it is quarantined. Redeliveries rule out transient failures.
+	maxPoisonDeliveries = 3
+	// poisonTTL bounds how long delivery counts for a bad message are kept.
+	poisonTTL = time.Hour
+
+	// snippetKey is the span attribute holding the start of a quarantined
+	// message body.
+	snippetKey = "messaging.message.body.snippet"
+	maxSnippet = 256
+)
+
+// snippetRules mask credentials and email addresses in message body
+// snippets before they are put on spans.
+var snippetRules = []redact.Rule{
+	{Key: snippetKey, Pattern: `("(?i:password|secret|token|api_key|authorization)"\s*:\s*)"[^"]*"`, Replacement: `${1}"` + redact.Mask + `"`},
+	{Key: snippetKey, Pattern: `[\w.+-]+@[\w-]+(?:\.[\w-]+)+`, Replacement: redact.Mask},
+}
+
+// QuarantinedMessage is a message moved out of the queue because it could
+// not be processed as a job. Body is the full message; only a redacted
+// snippet of it is recorded on spans.
+type QuarantinedMessage struct {
+	Queue         string    `json:"queue"`
+	Reason        string    `json:"reason"`
+	Error         string    `json:"error"`
+	Deliveries    int64     `json:"deliveries"`
+	Body          []byte    `json:"body"`
+	QuarantinedAt time.Time `json:"quarantined_at"`
+}
+
+func poisonKey(body []byte) string {
+	sum := sha256.Sum256(body)
+	return "jobs:poison:" + hex.EncodeToString(sum[:16])
+}
+
+// recordPoisonDelivery counts a failed delivery of body and returns the
+// number of failed deliveries so far. Messages carry no ID, so they are
+// identified by a hash of the body.
+func (s *Store) recordPoisonDelivery(ctx context.Context, body []byte) (int64, error) {
+	key := poisonKey(body)
+	pipe := s.rdb.WithContext(ctx).TxPipeline()
+	incr := pipe.Incr(key)
+	pipe.Expire(key, poisonTTL)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, fmt.Errorf("failed to count poison delivery: %v", err)
+	}
+	return incr.Val(), nil
+}
+
+// Quarantine adds m to the quarantine list and clears its delivery count.
+// It returns the length of the list.
+func (s *Store) Quarantine(ctx context.Context, m *QuarantinedMessage) (int64, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal quarantined message: %v", err)
+	}
+
+	pipe := s.rdb.WithContext(ctx).TxPipeline()
+	pipe.LPush(quarantineKey, data)
+	pipe.LTrim(quarantineKey, 0, maxQuarantined-1)
+	pipe.Del(poisonKey(m.Body))
+	size := pipe.LLen(quarantineKey)
+	if _, err := pipe.Exec(); err != nil {
+		return 0, fmt.Errorf("failed to quarantine message: %v", err)
+	}
+	return size.Val(), nil
+}
+
+// QuarantineSize returns the number of quarantined messages.
+func (s *Store) QuarantineSize(ctx context.Context) (int64, error) {
+	return s.rdb.WithContext(ctx).LLen(quarantineKey).Result()
+}
+
+// snippet returns the start of body with credentials and email addresses
+// masked. The whole body is redacted before it is cut, so a match can't be
+// split at the cut and slip through.
+func (s *Store) snippet(body []byte) string {
+	v := s.redactor.Value(snippetKey, strings.ToValidUTF8(string(body), "�"))
+	if len(v) > maxSnippet {
+		v = strings.ToValidUTF8(v[:maxSnippet], "") + "..."
+	}
+	return v
+}
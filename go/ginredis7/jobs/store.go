@@ -0,0 +1,297 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/last9/opentelemetry-examples/go/common/redact"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// jobTTL is how long job state is kept in Redis after its last update.
+	jobTTL = 24 * time.Hour
+	// recentKey is a sorted set of job IDs scored by creation time, used to
+	// list recent jobs. It is trimmed to maxRecent entries.
+	recentKey = "jobs:recent"
+	maxRecent = 1000
+)
+
+func jobKey(id string) string { return "job:" + id }
+
+func statusKey(s Status) string { return "jobs:status:" + string(s) }
+
+// Store keeps job state in Redis. Each job is a JSON document under
+// job:<id>, and its ID is also a member of the jobs:status:<status> sorted
+// set, scored by the job's last update, so jobs can be counted by status
+// without scanning keys.
+type Store struct {
+	rdb      *redis.Client
+	redactor *redact.Redactor
+}
+
+// NewStore returns a Store and registers the jobs.by_status and
+// jobs.quarantine.size gauges.
+func NewStore(rdb *redis.Client) (*Store, error) {
+	redactor, err := redact.New(snippetRules...)
+	if err != nil {
+		return nil, err
+	}
+	s := &Store{rdb: rdb, redactor: redactor}
+	if err := s.registerMetrics(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create saves a new job in the pending state.
+func (s *Store) Create(ctx context.Context, job *Job) error {
+	job.Status = StatusPending
+	job.UpdatedAt = job.CreatedAt
+
+	data, err := json.Marshal(job)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+
+	pipe := s.rdb.WithContext(ctx).TxPipeline()
+	pipe.Set(jobKey(job.ID), data, jobTTL)
+	pipe.ZAdd(statusKey(StatusPending), &redis.Z{Score: float64(job.UpdatedAt.UnixNano()), Member: job.ID})
+	pipe.ZAdd(recentKey, &redis.Z{Score: float64(job.CreatedAt.UnixNano()), Member: job.ID})
+	pipe.ZRemRangeByRank(recentKey, 0, -maxRecent-1)
+	if _, err := pipe.Exec(); err != nil {
+		return fmt.Errorf("failed to save job: %v", err)
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("job.created", trace.WithAttributes(
+		attribute.String("job.id", job.ID),
+		attribute.String("job.status", string(job.Status)),
+	))
+	return nil
+}
+
+// Get returns the stored state of a job.
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := s.rdb.WithContext(ctx).Get(jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load job: %v", err)
+	}
+
+	return decodeJob(data)
+}
+
+func decodeJob(data []byte) (*Job, error) {
+	var job Job
+	if err := json.Unmarshal(data, &job); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal job: %v", err)
+	}
+	return &job, nil
+}
+
+// List returns up to limit of the most recent jobs, newest first. If status
+// is not empty, only jobs in that status are returned.
+func (s *Store) List(ctx context.Context, status Status, limit int) ([]*Job, error) {
+	const pageSize = 100
+	rdb := s.rdb.WithContext(ctx)
+
+	jobs := make([]*Job, 0, limit)
+	for start := int64(0); len(jobs) < limit && start < maxRecent; start += pageSize {
+		ids, err := rdb.ZRevRange(recentKey, start, start+pageSize-1).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list jobs: %v", err)
+		}
+		if len(ids) == 0 {
+			break
+		}
+
+		keys := make([]string, len(ids))
+		for i, id := range ids {
+			keys[i] = jobKey(id)
+		}
+		values, err := rdb.MGet(keys...).Result()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load jobs: %v", err)
+		}
+
+		for _, v := range values {
+			// Expired jobs are still in the sorted set until it is trimmed
+			data, ok := v.(string)
+			if !ok {
+				continue
+			}
+			job, err := decodeJob([]byte(data))
+			if err != nil {
+				return nil, err
+			}
+			if status != "" && job.Status != status {
+				continue
+			}
+			jobs = append(jobs, job)
+			if len(jobs) == limit {
+				break
+			}
+		}
+	}
+	return jobs, nil
+}
+
+// Transition moves job to status to and saves it. jobErr is stored as the
+// job's error when moving to failed. The change is recorded as a
+// job.status_changed event on the span in ctx, so the job's history can be
+// read off its traces.
+//
+// It returns ErrInvalidTransition if the move isn't allowed from the job's
+// status, or if the stored job is no longer in that status, for example
+// because it was canceled while a handler was running.
+func (s *Store) Transition(ctx context.Context, job *Job, to Status, jobErr error) error {
+	from := job.Status
+	if !canTransition(from, to) {
+		return fmt.Errorf("%w: %s to %s", ErrInvalidTransition, from, to)
+	}
+
+	updated := *job
+	now := time.Now()
+	updated.Status = to
+	updated.UpdatedAt = now
+	switch to {
+	case StatusComplete:
+		updated.CompletedAt = &now
+		updated.Error = ""
+	case StatusFailed:
+		if jobErr != nil {
+			updated.Error = jobErr.Error()
+		}
+	case StatusPending:
+		updated.Error = ""
+	}
+
+	data, err := json.Marshal(&updated)
+	if err != nil {
+		return fmt.Errorf("failed to marshal job: %v", err)
+	}
+
+	// WATCH makes the check and the write atomic: if another request changes
+	// the job in between, EXEC fails and the transition is rejected. The
+	// state and the status sets change together, so the gauge never counts
+	// a job under two statuses.
+	key := jobKey(job.ID)
+	err = s.rdb.WatchContext(ctx, func(tx *redis.Tx) error {
+		current, err := tx.Get(key).Bytes()
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load job: %v", err)
+		}
+		stored, err := decodeJob(current)
+		if err != nil {
+			return err
+		}
+		if stored.Status != from {
+			return fmt.Errorf("%w: job is %s, not %s", ErrInvalidTransition, stored.Status, from)
+		}
+
+		_, err = tx.TxPipelined(func(pipe redis.Pipeliner) error {
+			pipe.Set(key, data, jobTTL)
+			pipe.ZRem(statusKey(from), job.ID)
+			pipe.ZAdd(statusKey(to), &redis.Z{Score: float64(now.UnixNano()), Member: job.ID})
+			return nil
+		})
+		return err
+	}, key)
+	if err == redis.TxFailedErr {
+		return fmt.Errorf("%w: job was changed concurrently", ErrInvalidTransition)
+	}
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInvalidTransition) {
+			return err
+		}
+		return fmt.Errorf("failed to save job: %v", err)
+	}
+	*job = updated
+
+	attrs := []attribute.KeyValue{
+		attribute.String("job.id", job.ID),
+		attribute.String("job.status.from", string(from)),
+		attribute.String("job.status.to", string(to)),
+	}
+	if job.Error != "" && to == StatusFailed {
+		attrs = append(attrs, attribute.String("job.error", job.Error))
+	}
+	trace.SpanFromContext(ctx).AddEvent("job.status_changed", trace.WithAttributes(attrs...))
+	return nil
+}
+
+// CountByStatus returns the number of jobs in each status. Members last
+// updated more than jobTTL ago belong to expired jobs, so they are removed
+// before counting.
+func (s *Store) CountByStatus(ctx context.Context) (map[Status]int64, error) {
+	expired := "(" + strconv.FormatInt(time.Now().Add(-jobTTL).UnixNano(), 10)
+	pipe := s.rdb.WithContext(ctx).Pipeline()
+	cmds := make(map[Status]*redis.IntCmd, len(Statuses))
+	for _, st := range Statuses {
+		pipe.ZRemRangeByScore(statusKey(st), "-inf", expired)
+		cmds[st] = pipe.ZCard(statusKey(st))
+	}
+	if _, err := pipe.Exec(); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[Status]int64, len(cmds))
+	for st, cmd := range cmds {
+		counts[st] = cmd.Val()
+	}
+	return counts, nil
+}
+
+// registerMetrics reports the jobs.by_status gauge from the status sets and
+// the jobs.quarantine.size gauge from the quarantine list.
+//
+// A Redis error skips the gauge rather than failing the callback: an error
+// from any callback stops the reader exporting the whole collection, which
+// would also lose the final flush at shutdown, after Redis is closed.
+func (s *Store) registerMetrics() error {
+	meter := otel.Meter("job-processor")
+	_, err := meter.Int64ObservableGauge("jobs.by_status",
+		metric.WithDescription("Number of jobs in each status"),
+		metric.WithUnit("{job}"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			counts, err := s.CountByStatus(ctx)
+			if err != nil {
+				otel.Handle(err)
+				return nil
+			}
+			for st, n := range counts {
+				o.Observe(n, metric.WithAttributes(attribute.String("job.status", string(st))))
+			}
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.Int64ObservableGauge("jobs.quarantine.size",
+		metric.WithDescription("Number of messages in the quarantine list"),
+		metric.WithUnit("{message}"),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			n, err := s.QuarantineSize(ctx)
+			if err != nil {
+				otel.Handle(err)
+				return nil
+			}
+			o.Observe(n)
+			return nil
+		}))
+	return err
+}
@@ -4,22 +4,54 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/go-redis/redis/v7"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
-// OtelHook is a Redis hook that adds OpenTelemetry instrumentation
+// Context keys for the span and start time stored by the Before* hooks.
+// Unexported struct types can't collide with keys set by other packages.
+type (
+	cmdStartKey      struct{}
+	pipelineStartKey struct{}
+)
+
+type hookStart struct {
+	span  trace.Span
+	start time.Time
+}
+
+// OtelHook is a Redis hook that adds OpenTelemetry instrumentation.
+//
+// Single commands get one span each. Pipelines and transactions (TxPipeline)
+// get one span for the whole round trip, with the command count and the
+// individual command names as attributes, rather than one span per queued
+// command. Every command or pipeline also records its latency in the
+// db.client.operation.duration histogram.
 type OtelHook struct {
-	tracer trace.Tracer
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
 }
 
 // NewOtelHook creates a new Redis hook with OpenTelemetry instrumentation
 func NewOtelHook(tracerName string) *OtelHook {
+	duration, err := otel.Meter(tracerName).Float64Histogram("db.client.operation.duration",
+		metric.WithDescription("Duration of Redis commands and pipelines"),
+		metric.WithUnit("s"),
+		metric.WithExplicitBucketBoundaries(0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
 	return &OtelHook{
-		tracer: otel.Tracer(tracerName),
+		tracer:   otel.Tracer(tracerName),
+		duration: duration,
 	}
 }
 
@@ -30,21 +62,16 @@ func (h *OtelHook) BeforeProcess(ctx context.Context, cmd redis.Cmder) (context.
 	}
 
 	cmdName := cmd.Name()
-	spanName := fmt.Sprintf("redis:%s", cmdName)
-
-	// Get the parent span context if it exists
-	ctx, span := h.tracer.Start(ctx, spanName, trace.WithSpanKind(trace.SpanKindClient))
-
-	// Add db.* semantic attributes consistently
-	span.SetAttributes(
-		attribute.String("db.system", "redis"),
-		attribute.String("db.operation", cmdName),
-		attribute.String("db.statement", formatCmd(cmd)),
+	ctx, span := h.tracer.Start(ctx, "redis:"+cmdName,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", cmdName),
+			attribute.String("db.statement", formatCmd(cmd)),
+		),
 	)
 
-	// Store the span in the context to access it in AfterProcess
-	ctx = context.WithValue(ctx, cmdName, span)
-	return ctx, nil
+	return context.WithValue(ctx, cmdStartKey{}, hookStart{span: span, start: time.Now()}), nil
 }
 
 // AfterProcess implements redis.Hook interface
@@ -53,14 +80,23 @@ func (h *OtelHook) AfterProcess(ctx context.Context, cmd redis.Cmder) error {
 		return nil
 	}
 
-	if span, ok := ctx.Value(cmd.Name()).(trace.Span); ok {
-		if err := cmd.Err(); err != nil && err != redis.Nil {
-			// Record error in the span
-			span.RecordError(err)
-		}
+	s, ok := ctx.Value(cmdStartKey{}).(hookStart)
+	if !ok {
+		return nil
+	}
+	defer s.span.End()
 
-		span.End()
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", cmd.Name()),
+	}
+	// redis.Nil means "key not found", which is a normal result.
+	if err := cmd.Err(); err != nil && err != redis.Nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		attrs = append(attrs, attribute.String("error.type", errorType(err)))
 	}
+	h.duration.Record(ctx, time.Since(s.start).Seconds(), metric.WithAttributes(attrs...))
 
 	return nil
 }
@@ -71,26 +107,28 @@ func (h *OtelHook) BeforeProcessPipeline(ctx context.Context, cmds []redis.Cmder
 		ctx = context.Background()
 	}
 
-	ctx, span := h.tracer.Start(ctx, "redis:pipeline", trace.WithSpanKind(trace.SpanKindClient))
+	operation, queued := pipelineOperation(cmds)
 
-	// Create a combined statement for the pipeline
-	var statements []string
-	for _, cmd := range cmds {
+	statements := make([]string, 0, len(queued))
+	names := make([]string, 0, len(queued))
+	for _, cmd := range queued {
 		statements = append(statements, formatCmd(cmd))
+		names = append(names, cmd.Name())
 	}
-	pipelineStatement := strings.Join(statements, "; ")
 
-	// Add db.* semantic attributes consistently
-	span.SetAttributes(
-		attribute.String("db.system", "redis"),
-		attribute.String("db.operation", "pipeline"),
-		attribute.String("db.statement", pipelineStatement),
-		attribute.Int("redis.num_commands", len(cmds)),
+	ctx, span := h.tracer.Start(ctx, "redis:"+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "redis"),
+			attribute.String("db.operation", operation),
+			attribute.String("db.statement", strings.Join(statements, "; ")),
+			attribute.Int("db.operation.batch.size", len(queued)),
+			attribute.StringSlice("redis.pipeline.commands", names),
+			attribute.Bool("redis.pipeline.transaction", operation == "multi"),
+		),
 	)
 
-	// Store the span in the context
-	ctx = context.WithValue(ctx, "pipeline", span)
-	return ctx, nil
+	return context.WithValue(ctx, pipelineStartKey{}, hookStart{span: span, start: time.Now()}), nil
 }
 
 // AfterProcessPipeline implements redis.Hook interface
@@ -99,21 +137,119 @@ func (h *OtelHook) AfterProcessPipeline(ctx context.Context, cmds []redis.Cmder)
 		return nil
 	}
 
-	if span, ok := ctx.Value("pipeline").(trace.Span); ok {
-		// Check for errors
-		for _, cmd := range cmds {
-			if err := cmd.Err(); err != nil && err != redis.Nil {
-				span.RecordError(err)
-				break
+	s, ok := ctx.Value(pipelineStartKey{}).(hookStart)
+	if !ok {
+		return nil
+	}
+	defer s.span.End()
+
+	operation, queued := pipelineOperation(cmds)
+	attrs := []attribute.KeyValue{
+		attribute.String("db.system", "redis"),
+		attribute.String("db.operation", operation),
+	}
+
+	// A pipeline does not fail as a whole: each command has its own result.
+	// Count the failures and record the first one on the span.
+	var firstErr error
+	failed := 0
+	for _, cmd := range queued {
+		if err := cmd.Err(); err != nil && err != redis.Nil {
+			failed++
+			if firstErr == nil {
+				firstErr = err
 			}
 		}
-
-		span.End()
 	}
+	s.span.SetAttributes(attribute.Int("redis.pipeline.failed_commands", failed))
+	if firstErr != nil {
+		s.span.RecordError(firstErr)
+		s.span.SetStatus(codes.Error, fmt.Sprintf("%d of %d commands failed: %v", failed, len(queued), firstErr))
+		attrs = append(attrs, attribute.String("error.type", errorType(firstErr)))
+	}
+	h.duration.Record(ctx, time.Since(s.start).Seconds(), metric.WithAttributes(attrs...))
 
 	return nil
 }
 
+// pipelineOperation reports whether cmds is a plain pipeline or a
+// transaction, and returns the user's commands. TxPipeline wraps the queued
+// commands in MULTI ... EXEC before the hooks see them.
+func pipelineOperation(cmds []redis.Cmder) (string, []redis.Cmder) {
+	n := len(cmds)
+	if n >= 2 && cmds[0].Name() == "multi" && cmds[n-1].Name() == "exec" {
+		return "multi", cmds[1 : n-1]
+	}
+	return "pipeline", cmds
+}
+
+// errorType returns a low-cardinality error.type value. Redis error replies
+// start with an error prefix such as WRONGTYPE or NOSCRIPT.
+func errorType(err error) string {
+	if rerr, ok := err.(redis.Error); ok {
+		msg := rerr.Error()
+		if i := strings.IndexByte(msg, ' '); i > 0 {
+			return msg[:i]
+		}
+		return msg
+	}
+	return fmt.Sprintf("%T", err)
+}
+
+// InstrumentPoolStats reports rdb's connection pool statistics as metrics:
+//
+//   - db.client.connections.usage{state=idle|used}  current connections
+//   - db.client.connections.stale                     connections removed as stale
+//   - redis.pool.hits / redis.pool.misses             free connection found / not found
+//   - db.client.connections.timeouts                  waits for a connection that timed out
+//
+// The last four are cumulative counters kept by go-redis.
+func InstrumentPoolStats(rdb *redis.Client, meterName string) error {
+	meter := otel.Meter(meterName)
+	poolAttr := attribute.String("db.client.connections.pool.name", rdb.Options().Addr)
+
+	usage, err := meter.Int64ObservableUpDownCounter("db.client.connections.usage",
+		metric.WithDescription("Number of connections in the pool, by state"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	stale, err := meter.Int64ObservableCounter("db.client.connections.stale",
+		metric.WithDescription("Number of stale connections removed from the pool"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	hits, err := meter.Int64ObservableCounter("redis.pool.hits",
+		metric.WithDescription("Number of times a free connection was found in the pool"))
+	if err != nil {
+		return err
+	}
+	misses, err := meter.Int64ObservableCounter("redis.pool.misses",
+		metric.WithDescription("Number of times a free connection was not found in the pool"))
+	if err != nil {
+		return err
+	}
+	timeouts, err := meter.Int64ObservableCounter("db.client.connections.timeouts",
+		metric.WithDescription("Number of times waiting for a pool connection timed out"))
+	if err != nil {
+		return err
+	}
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := rdb.PoolStats()
+		idle := int64(s.IdleConns)
+		o.ObserveInt64(usage, idle, metric.WithAttributes(poolAttr, attribute.String("state", "idle")))
+		o.ObserveInt64(usage, int64(s.TotalConns)-idle, metric.WithAttributes(poolAttr, attribute.String("state", "used")))
+		o.ObserveInt64(stale, int64(s.StaleConns), metric.WithAttributes(poolAttr))
+		o.ObserveInt64(hits, int64(s.Hits), metric.WithAttributes(poolAttr))
+		o.ObserveInt64(misses, int64(s.Misses), metric.WithAttributes(poolAttr))
+		o.ObserveInt64(timeouts, int64(s.Timeouts), metric.WithAttributes(poolAttr))
+		return nil
+	}, usage, stale, hits, misses, timeouts)
+	return err
+}
+
 // formatCmd formats a Redis command and its arguments for db.statement
 func formatCmd(cmd redis.Cmder) string {
 	args := cmd.Args()
@@ -0,0 +1,174 @@
+package last9
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SMTPConfig is the SMTP server mail is sent through. Without a Username,
+// mail is sent without authenticating, as MailHog expects.
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+}
+
+// smtpError is a failed SMTP exchange, with the step it failed at: connect,
+// hello, starttls, auth, mail, rcpt, data or quit. The step is the span's
+// error.type, so a refused connection and rejected credentials can be told
+// apart without reading the message.
+type smtpError struct {
+	step string
+	err  error
+}
+
+func (e *smtpError) Error() string {
+	return "smtp " + e.step + ": " + e.err.Error()
+}
+
+func (e *smtpError) Unwrap() error {
+	return e.err
+}
+
+// SMTPSender sends mail over SMTP, each message under a client span. The
+// span doesn't record the recipients, which are personal data: only their
+// count, and a hash that is the same for the same set of recipients.
+type SMTPSender struct {
+	cfg    *SMTPConfig
+	tracer trace.Tracer
+	sent   metric.Int64Counter
+}
+
+// NewSMTPSender creates a sender for the server in cfg
+func NewSMTPSender(cfg *SMTPConfig, tracerName string) *SMTPSender {
+	sent, err := otel.Meter(tracerName).Int64Counter("emails.sent",
+		metric.WithDescription("Emails accepted by the SMTP server"),
+		metric.WithUnit("{email}"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return &SMTPSender{cfg: cfg, tracer: otel.Tracer(tracerName), sent: sent}
+}
+
+// Send sends msg, a complete RFC 5322 message with its headers, from from
+// to every address in to. It upgrades the connection with STARTTLS when the
+// server offers it. Canceling ctx closes the connection, ending the
+// exchange wherever it is.
+func (s *SMTPSender) Send(ctx context.Context, from string, to []string, msg []byte) (err error) {
+	port, _ := strconv.Atoi(s.cfg.Port)
+	ctx, span := s.tracer.Start(ctx, "smtp send",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("rpc.system", "smtp"),
+			attribute.String("rpc.method", "SendMail"),
+			attribute.String("server.address", s.cfg.Host),
+			attribute.Int("server.port", port),
+			attribute.Int("smtp.message.size", len(msg)),
+			attribute.Int("smtp.recipients.count", len(to)),
+			attribute.String("smtp.recipients.hash", recipientsHash(to)),
+		),
+	)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			var se *smtpError
+			if errors.As(err, &se) {
+				span.SetAttributes(attribute.String("error.type", se.step))
+			}
+			var pe *textproto.Error
+			if errors.As(err, &pe) {
+				span.SetAttributes(attribute.Int("smtp.response.code", pe.Code))
+			}
+		} else {
+			s.sent.Add(ctx, 1, metric.WithAttributes(attribute.String("server.address", s.cfg.Host)))
+		}
+		span.End()
+	}()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(s.cfg.Host, s.cfg.Port))
+	if err != nil {
+		return &smtpError{"connect", err}
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	c, err := smtp.NewClient(conn, s.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return &smtpError{"connect", err}
+	}
+	defer c.Close()
+
+	if err := c.Hello("localhost"); err != nil {
+		return &smtpError{"hello", err}
+	}
+	starttls, _ := c.Extension("STARTTLS")
+	span.SetAttributes(attribute.Bool("smtp.starttls", starttls))
+	if starttls {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.Host}); err != nil {
+			return &smtpError{"starttls", err}
+		}
+	}
+	if s.cfg.Username != "" {
+		// PlainAuth refuses to send the password over a connection that
+		// isn't TLS, unless the server is on localhost
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.Host)
+		if err := c.Auth(auth); err != nil {
+			return &smtpError{"auth", err}
+		}
+	}
+
+	if err := c.Mail(from); err != nil {
+		return &smtpError{"mail", err}
+	}
+	for _, addr := range to {
+		if err := c.Rcpt(addr); err != nil {
+			return &smtpError{"rcpt", err}
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return &smtpError{"data", err}
+	}
+	if _, err := w.Write(msg); err != nil {
+		return &smtpError{"data", err}
+	}
+	// The server accepts or rejects the message when the data is closed
+	if err := w.Close(); err != nil {
+		return &smtpError{"data", err}
+	}
+	if err := c.Quit(); err != nil {
+		return &smtpError{"quit", err}
+	}
+	return nil
+}
+
+// recipientsHash is a short hash of the recipients, in any order and case
+func recipientsHash(to []string) string {
+	addrs := make([]string, len(to))
+	for i, addr := range to {
+		addrs[i] = strings.ToLower(strings.TrimSpace(addr))
+	}
+	slices.Sort(addrs)
+	sum := sha256.Sum256([]byte(strings.Join(addrs, ",")))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// phase is one step of shutdown. Its timeout bounds the step on its own, so
+// a slow phase can't use up the time of the phases after it.
+type phase struct {
+	name    string
+	timeout time.Duration
+	stop    func(context.Context) error
+}
+
+// lifecycle runs shutdown phases in the order they were added. Each phase
+// runs even if an earlier one failed: a worker that couldn't drain its jobs
+// must still close its connections and flush its telemetry.
+type lifecycle struct {
+	phases []phase
+}
+
+func (l *lifecycle) add(name string, timeout time.Duration, stop func(context.Context) error) {
+	l.phases = append(l.phases, phase{name: name, timeout: timeout, stop: stop})
+}
+
+// shutdown runs the phases under a shutdown span, with a child span per
+// phase, then flushes the spans and metrics recorded so far. The providers
+// themselves are shut down by agent.Shutdown after this returns, and that
+// exports the shutdown span.
+func (l *lifecycle) shutdown(ctx context.Context, reason string) error {
+	ctx, span := otel.Tracer("lifecycle").Start(ctx, "shutdown",
+		trace.WithAttributes(attribute.String("shutdown.reason", reason)))
+	defer span.End()
+
+	var errs []error
+	for _, p := range l.phases {
+		if err := l.run(ctx, p); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", p.name, err))
+		}
+	}
+	if err := l.run(ctx, phase{name: "flush_telemetry", timeout: 5 * time.Second, stop: flushTelemetry}); err != nil {
+		errs = append(errs, fmt.Errorf("flush_telemetry: %w", err))
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+func (l *lifecycle) run(ctx context.Context, p phase) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	ctx, span := otel.Tracer("lifecycle").Start(ctx, "shutdown "+p.name,
+		trace.WithAttributes(
+			attribute.String("shutdown.phase", p.name),
+			attribute.Float64("shutdown.phase.timeout", p.timeout.Seconds()),
+		))
+	defer span.End()
+
+	start := time.Now()
+	err := p.stop(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("Shutdown phase %s failed after %s: %v", p.name, time.Since(start).Round(time.Millisecond), err)
+		return err
+	}
+	log.Printf("Shutdown phase %s done in %s", p.name, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// flushTelemetry exports the spans and metrics recorded so far. It runs as
+// the last phase, so its span covers the flush of everything before it; the
+// span itself is exported when the providers shut down.
+func flushTelemetry(ctx context.Context) error {
+	var errs []error
+	if tp, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		errs = append(errs, tp.ForceFlush(ctx))
+	}
+	if mp, ok := otel.GetMeterProvider().(*sdkmetric.MeterProvider); ok {
+		errs = append(errs, mp.ForceFlush(ctx))
+	}
+	return errors.Join(errs...)
+}
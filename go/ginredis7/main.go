@@ -3,171 +3,30 @@ package main
 import (
 	"context"
 	"encoding/json"
-	"fmt"
+	"gin_example/jobs"
 	"gin_example/last9"
 	"gin_example/users"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v7"
-	"github.com/google/uuid"
 	"github.com/last9/go-agent"
 	ginagent "github.com/last9/go-agent/instrumentation/gin"
 	httpagent "github.com/last9/go-agent/integrations/http"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/codes"
-	"go.opentelemetry.io/otel/trace"
 )
 
-type JobStatus string
-
-const (
-	JobStatusPending  JobStatus = "pending"
-	JobStatusComplete JobStatus = "complete"
-	JobStatusFailed   JobStatus = "failed"
-)
-
-type Job struct {
-	ID          string      `json:"id"`
-	Type        string      `json:"type"`
-	Payload     interface{} `json:"payload"`
-	Status      JobStatus   `json:"status"`
-	CreatedAt   time.Time   `json:"created_at"`
-	CompletedAt *time.Time  `json:"completed_at,omitempty"`
-	Error       string      `json:"error,omitempty"`
-}
-
-type JobHandler func(context.Context, *Job) error
-
-type JobProcessor struct {
-	broker   last9.MessageBroker
-	handlers map[string]JobHandler
-}
-
-func NewJobProcessor(broker last9.MessageBroker) *JobProcessor {
-	return &JobProcessor{
-		broker:   broker,
-		handlers: make(map[string]JobHandler),
-	}
-}
-
-func (p *JobProcessor) RegisterHandler(jobType string, handler JobHandler) {
-	p.handlers[jobType] = handler
-}
-
-func (p *JobProcessor) PublishJob(ctx context.Context, queueName string, jobType string, payload interface{}) (*Job, error) {
-	// Create new job
-	job := &Job{
-		ID:        uuid.New().String(),
-		Type:      jobType,
-		Payload:   payload,
-		Status:    JobStatusPending,
-		CreatedAt: time.Now(),
-	}
-
-	// Marshal job to JSON
-	jobBytes, err := json.Marshal(job)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal job: %v", err)
-	}
-
-	// Publish the message
-	err = p.broker.PublishMessage(ctx, queueName, jobBytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to publish job: %v", err)
-	}
-
-	return job, nil
-}
-
-func (p *JobProcessor) StartConsumer(ctx context.Context, queueName string) error {
-	msgs, err := p.broker.ConsumeMessages(ctx, queueName)
-	if err != nil {
-		return fmt.Errorf("failed to start consumer: %v", err)
-	}
-
-	go func() {
-		for msg := range msgs {
-			// Use the context from the message instead of the parent context
-			jobCtx, jobSpan := otel.Tracer("job-processor").Start(msg.Context, "process.job",
-				trace.WithAttributes(
-					attribute.String("messaging.system", "rabbitmq"),
-					attribute.String("messaging.destination", queueName),
-					attribute.String("messaging.destination_kind", "queue"),
-					attribute.String("messaging.operation", "process"),
-					attribute.String("messaging.message_id", msg.Original.MessageId),
-					attribute.String("messaging.conversation_id", msg.Original.CorrelationId),
-				))
-
-			var job Job
-			if err := json.Unmarshal(msg.Body, &job); err != nil {
-				jobSpan.RecordError(err)
-				jobSpan.SetStatus(codes.Error, "failed to unmarshal job")
-				p.broker.NackMessage(jobCtx, msg.Original, false)
-				jobSpan.End()
-				continue
-			}
-
-			jobSpan.SetAttributes(
-				attribute.String("job.id", job.ID),
-				attribute.String("job.type", job.Type),
-				attribute.String("job.status", string(job.Status)),
-			)
-
-			if handler, ok := p.handlers[job.Type]; ok {
-				// Create handler span as child of job span
-				handlerCtx, handlerSpan := otel.Tracer("job-processor").Start(jobCtx, "execute.handler",
-					trace.WithAttributes(
-						attribute.String("job.id", job.ID),
-						attribute.String("job.type", job.Type),
-						attribute.String("messaging.system", "rabbitmq"),
-						attribute.String("messaging.destination", queueName),
-						attribute.String("messaging.destination_kind", "queue"),
-						attribute.String("messaging.operation", "process"),
-						attribute.String("messaging.message_id", msg.Original.MessageId),
-						attribute.String("messaging.conversation_id", msg.Original.CorrelationId),
-					))
-
-				err := handler(handlerCtx, &job)
-				if err != nil {
-					handlerSpan.RecordError(err)
-					handlerSpan.SetStatus(codes.Error, err.Error())
-					log.Printf("Failed to process job %s: %v", job.ID, err)
-					job.Status = JobStatusFailed
-					job.Error = err.Error()
-					// Use handlerCtx for NackMessage to make it a child of handler span
-					p.broker.NackMessage(handlerCtx, msg.Original, false)
-				} else {
-					now := time.Now()
-					job.Status = JobStatusComplete
-					job.CompletedAt = &now
-					handlerSpan.SetStatus(codes.Ok, "job completed successfully")
-					// Use handlerCtx for AckMessage to make it a child of handler span
-					p.broker.AckMessage(handlerCtx, msg.Original)
-				}
-				handlerSpan.End()
-			} else {
-				err := fmt.Errorf("no handler for job type: %s", job.Type)
-				jobSpan.RecordError(err)
-				jobSpan.SetStatus(codes.Error, err.Error())
-				log.Printf("No handler for job type: %s", job.Type)
-				p.broker.NackMessage(jobCtx, msg.Original, false)
-			}
-
-			jobSpan.End()
-		}
-	}()
-
-	return nil
-}
-
 func main() {
-	// Initialize go-agent (automatic OpenTelemetry setup)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Initialize go-agent (automatic OpenTelemetry setup). Shutdown runs
+	// last, after the lifecycle has stopped everything that records telemetry
 	agent.Start()
 	defer agent.Shutdown()
 
@@ -193,27 +52,29 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to initialize RabbitMQ broker: %v", err)
 	}
-	defer rmqBroker.Close()
 
 	log.Println("✓ RabbitMQ broker initialized")
 
+	// Job state is kept in Redis so it can be queried via GET /jobs/:id
+	jobStore, err := jobs.NewStore(redisClient)
+	if err != nil {
+		log.Fatalf("Failed to initialize job store: %v", err)
+	}
+
 	// Initialize job processor with the broker
-	jobProcessor := NewJobProcessor(rmqBroker)
+	jobProcessor := jobs.NewProcessor(rmqBroker, jobStore)
+	jh := jobs.NewJobsHandler(jobStore, jobProcessor)
 
-	// Register handlers
-	jobProcessor.RegisterHandler("email", func(ctx context.Context, job *Job) error {
-		// Simulate email processing
-		time.Sleep(time.Second)
-
-		log.Println("processing job")
-		payload, ok := job.Payload.(map[string]interface{})
-		if !ok {
-			return fmt.Errorf("invalid payload type")
-		}
+	// Emails are sent through MailHog by default; see the README
+	smtpSender := last9.NewSMTPSender(&last9.SMTPConfig{
+		Host:     getEnv("SMTP_HOST", "localhost"),
+		Port:     getEnv("SMTP_PORT", "1025"),
+		Username: getEnv("SMTP_USERNAME", ""),
+		Password: getEnv("SMTP_PASSWORD", ""),
+	}, "smtp-client")
 
-		log.Printf("Sending email to %v: %v", payload["to"], payload["subject"])
-		return nil
-	})
+	// Register handlers
+	jobProcessor.RegisterHandler("email", emailHandler(smtpSender, getEnv("SMTP_FROM", "jobs@example.com")))
 
 	// Start the consumer
 	err = jobProcessor.StartConsumer(context.Background(), "email_queue")
@@ -252,16 +113,56 @@ func main() {
 			"status": job.Status,
 		})
 	})
+	r.GET("/jobs", jh.ListJobs)
+	r.GET("/jobs/:id", jh.GetJob)
+	r.POST("/jobs/:id/cancel", jh.CancelJob)
+	r.POST("/jobs/:id/retry", jh.RetryJob)
+
+	srv := &http.Server{
+		Addr:              ":" + getEnv("PORT", "8080"),
+		Handler:           r,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Listening on %s", srv.Addr)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	// Shutdown order: stop taking requests, so no new jobs are published;
+	// let running jobs finish; close the connections they used; flush
+	lc := &lifecycle{}
+	lc.add("http", 10*time.Second, srv.Shutdown)
+	lc.add("jobs", getEnvDuration("JOB_DRAIN_TIMEOUT", 15*time.Second), jobProcessor.Drain)
+	lc.add("rabbitmq", 5*time.Second, func(context.Context) error { return rmqBroker.Close() })
+	lc.add("redis", 5*time.Second, func(context.Context) error { return redisClient.Close() })
+
+	reason := "signal"
+	select {
+	case <-ctx.Done():
+	case err := <-serveErr:
+		log.Printf("HTTP server stopped: %v", err)
+		reason = "server_error"
+	}
+	// A second signal kills the process
+	stop()
 
-	r.Run()
+	log.Printf("Shutting down (%s)", reason)
+	if err := lc.shutdown(context.Background(), reason); err != nil {
+		log.Printf("Shutdown finished with errors: %v", err)
+	}
 }
 
 func initRedis() *redis.Client {
 	rdb := redis.NewClient(&redis.Options{
 		Addr: "localhost:6379", // Update this with your Redis server address
 	})
-	// Add OpenTelemetry hook
+	// Add OpenTelemetry hook for command and pipeline spans and latency
 	rdb.AddHook(last9.NewOtelHook("redis-client"))
+	// Report connection pool stats as metrics
+	if err := last9.InstrumentPoolStats(rdb, "redis-client"); err != nil {
+		log.Printf("failed to register Redis pool metrics: %v", err)
+	}
 	return rdb
 }
 
@@ -298,3 +199,10 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
+}
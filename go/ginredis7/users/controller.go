@@ -112,10 +112,14 @@ func (c *UsersController) CreateUser(ctx context.Context, user *User) error {
 	if err != nil {
 		return err
 	}
-	c.redisClient.Set(fmt.Sprintf("user:%s", user.ID), userJSON, 0)
-
-	// Update users list in Redis
-	c.redisClient.Del("users")
+	// Cache the new user and invalidate the users list in one MULTI/EXEC
+	// round trip. The OtelHook records this as a single redis:multi span.
+	pipe := c.redisClient.WithContext(ctx).TxPipeline()
+	pipe.Set(fmt.Sprintf("user:%s", user.ID), userJSON, 0)
+	pipe.Del("users")
+	if _, err := pipe.Exec(); err != nil {
+		log.Printf("failed to update users cache: %v", err)
+	}
 
 	return nil
 }
@@ -3,135 +3,90 @@ package users
 import (
 	"encoding/json"
 	"net/http"
-	"strconv"
 
 	"github.com/gorilla/mux"
-	"go.opentelemetry.io/otel/attribute"
-	oteltrace "go.opentelemetry.io/otel/trace"
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 )
 
+// UsersHandler adapts the shared users service to Gorilla Mux.
 type UsersHandler struct {
-	controller *UsersController
-	tracer     oteltrace.Tracer
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController, t oteltrace.Tracer) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
-		tracer:     t,
+		service: s,
 	}
 }
 
 func (u *UsersHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
-	traceCtx, span := u.tracer.Start(r.Context(), "GetUsers")
-	defer span.End()
-
-	users, err := u.controller.GetUsers(traceCtx)
+	users, err := u.service.List(r.Context())
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to fetch users"})
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(users)
+	writeJSON(w, http.StatusOK, users)
 }
 
 func (u *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	traceCtx, span := u.tracer.Start(r.Context(), "GetUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	user, err := u.controller.GetUser(traceCtx, id)
+	user, err := u.service.Get(r.Context(), mux.Vars(r)["id"])
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "User not found"})
+		writeError(w, r, err)
 		return
 	}
-	json.NewEncoder(w).Encode(user)
+	writeJSON(w, http.StatusOK, user)
 }
 
 func (u *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
-	traceCtx, span := u.tracer.Start(r.Context(), "CreateUser")
-	defer span.End()
-
-	var newUser User
-	if err := json.NewDecoder(r.Body).Decode(&newUser); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Invalid input data"})
+	var in commonusers.CreateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
 		return
 	}
-
-	err := u.controller.CreateUser(traceCtx, &newUser)
+	user, err := u.service.Create(r.Context(), in)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to create user"})
+		writeError(w, r, err)
 		return
 	}
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(newUser)
+	writeJSON(w, http.StatusCreated, user)
 }
 
 func (u *UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	traceCtx, span := u.tracer.Start(r.Context(), "UpdateUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid ID"})
+	var in commonusers.UpdateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
 		return
 	}
-
-	var updateData struct {
-		Name string `json:"name"`
-	}
-	if err := json.NewDecoder(r.Body).Decode(&updateData); err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid input data"})
+	user, err := u.service.Update(r.Context(), mux.Vars(r)["id"], in)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
+	writeJSON(w, http.StatusOK, user)
+}
 
-	user := u.controller.UpdateUser(traceCtx, int(idInt), updateData.Name)
-	if user == nil {
-		w.WriteHeader(http.StatusNotFound)
-		json.NewEncoder(w).Encode(map[string]string{"message": "User not found"})
+func (u *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := u.service.Delete(r.Context(), mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent)
+}
 
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
 }
 
-func (u *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	id := vars["id"]
-	traceCtx, span := u.tracer.Start(r.Context(), "DeleteUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Invalid ID"})
-		return
-	}
-
-	err = u.controller.DeleteUser(traceCtx, int(idInt))
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		json.NewEncoder(w).Encode(map[string]string{"error": "Failed to delete user"})
-		return
+// writeError writes the error response. Server errors are also recorded on
+// the request span, with the stack of the service operation that failed; the
+// service span already carries the error itself.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := commonusers.StatusCode(err)
+	if status >= http.StatusInternalServerError {
+		otelerr.Record(r.Context(), err)
 	}
-	w.WriteHeader(http.StatusNoContent)
+	writeJSON(w, status, commonusers.ErrorBody(err))
 }
@@ -0,0 +1,30 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// withCode carries a machine-readable code in the GraphQL response's
+// extensions, so clients can tell "not found" from "invalid input". gqlgen
+// fills in the path when the resolver returns it.
+func withCode(err error, code string) *gqlerror.Error {
+	return &gqlerror.Error{
+		Err:        err,
+		Message:    err.Error(),
+		Extensions: map[string]any{"code": code},
+	}
+}
+
+func toResolverError(err error) error {
+	if errors.Is(err, errNotFound) {
+		return withCode(err, "NOT_FOUND")
+	}
+	return err
+}
+
+func badInput(format string, args ...any) error {
+	return withCode(fmt.Errorf(format, args...), "BAD_USER_INPUT")
+}
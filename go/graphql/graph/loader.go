@@ -0,0 +1,72 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/graph-gophers/dataloader/v7"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/last9/opentelemetry-examples/go/graphql/graph/model"
+)
+
+type loadersKey struct{}
+
+// loaders holds the per-request dataloaders. They must not be shared across
+// requests, since each one caches results for the lifetime of the request.
+type loaders struct {
+	authors *dataloader.Loader[string, model.Author]
+}
+
+// WithLoaders attaches fresh dataloaders to every request.
+func WithLoaders(s *Store, tracer trace.Tracer, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := &loaders{
+			authors: dataloader.NewBatchedLoader(authorBatch(s, tracer),
+				dataloader.WithWait[string, model.Author](2*time.Millisecond)),
+		}
+		ctx := context.WithValue(r.Context(), loadersKey{}, l)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func loadersFrom(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// authorBatch resolves every author requested during one batch window with a
+// single store call. The span is started from the context of the first Load
+// in the batch; graphql.dataloader.batch_size shows how many field resolvers
+// were collapsed into it.
+func authorBatch(s *Store, tracer trace.Tracer) dataloader.BatchFunc[string, model.Author] {
+	return func(ctx context.Context, ids []string) []*dataloader.Result[model.Author] {
+		ctx, span := tracer.Start(ctx, "dataloader.authors",
+			trace.WithAttributes(
+				attribute.String("graphql.dataloader.name", "authors"),
+				attribute.Int("graphql.dataloader.batch_size", len(ids)),
+			),
+		)
+		defer span.End()
+
+		found := s.AuthorsByIDs(ctx, ids)
+
+		results := make([]*dataloader.Result[model.Author], len(ids))
+		missing := 0
+		for i, id := range ids {
+			if a, ok := found[id]; ok {
+				results[i] = &dataloader.Result[model.Author]{Data: a}
+				continue
+			}
+			missing++
+			results[i] = &dataloader.Result[model.Author]{Error: fmt.Errorf("author %q: %w", id, errNotFound)}
+		}
+		if missing > 0 {
+			span.SetStatus(codes.Error, fmt.Sprintf("%d of %d keys not found", missing, len(ids)))
+		}
+		return results
+	}
+}
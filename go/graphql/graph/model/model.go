@@ -0,0 +1,16 @@
+// Package model holds the types the GraphQL schema is bound to. Book and
+// Author are written by hand so that Book can carry AuthorID, which the
+// author resolver loads through the dataloader; BookInput is generated.
+package model
+
+type Book struct {
+	ID       string
+	Title    string
+	Year     int32
+	AuthorID string
+}
+
+type Author struct {
+	ID   string
+	Name string
+}
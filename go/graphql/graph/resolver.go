@@ -0,0 +1,19 @@
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.86 generate
+
+// Resolver is the root resolver. The per-type resolvers in
+// schema.resolvers.go are generated from schema.graphqls and share its store.
+type Resolver struct {
+	Store *Store
+}
+
+// pointers returns pointers to the elements of s, which is what gqlgen's
+// generated code takes for lists of objects.
+func pointers[T any](s []T) []*T {
+	out := make([]*T, len(s))
+	for i := range s {
+		out[i] = &s[i]
+	}
+	return out
+}
@@ -0,0 +1,82 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver
+// implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+// Code generated by github.com/99designs/gqlgen version v0.17.86
+
+import (
+	"context"
+	"strings"
+
+	"github.com/last9/opentelemetry-examples/go/graphql/graph/model"
+)
+
+// Books is the resolver for the books field.
+func (r *authorResolver) Books(ctx context.Context, obj *model.Author) ([]*model.Book, error) {
+	return pointers(r.Store.BooksByAuthor(ctx, obj.ID)), nil
+}
+
+// Author is the resolver for the author field.
+//
+// It goes through the per-request dataloader, so listing N books costs one
+// store call for their authors instead of N.
+func (r *bookResolver) Author(ctx context.Context, obj *model.Book) (*model.Author, error) {
+	a, err := loadersFrom(ctx).authors.Load(ctx, obj.AuthorID)()
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	return &a, nil
+}
+
+// AddBook is the resolver for the addBook field.
+func (r *mutationResolver) AddBook(ctx context.Context, input model.BookInput) (*model.Book, error) {
+	if strings.TrimSpace(input.Title) == "" {
+		return nil, badInput("title must not be empty")
+	}
+	if input.Year < 0 || input.Year > 2100 {
+		return nil, badInput("year %d is out of range", input.Year)
+	}
+
+	b, err := r.Store.AddBook(ctx, model.Book{Title: input.Title, Year: input.Year, AuthorID: input.AuthorID})
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	return &b, nil
+}
+
+// Books is the resolver for the books field.
+func (r *queryResolver) Books(ctx context.Context) ([]*model.Book, error) {
+	return pointers(r.Store.ListBooks(ctx)), nil
+}
+
+// Book is the resolver for the book field.
+func (r *queryResolver) Book(ctx context.Context, id string) (*model.Book, error) {
+	b, err := r.Store.GetBook(ctx, id)
+	if err != nil {
+		return nil, toResolverError(err)
+	}
+	return &b, nil
+}
+
+// Authors is the resolver for the authors field.
+func (r *queryResolver) Authors(ctx context.Context) ([]*model.Author, error) {
+	return pointers(r.Store.ListAuthors(ctx)), nil
+}
+
+// Author returns AuthorResolver implementation.
+func (r *Resolver) Author() AuthorResolver { return &authorResolver{r} }
+
+// Book returns BookResolver implementation.
+func (r *Resolver) Book() BookResolver { return &bookResolver{r} }
+
+// Mutation returns MutationResolver implementation.
+func (r *Resolver) Mutation() MutationResolver { return &mutationResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+type authorResolver struct{ *Resolver }
+type bookResolver struct{ *Resolver }
+type mutationResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
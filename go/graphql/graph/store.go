@@ -0,0 +1,143 @@
+package graph
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/last9/opentelemetry-examples/go/graphql/graph/model"
+)
+
+var errNotFound = errors.New("not found")
+
+// Store is an in-memory stand-in for a database. Each call sleeps briefly and
+// records a client span, so the effect of dataloader batching is visible in
+// the trace: N author lookups collapse into one store call.
+type Store struct {
+	tracer trace.Tracer
+
+	mu      sync.RWMutex
+	books   []model.Book
+	authors map[string]model.Author
+	nextID  int
+}
+
+// NewStore returns a Store seeded with a few books and authors.
+func NewStore(tracer trace.Tracer) *Store {
+	return &Store{
+		tracer: tracer,
+		authors: map[string]model.Author{
+			"1": {ID: "1", Name: "Ursula K. Le Guin"},
+			"2": {ID: "2", Name: "Octavia E. Butler"},
+			"3": {ID: "3", Name: "Ted Chiang"},
+		},
+		books: []model.Book{
+			{ID: "1", Title: "A Wizard of Earthsea", Year: 1968, AuthorID: "1"},
+			{ID: "2", Title: "The Dispossessed", Year: 1974, AuthorID: "1"},
+			{ID: "3", Title: "Kindred", Year: 1979, AuthorID: "2"},
+			{ID: "4", Title: "Parable of the Sower", Year: 1993, AuthorID: "2"},
+			{ID: "5", Title: "Stories of Your Life and Others", Year: 2002, AuthorID: "3"},
+		},
+		nextID: 6,
+	}
+}
+
+func (s *Store) query(ctx context.Context, op string, attrs ...attribute.KeyValue) trace.Span {
+	_, span := s.tracer.Start(ctx, "store."+op,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "memory")),
+		trace.WithAttributes(attrs...),
+	)
+	time.Sleep(time.Duration(5+rand.Intn(15)) * time.Millisecond)
+	return span
+}
+
+func (s *Store) ListBooks(ctx context.Context) []model.Book {
+	span := s.query(ctx, "ListBooks")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]model.Book(nil), s.books...)
+}
+
+func (s *Store) GetBook(ctx context.Context, id string) (model.Book, error) {
+	span := s.query(ctx, "GetBook", attribute.String("book.id", id))
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, b := range s.books {
+		if b.ID == id {
+			return b, nil
+		}
+	}
+	return model.Book{}, fmt.Errorf("book %q: %w", id, errNotFound)
+}
+
+func (s *Store) BooksByAuthor(ctx context.Context, authorID string) []model.Book {
+	span := s.query(ctx, "BooksByAuthor", attribute.String("author.id", authorID))
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var out []model.Book
+	for _, b := range s.books {
+		if b.AuthorID == authorID {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+func (s *Store) ListAuthors(ctx context.Context) []model.Author {
+	span := s.query(ctx, "ListAuthors")
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]model.Author, 0, len(s.authors))
+	for i := 1; i <= len(s.authors); i++ {
+		out = append(out, s.authors[strconv.Itoa(i)])
+	}
+	return out
+}
+
+// AuthorsByIDs fetches several authors in one call. It is the batch function
+// behind the author dataloader.
+func (s *Store) AuthorsByIDs(ctx context.Context, ids []string) map[string]model.Author {
+	span := s.query(ctx, "AuthorsByIDs", attribute.StringSlice("author.ids", ids))
+	defer span.End()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make(map[string]model.Author, len(ids))
+	for _, id := range ids {
+		if a, ok := s.authors[id]; ok {
+			out[id] = a
+		}
+	}
+	return out
+}
+
+func (s *Store) AddBook(ctx context.Context, b model.Book) (model.Book, error) {
+	span := s.query(ctx, "AddBook", attribute.String("author.id", b.AuthorID))
+	defer span.End()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.authors[b.AuthorID]; !ok {
+		return model.Book{}, fmt.Errorf("author %q: %w", b.AuthorID, errNotFound)
+	}
+	b.ID = strconv.Itoa(s.nextID)
+	s.nextID++
+	s.books = append(s.books, b)
+	return b, nil
+}
@@ -0,0 +1,227 @@
+package last9
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/errcode"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attribute keys from the GraphQL semantic conventions, plus the field-level
+// keys used on resolver spans.
+const (
+	OperationTypeKey = attribute.Key("graphql.operation.type")
+	OperationNameKey = attribute.Key("graphql.operation.name")
+	DocumentKey      = attribute.Key("graphql.document")
+	FieldNameKey     = attribute.Key("graphql.field.name")
+	FieldParentKey   = attribute.Key("graphql.field.parent_type")
+	FieldPathKey     = attribute.Key("graphql.field.path")
+	FieldArgsKey     = attribute.Key("graphql.field.args")
+	ErrorCountKey    = attribute.Key("graphql.error.count")
+)
+
+// Tracer is a gqlgen handler extension.
+//
+// It produces one span per operation, a child span for validation and one
+// child span per resolver. Fields without a resolver, which gqlgen reads
+// straight from the model struct, get no span; tracing those would add a
+// span per scalar in the response.
+type Tracer struct {
+	tracer trace.Tracer
+
+	// IncludeDocument records the full query text as graphql.document. It is
+	// off by default because documents can be large and may contain inline
+	// literals that should not leave the service.
+	IncludeDocument bool
+
+	// IncludeArguments records each resolver argument's value as
+	// graphql.field.args.<name>. It is off by default because arguments
+	// carry user input, such as emails or search terms, and a value per
+	// request makes the attribute unbounded. Without it, resolver spans
+	// carry only the argument names.
+	IncludeArguments bool
+}
+
+var (
+	_ graphql.HandlerExtension    = (*Tracer)(nil)
+	_ graphql.ResponseInterceptor = (*Tracer)(nil)
+	_ graphql.FieldInterceptor    = (*Tracer)(nil)
+)
+
+// NewTracer returns a Tracer that creates spans with t.
+func NewTracer(t trace.Tracer) *Tracer {
+	return &Tracer{tracer: t}
+}
+
+func (t *Tracer) ExtensionName() string { return "OpenTelemetryTracer" }
+
+func (t *Tracer) Validate(graphql.ExecutableSchema) error { return nil }
+
+// InterceptResponse starts the operation span. The span is named
+// "<operation type> <operation name>" as the semantic conventions recommend,
+// falling back to the operation type for anonymous operations.
+//
+// gqlgen runs the resolvers inside next, so their spans are children of this
+// one. It is also the only hook gqlgen calls when a document fails to parse
+// or validate, which is why the operation span isn't started in
+// InterceptOperation.
+func (t *Tracer) InterceptResponse(ctx context.Context, next graphql.ResponseHandler) *graphql.Response {
+	// The request body couldn't be decoded, so there is no operation
+	if !graphql.HasOperationContext(ctx) {
+		return next(ctx)
+	}
+	opCtx := graphql.GetOperationContext(ctx)
+
+	opType, opName := operation(opCtx)
+	name := opType
+	if opName != "" {
+		name += " " + opName
+	}
+
+	attrs := []attribute.KeyValue{OperationTypeKey.String(opType)}
+	if opName != "" {
+		attrs = append(attrs, OperationNameKey.String(opName))
+	}
+	if t.IncludeDocument {
+		attrs = append(attrs, DocumentKey.String(opCtx.RawQuery))
+	}
+
+	ctx, span := t.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+		trace.WithTimestamp(opCtx.Stats.OperationStart),
+	)
+	defer span.End()
+
+	resp := next(ctx)
+	var errs gqlerror.List
+	if resp != nil {
+		errs = resp.Errors
+	}
+	t.traceValidation(ctx, opCtx, errs)
+	recordErrors(span, errs)
+	return resp
+}
+
+// traceValidation records document validation, which gqlgen runs before any
+// hook, as a span from the timings in the operation's stats. Validation
+// failures never reach a resolver, so this span is the only place they show
+// up besides the operation span. A document that failed to parse was never
+// validated and gets no span.
+func (t *Tracer) traceValidation(ctx context.Context, opCtx *graphql.OperationContext, errs gqlerror.List) {
+	validation := opCtx.Stats.Validation
+	if validation.Start.IsZero() {
+		return
+	}
+	_, span := t.tracer.Start(ctx, "graphql.validate",
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithTimestamp(validation.Start),
+	)
+
+	var failed gqlerror.List
+	for _, err := range errs {
+		if code, _ := err.Extensions["code"].(string); code == errcode.ValidationFailed {
+			failed = append(failed, err)
+		}
+	}
+	recordErrors(span, failed)
+
+	// Validation that failed has no end time
+	end := validation.End
+	if end.IsZero() {
+		end = time.Now()
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+// InterceptField starts a span for a single resolver call. When resolvers
+// share a dataloader batch, the batch span is a child of whichever field span
+// issued the first Load, since the batch runs under that context.
+func (t *Tracer) InterceptField(ctx context.Context, next graphql.Resolver) (any, error) {
+	fc := graphql.GetFieldContext(ctx)
+	if !fc.IsResolver {
+		return next(ctx)
+	}
+
+	attrs := []attribute.KeyValue{
+		FieldNameKey.String(fc.Field.Name),
+		FieldParentKey.String(fc.Object),
+	}
+	if len(fc.Args) > 0 {
+		names := make([]string, 0, len(fc.Args))
+		for k := range fc.Args {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		attrs = append(attrs, FieldArgsKey.StringSlice(names))
+		if t.IncludeArguments {
+			for _, k := range names {
+				attrs = append(attrs, attribute.String(string(FieldArgsKey)+"."+k, fmt.Sprint(fc.Args[k])))
+			}
+		}
+	}
+
+	ctx, span := t.tracer.Start(ctx, fc.Object+"."+fc.Field.Name,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attrs...),
+	)
+	defer span.End()
+
+	res, err := next(ctx)
+	if err != nil {
+		span.SetAttributes(FieldPathKey.String(fc.Path().String()))
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return res, err
+}
+
+// recordErrors sets the span status from the errors in the GraphQL
+// response. GraphQL returns HTTP 200 even when resolvers fail, so without
+// this the only trace of a failed operation is in the response body.
+func recordErrors(span trace.Span, errs gqlerror.List) {
+	if len(errs) == 0 {
+		return
+	}
+	for _, err := range errs {
+		span.RecordError(err)
+	}
+	msg := errs[0].Message
+	if len(errs) > 1 {
+		msg += fmt.Sprintf(" (and %d more errors)", len(errs)-1)
+	}
+	span.SetAttributes(ErrorCountKey.Int(len(errs)))
+	span.SetStatus(codes.Error, msg)
+}
+
+// operation returns the type and name of the operation that ran.
+func operation(opCtx *graphql.OperationContext) (opType, name string) {
+	if op := opCtx.Operation; op != nil {
+		return string(op.Operation), op.Name
+	}
+	return operationType(opCtx.RawQuery, opCtx.OperationName), opCtx.OperationName
+}
+
+var operationRe = regexp.MustCompile(`(?m)^\s*(query|mutation|subscription)\b\s*([_A-Za-z][_0-9A-Za-z]*)?`)
+
+// operationType finds the type of an operation gqlgen couldn't parse or
+// validate, from the query text: the named operation if one was requested,
+// otherwise the first one. A document starting with "{" is a shorthand
+// query.
+func operationType(query, operationName string) string {
+	matches := operationRe.FindAllStringSubmatch(query, -1)
+	for _, m := range matches {
+		if operationName == "" || m[2] == operationName {
+			return m[1]
+		}
+	}
+	return "query"
+}
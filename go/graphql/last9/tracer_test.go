@@ -0,0 +1,145 @@
+package last9
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/last9/opentelemetry-examples/go/graphql/graph"
+)
+
+// serve runs query through the example's schema with a Tracer set up by
+// configure, and returns the spans it ended.
+func serve(t *testing.T, query string, configure func(*Tracer)) []sdktrace.ReadOnlySpan {
+	t.Helper()
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer("test")
+
+	gqlTracer := NewTracer(tracer)
+	if configure != nil {
+		configure(gqlTracer)
+	}
+	s := graph.NewStore(tracer)
+	gql := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{Store: s}}))
+	gql.AddTransport(transport.POST{})
+	gql.Use(gqlTracer)
+
+	req := httptest.NewRequest(http.MethodPost, "/graphql", strings.NewReader(query))
+	req.Header.Set("Content-Type", "application/json")
+	graph.WithLoaders(s, tracer, gql).ServeHTTP(httptest.NewRecorder(), req)
+	return sr.Ended()
+}
+
+// spansNamed returns the spans called name.
+func spansNamed(spans []sdktrace.ReadOnlySpan, name string) []sdktrace.ReadOnlySpan {
+	var out []sdktrace.ReadOnlySpan
+	for _, s := range spans {
+		if s.Name() == name {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// onlySpan returns the one span called name.
+func onlySpan(t *testing.T, spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+	t.Helper()
+	named := spansNamed(spans, name)
+	if len(named) != 1 {
+		t.Fatalf("got %d %q spans, want 1", len(named), name)
+	}
+	return named[0]
+}
+
+func attr(s sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range s.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestTracerSpans(t *testing.T) {
+	spans := serve(t, `{"query":"query ListBooks { books { title author { name } } }"}`, nil)
+
+	op := onlySpan(t, spans, "query ListBooks")
+	if v, _ := attr(op, OperationTypeKey); v.AsString() != "query" {
+		t.Errorf("%s is %q, want query", OperationTypeKey, v.AsString())
+	}
+	if _, ok := attr(op, DocumentKey); ok {
+		t.Errorf("%s is set without IncludeDocument", DocumentKey)
+	}
+
+	for _, name := range []string{"graphql.validate", "Query.books"} {
+		if s := onlySpan(t, spans, name); s.Parent().SpanID() != op.SpanContext().SpanID() {
+			t.Errorf("%s isn't a child of the operation span", name)
+		}
+	}
+	if n := len(spansNamed(spans, "Book.author")); n != 5 {
+		t.Errorf("got %d Book.author spans, want one per book: 5", n)
+	}
+	// Plain struct fields have no resolver, so no span
+	if n := len(spansNamed(spans, "Book.title")); n != 0 {
+		t.Errorf("got %d Book.title spans, want 0", n)
+	}
+	onlySpan(t, spans, "dataloader.authors")
+	onlySpan(t, spans, "store.AuthorsByIDs")
+}
+
+func TestTracerArguments(t *testing.T) {
+	const query = `{"query":"query GetBook { book(id: \"1\") { title } }"}`
+	valueKey := attribute.Key(string(FieldArgsKey) + ".id")
+
+	t.Run("names only", func(t *testing.T) {
+		book := onlySpan(t, serve(t, query, nil), "Query.book")
+		if v, _ := attr(book, FieldArgsKey); len(v.AsStringSlice()) != 1 || v.AsStringSlice()[0] != "id" {
+			t.Errorf("%s is %v, want [id]", FieldArgsKey, v.AsStringSlice())
+		}
+		if v, ok := attr(book, valueKey); ok {
+			t.Errorf("%s is %q without IncludeArguments", valueKey, v.Emit())
+		}
+	})
+	t.Run("values", func(t *testing.T) {
+		book := onlySpan(t, serve(t, query, func(tr *Tracer) { tr.IncludeArguments = true }), "Query.book")
+		if v, _ := attr(book, valueKey); v.AsString() != "1" {
+			t.Errorf("%s is %q, want 1", valueKey, v.AsString())
+		}
+	})
+}
+
+func TestTracerErrors(t *testing.T) {
+	t.Run("resolver", func(t *testing.T) {
+		spans := serve(t, `{"query":"query GetBook { book(id: \"99\") { title } }"}`, nil)
+		for _, name := range []string{"query GetBook", "Query.book"} {
+			if s := onlySpan(t, spans, name); s.Status().Code != codes.Error {
+				t.Errorf("%s has status %v, want Error", name, s.Status().Code)
+			}
+		}
+		if v, _ := attr(onlySpan(t, spans, "Query.book"), FieldPathKey); v.AsString() != "book" {
+			t.Errorf("%s is %q, want book", FieldPathKey, v.AsString())
+		}
+		if v, _ := attr(onlySpan(t, spans, "query GetBook"), ErrorCountKey); v.AsInt64() != 1 {
+			t.Errorf("%s is %d, want 1", ErrorCountKey, v.AsInt64())
+		}
+	})
+	t.Run("validation", func(t *testing.T) {
+		spans := serve(t, `{"query":"{ books { isbn } }"}`, nil)
+		for _, name := range []string{"query", "graphql.validate"} {
+			if s := onlySpan(t, spans, name); s.Status().Code != codes.Error {
+				t.Errorf("%s has status %v, want Error", name, s.Status().Code)
+			}
+		}
+		if n := len(spansNamed(spans, "Query.books")); n != 0 {
+			t.Errorf("got %d Query.books spans for an invalid document, want 0", n)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// GraphQL server instrumented with OpenTelemetry.
+//
+// Every request produces a trace like:
+//
+//	POST /graphql                      (otelhttp server span)
+//	└── query ListBooks                (operation span)
+//	    ├── graphql.validate
+//	    ├── Query.books
+//	    │   └── store.ListBooks
+//	    ├── Book.author  (x N)
+//	    │   └── dataloader.authors     (one batch for all N books)
+//	    │       └── store.AuthorsByIDs
+//	    └── ...
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+
+	"github.com/last9/opentelemetry-examples/go/graphql/graph"
+	"github.com/last9/opentelemetry-examples/go/graphql/last9"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "graphql-example"
+	}
+	tp := last9.InitTracerProvider(ctx, serviceName)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(shutdownCtx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	tracer := otel.Tracer("github.com/last9/opentelemetry-examples/go/graphql")
+	s := graph.NewStore(tracer)
+
+	gqlTracer := last9.NewTracer(tracer)
+	gqlTracer.IncludeDocument = os.Getenv("GRAPHQL_INCLUDE_DOCUMENT") == "true"
+	gqlTracer.IncludeArguments = os.Getenv("GRAPHQL_INCLUDE_ARGUMENTS") == "true"
+
+	gql := handler.New(graph.NewExecutableSchema(graph.Config{Resolvers: &graph.Resolver{Store: s}}))
+	gql.AddTransport(transport.POST{})
+	gql.Use(gqlTracer)
+
+	mux := http.NewServeMux()
+	mux.Handle("/graphql", otelhttp.NewHandler(
+		graph.WithLoaders(s, tracer, gql),
+		"POST /graphql",
+	))
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	srv := &http.Server{Addr: ":" + port, Handler: mux}
+
+	go func() {
+		log.Printf("GraphQL server listening on :%s/graphql", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+}
@@ -24,8 +24,9 @@ type HelloReply struct {
 }
 
 func main() {
-	// Initialize the tracer
-	shutdown := instrumentation.InitTracer("grpc-gateway-client")
+	// Initialize the tracer and meter provider. otelhttp records
+	// http.client.request.duration, exported on shutdown
+	shutdown := instrumentation.Init("grpc-gateway-client")
 	defer shutdown(context.Background())
 
 	// Get name from command line args or use default
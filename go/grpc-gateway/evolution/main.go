@@ -0,0 +1,162 @@
+// Command evolution runs v1 and v2 clients against v1 and v2 servers of the
+// Greeter service, to show that the v2 messages are a safe change and what
+// the mismatch looks like in telemetry.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/last9/go-agent"
+	"github.com/last9/go-agent/instrumentation/grpcgateway"
+	pb "grpc-gateway-example/proto"
+	greeterv2 "grpc-gateway-example/proto/v2"
+	"grpc-gateway-example/protocompat"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	v1Addr = "localhost:50061"
+	v2Addr = "localhost:50062"
+)
+
+// v1Server is the original server, built from greeter.proto.
+type v1Server struct {
+	pb.UnimplementedGreeterServer
+}
+
+func (s *v1Server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	if fields := protocompat.UnknownFieldNumbers(in); len(fields) > 0 {
+		log.Printf("v1 server: request has unknown fields %v", fields)
+	}
+	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
+}
+
+var greetings = map[string][2]string{
+	"en": {"Hi", "Good day"},
+	"fr": {"Salut", "Bonjour"},
+	"es": {"Hola", "Buenos días"},
+}
+
+// v2Server serves the same RPC with the v2 messages.
+type v2Server struct{}
+
+func (s *v2Server) SayHello(ctx context.Context, in *greeterv2.HelloRequest) (*greeterv2.HelloReply, error) {
+	// v1 clients don't send a language, so it must have a default
+	lang := in.Language
+	if _, ok := greetings[lang]; !ok {
+		lang = "en"
+	}
+	greeting := greetings[lang][0]
+	if in.Formal {
+		greeting = greetings[lang][1]
+	}
+	return &greeterv2.HelloReply{Message: greeting + " " + in.Name, Language: lang}, nil
+}
+
+type greeterV2Service interface {
+	SayHello(context.Context, *greeterv2.HelloRequest) (*greeterv2.HelloReply, error)
+}
+
+// greeterV2ServiceDesc registers v2Server as greeter.Greeter. Generated code
+// for greeter.v2 would name the service greeter.v2.Greeter, a different RPC.
+var greeterV2ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "greeter.Greeter",
+	HandlerType: (*greeterV2Service)(nil),
+	Methods: []grpc.MethodDesc{{
+		MethodName: "SayHello",
+		Handler: func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+			in := new(greeterv2.HelloRequest)
+			if err := dec(in); err != nil {
+				return nil, err
+			}
+			if interceptor == nil {
+				return srv.(greeterV2Service).SayHello(ctx, in)
+			}
+			info := &grpc.UnaryServerInfo{Server: srv, FullMethod: pb.Greeter_SayHello_FullMethodName}
+			handler := func(ctx context.Context, req any) (any, error) {
+				return srv.(greeterV2Service).SayHello(ctx, req.(*greeterv2.HelloRequest))
+			}
+			return interceptor(ctx, in, info, handler)
+		},
+	}},
+	Metadata: "v2/greeter.proto",
+}
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	v1 := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(protocompat.UnaryServerInterceptor("v1")))
+	pb.RegisterGreeterServer(v1, &v1Server{})
+	v2 := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(protocompat.UnaryServerInterceptor("v2")))
+	v2.RegisterService(&greeterV2ServiceDesc, &v2Server{})
+	for addr, s := range map[string]*grpc.Server{v1Addr: v1, v2Addr: v2} {
+		lis, err := net.Listen("tcp", addr)
+		if err != nil {
+			log.Fatalf("failed to listen on %s: %v", addr, err)
+		}
+		go s.Serve(lis)
+		defer s.GracefulStop()
+	}
+
+	ctx := context.Background()
+	tracer := otel.Tracer("grpc-gateway-example/evolution")
+	for _, client := range []string{"v1", "v2"} {
+		for _, server := range []string{"v1", "v2"} {
+			addr := v1Addr
+			if server == "v2" {
+				addr = v2Addr
+			}
+
+			callCtx, span := tracer.Start(ctx, fmt.Sprintf("evolution %s client -> %s server", client, server))
+			span.SetAttributes(
+				attribute.String("evolution.client_version", client),
+				attribute.String("evolution.server_version", server),
+			)
+			reply, err := call(callCtx, addr, client)
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+				log.Printf("%s client -> %s server: error: %v", client, server, err)
+			} else {
+				log.Printf("%s client -> %s server: %v (unknown fields: %v)", client, server, reply, protocompat.UnknownFieldNumbers(reply))
+			}
+			span.End()
+		}
+	}
+}
+
+// call sends SayHello to addr with the messages of the client version.
+func call(ctx context.Context, addr, version string) (proto.Message, error) {
+	conn, err := grpc.NewClient(addr,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpcgateway.NewDialOption(),
+		grpc.WithChainUnaryInterceptor(protocompat.UnaryClientInterceptor(version)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", addr, err)
+	}
+	defer conn.Close()
+
+	if version == "v1" {
+		return pb.NewGreeterClient(conn).SayHello(ctx, &pb.HelloRequest{Name: "World"})
+	}
+	reply := new(greeterv2.HelloReply)
+	req := &greeterv2.HelloRequest{Name: "World", Language: "fr", Formal: true}
+	if err := conn.Invoke(ctx, pb.Greeter_SayHello_FullMethodName, req, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
@@ -0,0 +1,103 @@
+// Package faultinject lets a client ask for a specific gRPC error, so error
+// paths can be tested end to end without breaking a backend.
+//
+// A request sent with the x-fail-with header, such as
+//
+//	curl -H 'x-fail-with: UNAVAILABLE' -X POST http://localhost:8080/v1/greeter/hello -d '{"name":"World"}'
+//
+// is forwarded by the gateway as x-fail-with gRPC metadata, and the server
+// returns that status instead of calling the handler:
+//
+//	gwMux := grpcgateway.NewGatewayMux(runtime.WithMetadata(faultinject.Annotator))
+//	grpcServer := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(faultinject.UnaryServerInterceptor()))
+//
+// The value is a status code name (UNAVAILABLE, not_found) or number (14).
+// OK or an empty value injects nothing.
+package faultinject
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Header is the HTTP header and gRPC metadata key carrying the requested
+// status code.
+const Header = "x-fail-with"
+
+// Annotator is a runtime.WithMetadata annotator that forwards the Header
+// from the HTTP request as gRPC metadata. It also records the requested
+// code on the HTTP span, so the injection is visible at every layer.
+func Annotator(ctx context.Context, r *http.Request) metadata.MD {
+	v := r.Header.Get(Header)
+	if v == "" {
+		return nil
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.String("fault.requested", v))
+	return metadata.Pairs(Header, v)
+}
+
+// UnaryServerInterceptor returns an interceptor that fails calls carrying
+// the Header metadata with the requested code. An unknown code fails the
+// call with InvalidArgument.
+//
+// The server span gets a fault.injected event, and otelgrpc records the
+// returned status on it as for any other error.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		md, _ := metadata.FromIncomingContext(ctx)
+		values := md.Get(Header)
+		if len(values) == 0 {
+			return handler(ctx, req)
+		}
+
+		span := trace.SpanFromContext(ctx)
+		code, ok := ParseCode(values[0])
+		if !ok {
+			span.AddEvent("fault.rejected", trace.WithAttributes(attribute.String("fault.requested", values[0])))
+			return nil, status.Errorf(codes.InvalidArgument, "invalid %s value %q", Header, values[0])
+		}
+		if code == codes.OK {
+			return handler(ctx, req)
+		}
+
+		span.SetAttributes(attribute.Bool("fault.injected", true))
+		span.AddEvent("fault.injected", trace.WithAttributes(
+			attribute.String("fault.code", code.String()),
+			attribute.String("rpc.method", info.FullMethod),
+		))
+		return nil, status.Errorf(code, "injected failure (%s: %s)", Header, code)
+	}
+}
+
+// ParseCode parses a status code name, in any case and with or without
+// underscores, or a code number.
+func ParseCode(v string) (codes.Code, bool) {
+	v = strings.TrimSpace(v)
+	if n, err := strconv.ParseUint(v, 10, 32); err == nil {
+		if n > uint64(codes.Unauthenticated) {
+			return 0, false
+		}
+		return codes.Code(n), true
+	}
+	want := normalize(v)
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if normalize(c.String()) == want {
+			return c, true
+		}
+	}
+	return 0, false
+}
+
+// normalize makes "NOT_FOUND", "not_found" and "NotFound" compare equal.
+func normalize(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, "_", ""))
+}
@@ -17,6 +17,7 @@ import (
 	httpintegration "github.com/last9/go-agent/integrations/http"
 
 	pb "grpc-gateway-example/proto"
+	"grpc-gateway-example/startup"
 
 	_ "github.com/lib/pq" // PostgreSQL driver
 	"go.opentelemetry.io/contrib/instrumentation/net/http/httptrace/otelhttptrace"
@@ -125,7 +126,9 @@ func main() {
 	agent.Start()
 	defer agent.Shutdown()
 
-	log.Println("✓ go-agent initialized (all OpenTelemetry providers configured)")
+	// Startup is recorded as a service.startup span with a service.start
+	// event, rather than logged
+	ctx, report := startup.Begin(context.Background())
 
 	// 2. Database connection with automatic instrumentation
 	var db *sql.DB
@@ -138,63 +141,46 @@ func main() {
 			DSN:          dsn,
 			DatabaseName: "grpc_gateway",
 		})
+		// Open doesn't connect; ping so db.connected means it did
+		if err == nil {
+			if err = db.PingContext(ctx); err != nil {
+				db.Close()
+			}
+		}
+		report.Component("db", err)
 		if err != nil {
-			log.Printf("Warning: Database connection failed: %v", err)
-			log.Println("Continuing without database (greet counts won't persist)...")
+			// Continue without the database; greet counts won't persist
 			db = nil
 		} else {
 			defer db.Close()
 
 			// Create schema
-			if err := initSchema(db); err != nil {
-				log.Printf("Warning: Failed to initialize schema: %v", err)
-			}
-
-			log.Println("✓ Database connected with automatic go-agent instrumentation")
+			report.Component("db.schema", initSchema(ctx, db))
 		}
 	} else {
-		log.Println("DATABASE_URL not set, running without database")
+		report.Disabled("db")
 	}
 
 	// 3. HTTP client with automatic instrumentation
 	httpClient := httpintegration.NewClient(&http.Client{})
-	log.Println("✓ HTTP client configured with automatic go-agent instrumentation")
-
-	log.Println("")
-	log.Println("Starting Enhanced gRPC-Gateway with go-agent...")
-	log.Println("Features:")
-	log.Println("  ✓ gRPC server (auto-instrumented by go-agent)")
-	log.Println("  ✓ HTTP gateway (auto-instrumented by go-agent)")
-	if db != nil {
-		log.Println("  ✓ PostgreSQL database (auto-instrumented by go-agent)")
-	} else {
-		log.Println("  ✗ PostgreSQL database (not connected)")
+
+	lis, err := net.Listen("tcp", ":50051")
+	if err != nil {
+		log.Fatalf("Failed to listen on gRPC port: %v", err)
 	}
-	log.Println("  ✓ External API calls (auto-instrumented by go-agent)")
-	log.Println("")
-	log.Println("Benefits of go-agent:")
-	log.Println("  • 87% less boilerplate code")
-	log.Println("  • Standardized instrumentation patterns")
-	log.Println("  • Drop-in replacements for common frameworks")
-	log.Println("  • Centralized configuration")
-	log.Println("")
+	report.Listening("grpc", lis.Addr().String())
 
 	// Start gRPC server in background
-	go startGrpcServer(db, httpClient)
+	go startGrpcServer(lis, db, httpClient)
 
 	// Start HTTP gateway
-	if err := startHTTPGateway(); err != nil {
+	if err := startHTTPGateway(ctx, report); err != nil {
 		log.Fatalf("Failed to start HTTP gateway: %v", err)
 	}
 }
 
 // startGrpcServer starts the gRPC server using go-agent
-func startGrpcServer(db *sql.DB, httpClient *http.Client) {
-	lis, err := net.Listen("tcp", ":50051")
-	if err != nil {
-		log.Fatalf("Failed to listen on gRPC port: %v", err)
-	}
-
+func startGrpcServer(lis net.Listener, db *sql.DB, httpClient *http.Client) {
 	// Create gRPC server with go-agent (automatic instrumentation!)
 	grpcServer := grpcgateway.NewGrpcServer()
 
@@ -204,14 +190,14 @@ func startGrpcServer(db *sql.DB, httpClient *http.Client) {
 		httpClient: httpClient,
 	})
 
-	log.Printf("✓ gRPC server listening at %v (instrumented by go-agent)", lis.Addr())
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve gRPC: %v", err)
 	}
 }
 
-// startHTTPGateway starts the grpc-gateway HTTP server using go-agent
-func startHTTPGateway() error {
+// startHTTPGateway starts the grpc-gateway HTTP server using go-agent, and
+// makes report ready once it listens
+func startHTTPGateway(startupCtx context.Context, report *startup.Report) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -252,26 +238,18 @@ func startHTTPGateway() error {
 	handler := grpcgateway.WrapHTTPMux(httpMux, "grpc-gateway-http")
 
 	// Start HTTP server
-	log.Println("✓ HTTP gateway listening on :8080 (instrumented by go-agent)")
-	log.Println("")
-	log.Println("Try these commands:")
-	log.Println("  curl -X POST http://localhost:8080/v1/greeter/hello -d '{\"name\":\"World\"}'")
-	log.Println("  curl http://localhost:8080/health")
-	log.Println("")
-	log.Println("Full trace includes:")
-	log.Println("  → HTTP request (go-agent)")
-	log.Println("  → gRPC call (go-agent)")
-	log.Println("  → Database queries (go-agent)")
-	log.Println("  → External API calls (go-agent)")
-	log.Println("")
-
-	return http.ListenAndServe(":8080", handler)
+	lis, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		return fmt.Errorf("failed to listen on HTTP port: %w", err)
+	}
+	report.Listening("http", lis.Addr().String())
+	report.Ready(startupCtx)
+
+	return http.Serve(lis, handler)
 }
 
 // initSchema creates the database schema
-func initSchema(db *sql.DB) error {
-	ctx := context.Background()
-
+func initSchema(ctx context.Context, db *sql.DB) error {
 	_, err := db.ExecContext(ctx, `
 		CREATE TABLE IF NOT EXISTS users (
 			id SERIAL PRIMARY KEY,
@@ -288,6 +266,5 @@ func initSchema(db *sql.DB) error {
 		return fmt.Errorf("failed to create schema: %w", err)
 	}
 
-	log.Println("✓ Database schema initialized")
 	return nil
 }
@@ -20,6 +20,7 @@ import (
 	redisagent "github.com/last9/go-agent/integrations/redis"
 
 	pb "grpc-gateway-example/proto"
+	"grpc-gateway-example/startup"
 
 	"github.com/redis/go-redis/v9"
 	"go.opentelemetry.io/otel"
@@ -251,11 +252,9 @@ func main() {
 	agent.Start()
 	defer agent.Shutdown()
 
-	log.Println("============================================================")
-	log.Println("  gRPC-Gateway with Last9 go-agent - Full Instrumentation")
-	log.Println("============================================================")
-	log.Println("")
-	log.Println("[Last9 Agent] Initialized successfully")
+	// Startup is recorded as a service.startup span with a service.start
+	// event, rather than logged
+	ctx, report := startup.Begin(context.Background())
 
 	deps := &Dependencies{}
 
@@ -267,15 +266,19 @@ func main() {
 			DSN:          dsn,
 			DatabaseName: "grpc_gateway",
 		})
-		if err != nil {
-			log.Printf("[Database] Connection failed: %v", err)
-		} else {
+		// Open doesn't connect; ping so db.connected means it did
+		if err == nil {
+			if err = db.PingContext(ctx); err != nil {
+				db.Close()
+			}
+		}
+		report.Component("db", err)
+		if err == nil {
 			deps.DB = db
-			log.Println("[Database] Connected with OTel instrumentation")
 			defer db.Close()
 		}
 	} else {
-		log.Println("[Database] Skipped (DATABASE_URL not set)")
+		report.Disabled("db")
 	}
 
 	// 3. Redis with automatic instrumentation
@@ -289,21 +292,20 @@ func main() {
 		Password: os.Getenv("REDIS_PASSWORD"),
 		DB:       0,
 	})
-	if redisInstrErr != nil {
-		log.Printf("Warning: Redis instrumentation failed: %v", redisInstrErr)
-	}
+	// Redis still works uninstrumented, so this isn't a failed component
+	report.Flag(attribute.Bool("redis.instrumented", redisInstrErr == nil))
 
 	// Test Redis connection
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	_, err := redisClient.Ping(ctx).Result()
+	pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	_, err := redisClient.Ping(pingCtx).Result()
 	cancel()
 
+	report.Component("redis", err)
 	if err != nil {
-		log.Printf("[Redis] Connection failed: %v (continuing without Redis)", err)
-		redisClient = nil
+		// Continue without Redis
+		redisClient.Close()
 	} else {
 		deps.Redis = redisClient
-		log.Println("[Redis] Connected with OTel instrumentation")
 		defer redisClient.Close()
 	}
 
@@ -311,38 +313,44 @@ func main() {
 	deps.HTTPClient = httpagent.NewClient(&http.Client{
 		Timeout: 10 * time.Second,
 	})
-	log.Println("[HTTP Client] Created with OTel instrumentation")
 
-	log.Println("")
-	log.Println("Starting services...")
+	lis, err := net.Listen("tcp", ":50051")
+	if err != nil {
+		log.Fatalf("Failed to listen: %v", err)
+	}
+	report.Listening("grpc", lis.Addr().String())
 
 	// Start gRPC server
-	go startGrpcServer(deps)
+	go startGrpcServer(lis, deps)
 
 	// Start HTTP gateway
-	if err := startHTTPGateway(); err != nil {
+	if err := startHTTPGateway(ctx, report); err != nil {
 		log.Fatalf("Failed to start HTTP gateway: %v", err)
 	}
 }
 
-func startGrpcServer(deps *Dependencies) {
-	lis, err := net.Listen("tcp", ":50051")
-	if err != nil {
-		log.Fatalf("Failed to listen: %v", err)
-	}
-
+func startGrpcServer(lis net.Listener, deps *Dependencies) {
 	// Create gRPC server with go-agent (automatic instrumentation)
 	grpcServer := grpcgateway.NewGrpcServer()
 
 	pb.RegisterGreeterServer(grpcServer, &server{deps: deps})
 
-	log.Printf("[gRPC Server] Listening at %v (instrumented)", lis.Addr())
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
 }
 
-func startHTTPGateway() error {
+// startHTTPGateway serves the gateway on :8080, and makes report ready once
+// it listens. The spans of a request are, parent to child:
+//
+//	HTTP Server (grpc-gateway)
+//	  └── gRPC Client (/proto.Greeter/SayHello)
+//	       └── gRPC Server (/proto.Greeter/SayHello)
+//	            └── SayHello.ProcessRequest
+//	                 ├── redis.operations (Redis GET, SET, INCR)
+//	                 ├── database.operations (SELECT NOW(), SELECT COUNT(*))
+//	                 └── external.api.call (HTTP GET httpbin.org)
+func startHTTPGateway(startupCtx context.Context, report *startup.Report) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -376,31 +384,12 @@ func startHTTPGateway() error {
 	// Wrap with go-agent HTTP instrumentation
 	handler := grpcgateway.WrapHTTPMux(httpMux, "grpc-gateway")
 
-	log.Println("[HTTP Gateway] Listening on :8080 (instrumented)")
-	log.Println("")
-	log.Println("============================================================")
-	log.Println("  Span Hierarchy (Parent -> Child):")
-	log.Println("  ")
-	log.Println("  HTTP Server (grpc-gateway)")
-	log.Println("    └── gRPC Client (/proto.Greeter/SayHello)")
-	log.Println("         └── gRPC Server (/proto.Greeter/SayHello)")
-	log.Println("              └── SayHello.ProcessRequest")
-	log.Println("                   ├── redis.operations")
-	log.Println("                   │    ├── Redis GET")
-	log.Println("                   │    ├── Redis SET")
-	log.Println("                   │    └── Redis INCR")
-	log.Println("                   ├── database.operations")
-	log.Println("                   │    ├── SELECT NOW()")
-	log.Println("                   │    └── SELECT COUNT(*)")
-	log.Println("                   └── external.api.call")
-	log.Println("                        └── HTTP GET httpbin.org")
-	log.Println("============================================================")
-	log.Println("")
-	log.Println("Test with:")
-	log.Println("  curl -X POST http://localhost:8080/v1/greeter/hello \\")
-	log.Println("    -H 'Content-Type: application/json' \\")
-	log.Println("    -d '{\"name\":\"World\"}'")
-	log.Println("")
-
-	return http.ListenAndServe(":8080", handler)
+	lis, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		return fmt.Errorf("failed to listen on HTTP port: %w", err)
+	}
+	report.Listening("http", lis.Addr().String())
+	report.Ready(startupCtx)
+
+	return http.Serve(lis, handler)
 }
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+//go:embed web
+var webRoot embed.FS
+
+// webFiles holds the grpc-web browser client.
+var webFiles, _ = fs.Sub(webRoot, "web")
+
+// grpcWebHandler serves grpc-web calls, and their CORS preflights, with
+// grpcServer and passes everything else to next.
+//
+// Trace context travels differently than for the other clients:
+//
+//   - A grpc-web call is an HTTP/1.1 POST to /greeter.Greeter/SayHello. Its
+//     HTTP headers, traceparent included, become the gRPC metadata the
+//     server's otelgrpc handler extracts from. REST calls instead go through
+//     the gateway's gRPC client, which starts a new span and injects its own
+//     context.
+//   - Left as is, the browser's traceparent would parent the gRPC server span
+//     directly, next to the HTTP span rather than under it. It is replaced
+//     with the HTTP span's context so the trace nests browser -> HTTP -> gRPC.
+//   - Browsers only send traceparent cross-origin if the CORS preflight
+//     allows it. The wrapper's CORS handling allows any request header.
+//   - The status comes back in a grpc-status trailer inside the response
+//     body, so the HTTP span shows 200 even for failed calls. The gRPC
+//     server span carries the real status.
+func grpcWebHandler(grpcServer *grpc.Server, next http.Handler) http.Handler {
+	wrapped := grpcweb.WrapServer(grpcServer,
+		// Any origin, for the demo. Restrict this in production.
+		grpcweb.WithOriginFunc(func(origin string) bool { return true }),
+	)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !wrapped.IsGrpcWebRequest(r) && !wrapped.IsAcceptableGrpcCorsRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		span := trace.SpanFromContext(r.Context())
+		span.SetAttributes(
+			attribute.String("rpc.system", "grpc_web"),
+			attribute.String("rpc.grpc_web.content_type", r.Header.Get("Content-Type")),
+		)
+		if wrapped.IsGrpcWebRequest(r) {
+			otel.GetTextMapPropagator().Inject(r.Context(), propagation.HeaderCarrier(r.Header))
+		}
+		wrapped.ServeHTTP(w, r)
+	})
+}
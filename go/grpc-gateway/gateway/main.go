@@ -4,13 +4,28 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"math/rand"
 	"net"
 	"net/http"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/last9/go-agent"
 	"github.com/last9/go-agent/instrumentation/grpcgateway"
+	"github.com/last9/opentelemetry-examples/go/common/bodylimit"
+	"github.com/last9/opentelemetry-examples/go/common/routefilter"
+	"grpc-gateway-example/faultinject"
+	"grpc-gateway-example/gatewaymetrics"
+	"grpc-gateway-example/grpcerr"
+	"grpc-gateway-example/hedging"
+	"grpc-gateway-example/payloadcapture"
 	pb "grpc-gateway-example/proto"
+	"grpc-gateway-example/startup"
 
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 )
@@ -22,6 +37,15 @@ type server struct {
 
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
 	log.Printf("Gateway received request: name=%s", in.Name)
+	if err := grpcerr.ValidateName(in.Name); err != nil {
+		return nil, err
+	}
+	if err := grpcerr.Simulated(in.SimulateError, in.Name); err != nil {
+		return nil, err
+	}
+	if err := simulateSlowRequest(ctx); err != nil {
+		return nil, err
+	}
 	return &pb.HelloReply{Message: "Hello " + in.Name + " from gRPC-Gateway!"}, nil
 }
 
@@ -30,46 +54,73 @@ func main() {
 	agent.Start()
 	defer agent.Shutdown()
 
-	log.Println("✓ go-agent initialized")
-	log.Println("Starting gRPC-Gateway example...")
+	// Startup is recorded as a service.startup span with a service.start
+	// event, rather than logged
+	ctx, report := startup.Begin(context.Background())
 
-	// Start gRPC server in background
-	go startGrpcServer()
+	// Create gRPC server with go-agent (automatic instrumentation)
+	// x-fail-with metadata makes the server return that status code, and
+	// every returned error is recorded on the server span. The message sizes
+	// go on the server span too
+	grpcServer := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(
+		grpcerr.UnaryServerInterceptor(),
+		faultinject.UnaryServerInterceptor(),
+		payloadcapture.UnaryServerInterceptor(),
+	))
 
-	// Start HTTP gateway
-	if err := startHTTPGateway(); err != nil {
-		log.Fatalf("Failed to start HTTP gateway: %v", err)
-	}
-}
+	// Register the Greeter service
+	pb.RegisterGreeterServer(grpcServer, &server{})
 
-// startGrpcServer starts the gRPC server with go-agent instrumentation
-func startGrpcServer() {
 	lis, err := net.Listen("tcp", ":50051")
 	if err != nil {
 		log.Fatalf("Failed to listen on gRPC port: %v", err)
 	}
+	report.Listening("grpc", lis.Addr().String())
 
-	// Create gRPC server with go-agent (automatic instrumentation)
-	grpcServer := grpcgateway.NewGrpcServer()
+	// Start gRPC server in background
+	go startGrpcServer(grpcServer, lis)
 
-	// Register the Greeter service
-	pb.RegisterGreeterServer(grpcServer, &server{})
+	// Start HTTP gateway
+	if err := startHTTPGateway(ctx, report, grpcServer); err != nil {
+		log.Fatalf("Failed to start HTTP gateway: %v", err)
+	}
+}
 
-	log.Printf("✓ gRPC server listening at %v (instrumented by go-agent)", lis.Addr())
+// startGrpcServer serves the gRPC server on lis
+func startGrpcServer(grpcServer *grpc.Server, lis net.Listener) {
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("Failed to serve gRPC: %v", err)
 	}
 }
 
 // startHTTPGateway starts the grpc-gateway HTTP server with go-agent instrumentation
-// This demonstrates the complete stack: HTTP -> grpc-gateway -> gRPC
-func startHTTPGateway() error {
+// This demonstrates the complete stack: HTTP -> grpc-gateway -> gRPC.
+// grpc-web requests from browsers go straight to grpcServer.
+// report is made ready once the gateway listens.
+func startHTTPGateway(startupCtx context.Context, report *startup.Report, grpcServer *grpc.Server) error {
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// Per-route request metrics; go-agent's HTTP metrics only see the outer mux
+	routeMetrics, err := gatewaymetrics.NewMiddleware()
+	if err != nil {
+		return fmt.Errorf("failed to create gateway metrics: %w", err)
+	}
+
+	// Body sizes on the HTTP span, and with OTEL_CAPTURE_PAYLOADS=true the
+	// redacted JSON bodies as span events
+	payloads := payloadcapture.ConfigFromEnv()
+	report.Flag(attribute.Bool("payload_capture.enabled", payloads.Enabled))
+
 	// Create grpc-gateway ServeMux with go-agent
-	gwMux := grpcgateway.NewGatewayMux()
+	// The x-fail-with header is forwarded as gRPC metadata, and gRPC errors
+	// are mapped to HTTP statuses by grpcerr.ErrorHandler
+	gwMux := grpcgateway.NewGatewayMux(
+		runtime.WithMetadata(faultinject.Annotator),
+		runtime.WithErrorHandler(grpcerr.ErrorHandler),
+		runtime.WithMiddlewares(routeMetrics, payloadcapture.NewMiddleware(payloads)),
+	)
 
 	// Connect to gRPC server with go-agent (automatic client instrumentation)
 	opts := []grpc.DialOption{
@@ -85,15 +136,46 @@ func startHTTPGateway() error {
 
 	// Register gRPC-gateway handlers
 	// This maps HTTP routes to gRPC methods based on proto annotations
-	if err := pb.RegisterGreeterHandler(ctx, gwMux, conn); err != nil {
+	backend := os.Getenv("HEDGE_BACKEND")
+	report.Flag(attribute.Bool("hedging.enabled", backend != ""))
+	if backend != "" {
+		// Hedge reads across the local server and a second backend
+		hedgeConn, err := grpc.NewClient(backend, opts...)
+		if err != nil {
+			return fmt.Errorf("failed to dial hedge backend: %w", err)
+		}
+		defer hedgeConn.Close()
+
+		hedged, err := hedging.NewConn(conn, hedgeConn, hedging.Config{
+			Delay:   getEnvDuration("HEDGE_DELAY", 50*time.Millisecond),
+			Methods: []string{pb.Greeter_SayHello_FullMethodName},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create hedging connection: %w", err)
+		}
+		if err := pb.RegisterGreeterHandlerClient(ctx, gwMux, pb.NewGreeterClient(hedged)); err != nil {
+			return fmt.Errorf("failed to register gateway: %w", err)
+		}
+		report.Set(attribute.String("hedging.backend", backend))
+	} else if err := pb.RegisterGreeterHandler(ctx, gwMux, conn); err != nil {
 		return fmt.Errorf("failed to register gateway: %w", err)
 	}
 
 	// Create standard library http.ServeMux (outer HTTP layer)
 	httpMux := http.NewServeMux()
 
-	// Mount grpc-gateway routes under /
-	httpMux.Handle("/", gwMux)
+	// Reject bodies over MAX_BODY_BYTES (default 1 MiB) with a 413 before
+	// they are decoded. The limit runs inside the instrumentation, so the
+	// rejection is recorded on the HTTP span
+	maxBodyBytes := bodylimit.LimitFromEnv()
+	limitBody := bodylimit.Middleware(maxBodyBytes)
+
+	// Mount grpc-gateway routes under /, with grpc-web calls sent to the
+	// gRPC server
+	httpMux.Handle("/", limitBody(grpcWebHandler(grpcServer, gwMux)))
+
+	// Browser client for grpc-web
+	httpMux.Handle("/grpc-web/", http.StripPrefix("/grpc-web/", http.FileServer(http.FS(webFiles))))
 
 	// Add additional HTTP-only routes
 	httpMux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -101,16 +183,43 @@ func startHTTPGateway() error {
 		w.Write([]byte("OK"))
 	})
 
-	// Wrap entire HTTP server with go-agent (automatic instrumentation)
-	handler := grpcgateway.WrapHTTPMux(httpMux, "grpc-gateway-http")
+	// Wrap entire HTTP server with otelhttp, as grpcgateway.WrapHTTPMux does,
+	// plus a filter: probes of OTEL_TRACES_EXCLUDED_ROUTES (default /health,
+	// /ready, /metrics) get no span
+	probes := routefilter.FromEnv()
+	handler := otelhttp.NewHandler(httpMux, "grpc-gateway-http", otelhttp.WithFilter(probes.Request))
 
 	// Start HTTP server
-	log.Println("✓ HTTP gateway listening on :8080 (instrumented by go-agent)")
-	log.Println("")
-	log.Println("Try these commands:")
-	log.Println("  curl -X POST http://localhost:8080/v1/greeter/hello -d '{\"name\":\"World\"}'")
-	log.Println("  curl http://localhost:8080/health")
-	log.Println("")
-
-	return http.ListenAndServe(":8080", handler)
+	lis, err := net.Listen("tcp", ":8080")
+	if err != nil {
+		return fmt.Errorf("failed to listen on HTTP port: %w", err)
+	}
+	report.Listening("http", lis.Addr().String())
+	report.Set(attribute.Int64("http.request.body.max_size", maxBodyBytes))
+	report.Ready(startupCtx)
+
+	return http.Serve(lis, handler)
+}
+
+// simulateSlowRequest delays a SLOW_REQUEST_RATE fraction of requests by
+// SLOW_REQUEST_DELAY (default 500ms), to give hedging a slow tail to cut.
+// It returns early if the caller cancels.
+func simulateSlowRequest(ctx context.Context) error {
+	rate, _ := strconv.ParseFloat(os.Getenv("SLOW_REQUEST_RATE"), 64)
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	select {
+	case <-time.After(getEnvDuration("SLOW_REQUEST_DELAY", 500*time.Millisecond)):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return d
+	}
+	return fallback
 }
@@ -0,0 +1,70 @@
+// Package gatewaymetrics records request metrics per grpc-gateway route.
+//
+// go-agent's otelhttp handler records http.server.request.duration for every
+// request, but it wraps the outer http.ServeMux, which sends every gateway
+// route to one handler, so its metrics have no http.route. The middleware
+// runs inside the gateway mux, where the matched pattern is known:
+//
+//	mw, err := gatewaymetrics.NewMiddleware()
+//	gwMux := grpcgateway.NewGatewayMux(runtime.WithMiddlewares(mw))
+//
+// It adds http.route to the otelhttp span and metrics, and counts requests
+// in http.server.gateway.requests by method, route and status code. 5xx
+// responses also get error.type, so the counter gives both the rate and the
+// errors of each route.
+package gatewaymetrics
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "grpc-gateway-example/gatewaymetrics"
+
+// NewMiddleware returns the grpc-gateway middleware. Requests that match no
+// route never reach it; otelhttp still records them.
+func NewMiddleware() (runtime.Middleware, error) {
+	requests, err := otel.Meter(instrumentationName).Int64Counter("http.server.gateway.requests",
+		metric.WithDescription("Requests handled by grpc-gateway routes"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			ctx := r.Context()
+			// HTTPPathPattern is only set later, by the generated handler
+			pattern, _ := runtime.HTTPPattern(ctx)
+			routeAttr := semconv.HTTPRoute(pattern.String())
+
+			trace.SpanFromContext(ctx).SetAttributes(routeAttr)
+			if labeler, ok := otelhttp.LabelerFromContext(ctx); ok {
+				labeler.Add(routeAttr)
+			}
+
+			m := httpsnoop.CaptureMetricsFn(w, func(w http.ResponseWriter) {
+				next(w, r, pathParams)
+			})
+
+			attrs := []attribute.KeyValue{
+				semconv.HTTPRequestMethodKey.String(r.Method),
+				routeAttr,
+				semconv.HTTPResponseStatusCode(m.Code),
+			}
+			if m.Code >= http.StatusInternalServerError {
+				attrs = append(attrs, semconv.ErrorTypeKey.String(strconv.Itoa(m.Code)))
+			}
+			requests.Add(ctx, 1, metric.WithAttributes(attrs...))
+		}
+	}, nil
+}
@@ -0,0 +1,196 @@
+// Package grpcerr maps gRPC errors to HTTP responses in the gateway, and
+// records them on the spans of both layers, so an error can be followed from
+// the handler that returned it to the HTTP response.
+//
+// The server records each error it returns, and the gateway maps it to an
+// HTTP status with ErrorHandler:
+//
+//	grpcServer := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(grpcerr.UnaryServerInterceptor()))
+//	gwMux := grpcgateway.NewGatewayMux(runtime.WithErrorHandler(grpcerr.ErrorHandler))
+//
+// Both spans get rpc.grpc.status_code and an rpc.error event. Only server
+// faults (Internal, Unavailable and the like) set the span status to Error:
+// a NotFound or InvalidArgument is the caller's mistake, not a failure of the
+// service.
+package grpcerr
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// httpStatus is how the gateway maps gRPC codes. Codes not listed use the
+// grpc-gateway default.
+var httpStatus = map[codes.Code]int{
+	codes.InvalidArgument:    http.StatusBadRequest,
+	codes.NotFound:           http.StatusNotFound,
+	codes.AlreadyExists:      http.StatusConflict,
+	codes.PermissionDenied:   http.StatusForbidden,
+	codes.Unauthenticated:    http.StatusUnauthorized,
+	codes.ResourceExhausted:  http.StatusTooManyRequests,
+	codes.FailedPrecondition: http.StatusPreconditionFailed,
+	codes.Unavailable:        http.StatusServiceUnavailable,
+	codes.DeadlineExceeded:   http.StatusGatewayTimeout,
+	codes.Internal:           http.StatusInternalServerError,
+}
+
+// HTTPStatus returns the HTTP status the gateway uses for code.
+func HTTPStatus(code codes.Code) int {
+	if s, ok := httpStatus[code]; ok {
+		return s
+	}
+	return runtime.HTTPStatusFromCode(code)
+}
+
+// IsServerFault reports whether code means the service failed, rather than
+// the request being wrong.
+func IsServerFault(code codes.Code) bool {
+	switch code {
+	case codes.Unknown, codes.DeadlineExceeded, codes.Unimplemented,
+		codes.Internal, codes.Unavailable, codes.DataLoss:
+		return true
+	}
+	return false
+}
+
+// Record adds st to span: the rpc.grpc.status_code attribute,
+// an rpc.error event with the message and detail types, and an Error span
+// status for server faults.
+func Record(span trace.Span, st *status.Status) {
+	details := make([]string, 0, len(st.Details()))
+	for _, d := range st.Details() {
+		if m, ok := d.(proto.Message); ok {
+			details = append(details, string(m.ProtoReflect().Descriptor().FullName()))
+		}
+	}
+
+	span.SetAttributes(attribute.Int("rpc.grpc.status_code", int(st.Code())))
+	span.AddEvent("rpc.error", trace.WithAttributes(
+		attribute.String("rpc.grpc.status", statusName(st.Code())),
+		attribute.String("rpc.grpc.message", st.Message()),
+		attribute.StringSlice("rpc.grpc.details", details),
+	))
+	if IsServerFault(st.Code()) {
+		span.SetStatus(otelcodes.Error, st.Message())
+	}
+}
+
+// UnaryServerInterceptor returns an interceptor that records every error a
+// handler returns on the server span.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			Record(trace.SpanFromContext(ctx), status.Convert(err))
+		}
+		return resp, err
+	}
+}
+
+// errorBody is the JSON body of an error response. TraceID lets a client
+// report an error that can be found in the trace.
+type errorBody struct {
+	Code    int               `json:"code"`
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+	TraceID string            `json:"trace_id,omitempty"`
+}
+
+// ErrorHandler is a runtime.ErrorHandlerFunc. It writes the gRPC error as
+// JSON with the HTTP status from HTTPStatus, and records it on the HTTP
+// span.
+func ErrorHandler(_ context.Context, _ *runtime.ServeMux, _ runtime.Marshaler, w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	httpCode := HTTPStatus(st.Code())
+
+	span := trace.SpanFromContext(r.Context())
+	Record(span, st)
+
+	body := errorBody{
+		Code:    httpCode,
+		Status:  statusName(st.Code()),
+		Message: st.Message(),
+	}
+	if sc := span.SpanContext(); sc.HasTraceID() {
+		body.TraceID = sc.TraceID().String()
+	}
+	for _, d := range st.Proto().GetDetails() {
+		if b, err := protojson.Marshal(d); err == nil {
+			body.Details = append(body.Details, b)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpCode)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// statusName returns the canonical name of c, such as NOT_FOUND.
+func statusName(c codes.Code) string {
+	return code.Code(c).String()
+}
+
+// ValidateName returns an InvalidArgument error with a field violation when
+// the request's name is empty, which the gateway maps to a 400.
+func ValidateName(name string) error {
+	if name != "" {
+		return nil
+	}
+	st, _ := status.New(codes.InvalidArgument, "name is required").WithDetails(&errdetails.BadRequest{
+		FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       "name",
+			Description: "must not be empty",
+		}},
+	})
+	return st.Err()
+}
+
+// Simulated returns the error a handler fails with when asked to through
+// the request's simulate_error field, or nil when the field is empty.
+// NOT_FOUND and INVALID_ARGUMENT carry error details, as a real service's
+// errors would.
+func Simulated(field, name string) error {
+	switch field {
+	case "":
+		return nil
+	case "NOT_FOUND":
+		st, _ := status.New(codes.NotFound, "greeting for "+name+" not found").WithDetails(&errdetails.ResourceInfo{
+			ResourceType: "greeting",
+			ResourceName: name,
+			Description:  "no greeting is configured for this name",
+		})
+		return st.Err()
+	case "INVALID_ARGUMENT":
+		st, _ := status.New(codes.InvalidArgument, "invalid request").WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "name",
+				Description: "name " + name + " is not allowed",
+			}},
+		})
+		return st.Err()
+	case "INTERNAL":
+		return status.Error(codes.Internal, "greeting store failed")
+	default:
+		st, _ := status.New(codes.InvalidArgument, "unsupported simulate_error").WithDetails(&errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       "simulate_error",
+				Description: "must be NOT_FOUND, INVALID_ARGUMENT or INTERNAL",
+			}},
+		})
+		return st.Err()
+	}
+}
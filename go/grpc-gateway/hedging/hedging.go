@@ -0,0 +1,232 @@
+// Package hedging sends read RPCs to two gRPC backends and uses the first
+// successful response, cutting tail latency when one backend is slow.
+//
+// Conn implements grpc.ClientConnInterface, so generated clients can use it
+// in place of a *grpc.ClientConn:
+//
+//	conn, err := hedging.NewConn(primary, secondary, hedging.Config{
+//		Delay:   50 * time.Millisecond,
+//		Methods: []string{pb.Greeter_SayHello_FullMethodName},
+//	})
+//	pb.RegisterGreeterHandlerClient(ctx, gwMux, pb.NewGreeterClient(conn))
+//
+// Only methods listed in Config.Methods are hedged. They must be safe to run
+// twice, so list read RPCs only.
+package hedging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+const instrumentationName = "grpc-gateway-example/hedging"
+
+// Config controls which RPCs are hedged and when.
+type Config struct {
+	// Delay is how long to wait for the primary before sending the hedged
+	// request. Zero sends both at once.
+	Delay time.Duration
+	// Methods are the full method names to hedge, such as
+	// "/greeter.Greeter/SayHello". Other RPCs go to the primary only.
+	Methods []string
+}
+
+// Conn hedges unary RPCs across a primary and a secondary connection.
+//
+// Each hedged RPC gets a "hedge <method>" span with one "hedge.attempt"
+// child per request sent. The attempt spans link to each other, and the
+// losing attempt is canceled and marked with hedge.outcome=canceled.
+type Conn struct {
+	primary   *grpc.ClientConn
+	secondary *grpc.ClientConn
+	delay     time.Duration
+	methods   map[string]bool
+
+	tracer   trace.Tracer
+	requests metric.Int64Counter
+}
+
+var _ grpc.ClientConnInterface = (*Conn)(nil)
+
+// NewConn returns a Conn that hedges cfg.Methods across primary and
+// secondary.
+func NewConn(primary, secondary *grpc.ClientConn, cfg Config) (*Conn, error) {
+	requests, err := otel.Meter(instrumentationName).Int64Counter("rpc.client.hedge.requests",
+		metric.WithDescription("Hedged RPCs by whether the hedge was sent and which attempt won"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		return nil, err
+	}
+
+	methods := make(map[string]bool, len(cfg.Methods))
+	for _, m := range cfg.Methods {
+		methods[m] = true
+	}
+	return &Conn{
+		primary:   primary,
+		secondary: secondary,
+		delay:     cfg.Delay,
+		methods:   methods,
+		tracer:    otel.Tracer(instrumentationName),
+		requests:  requests,
+	}, nil
+}
+
+// NewStream opens streams on the primary; streams are not hedged.
+func (c *Conn) NewStream(ctx context.Context, desc *grpc.StreamDesc, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+	return c.primary.NewStream(ctx, desc, method, opts...)
+}
+
+type attempt struct {
+	name   string // "primary" or "hedge"
+	reply  proto.Message
+	span   trace.Span
+	cancel context.CancelFunc
+	done   bool
+}
+
+type result struct {
+	a   *attempt
+	err error
+}
+
+// Invoke runs a unary RPC, hedging it if the method is configured.
+func (c *Conn) Invoke(ctx context.Context, method string, args, reply any, opts ...grpc.CallOption) error {
+	replyMsg, ok := reply.(proto.Message)
+	if !c.methods[method] || !ok {
+		return c.primary.Invoke(ctx, method, args, reply, opts...)
+	}
+
+	ctx, span := c.tracer.Start(ctx, "hedge "+method,
+		trace.WithAttributes(
+			attribute.String("rpc.method", method),
+			attribute.Int64("hedge.delay_ms", c.delay.Milliseconds()),
+		))
+	defer span.End()
+
+	results := make(chan result, 2)
+	start := func(name string, conn *grpc.ClientConn, links ...trace.Link) *attempt {
+		actx, cancel := context.WithCancel(ctx)
+		actx, aspan := c.tracer.Start(actx, "hedge.attempt",
+			trace.WithLinks(links...),
+			trace.WithAttributes(
+				attribute.String("hedge.attempt", name),
+				attribute.String("server.address", conn.Target()),
+			))
+		a := &attempt{name: name, reply: proto.Clone(replyMsg), span: aspan, cancel: cancel}
+		proto.Reset(a.reply)
+		go func() {
+			results <- result{a: a, err: conn.Invoke(actx, method, args, a.reply, opts...)}
+		}()
+		return a
+	}
+
+	primary := start("primary", c.primary)
+	attempts := []*attempt{primary}
+
+	var timer <-chan time.Time
+	if c.delay > 0 {
+		t := time.NewTimer(c.delay)
+		defer t.Stop()
+		timer = t.C
+	} else {
+		timer = closedTimer
+	}
+
+	sendHedge := func() {
+		hedge := start("hedge", c.secondary, trace.Link{SpanContext: primary.span.SpanContext()})
+		primary.span.AddLink(trace.Link{SpanContext: hedge.span.SpanContext()})
+		attempts = append(attempts, hedge)
+		span.AddEvent("hedge.sent")
+	}
+
+	var winner *attempt
+	var lastErr error
+	pending := 1
+	for winner == nil && pending > 0 {
+		select {
+		case <-timer:
+			timer = nil
+			sendHedge()
+			pending++
+		case r := <-results:
+			pending--
+			r.a.done = true
+			if r.err == nil {
+				winner = r.a
+				break
+			}
+			lastErr = r.err
+			r.a.span.RecordError(r.err)
+			r.a.span.SetStatus(codes.Error, r.err.Error())
+			r.a.span.SetAttributes(attribute.String("hedge.outcome", "failed"))
+			// A failed primary doesn't wait out the delay
+			if timer != nil {
+				timer = nil
+				sendHedge()
+				pending++
+			}
+		}
+	}
+
+	for _, a := range attempts {
+		switch {
+		case a == winner:
+			a.span.SetAttributes(attribute.String("hedge.outcome", "won"))
+		case !a.done:
+			// Still running; canceling makes its RPC return codes.Canceled
+			a.span.SetAttributes(attribute.String("hedge.outcome", "canceled"))
+		}
+		a.cancel()
+		a.span.End()
+	}
+
+	hedged := len(attempts) > 1
+	winnerName := "none"
+	if winner != nil {
+		winnerName = winner.name
+	}
+	span.SetAttributes(
+		attribute.Bool("hedge.sent", hedged),
+		attribute.String("hedge.winner", winnerName),
+	)
+	c.requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("rpc.method", method),
+		attribute.Bool("hedge.sent", hedged),
+		attribute.String("hedge.winner", winnerName),
+	))
+
+	if winner == nil {
+		if lastErr == nil {
+			lastErr = errors.New("no hedge attempt completed")
+		}
+		span.RecordError(lastErr)
+		span.SetStatus(codes.Error, lastErr.Error())
+		return lastErr
+	}
+	proto.Reset(replyMsg)
+	proto.Merge(replyMsg, winner.reply)
+	return nil
+}
+
+// closedTimer fires at once, for a zero Delay.
+var closedTimer = func() <-chan time.Time {
+	ch := make(chan time.Time)
+	close(ch)
+	return ch
+}()
+
+// String describes the backends, for logging.
+func (c *Conn) String() string {
+	return fmt.Sprintf("hedging(%s, %s)", c.primary.Target(), c.secondary.Target())
+}
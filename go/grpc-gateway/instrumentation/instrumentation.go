@@ -2,10 +2,13 @@ package instrumentation
 
 import (
 	"context"
+	"errors"
 
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
@@ -27,6 +30,48 @@ func InitTracer(serviceName string) func(context.Context) error {
 	// 	}),
 	// )
 
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(newResource(serviceName)),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown
+}
+
+// InitMeter initializes the OpenTelemetry meter provider, so instrumentation
+// such as otelhttp records metrics. It exports to the same endpoint as the
+// tracer, every OTEL_METRIC_EXPORT_INTERVAL (default 60s). Shutdown exports
+// what was recorded since the last export.
+func InitMeter(serviceName string) func(context.Context) error {
+	exporter, err := otlpmetricgrpc.New(context.Background())
+	if err != nil {
+		panic(err)
+	}
+
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(exporter)),
+		sdkmetric.WithResource(newResource(serviceName)),
+	)
+
+	otel.SetMeterProvider(mp)
+
+	return mp.Shutdown
+}
+
+// Init initializes the tracer and the meter provider, and returns a function
+// that shuts down both.
+func Init(serviceName string) func(context.Context) error {
+	shutdownTracer := InitTracer(serviceName)
+	shutdownMeter := InitMeter(serviceName)
+	return func(ctx context.Context) error {
+		return errors.Join(shutdownMeter(ctx), shutdownTracer(ctx))
+	}
+}
+
+func newResource(serviceName string) *resource.Resource {
 	attr := resource.WithAttributes(
 		semconv.DeploymentEnvironmentKey.String("production"), // You can change this value to "development" or "staging" or you can get the value from the environment variables
 		semconv.ServiceNameKey.String(serviceName),
@@ -45,14 +90,5 @@ func InitTracer(serviceName string) func(context.Context) error {
 	if err != nil {
 		panic(err)
 	}
-
-	tp := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(resources),
-	)
-
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-
-	return tp.Shutdown
+	return resources
 }
@@ -0,0 +1,254 @@
+// Package payloadcapture records the JSON bodies grpc-gateway transcodes as
+// span events, for debugging the mapping between HTTP and gRPC, and the body
+// sizes on the HTTP and gRPC spans.
+//
+// Capture is opt-in, with OTEL_CAPTURE_PAYLOADS=true: bodies carry user data,
+// and every captured byte is stored with the trace. The middleware runs
+// inside the gateway mux, where go-agent's HTTP span is in the context:
+//
+//	gwMux := grpcgateway.NewGatewayMux(runtime.WithMiddlewares(payloadcapture.NewMiddleware(payloadcapture.ConfigFromEnv())))
+//
+// and the interceptor on the gRPC server, for the sizes of the messages it
+// receives and sends:
+//
+//	grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(payloadcapture.UnaryServerInterceptor()))
+//
+// Sizes are recorded whether or not capture is on.
+package payloadcapture
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"github.com/last9/opentelemetry-examples/go/common/redact"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultMaxBytes is how much of each body is recorded when
+// OTEL_CAPTURE_PAYLOADS_MAX_BYTES is not set.
+const DefaultMaxBytes = 2048
+
+// parseLimit is the largest body that is parsed for redaction. Larger bodies
+// are not recorded, only their size.
+const parseLimit = 1 << 20
+
+// DefaultRedactFields are the JSON fields masked when
+// OTEL_CAPTURE_PAYLOADS_REDACT is not set.
+var DefaultRedactFields = []string{"password", "token", "secret", "authorization", "api_key"}
+
+// Attributes of the body events, besides http.request.body.size and
+// http.response.body.size.
+const (
+	// ContentKey is the body, redacted, and truncated to MaxBytes.
+	ContentKey = attribute.Key("http.body.content")
+	// TruncatedKey is true when the content was cut at MaxBytes.
+	TruncatedKey = attribute.Key("http.body.truncated")
+	// SkippedKey is why a body has no content: "not_json" or "too_large".
+	// Bodies that can't be parsed can't be redacted, so they aren't
+	// recorded.
+	SkippedKey = attribute.Key("http.body.skipped")
+)
+
+// Attributes of the gRPC server span, set by UnaryServerInterceptor.
+const (
+	RPCRequestSizeKey  = attribute.Key("rpc.request.body.size")
+	RPCResponseSizeKey = attribute.Key("rpc.response.body.size")
+)
+
+// Config configures NewMiddleware.
+type Config struct {
+	// Enabled turns on body capture.
+	Enabled bool
+	// MaxBytes is the most of each body recorded.
+	MaxBytes int
+	// RedactFields are the JSON object keys whose values are replaced with
+	// redact.Mask, at any depth. They match case-insensitively.
+	RedactFields []string
+}
+
+// ConfigFromEnv returns a Config with Enabled from OTEL_CAPTURE_PAYLOADS,
+// MaxBytes from OTEL_CAPTURE_PAYLOADS_MAX_BYTES and RedactFields from the
+// comma-separated OTEL_CAPTURE_PAYLOADS_REDACT, or the defaults.
+func ConfigFromEnv() Config {
+	cfg := Config{MaxBytes: DefaultMaxBytes, RedactFields: DefaultRedactFields}
+	cfg.Enabled, _ = strconv.ParseBool(os.Getenv("OTEL_CAPTURE_PAYLOADS"))
+	if n, err := strconv.Atoi(os.Getenv("OTEL_CAPTURE_PAYLOADS_MAX_BYTES")); err == nil && n > 0 {
+		cfg.MaxBytes = n
+	}
+	if v := os.Getenv("OTEL_CAPTURE_PAYLOADS_REDACT"); v != "" {
+		cfg.RedactFields = strings.Split(v, ",")
+	}
+	return cfg
+}
+
+// NewMiddleware returns the grpc-gateway middleware. It sets
+// http.request.body.size and http.response.body.size on the HTTP span, and
+// with cfg.Enabled adds http.request.body and http.response.body events.
+func NewMiddleware(cfg Config) runtime.Middleware {
+	redactFields := make(map[string]bool, len(cfg.RedactFields))
+	for _, f := range cfg.RedactFields {
+		redactFields[strings.ToLower(strings.TrimSpace(f))] = true
+	}
+	c := capturer{maxBytes: cfg.MaxBytes, redactFields: redactFields}
+
+	return func(next runtime.HandlerFunc) runtime.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+			span := trace.SpanFromContext(r.Context())
+
+			// The gateway decodes the body after this, so it gets what was
+			// read, and the read's error, such as bodylimit's 413
+			reqBody := &countingReader{r: r.Body}
+			var reqBuf bytes.Buffer
+			if cfg.Enabled {
+				_, err := io.Copy(&reqBuf, reqBody)
+				reqBody = &countingReader{r: io.MultiReader(bytes.NewReader(reqBuf.Bytes()), errReader{err})}
+			}
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{reqBody, r.Body}
+
+			var respSize int64
+			var respBuf bytes.Buffer
+			w = httpsnoop.Wrap(w, httpsnoop.Hooks{
+				Write: func(write httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+					return func(b []byte) (int, error) {
+						n, err := write(b)
+						respSize += int64(n)
+						if cfg.Enabled && respBuf.Len() <= parseLimit {
+							respBuf.Write(b[:n])
+						}
+						return n, err
+					}
+				},
+			})
+
+			next(w, r, pathParams)
+
+			reqSize := reqBody.n
+			if cfg.Enabled {
+				reqSize = int64(reqBuf.Len())
+			}
+			span.SetAttributes(
+				semconv.HTTPRequestBodySize(int(reqSize)),
+				semconv.HTTPResponseBodySize(int(respSize)),
+			)
+			if !cfg.Enabled {
+				return
+			}
+			if reqSize > 0 {
+				span.AddEvent("http.request.body", trace.WithAttributes(
+					append(c.content(reqBuf.Bytes()), semconv.HTTPRequestBodySize(int(reqSize)))...))
+			}
+			if respSize > 0 {
+				span.AddEvent("http.response.body", trace.WithAttributes(
+					append(c.content(respBuf.Bytes()), semconv.HTTPResponseBodySize(int(respSize)))...))
+			}
+		}
+	}
+}
+
+type capturer struct {
+	maxBytes     int
+	redactFields map[string]bool
+}
+
+// content returns the attributes of a body event for body: the redacted,
+// truncated JSON, or why there is none.
+func (c capturer) content(body []byte) []attribute.KeyValue {
+	if len(body) > parseLimit {
+		return []attribute.KeyValue{SkippedKey.String("too_large")}
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []attribute.KeyValue{SkippedKey.String("not_json")}
+	}
+	redacted, err := json.Marshal(c.redact(v))
+	if err != nil {
+		return []attribute.KeyValue{SkippedKey.String("not_json")}
+	}
+
+	truncated := len(redacted) > c.maxBytes
+	if truncated {
+		cut := c.maxBytes
+		// Don't split a UTF-8 sequence
+		for cut > 0 && !utf8.RuneStart(redacted[cut]) {
+			cut--
+		}
+		redacted = redacted[:cut]
+	}
+	return []attribute.KeyValue{ContentKey.String(string(redacted)), TruncatedKey.Bool(truncated)}
+}
+
+// redact masks the values of redactFields in v, at any depth
+func (c capturer) redact(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if c.redactFields[strings.ToLower(key)] {
+				v[key] = redact.Mask
+			} else {
+				v[key] = c.redact(value)
+			}
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = c.redact(value)
+		}
+	}
+	return v
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// errReader returns err, or io.EOF if it is nil
+type errReader struct{ err error }
+
+func (e errReader) Read([]byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	return 0, io.EOF
+}
+
+// UnaryServerInterceptor sets the sizes of the request and response messages
+// on the gRPC server span: rpc.request.body.size and rpc.response.body.size,
+// in bytes of protobuf wire format. Compare them with the HTTP body sizes to
+// see what transcoding to JSON costs.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		span := trace.SpanFromContext(ctx)
+		if m, ok := req.(proto.Message); ok {
+			span.SetAttributes(RPCRequestSizeKey.Int(proto.Size(m)))
+		}
+		resp, err := handler(ctx, req)
+		if m, ok := resp.(proto.Message); ok && err == nil {
+			span.SetAttributes(RPCResponseSizeKey.Int(proto.Size(m)))
+		}
+		return resp, err
+	}
+}
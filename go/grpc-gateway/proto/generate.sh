@@ -20,3 +20,4 @@ echo "Generated files:"
 echo "  - proto/greeter.pb.go (protobuf messages)"
 echo "  - proto/greeter_grpc.pb.go (gRPC server/client)"
 echo "  - proto/greeter.pb.gw.go (grpc-gateway HTTP proxy)"
+echo "  - proto/v2/greeter.pb.go (v2 messages for the evolution demo)"
@@ -0,0 +1,219 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: v2/greeter.proto
+
+// greeter.v2 is the second version of the Greeter messages. It is wire
+// compatible with greeter.HelloRequest and greeter.HelloReply: existing
+// fields keep their numbers and types, and new fields only add numbers.
+//
+// The RPC is still greeter.Greeter/SayHello, so v1 and v2 clients and
+// servers can talk to each other.
+
+package greeterv2
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type HelloRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Name  string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	// Added in v2. A v1 server keeps it as an unknown field.
+	Language string `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`
+	// Added in v2.
+	Formal bool `protobuf:"varint,3,opt,name=formal,proto3" json:"formal,omitempty"`
+	// Same as greeter.HelloRequest.simulate_error.
+	SimulateError string `protobuf:"bytes,4,opt,name=simulate_error,json=simulateError,proto3" json:"simulate_error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HelloRequest) Reset() {
+	*x = HelloRequest{}
+	mi := &file_v2_greeter_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HelloRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HelloRequest) ProtoMessage() {}
+
+func (x *HelloRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_greeter_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HelloRequest.ProtoReflect.Descriptor instead.
+func (*HelloRequest) Descriptor() ([]byte, []int) {
+	return file_v2_greeter_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *HelloRequest) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HelloRequest) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+func (x *HelloRequest) GetFormal() bool {
+	if x != nil {
+		return x.Formal
+	}
+	return false
+}
+
+func (x *HelloRequest) GetSimulateError() string {
+	if x != nil {
+		return x.SimulateError
+	}
+	return ""
+}
+
+type HelloReply struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// Added in v2: the language of the greeting. A v1 client keeps it as an
+	// unknown field.
+	Language      string `protobuf:"bytes,2,opt,name=language,proto3" json:"language,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HelloReply) Reset() {
+	*x = HelloReply{}
+	mi := &file_v2_greeter_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HelloReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HelloReply) ProtoMessage() {}
+
+func (x *HelloReply) ProtoReflect() protoreflect.Message {
+	mi := &file_v2_greeter_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HelloReply.ProtoReflect.Descriptor instead.
+func (*HelloReply) Descriptor() ([]byte, []int) {
+	return file_v2_greeter_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *HelloReply) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *HelloReply) GetLanguage() string {
+	if x != nil {
+		return x.Language
+	}
+	return ""
+}
+
+var File_v2_greeter_proto protoreflect.FileDescriptor
+
+const file_v2_greeter_proto_rawDesc = "" +
+	"\n" +
+	"\x10v2/greeter.proto\x12\n" +
+	"greeter.v2\"}\n" +
+	"\fHelloRequest\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguage\x12\x16\n" +
+	"\x06formal\x18\x03 \x01(\bR\x06formal\x12%\n" +
+	"\x0esimulate_error\x18\x04 \x01(\tR\rsimulateError\"B\n" +
+	"\n" +
+	"HelloReply\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x1a\n" +
+	"\blanguage\x18\x02 \x01(\tR\blanguageB)Z'grpc-gateway-example/proto/v2;greeterv2b\x06proto3"
+
+var (
+	file_v2_greeter_proto_rawDescOnce sync.Once
+	file_v2_greeter_proto_rawDescData []byte
+)
+
+func file_v2_greeter_proto_rawDescGZIP() []byte {
+	file_v2_greeter_proto_rawDescOnce.Do(func() {
+		file_v2_greeter_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_v2_greeter_proto_rawDesc), len(file_v2_greeter_proto_rawDesc)))
+	})
+	return file_v2_greeter_proto_rawDescData
+}
+
+var file_v2_greeter_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_v2_greeter_proto_goTypes = []any{
+	(*HelloRequest)(nil), // 0: greeter.v2.HelloRequest
+	(*HelloReply)(nil),   // 1: greeter.v2.HelloReply
+}
+var file_v2_greeter_proto_depIdxs = []int32{
+	0, // [0:0] is the sub-list for method output_type
+	0, // [0:0] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_v2_greeter_proto_init() }
+func file_v2_greeter_proto_init() {
+	if File_v2_greeter_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_v2_greeter_proto_rawDesc), len(file_v2_greeter_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   2,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_v2_greeter_proto_goTypes,
+		DependencyIndexes: file_v2_greeter_proto_depIdxs,
+		MessageInfos:      file_v2_greeter_proto_msgTypes,
+	}.Build()
+	File_v2_greeter_proto = out.File
+	file_v2_greeter_proto_goTypes = nil
+	file_v2_greeter_proto_depIdxs = nil
+}
@@ -0,0 +1,144 @@
+// Package protocompat records which message schema version each side of an
+// RPC uses, and counts the fields a side received but didn't know about.
+//
+// Clients send their schema version in x-schema-version metadata and servers
+// send theirs back in the response header:
+//
+//	grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(protocompat.UnaryServerInterceptor("v2")))
+//	grpc.NewClient(addr, grpc.WithChainUnaryInterceptor(protocompat.UnaryClientInterceptor("v1")))
+//
+// An unknown field is one whose number the local schema doesn't define,
+// typically a field added in a newer version. proto3 keeps them on decode, so
+// a nonzero count shows a version mismatch that is safe, while failed calls
+// or wrong values with a zero count point at an incompatible change.
+package protocompat
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+const instrumentationName = "grpc-gateway-example/protocompat"
+
+// MetadataKey carries the schema version of the client in request metadata
+// and of the server in response headers.
+const MetadataKey = "x-schema-version"
+
+// unknownVersion is recorded when the peer didn't send its version.
+const unknownVersion = "unknown"
+
+var unknownFields metric.Int64Counter
+
+func init() {
+	var err error
+	unknownFields, err = otel.Meter(instrumentationName).Int64Counter("rpc.unknown_fields",
+		metric.WithDescription("Fields received that the local message schema doesn't define"),
+		metric.WithUnit("{field}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+}
+
+// UnaryServerInterceptor tags the server span with the request and server
+// schema versions, and records unknown fields in the request.
+func UnaryServerInterceptor(version string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		peer := unknownVersion
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if v := md.Get(MetadataKey); len(v) > 0 {
+				peer = v[0]
+			}
+		}
+		_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataKey, version))
+
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			attribute.String("rpc.request.schema_version", peer),
+			attribute.String("rpc.server.schema_version", version),
+		)
+		record(ctx, span, "request", info.FullMethod, req, version, peer)
+		return handler(ctx, req)
+	}
+}
+
+// UnaryClientInterceptor sends the client schema version and records
+// unknown fields in the response.
+//
+// The client RPC span is started inside the call, so the attributes and
+// events go on the caller's span.
+func UnaryClientInterceptor(version string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, MetadataKey, version)
+		var header metadata.MD
+		err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+
+		peer := unknownVersion
+		if v := header.Get(MetadataKey); len(v) > 0 {
+			peer = v[0]
+		}
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(
+			attribute.String("rpc.client.schema_version", version),
+			attribute.String("rpc.response.schema_version", peer),
+		)
+		if err == nil {
+			record(ctx, span, "response", method, reply, version, peer)
+		}
+		return err
+	}
+}
+
+// record counts the unknown fields of msg and adds a proto.unknown_fields
+// event listing their numbers. Only top-level fields are checked.
+func record(ctx context.Context, span trace.Span, direction, method string, msg any, local, peer string) {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return
+	}
+	numbers := UnknownFieldNumbers(m)
+	span.SetAttributes(attribute.Int("rpc."+direction+".unknown_fields", len(numbers)))
+	if len(numbers) == 0 {
+		return
+	}
+
+	name := string(m.ProtoReflect().Descriptor().FullName())
+	span.AddEvent("proto.unknown_fields", trace.WithAttributes(
+		attribute.String("proto.message", name),
+		attribute.IntSlice("proto.unknown_field_numbers", numbers),
+	))
+	unknownFields.Add(ctx, int64(len(numbers)), metric.WithAttributes(
+		attribute.String("rpc.method", method),
+		attribute.String("proto.message", name),
+		attribute.String("rpc.message.direction", direction),
+		attribute.String("schema.version.local", local),
+		attribute.String("schema.version.peer", peer),
+	))
+}
+
+// UnknownFieldNumbers returns the numbers of the unknown fields of m, once
+// each, in the order they were received.
+func UnknownFieldNumbers(m proto.Message) []int {
+	b := m.ProtoReflect().GetUnknown()
+	var numbers []int
+	seen := map[protowire.Number]bool{}
+	for len(b) > 0 {
+		num, _, n := protowire.ConsumeField(b)
+		if n < 0 {
+			break
+		}
+		if !seen[num] {
+			seen[num] = true
+			numbers = append(numbers, int(num))
+		}
+		b = b[n:]
+	}
+	return numbers
+}
@@ -3,11 +3,19 @@ package main
 import (
 	"context"
 	"log"
+	"math/rand"
 	"net"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/last9/go-agent"
 	"github.com/last9/go-agent/instrumentation/grpcgateway"
+	"google.golang.org/grpc"
+	"grpc-gateway-example/faultinject"
+	"grpc-gateway-example/grpcerr"
 	pb "grpc-gateway-example/proto"
+	"grpc-gateway-example/startup"
 )
 
 type server struct {
@@ -16,6 +24,15 @@ type server struct {
 
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
 	log.Printf("gRPC Server received: name=%s", in.Name)
+	if err := grpcerr.ValidateName(in.Name); err != nil {
+		return nil, err
+	}
+	if err := grpcerr.Simulated(in.SimulateError, in.Name); err != nil {
+		return nil, err
+	}
+	if err := simulateSlowRequest(ctx); err != nil {
+		return nil, err
+	}
 	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
 }
 
@@ -24,19 +41,48 @@ func main() {
 	agent.Start()
 	defer agent.Shutdown()
 
-	log.Println("✓ go-agent initialized")
+	// Startup is recorded as a service.startup span with a service.start
+	// event, rather than logged
+	ctx, report := startup.Begin(context.Background())
 
-	lis, err := net.Listen("tcp", ":50051")
+	port := os.Getenv("GRPC_PORT")
+	if port == "" {
+		port = "50051"
+	}
+	lis, err := net.Listen("tcp", ":"+port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+	report.Listening("grpc", lis.Addr().String())
 
 	// Create gRPC server with go-agent (automatic instrumentation)
-	s := grpcgateway.NewGrpcServer()
+	// x-fail-with metadata makes the server return that status code, and
+	// every returned error is recorded on the server span
+	s := grpcgateway.NewGrpcServer(grpc.ChainUnaryInterceptor(grpcerr.UnaryServerInterceptor(), faultinject.UnaryServerInterceptor()))
 
 	pb.RegisterGreeterServer(s, &server{})
-	log.Printf("✓ gRPC server listening at %v (instrumented by go-agent)", lis.Addr())
+	report.Ready(ctx)
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+// simulateSlowRequest delays a SLOW_REQUEST_RATE fraction of requests by
+// SLOW_REQUEST_DELAY (default 500ms), to give hedging a slow tail to cut.
+// It returns early if the caller cancels.
+func simulateSlowRequest(ctx context.Context) error {
+	rate, _ := strconv.ParseFloat(os.Getenv("SLOW_REQUEST_RATE"), 64)
+	if rate <= 0 || rand.Float64() >= rate {
+		return nil
+	}
+	delay := 500 * time.Millisecond
+	if d, err := time.ParseDuration(os.Getenv("SLOW_REQUEST_DELAY")); err == nil {
+		delay = d
+	}
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,187 @@
+// Package startup records a service's startup as telemetry instead of a log
+// banner, so deployment automation can check that a new instance came up
+// healthy by querying the backend rather than parsing logs.
+//
+// A Report is a service.startup span, covering startup from Begin to Ready.
+// Ready adds a service.start event to it carrying what was found along the
+// way: which components are enabled and connected, feature flags, listen
+// addresses and versions. It also increments the service.starts counter with
+// the component flags and versions, since a metric is exported even when the
+// trace isn't sampled:
+//
+//	ctx, report := startup.Begin(context.Background())
+//	db, err := database.Open(cfg)
+//	report.Component("db", err)
+//	report.Ready(ctx)
+//
+// A component that failed to connect is recorded on the span as an error,
+// and makes the event's startup.healthy false.
+package startup
+
+import (
+	"context"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "grpc-gateway-example/startup"
+
+// EventName is the name of the span event Ready adds.
+const EventName = "service.start"
+
+// HealthyKey is true in the service.start event and the service.starts
+// counter when every enabled component connected.
+const HealthyKey = attribute.Key("startup.healthy")
+
+// FlushTimeout bounds the span flush in Ready.
+const FlushTimeout = 2 * time.Second
+
+// Report collects a service's startup state. Create it with Begin.
+type Report struct {
+	span trace.Span
+
+	mu sync.Mutex
+	// metricAttrs are the flags and versions, also kept on the counter;
+	// attrs adds values too fine-grained for a metric, such as addresses
+	metricAttrs []attribute.KeyValue
+	attrs       []attribute.KeyValue
+	healthy     bool
+	done        bool
+}
+
+// Begin starts the service.startup span. The span is a new root: it is the
+// startup of this process, not part of whatever trace ctx carries.
+func Begin(ctx context.Context) (context.Context, *Report) {
+	ctx, span := otel.Tracer(instrumentationName).Start(ctx, "service.startup",
+		trace.WithNewRoot(), trace.WithSpanKind(trace.SpanKindInternal))
+	r := &Report{span: span, healthy: true}
+	r.metricAttrs = versions()
+	return ctx, r
+}
+
+// Component records whether a dependency named name, such as "db" or
+// "redis", connected: err is nil if it did. It sets <name>.enabled and
+// <name>.connected.
+func (r *Report) Component(name string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metricAttrs = append(r.metricAttrs,
+		attribute.Bool(name+".enabled", true),
+		attribute.Bool(name+".connected", err == nil))
+	if err != nil {
+		r.healthy = false
+		r.span.RecordError(err, trace.WithAttributes(attribute.String("startup.component", name)))
+	}
+}
+
+// Disabled records that a dependency named name wasn't configured, so it
+// isn't counted against startup.healthy. It sets <name>.enabled and
+// <name>.connected to false.
+func (r *Report) Disabled(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metricAttrs = append(r.metricAttrs,
+		attribute.Bool(name+".enabled", false),
+		attribute.Bool(name+".connected", false))
+}
+
+// Flag records a feature flag, such as hedging being on. Flags are kept on
+// the counter, so they must have few distinct values.
+func (r *Report) Flag(kv ...attribute.KeyValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metricAttrs = append(r.metricAttrs, kv...)
+}
+
+// Set records attributes for the event only, such as limits and backend
+// addresses.
+func (r *Report) Set(kv ...attribute.KeyValue) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attrs = append(r.attrs, kv...)
+}
+
+// Listening records that server name, such as "grpc" or "http", listens on
+// addr, as <name>.listen.address.
+func (r *Report) Listening(name, addr string) {
+	r.Set(attribute.String(name+".listen.address", addr))
+}
+
+// Ready adds the service.start event, counts the start, ends the span and
+// flushes it, so the event is exported without waiting for the next batch.
+// The flush is bounded by FlushTimeout, so an unreachable backend delays
+// startup by at most that. Call Ready once every listener is bound; later
+// calls do nothing.
+func (r *Report) Ready(ctx context.Context) {
+	r.mu.Lock()
+	if r.done {
+		r.mu.Unlock()
+		return
+	}
+	r.done = true
+	metricAttrs := append(r.metricAttrs, HealthyKey.Bool(r.healthy))
+	attrs := append(append([]attribute.KeyValue{}, metricAttrs...), r.attrs...)
+	healthy := r.healthy
+	r.mu.Unlock()
+
+	r.span.SetAttributes(attrs...)
+	r.span.AddEvent(EventName, trace.WithAttributes(attrs...))
+	if !healthy {
+		r.span.SetStatus(codes.Error, "a component failed to connect")
+	}
+	r.span.End()
+
+	starts, err := otel.Meter(instrumentationName).Int64Counter("service.starts",
+		metric.WithDescription("Service starts, by component state and version"),
+		metric.WithUnit("{start}"))
+	if err != nil {
+		otel.Handle(err)
+	} else {
+		starts.Add(ctx, 1, metric.WithAttributes(metricAttrs...))
+	}
+
+	// The SDK TracerProvider can flush; the API's can't
+	if tp, ok := otel.GetTracerProvider().(interface{ ForceFlush(context.Context) error }); ok {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), FlushTimeout)
+		defer cancel()
+		if err := tp.ForceFlush(ctx); err != nil {
+			otel.Handle(err)
+		}
+	}
+}
+
+// versions returns the Go, OpenTelemetry and go-agent versions, and the
+// main module's, when the binary was built with module information.
+func versions() []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		semconv.ProcessRuntimeVersion(runtime.Version()),
+		attribute.String("otel.version", otel.Version()),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return attrs
+	}
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		attrs = append(attrs, attribute.String("build.version", v))
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == "github.com/last9/go-agent" {
+			attrs = append(attrs, attribute.String("go_agent.version", dep.Version))
+		}
+	}
+	for _, s := range info.Settings {
+		if s.Key == "vcs.revision" {
+			attrs = append(attrs, attribute.String("vcs.revision", s.Value))
+		}
+	}
+	return attrs
+}
@@ -1,28 +1,28 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/last9/go-agent"
 	httpagent "github.com/last9/go-agent/integrations/http"
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
-type HelloRequest struct {
-	Name string `json:"name"`
-}
-
-type HelloReply struct {
-	Message string `json:"message"`
-}
-
 var names = []string{
 	"Alice", "Bob", "Charlie", "Diana", "Eve",
 	"Frank", "Grace", "Henry", "Ivy", "Jack",
@@ -31,7 +31,130 @@ var names = []string{
 	"Uma", "Victor", "Wendy", "Xavier", "Yara", "Zoe",
 }
 
+// loadProfile describes the traffic to send. Every field has a flag and an
+// environment variable; the flag wins.
+type loadProfile struct {
+	URL         string
+	RPS         float64
+	Duration    time.Duration
+	Concurrency int
+	// RampUp is how long the rate takes to rise linearly from zero to RPS.
+	RampUp time.Duration
+	// BadPercent is the percentage of requests sent with an empty name,
+	// which the server rejects with a 400. It applies to the default
+	// greeter traffic only.
+	BadPercent float64
+	// Scenarios is the path of a scenario file describing the traffic mix.
+	// Empty sends greetings to URL.
+	Scenarios string
+}
+
+func loadProfileFromFlags() loadProfile {
+	var p loadProfile
+	flag.StringVar(&p.URL, "url", getEnv("TARGET_URL", "http://localhost:8080/v1/greeter/hello"), "greeter endpoint to send requests to without -scenarios (TARGET_URL)")
+	flag.Float64Var(&p.RPS, "rps", getEnvFloat("RPS", 5), "target requests per second (RPS)")
+	flag.DurationVar(&p.Duration, "duration", getEnvDuration("DURATION", 30*time.Second), "how long to send requests, ramp-up included (DURATION)")
+	flag.IntVar(&p.Concurrency, "concurrency", getEnvInt("CONCURRENCY", 10), "number of workers sending requests (CONCURRENCY)")
+	flag.DurationVar(&p.RampUp, "ramp-up", getEnvDuration("RAMP_UP", 0), "time to ramp the rate up from zero to -rps (RAMP_UP)")
+	flag.Float64Var(&p.BadPercent, "bad-percent", getEnvFloat("BAD_REQUEST_PERCENT", 0), "percentage of greetings sent with an empty name (BAD_REQUEST_PERCENT)")
+	flag.StringVar(&p.Scenarios, "scenarios", os.Getenv("SCENARIO_FILE"), "YAML or JSON file describing a weighted mix of requests (SCENARIO_FILE)")
+	flag.Parse()
+	return p
+}
+
+func (p loadProfile) validate() error {
+	switch {
+	case p.RPS <= 0:
+		return fmt.Errorf("rps must be positive, got %v", p.RPS)
+	case p.Duration <= 0:
+		return fmt.Errorf("duration must be positive, got %v", p.Duration)
+	case p.Concurrency <= 0:
+		return fmt.Errorf("concurrency must be positive, got %d", p.Concurrency)
+	case p.RampUp < 0 || p.RampUp > p.Duration:
+		return fmt.Errorf("ramp-up must be between 0 and the duration, got %v", p.RampUp)
+	case p.BadPercent < 0 || p.BadPercent > 100:
+		return fmt.Errorf("bad-percent must be between 0 and 100, got %v", p.BadPercent)
+	}
+	return nil
+}
+
+// rateAt returns the target rate at elapsed time t into the run.
+func (p loadProfile) rateAt(t time.Duration) float64 {
+	if p.RampUp == 0 || t >= p.RampUp {
+		return p.RPS
+	}
+	// At least 1 rps, so the first request of a ramp is not scheduled
+	// at infinity
+	return max(p.RPS*float64(t)/float64(p.RampUp), min(p.RPS, 1))
+}
+
+// job is one request for a worker to send.
+type job struct {
+	scenario int
+	seq      int
+}
+
+// scenarioStats collects the outcomes and latencies of one scenario. A
+// request is expected when its status is one the scenario expects, so a
+// deliberately bad request that gets its 400 is not a failure.
+type scenarioStats struct {
+	latencies  []time.Duration
+	expected   int
+	unexpected int
+}
+
+// stats collects the outcome and latency of every request.
+type stats struct {
+	mu         sync.Mutex
+	byScenario []scenarioStats
+	// dropped counts requests not sent because every worker was busy.
+	dropped int
+}
+
+func (s *stats) record(scenario int, expected bool, latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	st := &s.byScenario[scenario]
+	if expected {
+		st.expected++
+	} else {
+		st.unexpected++
+	}
+	st.latencies = append(st.latencies, latency)
+}
+
+// percentile returns the nearest-rank percentile of sorted latencies.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p/100+0.5) - 1
+	return sorted[min(max(i, 0), len(sorted)-1)]
+}
+
+func sortedLatencies(latencies []time.Duration) []time.Duration {
+	sorted := append([]time.Duration(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted
+}
+
 func main() {
+	profile := loadProfileFromFlags()
+	if err := profile.validate(); err != nil {
+		log.Fatalf("invalid load profile: %v", err)
+	}
+
+	scenarios := defaultScenarios(profile.URL, profile.BadPercent)
+	if profile.Scenarios != "" {
+		var err error
+		if scenarios, err = loadScenarios(profile.Scenarios); err != nil {
+			log.Fatalf("invalid scenario file: %v", err)
+		}
+		if profile.BadPercent > 0 {
+			log.Printf("⚠️  -bad-percent is ignored with -scenarios; add a scenario with expect_status instead")
+		}
+	}
+
 	// Initialize go-agent (automatic OpenTelemetry setup)
 	agent.Start()
 	defer agent.Shutdown()
@@ -42,97 +165,204 @@ func main() {
 	client := httpagent.NewClient(&http.Client{
 		Timeout: 5 * time.Second,
 	})
-
-	const totalRequests = 100
-	successCount := 0
-	failureCount := 0
+	tracer := otel.Tracer("grpc-gateway-traffic-generator")
+	runID := testrun.NewRunID()
 
 	log.Printf("🚀 Starting traffic generator...")
-	log.Printf("   Target: http://localhost:8080/v1/greeter/hello")
-	log.Printf("   Total requests: %d", totalRequests)
+	log.Printf("   Rate: %v rps for %v (ramp-up %v)", profile.RPS, profile.Duration, profile.RampUp)
+	log.Printf("   Workers: %d", profile.Concurrency)
+	log.Printf("   Scenarios:")
+	for _, sc := range scenarios {
+		log.Printf("     %-28s weight %-5d %s %s", sc.Name, sc.weight, sc.Method, sc.url)
+	}
 	log.Println("")
 
+	st := &stats{byScenario: make([]scenarioStats, len(scenarios))}
+	// Buffer one job per worker, so short stalls do not drop requests
+	jobs := make(chan job, profile.Concurrency)
+	var wg sync.WaitGroup
+	for range profile.Concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				sc := &scenarios[j.scenario]
+				start := time.Now()
+				err := sendRequest(context.Background(), tracer, client, sc, j.seq, runID)
+				st.record(j.scenario, err == nil, time.Since(start))
+				if err != nil {
+					log.Printf("  ✗ %s: %v", sc.Name, err)
+				}
+			}
+		}()
+	}
+
 	startTime := time.Now()
+	dispatch(profile, newPicker(scenarios), jobs, st)
+	close(jobs)
+	wg.Wait()
+	duration := time.Since(startTime)
 
-	for i := 0; i < totalRequests; i++ {
-		// Pick a random name
-		name := names[rand.Intn(len(names))]
+	printSummary(scenarios, st, duration)
 
-		// Create a new context for each request
-		ctx := context.Background()
+	log.Println("")
+	log.Println("🔍 View traces in Last9 dashboard:")
+	log.Println("   https://app.last9.io")
+	log.Println("   Service name: grpc-gateway-traffic-generator")
+	log.Println("   Filter by scenario: traffic_gen.scenario")
+
+	// Give time for final traces to be exported
+	time.Sleep(2 * time.Second)
+}
 
-		// Send request (automatically instrumented by go-agent)
-		if err := sendRequest(ctx, client, name, i+1, totalRequests); err != nil {
-			log.Printf("  ✗ [%d/%d] Request failed: %v", i+1, totalRequests, err)
-			failureCount++
-		} else {
-			successCount++
+// dispatch queues jobs at the profile's rate until its duration is up. When
+// every worker is busy and the queue is full, the request is dropped rather
+// than sent late, so the offered rate stays honest and the drop count shows
+// the pool is too small.
+func dispatch(p loadProfile, pk *picker, jobs chan<- job, st *stats) {
+	start := time.Now()
+	next := time.Duration(0)
+	for seq := 1; next < p.Duration; seq++ {
+		time.Sleep(time.Until(start.Add(next)))
+
+		select {
+		case jobs <- job{scenario: pk.pick(), seq: seq}:
+		default:
+			st.mu.Lock()
+			st.dropped++
+			st.mu.Unlock()
 		}
 
-		// Random delay between requests (100ms to 1s)
-		delay := time.Duration(100+rand.Intn(900)) * time.Millisecond
-		time.Sleep(delay)
+		next += time.Duration(float64(time.Second) / p.rateAt(next))
 	}
+}
 
-	duration := time.Since(startTime)
+func printSummary(scenarios []scenario, st *stats, duration time.Duration) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	var all []time.Duration
+	expected, unexpected := 0, 0
+	for _, s := range st.byScenario {
+		all = append(all, s.latencies...)
+		expected += s.expected
+		unexpected += s.unexpected
+	}
+	sent := len(all)
 
 	log.Println("")
 	log.Println("✅ Traffic generation complete!")
-	log.Printf("   Duration: %v", duration)
-	log.Printf("   Successful: %d/%d", successCount, totalRequests)
-	log.Printf("   Failed: %d/%d", failureCount, totalRequests)
-	log.Printf("   Avg time per request: %v", duration/time.Duration(totalRequests))
+	log.Printf("   Duration: %v", duration.Round(time.Millisecond))
+	log.Printf("   Sent: %d (%.1f rps achieved)", sent, float64(sent)/duration.Seconds())
+	log.Printf("   Expected responses: %d", expected)
+	log.Printf("   Unexpected responses: %d", unexpected)
+	log.Printf("   Dropped (all workers busy): %d", st.dropped)
+	if sent == 0 {
+		return
+	}
+
+	sorted := sortedLatencies(all)
 	log.Println("")
-	log.Println("🔍 View traces in Last9 dashboard:")
-	log.Println("   https://app.last9.io")
-	log.Println("   Service name: grpc-gateway-traffic-generator")
-	log.Println("   Downstream service: grpc-gateway-demo")
+	log.Println("   Latency:")
+	for _, p := range []float64{50, 90, 95, 99} {
+		log.Printf("     p%-3v %v", p, percentile(sorted, p).Round(time.Microsecond))
+	}
+	log.Printf("     max  %v", sorted[sent-1].Round(time.Microsecond))
 
-	// Give time for final traces to be exported
-	time.Sleep(2 * time.Second)
+	log.Println("")
+	log.Printf("   %-28s %6s %9s %11s %10s %10s", "Scenario", "Sent", "Expected", "Unexpected", "p50", "p99")
+	for i, s := range st.byScenario {
+		if len(s.latencies) == 0 {
+			continue
+		}
+		sorted := sortedLatencies(s.latencies)
+		log.Printf("   %-28s %6d %9d %11d %10v %10v", scenarios[i].Name, len(sorted), s.expected, s.unexpected,
+			percentile(sorted, 50).Round(time.Microsecond), percentile(sorted, 99).Round(time.Microsecond))
+	}
 }
 
-func sendRequest(ctx context.Context, client *http.Client, name string, reqNum, total int) error {
-	// Prepare request body
-	reqBody := HelloRequest{Name: name}
-	jsonData, err := json.Marshal(reqBody)
+// sendRequest sends one request of a scenario under a scenario span, and
+// returns an error when it fails or gets a status the scenario does not
+// expect.
+func sendRequest(ctx context.Context, tracer trace.Tracer, client *http.Client, sc *scenario, seq int, runID string) error {
+	ctx, span := tracer.Start(ctx, "scenario "+sc.Name, trace.WithAttributes(
+		append([]attribute.KeyValue{
+			attribute.String("traffic_gen.scenario", sc.Name),
+			attribute.String("traffic_gen.run_id", runID),
+		}, sc.attrs...)...,
+	))
+	defer span.End()
+
+	status, err := doRequest(ctx, client, sc, seq, runID)
+	if status != 0 {
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
+
+// doRequest sends the request and returns the response status, or 0 if
+// there was no response.
+func doRequest(ctx context.Context, client *http.Client, sc *scenario, seq int, runID string) (int, error) {
+	var body io.Reader
+	if sc.body != "" {
+		body = strings.NewReader(render(sc.body, seq, runID))
 	}
 
 	// Create HTTP request with context
-	req, err := http.NewRequestWithContext(
-		ctx,
-		"POST",
-		"http://localhost:8080/v1/greeter/hello",
-		bytes.NewBuffer(jsonData),
-	)
+	req, err := http.NewRequestWithContext(ctx, sc.Method, render(sc.url, seq, runID), body)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	for k, v := range sc.Headers {
+		req.Header.Set(k, v)
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	// Send request
+	// Send request (automatically instrumented by go-agent)
 	resp, err := client.Do(req)
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		return 0, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+	// Read the whole response, so the latency includes the body
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return fmt.Errorf("failed to read response: %w", err)
+		return resp.StatusCode, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if !sc.expected(resp.StatusCode) {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d: %.200s", resp.StatusCode, respBody)
 	}
+	return resp.StatusCode, nil
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
 
-	// Parse response
-	var reply HelloReply
-	if err := json.Unmarshal(body, &reply); err != nil {
-		return fmt.Errorf("failed to unmarshal response: %w", err)
+func getEnvFloat(key string, fallback float64) float64 {
+	if v, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		return v
 	}
+	return fallback
+}
 
-	// Log success
-	log.Printf("  ✓ [%d/%d] %s → %s", reqNum, total, name, reply.Message)
+func getEnvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
 
-	return nil
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
 }
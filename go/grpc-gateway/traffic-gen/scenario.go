@@ -0,0 +1,231 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"gopkg.in/yaml.v3"
+)
+
+// scenarioFile is the format of a -scenarios file. JSON is valid YAML, so
+// the same parser reads both.
+type scenarioFile struct {
+	// BaseURL is prepended to the path of scenarios that set no base URL of
+	// their own.
+	BaseURL   string     `yaml:"base_url"`
+	Scenarios []scenario `yaml:"scenarios"`
+}
+
+// scenario is one kind of request in the traffic mix.
+type scenario struct {
+	Name string `yaml:"name"`
+	// Weight is the scenario's share of the traffic relative to the others.
+	// Zero disables it; unset means 1.
+	Weight  *int              `yaml:"weight"`
+	BaseURL string            `yaml:"base_url"`
+	Method  string            `yaml:"method"`
+	Path    string            `yaml:"path"`
+	Headers map[string]string `yaml:"headers"`
+	// Body is sent as is when it is a string, and as JSON otherwise.
+	Body any `yaml:"body"`
+	// ExpectStatus lists the statuses that count as expected. Unset means
+	// any 2xx.
+	ExpectStatus []int `yaml:"expect_status"`
+	// Attributes are set on the scenario span of every request.
+	Attributes map[string]any `yaml:"attributes"`
+
+	url    string
+	body   string
+	weight int
+	attrs  []attribute.KeyValue
+}
+
+// defaultScenarios is the traffic without a scenario file: greetings sent to
+// url, badPercent of them with an empty name, which the server rejects.
+func defaultScenarios(url string, badPercent float64) []scenario {
+	// Weights in hundredths of a percent, so fractional percentages work
+	good, bad := int((100-badPercent)*100), int(badPercent*100)
+	return []scenario{
+		{
+			Name:   "say-hello",
+			Method: http.MethodPost,
+			url:    url,
+			body:   `{"name":"{{name}}"}`,
+			weight: good,
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+		},
+		{
+			Name:         "say-hello-empty-name",
+			Method:       http.MethodPost,
+			url:          url,
+			body:         `{"name":""}`,
+			weight:       bad,
+			ExpectStatus: []int{http.StatusBadRequest},
+			Headers: map[string]string{
+				"Content-Type": "application/json",
+			},
+		},
+	}
+}
+
+// loadScenarios reads and checks a scenario file.
+func loadScenarios(path string) ([]scenario, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f scenarioFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	if len(f.Scenarios) == 0 {
+		return nil, fmt.Errorf("%s has no scenarios", path)
+	}
+
+	seen := make(map[string]bool)
+	total := 0
+	for i := range f.Scenarios {
+		sc := &f.Scenarios[i]
+		if err := sc.resolve(f.BaseURL); err != nil {
+			return nil, fmt.Errorf("scenario %d (%q): %w", i+1, sc.Name, err)
+		}
+		if seen[sc.Name] {
+			return nil, fmt.Errorf("scenario %q is defined twice", sc.Name)
+		}
+		seen[sc.Name] = true
+		total += sc.weight
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("%s: every scenario has weight 0", path)
+	}
+	return f.Scenarios, nil
+}
+
+// resolve checks the scenario and fills in its defaults, URL, body and span
+// attributes.
+func (sc *scenario) resolve(baseURL string) error {
+	if sc.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	sc.weight = 1
+	if sc.Weight != nil {
+		sc.weight = *sc.Weight
+	}
+	if sc.weight < 0 {
+		return fmt.Errorf("weight must not be negative, got %d", sc.weight)
+	}
+	if sc.Method == "" {
+		sc.Method = http.MethodGet
+	}
+	sc.Method = strings.ToUpper(sc.Method)
+
+	if sc.BaseURL != "" {
+		baseURL = sc.BaseURL
+	}
+	sc.url = strings.TrimSuffix(baseURL, "/") + sc.Path
+	u, err := url.Parse(sc.url)
+	if err != nil {
+		return err
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("URL %q is not absolute; set base_url", sc.url)
+	}
+
+	switch b := sc.Body.(type) {
+	case nil:
+	case string:
+		sc.body = b
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			return fmt.Errorf("body: %w", err)
+		}
+		sc.body = string(data)
+		if _, ok := sc.Headers["Content-Type"]; !ok {
+			if sc.Headers == nil {
+				sc.Headers = make(map[string]string)
+			}
+			sc.Headers["Content-Type"] = "application/json"
+		}
+	}
+
+	for k, v := range sc.Attributes {
+		switch v := v.(type) {
+		case string:
+			sc.attrs = append(sc.attrs, attribute.String(k, v))
+		case int:
+			sc.attrs = append(sc.attrs, attribute.Int(k, v))
+		case float64:
+			sc.attrs = append(sc.attrs, attribute.Float64(k, v))
+		case bool:
+			sc.attrs = append(sc.attrs, attribute.Bool(k, v))
+		default:
+			return fmt.Errorf("attribute %q: unsupported value %v", k, v)
+		}
+	}
+	return nil
+}
+
+// expected reports whether status is what the scenario expects.
+func (sc *scenario) expected(status int) bool {
+	if len(sc.ExpectStatus) == 0 {
+		return status >= 200 && status < 300
+	}
+	for _, s := range sc.ExpectStatus {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// render fills in the placeholders of a path or body: {{name}} is a random
+// name, {{seq}} the request's sequence number and {{run}} the run ID, so
+// {{run}}-{{seq}} is unique across runs.
+func render(s string, seq int, runID string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	return strings.NewReplacer(
+		"{{name}}", names[rand.Intn(len(names))],
+		"{{seq}}", strconv.Itoa(seq),
+		"{{run}}", runID,
+	).Replace(s)
+}
+
+// picker picks scenarios at random in proportion to their weights.
+type picker struct {
+	scenarios []scenario
+	// cumulative[i] is the total weight of scenarios[:i+1].
+	cumulative []int
+}
+
+func newPicker(scenarios []scenario) *picker {
+	p := &picker{scenarios: scenarios}
+	total := 0
+	for _, sc := range scenarios {
+		total += sc.weight
+		p.cumulative = append(p.cumulative, total)
+	}
+	return p
+}
+
+// pick returns the index of a random scenario.
+func (p *picker) pick() int {
+	n := rand.Intn(p.cumulative[len(p.cumulative)-1])
+	for i, c := range p.cumulative {
+		if n < c {
+			return i
+		}
+	}
+	return len(p.cumulative) - 1
+}
@@ -4,11 +4,14 @@ import (
 	"context"
 	"log"
 	"os"
+	"strconv"
 	"time"
 
 	agent "github.com/last9/go-agent"
 	grpcagent "github.com/last9/go-agent/instrumentation/grpc"
+	"grpc-example/healthprobe"
 	pb "grpc-example/proto"
+	"grpc-example/retrytrace"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -21,10 +24,16 @@ func main() {
 
 	log.Println("✓ go-agent initialized")
 
-	// Connect to gRPC server with go-agent (automatic client instrumentation)
+	// Connect to gRPC server with go-agent (automatic client instrumentation).
+	// The service config retries UNAVAILABLE; retrytrace adds a span per call
+	// and one per attempt. Its stats handler goes before go-agent's so each
+	// otelgrpc client span is a child of its attempt span
 	conn, err := grpc.NewClient(
 		"localhost:" + func() string { if p := os.Getenv("GRPC_PORT"); p != "" { return p }; return "50051" }(),
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(retrytrace.ServiceConfig),
+		grpc.WithUnaryInterceptor(retrytrace.UnaryClientInterceptor()),
+		grpc.WithStatsHandler(retrytrace.NewStatsHandler()),
 		grpcagent.NewClientDialOption(), // Automatic OTel client tracing
 	)
 	if err != nil {
@@ -34,15 +43,72 @@ func main() {
 
 	c := pb.NewGreeterClient(conn)
 
+	// Watch the server's health while the greetings run, on a connection of
+	// its own whose probe spans are sampled separately
+	if d, err := time.ParseDuration(os.Getenv("GRPC_HEALTH_WATCH")); err == nil && d > 0 {
+		stop := watchHealth(conn.Target(), d)
+		defer stop()
+	}
+
 	name := "World"
 	if len(os.Args) > 1 {
 		name = os.Args[1]
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-	r, err := c.SayHello(ctx, &pb.HelloRequest{Name: name})
+	requests := 1
+	if n, err := strconv.Atoi(os.Getenv("GRPC_CLIENT_REQUESTS")); err == nil && n > 0 {
+		requests = n
+	}
+
+	for i := 0; i < requests; i++ {
+		// The deadline covers all attempts and the backoff between them
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		r, err := c.SayHello(ctx, &pb.HelloRequest{Name: name})
+		cancel()
+		if err != nil {
+			if requests == 1 {
+				log.Fatalf("could not greet: %v", err)
+			}
+			log.Printf("✗ could not greet: %v", err)
+			continue
+		}
+		log.Printf("✓ Greeting: %s", r.GetMessage())
+	}
+}
+
+// watchHealth runs a health watcher for duration, probing every
+// GRPC_HEALTH_PROBE_INTERVAL. The returned func waits for it to finish.
+func watchHealth(target string, duration time.Duration) func() {
+	ctx, cancel := context.WithTimeout(context.Background(), duration)
+
+	ratio := healthprobe.RatioFromEnv()
+	tp, err := healthprobe.NewTracerProvider(ctx, ratio)
+	if err != nil {
+		log.Fatalf("health tracer provider: %v", err)
+	}
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		healthprobe.DialOption(tp),
+	)
 	if err != nil {
-		log.Fatalf("could not greet: %v", err)
+		log.Fatalf("did not connect for health: %v", err)
+	}
+
+	interval := 5 * time.Second
+	if d, err := time.ParseDuration(os.Getenv("GRPC_HEALTH_PROBE_INTERVAL")); err == nil && d > 0 {
+		interval = d
+	}
+	log.Printf("✓ watching health of %s for %s (probes every %s, %.0f%% traced)",
+		pb.Greeter_ServiceDesc.ServiceName, duration, interval, ratio*100)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		healthprobe.NewWatcher(conn, pb.Greeter_ServiceDesc.ServiceName, interval, tp).Run(ctx)
+	}()
+	return func() {
+		<-done
+		cancel()
+		conn.Close()
+		_ = tp.Shutdown(context.Background())
 	}
-	log.Printf("✓ Greeting: %s", r.GetMessage())
 }
@@ -0,0 +1,213 @@
+// Package healthprobe watches a gRPC server's health and traces the probes
+// at a lower sampling rate than the rest of the client.
+//
+// Health checks run every few seconds for as long as the client does, so at
+// the sampling rate of real traffic they would flood the trace view. Probes
+// are traced with their own TracerProvider, whose sampler keeps only a
+// fraction of them:
+//
+//	tp, err := healthprobe.NewTracerProvider(ctx, healthprobe.RatioFromEnv())
+//	conn, err := grpc.NewClient(target, healthprobe.DialOption(tp), ...)
+//	w := healthprobe.NewWatcher(conn, "greeter.Greeter", 5*time.Second, tp)
+//	w.Run(ctx)
+//
+// Status changes, which are rare and worth seeing, come from the Watch stream
+// and are traced with the global TracerProvider.
+package healthprobe
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	scopeName    = "grpc-example/healthprobe"
+	defaultRatio = 0.1
+	checkMethod  = "/grpc.health.v1.Health/Check"
+	probeTimeout = time.Second
+)
+
+// RatioFromEnv returns GRPC_HEALTH_SAMPLE_RATIO, the fraction of probes to
+// trace, or 0.1.
+func RatioFromEnv() float64 {
+	ratio, err := strconv.ParseFloat(os.Getenv("GRPC_HEALTH_SAMPLE_RATIO"), 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return defaultRatio
+	}
+	return ratio
+}
+
+// NewTracerProvider returns the TracerProvider for probe spans. It exports
+// to the same OTLP endpoint as go-agent, configured by the same environment
+// variables, and samples ratio of probe traces.
+//
+// The sampler is parent-based so the probe's client span follows the probe
+// span's decision.
+func NewTracerProvider(ctx context.Context, ratio float64) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx, resource.WithFromEnv(), resource.WithTelemetrySDK())
+	if err != nil {
+		return nil, err
+	}
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+	), nil
+}
+
+// DialOption instruments the health connection with tp. Only Check calls are
+// traced: a Watch stream lasts as long as the connection, and its updates
+// are traced by the Watcher.
+func DialOption(tp trace.TracerProvider) grpc.DialOption {
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler(
+		otelgrpc.WithTracerProvider(tp),
+		otelgrpc.WithPropagators(otel.GetTextMapPropagator()),
+		otelgrpc.WithFilter(func(info *stats.RPCTagInfo) bool {
+			return info.FullMethodName == checkMethod
+		}),
+	))
+}
+
+// Watcher probes one service's health on an interval and follows its status
+// changes.
+type Watcher struct {
+	client   healthpb.HealthClient
+	service  string
+	interval time.Duration
+	// probeTracer comes from the probe TracerProvider, changeTracer from the
+	// global one.
+	probeTracer  trace.Tracer
+	changeTracer trace.Tracer
+}
+
+// NewWatcher returns a Watcher for service on conn. An empty service is the
+// server as a whole. Probe spans are traced with tp.
+func NewWatcher(conn *grpc.ClientConn, service string, interval time.Duration, tp trace.TracerProvider) *Watcher {
+	return &Watcher{
+		client:       healthpb.NewHealthClient(conn),
+		service:      service,
+		interval:     interval,
+		probeTracer:  tp.Tracer(scopeName),
+		changeTracer: otel.Tracer(scopeName),
+	}
+}
+
+// Run probes and watches until ctx is done.
+func (w *Watcher) Run(ctx context.Context) {
+	go w.watch(ctx)
+
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		w.probe(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe makes one Check call under a "health probe" span. Each probe is a
+// trace of its own, so the sampler decides per probe.
+func (w *Watcher) probe(ctx context.Context) {
+	ctx, span := w.probeTracer.Start(ctx, "health probe",
+		trace.WithNewRoot(),
+		trace.WithAttributes(attribute.String("rpc.grpc.health.service", w.service)))
+	defer span.End()
+
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	start := time.Now()
+	resp, err := w.client.Check(probeCtx, &healthpb.HealthCheckRequest{Service: w.service})
+	span.SetAttributes(attribute.Float64("rpc.grpc.health.latency", time.Since(start).Seconds()))
+	if err != nil && ctx.Err() != nil {
+		// The watcher stopped, not the server
+		span.SetAttributes(attribute.Bool("rpc.grpc.health.canceled", true))
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+		log.Printf("✗ health probe failed: %v", err)
+		return
+	}
+	span.SetAttributes(attribute.String("rpc.grpc.health.status", resp.GetStatus().String()))
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		span.SetStatus(otelcodes.Error, "not serving")
+	}
+}
+
+// watch follows the Watch stream, reopening it when it breaks, and records a
+// span for every status change.
+func (w *Watcher) watch(ctx context.Context) {
+	previous := healthpb.HealthCheckResponse_UNKNOWN
+	for ctx.Err() == nil {
+		stream, err := w.client.Watch(ctx, &healthpb.HealthCheckRequest{Service: w.service})
+		if err == nil {
+			for {
+				var resp *healthpb.HealthCheckResponse
+				resp, err = stream.Recv()
+				if err != nil {
+					break
+				}
+				if resp.GetStatus() != previous {
+					w.recordChange(ctx, previous, resp.GetStatus())
+					previous = resp.GetStatus()
+				}
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if status.Code(err) == codes.Unimplemented {
+			log.Printf("server does not implement health Watch")
+			return
+		}
+		if err != io.EOF {
+			log.Printf("health watch broken, reopening: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+func (w *Watcher) recordChange(ctx context.Context, from, to healthpb.HealthCheckResponse_ServingStatus) {
+	_, span := w.changeTracer.Start(ctx, "health status change",
+		trace.WithNewRoot(),
+		trace.WithAttributes(
+			attribute.String("rpc.grpc.health.service", w.service),
+			attribute.String("rpc.grpc.health.previous_status", from.String()),
+			attribute.String("rpc.grpc.health.status", to.String()),
+		))
+	if to != healthpb.HealthCheckResponse_SERVING {
+		span.SetStatus(otelcodes.Error, "not serving")
+	}
+	span.End()
+	log.Printf("health of %q: %s → %s", w.service, from, to)
+}
@@ -0,0 +1,209 @@
+// Package retrytrace shows gRPC client retries in traces.
+//
+// Retries configured in the service config happen inside grpc-go, below the
+// interceptors: an interceptor sees one call however many attempts it took.
+// Stats handlers are called once per attempt, so this package pairs the two:
+//
+//	conn, err := grpc.NewClient(target,
+//	    grpc.WithDefaultServiceConfig(retrytrace.ServiceConfig),
+//	    grpc.WithUnaryInterceptor(retrytrace.UnaryClientInterceptor()),
+//	    grpc.WithStatsHandler(retrytrace.NewStatsHandler()), // before otelgrpc
+//	    grpcagent.NewClientDialOption(),
+//	)
+//
+// The interceptor starts a span for the whole call, and the stats handler
+// starts a child span per attempt. Registered before otelgrpc, the attempt
+// span is the parent of that attempt's otelgrpc client span:
+//
+//	call greeter.Greeter/SayHello          rpc.retry.attempts=3 rpc.retry.outcome=succeeded_after_retry
+//	  ├─ attempt                           rpc.attempt.number=1 rpc.attempt.status_code=14
+//	  │   └─ greeter.Greeter/SayHello      (otelgrpc client)
+//	  ├─ attempt                           rpc.attempt.number=2 rpc.attempt.backoff=0.08
+//	  └─ attempt                           rpc.attempt.number=3 rpc.attempt.status_code=0
+package retrytrace
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+const scopeName = "grpc-example/retrytrace"
+
+// ServiceConfig retries SayHello up to 4 attempts on UNAVAILABLE, with
+// exponential backoff from 100ms to 1s. grpc-go picks each backoff at random
+// between 0 and the current maximum.
+const ServiceConfig = `{
+  "methodConfig": [{
+    "name": [{"service": "greeter.Greeter", "method": "SayHello"}],
+    "retryPolicy": {
+      "maxAttempts": 4,
+      "initialBackoff": "0.1s",
+      "maxBackoff": "1s",
+      "backoffMultiplier": 2,
+      "retryableStatusCodes": ["UNAVAILABLE"]
+    }
+  }]
+}`
+
+// MaxAttempts is the maxAttempts of ServiceConfig.
+const MaxAttempts = 4
+
+// Why a call ended, on the call span as rpc.retry.outcome.
+const (
+	OutcomeSucceeded           = "succeeded"
+	OutcomeSucceededAfterRetry = "succeeded_after_retry"
+	OutcomeRetriesExhausted    = "retries_exhausted"
+	OutcomeNonRetryable        = "non_retryable"
+)
+
+// retryable lists the retryableStatusCodes of ServiceConfig.
+var retryable = map[codes.Code]bool{codes.Unavailable: true}
+
+// callState is shared by the call span and its attempt spans.
+type callState struct {
+	ctx context.Context
+
+	mu         sync.Mutex
+	attempts   int
+	lastEnd    time.Time
+	lastStatus codes.Code
+}
+
+type callStateKey struct{}
+
+// UnaryClientInterceptor returns an interceptor that starts a span for the
+// whole call and records how many attempts it took and how it ended.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	tracer := otel.Tracer(scopeName)
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, span := tracer.Start(ctx, "call "+method[1:],
+			trace.WithAttributes(attribute.String("rpc.method", method)))
+		defer span.End()
+
+		state := &callState{ctx: ctx}
+		err := invoker(context.WithValue(ctx, callStateKey{}, state), method, req, reply, cc, opts...)
+
+		state.mu.Lock()
+		attempts := state.attempts
+		state.mu.Unlock()
+
+		code := status.Code(err)
+		var outcome string
+		switch {
+		case err == nil && attempts > 1:
+			outcome = OutcomeSucceededAfterRetry
+		case err == nil:
+			outcome = OutcomeSucceeded
+		case retryable[code] && attempts >= MaxAttempts:
+			outcome = OutcomeRetriesExhausted
+		default:
+			outcome = OutcomeNonRetryable
+		}
+		span.SetAttributes(
+			attribute.Int("rpc.retry.attempts", attempts),
+			attribute.String("rpc.retry.outcome", outcome),
+			attribute.Int("rpc.grpc.status_code", int(code)),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(otelcodes.Error, status.Convert(err).Message())
+		}
+		return err
+	}
+}
+
+// statsHandler starts a span per attempt of calls made through
+// UnaryClientInterceptor.
+type statsHandler struct {
+	tracer trace.Tracer
+}
+
+// NewStatsHandler returns the per-attempt stats handler. Register it before
+// any other stats handler whose spans should be children of the attempt.
+func NewStatsHandler() stats.Handler {
+	return &statsHandler{tracer: otel.Tracer(scopeName)}
+}
+
+type attemptKey struct{}
+
+// attempt is the per-attempt state kept in the attempt's context.
+type attempt struct {
+	call *callState
+	span trace.Span
+}
+
+// TagRPC is called at the start of every attempt.
+func (h *statsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	state, ok := ctx.Value(callStateKey{}).(*callState)
+	if !ok {
+		return ctx
+	}
+
+	state.mu.Lock()
+	state.attempts++
+	n := state.attempts
+	attrs := []attribute.KeyValue{
+		attribute.String("rpc.method", info.FullMethodName),
+		attribute.Int("rpc.attempt.number", n),
+	}
+	if n > 1 {
+		// Time from the end of the previous attempt to the start of this one
+		attrs = append(attrs,
+			attribute.Float64("rpc.attempt.backoff", time.Since(state.lastEnd).Seconds()),
+			attribute.Int("rpc.attempt.previous_status_code", int(state.lastStatus)),
+		)
+	}
+	state.mu.Unlock()
+
+	// Parent on the call span: ctx may already hold the previous attempt's
+	// span if grpc-go derived this attempt's context from it
+	_, span := h.tracer.Start(state.ctx, "attempt", trace.WithAttributes(attrs...))
+	ctx = trace.ContextWithSpan(ctx, span)
+	return context.WithValue(ctx, attemptKey{}, &attempt{call: state, span: span})
+}
+
+// HandleRPC ends the attempt span when the attempt ends.
+func (h *statsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	a, ok := ctx.Value(attemptKey{}).(*attempt)
+	if !ok {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		a.span.SetAttributes(attribute.Bool("rpc.attempt.transparent_retry", s.IsTransparentRetryAttempt))
+	case *stats.End:
+		code := status.Code(s.Error)
+		a.span.SetAttributes(
+			attribute.Int("rpc.attempt.status_code", int(code)),
+			attribute.Bool("rpc.attempt.retryable", retryable[code]),
+		)
+		if s.Error != nil {
+			a.span.RecordError(s.Error)
+			a.span.SetStatus(otelcodes.Error, status.Convert(s.Error).Message())
+		}
+		a.span.End(trace.WithTimestamp(s.EndTime))
+
+		a.call.mu.Lock()
+		a.call.lastEnd = s.EndTime
+		a.call.lastStatus = code
+		a.call.mu.Unlock()
+	}
+}
+
+// TagConn and HandleConn are part of stats.Handler; connections are not
+// traced.
+func (h *statsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *statsHandler) HandleConn(context.Context, stats.ConnStats) {}
@@ -3,19 +3,45 @@ package main
 import (
 	"context"
 	"log"
+	"math/rand"
 	"net"
 	"os"
+	"strconv"
+	"time"
 
 	agent "github.com/last9/go-agent"
 	grpcagent "github.com/last9/go-agent/instrumentation/grpc"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	pb "grpc-example/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
 )
 
 type server struct {
 	pb.UnimplementedGreeterServer
+	// failRate is the fraction of calls that fail with UNAVAILABLE, so the
+	// client retries them
+	failRate float64
 }
 
 func (s *server) SayHello(ctx context.Context, in *pb.HelloRequest) (*pb.HelloReply, error) {
+	// grpc-go sets grpc-previous-rpc-attempts on retried attempts
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get("grpc-previous-rpc-attempts"); len(v) > 0 {
+			if n, err := strconv.Atoi(v[0]); err == nil {
+				trace.SpanFromContext(ctx).SetAttributes(attribute.Int("rpc.grpc.previous_rpc_attempts", n))
+			}
+		}
+	}
+	if rand.Float64() < s.failRate {
+		return nil, status.Error(codes.Unavailable, "simulated overload")
+	}
 	return &pb.HelloReply{Message: "Hello " + in.Name}, nil
 }
 
@@ -38,9 +64,37 @@ func main() {
 	// Create gRPC server with go-agent (automatic instrumentation)
 	s := grpcagent.NewServer()
 
-	pb.RegisterGreeterServer(s, &server{})
+	failRate, _ := strconv.ParseFloat(os.Getenv("GRPC_FAIL_RATE"), 64)
+	pb.RegisterGreeterServer(s, &server{failRate: failRate})
+
+	// Health checking (grpc.health.v1) and reflection, for grpcurl and
+	// grpc_health_probe
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthServer.SetServingStatus(pb.Greeter_ServiceDesc.ServiceName, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(s, healthServer)
+	reflection.Register(s)
+	if d, err := time.ParseDuration(os.Getenv("GRPC_HEALTH_FLAP_INTERVAL")); err == nil && d > 0 {
+		go flapHealth(healthServer, d)
+	}
+
 	log.Printf("✓ gRPC server listening at %v (instrumented by go-agent)", lis.Addr())
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+// flapHealth toggles the greeter's health between SERVING and NOT_SERVING
+// every interval, so health watchers see status changes.
+func flapHealth(healthServer *health.Server, interval time.Duration) {
+	serving := true
+	for range time.Tick(interval) {
+		serving = !serving
+		st := healthpb.HealthCheckResponse_NOT_SERVING
+		if serving {
+			st = healthpb.HealthCheckResponse_SERVING
+		}
+		healthServer.SetServingStatus(pb.Greeter_ServiceDesc.ServiceName, st)
+		log.Printf("health of %s set to %s", pb.Greeter_ServiceDesc.ServiceName, st)
+	}
+}
@@ -1,16 +1,24 @@
 package last9
 
 import (
+	"context"
 	"fmt"
-	"regexp"
-	"strings"
+	"runtime/debug"
+	"strconv"
+	"time"
 
 	"github.com/kataras/iris/v12"
+	"github.com/last9/opentelemetry-examples/go/common/pathnorm"
+	"github.com/last9/opentelemetry-examples/go/common/recovery"
+	"github.com/last9/opentelemetry-examples/go/common/spanname"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	// The metrics use the stable HTTP names
+	metricconv "go.opentelemetry.io/otel/semconv/v1.26.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
@@ -21,6 +29,7 @@ const (
 
 type Config struct {
 	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
 	Propagators    propagation.TextMapPropagator
 	Filters        []Filter
 }
@@ -29,6 +38,23 @@ type Filter func(iris.Context) bool
 
 type Option func(*Config)
 
+// OtelMiddleware returns middleware that traces incoming requests, and counts
+// them and records their duration. The service parameter should describe the
+// name of the (virtual) server handling the request.
+//
+// A panic in a handler is recovered by the shared recovery package: the span
+// gets an exception event with the stack trace and status Error, the panic is
+// counted in panics_total, and the client gets a 500. Iris's own recover
+// middleware isn't needed.
+//
+// Spans and metrics use the route the request matched, such as /users/{id}.
+// Registered with app.Use, the middleware runs on the matched route, so the
+// route is known when the span starts. Registered with app.UseRouter, it runs
+// before routing: the span is started with the path normalized by pathnorm,
+// and renamed once the router has matched. Requests that matched no route
+// keep the normalized name, and their metrics have no http.route.
+//
+// Handlers get the span from ctx.Request().Context().
 func OtelMiddleware(service string, opts ...Option) iris.Handler {
 	cfg := Config{}
 	for _, opt := range opts {
@@ -42,9 +68,16 @@ func OtelMiddleware(service string, opts ...Option) iris.Handler {
 		ScopeName,
 		trace.WithInstrumentationVersion(SemVersion()),
 	)
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	metrics := newServerMetrics(cfg.MeterProvider)
+	panics := recovery.New(cfg.MeterProvider)
 	if cfg.Propagators == nil {
 		cfg.Propagators = otel.GetTextMapPropagator()
 	}
+	// Spans are named by HTTP_SPAN_NAME_STRATEGY, "GET /users/{id}" by default
+	namer := spanname.FromEnv()
 
 	return func(ctx iris.Context) {
 		for _, f := range cfg.Filters {
@@ -54,32 +87,172 @@ func OtelMiddleware(service string, opts ...Option) iris.Handler {
 			}
 		}
 
+		begin := time.Now()
 		ctx.Values().Set(TracerKey, tracer)
 		carrier := irisCarrier{ctx: ctx}
 		propagatedCtx := cfg.Propagators.Extract(ctx.Request().Context(), carrier)
-		route := ctx.Path()
+		method := ctx.Method()
+		path := ctx.Path()
 		opts := []trace.SpanStartOption{
 			trace.WithAttributes(httpServerAttributes(service, ctx)...),
 			trace.WithSpanKind(trace.SpanKindServer),
 		}
-		spanName := normalizePath(route)
-		if spanName == "" {
-			spanName = fmt.Sprintf("HTTP %s route not found", ctx.Method())
+		normalized := pathnorm.Normalize(path)
+		legacy := normalized
+		if legacy == "" {
+			legacy = fmt.Sprintf("HTTP %s route not found", method)
+		}
+		// Without a matched route yet, the normalized path stands in for it
+		route, matched := matchedRoute(ctx)
+		template := normalized
+		if matched {
+			template = route
 		}
+		spanName, nameAttrs := namer.Name(spanname.Request{
+			Method: method,
+			Route:  template,
+			Target: path,
+			Legacy: legacy,
+		})
+		opts = append(opts, trace.WithAttributes(nameAttrs...))
 		spanCtx, span := tracer.Start(propagatedCtx, spanName, opts...)
 		defer span.End()
 
-		// Inject the span context back into the request headers
+		// Inject the span context back into the request headers, and hand it
+		// to the handlers through the request context
 		cfg.Propagators.Inject(spanCtx, carrier)
+		ctx.ResetRequest(ctx.Request().WithContext(spanCtx))
 
-		// Call the next handler
-		ctx.Next()
+		// Call the next handler. A panic is answered with a 500 and recorded
+		// on the span
+		errType := serve(ctx, spanCtx, panics, method)
 
 		status := ctx.GetStatusCode()
-		span.SetStatus(httpStatusCodeToSpanStatus(status))
-		if status > 0 {
-			span.SetAttributes(semconv.HTTPStatusCode(status))
+		if errType == "" && status >= iris.StatusInternalServerError {
+			errType = strconv.Itoa(status)
+		}
+		// Run before routing, the middleware only learns the route now
+		matchedBefore := matched
+		route, matched = matchedRoute(ctx)
+		// Formatting the status description and boxing the attribute allocate,
+		// so skip them for spans the sampler dropped
+		if span.IsRecording() {
+			if matched {
+				if !matchedBefore {
+					spanName, nameAttrs = namer.Name(spanname.Request{
+						Method: method,
+						Route:  route,
+						Target: path,
+						Legacy: legacy,
+					})
+					span.SetName(spanName)
+					span.SetAttributes(nameAttrs...)
+				}
+				span.SetAttributes(semconv.HTTPRoute(route))
+			}
+			span.SetStatus(httpStatusCodeToSpanStatus(status))
+			if status > 0 {
+				span.SetAttributes(semconv.HTTPStatusCode(status))
+			}
+			if errType != "" {
+				span.SetAttributes(metricconv.ErrorTypeKey.String(errType))
+			}
+		}
+
+		attrs := []attribute.KeyValue{
+			metricconv.HTTPRequestMethodKey.String(method),
+			metricconv.HTTPResponseStatusCode(status),
+			metricconv.URLScheme(scheme(ctx)),
+		}
+		// Unmatched paths, such as scanners probing for files, would make a
+		// series each, so they get no route
+		if matched {
+			attrs = append(attrs, metricconv.HTTPRoute(route))
+		}
+		if errType != "" {
+			attrs = append(attrs, metricconv.ErrorTypeKey.String(errType))
+		}
+		metrics.record(spanCtx, time.Since(begin), metric.WithAttributes(attrs...))
+	}
+}
+
+// serve calls the next handlers, and recovers a panic in them. The panic is
+// recorded by rec on the span in spanCtx as an exception event, with the
+// stack of the handler that panicked, and counted in panics_total; the
+// client gets a 500. serve returns the panic's exception type, for
+// error.type, or "" if the handlers returned normally.
+func serve(ctx iris.Context, spanCtx context.Context, rec *recovery.Recorder, method string) (errType string) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
 		}
+		// The stack has to be taken here, while the handler's frames are
+		// still on it
+		stack := debug.Stack()
+		attrs := []attribute.KeyValue{metricconv.HTTPRequestMethodKey.String(method)}
+		if route, ok := matchedRoute(ctx); ok {
+			attrs = append(attrs, metricconv.HTTPRoute(route))
+		}
+		errType = rec.Record(spanCtx, r, stack, attrs...)
+		ctx.StopWithStatus(iris.StatusInternalServerError)
+	}()
+	ctx.Next()
+	return ""
+}
+
+// matchedRoute returns the template of the route the request matched, such
+// as /users/{id}. Iris sets the route when the router matches, so it isn't
+// known yet to a middleware registered with UseRouter.
+func matchedRoute(ctx iris.Context) (string, bool) {
+	r := ctx.GetCurrentRoute()
+	if r == nil || r.Path() == "" {
+		return "", false
+	}
+	return r.Path(), true
+}
+
+// scheme returns the scheme the request was served over. URL.Scheme is empty
+// for server requests.
+func scheme(ctx iris.Context) string {
+	if ctx.Request().TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// serverMetrics are the metrics OtelMiddleware records for each request. An
+// instrument that fails to be created is nil and not recorded.
+type serverMetrics struct {
+	requests metric.Int64Counter
+	duration metric.Float64Histogram
+}
+
+func newServerMetrics(mp metric.MeterProvider) *serverMetrics {
+	meter := mp.Meter(ScopeName, metric.WithInstrumentationVersion(SemVersion()))
+	m := &serverMetrics{}
+	var err error
+	// The count of the duration histogram is the number of requests too;
+	// the counter is for backends and dashboards that graph counters
+	if m.requests, err = meter.Int64Counter("http.server.requests",
+		metric.WithDescription("Number of HTTP server requests"),
+		metric.WithUnit("{request}")); err != nil {
+		otel.Handle(err)
+	}
+	if m.duration, err = meter.Float64Histogram("http.server.request.duration",
+		metric.WithDescription("Duration of HTTP server requests"),
+		metric.WithUnit("s")); err != nil {
+		otel.Handle(err)
+	}
+	return m
+}
+
+func (m *serverMetrics) record(ctx context.Context, elapsed time.Duration, attrs metric.MeasurementOption) {
+	if m.requests != nil {
+		m.requests.Add(ctx, 1, attrs)
+	}
+	if m.duration != nil {
+		m.duration.Record(ctx, elapsed.Seconds(), attrs)
 	}
 }
 
@@ -147,6 +320,12 @@ func WithTracerProvider(provider trace.TracerProvider) Option {
 	}
 }
 
+func WithMeterProvider(provider metric.MeterProvider) Option {
+	return func(cfg *Config) {
+		cfg.MeterProvider = provider
+	}
+}
+
 func WithPropagators(propagators propagation.TextMapPropagator) Option {
 	return func(cfg *Config) {
 		cfg.Propagators = propagators
@@ -162,27 +341,3 @@ func WithFilter(f Filter) Option {
 func SemVersion() string {
 	return "0.0.1"
 }
-
-func normalizePath(path string) string {
-	uuidRegex := regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
-	path = uuidRegex.ReplaceAllString(path, ":uuid")
-
-	numericIDRegex := regexp.MustCompile(`/\d+(/|$)`)
-	path = numericIDRegex.ReplaceAllString(path, "/:id$1")
-
-	dateRegex := regexp.MustCompile(`/\d{4}-\d{2}-\d{2}(/|$)`)
-	path = dateRegex.ReplaceAllString(path, "/:date$1")
-
-	timestampRegex := regexp.MustCompile(`/\d{10,13}(/|$)`)
-	path = timestampRegex.ReplaceAllString(path, "/:timestamp$1")
-
-	guidRegex := regexp.MustCompile(`/[0-9a-fA-F]{32}(/|$)`)
-	path = guidRegex.ReplaceAllString(path, "/:guid$1")
-
-	langRegex := regexp.MustCompile(`/[a-z]{2}(-[A-Z]{2})?(/|$)`)
-	path = langRegex.ReplaceAllString(path, "/:lang$1")
-
-	path = strings.TrimSuffix(path, "/")
-
-	return path
-}
@@ -1,129 +1,77 @@
 package users
 
 import (
-	"strconv"
-
 	"github.com/kataras/iris/v12"
-	"go.opentelemetry.io/otel/attribute"
-	oteltrace "go.opentelemetry.io/otel/trace"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
 )
 
+// UsersHandler adapts the shared users service to Iris.
 type UsersHandler struct {
-	controller *UsersController
-	tracer     oteltrace.Tracer
+	service *commonusers.Service
 }
 
-func NewUsersHandler(c *UsersController, t oteltrace.Tracer) *UsersHandler {
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
 	return &UsersHandler{
-		controller: c,
-		tracer:     t,
+		service: s,
 	}
 }
 
 func (u *UsersHandler) GetUsers(ctx iris.Context) {
-	traceCtx, span := u.tracer.Start(ctx.Request().Context(), "GetUsers")
-	defer span.End()
-
-	users, err := u.controller.GetUsers(traceCtx)
+	users, err := u.service.List(ctx.Request().Context())
 	if err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"error": "Failed to fetch users"})
+		writeError(ctx, err)
 		return
 	}
-
 	ctx.JSON(users)
 }
 
 func (u *UsersHandler) GetUser(ctx iris.Context) {
-	id := ctx.Params().Get("id")
-	traceCtx, span := u.tracer.Start(ctx.Request().Context(), "GetUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	user, err := u.controller.GetUser(traceCtx, id)
+	user, err := u.service.Get(ctx.Request().Context(), ctx.Params().Get("id"))
 	if err != nil {
-		ctx.StatusCode(iris.StatusNotFound)
-		ctx.JSON(iris.Map{"message": "User not found"})
+		writeError(ctx, err)
 		return
 	}
 	ctx.JSON(user)
 }
 
 func (u *UsersHandler) CreateUser(ctx iris.Context) {
-	traceCtx, span := u.tracer.Start(ctx.Request().Context(), "CreateUser")
-	defer span.End()
-
-	var newUser User
-	if err := ctx.ReadJSON(&newUser); err != nil {
-		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"error": "Invalid input data"})
+	var in commonusers.CreateInput
+	if err := ctx.ReadJSON(&in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-
-	err := u.controller.CreateUser(traceCtx, &newUser)
+	user, err := u.service.Create(ctx.Request().Context(), in)
 	if err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"error": "Failed to create user"})
+		writeError(ctx, err)
 		return
 	}
-
 	ctx.StatusCode(iris.StatusCreated)
-	ctx.JSON(newUser)
+	ctx.JSON(user)
 }
 
 func (u *UsersHandler) UpdateUser(ctx iris.Context) {
-	id := ctx.Params().Get("id")
-	traceCtx, span := u.tracer.Start(ctx.Request().Context(), "UpdateUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"message": "Invalid ID"})
+	var in commonusers.UpdateInput
+	if err := ctx.ReadJSON(&in); err != nil {
+		writeError(ctx, commonusers.ErrInvalidInput)
 		return
 	}
-
-	var updateData struct {
-		Name string `json:"name"`
-	}
-	if err := ctx.ReadJSON(&updateData); err != nil {
-		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"message": "Invalid input data"})
-		return
-	}
-
-	user := u.controller.UpdateUser(traceCtx, int(idInt), updateData.Name)
-	if user == nil {
-		ctx.StatusCode(iris.StatusNotFound)
-		ctx.JSON(iris.Map{"message": "User not found"})
+	user, err := u.service.Update(ctx.Request().Context(), ctx.Params().Get("id"), in)
+	if err != nil {
+		writeError(ctx, err)
 		return
 	}
-
 	ctx.JSON(user)
 }
 
 func (u *UsersHandler) DeleteUser(ctx iris.Context) {
-	id := ctx.Params().Get("id")
-	traceCtx, span := u.tracer.Start(ctx.Request().Context(), "DeleteUser", oteltrace.WithAttributes(
-		attribute.String("user.id", id),
-	))
-	defer span.End()
-
-	idInt, err := strconv.ParseInt(id, 10, 32)
-	if err != nil {
-		ctx.StatusCode(iris.StatusBadRequest)
-		ctx.JSON(iris.Map{"message": "Invalid ID"})
-		return
-	}
-
-	err = u.controller.DeleteUser(traceCtx, int(idInt))
-	if err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(iris.Map{"error": "Failed to delete user"})
+	if err := u.service.Delete(ctx.Request().Context(), ctx.Params().Get("id")); err != nil {
+		writeError(ctx, err)
 		return
 	}
 	ctx.StatusCode(iris.StatusNoContent)
 }
+
+func writeError(ctx iris.Context, err error) {
+	ctx.StatusCode(commonusers.StatusCode(err))
+	ctx.JSON(commonusers.ErrorBody(err))
+}
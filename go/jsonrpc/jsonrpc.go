@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The error codes the JSON-RPC 2.0 specification reserves. -32000 to -32099
+// are left to the server for its own failures; other codes are the
+// application's.
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+	codeServerErrorMin = -32099
+	codeServerErrorMax = -32000
+)
+
+const (
+	// maxBodyBytes bounds the size of a request body.
+	maxBodyBytes = 1 << 20
+	// maxBatch bounds the calls in a batch, which run concurrently.
+	maxBatch = 100
+	// otherMethod names the span of a call to a method that isn't
+	// registered, so a client can't create a span name per typo.
+	otherMethod = "_OTHER"
+)
+
+// rpcSystem is the rpc.system of JSON-RPC. The semconv package has no
+// constant for it.
+var rpcSystem = semconv.RPCSystemKey.String("jsonrpc")
+
+// rpcError is a JSON-RPC error object. A method returns one for errors the
+// client should see as they are; any other error is answered as an internal
+// error, and only recorded on the span.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+// errorType is the error.type of a code: the name of a reserved code, or the
+// code itself for application errors.
+func errorType(code int) string {
+	switch {
+	case code == codeParseError:
+		return "parse_error"
+	case code == codeInvalidRequest:
+		return "invalid_request"
+	case code == codeMethodNotFound:
+		return "method_not_found"
+	case code == codeInvalidParams:
+		return "invalid_params"
+	case code == codeInternalError:
+		return "internal_error"
+	case code >= codeServerErrorMin && code <= codeServerErrorMax:
+		return "server_error"
+	}
+	return strconv.Itoa(code)
+}
+
+// serverFault reports whether code means the server failed, rather than the
+// client or the request. Only those set the span status to Error, the way a
+// 4xx leaves an HTTP server span's status unset.
+func serverFault(code int) bool {
+	return code == codeInternalError || (code >= codeServerErrorMin && code <= codeServerErrorMax)
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	// ID is nil for a notification, which gets no response, and the JSON
+	// null for a request whose id is null
+	ID json.RawMessage `json:"id,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  any             `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// method handles a call. params is the raw params member, nil if absent.
+type method func(ctx context.Context, params json.RawMessage) (any, error)
+
+// server is a JSON-RPC 2.0 server over HTTP POST. Each call is a server
+// span named after its method, with the rpc.* attributes; the server is
+// the RPC instrumentation, so the HTTP request gets no span of its own.
+type server struct {
+	methods  map[string]method
+	tracer   trace.Tracer
+	duration metric.Float64Histogram
+	prop     propagation.TextMapPropagator
+}
+
+func newServer() (*server, error) {
+	duration, err := otel.Meter(tracerName).Float64Histogram("rpc.server.duration",
+		metric.WithDescription("Measures the duration of inbound RPC."),
+		metric.WithUnit("ms"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &server{
+		methods:  map[string]method{},
+		tracer:   otel.Tracer(tracerName),
+		duration: duration,
+		prop:     otel.GetTextMapPropagator(),
+	}, nil
+}
+
+func (s *server) register(name string, m method) {
+	s.methods[name] = m
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// The caller's trace context is in the HTTP headers, as with any other
+	// HTTP call
+	ctx := s.prop.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	transport := []attribute.KeyValue{
+		semconv.HTTPRequestMethodPost,
+		semconv.URLPath(r.URL.Path),
+		semconv.ClientAddress(clientAddress(r.RemoteAddr)),
+		semconv.UserAgentOriginal(r.UserAgent()),
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "request body too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "failed to read request body", http.StatusBadRequest)
+		return
+	}
+	body = bytes.TrimSpace(body)
+
+	if len(body) > 0 && body[0] == '[' {
+		var calls []json.RawMessage
+		if err := json.Unmarshal(body, &calls); err != nil {
+			writeJSON(w, s.reject(ctx, transport, codeParseError, "Parse error"))
+			return
+		}
+		switch {
+		case len(calls) == 0:
+			writeJSON(w, s.reject(ctx, transport, codeInvalidRequest, "Invalid Request: empty batch"))
+		case len(calls) > maxBatch:
+			writeJSON(w, s.reject(ctx, transport, codeInvalidRequest,
+				fmt.Sprintf("Invalid Request: batch of more than %d calls", maxBatch)))
+		default:
+			if resps := s.batch(ctx, transport, calls); len(resps) > 0 {
+				writeJSON(w, resps)
+			} else {
+				// A batch of notifications only gets no response
+				w.WriteHeader(http.StatusNoContent)
+			}
+		}
+		return
+	}
+
+	var req request
+	if err := json.Unmarshal(body, &req); err != nil {
+		if !json.Valid(body) {
+			writeJSON(w, s.reject(ctx, transport, codeParseError, "Parse error"))
+			return
+		}
+		// JSON, but not a request object: call answers an invalid request
+		req = request{}
+	}
+	if resp, _ := s.call(ctx, req, trace.WithAttributes(transport...)); resp != nil {
+		writeJSON(w, resp)
+	} else {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// batch runs the calls of a batch concurrently, as the specification allows,
+// and returns their responses in order, leaving out notifications.
+//
+// A batch span covers the HTTP request. Each call is a trace of its own,
+// linked to the batch span both ways: the calls are independent, and as
+// traces of their own they look the same as single calls, so a method's
+// latency and errors can be compared however it was called.
+func (s *server) batch(ctx context.Context, transport []attribute.KeyValue, calls []json.RawMessage) []*response {
+	ctx, span := s.tracer.Start(ctx, "jsonrpc batch",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(transport...),
+		trace.WithAttributes(
+			rpcSystem,
+			attribute.Int("rpc.jsonrpc.batch.size", len(calls)),
+		))
+	defer span.End()
+	batchLink := trace.Link{SpanContext: span.SpanContext()}
+
+	resps := make([]*response, len(calls))
+	callSpans := make([]trace.SpanContext, len(calls))
+	var wg sync.WaitGroup
+	for i, raw := range calls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var req request
+			if err := json.Unmarshal(raw, &req); err != nil {
+				// Not a request object: call answers an invalid request
+				req = request{}
+			}
+			resp, sc := s.call(ctx, req,
+				trace.WithNewRoot(),
+				trace.WithLinks(batchLink),
+				trace.WithAttributes(attribute.Int("rpc.jsonrpc.batch.index", i)))
+			resps[i], callSpans[i] = resp, sc
+		}()
+	}
+	wg.Wait()
+	for _, sc := range callSpans {
+		span.AddLink(trace.Link{SpanContext: sc})
+	}
+
+	out := resps[:0]
+	var failed int
+	for _, resp := range resps {
+		if resp != nil {
+			out = append(out, resp)
+			if resp.Error != nil {
+				failed++
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("rpc.jsonrpc.batch.errors", failed))
+	return out
+}
+
+// call runs one call under a server span named after its method. It returns
+// the call's response, nil for a notification, and the span's context.
+func (s *server) call(ctx context.Context, req request, opts ...trace.SpanStartOption) (*response, trace.SpanContext) {
+	name := req.Method
+	m, ok := s.methods[req.Method]
+	if !ok {
+		name = otherMethod
+	}
+	methodAttrs := []attribute.KeyValue{rpcSystem, semconv.RPCMethod(name)}
+	opts = append(opts,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(methodAttrs...))
+	ctx, span := s.tracer.Start(ctx, name, opts...)
+	defer span.End()
+	start := time.Now()
+
+	invalid := req.JSONRPC != "2.0" || req.Method == ""
+	if invalid && req.ID == nil {
+		// An invalid request is answered even without an id, with a null one
+		req.ID = json.RawMessage("null")
+	}
+	if req.JSONRPC != "" {
+		span.SetAttributes(semconv.RPCJSONRPCVersion(req.JSONRPC))
+	}
+	if req.ID != nil {
+		span.SetAttributes(semconv.RPCJSONRPCRequestID(requestID(req.ID)))
+	}
+	if !ok && req.Method != "" {
+		span.SetAttributes(attribute.String("rpc.method_original", req.Method))
+	}
+
+	var result any
+	var rerr *rpcError
+	switch {
+	case invalid:
+		rerr = &rpcError{Code: codeInvalidRequest, Message: "Invalid Request"}
+	case !ok:
+		rerr = &rpcError{Code: codeMethodNotFound, Message: "Method not found"}
+	default:
+		result, rerr = s.invoke(ctx, span, m, req.Params)
+	}
+
+	if rerr != nil {
+		span.SetAttributes(
+			semconv.RPCJSONRPCErrorCode(rerr.Code),
+			semconv.RPCJSONRPCErrorMessage(rerr.Message),
+			semconv.ErrorTypeKey.String(errorType(rerr.Code)),
+		)
+		if serverFault(rerr.Code) {
+			span.SetStatus(codes.Error, rerr.Message)
+		}
+		methodAttrs = append(methodAttrs, semconv.RPCJSONRPCErrorCode(rerr.Code))
+	}
+	s.duration.Record(ctx, float64(time.Since(start))/float64(time.Millisecond),
+		metric.WithAttributes(methodAttrs...))
+
+	if req.ID == nil {
+		return nil, span.SpanContext()
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if rerr != nil {
+		resp.Error = rerr
+	} else {
+		resp.Result = result
+	}
+	return resp, span.SpanContext()
+}
+
+// invoke runs m, and turns its error, or panic, into a JSON-RPC error. Errors
+// other than *rpcError are recorded on span, and answered as internal
+// errors: their messages are for the trace, not the client.
+func (s *server) invoke(ctx context.Context, span trace.Span, m method, params json.RawMessage) (result any, rerr *rpcError) {
+	defer func() {
+		if v := recover(); v != nil {
+			span.RecordError(fmt.Errorf("panic: %v", v),
+				trace.WithAttributes(semconv.ExceptionStacktrace(string(debug.Stack()))))
+			log.Printf("panic in JSON-RPC method: %v", v)
+			result, rerr = nil, &rpcError{Code: codeInternalError, Message: "Internal error"}
+		}
+	}()
+	result, err := m(ctx, params)
+	if err == nil {
+		return result, nil
+	}
+	if errors.As(err, &rerr) {
+		return nil, rerr
+	}
+	span.RecordError(err)
+	return nil, &rpcError{Code: codeInternalError, Message: "Internal error"}
+}
+
+// reject answers a request that couldn't be parsed into calls, under a span
+// of its own, since there's no method to name one after.
+func (s *server) reject(ctx context.Context, transport []attribute.KeyValue, code int, msg string) *response {
+	_, span := s.tracer.Start(ctx, "jsonrpc",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(transport...),
+		trace.WithAttributes(
+			rpcSystem,
+			semconv.RPCJSONRPCErrorCode(code),
+			semconv.RPCJSONRPCErrorMessage(msg),
+			semconv.ErrorTypeKey.String(errorType(code)),
+		))
+	span.End()
+	return &response{JSONRPC: "2.0", Error: &rpcError{Code: code, Message: msg}, ID: json.RawMessage("null")}
+}
+
+// requestID is the rpc.jsonrpc.request_id of an id: a string's value, a
+// number as written, and "" for null.
+func requestID(id json.RawMessage) string {
+	var s string
+	if json.Unmarshal(id, &s) == nil {
+		return s
+	}
+	if string(id) == "null" {
+		return ""
+	}
+	return string(id)
+}
+
+// clientAddress is the host of a RemoteAddr, without the port.
+func clientAddress(remoteAddr string) string {
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		return host
+	}
+	return remoteAddr
+}
+
+// decodeParams decodes params into v, and answers invalid params if they
+// don't fit.
+func decodeParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return &rpcError{Code: codeInvalidParams, Message: "Invalid params: missing"}
+	}
+	dec := json.NewDecoder(bytes.NewReader(params))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: "Invalid params", Data: err.Error()}
+	}
+	return nil
+}
+
+// JSON-RPC answers with 200 whatever the outcome of the calls: errors are in
+// the body.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("failed to write response: %v", err)
+	}
+}
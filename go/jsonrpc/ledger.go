@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Application error codes, outside the range the specification reserves.
+const (
+	codeAccountNotFound   = 1001
+	codeInsufficientFunds = 1002
+)
+
+type account struct {
+	ID      string `json:"id"`
+	Owner   string `json:"owner"`
+	Balance int64  `json:"balance"`
+}
+
+// ledger is the service behind the example's methods: accounts with
+// balances, in memory.
+type ledger struct {
+	mu       sync.Mutex
+	accounts map[string]*account
+}
+
+func newLedger() *ledger {
+	return &ledger{accounts: map[string]*account{
+		"acc-1": {ID: "acc-1", Owner: "alice", Balance: 10_000},
+		"acc-2": {ID: "acc-2", Owner: "bob", Balance: 2_500},
+		"acc-3": {ID: "acc-3", Owner: "carol", Balance: 0},
+	}}
+}
+
+// register adds the ledger's methods to s.
+func (l *ledger) register(s *server) {
+	s.register("accounts.get", l.get)
+	s.register("accounts.list", l.list)
+	s.register("accounts.transfer", l.transfer)
+	s.register("reports.generate", l.generateReport)
+	s.register("audit.record", l.recordAudit)
+}
+
+// get answers {"id": "acc-1"} with the account.
+func (l *ledger) get(_ context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	a, ok := l.accounts[p.ID]
+	if !ok {
+		return nil, &rpcError{Code: codeAccountNotFound, Message: "Account not found", Data: p.ID}
+	}
+	return *a, nil
+}
+
+// list answers with every account, in ID order. It takes no params.
+func (l *ledger) list(context.Context, json.RawMessage) (any, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	out := make([]account, 0, len(l.accounts))
+	for _, a := range l.accounts {
+		out = append(out, *a)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+// transfer moves {"amount": 100} from the account "from" to the account
+// "to", and answers with both balances.
+func (l *ledger) transfer(ctx context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		From   string `json:"from"`
+		To     string `json:"to"`
+		Amount int64  `json:"amount"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Amount <= 0 || p.From == p.To {
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Invalid params",
+			Data: "amount must be positive, between two different accounts"}
+	}
+	trace.SpanFromContext(ctx).SetAttributes(attribute.Int64("ledger.transfer.amount", p.Amount))
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	from, ok := l.accounts[p.From]
+	if !ok {
+		return nil, &rpcError{Code: codeAccountNotFound, Message: "Account not found", Data: p.From}
+	}
+	to, ok := l.accounts[p.To]
+	if !ok {
+		return nil, &rpcError{Code: codeAccountNotFound, Message: "Account not found", Data: p.To}
+	}
+	if from.Balance < p.Amount {
+		return nil, &rpcError{Code: codeInsufficientFunds, Message: "Insufficient funds",
+			Data: map[string]int64{"balance": from.Balance, "amount": p.Amount}}
+	}
+	from.Balance -= p.Amount
+	to.Balance += p.Amount
+	return map[string]int64{p.From: from.Balance, p.To: to.Balance}, nil
+}
+
+// generateReport stands in for slow work with two steps, and fails one call
+// in four with an error that isn't an *rpcError: the client gets an internal
+// error, and the span the error itself.
+func (l *ledger) generateReport(ctx context.Context, _ json.RawMessage) (any, error) {
+	tracer := otel.Tracer(tracerName)
+
+	_, span := tracer.Start(ctx, "load ledger snapshot")
+	time.Sleep(time.Duration(50+rand.IntN(100)) * time.Millisecond)
+	span.End()
+
+	_, span = tracer.Start(ctx, "render report")
+	defer span.End()
+	time.Sleep(time.Duration(20+rand.IntN(50)) * time.Millisecond)
+	if rand.IntN(4) == 0 {
+		err := errors.New("report store: write timed out")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var total int64
+	for _, a := range l.accounts {
+		total += a.Balance
+	}
+	return map[string]any{"accounts": len(l.accounts), "total_balance": total}, nil
+}
+
+// recordAudit is meant to be sent as a notification, without an id: the
+// caller gets no response, but the call is still traced.
+func (l *ledger) recordAudit(_ context.Context, params json.RawMessage) (any, error) {
+	var p struct {
+		Event string `json:"event"`
+	}
+	if err := decodeParams(params, &p); err != nil {
+		return nil, err
+	}
+	log.Printf("audit: %s", p.Event)
+	return nil, nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/last9/go-agent"
+)
+
+const tracerName = "jsonrpc-example"
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rpc, err := newServer()
+	if err != nil {
+		log.Fatalf("failed to create JSON-RPC server: %v", err)
+	}
+	newLedger().register(rpc)
+
+	// The JSON-RPC server starts the server spans itself, one per call, so
+	// the mux isn't wrapped in HTTP instrumentation
+	mux := http.NewServeMux()
+	mux.Handle("POST /rpc", rpc)
+
+	srv := &http.Server{
+		Addr:              ":" + getEnv("PORT", "8080"),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+	log.Printf("✓ JSON-RPC server running on %s/rpc", srv.Addr)
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down server: %v", err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
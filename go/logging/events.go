@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/last9/opentelemetry-examples/go/logging/telemetry"
+)
+
+// checkoutMetricAttributes are the attributes of the order.checkout event
+// kept on the app.events metric. order.id and order.total are left out: they
+// would make a series per order.
+var checkoutMetricAttributes = []attribute.Key{"order.status", "payment.method"}
+
+// checkout records one business occurrence, an order being checked out, with
+// telemetry.Event. With TELEMETRY_EVENT_SINKS=all it shows up three times in
+// Last9: as an event on the request span, as a log record linked to that span,
+// and as an increment of app.events.
+func checkout(c *gin.Context) {
+	ctx := c.Request.Context()
+
+	o, ok := orders[c.Param("id")]
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": errOrderNotFound.Error()})
+		return
+	}
+
+	telemetry.Event(ctx, "order.checkout",
+		attribute.String("order.id", o.ID),
+		attribute.String("order.status", o.Status),
+		attribute.Float64("order.total", o.Total),
+		attribute.String("payment.method", c.DefaultQuery("payment_method", "card")),
+	)
+
+	c.JSON(http.StatusOK, gin.H{
+		"order": o,
+		"event": "order.checkout",
+		"sinks": telemetry.Sinks().String(),
+	})
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.uber.org/zap"
+
+	"github.com/last9/opentelemetry-examples/go/logging/last9"
+)
+
+var tracer = otel.Tracer(last9.ScopeName)
+
+var (
+	errOrderNotFound = errors.New("order not found")
+	errPaymentFailed = errors.New("payment gateway returned 502")
+)
+
+type order struct {
+	ID     string  `json:"id"`
+	Status string  `json:"status"`
+	Total  float64 `json:"total"`
+}
+
+var orders = map[string]order{
+	"1001": {ID: "1001", Status: "shipped", Total: 49.90},
+	"1002": {ID: "1002", Status: "processing", Total: 12.00},
+	"1003": {ID: "1003", Status: "payment_pending", Total: 230.15},
+}
+
+// lookupOrder runs in its own span, so log records emitted from inside it
+// carry a different span_id than those from the handler.
+func lookupOrder(ctx context.Context, id string) (context.Context, order, error) {
+	ctx, span := tracer.Start(ctx, "orders.lookup")
+	defer span.End()
+	span.SetAttributes(attribute.String("order.id", id))
+
+	time.Sleep(10 * time.Millisecond)
+
+	o, ok := orders[id]
+	if !ok {
+		return ctx, order{}, errOrderNotFound
+	}
+	if o.Status == "payment_pending" {
+		span.RecordError(errPaymentFailed)
+		span.SetStatus(codes.Error, errPaymentFailed.Error())
+		return ctx, order{}, errPaymentFailed
+	}
+	return ctx, o, nil
+}
+
+type zapHandlers struct {
+	logger *zap.Logger
+}
+
+// getOrder logs at every severity the example maps: debug on entry, info on
+// success, warn on a missing order and error on a failed dependency.
+func (h *zapHandlers) getOrder(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+
+	h.logger.Debug("looking up order", last9.ZapContext(ctx), zap.String("order.id", id))
+
+	lookupCtx, o, err := lookupOrder(ctx, id)
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		h.logger.Warn("order not found", last9.ZapContext(ctx), zap.String("order.id", id))
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		// Logged with the lookup span's context, so the record links to the
+		// span that failed rather than the request span.
+		h.logger.Error("order lookup failed", last9.ZapContext(lookupCtx),
+			zap.String("order.id", id), zap.Error(err))
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.logger.Info("order found", last9.ZapContext(ctx),
+		zap.String("order.id", o.ID),
+		zap.String("order.status", o.Status),
+		zap.Float64("order.total", o.Total),
+	)
+	c.JSON(http.StatusOK, o)
+}
+
+type logrusHandlers struct {
+	logger *logrus.Logger
+}
+
+// getOrder is the logrus version of zapHandlers.getOrder.
+func (h *logrusHandlers) getOrder(c *gin.Context) {
+	ctx := c.Request.Context()
+	id := c.Param("id")
+	log := h.logger.WithContext(ctx).WithField("order.id", id)
+
+	log.Debug("looking up order")
+
+	lookupCtx, o, err := lookupOrder(ctx, id)
+	switch {
+	case errors.Is(err, errOrderNotFound):
+		log.Warn("order not found")
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		log.WithContext(lookupCtx).WithError(err).Error("order lookup failed")
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.WithFields(logrus.Fields{
+		"order.status": o.Status,
+		"order.total":  o.Total,
+	}).Info("order found")
+	c.JSON(http.StatusOK, o)
+}
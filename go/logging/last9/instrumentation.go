@@ -0,0 +1,103 @@
+package last9
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// Instrumentation holds the tracer, logger and meter providers so callers can
+// flush them on shutdown.
+type Instrumentation struct {
+	TracerProvider *sdktrace.TracerProvider
+	LoggerProvider *sdklog.LoggerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+}
+
+// NewInstrumentation sets up OTLP/HTTP trace, log and metric exporters and
+// registers the providers globally. Endpoint and headers are read from the standard
+// OTEL_EXPORTER_OTLP_* environment variables.
+//
+// All three signals share one resource, so a log record and the span it was
+// emitted under carry the same service.name, service.version and
+// deployment.environment.
+func NewInstrumentation(ctx context.Context, serviceName, serviceVersion string) *Instrumentation {
+	env := os.Getenv("DEPLOYMENT_ENVIRONMENT")
+	if env == "" {
+		env = "local"
+	}
+
+	// Attributes from OTEL_RESOURCE_ATTRIBUTES are applied last, so they
+	// override the defaults set here.
+	res, err := resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithOS(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+			semconv.ServiceVersionKey.String(serviceVersion),
+			semconv.DeploymentEnvironmentKey.String(env),
+		),
+		resource.WithFromEnv(),
+	)
+	if err != nil {
+		log.Fatalf("failed to create resource: %v", err)
+	}
+
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp trace exporter: %v", err)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+
+	logExporter, err := otlploghttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp log exporter: %v", err)
+	}
+	lp := sdklog.NewLoggerProvider(
+		sdklog.WithProcessor(sdklog.NewBatchProcessor(logExporter)),
+		sdklog.WithResource(res),
+	)
+
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		log.Fatalf("failed to create otlp metric exporter: %v", err)
+	}
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+
+	otel.SetTracerProvider(tp)
+	otel.SetMeterProvider(mp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	global.SetLoggerProvider(lp)
+
+	return &Instrumentation{TracerProvider: tp, LoggerProvider: lp, MeterProvider: mp}
+}
+
+// Shutdown flushes any buffered spans, log records and metrics.
+func (i *Instrumentation) Shutdown(ctx context.Context) error {
+	return errors.Join(
+		i.TracerProvider.Shutdown(ctx),
+		i.LoggerProvider.Shutdown(ctx),
+		i.MeterProvider.Shutdown(ctx),
+	)
+}
@@ -0,0 +1,70 @@
+package last9
+
+import (
+	"context"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/bridges/otellogrus"
+	"go.opentelemetry.io/contrib/bridges/otelzap"
+	"go.opentelemetry.io/otel/log"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// ScopeName is the instrumentation scope name used by both bridges.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/logging"
+
+// NewZapLogger returns a zap logger that writes JSON to stdout and sends
+// every record at or above level to the OpenTelemetry logs SDK.
+//
+// Pass the request context with ZapContext so records are correlated with the
+// active span:
+//
+//	logger.Info("order found", last9.ZapContext(ctx), zap.String("order.id", id))
+func NewZapLogger(lp log.LoggerProvider, level zapcore.Level) (*zap.Logger, error) {
+	stdout := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.Lock(os.Stdout),
+		level,
+	)
+	// otelzap.Core enables every level the LoggerProvider accepts, so raise
+	// it to the same threshold as stdout.
+	otelCore, err := zapcore.NewIncreaseLevelCore(
+		otelzap.NewCore(ScopeName, otelzap.WithLoggerProvider(lp)),
+		level,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return zap.New(zapcore.NewTee(stdout, otelCore)), nil
+}
+
+// ZapContext carries ctx to the otelzap core. It uses zapcore.SkipType, so
+// the stdout encoder ignores it while otelzap reads the trace and span IDs
+// from it.
+func ZapContext(ctx context.Context) zap.Field {
+	return zap.Field{Key: "context", Type: zapcore.SkipType, Interface: ctx}
+}
+
+// NewLogrusLogger returns a logrus logger that writes JSON to stdout and
+// sends every record at or above level to the OpenTelemetry logs SDK through
+// the otellogrus hook.
+//
+// Use WithContext so records are correlated with the active span:
+//
+//	logger.WithContext(ctx).WithField("order.id", id).Info("order found")
+func NewLogrusLogger(lp log.LoggerProvider, level logrus.Level) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&logrus.JSONFormatter{})
+	logger.SetLevel(level)
+
+	// The hook fires only for the levels it declares; logrus has already
+	// dropped anything below the logger's own level.
+	logger.AddHook(otellogrus.NewHook(ScopeName,
+		otellogrus.WithLoggerProvider(lp),
+		otellogrus.WithLevels(logrus.AllLevels[:level+1]),
+	))
+	return logger
+}
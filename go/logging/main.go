@@ -0,0 +1,111 @@
+// Gin service that sends zap and logrus logs through the OpenTelemetry logs
+// SDK. Each log record carries the trace and span ID of the request it was
+// emitted in, so logs and traces can be joined in Last9. The checkout endpoint
+// records a business event as a span event, a log record and a metric, to
+// compare the three.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/last9/opentelemetry-examples/go/logging/last9"
+	"github.com/last9/opentelemetry-examples/go/logging/telemetry"
+)
+
+const serviceVersion = "1.0.0"
+
+func main() {
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "logging-example"
+	}
+
+	inst := last9.NewInstrumentation(context.Background(), serviceName, serviceVersion)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := inst.Shutdown(ctx); err != nil {
+			log.Printf("failed to shut down instrumentation: %v", err)
+		}
+	}()
+
+	zapLevel, err := zapcore.ParseLevel(envOr("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Fatalf("invalid LOG_LEVEL: %v", err)
+	}
+	logrusLevel, err := logrus.ParseLevel(envOr("LOG_LEVEL", "info"))
+	if err != nil {
+		log.Fatalf("invalid LOG_LEVEL: %v", err)
+	}
+
+	zapLogger, err := last9.NewZapLogger(inst.LoggerProvider, zapLevel)
+	if err != nil {
+		log.Fatalf("failed to create zap logger: %v", err)
+	}
+	defer zapLogger.Sync()
+	logrusLogger := last9.NewLogrusLogger(inst.LoggerProvider, logrusLevel)
+
+	sinks, err := telemetry.ParseSinks(envOr("TELEMETRY_EVENT_SINKS", "all"))
+	if err != nil {
+		log.Fatalf("invalid TELEMETRY_EVENT_SINKS: %v", err)
+	}
+	telemetry.Configure(telemetry.Config{
+		Sinks:            sinks,
+		MetricAttributes: checkoutMetricAttributes,
+		LoggerProvider:   inst.LoggerProvider,
+		MeterProvider:    inst.MeterProvider,
+	})
+
+	zh := &zapHandlers{logger: zapLogger}
+	lh := &logrusHandlers{logger: logrusLogger}
+
+	r := gin.New()
+	r.Use(gin.Recovery())
+	r.Use(otelgin.Middleware(serviceName))
+
+	r.GET("/zap/orders/:id", zh.getOrder)
+	r.GET("/logrus/orders/:id", lh.getOrder)
+	r.POST("/orders/:id/checkout", checkout)
+
+	port := envOr("PORT", "8080")
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+
+	go func() {
+		zapLogger.Info("server starting", zap.String("port", port))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// Wait for a signal, then stop the server so the deferred shutdown
+	// flushes the last log records and spans.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
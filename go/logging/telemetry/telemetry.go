@@ -0,0 +1,193 @@
+// Package telemetry records business occurrences, such as an order being
+// placed, as a span event, a log record and a metric increment, so the same
+// occurrence can be compared in each signal.
+//
+// Which of the three an event goes to is set once, with Configure:
+//
+//	telemetry.Configure(telemetry.Config{Sinks: telemetry.SpanEvent | telemetry.MetricCount})
+//	telemetry.Event(ctx, "order.placed", attribute.String("order.id", id))
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/log"
+	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope name of the log records and metric.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/logging/telemetry"
+
+// Sink is a set of signals an event is recorded to.
+type Sink uint8
+
+const (
+	// SpanEvent adds the event to the span in the context. It is exported
+	// with the span, and dropped with it if the span isn't sampled.
+	SpanEvent Sink = 1 << iota
+	// LogRecord emits an info log record with the event name, correlated
+	// with the span in the context. It is exported whether or not the span
+	// is sampled.
+	LogRecord
+	// MetricCount increments the app.events counter. Only the event name and
+	// the attributes listed in Config.MetricAttributes are kept, so IDs
+	// don't make a series each.
+	MetricCount
+
+	// AllSinks records events to every signal.
+	AllSinks = SpanEvent | LogRecord | MetricCount
+)
+
+var sinkNames = []struct {
+	sink Sink
+	name string
+}{
+	{SpanEvent, "span"},
+	{LogRecord, "log"},
+	{MetricCount, "metric"},
+}
+
+// String returns the sinks as a comma-separated list, such as "span,metric".
+func (s Sink) String() string {
+	var names []string
+	for _, n := range sinkNames {
+		if s&n.sink != 0 {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// ParseSinks parses a comma-separated list of "span", "log" and "metric".
+// "all" selects every sink.
+func ParseSinks(s string) (Sink, error) {
+	var sinks Sink
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if part == "all" {
+			sinks |= AllSinks
+			continue
+		}
+		found := false
+		for _, n := range sinkNames {
+			if part == n.name {
+				sinks |= n.sink
+				found = true
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown telemetry sink %q", part)
+		}
+	}
+	return sinks, nil
+}
+
+// Config configures where Event records events.
+type Config struct {
+	// Sinks are the signals events are recorded to.
+	Sinks Sink
+	// MetricAttributes are the attribute keys copied to the metric. Every
+	// other attribute is left out of it.
+	MetricAttributes []attribute.Key
+	// LoggerProvider defaults to the global LoggerProvider.
+	LoggerProvider log.LoggerProvider
+	// MeterProvider defaults to the global MeterProvider.
+	MeterProvider metric.MeterProvider
+}
+
+type emitter struct {
+	sinks      Sink
+	metricKeys map[attribute.Key]bool
+	logger     log.Logger
+	events     metric.Int64Counter
+}
+
+var current atomic.Pointer[emitter]
+
+func init() {
+	Configure(Config{Sinks: AllSinks})
+}
+
+// Configure sets where Event records events. Until it is called, events go to
+// every sink, through the global providers, and the metric has only the event
+// name.
+func Configure(cfg Config) {
+	if cfg.LoggerProvider == nil {
+		cfg.LoggerProvider = global.GetLoggerProvider()
+	}
+	if cfg.MeterProvider == nil {
+		cfg.MeterProvider = otel.GetMeterProvider()
+	}
+	e := &emitter{
+		sinks:      cfg.Sinks,
+		metricKeys: make(map[attribute.Key]bool, len(cfg.MetricAttributes)),
+		logger:     cfg.LoggerProvider.Logger(ScopeName),
+	}
+	for _, k := range cfg.MetricAttributes {
+		e.metricKeys[k] = true
+	}
+	var err error
+	e.events, err = cfg.MeterProvider.Meter(ScopeName).Int64Counter("app.events",
+		metric.WithDescription("Business events, by event.name"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		otel.Handle(err)
+	}
+	current.Store(e)
+}
+
+// Sinks returns the sinks events are currently recorded to.
+func Sinks() Sink {
+	return current.Load().sinks
+}
+
+// Event records a business occurrence named name to the configured sinks.
+// The span event and log record get every attribute; the metric only the
+// event name and the configured metric attributes.
+func Event(ctx context.Context, name string, attrs ...attribute.KeyValue) {
+	e := current.Load()
+	if e.sinks&SpanEvent != 0 {
+		trace.SpanFromContext(ctx).AddEvent(name, trace.WithAttributes(attrs...))
+	}
+	if e.sinks&LogRecord != 0 {
+		e.emitLog(ctx, name, attrs)
+	}
+	if e.sinks&MetricCount != 0 && e.events != nil {
+		e.count(ctx, name, attrs)
+	}
+}
+
+func (e *emitter) emitLog(ctx context.Context, name string, attrs []attribute.KeyValue) {
+	if !e.logger.Enabled(ctx, log.EnabledParameters{Severity: log.SeverityInfo, EventName: name}) {
+		return
+	}
+	var rec log.Record
+	rec.SetEventName(name)
+	rec.SetBody(log.StringValue(name))
+	rec.SetSeverity(log.SeverityInfo)
+	rec.SetSeverityText("INFO")
+	for _, kv := range attrs {
+		rec.AddAttributes(log.KeyValueFromAttribute(kv))
+	}
+	e.logger.Emit(ctx, rec)
+}
+
+func (e *emitter) count(ctx context.Context, name string, attrs []attribute.KeyValue) {
+	kept := []attribute.KeyValue{attribute.String("event.name", name)}
+	for _, kv := range attrs {
+		if e.metricKeys[kv.Key] {
+			kept = append(kept, kv)
+		}
+	}
+	e.events.Add(ctx, 1, metric.WithAttributes(kept...))
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Topics, with the device ID in the second level. The templates name the
+// spans.
+const (
+	telemetryTemplate = "devices/+/telemetry"
+	statusTemplate    = "devices/+/status"
+	commandsTemplate  = "devices/+/commands"
+)
+
+func deviceTopic(id, kind string) string {
+	return "devices/" + id + "/" + kind
+}
+
+// reading is a telemetry message
+type reading struct {
+	Temperature float64   `json:"temperature"`
+	Setpoint    float64   `json:"setpoint"`
+	Time        time.Time `json:"time"`
+}
+
+// command is a command message, and the body of POST /devices/:id/commands
+type command struct {
+	Setpoint *float64 `json:"setpoint" binding:"required"`
+}
+
+// device simulates a thermostat. It publishes a reading to its telemetry
+// topic every interval with QoS 0, since the next reading soon replaces a
+// lost one, and its status with QoS 1, retained, so a new subscriber learns
+// it right away. The broker publishes the retained "offline" will if the
+// device drops off without disconnecting.
+type device struct {
+	id       string
+	interval time.Duration
+	c        *client
+
+	mu       sync.Mutex
+	setpoint float64
+}
+
+func runDevice(ctx context.Context, broker *url.URL, id string, interval time.Duration) error {
+	d := &device{id: id, interval: interval, setpoint: 20}
+	will := &paho.WillMessage{Topic: deviceTopic(id, "status"), Payload: []byte("offline"), QoS: 1, Retain: true}
+	c, err := connect(broker, "device-"+id, will, route{
+		filter:   deviceTopic(id, "commands"),
+		template: commandsTemplate,
+		qos:      1,
+		handle:   d.handleCommand,
+	})
+	if err != nil {
+		return err
+	}
+	d.c = c
+	if err := c.cm.AwaitConnection(ctx); err != nil {
+		c.disconnect(context.Background())
+		return err
+	}
+
+	if err := d.publishStatus(ctx, "online"); err != nil {
+		log.Printf("device %s: %v", id, err)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := d.publishStatus(shutdownCtx, "offline"); err != nil {
+				log.Printf("device %s: %v", id, err)
+			}
+			c.disconnect(shutdownCtx)
+			return nil
+		case <-ticker.C:
+		}
+		if err := d.publishReading(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("device %s: %v", id, err)
+		}
+	}
+}
+
+// publishReading publishes a reading. Each starts a trace of its own.
+func (d *device) publishReading(ctx context.Context) error {
+	d.mu.Lock()
+	r := reading{Setpoint: d.setpoint, Time: time.Now()}
+	d.mu.Unlock()
+	r.Temperature = r.Setpoint + rand.NormFloat64()
+
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return d.c.publish(ctx, telemetryTemplate, &paho.Publish{
+		Topic:   deviceTopic(d.id, "telemetry"),
+		QoS:     0,
+		Payload: payload,
+		Properties: &paho.PublishProperties{
+			ContentType: "application/json",
+		},
+	})
+}
+
+func (d *device) publishStatus(ctx context.Context, status string) error {
+	return d.c.publish(ctx, statusTemplate, &paho.Publish{
+		Topic:   deviceTopic(d.id, "status"),
+		QoS:     1,
+		Retain:  true,
+		Payload: []byte(status),
+	})
+}
+
+// handleCommand applies a command. Its span is a child of the publish span
+// of the request that sent it.
+func (d *device) handleCommand(ctx context.Context, p *paho.Publish) error {
+	var cmd command
+	if err := json.Unmarshal(p.Payload, &cmd); err != nil {
+		return fmt.Errorf("failed to decode command: %v", err)
+	}
+	if cmd.Setpoint == nil {
+		return errors.New("command has no setpoint")
+	}
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("device.id", d.id),
+		attribute.Float64("device.setpoint", *cmd.Setpoint),
+	)
+
+	d.mu.Lock()
+	d.setpoint = *cmd.Setpoint
+	d.mu.Unlock()
+	log.Printf("device %s: setpoint changed to %.1f", d.id, *cmd.Setpoint)
+	return nil
+}
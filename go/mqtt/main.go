@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/eclipse/paho.golang/paho"
+	"github.com/gin-gonic/gin"
+	"github.com/last9/go-agent"
+	ginagent "github.com/last9/go-agent/instrumentation/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "mqtt-example"
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	broker, err := url.Parse(getEnv("MQTT_BROKER_URL", "mqtt://localhost:1883"))
+	if err != nil {
+		log.Fatalf("invalid MQTT_BROKER_URL: %v", err)
+	}
+
+	// The backend subscribes to every device's telemetry and status, and
+	// sends commands
+	backend, err := connect(broker, getEnv("MQTT_CLIENT_ID", "mqtt-example-backend"), nil,
+		route{filter: telemetryTemplate, template: telemetryTemplate, qos: 0, handle: handleTelemetry},
+		route{filter: statusTemplate, template: statusTemplate, qos: 1, handle: handleStatus},
+	)
+	if err != nil {
+		log.Fatalf("failed to connect backend: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	if getEnv("SIMULATE_DEVICE", "true") == "true" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := getEnv("DEVICE_ID", "thermostat-1")
+			if err := runDevice(ctx, broker, id, getEnvDuration("TELEMETRY_INTERVAL", 5*time.Second)); err != nil && ctx.Err() == nil {
+				log.Printf("device %s stopped: %v", id, err)
+			}
+		}()
+	}
+
+	router := ginagent.Default()
+	router.POST("/devices/:id/commands", commandHandler(backend))
+
+	srv := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+	log.Printf("✓ Gin server running on %s (instrumented by go-agent)", srv.Addr)
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down server: %v", err)
+	}
+	wg.Wait()
+	backend.disconnect(shutdownCtx)
+}
+
+// commandHandler publishes a command to a device with QoS 1, under a
+// publish span that's a child of the request's. It responds once the broker
+// has acknowledged the command; the device applies it on its own time.
+func commandHandler(backend *client) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var cmd command
+		if err := c.ShouldBindJSON(&cmd); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		payload, err := json.Marshal(cmd)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		id := c.Param("id")
+		err = backend.publish(c.Request.Context(), commandsTemplate, &paho.Publish{
+			Topic:   deviceTopic(id, "commands"),
+			QoS:     1,
+			Payload: payload,
+			Properties: &paho.PublishProperties{
+				ContentType: "application/json",
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"device": id, "topic": deviceTopic(id, "commands")})
+	}
+}
+
+// handleTelemetry stands in for storing a reading. Its span is a child of
+// the device's publish span.
+func handleTelemetry(ctx context.Context, p *paho.Publish) error {
+	var r reading
+	if err := json.Unmarshal(p.Payload, &r); err != nil {
+		return fmt.Errorf("failed to decode reading: %v", err)
+	}
+	id := topicDeviceID(p.Topic)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("device.id", id),
+		attribute.Float64("device.temperature", r.Temperature),
+	)
+	log.Printf("%s: %.1f°C (setpoint %.1f)", id, r.Temperature, r.Setpoint)
+	return nil
+}
+
+// handleStatus logs a device coming online or going offline. The statuses
+// are retained, so one arrives for every known device when the backend
+// subscribes.
+func handleStatus(ctx context.Context, p *paho.Publish) error {
+	id := topicDeviceID(p.Topic)
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("device.id", id),
+		attribute.String("device.status", string(p.Payload)),
+	)
+	log.Printf("%s is %s", id, p.Payload)
+	return nil
+}
+
+// topicDeviceID returns the device ID, the second level of a device topic
+func topicDeviceID(topic string) string {
+	levels := strings.Split(topic, "/")
+	if len(levels) < 2 {
+		return ""
+	}
+	return levels[1]
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
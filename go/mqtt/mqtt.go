@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// userPropertiesCarrier implements TextMapCarrier for MQTT v5 user
+// properties. MQTT v3.1.1 has no place for them; a v3 subscriber gets the
+// message without its trace context.
+type userPropertiesCarrier struct {
+	props *paho.UserProperties
+}
+
+func (c userPropertiesCarrier) Get(key string) string {
+	return c.props.Get(key)
+}
+
+// Set replaces the property, since user properties may repeat a key
+func (c userPropertiesCarrier) Set(key string, value string) {
+	props := (*c.props)[:0]
+	for _, p := range *c.props {
+		if p.Key != key {
+			props = append(props, p)
+		}
+	}
+	*c.props = append(props, paho.UserProperty{Key: key, Value: value})
+}
+
+func (c userPropertiesCarrier) Keys() []string {
+	keys := make([]string, 0, len(*c.props))
+	for _, p := range *c.props {
+		keys = append(keys, p.Key)
+	}
+	return keys
+}
+
+// route is a handler for the messages on the topics that match filter,
+// which may hold + and # wildcards. template names the spans, as for
+// publish; it is the filter itself unless that names a single device.
+// Handlers run on the connection's read
+// loop, one at a time: one that publishes with QoS 1 or 2 on the same
+// connection would wait for an acknowledgement the loop can't read.
+type route struct {
+	filter   string
+	template string
+	qos      byte
+	handle   func(ctx context.Context, p *paho.Publish) error
+}
+
+// client is a connection to the broker that publishes and receives
+// messages under spans.
+type client struct {
+	id     string
+	cm     *autopaho.ConnectionManager
+	routes []route
+	tracer trace.Tracer
+}
+
+// connect connects to the broker as clientID, and subscribes to the routes'
+// filters every time the connection comes up. autopaho reconnects on its
+// own, until disconnect; the connection doesn't end with a context, so a
+// client can still publish while it shuts down. will, if set, is published
+// by the broker when the connection drops without a DISCONNECT.
+func connect(broker *url.URL, clientID string, will *paho.WillMessage, routes ...route) (*client, error) {
+	ctx := context.Background()
+	c := &client{id: clientID, routes: routes, tracer: otel.Tracer(tracerName)}
+	cfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{broker},
+		KeepAlive:                     20,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                5 * time.Second,
+		WillMessage:                   will,
+		ConnectUsername:               os.Getenv("MQTT_USERNAME"),
+		ConnectPassword:               []byte(os.Getenv("MQTT_PASSWORD")),
+		OnConnectionUp: func(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+			log.Printf("%s: connected to %s", clientID, broker.Host)
+			if len(routes) == 0 {
+				return
+			}
+			sub := &paho.Subscribe{}
+			for _, r := range routes {
+				sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: r.filter, QoS: r.qos})
+			}
+			if _, err := cm.Subscribe(ctx, sub); err != nil {
+				log.Printf("%s: failed to subscribe: %v", clientID, err)
+			}
+		},
+		OnConnectError: func(err error) {
+			log.Printf("%s: failed to connect to %s: %v", clientID, broker.Host, err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID:          clientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){c.onPublishReceived},
+		},
+	}
+	cm, err := autopaho.NewConnection(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", broker.Host, err)
+	}
+	c.cm = cm
+	return c, nil
+}
+
+// publish sends p under a producer span, a child of the span in ctx, and
+// injects the span's context into p's user properties. template is the
+// topic with its variable levels as wildcards, for the span name: a topic
+// per device would make a span name per device. For QoS 1 and 2, publish
+// returns once the broker has acknowledged the message.
+func (c *client) publish(ctx context.Context, template string, p *paho.Publish) (err error) {
+	ctx, span := c.tracer.Start(ctx, "publish "+template,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messageAttributes(c.id, "send", template, p)...))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	if p.Properties == nil {
+		p.Properties = &paho.PublishProperties{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, userPropertiesCarrier{&p.Properties.User})
+	if _, err := c.cm.Publish(ctx, p); err != nil {
+		return fmt.Errorf("failed to publish to %s: %v", p.Topic, err)
+	}
+	return nil
+}
+
+// onPublishReceived runs the handler of the first route whose filter matches
+// the message's topic, under a consumer span.
+//
+// The span is a child of the publisher's span, from the message's user
+// properties. A retained message is the exception: the broker replays it
+// to every new subscriber, possibly long after it was published, so its
+// span starts a new trace, linked to the publisher's span. Otherwise each
+// subscribe would add a span to the publisher's trace.
+func (c *client) onPublishReceived(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+	var r *route
+	for i := range c.routes {
+		if topicMatches(c.routes[i].filter, p.Topic) {
+			r = &c.routes[i]
+			break
+		}
+	}
+	if r == nil {
+		return false, nil
+	}
+
+	ctx := context.Background()
+	if p.Properties != nil {
+		ctx = otel.GetTextMapPropagator().Extract(ctx, userPropertiesCarrier{&p.Properties.User})
+	}
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messageAttributes(c.id, "process", r.template, p)...),
+		trace.WithAttributes(attribute.Bool("messaging.mqtt.duplicate", p.Duplicate())),
+	}
+	if p.Retain {
+		opts = append(opts, trace.WithNewRoot())
+		if pub := trace.SpanContextFromContext(ctx); pub.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: pub}))
+		}
+	}
+	ctx, span := c.tracer.Start(ctx, "process "+r.template, opts...)
+	defer span.End()
+
+	// The error is only logged: paho acks a QoS 1 or 2 message once the
+	// handlers return, failed or not, so the broker won't redeliver it
+	if err := r.handle(ctx, p); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("%s: failed to handle message on %s: %v", c.id, p.Topic, err)
+	}
+	return true, nil
+}
+
+func (c *client) disconnect(ctx context.Context) {
+	if err := c.cm.Disconnect(ctx); err != nil {
+		log.Printf("%s: failed to disconnect: %v", c.id, err)
+	}
+}
+
+// messageAttributes are the attributes of a publish or process span
+func messageAttributes(clientID, operation, template string, p *paho.Publish) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "mqtt"),
+		attribute.String("messaging.operation.type", operation),
+		attribute.String("messaging.destination.name", p.Topic),
+		attribute.String("messaging.destination.template", template),
+		attribute.String("messaging.client.id", clientID),
+		attribute.Int("messaging.message.body.size", len(p.Payload)),
+		attribute.Int("messaging.mqtt.qos", int(p.QoS)),
+		attribute.Bool("messaging.mqtt.retain", p.Retain),
+	}
+}
+
+// topicMatches reports whether topic matches filter: + matches one level,
+// and # the rest of the topic, the parent level included.
+func topicMatches(filter, topic string) bool {
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true
+		}
+		if i >= len(t) || (level != "+" && level != t[i]) {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	tokenIssuer = "nethttp_example"
+	tokenTTL    = 15 * time.Minute
+)
+
+// Reasons a request fails authentication, the auth.failure.reason of its
+// span event and of the failure counter. They don't say whose token it was,
+// or anything in it.
+const (
+	authMissingToken     = "missing_token"
+	authMalformedToken   = "malformed_token"
+	authInvalidSignature = "invalid_signature"
+	authExpiredToken     = "expired_token"
+	authInvalidClaims    = "invalid_claims"
+)
+
+// Auth metrics, on the global meter provider set by agent.Start.
+var (
+	authSuccesses metric.Int64Counter
+	authFailures  metric.Int64Counter
+)
+
+// jwtSecret signs and verifies tokens, with HS256. issueTokens is true when
+// JWT_SECRET is unset: the secret is then random, so no one else can issue
+// tokens for it, and POST /token stands in for an identity provider.
+var (
+	jwtSecret   []byte
+	issueTokens bool
+)
+
+func init() {
+	meter := otel.Meter("nethttp_example/auth")
+
+	var err error
+	authSuccesses, err = meter.Int64Counter("auth.successes",
+		metric.WithDescription("Requests with a valid token"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		log.Fatalf("failed to create auth.successes counter: %v", err)
+	}
+	authFailures, err = meter.Int64Counter("auth.failures",
+		metric.WithDescription("Requests rejected for a missing or invalid token, by reason"),
+		metric.WithUnit("{request}"))
+	if err != nil {
+		log.Fatalf("failed to create auth.failures counter: %v", err)
+	}
+
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		jwtSecret = []byte(secret)
+		return
+	}
+	jwtSecret = make([]byte, 32)
+	if _, err := rand.Read(jwtSecret); err != nil {
+		log.Fatalf("failed to generate JWT secret: %v", err)
+	}
+	issueTokens = true
+}
+
+type authUserKey struct{}
+
+// authUser is who a request's token was issued to
+type authUser struct {
+	ID string
+	// SessionHash identifies the token without revealing it: requests made
+	// with the same token have the same hash
+	SessionHash string
+}
+
+// userFromContext returns the user requireAuth put in ctx
+func userFromContext(ctx context.Context) (authUser, bool) {
+	u, ok := ctx.Value(authUserKey{}).(authUser)
+	return u, ok
+}
+
+// requireAuth only calls next for requests with a valid bearer token. The
+// route's span gets enduser.id, the token's subject, and session.id, a hash
+// of the token. The token itself never reaches the telemetry: anyone who
+// can read the spans could use it.
+//
+// A rejected request gets a 401, and an auth.failure event on its span with
+// auth.failure.reason. The span status stays unset, as for any 4xx: the
+// server did what it should.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		route := attribute.String("http.route", routeOf(r))
+
+		user, reason := authenticate(r)
+		if reason != "" {
+			span.AddEvent("auth.failure", trace.WithAttributes(
+				attribute.String("auth.failure.reason", reason),
+			))
+			authFailures.Add(ctx, 1, metric.WithAttributes(
+				route, attribute.String("auth.failure.reason", reason),
+			))
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, jsonError("authentication required: "+reason), http.StatusUnauthorized)
+			return
+		}
+
+		span.SetAttributes(
+			attribute.String("enduser.id", user.ID),
+			attribute.String("session.id", user.SessionHash),
+		)
+		authSuccesses.Add(ctx, 1, metric.WithAttributes(route))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, authUserKey{}, user)))
+	})
+}
+
+// routeOf is the pattern r matched without its method, such as /users/{id}
+func routeOf(r *http.Request) string {
+	if i := strings.IndexByte(r.Pattern, '/'); i >= 0 {
+		return r.Pattern[i:]
+	}
+	return r.Pattern
+}
+
+// authenticate validates the request's bearer token, and returns its user,
+// or the reason it isn't valid
+func authenticate(r *http.Request) (authUser, string) {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		return authUser{}, authMissingToken
+	}
+
+	token, err := jwt.ParseWithClaims(raw, &jwt.RegisteredClaims{},
+		func(*jwt.Token) (any, error) { return jwtSecret, nil },
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(tokenIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	switch {
+	case errors.Is(err, jwt.ErrTokenMalformed):
+		return authUser{}, authMalformedToken
+	case errors.Is(err, jwt.ErrTokenSignatureInvalid), errors.Is(err, jwt.ErrTokenUnverifiable):
+		return authUser{}, authInvalidSignature
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return authUser{}, authExpiredToken
+	case err != nil:
+		return authUser{}, authInvalidClaims
+	}
+
+	subject, err := token.Claims.GetSubject()
+	if err != nil || subject == "" {
+		return authUser{}, authInvalidClaims
+	}
+	sum := sha256.Sum256([]byte(raw))
+	return authUser{ID: subject, SessionHash: hex.EncodeToString(sum[:8])}, ""
+}
+
+// tokenHandler issues a token for {"user_id": "..."}, valid for 15 minutes.
+// It is only registered when JWT_SECRET is unset.
+func tokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.UserID == "" {
+		http.Error(w, jsonError("user_id is required"), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{
+		Issuer:    tokenIssuer,
+		Subject:   req.UserID,
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(tokenTTL)),
+	}).SignedString(jwtSecret)
+	if err != nil {
+		http.Error(w, jsonError("failed to sign token"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"token":      token,
+		"expires_in": int(tokenTTL.Seconds()),
+	})
+}
+
+// meHandler returns the user the request's token was issued to
+func meHandler(w http.ResponseWriter, r *http.Request) {
+	user, _ := userFromContext(r.Context())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"user_id":    user.ID,
+		"session_id": user.SessionHash,
+	})
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	httpagent "github.com/last9/go-agent/integrations/http"
+)
+
+const slowMaxDelay = 30 * time.Second
+
+// upstreamClient calls /upstream. It has no Timeout of its own: the request's
+// deadline is what stops it.
+var upstreamClient = httpagent.NewClient(&http.Client{})
+
+// slowHandler does work that takes ?delay= (default 3s), either as a SQLite
+// query (?via=sql) or as a call to /upstream (?via=http). Under a shorter
+// route deadline, the query is interrupted and the call abandoned when the
+// deadline passes, and the client gets a 503 from the deadline middleware.
+func slowHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	delay, err := parseDelay(r, 3*time.Second)
+	if err != nil {
+		http.Error(w, jsonError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	switch via := r.URL.Query().Get("via"); via {
+	case "", "sql":
+		err = slowQuery(ctx, delay)
+	case "http":
+		err = slowCall(ctx, r.Host, delay)
+	default:
+		http.Error(w, jsonError("via must be sql or http"), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		// Leave the response to the deadline middleware
+		return
+	}
+	if err != nil {
+		http.Error(w, jsonError("slow call failed"), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"delay": delay.String()})
+}
+
+// slowQuery runs a query that counts in SQLite for roughly delay, depending
+// on the machine. The driver interrupts it when ctx is done.
+func slowQuery(ctx context.Context, delay time.Duration) error {
+	const rowsPerSecond = 3_000_000
+	var n int64
+	return db.QueryRowContext(ctx, `
+		WITH RECURSIVE spin(i) AS (
+			SELECT 0
+			UNION ALL
+			SELECT i + 1 FROM spin WHERE i < ?
+		)
+		SELECT max(i) FROM spin`, int64(delay.Seconds()*rowsPerSecond),
+	).Scan(&n)
+}
+
+// slowCall calls this server's /upstream, which takes delay to answer. The
+// request carries ctx, so the client gives up when ctx's deadline passes.
+func slowCall(ctx context.Context, host string, delay time.Duration) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		"http://"+host+"/upstream?delay="+delay.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := upstreamClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// upstreamHandler stands in for a slow dependency: it answers after ?delay=,
+// or stops early if the caller goes away.
+func upstreamHandler(w http.ResponseWriter, r *http.Request) {
+	delay, err := parseDelay(r, time.Second)
+	if err != nil {
+		http.Error(w, jsonError(err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	select {
+	case <-time.After(delay):
+	case <-r.Context().Done():
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"delay": delay.String()})
+}
+
+func parseDelay(r *http.Request, fallback time.Duration) (time.Duration, error) {
+	s := r.URL.Query().Get("delay")
+	if s == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		// Accept plain seconds too, as ?seconds= does on /events
+		secs, serr := strconv.ParseFloat(s, 64)
+		if serr != nil {
+			return 0, errors.New("delay must be a duration such as 2s")
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < 0 || d > slowMaxDelay {
+		return 0, errors.New("delay must be between 0 and 30s")
+	}
+	return d, nil
+}
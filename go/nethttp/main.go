@@ -7,6 +7,12 @@
 // 3. Using Handler() - for individual handler instrumentation
 // 4. Database integration with automatic query tracing
 // 5. HTTP client instrumentation with trace propagation
+// 6. Server-Sent Events streaming with a long-lived span
+// 7. Tenant attributes on every span from W3C baggage
+// 8. Request body size limits with 413 responses
+// 9. Request deadlines that reach database and HTTP calls
+// 10. Per-route saturation metrics from one middleware around the mux
+// 11. JWT authentication with the user on the span and failures as events
 package main
 
 import (
@@ -21,9 +27,17 @@ import (
 	"time"
 
 	"github.com/last9/go-agent"
+	"github.com/last9/go-agent/instrumentation/nethttp"
 	"github.com/last9/go-agent/integrations/database"
 	httpagent "github.com/last9/go-agent/integrations/http"
-	"github.com/last9/go-agent/instrumentation/nethttp"
+	"github.com/last9/opentelemetry-examples/go/common/baggageattr"
+	"github.com/last9/opentelemetry-examples/go/common/bodylimit"
+	"github.com/last9/opentelemetry-examples/go/common/deadline"
+	"github.com/last9/opentelemetry-examples/go/common/loadshed"
+	"github.com/last9/opentelemetry-examples/go/common/problem"
+	"github.com/last9/opentelemetry-examples/go/common/saturation"
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"go.opentelemetry.io/otel"
 
 	_ "github.com/mattn/go-sqlite3" // SQLite driver
 )
@@ -48,6 +62,18 @@ func main() {
 	}
 	defer agent.Shutdown()
 
+	// Copy tenant.id and user.plan from incoming baggage onto every span,
+	// including the database spans started by handlers
+	if err := baggageattr.Register(otel.GetTracerProvider()); err != nil {
+		log.Printf("Failed to register baggage span processor: %v", err)
+	}
+
+	// Tag the spans of integration test requests with test.run_id, so test
+	// traffic can be filtered out
+	if err := testrun.Register(otel.GetTracerProvider()); err != nil {
+		log.Printf("Failed to register test run span processor: %v", err)
+	}
+
 	// Initialize database with instrumentation
 	var err error
 	db, err = database.Open(database.Config{
@@ -69,19 +95,69 @@ func main() {
 	// Each handler automatically gets traced with the route pattern as span name
 	mux := nethttp.NewServeMux()
 
-	// Register handlers - each is automatically instrumented
-	mux.HandleFunc("/", homeHandler)
-	mux.HandleFunc("/health", healthHandler)
+	// Error responses become problem+json with the route span's trace ID,
+	// and every response gets traceresponse and Server-Timing headers. The
+	// spans are per route, so problem.Middleware wraps each route's handler
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, problem.Middleware(h))
+	}
 
-	// User CRUD with database
-	mux.HandleFunc("GET /users", listUsersHandler)
-	mux.HandleFunc("POST /users", createUserHandler)
-	mux.HandleFunc("GET /users/{id}", getUserHandler)
-	mux.HandleFunc("PUT /users/{id}", updateUserHandler)
-	mux.HandleFunc("DELETE /users/{id}", deleteUserHandler)
+	// Register handlers - each is automatically instrumented
+	handle("/", http.HandlerFunc(homeHandler))
+	handle("/health", http.HandlerFunc(healthHandler))
+
+	// Bodies over MAX_BODY_BYTES (default 1 MiB) get a 413. The limit runs
+	// inside the route's span, so rejections are recorded on it
+	maxBodyBytes := bodylimit.LimitFromEnv()
+	limitBody := bodylimit.Middleware(maxBodyBytes)
+
+	// Requests still running after REQUEST_TIMEOUT (default 5s) get a 503,
+	// and the timeout is recorded on the route's span. Handlers pass
+	// r.Context() on, so the deadline also stops their queries and calls
+	requestTimeout := deadline.TimeoutFromEnv("REQUEST_TIMEOUT", deadline.DefaultTimeout)
+	withDeadline := deadline.Middleware(requestTimeout)
+
+	// Requests are shed with a 503 while LOADSHED_MAX_IN_FLIGHT (default
+	// 64) are in flight, or, in a growing share, while the p99 latency is
+	// over LOADSHED_TARGET_P99 (default 1s). One shedder covers the users
+	// routes and /joke, which share the server; /slow, /upstream and
+	// /events are slow on purpose and would shed the others
+	shedderCfg := loadshed.ConfigFromEnv()
+	shed := loadshed.New(shedderCfg).Middleware
+
+	// User CRUD with database. Writes need a bearer token: requireAuth puts
+	// its user on the route's span as enduser.id, and rejects the others
+	// with a 401 and an auth.failure span event
+	handle("GET /users", shed(withDeadline(http.HandlerFunc(listUsersHandler))))
+	handle("POST /users", shed(withDeadline(requireAuth(limitBody(http.HandlerFunc(createUserHandler))))))
+	handle("GET /users/{id}", shed(withDeadline(http.HandlerFunc(getUserHandler))))
+	handle("PUT /users/{id}", shed(withDeadline(requireAuth(limitBody(http.HandlerFunc(updateUserHandler))))))
+	handle("DELETE /users/{id}", shed(withDeadline(requireAuth(http.HandlerFunc(deleteUserHandler)))))
+	handle("GET /me", requireAuth(http.HandlerFunc(meHandler)))
+	// Without JWT_SECRET, tokens are signed with a random secret, and
+	// issued here
+	if issueTokens {
+		handle("POST /token", limitBody(http.HandlerFunc(tokenHandler)))
+	}
 
 	// External API call example
-	mux.HandleFunc("/joke", jokeHandler)
+	handle("/joke", shed(withDeadline(http.HandlerFunc(jokeHandler))))
+
+	// A route with its own, shorter deadline (SLOW_ROUTE_TIMEOUT, default
+	// 1s) and a dependency that is slower than that
+	slowTimeout := deadline.TimeoutFromEnv("SLOW_ROUTE_TIMEOUT", time.Second)
+	handle("GET /slow", deadline.Middleware(slowTimeout)(http.HandlerFunc(slowHandler)))
+	handle("GET /upstream", http.HandlerFunc(upstreamHandler))
+
+	// Server-Sent Events: one long-lived span per stream
+	handle("GET /events", http.HandlerFunc(sseHandler))
+
+	// Saturation metrics for every route: in-flight requests, queue time
+	// for one of MAX_CONCURRENT_REQUESTS workers, worker utilization and GC
+	// pauses. It wraps the whole mux, outside the route spans, so queue time
+	// isn't counted as handler latency
+	saturationCfg := saturation.ConfigFromEnv()
+	handler := saturation.Middleware(saturationCfg, saturation.ServeMuxRoute(mux))(mux)
 
 	log.Println("Starting server on http://localhost:8080")
 	log.Println("")
@@ -94,10 +170,21 @@ func main() {
 	log.Println("  PUT    http://localhost:8080/users/1        - Update user (DB update)")
 	log.Println("  DELETE http://localhost:8080/users/1        - Delete user (DB delete)")
 	log.Println("  GET    http://localhost:8080/joke           - External API call")
+	log.Println("  GET    http://localhost:8080/events         - Server-Sent Events stream (?seconds=N)")
+	log.Println("  GET    http://localhost:8080/slow?via=sql   - Query slower than the route deadline (?delay=, via=http)")
+	log.Println("  GET    http://localhost:8080/me             - The token's user (Authorization: Bearer <token>)")
+	if issueTokens {
+		log.Println("  POST   http://localhost:8080/token          - Issue a token for {\"user_id\": \"...\"}")
+	}
+	log.Println("")
+	log.Printf("Request bodies over %d bytes are rejected with 413 (MAX_BODY_BYTES)", maxBodyBytes)
+	log.Printf("Requests time out after %s (REQUEST_TIMEOUT), /slow after %s (SLOW_ROUTE_TIMEOUT)", requestTimeout, slowTimeout)
+	log.Printf("Requests are shed over %d in flight (LOADSHED_MAX_IN_FLIGHT), or while the p99 is over %s (LOADSHED_TARGET_P99)", shedderCfg.MaxInFlight, shedderCfg.TargetP99)
+	log.Printf("At most %d requests are served at once (MAX_CONCURRENT_REQUESTS); others queue for up to %s (QUEUE_TIMEOUT)", saturationCfg.Workers, saturationCfg.QueueTimeout)
 	log.Println("")
 
 	// Start the server
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	if err := http.ListenAndServe(":8080", handler); err != nil {
 		log.Fatalf("Server failed: %v", err)
 	}
 }
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	sseDefaultSeconds = 10
+	sseMaxSeconds     = 60
+	sseInterval       = time.Second
+)
+
+// SSE metrics. The counters are created once; the global meter provider set
+// by agent.Start is used.
+var (
+	sseBytesStreamed  metric.Int64Counter
+	sseEventsStreamed metric.Int64Counter
+)
+
+func init() {
+	meter := otel.Meter("nethttp_example/sse")
+
+	var err error
+	sseBytesStreamed, err = meter.Int64Counter("sse.streamed.bytes",
+		metric.WithDescription("Bytes written to Server-Sent Events streams"),
+		metric.WithUnit("By"))
+	if err != nil {
+		log.Fatalf("failed to create sse.streamed.bytes counter: %v", err)
+	}
+	sseEventsStreamed, err = meter.Int64Counter("sse.streamed.events",
+		metric.WithDescription("Events written to Server-Sent Events streams"),
+		metric.WithUnit("{event}"))
+	if err != nil {
+		log.Fatalf("failed to create sse.streamed.events counter: %v", err)
+	}
+}
+
+// sseHandler streams one event per second for ?seconds=N (default 10).
+//
+// The whole stream is a single server span that stays open until the last
+// event is flushed or the client goes away. Each flushed event is recorded as
+// a span event rather than a child span, so a long stream doesn't produce
+// hundreds of tiny spans, and the span's duration is the stream's duration.
+func sseHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	span := trace.SpanFromContext(ctx)
+
+	seconds := sseDefaultSeconds
+	if s := r.URL.Query().Get("seconds"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > sseMaxSeconds {
+			http.Error(w, jsonError(fmt.Sprintf("seconds must be between 1 and %d", sseMaxSeconds)), http.StatusBadRequest)
+			return
+		}
+		seconds = n
+	}
+
+	// ResponseController unwraps the instrumented ResponseWriter to reach
+	// the underlying http.Flusher.
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	span.SetAttributes(
+		attribute.Int("sse.requested_seconds", seconds),
+		attribute.String("sse.interval", sseInterval.String()),
+	)
+
+	metricAttrs := metric.WithAttributes(attribute.String("http.route", "/events"))
+	ticker := time.NewTicker(sseInterval)
+	defer ticker.Stop()
+
+	var totalBytes, sent int
+	defer func() {
+		span.SetAttributes(
+			attribute.Int("sse.events_sent", sent),
+			attribute.Int("sse.bytes_sent", totalBytes),
+		)
+	}()
+
+	for sent < seconds {
+		select {
+		case <-ctx.Done():
+			// The client disconnected; this is normal for SSE, not an error.
+			span.AddEvent("sse.client_disconnected", trace.WithAttributes(
+				attribute.Int("sse.events_sent", sent),
+			))
+			return
+		case t := <-ticker.C:
+			sent++
+			payload := fmt.Sprintf("id: %d\nevent: tick\ndata: {\"seq\":%d,\"time\":%q}\n\n",
+				sent, sent, t.UTC().Format(time.RFC3339))
+
+			n, err := fmt.Fprint(w, payload)
+			if err == nil {
+				err = rc.Flush()
+			}
+			if err != nil {
+				span.RecordError(err)
+				span.SetStatus(codes.Error, "failed to write SSE event")
+				return
+			}
+
+			totalBytes += n
+			sseBytesStreamed.Add(ctx, int64(n), metricAttrs)
+			sseEventsStreamed.Add(ctx, 1, metricAttrs)
+			span.AddEvent("sse.event.flushed", trace.WithAttributes(
+				attribute.Int("sse.event.id", sent),
+				attribute.Int("sse.event.bytes", n),
+			))
+		}
+	}
+
+	span.AddEvent("sse.stream_completed")
+}
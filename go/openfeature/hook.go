@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/telemetry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// traceHook adds a feature_flag.evaluation event to the span in the
+// evaluation's context for every flag evaluation, with the attributes of the
+// OpenTelemetry feature flag semantic conventions: feature_flag.key,
+// feature_flag.result.variant (or feature_flag.result.value for a flag
+// without variants), feature_flag.result.reason, feature_flag.provider.name
+// and feature_flag.context.id, plus error.type and error.message when the
+// evaluation failed and the default was used.
+//
+// The event is built by the SDK's telemetry package, so it follows the
+// conventions the SDK version implements. Evaluations without a recording
+// span, such as the sampler's, add nothing.
+type traceHook struct {
+	openfeature.UnimplementedHook
+}
+
+// Finally runs after every evaluation, successful or not.
+func (traceHook) Finally(ctx context.Context, hookContext openfeature.HookContext, details openfeature.InterfaceEvaluationDetails, _ openfeature.HookHints) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+	event := telemetry.CreateEvaluationEvent(hookContext, details)
+	attrs := make([]attribute.KeyValue, 0, len(event.Attributes))
+	for key, value := range event.Attributes {
+		attrs = append(attrs, toAttribute(key, value))
+	}
+	span.AddEvent(event.Name, trace.WithAttributes(attrs...))
+}
+
+func toAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
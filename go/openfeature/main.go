@@ -0,0 +1,263 @@
+// Service whose tracing is controlled by feature flags through OpenFeature:
+// one flag turns on verbose span attributes, another sets the trace sampling
+// ratio at runtime, and every flag evaluation is recorded on the request's
+// span as a feature_flag.evaluation event.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Flag keys, defined in flags.json.
+const (
+	flagVerbose     = "verbose-span-attributes"
+	flagSampleRatio = "trace-sample-ratio"
+	flagStrategy    = "recommendation-strategy"
+)
+
+// flagReloadInterval is how often the flag file is checked for changes.
+const flagReloadInterval = 2 * time.Second
+
+var tracer = otel.Tracer("openfeature-example")
+
+func main() {
+	ctx := context.Background()
+
+	sampler := newFlagSampler(1)
+	tp, err := initTracerProvider(ctx, sdktrace.ParentBased(sampler))
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	// Every evaluation, by any client, adds an event to the current span
+	openfeature.AddHooks(traceHook{})
+	flags := openfeature.NewClient("openfeature-example")
+
+	// The sampler takes its ratio from the flag when the provider is ready,
+	// and again whenever the flag changes
+	updateSampling := func(openfeature.EventDetails) {
+		ratio, err := flags.FloatValue(context.Background(), flagSampleRatio, 1, openfeature.EvaluationContext{})
+		if err != nil {
+			log.Printf("%s: %v; sampling every trace", flagSampleRatio, err)
+		}
+		sampler.SetRatio(ratio)
+		log.Printf("sampling %s", sampler.Description())
+	}
+	onChange := func(details openfeature.EventDetails) {
+		if slices.Contains(details.FlagChanges, flagSampleRatio) {
+			updateSampling(details)
+		}
+	}
+	logError := func(details openfeature.EventDetails) {
+		log.Printf("flag provider %s: %s", details.ProviderName, details.Message)
+	}
+	openfeature.AddHandler(openfeature.ProviderReady, &updateSampling)
+	openfeature.AddHandler(openfeature.ProviderConfigChange, &onChange)
+	openfeature.AddHandler(openfeature.ProviderError, &logError)
+
+	flagsFile := envOr("FLAGS_FILE", "flags.json")
+	if err := openfeature.SetProviderAndWait(newFileProvider(flagsFile, flagReloadInterval)); err != nil {
+		log.Fatalf("failed to load flags from %s: %v", flagsFile, err)
+	}
+	defer openfeature.Shutdown()
+
+	mux := http.NewServeMux()
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, withFlags(flags, h))
+	}
+	handle("GET /recommendations", recommendationsHandler(flags))
+	handle("GET /flags", flagsHandler(flags, sampler))
+
+	addr := ":" + envOr("PORT", "8080")
+	// otelhttp names the span after the handler returns, once the mux has
+	// set the request's pattern
+	handler := otelhttp.NewHandler(mux, "openfeature-example",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return operation
+		}))
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		log.Printf("listening on %s, flags from %s", addr, flagsFile)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+}
+
+type verboseKey struct{}
+
+// withFlags sets the server span's http.route, and evaluates the
+// verbose-span-attributes flag for the request's user, from X-User-ID. When
+// it is on, the span gets the request's details, and handlers add their own;
+// isVerbose tells them.
+func withFlags(flags *openfeature.Client, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+
+		verbose, _ := flags.BooleanValue(ctx, flagVerbose, false, evaluationContext(r))
+		if verbose {
+			span.SetAttributes(
+				semconv.EnduserID(userID(r)),
+				semconv.UserAgentOriginal(r.UserAgent()),
+				semconv.URLQuery(r.URL.RawQuery),
+				semconv.ClientAddress(r.RemoteAddr),
+			)
+			ctx = context.WithValue(ctx, verboseKey{}, true)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func isVerbose(ctx context.Context) bool {
+	v, _ := ctx.Value(verboseKey{}).(bool)
+	return v
+}
+
+// evaluationContext is the OpenFeature evaluation context of a request. The
+// targeting key is the user, so a provider with targeting rules, such as
+// flagd, can turn a flag on for some users only.
+func evaluationContext(r *http.Request) openfeature.EvaluationContext {
+	return openfeature.NewEvaluationContext(userID(r), map[string]any{
+		"http.route": r.Pattern,
+	})
+}
+
+func userID(r *http.Request) string {
+	if id := r.Header.Get("X-User-ID"); id != "" {
+		return id
+	}
+	return "anonymous"
+}
+
+var catalog = []string{"keyboard", "monitor", "headphones", "webcam", "desk lamp", "usb hub"}
+
+// recommendationsHandler picks products with the strategy the
+// recommendation-strategy flag chooses for the user.
+func recommendationsHandler(flags *openfeature.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		strategy, _ := flags.StringValue(ctx, flagStrategy, "popular", evaluationContext(r))
+
+		ctx, span := tracer.Start(ctx, "recommendations.compute",
+			trace.WithAttributes(attribute.String("recommendation.strategy", strategy)))
+		items := slices.Clone(catalog[:3])
+		if strategy == "personalized" {
+			// A model call, in a real service
+			time.Sleep(30 * time.Millisecond)
+			items = []string{catalog[3], catalog[5], catalog[0]}
+		}
+		span.SetAttributes(attribute.Int("recommendation.count", len(items)))
+		if isVerbose(ctx) {
+			span.SetAttributes(attribute.StringSlice("recommendation.items", items))
+		}
+		span.End()
+
+		writeJSON(w, map[string]any{"strategy": strategy, "items": items})
+	}
+}
+
+// flagsHandler shows the flags as the request's user gets them, and the
+// sampler in effect.
+func flagsHandler(flags *openfeature.Client, sampler *flagSampler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		evalCtx := evaluationContext(r)
+		verbose, _ := flags.BooleanValueDetails(ctx, flagVerbose, false, evalCtx)
+		strategy, _ := flags.StringValueDetails(ctx, flagStrategy, "popular", evalCtx)
+		ratio, _ := flags.FloatValueDetails(ctx, flagSampleRatio, 1, evalCtx)
+		writeJSON(w, map[string]any{
+			"user":    userID(r),
+			"sampler": sampler.Description(),
+			"flags": map[string]any{
+				flagVerbose:     map[string]any{"value": verbose.Value, "variant": verbose.Variant, "reason": verbose.Reason},
+				flagStrategy:    map[string]any{"value": strategy.Value, "variant": strategy.Variant, "reason": strategy.Reason},
+				flagSampleRatio: map[string]any{"value": ratio.Value, "variant": ratio.Variant, "reason": ratio.Reason},
+			},
+		})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func initTracerProvider(ctx context.Context, sampler sdktrace.Sampler) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(envOr("OTEL_SERVICE_NAME", "openfeature-example")),
+			semconv.DeploymentEnvironment(envOr("DEPLOYMENT_ENVIRONMENT", "local")),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/open-feature/go-sdk/openfeature"
+	"github.com/open-feature/go-sdk/openfeature/memprovider"
+)
+
+// flagFile is a flag definition file in flagd's format, so the same file can
+// be served by flagd in production. Targeting rules aren't supported here:
+// every evaluation gets the default variant.
+type flagFile struct {
+	Flags map[string]flagDefinition `json:"flags"`
+}
+
+type flagDefinition struct {
+	State          string         `json:"state"`
+	Variants       map[string]any `json:"variants"`
+	DefaultVariant string         `json:"defaultVariant"`
+}
+
+// fileProvider is an OpenFeature provider that serves the flags in a file,
+// and reloads them when the file changes. After a reload that changed flags
+// it emits PROVIDER_CONFIGURATION_CHANGED, naming them; a file that fails to
+// parse emits PROVIDER_ERROR, and the previous flags stay in effect.
+type fileProvider struct {
+	path     string
+	interval time.Duration
+
+	mu      sync.RWMutex
+	flags   memprovider.InMemoryProvider
+	defs    map[string]flagDefinition
+	modTime time.Time
+
+	events chan openfeature.Event
+	stop   chan struct{}
+}
+
+func newFileProvider(path string, interval time.Duration) *fileProvider {
+	return &fileProvider{
+		path:     path,
+		interval: interval,
+		flags:    memprovider.NewInMemoryProvider(nil),
+		events:   make(chan openfeature.Event, 1),
+		stop:     make(chan struct{}),
+	}
+}
+
+func (p *fileProvider) Metadata() openfeature.Metadata {
+	return openfeature.Metadata{Name: "file"}
+}
+
+// Init loads the file and starts watching it. The SDK calls it when the
+// provider is set.
+func (p *fileProvider) Init(openfeature.EvaluationContext) error {
+	if _, err := p.load(); err != nil {
+		return err
+	}
+	go p.watch()
+	return nil
+}
+
+func (p *fileProvider) Shutdown() {
+	close(p.stop)
+}
+
+func (p *fileProvider) EventChannel() <-chan openfeature.Event {
+	return p.events
+}
+
+func (p *fileProvider) Hooks() []openfeature.Hook {
+	return nil
+}
+
+func (p *fileProvider) current() memprovider.InMemoryProvider {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.flags
+}
+
+func (p *fileProvider) BooleanEvaluation(ctx context.Context, flag string, defaultValue bool, flatCtx openfeature.FlattenedContext) openfeature.BoolResolutionDetail {
+	return p.current().BooleanEvaluation(ctx, flag, defaultValue, flatCtx)
+}
+
+func (p *fileProvider) StringEvaluation(ctx context.Context, flag string, defaultValue string, flatCtx openfeature.FlattenedContext) openfeature.StringResolutionDetail {
+	return p.current().StringEvaluation(ctx, flag, defaultValue, flatCtx)
+}
+
+// FloatEvaluation serves float flags. JSON numbers are floats, so use it for
+// every numeric flag; IntEvaluation reports a type mismatch.
+func (p *fileProvider) FloatEvaluation(ctx context.Context, flag string, defaultValue float64, flatCtx openfeature.FlattenedContext) openfeature.FloatResolutionDetail {
+	return p.current().FloatEvaluation(ctx, flag, defaultValue, flatCtx)
+}
+
+func (p *fileProvider) IntEvaluation(ctx context.Context, flag string, defaultValue int64, flatCtx openfeature.FlattenedContext) openfeature.IntResolutionDetail {
+	return p.current().IntEvaluation(ctx, flag, defaultValue, flatCtx)
+}
+
+func (p *fileProvider) ObjectEvaluation(ctx context.Context, flag string, defaultValue any, flatCtx openfeature.FlattenedContext) openfeature.InterfaceResolutionDetail {
+	return p.current().ObjectEvaluation(ctx, flag, defaultValue, flatCtx)
+}
+
+// watch reloads the file when its modification time changes, every
+// interval until Shutdown.
+func (p *fileProvider) watch() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	// failed reports an error once, not on every tick until it is fixed
+	var lastErr string
+	failed := func(err error) {
+		if err.Error() != lastErr {
+			lastErr = err.Error()
+			p.emit(openfeature.ProviderError, lastErr, nil)
+		}
+	}
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(p.path)
+		if err != nil {
+			failed(err)
+			continue
+		}
+		p.mu.RLock()
+		unchanged := info.ModTime().Equal(p.modTime)
+		p.mu.RUnlock()
+		if unchanged {
+			continue
+		}
+		changed, err := p.load()
+		if err != nil {
+			failed(err)
+			continue
+		}
+		lastErr = ""
+		if len(changed) > 0 {
+			p.emit(openfeature.ProviderConfigChange, "flags reloaded from "+p.path, changed)
+		}
+	}
+}
+
+// load reads the file and swaps in its flags. It returns the keys of the
+// flags that were added, removed or changed.
+func (p *fileProvider) load() ([]string, error) {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return nil, err
+	}
+	var file flagFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", p.path, err)
+	}
+
+	flags := make(map[string]memprovider.InMemoryFlag, len(file.Flags))
+	for key, def := range file.Flags {
+		if _, ok := def.Variants[def.DefaultVariant]; !ok {
+			return nil, fmt.Errorf("parse %s: flag %q: default variant %q isn't one of its variants", p.path, key, def.DefaultVariant)
+		}
+		state := memprovider.Enabled
+		if def.State == string(memprovider.Disabled) {
+			state = memprovider.Disabled
+		}
+		flags[key] = memprovider.InMemoryFlag{
+			Key:            key,
+			State:          state,
+			DefaultVariant: def.DefaultVariant,
+			Variants:       def.Variants,
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var changed []string
+	for key, def := range file.Flags {
+		if prev, ok := p.defs[key]; !ok || !reflect.DeepEqual(prev, def) {
+			changed = append(changed, key)
+		}
+	}
+	for key := range p.defs {
+		if _, ok := file.Flags[key]; !ok {
+			changed = append(changed, key)
+		}
+	}
+	sort.Strings(changed)
+	p.flags = memprovider.NewInMemoryProvider(flags)
+	p.defs = file.Flags
+	p.modTime = info.ModTime()
+	return changed, nil
+}
+
+// emit sends an event. The SDK reads the channel from when the provider is
+// set, so it waits only until then, or until Shutdown.
+func (p *fileProvider) emit(typ openfeature.EventType, message string, changed []string) {
+	event := openfeature.Event{
+		ProviderName: p.Metadata().Name,
+		EventType:    typ,
+		ProviderEventDetails: openfeature.ProviderEventDetails{
+			Message:     message,
+			FlagChanges: changed,
+		},
+	}
+	select {
+	case p.events <- event:
+	case <-p.stop:
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// flagSampler samples root spans at a ratio that can change at runtime. The
+// ratio comes from the trace-sample-ratio flag: main sets it when the
+// provider is ready and again whenever the flag changes, rather than
+// evaluating the flag for every span.
+//
+// Wrap it in sdktrace.ParentBased, so a trace is kept or dropped as a whole
+// and a change only affects traces that start after it.
+type flagSampler struct {
+	sampler atomic.Pointer[sdktrace.Sampler]
+}
+
+func newFlagSampler(ratio float64) *flagSampler {
+	s := &flagSampler{}
+	s.SetRatio(ratio)
+	return s
+}
+
+// SetRatio makes the sampler keep ratio of new traces, clamped to [0, 1].
+func (s *flagSampler) SetRatio(ratio float64) {
+	ratio = min(max(ratio, 0), 1)
+	sampler := sdktrace.TraceIDRatioBased(ratio)
+	s.sampler.Store(&sampler)
+}
+
+func (s *flagSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	return (*s.sampler.Load()).ShouldSample(p)
+}
+
+func (s *flagSampler) Description() string {
+	return fmt.Sprintf("FlagSampler{%s}", (*s.sampler.Load()).Description())
+}
@@ -0,0 +1,302 @@
+// Package main is a net/http service meant to run under the OpenTelemetry
+// Operator's Go auto-instrumentation, which traces it from an eBPF sidecar,
+// while adding business spans of its own through the OpenTelemetry API.
+//
+// The sidecar starts the server spans, and the client spans of outgoing
+// requests. The app must not start them too, or every request would have two
+// server spans. So under the operator (AUTO_INSTRUMENTATION=ebpf) the app:
+//
+//   - doesn't wrap its handlers or client with otelhttp,
+//   - doesn't install an SDK TracerProvider. Spans started through the
+//     global API are then picked up by the sidecar and exported with its
+//     resource, as children of its server span.
+//
+// Run anywhere else, with no sidecar, it installs an SDK and otelhttp itself,
+// so the same code produces the same trace.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer starts the business spans. It is resolved through the global
+// TracerProvider on every call, so it works with or without an SDK.
+var tracer = otel.Tracer("github.com/last9/opentelemetry-examples/go/otel-operator-hybrid")
+
+// autoInstrumented reports whether the operator's eBPF sidecar traces this
+// process. The deployment sets AUTO_INSTRUMENTATION=ebpf next to the
+// inject-go annotation.
+func autoInstrumented() bool {
+	return os.Getenv("AUTO_INSTRUMENTATION") == "ebpf"
+}
+
+// initTracer installs an SDK TracerProvider for runs without the sidecar.
+// Under the sidecar it does nothing: an SDK would take the business spans
+// away from the sidecar, and export them in a trace of their own.
+func initTracer(ctx context.Context) (func(context.Context) error, error) {
+	if autoInstrumented() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+	// resource.Default reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES,
+	// the same variables the operator sets on the sidecar
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.Default()),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	return tp.Shutdown, nil
+}
+
+// instrument wraps h in otelhttp for runs without the sidecar, which
+// otherwise starts the server span itself.
+func instrument(h http.Handler, route string) http.Handler {
+	if autoInstrumented() {
+		return h
+	}
+	return otelhttp.NewHandler(h, route)
+}
+
+// newClient returns the client for calls to the pricing service. Under the
+// sidecar, a plain client is traced and gets traceparent injected by it.
+func newClient() *http.Client {
+	if autoInstrumented() {
+		return &http.Client{Timeout: 5 * time.Second}
+	}
+	return &http.Client{Timeout: 5 * time.Second, Transport: otelhttp.NewTransport(http.DefaultTransport)}
+}
+
+// inventory is the stock of each SKU.
+type inventory struct {
+	mu    sync.Mutex
+	stock map[string]int
+}
+
+var (
+	errUnknownSKU   = errors.New("unknown sku")
+	errOutOfStock   = errors.New("out of stock")
+	errInvalidOrder = errors.New("quantity must be positive")
+)
+
+func (inv *inventory) reserve(ctx context.Context, sku string, qty int) error {
+	_, span := tracer.Start(ctx, "inventory.reserve", trace.WithAttributes(
+		attribute.String("order.sku", sku),
+		attribute.Int("order.quantity", qty),
+	))
+	defer span.End()
+
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+	left, ok := inv.stock[sku]
+	if !ok {
+		return fail(span, errUnknownSKU)
+	}
+	if left < qty {
+		span.SetAttributes(attribute.Int("inventory.available", left))
+		return fail(span, errOutOfStock)
+	}
+	inv.stock[sku] = left - qty
+	span.SetAttributes(attribute.Int("inventory.available", left-qty))
+	return nil
+}
+
+// fail records err on span and returns it.
+func fail(span trace.Span, err error) error {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	return err
+}
+
+type server struct {
+	inv        *inventory
+	client     *http.Client
+	pricingURL string
+}
+
+// checkout places an order. Its spans, order.checkout and the ones under it,
+// are the app's own; the server span around them and the client span of the
+// pricing call come from the sidecar.
+func (s *server) checkout(w http.ResponseWriter, r *http.Request) {
+	var in struct {
+		SKU      string `json:"sku"`
+		Quantity int    `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid JSON"})
+		return
+	}
+
+	// r.Context() carries the server span, so order.checkout is its child
+	ctx, span := tracer.Start(r.Context(), "order.checkout", trace.WithAttributes(
+		attribute.String("order.sku", in.SKU),
+		attribute.Int("order.quantity", in.Quantity),
+	))
+	defer span.End()
+
+	if in.Quantity <= 0 {
+		fail(span, errInvalidOrder)
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": errInvalidOrder.Error()})
+		return
+	}
+
+	price, err := s.price(ctx, in.SKU)
+	if err != nil {
+		fail(span, err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": "pricing unavailable"})
+		return
+	}
+
+	if err := s.inv.reserve(ctx, in.SKU, in.Quantity); err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		status := http.StatusConflict
+		if errors.Is(err, errUnknownSKU) {
+			status = http.StatusNotFound
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	total := price * float64(in.Quantity)
+	span.SetAttributes(attribute.Float64("order.total", total))
+	writeJSON(w, http.StatusCreated, map[string]any{
+		"sku":      in.SKU,
+		"quantity": in.Quantity,
+		"total":    total,
+	})
+}
+
+// price asks the pricing service for the unit price of sku. The request must
+// carry ctx: that is how the client span, from the sidecar or otelhttp, finds
+// its parent.
+func (s *server) price(ctx context.Context, sku string) (float64, error) {
+	ctx, span := tracer.Start(ctx, "pricing.lookup", trace.WithAttributes(attribute.String("order.sku", sku)))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.pricingURL+"?sku="+sku, nil)
+	if err != nil {
+		return 0, fail(span, err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, fail(span, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fail(span, fmt.Errorf("pricing: %s", resp.Status))
+	}
+
+	var body struct {
+		Price float64 `json:"price"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fail(span, fmt.Errorf("decode price: %w", err))
+	}
+	span.SetAttributes(attribute.Float64("order.unit_price", body.Price))
+	return body.Price, nil
+}
+
+// prices stands in for a pricing service. It is served by this process, so
+// the call to it is a real outgoing request.
+var prices = map[string]float64{"sku-1": 19.99, "sku-2": 5.25, "sku-3": 120}
+
+func pricing(w http.ResponseWriter, r *http.Request) {
+	// Unknown SKUs are priced at 0, and rejected by the inventory
+	price := prices[r.URL.Query().Get("sku")]
+	writeJSON(w, http.StatusOK, map[string]float64{"price": price})
+}
+
+func health(w http.ResponseWriter, _ *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte("ok"))
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	shutdown, err := initTracer(ctx)
+	if err != nil {
+		log.Fatalf("init tracer: %v", err)
+	}
+	defer func() {
+		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelShutdown()
+		if err := shutdown(shutdownCtx); err != nil {
+			log.Printf("tracer shutdown: %v", err)
+		}
+	}()
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	pricingURL := os.Getenv("PRICING_URL")
+	if pricingURL == "" {
+		pricingURL = "http://localhost:" + port + "/pricing"
+	}
+
+	s := &server{
+		inv:        &inventory{stock: map[string]int{"sku-1": 10, "sku-2": 100, "sku-3": 2}},
+		client:     newClient(),
+		pricingURL: pricingURL,
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /checkout", instrument(http.HandlerFunc(s.checkout), "POST /checkout"))
+	mux.Handle("GET /pricing", instrument(http.HandlerFunc(pricing), "GET /pricing"))
+	// Probes are left untraced
+	mux.HandleFunc("GET /health", health)
+
+	srv := &http.Server{
+		Addr:              ":" + port,
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		log.Printf("listening on :%s (auto-instrumented: %t)", port, autoInstrumented())
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+}
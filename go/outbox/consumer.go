@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// amqpHeadersCarrier implements TextMapCarrier for RabbitMQ headers
+type amqpHeadersCarrier amqp.Table
+
+func (c amqpHeadersCarrier) Get(key string) string {
+	if value, ok := c[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func (c amqpHeadersCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c amqpHeadersCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// consumer handles the published events. The relay delivers at least once,
+// so the consumer records each event ID in processed_events, in the same
+// transaction as its work, and skips IDs it has seen.
+type consumer struct {
+	db     *sql.DB
+	ch     *amqp.Channel
+	queue  string
+	tracer trace.Tracer
+}
+
+func newConsumer(db *sql.DB, ch *amqp.Channel, queue string) *consumer {
+	return &consumer{db: db, ch: ch, queue: queue, tracer: otel.Tracer(tracerName)}
+}
+
+// run consumes until ctx is canceled or the channel closes.
+func (c *consumer) run(ctx context.Context) error {
+	deliveries, err := c.ch.ConsumeWithContext(ctx,
+		c.queue,           // queue
+		"outbox-consumer", // consumer
+		false,             // auto-ack
+		false,             // exclusive
+		false,             // no-local
+		false,             // no-wait
+		nil,               // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to consume %s: %v", c.queue, err)
+	}
+	for d := range deliveries {
+		c.handle(ctx, d)
+	}
+	return nil
+}
+
+// handle processes one delivery under a consumer span, a child of the
+// relay's publish span.
+func (c *consumer) handle(ctx context.Context, d amqp.Delivery) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, amqpHeadersCarrier(d.Headers))
+	ctx, span := c.tracer.Start(ctx, "process "+c.queue,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", c.queue),
+			attribute.String("messaging.message.id", d.MessageId),
+			attribute.Bool("messaging.rabbitmq.redelivered", d.Redelivered),
+			attribute.String("outbox.event.type", d.Type),
+		))
+	defer span.End()
+
+	duplicate, err := c.apply(ctx, d)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("failed to process event %s: %v", d.MessageId, err)
+		// Retry once, then drop, so a poison message can't loop forever
+		requeue := !d.Redelivered
+		span.SetAttributes(attribute.Bool("messaging.rabbitmq.requeue", requeue))
+		if err := d.Nack(false, requeue); err != nil {
+			span.RecordError(err)
+		}
+		return
+	}
+	span.SetAttributes(attribute.Bool("outbox.event.duplicate", duplicate))
+	if err := d.Ack(false); err != nil {
+		span.RecordError(err)
+	}
+}
+
+// apply records the event and does its work in one transaction. It reports
+// duplicate for an event that was already processed.
+func (c *consumer) apply(ctx context.Context, d amqp.Delivery) (duplicate bool, err error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.ExecContext(ctx,
+		"INSERT INTO processed_events (event_id) VALUES ($1) ON CONFLICT DO NOTHING", d.MessageId)
+	if err != nil {
+		return false, fmt.Errorf("failed to record event: %v", err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return false, err
+	} else if n == 0 {
+		return true, nil
+	}
+
+	switch d.Type {
+	case "user.created":
+		var user User
+		if err := json.Unmarshal(d.Body, &user); err != nil {
+			return false, fmt.Errorf("failed to decode user: %v", err)
+		}
+		log.Printf("Sending welcome email to %s <%s>", user.Name, user.Email)
+	default:
+		log.Printf("Ignoring event %s of type %q", d.MessageId, d.Type)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit: %v", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type outboxEvent struct {
+	id           int64
+	eventID      string
+	eventType    string
+	payload      []byte
+	traceContext propagation.MapCarrier
+	createdAt    time.Time
+}
+
+// relay publishes outbox events to RabbitMQ. Each event is published with
+// publisher confirms and marked published in the transaction that locked
+// it, so an event is delivered at least once: if the commit fails after the
+// broker confirmed, it is published again and the consumer drops the
+// duplicate.
+type relay struct {
+	db        *sql.DB
+	ch        *amqp.Channel
+	queue     string
+	interval  time.Duration
+	batchSize int
+	tracer    trace.Tracer
+}
+
+// newRelay puts ch in confirm mode; the channel must not be shared.
+func newRelay(db *sql.DB, ch *amqp.Channel, queue string, interval time.Duration, batchSize int) (*relay, error) {
+	if err := ch.Confirm(false); err != nil {
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	return &relay{
+		db:        db,
+		ch:        ch,
+		queue:     queue,
+		interval:  interval,
+		batchSize: batchSize,
+		tracer:    otel.Tracer(tracerName),
+	}, nil
+}
+
+// run polls the outbox until ctx is canceled. A full batch is followed by
+// another poll right away, so a backlog drains without waiting for the
+// ticker.
+func (r *relay) run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for {
+			n, err := r.relayBatch(ctx)
+			if err != nil && ctx.Err() == nil {
+				log.Printf("outbox relay: %v", err)
+			}
+			if err != nil || n < r.batchSize {
+				break
+			}
+		}
+	}
+}
+
+// relayBatch publishes up to batchSize events in order. FOR UPDATE SKIP
+// LOCKED lets several relays run side by side without publishing the same
+// event twice. A failed publish stops the batch, so later events aren't
+// published ahead of it.
+func (r *relay) relayBatch(ctx context.Context) (int, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	events, err := r.lockPending(ctx, tx)
+	if err != nil || len(events) == 0 {
+		return 0, err
+	}
+
+	published := 0
+	var publishErr error
+	for _, ev := range events {
+		if publishErr = r.publish(ctx, tx, ev); publishErr != nil {
+			break
+		}
+		published++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return published, fmt.Errorf("failed to commit: %v", err)
+	}
+	return published, publishErr
+}
+
+func (r *relay) lockPending(ctx context.Context, tx *sql.Tx) ([]outboxEvent, error) {
+	rows, err := tx.QueryContext(ctx,
+		`SELECT id, event_id, event_type, payload, trace_context, created_at
+		FROM outbox WHERE published_at IS NULL
+		ORDER BY id LIMIT $1 FOR UPDATE SKIP LOCKED`, r.batchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query outbox: %v", err)
+	}
+	defer rows.Close()
+
+	var events []outboxEvent
+	for rows.Next() {
+		var ev outboxEvent
+		var traceContext []byte
+		if err := rows.Scan(&ev.id, &ev.eventID, &ev.eventType, &ev.payload, &traceContext, &ev.createdAt); err != nil {
+			return nil, fmt.Errorf("failed to scan outbox event: %v", err)
+		}
+		if err := json.Unmarshal(traceContext, &ev.traceContext); err != nil {
+			return nil, fmt.Errorf("failed to decode trace context of event %s: %v", ev.eventID, err)
+		}
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// publish sends one event under a producer span. The span starts a new
+// trace, linked to the span that wrote the event: the relay runs after the
+// request has returned, and making the publish a child would stretch the
+// request's trace by the polling delay. The consumer continues the publish
+// span's trace from the message headers.
+func (r *relay) publish(ctx context.Context, tx *sql.Tx, ev outboxEvent) (err error) {
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.destination.name", r.queue),
+			attribute.String("messaging.message.id", ev.eventID),
+			attribute.Int("messaging.message.body.size", len(ev.payload)),
+			attribute.String("outbox.event.type", ev.eventType),
+			attribute.Float64("outbox.event.age", time.Since(ev.createdAt).Seconds()),
+		),
+	}
+	write := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), ev.traceContext))
+	if write.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: write}))
+	}
+	ctx, span := r.tracer.Start(ctx, "send "+r.queue, opts...)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	headers := amqp.Table{}
+	otel.GetTextMapPropagator().Inject(ctx, amqpHeadersCarrier(headers))
+	confirm, err := r.ch.PublishWithDeferredConfirmWithContext(ctx,
+		"",      // exchange
+		r.queue, // routing key
+		false,   // mandatory
+		false,   // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			MessageId:    ev.eventID,
+			Type:         ev.eventType,
+			Timestamp:    ev.createdAt,
+			Headers:      headers,
+			Body:         ev.payload,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to publish event %s: %v", ev.eventID, err)
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to confirm event %s: %v", ev.eventID, err)
+	}
+	if !acked {
+		return errors.New("broker rejected event " + ev.eventID)
+	}
+
+	if _, err := tx.ExecContext(ctx, "UPDATE outbox SET published_at = now() WHERE id = $1", ev.id); err != nil {
+		return fmt.Errorf("failed to mark event %s published: %v", ev.eventID, err)
+	}
+	return nil
+}
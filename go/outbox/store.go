@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"go.nhat.io/otelsql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const schema = `
+CREATE TABLE IF NOT EXISTS users (
+	id UUID PRIMARY KEY,
+	name TEXT NOT NULL,
+	email TEXT NOT NULL UNIQUE,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+CREATE TABLE IF NOT EXISTS outbox (
+	id BIGSERIAL PRIMARY KEY,
+	event_id UUID NOT NULL UNIQUE,
+	event_type TEXT NOT NULL,
+	aggregate_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	trace_context JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	published_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS outbox_unpublished ON outbox (id) WHERE published_at IS NULL;
+CREATE TABLE IF NOT EXISTS processed_events (
+	event_id UUID PRIMARY KEY,
+	processed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);`
+
+var errEmailTaken = errors.New("email already in use")
+
+type User struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// openDB opens Postgres through the otelsql driver. Unlike go-agent's
+// database integration it doesn't set AllowRoot: the relay polls the outbox
+// without a span in its context, and with AllowRoot every empty poll would
+// be a trace of its own. Queries run under a span, such as a request's or a
+// publish's, are traced as usual.
+func openDB(dsn string) (*sql.DB, error) {
+	driverName, err := otelsql.Register("postgres",
+		otelsql.TraceQueryWithoutArgs(),
+		otelsql.TraceRowsAffected(),
+		otelsql.WithDatabaseName("outbox"),
+		otelsql.WithSystem(semconv.DBSystemPostgreSQL),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to register driver: %v", err)
+	}
+
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %v", err)
+	}
+
+	// Record stats to expose connection pool metrics
+	if err := otelsql.RecordStats(db); err != nil {
+		return nil, err
+	}
+
+	if _, err := db.Exec(schema); err != nil {
+		return nil, fmt.Errorf("failed to create tables: %v", err)
+	}
+	return db, nil
+}
+
+// createUser inserts the user and its user.created event in one transaction,
+// so the event is published if and only if the user exists. The trace
+// context of the write span is stored with the event; the relay links its
+// publish span to it.
+func createUser(ctx context.Context, db *sql.DB, name, email string) (user User, err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "outbox.write user.created",
+		trace.WithAttributes(attribute.String("outbox.event.type", "user.created")))
+	defer func() {
+		if err != nil && !errors.Is(err, errEmailTaken) {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return User{}, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	user = User{ID: uuid.New().String(), Name: name, Email: email}
+	err = tx.QueryRowContext(ctx,
+		"INSERT INTO users (id, name, email) VALUES ($1, $2, $3) RETURNING created_at",
+		user.ID, user.Name, user.Email).Scan(&user.CreatedAt)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return User{}, errEmailTaken
+		}
+		return User{}, fmt.Errorf("failed to insert user: %v", err)
+	}
+
+	payload, err := json.Marshal(user)
+	if err != nil {
+		return User{}, err
+	}
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	traceContext, err := json.Marshal(carrier)
+	if err != nil {
+		return User{}, err
+	}
+
+	eventID := uuid.New().String()
+	span.SetAttributes(attribute.String("messaging.message.id", eventID))
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO outbox (event_id, event_type, aggregate_id, payload, trace_context)
+		VALUES ($1, $2, $3, $4, $5)`,
+		eventID, "user.created", user.ID, payload, traceContext); err != nil {
+		return User{}, fmt.Errorf("failed to insert outbox event: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return User{}, fmt.Errorf("failed to commit: %v", err)
+	}
+	return user, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// batchIndexKey holds a *int counting the queries of a batch whose results
+// have been read.
+type batchIndexKey struct{}
+
+// TraceBatchStart adds db.operation.batch.size to otelpgx's batch span.
+func (t *poolTracer) TraceBatchStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchStartData) context.Context {
+	ctx = t.Tracer.TraceBatchStart(ctx, conn, data)
+	if data.Batch != nil {
+		trace.SpanFromContext(ctx).SetAttributes(semconv.DBOperationBatchSize(data.Batch.Len()))
+	}
+	return context.WithValue(ctx, batchIndexKey{}, new(int))
+}
+
+// TraceBatchQuery adds a batch.query event to the batch span for each query,
+// then lets otelpgx add its span.
+//
+// pgx calls it as each result is read, after the whole batch has been sent
+// in one round trip, so otelpgx's per-query spans have no real duration.
+// The events keep the queries in order on the span that did take the time,
+// with their rows affected and errors.
+func (t *poolTracer) TraceBatchQuery(ctx context.Context, conn *pgx.Conn, data pgx.TraceBatchQueryData) {
+	index := 0
+	if n, ok := ctx.Value(batchIndexKey{}).(*int); ok {
+		index = *n
+		*n++
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int("pgx.batch.query.index", index),
+		semconv.DBQueryText(data.SQL),
+	}
+	if data.Err != nil {
+		attrs = append(attrs, semconv.ErrorTypeKey.String(fmt.Sprintf("%T", data.Err)))
+	} else {
+		attrs = append(attrs, attribute.Int64("pgx.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	trace.SpanFromContext(ctx).AddEvent("batch.query", trace.WithAttributes(attrs...))
+
+	t.Tracer.TraceBatchQuery(ctx, conn, data)
+}
+
+// TraceCopyFromStart adds db.operation.name and db.collection.name to
+// otelpgx's copy_from span, which otherwise has only the table in the older
+// db.sql.table.
+func (t *poolTracer) TraceCopyFromStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceCopyFromStartData) context.Context {
+	ctx = t.Tracer.TraceCopyFromStart(ctx, conn, data)
+	trace.SpanFromContext(ctx).SetAttributes(
+		semconv.DBOperationName("COPY"),
+		semconv.DBCollectionName(strings.Join(data.TableName, ".")),
+	)
+	return ctx
+}
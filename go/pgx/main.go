@@ -8,8 +8,8 @@ import (
 	"os"
 	"strconv"
 
-	"github.com/exaring/otelpgx"
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/last9/go-agent"
 	ginagent "github.com/last9/go-agent/instrumentation/gin"
@@ -36,8 +36,15 @@ func main() {
 		os.Exit(1)
 	}
 
-	// pgxpool uses otelpgx tracer (go-agent provides the tracer provider)
-	cfg.ConnConfig.Tracer = otelpgx.NewTracer()
+	// pgxpool uses otelpgx tracer (go-agent provides the tracer provider),
+	// wrapped to also time connection acquires
+	name := poolName(cfg)
+	tracer, err := newPoolTracer(name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "create pool tracer: %v\n", err)
+		os.Exit(1)
+	}
+	cfg.ConnConfig.Tracer = tracer
 	conn, err = pgxpool.NewWithConfig(context.Background(), cfg)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Unable to connection to database: %v\n", err)
@@ -45,13 +52,21 @@ func main() {
 	}
 	defer conn.Close()
 
-	log.Println("✓ pgxpool connected with OTel tracing")
+	// Connection pool metrics (go-agent provides the meter provider)
+	if err := recordPoolStats(conn, name); err != nil {
+		log.Printf("failed to record pool stats: %v", err)
+	}
+
+	log.Println("✓ pgxpool connected with OTel tracing and pool metrics")
 
 	// Create Gin router with go-agent instrumentation
 	r := ginagent.Default()
 
 	r.GET("/tasks", listTasksHandler)
 	r.POST("/tasks", addTaskHandler)
+	r.POST("/tasks/bulk", addTasksHandler)
+	r.POST("/tasks/batch", bulkHandler(addTasksBatch))
+	r.POST("/tasks/import", bulkHandler(importTasks))
 	r.PUT("/tasks/:id", updateTaskHandler)
 	r.DELETE("/tasks/:id", removeTaskHandler)
 
@@ -84,6 +99,42 @@ func addTaskHandler(c *gin.Context) {
 	c.Status(http.StatusCreated)
 }
 
+func addTasksHandler(c *gin.Context) {
+	var req struct {
+		Descriptions []string `json:"descriptions" binding:"required,min=1,dive,required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	err := addTasks(c.Request.Context(), req.Descriptions)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"created": len(req.Descriptions)})
+}
+
+// bulkHandler handles a request that creates several tasks at once with
+// insert, such as pgx.Batch or COPY.
+func bulkHandler(insert func(ctx context.Context, descriptions []string) (int64, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Descriptions []string `json:"descriptions" binding:"required,min=1,dive,required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		created, err := insert(c.Request.Context(), req.Descriptions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"created": created})
+	}
+}
+
 func updateTaskHandler(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 32)
 	if err != nil {
@@ -142,6 +193,49 @@ func addTask(ctx context.Context, description string) error {
 	return err
 }
 
+// addTasks inserts all the tasks or none of them.
+func addTasks(ctx context.Context, descriptions []string) error {
+	return inTx(ctx, conn, "add_tasks", func(ctx context.Context, tx pgx.Tx) error {
+		for _, d := range descriptions {
+			if _, err := tx.Exec(ctx, "insert into tasks(description) values($1)", d); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addTasksBatch queues one insert per task in a pgx.Batch and sends them
+// in a single round trip. The batch runs in an implicit transaction, so a
+// failed insert rolls back the others.
+func addTasksBatch(ctx context.Context, descriptions []string) (int64, error) {
+	batch := &pgx.Batch{}
+	for _, d := range descriptions {
+		batch.Queue("insert into tasks(description) values($1)", d)
+	}
+	results := conn.SendBatch(ctx, batch)
+	var created int64
+	for range descriptions {
+		tag, err := results.Exec()
+		if err != nil {
+			results.Close()
+			return 0, err
+		}
+		created += tag.RowsAffected()
+	}
+	return created, results.Close()
+}
+
+// importTasks loads the tasks with the COPY protocol, the fastest way to
+// insert many rows.
+func importTasks(ctx context.Context, descriptions []string) (int64, error) {
+	rows := make([][]any, len(descriptions))
+	for i, d := range descriptions {
+		rows[i] = []any{d}
+	}
+	return conn.CopyFrom(ctx, pgx.Identifier{"tasks"}, []string{"description"}, pgx.CopyFromRows(rows))
+}
+
 func updateTask(ctx context.Context, itemNum int32, description string) error {
 	_, err := conn.Exec(ctx, "update tasks set description=$1 where id=$2", description, itemNum)
 	return err
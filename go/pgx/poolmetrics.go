@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/exaring/otelpgx"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+)
+
+// scopeName is the instrumentation scope of the pool metrics and the
+// transaction spans.
+const scopeName = "github.com/last9/opentelemetry-examples/go/pgx"
+
+// poolName identifies the pool in db.client.connection.pool.name, as
+// host:port/database.
+func poolName(cfg *pgxpool.Config) string {
+	return fmt.Sprintf("%s:%d/%s", cfg.ConnConfig.Host, cfg.ConnConfig.Port, cfg.ConnConfig.Database)
+}
+
+// poolTracer adds connection acquire timing to otelpgx's query tracing,
+// and batch and COPY details (see batch.go). pgxpool calls TraceAcquireStart
+// and TraceAcquireEnd on the connection tracer when it implements
+// pgxpool.AcquireTracer; the embedded Tracer handles everything else.
+type poolTracer struct {
+	*otelpgx.Tracer
+	waitTime metric.Float64Histogram
+	attrs    attribute.Set
+}
+
+var _ pgxpool.AcquireTracer = (*poolTracer)(nil)
+
+type acquireStartKey struct{}
+
+// newPoolTracer returns a tracer that records db.client.connection.wait_time
+// for every connection acquired from the pool.
+func newPoolTracer(name string) (*poolTracer, error) {
+	waitTime, err := otel.Meter(scopeName).Float64Histogram("db.client.connection.wait_time",
+		metric.WithDescription("The time it took to obtain an open connection from the pool"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &poolTracer{
+		Tracer:   otelpgx.NewTracer(),
+		waitTime: waitTime,
+		attrs:    attribute.NewSet(semconv.DBClientConnectionPoolName(name)),
+	}, nil
+}
+
+func (t *poolTracer) TraceAcquireStart(ctx context.Context, _ *pgxpool.Pool, _ pgxpool.TraceAcquireStartData) context.Context {
+	return context.WithValue(ctx, acquireStartKey{}, time.Now())
+}
+
+// TraceAcquireEnd records the wait. A failed acquire, such as one canceled
+// by its context, also gets error.type.
+func (t *poolTracer) TraceAcquireEnd(ctx context.Context, _ *pgxpool.Pool, data pgxpool.TraceAcquireEndData) {
+	start, ok := ctx.Value(acquireStartKey{}).(time.Time)
+	if !ok {
+		return
+	}
+	opts := []metric.RecordOption{metric.WithAttributeSet(t.attrs)}
+	if data.Err != nil {
+		opts = append(opts, metric.WithAttributes(semconv.ErrorTypeKey.String(fmt.Sprintf("%T", data.Err))))
+	}
+	t.waitTime.Record(ctx, time.Since(start).Seconds(), opts...)
+}
+
+// recordPoolStats reports pgxpool.Stat as observable metrics, read at every
+// collection. It is the pgx counterpart of otelsql.RecordStats for
+// database/sql pools.
+func recordPoolStats(pool *pgxpool.Pool, name string) error {
+	meter := otel.Meter(scopeName)
+
+	count, err := meter.Int64ObservableUpDownCounter("db.client.connection.count",
+		metric.WithDescription("The number of connections that are currently in the state described by the state attribute"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	maxConns, err := meter.Int64ObservableUpDownCounter("db.client.connection.max",
+		metric.WithDescription("The maximum number of open connections allowed"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	constructing, err := meter.Int64ObservableUpDownCounter("pgxpool.connection.constructing",
+		metric.WithDescription("The number of connections being established"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	timeouts, err := meter.Int64ObservableCounter("db.client.connection.timeouts",
+		metric.WithDescription("The number of acquires canceled by their context before a connection was available"),
+		metric.WithUnit("{timeout}"))
+	if err != nil {
+		return err
+	}
+	acquires, err := meter.Int64ObservableCounter("pgxpool.acquires",
+		metric.WithDescription("The number of successful acquires; pgxpool.acquire.waited is true for those that waited for a connection"),
+		metric.WithUnit("{acquire}"))
+	if err != nil {
+		return err
+	}
+	created, err := meter.Int64ObservableCounter("pgxpool.connection.created",
+		metric.WithDescription("The number of connections opened"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+	destroyed, err := meter.Int64ObservableCounter("pgxpool.connection.destroyed",
+		metric.WithDescription("The number of connections closed by the pool, by reason"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		return err
+	}
+
+	poolAttr := semconv.DBClientConnectionPoolName(name)
+	attrs := metric.WithAttributes(poolAttr)
+	used := metric.WithAttributes(poolAttr, semconv.DBClientConnectionStateUsed)
+	idle := metric.WithAttributes(poolAttr, semconv.DBClientConnectionStateIdle)
+	waited := metric.WithAttributes(poolAttr, attribute.Bool("pgxpool.acquire.waited", true))
+	immediate := metric.WithAttributes(poolAttr, attribute.Bool("pgxpool.acquire.waited", false))
+	maxLifetime := metric.WithAttributes(poolAttr, attribute.String("pgxpool.destroy.reason", "max_lifetime"))
+	maxIdleTime := metric.WithAttributes(poolAttr, attribute.String("pgxpool.destroy.reason", "max_idle_time"))
+
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		s := pool.Stat()
+		o.ObserveInt64(count, int64(s.AcquiredConns()), used)
+		o.ObserveInt64(count, int64(s.IdleConns()), idle)
+		o.ObserveInt64(maxConns, int64(s.MaxConns()), attrs)
+		o.ObserveInt64(constructing, int64(s.ConstructingConns()), attrs)
+		o.ObserveInt64(timeouts, s.CanceledAcquireCount(), attrs)
+		// EmptyAcquireCount counts acquires that found no idle connection
+		o.ObserveInt64(acquires, s.EmptyAcquireCount(), waited)
+		o.ObserveInt64(acquires, s.AcquireCount()-s.EmptyAcquireCount(), immediate)
+		o.ObserveInt64(created, s.NewConnsCount(), attrs)
+		o.ObserveInt64(destroyed, s.MaxLifetimeDestroyCount(), maxLifetime)
+		o.ObserveInt64(destroyed, s.MaxIdleDestroyCount(), maxIdleTime)
+		return nil
+	}, count, maxConns, constructing, timeouts, acquires, created, destroyed)
+	return err
+}
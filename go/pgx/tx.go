@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// inTx runs fn in a transaction under a "tx <name>" span. The transaction
+// commits when fn returns nil and rolls back otherwise.
+//
+// otelpgx traces each statement, including BEGIN and COMMIT, but nothing
+// ties them together: the statements of a transaction look like unrelated
+// queries in the request's trace. Here they are children of the transaction
+// span, which records how it ended in db.transaction.outcome.
+func inTx(ctx context.Context, pool *pgxpool.Pool, name string, fn func(ctx context.Context, tx pgx.Tx) error) (err error) {
+	ctx, span := otel.Tracer(scopeName).Start(ctx, "tx "+name,
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			attribute.String("db.transaction.name", name),
+		),
+	)
+	defer span.End()
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "begin failed")
+		return err
+	}
+
+	outcome := "commit"
+	defer func() {
+		span.SetAttributes(attribute.String("db.transaction.outcome", outcome))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+	}()
+
+	if err = fn(ctx, tx); err != nil {
+		outcome = "rollback"
+		// Roll back with a fresh context, so a canceled request still
+		// releases its connection cleanly
+		if rbErr := tx.Rollback(context.WithoutCancel(ctx)); rbErr != nil && !errors.Is(rbErr, pgx.ErrTxClosed) {
+			err = errors.Join(err, rbErr)
+		}
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		outcome = "commit_failed"
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// profileSummary is the CPU time in one profile, by the trace it was spent
+// on.
+type profileSummary struct {
+	Profile string  `json:"profile"`
+	TotalMs float64 `json:"total_cpu_ms"`
+	// UnlabeledMs was spent outside requests: the garbage collector, the
+	// scheduler, the exporter's goroutines.
+	UnlabeledMs float64    `json:"unlabeled_cpu_ms"`
+	Traces      []traceCPU `json:"traces"`
+}
+
+type traceCPU struct {
+	TraceID string    `json:"trace_id"`
+	Route   string    `json:"http_route"`
+	CPUMs   float64   `json:"cpu_ms"`
+	Spans   []spanCPU `json:"spans"`
+}
+
+type spanCPU struct {
+	SpanID string  `json:"span_id"`
+	CPUMs  float64 `json:"cpu_ms"`
+}
+
+// summarize reads a CPU profile and adds up its samples by their trace_id
+// and span_id labels. It returns the top traces by CPU time, and their
+// spans, most first.
+func summarize(path string, top int) (profileSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return profileSummary{}, err
+	}
+	defer f.Close()
+	p, err := profile.Parse(f)
+	if err != nil {
+		return profileSummary{}, err
+	}
+	cpu := slices.IndexFunc(p.SampleType, func(st *profile.ValueType) bool {
+		return st.Type == "cpu" && st.Unit == "nanoseconds"
+	})
+	if cpu < 0 {
+		return profileSummary{}, fmt.Errorf("not a CPU profile")
+	}
+
+	var total, unlabeled time.Duration
+	traces := map[string]*traceCPU{}
+	spans := map[string]map[string]time.Duration{}
+	for _, s := range p.Sample {
+		d := time.Duration(s.Value[cpu])
+		total += d
+		traceID := label(s, labelTraceID)
+		if traceID == "" {
+			unlabeled += d
+			continue
+		}
+		t, ok := traces[traceID]
+		if !ok {
+			t = &traceCPU{TraceID: traceID, Route: label(s, labelRoute)}
+			traces[traceID] = t
+			spans[traceID] = map[string]time.Duration{}
+		}
+		t.CPUMs += ms(d)
+		spans[traceID][label(s, labelSpanID)] += d
+	}
+
+	summary := profileSummary{TotalMs: ms(total), UnlabeledMs: ms(unlabeled)}
+	for _, t := range traces {
+		for id, d := range spans[t.TraceID] {
+			t.Spans = append(t.Spans, spanCPU{SpanID: id, CPUMs: ms(d)})
+		}
+		slices.SortFunc(t.Spans, func(a, b spanCPU) int { return cmp.Compare(b.CPUMs, a.CPUMs) })
+		summary.Traces = append(summary.Traces, *t)
+	}
+	slices.SortFunc(summary.Traces, func(a, b traceCPU) int { return cmp.Compare(b.CPUMs, a.CPUMs) })
+	if len(summary.Traces) > top {
+		summary.Traces = summary.Traces[:top]
+	}
+	return summary, nil
+}
+
+func label(s *profile.Sample, key string) string {
+	if v := s.Label[key]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
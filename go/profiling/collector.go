@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// profileCollector records CPU profiles back to back, one file per window,
+// and keeps the most recent ones. The Go runtime allows one CPU profile at a
+// time, so a window can't start while another profile, such as one from
+// /debug/pprof/profile, is running; the collector retries a window later.
+type profileCollector struct {
+	dir    string
+	window time.Duration
+	keep   int
+
+	// current is the name of the file being recorded, nil between windows.
+	current atomic.Pointer[string]
+}
+
+// profileInfo describes a profile file in the collector's directory.
+type profileInfo struct {
+	Name      string    `json:"name"`
+	Start     time.Time `json:"start"`
+	Size      int64     `json:"size_bytes"`
+	Recording bool      `json:"recording"`
+}
+
+const profilePrefix, profileSuffix = "cpu-", ".pb.gz"
+
+// profileTimeFormat names a profile file after the start of its window.
+const profileTimeFormat = "20060102T150405Z"
+
+func newProfileCollector(dir string, window time.Duration, keep int) (*profileCollector, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &profileCollector{dir: dir, window: max(window, time.Second), keep: max(keep, 1)}, nil
+}
+
+// run records windows until ctx is canceled, then stops the one in progress
+// and returns once its file is complete.
+func (c *profileCollector) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := c.record(ctx); err != nil {
+			log.Printf("cpu profile: %v; retrying in %s", err, c.window)
+			select {
+			case <-ctx.Done():
+			case <-time.After(c.window):
+			}
+		}
+		c.prune()
+	}
+}
+
+// record writes one window's CPU profile.
+func (c *profileCollector) record(ctx context.Context) error {
+	name := profilePrefix + time.Now().UTC().Format(profileTimeFormat) + profileSuffix
+	path := filepath.Join(c.dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	c.current.Store(&name)
+
+	select {
+	case <-ctx.Done():
+	case <-time.After(c.window):
+	}
+
+	c.current.Store(nil)
+	pprof.StopCPUProfile()
+	if err := f.Close(); err != nil {
+		return err
+	}
+	log.Printf("cpu profile %s", name)
+	return nil
+}
+
+// currentFile returns the name of the profile being recorded, or "".
+func (c *profileCollector) currentFile() string {
+	if name := c.current.Load(); name != nil {
+		return *name
+	}
+	return ""
+}
+
+// list returns the profiles in the directory, oldest first.
+func (c *profileCollector) list() ([]profileInfo, error) {
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return nil, err
+	}
+	current := c.currentFile()
+	var profiles []profileInfo
+	for _, e := range entries {
+		start, ok := profileStart(e.Name())
+		if !ok {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		profiles = append(profiles, profileInfo{
+			Name:      e.Name(),
+			Start:     start,
+			Size:      info.Size(),
+			Recording: e.Name() == current,
+		})
+	}
+	// The names sort by time
+	slices.SortFunc(profiles, func(a, b profileInfo) int { return strings.Compare(a.Name, b.Name) })
+	return profiles, nil
+}
+
+var errRecording = errors.New("profile is still being recorded")
+
+// path returns the path of a complete profile, checking that name is one.
+func (c *profileCollector) path(name string) (string, error) {
+	if _, ok := profileStart(name); !ok {
+		return "", fmt.Errorf("%q is not a profile name", name)
+	}
+	if name == c.currentFile() {
+		return "", errRecording
+	}
+	return filepath.Join(c.dir, name), nil
+}
+
+// prune removes all but the most recent c.keep profiles.
+func (c *profileCollector) prune() {
+	profiles, err := c.list()
+	if err != nil {
+		log.Printf("list profiles: %v", err)
+		return
+	}
+	for len(profiles) > c.keep {
+		if err := os.Remove(filepath.Join(c.dir, profiles[0].Name)); err != nil {
+			log.Printf("remove profile: %v", err)
+		}
+		profiles = profiles[1:]
+	}
+}
+
+// profileStart parses the start of a window from a profile's file name.
+func profileStart(name string) (time.Time, bool) {
+	ts, ok := strings.CutPrefix(name, profilePrefix)
+	if !ok {
+		return time.Time{}, false
+	}
+	ts, ok = strings.CutSuffix(ts, profileSuffix)
+	if !ok {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(profileTimeFormat, ts)
+	return t, err == nil
+}
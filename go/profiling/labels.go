@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"runtime/pprof"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// pprof label keys. A CPU profile sample carries the labels of the
+// goroutine it was taken on, so samples can be filtered by them with
+// go tool pprof -tagfocus, or grouped with -tags.
+const (
+	labelTraceID = "trace_id"
+	labelSpanID  = "span_id"
+	labelRoute   = "http.route"
+)
+
+// withProfileLabels runs the request with pprof labels for its trace, its
+// server span and its route. Goroutines inherit their creator's labels, so
+// the work the handler starts is labeled too. It also records on the server
+// span the CPU profile being collected, so a trace leads to the file its
+// samples are in.
+func withProfileLabels(profiles *profileCollector, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		span := trace.SpanFromContext(ctx)
+		span.SetAttributes(semconv.HTTPRoute(r.Pattern))
+		if file := profiles.currentFile(); file != "" {
+			span.SetAttributes(attribute.String("pprof.profile.file", file))
+		}
+		doWithSpanLabels(ctx, func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}, labelRoute, r.Pattern)
+	})
+}
+
+// doWithSpanLabels calls f with the trace and span IDs of the span in ctx
+// added to the goroutine's pprof labels, along with the extra key, value
+// pairs. Labels already in ctx, such as the route, are kept, and the
+// goroutine's previous labels are restored when f returns. Without a valid
+// span in ctx, f runs with the labels it has.
+func doWithSpanLabels(ctx context.Context, f func(context.Context), extra ...string) {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		f(ctx)
+		return
+	}
+	labels := append([]string{
+		labelTraceID, sc.TraceID().String(),
+		labelSpanID, sc.SpanID().String(),
+	}, extra...)
+	pprof.Do(ctx, pprof.Labels(labels...), f)
+}
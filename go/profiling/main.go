@@ -0,0 +1,252 @@
+// Service that collects CPU profiles continuously, next to its traces, and
+// labels the goroutines serving each request with the request's trace and
+// span IDs, so the CPU time in a profile can be tied to the traces that
+// spent it, and a slow trace to the code it ran.
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	// The usual /debug/pprof handlers, served on PPROF_ADDR only
+	_ "net/http/pprof"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("profiling-example")
+
+func main() {
+	ctx := context.Background()
+
+	tp, err := initTracerProvider(ctx)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	window, err := time.ParseDuration(envOr("PROFILE_WINDOW", "30s"))
+	if err != nil {
+		log.Fatalf("PROFILE_WINDOW: %v", err)
+	}
+	keep, _ := strconv.Atoi(envOr("PROFILE_KEEP", "10"))
+	profiles, err := newProfileCollector(envOr("PROFILE_DIR", "profiles"), window, keep)
+	if err != nil {
+		log.Fatalf("failed to create profile directory: %v", err)
+	}
+	collectCtx, stopCollecting := context.WithCancel(ctx)
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		profiles.run(collectCtx)
+	}()
+
+	// net/http/pprof registers on http.DefaultServeMux, which only this
+	// listener serves, so profiles aren't exposed on the public port
+	pprofAddr := envOr("PPROF_ADDR", "localhost:6060")
+	go func() {
+		log.Printf("pprof on http://%s/debug/pprof/", pprofAddr)
+		if err := http.ListenAndServe(pprofAddr, nil); err != nil {
+			log.Printf("pprof server: %v", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	handle := func(pattern string, h http.HandlerFunc) {
+		mux.Handle(pattern, withProfileLabels(profiles, h))
+	}
+	handle("GET /work", workHandler(profiles))
+	handle("GET /profiles", listProfilesHandler(profiles))
+	handle("GET /profiles/{name}/traces", profileTracesHandler(profiles))
+
+	addr := ":" + envOr("PORT", "8080")
+	// otelhttp names the span after the handler returns, once the mux has
+	// set the request's pattern
+	handler := otelhttp.NewHandler(mux, "profiling-example",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return operation
+		}))
+	srv := &http.Server{Addr: addr, Handler: handler}
+	go func() {
+		log.Printf("listening on %s, CPU profiles every %s in %s", addr, profiles.window, profiles.dir)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	// Ends the window in progress, so its file is a complete profile
+	stopCollecting()
+	<-collected
+}
+
+// workHandler burns CPU: ?iterations= rounds of SHA-256, default 2000000,
+// split across ?parallel= goroutines, default 2. Each goroutine runs under
+// its own work.hash span, with that span's ID as its span_id label, so the
+// profile splits the request's CPU time by span.
+func workHandler(profiles *profileCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		iterations := min(max(queryInt(r, "iterations", 2_000_000), 1), 100_000_000)
+		parallel := min(max(queryInt(r, "parallel", 2), 1), 16)
+
+		var wg sync.WaitGroup
+		digests := make([]string, parallel)
+		for i := range parallel {
+			wg.Add(1)
+			// The goroutine inherits the request's labels, and replaces
+			// span_id with its own span's
+			go func() {
+				defer wg.Done()
+				ctx, span := tracer.Start(r.Context(), "work.hash", trace.WithAttributes(
+					attribute.Int("work.worker", i),
+					attribute.Int("work.iterations", iterations/parallel),
+				))
+				defer span.End()
+				doWithSpanLabels(ctx, func(context.Context) {
+					digests[i] = hashRounds(i, iterations/parallel)
+				})
+			}()
+		}
+		wg.Wait()
+
+		writeJSON(w, map[string]any{
+			"trace_id":   trace.SpanContextFromContext(r.Context()).TraceID().String(),
+			"profile":    profiles.currentFile(),
+			"iterations": iterations,
+			"parallel":   parallel,
+			"digests":    digests,
+		})
+	}
+}
+
+// hashRounds hashes a seed n times, each round hashing the last digest.
+func hashRounds(seed, n int) string {
+	sum := sha256.Sum256([]byte(strconv.Itoa(seed)))
+	for range n {
+		sum = sha256.Sum256(sum[:])
+	}
+	return hex.EncodeToString(sum[:8])
+}
+
+func listProfilesHandler(profiles *profileCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		list, err := profiles.list()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, map[string]any{"window": profiles.window.String(), "profiles": list})
+	}
+}
+
+// profileTracesHandler shows the CPU time in a complete profile by trace,
+// for the top ?top= traces, default 10.
+func profileTracesHandler(profiles *profileCollector) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		path, err := profiles.path(name)
+		if errors.Is(err, errRecording) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		summary, err := summarize(path, max(queryInt(r, "top", 10), 1))
+		if errors.Is(err, os.ErrNotExist) {
+			http.Error(w, "profile not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		summary.Profile = name
+		writeJSON(w, summary)
+	}
+}
+
+func queryInt(r *http.Request, key string, fallback int) int {
+	if n, err := strconv.Atoi(r.URL.Query().Get(key)); err == nil {
+		return n
+	}
+	return fallback
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func initTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(envOr("OTEL_SERVICE_NAME", "profiling-example")),
+			semconv.DeploymentEnvironment(envOr("DEPLOYMENT_ENVIRONMENT", "local")),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	return tp, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
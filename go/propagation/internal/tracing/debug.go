@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// extraction is what one propagator, or the composite, found in a request.
+type extraction struct {
+	Propagator string `json:"propagator"`
+	Found      bool   `json:"found"`
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	Sampled    *bool  `json:"sampled,omitempty"`
+	TraceState string `json:"tracestate,omitempty"`
+}
+
+// ContextDump is the response of /debug/context.
+type ContextDump struct {
+	Service     string   `json:"service"`
+	Propagators []string `json:"propagators"`
+	// Headers are the request's propagation headers, of any known format,
+	// whether or not this service's propagators read them.
+	Headers map[string]string `json:"headers"`
+	// Extracted is what each configured propagator finds on its own.
+	Extracted []extraction `json:"extracted"`
+	// Result is what the composite finds, and so what the service's spans
+	// for this request would be parented to. Its Propagator is the one
+	// whose context won.
+	Result   extraction        `json:"result"`
+	Baggage  map[string]string `json:"baggage"`
+	Warnings []string          `json:"warnings"`
+}
+
+// DebugContextHandler answers with the ContextDump of the request: the
+// propagation headers it carries, and what the service extracts from them.
+// Send it the headers a caller sends, to see why a trace breaks between two
+// services.
+func DebugContextHandler(service string, props Propagators) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(Dump(service, props, r.Header))
+	}
+}
+
+// Dump extracts the context from h with each of props, and with their
+// composite, and lists what looks wrong.
+func Dump(service string, props Propagators, h http.Header) ContextDump {
+	carrier := propagation.HeaderCarrier(h)
+	d := ContextDump{
+		Service:     service,
+		Propagators: props.Names(),
+		Headers:     propagationHeaders(h),
+		Baggage:     map[string]string{},
+		Warnings:    []string{},
+	}
+
+	var winner string
+	for _, p := range props {
+		e := extract(p.name, p.Extract(context.Background(), carrier))
+		if p.name == "baggage" {
+			continue
+		}
+		d.Extracted = append(d.Extracted, e)
+		if e.Found {
+			winner = p.name
+		}
+	}
+
+	ctx := props.Composite().Extract(context.Background(), carrier)
+	d.Result = extract(winner, ctx)
+	for _, m := range baggage.FromContext(ctx).Members() {
+		d.Baggage[m.Key()] = m.Value()
+	}
+	d.Warnings = warnings(props, d, h)
+	return d
+}
+
+func extract(name string, ctx context.Context) extraction {
+	sc := trace.SpanContextFromContext(ctx)
+	e := extraction{Propagator: name, Found: sc.IsValid()}
+	if !e.Found {
+		return e
+	}
+	sampled := sc.IsSampled()
+	e.TraceID = sc.TraceID().String()
+	e.SpanID = sc.SpanID().String()
+	e.Sampled = &sampled
+	e.TraceState = sc.TraceState().String()
+	return e
+}
+
+// propagationHeaders returns the headers of h that any known propagator
+// reads, and Jaeger's uberctx- baggage headers, by lowercase name.
+func propagationHeaders(h http.Header) map[string]string {
+	fields := map[string]bool{}
+	for _, p := range known {
+		for _, f := range p.Fields() {
+			fields[strings.ToLower(f)] = true
+		}
+	}
+	headers := map[string]string{}
+	for name, values := range h {
+		lower := strings.ToLower(name)
+		if fields[lower] || strings.HasPrefix(lower, "uberctx-") {
+			headers[lower] = strings.Join(values, ",")
+		}
+	}
+	return headers
+}
+
+// warnings lists the usual causes of a trace breaking between services.
+func warnings(props Propagators, d ContextDump, h http.Header) []string {
+	ws := []string{}
+
+	configured := map[string]bool{}
+	for _, name := range d.Propagators {
+		configured[name] = true
+	}
+	// A header only a propagator this service doesn't have can read
+	for _, hp := range []struct{ header, name string }{
+		{"traceparent", "tracecontext"},
+		{"baggage", "baggage"},
+		{"uber-trace-id", "jaeger"},
+	} {
+		if _, ok := d.Headers[hp.header]; ok && !configured[hp.name] {
+			ws = append(ws, fmt.Sprintf("%s is ignored: add %s to PROPAGATORS to read it", hp.header, hp.name))
+		}
+	}
+	_, single := d.Headers["b3"]
+	_, multi := d.Headers["x-b3-traceid"]
+	if (single || multi) && !configured["b3"] && !configured["b3multi"] {
+		ws = append(ws, "B3 headers are ignored: add b3 or b3multi to PROPAGATORS to read them")
+	}
+	for name := range d.Headers {
+		if strings.HasPrefix(name, "uberctx-") {
+			ws = append(ws, "uberctx- baggage headers are ignored: the jaeger propagator reads uber-trace-id only. Send W3C baggage instead")
+			break
+		}
+	}
+
+	// Formats that disagree: the last one in PROPAGATORS wins
+	traceIDs := map[string][]string{}
+	for _, e := range d.Extracted {
+		if e.Found {
+			traceIDs[e.TraceID] = append(traceIDs[e.TraceID], e.Propagator)
+		}
+	}
+	if len(traceIDs) > 1 {
+		var parts []string
+		for id, names := range traceIDs {
+			parts = append(parts, fmt.Sprintf("%s from %s", id, strings.Join(names, " and ")))
+		}
+		sort.Strings(parts)
+		ws = append(ws, fmt.Sprintf("formats carry different trace IDs (%s): %s wins, as the last in PROPAGATORS", strings.Join(parts, ", "), d.Result.Propagator))
+	}
+
+	// B3 without a sampling decision defers it. OpenTelemetry reads that as
+	// not sampled, and a parent-based sampler then drops the trace
+	if d.Result.Found && !*d.Result.Sampled && strings.HasPrefix(d.Result.Propagator, "b3") &&
+		h.Get("X-B3-Sampled") == "" && h.Get("X-B3-Flags") == "" && !b3SingleHasSampling(h.Get("b3")) {
+		ws = append(ws, "B3 context has no sampling decision, so it's read as not sampled and this service won't record the trace: send X-B3-Sampled: 1, or end the b3 header with -1")
+	} else if d.Result.Found && !*d.Result.Sampled {
+		ws = append(ws, "context is not sampled: this service won't record the trace")
+	}
+	return ws
+}
+
+// b3SingleHasSampling reports whether a single b3 header, traceid-spanid,
+// optionally followed by -sampled and -parentspanid, has the sampling part.
+func b3SingleHasSampling(v string) bool {
+	return v != "" && strings.Count(v, "-") >= 2
+}
@@ -0,0 +1,113 @@
+// Package tracing sets up tracing for the legacy and orders services, with
+// the propagators named in their PROPAGATORS setting, and serves the
+// /debug/context endpoint both expose.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// known are the propagators PROPAGATORS can name, with the names
+// OTEL_PROPAGATORS uses for them.
+var known = map[string]propagation.TextMapPropagator{
+	"tracecontext": propagation.TraceContext{},
+	"baggage":      propagation.Baggage{},
+	// b3.New() alone injects the single b3 header. Both read either form
+	"b3":      b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)),
+	"b3multi": b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)),
+	"jaeger":  jaeger.Jaeger{},
+}
+
+// namedPropagator is one propagator of a Propagators.
+type namedPropagator struct {
+	name string
+	propagation.TextMapPropagator
+}
+
+// Propagators is an ordered list of propagators. Their composite injects
+// every format, and extracts with each in turn: when a request carries
+// more than one format, the context from the last one that has a valid
+// context wins.
+type Propagators []namedPropagator
+
+// ParsePropagators returns the propagators named in names, a comma-separated
+// list such as "b3multi,jaeger,tracecontext,baggage".
+func ParsePropagators(names string) (Propagators, error) {
+	var props Propagators
+	for _, name := range strings.Split(names, ",") {
+		name = strings.TrimSpace(name)
+		p, ok := known[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown propagator %q: want tracecontext, baggage, b3, b3multi or jaeger", name)
+		}
+		props = append(props, namedPropagator{name, p})
+	}
+	return props, nil
+}
+
+// Composite returns the propagators as one.
+func (props Propagators) Composite() propagation.TextMapPropagator {
+	ps := make([]propagation.TextMapPropagator, len(props))
+	for i, p := range props {
+		ps[i] = p.TextMapPropagator
+	}
+	return propagation.NewCompositeTextMapPropagator(ps...)
+}
+
+// Names returns the propagators' names, in order.
+func (props Propagators) Names() []string {
+	names := make([]string, len(props))
+	for i, p := range props {
+		names[i] = p.name
+	}
+	return names
+}
+
+// Init sets up an OTLP tracer provider and props as the global propagator.
+// The returned shutdown flushes the spans.
+func Init(ctx context.Context, serviceName string, props Propagators) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(EnvOr("OTEL_SERVICE_NAME", serviceName)),
+			semconv.DeploymentEnvironment(EnvOr("DEPLOYMENT_ENVIRONMENT", "local")),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(props.Composite())
+	return tp.Shutdown, nil
+}
+
+// EnvOr returns the value of the environment variable key, or fallback
+// if it is unset or empty.
+func EnvOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,140 @@
+// The legacy service: a Zipkin-era service that only reads and writes B3
+// headers. It starts checkouts, which call the orders service, and answers
+// the orders service's stock checks.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/propagation/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "propagation-legacy"
+
+var tracer = otel.Tracer("github.com/last9/opentelemetry-examples/go/propagation/legacy")
+
+var (
+	client    = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: 5 * time.Second}
+	ordersURL = tracing.EnvOr("ORDERS_URL", "http://localhost:8080")
+)
+
+func main() {
+	props, err := tracing.ParsePropagators(tracing.EnvOr("PROPAGATORS", "b3multi"))
+	if err != nil {
+		log.Fatalf("PROPAGATORS: %v", err)
+	}
+	ctx := context.Background()
+	shutdown, err := tracing.Init(ctx, serviceName, props)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /checkout", checkout)
+	mux.HandleFunc("GET /stock", stock)
+	mux.HandleFunc("/debug/context", tracing.DebugContextHandler(serviceName, props))
+
+	addr := ":" + tracing.EnvOr("PORT", "8081")
+	srv := &http.Server{Addr: addr, Handler: otelhttp.NewHandler(mux, "legacy",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return operation
+		}))}
+	go func() {
+		log.Printf("legacy listening on %s, propagators %v", addr, props.Names())
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+}
+
+// checkout places an order for ?item= with the orders service. With
+// ?dump=true, it sends the same request to the orders service's
+// /debug/context instead, and answers with what the orders service
+// extracted from it.
+func checkout(w http.ResponseWriter, r *http.Request) {
+	item := r.URL.Query().Get("item")
+	if item == "" {
+		item = "widget"
+	}
+	path := "/orders"
+	if r.URL.Query().Get("dump") == "true" {
+		path = "/debug/context"
+	}
+
+	ctx, span := tracer.Start(r.Context(), "checkout", trace.WithAttributes(
+		attribute.String("order.item", item),
+	))
+	defer span.End()
+
+	body, _ := json.Marshal(map[string]string{"item": item})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, ordersURL+path, bytes.NewReader(body))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "order request failed")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 500 {
+		span.SetStatus(codes.Error, fmt.Sprintf("orders answered %s", resp.Status))
+	}
+
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+	w.WriteHeader(resp.StatusCode)
+	io.Copy(w, resp.Body)
+}
+
+// stock answers the orders service's stock checks. Items starting with
+// "sold-out" are out of stock.
+func stock(w http.ResponseWriter, r *http.Request) {
+	item := r.URL.Query().Get("item")
+	_, span := tracer.Start(r.Context(), "stock.lookup", trace.WithAttributes(
+		attribute.String("order.item", item),
+	))
+	inStock := !strings.HasPrefix(item, "sold-out")
+	span.SetAttributes(attribute.Bool("stock.available", inStock))
+	span.End()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"item": item, "in_stock": inStock})
+}
@@ -0,0 +1,152 @@
+// The orders service: a W3C service that has to take part in traces
+// started by the legacy service, which only speaks B3. It reads B3, Jaeger
+// and W3C trace context, and sends all three, with W3C baggage, on its own
+// calls, so the legacy service can continue its traces too.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/propagation/internal/tracing"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "propagation-orders"
+
+var tracer = otel.Tracer("github.com/last9/opentelemetry-examples/go/propagation/orders")
+
+var (
+	client    = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport), Timeout: 5 * time.Second}
+	legacyURL = tracing.EnvOr("LEGACY_URL", "http://localhost:8081")
+	nextID    atomic.Int64
+)
+
+func main() {
+	// tracecontext comes after b3multi and jaeger, so it wins when a
+	// request carries more than one format
+	props, err := tracing.ParsePropagators(tracing.EnvOr("PROPAGATORS", "b3multi,jaeger,tracecontext,baggage"))
+	if err != nil {
+		log.Fatalf("PROPAGATORS: %v", err)
+	}
+	ctx := context.Background()
+	shutdown, err := tracing.Init(ctx, serviceName, props)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /orders", placeOrder)
+	mux.HandleFunc("/debug/context", tracing.DebugContextHandler(serviceName, props))
+
+	addr := ":" + tracing.EnvOr("PORT", "8080")
+	srv := &http.Server{Addr: addr, Handler: otelhttp.NewHandler(mux, "orders",
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			if r.Pattern != "" {
+				return r.Pattern
+			}
+			return operation
+		}))}
+	go func() {
+		log.Printf("orders listening on %s, propagators %v", addr, props.Names())
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+}
+
+// placeOrder checks stock with the legacy service, then places the order.
+// The customer's tier comes from W3C baggage, when the caller sends it.
+func placeOrder(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Item string `json:"item"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Item == "" {
+		http.Error(w, `want {"item": "..."}`, http.StatusBadRequest)
+		return
+	}
+
+	ctx, span := tracer.Start(r.Context(), "order.place", trace.WithAttributes(
+		attribute.String("order.item", req.Item),
+	))
+	defer span.End()
+	tier := baggage.FromContext(ctx).Member("customer.tier").Value()
+	if tier != "" {
+		span.SetAttributes(attribute.String("customer.tier", tier))
+	}
+
+	inStock, err := checkStock(ctx, req.Item)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, "stock check failed")
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if !inStock {
+		span.SetAttributes(attribute.Bool("order.rejected", true))
+		http.Error(w, "out of stock", http.StatusConflict)
+		return
+	}
+
+	id := nextID.Add(1)
+	span.SetAttributes(attribute.Int64("order.id", id))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{
+		"order_id":      id,
+		"item":          req.Item,
+		"customer_tier": tier,
+		"trace_id":      span.SpanContext().TraceID().String(),
+	})
+}
+
+// checkStock calls the legacy service. The otelhttp transport injects every
+// format of the composite propagator, B3 among them.
+func checkStock(ctx context.Context, item string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, legacyURL+"/stock?item="+url.QueryEscape(item), nil)
+	if err != nil {
+		return false, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("stock check: %s", resp.Status)
+	}
+	var stock struct {
+		InStock bool `json:"in_stock"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&stock)
+	return stock.InStock, err
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/last9/go-agent"
+	ginagent "github.com/last9/go-agent/instrumentation/gin"
+	redisagent "github.com/last9/go-agent/integrations/redis"
+	"github.com/redis/go-redis/v9"
+)
+
+const tracerName = "redis-streams-example"
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	opts := &redis.Options{
+		Addr:     getEnv("REDIS_ADDR", "localhost:6379"),
+		Password: os.Getenv("REDIS_PASSWORD"),
+	}
+	// rdb traces every command; it's used under a request, send or process
+	// span. poller isn't instrumented: XREADGROUP blocks in a loop and the
+	// gauges run XPENDING every collection, without a span, and each call
+	// would be a trace of its own.
+	rdb, err := redisagent.NewClient(opts)
+	if err != nil {
+		log.Printf("Redis commands won't be traced: %v", err)
+	}
+	defer rdb.Close()
+	poller := redis.NewClient(opts)
+	defer poller.Close()
+
+	q := &queue{
+		rdb:           rdb,
+		poller:        poller,
+		stream:        getEnv("STREAM", "jobs"),
+		group:         getEnv("CONSUMER_GROUP", "workers"),
+		maxLen:        int64(getEnvInt("STREAM_MAX_LEN", 10000)),
+		minIdle:       getEnvDuration("CLAIM_MIN_IDLE", 30*time.Second),
+		maxDeliveries: int64(getEnvInt("MAX_DELIVERIES", 3)),
+	}
+	q.deadLetter = q.stream + ":dead"
+	if err := q.createGroup(ctx); err != nil {
+		log.Fatalf("failed to create consumer group: %v", err)
+	}
+	if err := registerStreamMetrics(q); err != nil {
+		log.Printf("failed to register stream metrics: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	consumer := getEnv("CONSUMER_NAME", hostname)
+
+	var wg sync.WaitGroup
+	for i := range getEnvInt("WORKERS", 4) {
+		w := newWorker(q, fmt.Sprintf("%s-%d", consumer, i))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	rc := newWorker(q, consumer+"-reclaimer")
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		rc.reclaim(ctx)
+	}()
+
+	router := ginagent.Default()
+	router.POST("/jobs", enqueueHandler(q))
+
+	srv := &http.Server{Addr: ":" + getEnv("PORT", "8080"), Handler: router}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+	log.Printf("✓ Gin server running on %s (instrumented by go-agent)", srv.Addr)
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down server: %v", err)
+	}
+	wg.Wait()
+}
+
+func enqueueHandler(q *queue) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var j job
+		if err := c.ShouldBindJSON(&j); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		id, err := q.enqueue(c.Request.Context(), j)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, gin.H{"id": id})
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v > 0 {
+		return v
+	}
+	return fallback
+}
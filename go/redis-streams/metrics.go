@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// registerStreamMetrics registers gauges of the queue's backlog, read from
+// Redis on every collection:
+//
+//   - redis.stream.length: entries in the stream and in the dead-letter
+//     stream. Trimming keeps the stream near STREAM_MAX_LEN, acked or not
+//   - redis.stream.pending: entries read but not yet acked, per consumer
+//   - redis.stream.pending.idle: how long the oldest pending entry has been
+//     idle. Past CLAIM_MIN_IDLE, the reclaimer is behind or down
+func registerStreamMetrics(q *queue) error {
+	meter := otel.Meter(tracerName)
+	length, err := meter.Int64ObservableGauge("redis.stream.length",
+		metric.WithDescription("Number of entries in the stream"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return err
+	}
+	pending, err := meter.Int64ObservableGauge("redis.stream.pending",
+		metric.WithDescription("Number of entries delivered to a consumer and not yet acked"),
+		metric.WithUnit("{entry}"),
+	)
+	if err != nil {
+		return err
+	}
+	idle, err := meter.Float64ObservableGauge("redis.stream.pending.idle",
+		metric.WithDescription("Idle time of the oldest pending entry"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	stream := attribute.String("messaging.destination.name", q.stream)
+	group := attribute.String("messaging.consumer.group.name", q.group)
+	_, err = meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		for _, s := range []string{q.stream, q.deadLetter} {
+			n, err := q.poller.XLen(ctx, s).Result()
+			if err != nil {
+				return fmt.Errorf("failed to read length of %s: %v", s, err)
+			}
+			o.ObserveInt64(length, n, metric.WithAttributes(attribute.String("messaging.destination.name", s)))
+		}
+
+		// XINFO CONSUMERS, unlike the XPENDING summary, lists consumers with
+		// nothing pending, so their series drop to 0 rather than stopping
+		consumers, err := q.poller.XInfoConsumers(ctx, q.stream, q.group).Result()
+		if err != nil {
+			return fmt.Errorf("failed to read consumers: %v", err)
+		}
+		var total int64
+		for _, c := range consumers {
+			total += c.Pending
+			o.ObserveInt64(pending, c.Pending, metric.WithAttributes(stream, group, attribute.String("messaging.client.id", c.Name)))
+		}
+
+		// Entries are listed by ID, so the first is the oldest
+		var oldest float64
+		if total > 0 {
+			entries, err := q.poller.XPendingExt(ctx, &redis.XPendingExtArgs{
+				Stream: q.stream,
+				Group:  q.group,
+				Start:  "-",
+				End:    "+",
+				Count:  1,
+			}).Result()
+			if err != nil {
+				return fmt.Errorf("failed to read oldest pending entry: %v", err)
+			}
+			if len(entries) > 0 {
+				oldest = entries[0].Idle.Seconds()
+			}
+		}
+		o.ObserveFloat64(idle, oldest, metric.WithAttributes(stream, group))
+		return nil
+	}, length, pending, idle)
+	return err
+}
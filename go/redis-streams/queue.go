@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// job is the body of POST /jobs. Stall and Fail make a worker misbehave, to
+// show how stuck and failing jobs are traced.
+type job struct {
+	Type    string          `json:"type" binding:"required"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Stall makes the first worker to read the job give up without acking
+	// it, as if it had crashed. The reclaimer claims it after CLAIM_MIN_IDLE.
+	Stall bool `json:"stall,omitempty"`
+	// Fail makes every attempt fail, until the job is dead-lettered after
+	// MAX_DELIVERIES.
+	Fail bool `json:"fail,omitempty"`
+}
+
+// jobField is the stream entry field holding the JSON-encoded job. The trace
+// context is injected next to it, as fields of their own.
+const jobField = "job"
+
+// streamCarrier implements TextMapCarrier for the fields of a stream entry
+type streamCarrier map[string]any
+
+func (c streamCarrier) Get(key string) string {
+	if value, ok := c[key].(string); ok {
+		return value
+	}
+	return ""
+}
+
+func (c streamCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c streamCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// queue is a job queue on a Redis stream, read by a consumer group. An entry
+// stays in the group's pending entries list from the time a consumer reads
+// it until it is acked, so a job whose worker died is not lost: after
+// minIdle, the reclaimer claims it for another attempt. After maxDeliveries
+// attempts it is moved to the deadLetter stream.
+type queue struct {
+	rdb           *redis.Client
+	poller        *redis.Client
+	stream        string
+	deadLetter    string
+	group         string
+	maxLen        int64
+	minIdle       time.Duration
+	maxDeliveries int64
+}
+
+// createGroup creates the consumer group, and the stream if it doesn't exist.
+// A new group starts at the end of the stream. An existing group is kept.
+func (q *queue) createGroup(ctx context.Context) error {
+	err := q.poller.XGroupCreateMkStream(ctx, q.stream, q.group, "$").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return fmt.Errorf("failed to create group %s on %s: %v", q.group, q.stream, err)
+	}
+	return nil
+}
+
+// enqueue adds j to the stream under a producer span, a child of the
+// request's, and returns the entry ID. The span's context is written into
+// the entry, so the worker that processes it continues the trace.
+func (q *queue) enqueue(ctx context.Context, j job) (id string, err error) {
+	body, err := json.Marshal(j)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "send "+q.stream,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.destination.name", q.stream),
+			attribute.Int("messaging.message.body.size", len(body)),
+			attribute.String("job.type", j.Type),
+		))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	fields := streamCarrier{jobField: body}
+	otel.GetTextMapPropagator().Inject(ctx, fields)
+	id, err = q.rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		// Approximate trimming is cheap; it keeps at least maxLen entries
+		MaxLen: q.maxLen,
+		Approx: true,
+		Values: map[string]any(fields),
+	}).Result()
+	if err != nil {
+		return "", fmt.Errorf("failed to add job to %s: %v", q.stream, err)
+	}
+	span.SetAttributes(attribute.String("messaging.message.id", id))
+	return id, nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// reclaim claims entries that have been pending for longer than minIdle,
+// until ctx is canceled. Those are jobs whose worker failed them, or died
+// or hung before acking. Each is retried, or dead-lettered once it has been
+// delivered maxDeliveries times.
+func (w *worker) reclaim(ctx context.Context) {
+	ticker := time.NewTicker(max(w.q.minIdle/2, time.Second))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := w.reclaimBatch(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("%s: %v", w.consumer, err)
+		}
+	}
+}
+
+// reclaimBatch claims up to 100 idle entries with XCLAIM. XCLAIM checks the
+// idle time again, so an entry another reclaimer claimed, or its worker
+// acked, since XPENDING isn't claimed twice.
+func (w *worker) reclaimBatch(ctx context.Context) error {
+	pending, err := w.q.poller.XPendingExt(ctx, &redis.XPendingExtArgs{
+		Stream: w.q.stream,
+		Group:  w.q.group,
+		Idle:   w.q.minIdle,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to list pending entries: %v", err)
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	ids := make([]string, len(pending))
+	byID := make(map[string]redis.XPendingExt, len(pending))
+	for i, p := range pending {
+		ids[i] = p.ID
+		byID[p.ID] = p
+	}
+	msgs, err := w.q.poller.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   w.q.stream,
+		Group:    w.q.group,
+		Consumer: w.consumer,
+		MinIdle:  w.q.minIdle,
+		Messages: ids,
+	}).Result()
+	if err != nil {
+		return fmt.Errorf("failed to claim pending entries: %v", err)
+	}
+
+	for _, msg := range msgs {
+		p := byID[msg.ID]
+		if p.RetryCount >= w.q.maxDeliveries {
+			w.deadLetter(ctx, msg, p)
+			continue
+		}
+		w.handle(ctx, msg, delivery{
+			count:       p.RetryCount + 1,
+			claimedFrom: p.Consumer,
+			idle:        p.Idle,
+		})
+	}
+	return nil
+}
+
+// deadLetter moves an entry that has used up its deliveries to the
+// dead-letter stream, and acks it, in one transaction. The producer span,
+// like a claimed entry's process span, starts a new trace linked to the
+// original send span; the dead-lettered entry keeps the original trace
+// context, so whoever replays it continues the original trace.
+func (w *worker) deadLetter(ctx context.Context, msg redis.XMessage, p redis.XPendingExt) {
+	fields := streamCarrier(msg.Values)
+	opts := []trace.SpanStartOption{
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.operation.type", "send"),
+			attribute.String("messaging.destination.name", w.q.deadLetter),
+			attribute.String("messaging.client.id", w.consumer),
+			attribute.String("messaging.message.id", msg.ID),
+			attribute.Int64("messaging.redis.delivery_count", p.RetryCount),
+			attribute.String("messaging.redis.claimed_from", p.Consumer),
+		),
+	}
+	send := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), fields))
+	if send.IsValid() {
+		opts = append(opts, trace.WithLinks(trace.Link{SpanContext: send}))
+	}
+	ctx, span := w.tracer.Start(ctx, "send "+w.q.deadLetter, opts...)
+	defer span.End()
+
+	values := make(map[string]any, len(fields)+2)
+	for k, v := range fields {
+		values[k] = v
+	}
+	values["original_id"] = msg.ID
+	values["deliveries"] = strconv.FormatInt(p.RetryCount, 10)
+
+	_, err := w.q.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: w.q.deadLetter, Values: values})
+		pipe.XAck(ctx, w.q.stream, w.q.group, msg.ID)
+		return nil
+	})
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("%s: failed to dead-letter %s: %v", w.consumer, msg.ID, err)
+		return
+	}
+	log.Printf("%s: dead-lettered job %s after %d deliveries", w.consumer, msg.ID, p.RetryCount)
+}
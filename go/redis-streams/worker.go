@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// delivery is how an entry reached a worker: read from the stream for the
+// first time, or claimed from another consumer's pending entries.
+type delivery struct {
+	// count is the number of times the entry was delivered, this one
+	// included
+	count int64
+	// claimedFrom is the consumer the entry was claimed from, and idle how
+	// long it had been pending there. Both are empty for a first delivery.
+	claimedFrom string
+	idle        time.Duration
+}
+
+var errJobFailed = errors.New("job failed")
+
+// worker is a consumer in the queue's group. Each worker has a name of its
+// own, since the pending entries list records which consumer holds an entry.
+type worker struct {
+	q        *queue
+	consumer string
+	tracer   trace.Tracer
+}
+
+func newWorker(q *queue, consumer string) *worker {
+	return &worker{q: q, consumer: consumer, tracer: otel.Tracer(tracerName)}
+}
+
+// run reads new entries with XREADGROUP until ctx is canceled. The read
+// blocks for up to 5s, so an idle worker doesn't spin.
+func (w *worker) run(ctx context.Context) {
+	for {
+		streams, err := w.q.poller.XReadGroup(ctx, &redis.XReadGroupArgs{
+			Group:    w.q.group,
+			Consumer: w.consumer,
+			Streams:  []string{w.q.stream, ">"},
+			Count:    10,
+			Block:    5 * time.Second,
+		}).Result()
+		if ctx.Err() != nil {
+			return
+		}
+		if errors.Is(err, redis.Nil) {
+			continue
+		}
+		if err != nil {
+			log.Printf("%s: failed to read %s: %v", w.consumer, w.q.stream, err)
+			time.Sleep(time.Second)
+			continue
+		}
+		for _, s := range streams {
+			for _, msg := range s.Messages {
+				w.handle(ctx, msg, delivery{count: 1})
+			}
+		}
+	}
+}
+
+// handle processes one entry under a consumer span and acks it if the job
+// succeeds. A failed job stays pending, for the reclaimer to retry.
+//
+// The first delivery's span is a child of the producer's send span. A
+// claimed entry's span starts a new trace, linked to the send span instead:
+// the claim comes at least CLAIM_MIN_IDLE later, and as a child it would
+// stretch the producer's trace by that long, once per attempt.
+func (w *worker) handle(ctx context.Context, msg redis.XMessage, d delivery) {
+	fields := streamCarrier(msg.Values)
+	ctx = otel.GetTextMapPropagator().Extract(ctx, fields)
+
+	opts := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.operation.type", "process"),
+			attribute.String("messaging.destination.name", w.q.stream),
+			attribute.String("messaging.consumer.group.name", w.q.group),
+			attribute.String("messaging.client.id", w.consumer),
+			attribute.String("messaging.message.id", msg.ID),
+			attribute.Int64("messaging.redis.delivery_count", d.count),
+		),
+	}
+	if d.claimedFrom != "" {
+		opts = append(opts,
+			trace.WithNewRoot(),
+			trace.WithAttributes(
+				attribute.String("messaging.redis.claimed_from", d.claimedFrom),
+				attribute.Float64("messaging.redis.idle", d.idle.Seconds()),
+			))
+		if send := trace.SpanContextFromContext(ctx); send.IsValid() {
+			opts = append(opts, trace.WithLinks(trace.Link{SpanContext: send}))
+		}
+	}
+	ctx, span := w.tracer.Start(ctx, "process "+w.q.stream, opts...)
+	defer span.End()
+
+	var j job
+	if err := json.Unmarshal([]byte(fields.Get(jobField)), &j); err != nil {
+		// No attempt can succeed, so it's acked and dropped right away
+		err = fmt.Errorf("failed to decode job %s: %v", msg.ID, err)
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("%s: %v", w.consumer, err)
+		w.ack(ctx, msg.ID)
+		return
+	}
+	span.SetAttributes(attribute.String("job.type", j.Type))
+
+	if j.Stall && d.count == 1 {
+		// As if the worker had crashed: the entry stays pending on this
+		// consumer until the reclaimer claims it
+		span.SetAttributes(attribute.Bool("job.stalled", true))
+		log.Printf("%s: abandoning job %s", w.consumer, msg.ID)
+		return
+	}
+
+	if err := w.do(ctx, j); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		log.Printf("%s: job %s, attempt %d: %v", w.consumer, msg.ID, d.count, err)
+		return
+	}
+	w.ack(ctx, msg.ID)
+}
+
+// do stands in for the job's work
+func (w *worker) do(ctx context.Context, j job) error {
+	_, span := w.tracer.Start(ctx, "job "+j.Type)
+	defer span.End()
+
+	time.Sleep(time.Duration(50+rand.IntN(100)) * time.Millisecond)
+	if j.Fail {
+		span.SetStatus(codes.Error, errJobFailed.Error())
+		return errJobFailed
+	}
+	return nil
+}
+
+// ack removes the entry from the group's pending entries list
+func (w *worker) ack(ctx context.Context, id string) {
+	if err := w.q.rdb.XAck(ctx, w.q.stream, w.q.group, id).Err(); err != nil {
+		trace.SpanFromContext(ctx).RecordError(err)
+		log.Printf("%s: failed to ack %s: %v", w.consumer, id, err)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// check is one request and the status a healthy deployment answers it with.
+type check struct {
+	Name   string
+	Method string
+	Path   string
+	// Body is sent as JSON when set.
+	Body   string
+	Status int
+}
+
+func health() check {
+	return check{Name: "health", Method: http.MethodGet, Path: "/health", Status: http.StatusOK}
+}
+
+// exampleChecks are the checks for each example: its health endpoint, where
+// it has one, and a core endpoint that exercises its main dependency. Core
+// endpoints only read, except for the greeter, so a smoke test leaves no
+// data behind. Examples whose core endpoints write to cloud services are
+// checked by health only.
+var exampleChecks = map[string][]check{
+	"aws-airflow-secrets": {health()},
+	"aws-sqs-s3":          {health()},
+	"ebpf": {
+		health(),
+		{Name: "list users", Method: http.MethodGet, Path: "/api/users", Status: http.StatusOK},
+	},
+	"gcp-pubsub-storage-content": {health()},
+	"gin": {
+		{Name: "list users", Method: http.MethodGet, Path: "/users", Status: http.StatusOK},
+	},
+	"gin-dynamodb-valkey": {health()},
+	"gorm": {
+		{Name: "list users", Method: http.MethodGet, Path: "/users", Status: http.StatusOK},
+	},
+	"grpc-gateway": {
+		health(),
+		{Name: "say hello", Method: http.MethodPost, Path: "/v1/greeter/hello", Body: `{"name":"smoketest"}`, Status: http.StatusOK},
+	},
+	"k8s-downward-api": {
+		health(),
+		{Name: "hello", Method: http.MethodGet, Path: "/hello", Status: http.StatusOK},
+	},
+	"nethttp": {
+		health(),
+		{Name: "list users", Method: http.MethodGet, Path: "/users", Status: http.StatusOK},
+	},
+	"pgx": {
+		{Name: "list tasks", Method: http.MethodGet, Path: "/tasks", Status: http.StatusOK},
+	},
+}
+
+// target is a deployed example to check.
+type target struct {
+	Example string
+	BaseURL string
+}
+
+// parseTargets parses a comma-separated list of example=url pairs, such as
+// "gin=http://gin:8080,grpc-gateway=http://gateway:8080".
+func parseTargets(s string) ([]target, error) {
+	var targets []target
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		example, rawURL, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("target %q is not example=url", pair)
+		}
+		if _, ok := exampleChecks[example]; !ok {
+			return nil, fmt.Errorf("unknown example %q; known examples: %s", example, strings.Join(knownExamples(), ", "))
+		}
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("target %q: %q is not an absolute URL", example, rawURL)
+		}
+		targets = append(targets, target{Example: example, BaseURL: strings.TrimSuffix(rawURL, "/")})
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no targets")
+	}
+	return targets, nil
+}
+
+func knownExamples() []string {
+	names := make([]string, 0, len(exampleChecks))
+	for name := range exampleChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
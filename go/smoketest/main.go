@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// initTelemetry sets up tracing and metrics. The smoke test runs once and
+// exits, so the returned shutdown must run to flush both.
+func initTelemetry(ctx context.Context) (func(context.Context) error, error) {
+	traceExporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP trace exporter: %w", err)
+	}
+	metricExporter, err := otlpmetrichttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP metric exporter: %w", err)
+	}
+
+	// resource.Default() reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	res := resource.Default()
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(traceExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	// Shutdown collects and exports the counts, so no interval is needed
+	mp := sdkmetric.NewMeterProvider(
+		sdkmetric.WithReader(sdkmetric.NewPeriodicReader(metricExporter)),
+		sdkmetric.WithResource(res),
+	)
+	otel.SetMeterProvider(mp)
+	// Baggage carries test.run_id and test.case.name to the examples
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return func(ctx context.Context) error {
+		return errors.Join(tp.Shutdown(ctx), mp.Shutdown(ctx))
+	}, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return v
+	}
+	return fallback
+}
+
+func attempts(res result) string {
+	if res.Attempts == 1 {
+		return ""
+	}
+	return fmt.Sprintf(" (%d attempts)", res.Attempts)
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run checks every target and returns the exit code: 1 if any check failed
+// or the configuration is invalid.
+func run() int {
+	targets, err := parseTargets(os.Getenv("SMOKETEST_TARGETS"))
+	if err != nil {
+		log.Printf("SMOKETEST_TARGETS: %v", err)
+		return 1
+	}
+
+	ctx := context.Background()
+	shutdown, err := initTelemetry(ctx)
+	if err != nil {
+		log.Printf("init telemetry: %v", err)
+		return 1
+	}
+	defer func() {
+		// Export the spans and counts of a failed run before exiting
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdown(shutdownCtx); err != nil {
+			log.Printf("telemetry shutdown: %v", err)
+		}
+	}()
+
+	// Tag the requests as test traffic, so examples that register the
+	// testrun span processor can filter them out
+	runID := getenv("TEST_RUN_ID", testrun.NewRunID())
+	client := &http.Client{
+		Transport: testrun.NewTransport(otelhttp.NewTransport(http.DefaultTransport), runID),
+		Timeout:   getEnvDuration("SMOKETEST_TIMEOUT", 5*time.Second),
+	}
+	r, err := newRunner(client, getEnvDuration("SMOKETEST_RETRY_FOR", 30*time.Second))
+	if err != nil {
+		log.Printf("create runner: %v", err)
+		return 1
+	}
+
+	log.Printf("Smoke testing %d examples (test.run_id=%s)", len(targets), runID)
+	results := r.run(testrun.ContextWithRun(ctx, runID), targets)
+
+	failed := 0
+	for _, res := range results {
+		if res.Passed {
+			fmt.Printf("✓ %s %s%s\n", res.Example, res.Check, attempts(res))
+			continue
+		}
+		failed++
+		fmt.Printf("✗ %s %s: %v%s\n    trace_id=%s span_id=%s\n", res.Example, res.Check, res.Err, attempts(res), res.TraceID, res.SpanID)
+	}
+	fmt.Printf("\n%d passed, %d failed (test.run_id=%s)\n", len(results)-failed, failed, runID)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const scopeName = "github.com/last9/opentelemetry-examples/go/smoketest"
+
+// result is the outcome of one check.
+type result struct {
+	Example  string
+	Check    string
+	Passed   bool
+	Attempts int
+	Err      error
+	// TraceID and SpanID locate the check's span. All checks of a run share
+	// one trace.
+	TraceID string
+	SpanID  string
+}
+
+// runner runs checks, each under its own span, and counts their results.
+type runner struct {
+	client *http.Client
+	tracer trace.Tracer
+	checks metric.Int64Counter
+	// retryFor is how long a failing check is retried, so a deployment that
+	// is still becoming ready is not failed right away.
+	retryFor      time.Duration
+	retryInterval time.Duration
+}
+
+func newRunner(client *http.Client, retryFor time.Duration) (*runner, error) {
+	checks, err := otel.Meter(scopeName).Int64Counter("smoketest.checks",
+		metric.WithDescription("Smoke test checks run, by example, check and result"),
+		metric.WithUnit("{check}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &runner{
+		client:        client,
+		tracer:        otel.Tracer(scopeName),
+		checks:        checks,
+		retryFor:      retryFor,
+		retryInterval: 2 * time.Second,
+	}, nil
+}
+
+// run runs every check of every target, in order, under a smoketest span.
+func (r *runner) run(ctx context.Context, targets []target) []result {
+	ctx, span := r.tracer.Start(ctx, "smoketest")
+	defer span.End()
+
+	var results []result
+	failed := 0
+	for _, t := range targets {
+		for _, c := range exampleChecks[t.Example] {
+			res := r.runCheck(ctx, t, c)
+			if !res.Passed {
+				failed++
+			}
+			results = append(results, res)
+		}
+	}
+
+	span.SetAttributes(
+		attribute.Int("smoketest.checks", len(results)),
+		attribute.Int("smoketest.checks.failed", failed),
+	)
+	if failed > 0 {
+		span.SetStatus(codes.Error, fmt.Sprintf("%d of %d checks failed", failed, len(results)))
+	}
+	return results
+}
+
+// runCheck runs one check until it passes or its retry window ends.
+func (r *runner) runCheck(ctx context.Context, t target, c check) result {
+	ctx = testrun.ContextWithCase(ctx, t.Example+" "+c.Name)
+	ctx, span := r.tracer.Start(ctx, "smoketest "+t.Example+" "+c.Name, trace.WithAttributes(
+		attribute.String("smoketest.example", t.Example),
+		attribute.String("smoketest.check", c.Name),
+		attribute.String("smoketest.request", c.Method+" "+t.BaseURL+c.Path),
+		attribute.Int("smoketest.expected_status", c.Status),
+	))
+	defer span.End()
+
+	res := result{
+		Example: t.Example,
+		Check:   c.Name,
+		TraceID: span.SpanContext().TraceID().String(),
+		SpanID:  span.SpanContext().SpanID().String(),
+	}
+	deadline := time.Now().Add(r.retryFor)
+retry:
+	for {
+		res.Attempts++
+		res.Err = r.attempt(ctx, t, c)
+		if res.Err == nil || time.Now().Add(r.retryInterval).After(deadline) {
+			break
+		}
+		span.AddEvent("smoketest.retry", trace.WithAttributes(
+			attribute.Int("smoketest.attempt", res.Attempts),
+			attribute.String("smoketest.retry.reason", res.Err.Error()),
+		))
+		select {
+		case <-ctx.Done():
+			res.Err = ctx.Err()
+			break retry
+		case <-time.After(r.retryInterval):
+		}
+	}
+
+	resultAttr := "pass"
+	res.Passed = res.Err == nil
+	span.SetAttributes(attribute.Int("smoketest.attempts", res.Attempts))
+	if !res.Passed {
+		resultAttr = "fail"
+		span.RecordError(res.Err)
+		span.SetStatus(codes.Error, res.Err.Error())
+	}
+	span.SetAttributes(attribute.String("smoketest.result", resultAttr))
+	r.checks.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("smoketest.example", t.Example),
+		attribute.String("smoketest.check", c.Name),
+		attribute.String("smoketest.result", resultAttr),
+	))
+	return res
+}
+
+// attempt sends the check's request once, and fails unless the response
+// has the expected status.
+func (r *runner) attempt(ctx context.Context, t target, c check) error {
+	var body io.Reader
+	if c.Body != "" {
+		body = strings.NewReader(c.Body)
+	}
+	req, err := http.NewRequestWithContext(ctx, c.Method, t.BaseURL+c.Path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	// Drain the body so the connection is reused
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != c.Status {
+		return fmt.Errorf("status: want %d, got %d", c.Status, resp.StatusCode)
+	}
+	return nil
+}
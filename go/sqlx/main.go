@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"gin_example/users"
 	"io"
 	"log"
 	"net/http"
+	"os"
 
 	"github.com/gin-gonic/gin"
 	"github.com/jmoiron/sqlx"
@@ -23,8 +26,18 @@ func main() {
 
 	log.Println("✓ go-agent initialized")
 
+	// Startup, until the server is ready, is traced under a service.startup
+	// span, with a span per migration applied
+	ctx, start := beginStartup(context.Background())
+
 	// Initialize database connection with go-agent
-	db := initDB()
+	db, step, err := initDB(ctx)
+	if err != nil {
+		start.end(step, err)
+		// log.Fatalf skips the deferred Shutdown, which sends the span
+		agent.Shutdown()
+		log.Fatalf("failed to start: %v", err)
+	}
 	defer db.Close()
 
 	// Initialize the controller with database connection
@@ -36,45 +49,52 @@ func main() {
 
 	// Routes
 	r.GET("/users", h.GetUsers)
+	r.GET("/users/search", h.SearchUsers)
 	r.GET("/users/:id", h.GetUser)
 	r.POST("/users", h.CreateUser)
+	r.POST("/users/batch", h.CreateUsers)
+	r.PUT("/users/:id/email", h.ChangeEmail)
 	r.PUT("/users/:id", h.UpdateUser)
 	r.DELETE("/users/:id", h.DeleteUser)
 	r.GET("/joke", getRandomJoke)
 
+	start.end("", nil)
 	log.Println("✓ Gin server running on :8080 (instrumented by go-agent)")
 	r.Run()
 }
 
-func initDB() *sqlx.DB {
-	// Open database with go-agent (automatic instrumentation)
+// initDB connects to the database and migrates its schema. It returns the
+// step that failed, "connect" or "migrate", with the error.
+func initDB(ctx context.Context) (*sqlx.DB, string, error) {
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		dsn = "host=localhost port=5432 user=postgres password=your-password-here sslmode=disable"
+	}
+
+	// Open database with go-agent (automatic instrumentation). Every query,
+	// transaction and commit becomes a child span of the request, and
+	// connection pool metrics (db.sql.connections.*) are recorded from
+	// db.Stats().
 	sqlDB, err := dbagent.Open(dbagent.Config{
 		DriverName:   "postgres",
-		DSN:          "host=localhost port=5432 user=postgres password=your-password-here sslmode=disable",
+		DSN:          dsn,
 		DatabaseName: "users",
 	})
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		return nil, "connect", fmt.Errorf("failed to connect to database: %w", err)
 	}
 
 	// Wrap with sqlx
 	db := sqlx.NewDb(sqlDB, "postgres")
 
-	// Create users table if it doesn't exist
-	schema := `
-	CREATE TABLE IF NOT EXISTS users (
-		id VARCHAR(36) PRIMARY KEY,
-		name VARCHAR(100) NOT NULL,
-		email VARCHAR(100) NOT NULL UNIQUE
-	);`
-
-	_, err = db.Exec(schema)
-	if err != nil {
-		log.Fatalf("failed to create users table: %v", err)
+	// Create or update the tables, from the files in migrations
+	if err := runMigrations(ctx, dsn); err != nil {
+		db.Close()
+		return nil, "migrate", err
 	}
 
 	log.Println("✓ sqlx database connected with go-agent instrumentation")
-	return db
+	return db, "", nil
 }
 
 func getRandomJoke(c *gin.Context) {
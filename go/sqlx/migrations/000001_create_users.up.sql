@@ -0,0 +1,7 @@
+-- IF NOT EXISTS, so databases created before migrations were added keep
+-- their table
+CREATE TABLE IF NOT EXISTS users (
+	id VARCHAR(36) PRIMARY KEY,
+	name VARCHAR(100) NOT NULL,
+	email VARCHAR(100) NOT NULL UNIQUE
+);
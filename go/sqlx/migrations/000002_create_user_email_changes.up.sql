@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS user_email_changes (
+	id SERIAL PRIMARY KEY,
+	user_id VARCHAR(36) NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	old_email VARCHAR(100) NOT NULL,
+	new_email VARCHAR(100) NOT NULL,
+	changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS user_email_changes_user_id_idx;
@@ -0,0 +1,3 @@
+-- Deleting a user cascades to its email changes, which scans the table
+-- without an index on the foreign key
+CREATE INDEX IF NOT EXISTS user_email_changes_user_id_idx ON user_email_changes (user_id);
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "gin_example/startup"
+
+// migrations is the schema, applied at startup. Add a pair of
+// NNNNNN_name.up.sql and NNNNNN_name.down.sql files to change it.
+//
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+// startup traces the service's startup under a root "service.startup" span,
+// and records its duration in service.startup.duration.
+type startup struct {
+	span     trace.Span
+	begin    time.Time
+	duration metric.Float64Histogram
+}
+
+// beginStartup starts the service.startup span. Pass the returned context to
+// the startup steps, so their spans are its children.
+func beginStartup(ctx context.Context) (context.Context, *startup) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "service.startup", trace.WithNewRoot())
+	duration, err := otel.Meter(tracerName).Float64Histogram("service.startup.duration",
+		metric.WithDescription("Time from the start of the service until it was ready to serve, or failed to start"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return ctx, &startup{span: span, begin: time.Now(), duration: duration}
+}
+
+// end ends the startup span. step is the step that failed with err, such
+// as "migrate", and is empty on success.
+func (s *startup) end(step string, err error) {
+	var attrs []attribute.KeyValue
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		attrs = append(attrs, attribute.String("error.type", step))
+		s.span.SetAttributes(attrs...)
+	}
+	if s.duration != nil {
+		s.duration.Record(context.Background(), time.Since(s.begin).Seconds(), metric.WithAttributes(attrs...))
+	}
+	s.span.End()
+}
+
+// runMigrations applies the migrations the database doesn't have yet, one
+// version at a time, each under a span of its own.
+//
+// golang-migrate runs its statements without a context, so it gets a plain
+// connection: through go-agent's instrumented driver, every statement would
+// be a trace of its own. The per-version spans stand in for them. Replicas
+// starting together are safe: golang-migrate holds a Postgres advisory lock
+// while it migrates.
+func runMigrations(ctx context.Context, dsn string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return fmt.Errorf("failed to open migration connection: %w", err)
+	}
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+	src, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to read migrations: %w", err)
+	}
+	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
+	if err != nil {
+		db.Close()
+		return fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+	// Closes the source and the database connection
+	defer m.Close()
+	return migrateUp(ctx, m, src)
+}
+
+// migrateUp applies the migrations in src after the database's version.
+func migrateUp(ctx context.Context, m *migrate.Migrate, src source.Driver) error {
+	span := trace.SpanFromContext(ctx)
+	current, dirty, err := m.Version()
+	hasVersion := err == nil
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if dirty {
+		span.SetAttributes(attribute.Bool("db.migration.dirty", true))
+		return fmt.Errorf("schema version %d is dirty: a migration failed partway, fix the schema and force the version with the migrate CLI", current)
+	}
+	if hasVersion {
+		span.SetAttributes(attribute.Int64("db.migration.from_version", int64(current)))
+	}
+
+	applied := 0
+	for {
+		next, err := nextVersion(src, current, hasVersion)
+		if errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to find the next migration: %w", err)
+		}
+		if err := applyMigration(ctx, m, src, next); err != nil {
+			return err
+		}
+		current, hasVersion = next, true
+		applied++
+	}
+
+	span.SetAttributes(attribute.Int("db.migration.applied", applied))
+	if hasVersion {
+		span.SetAttributes(attribute.Int64("db.migration.version", int64(current)))
+	}
+	log.Printf("✓ Schema at version %d, %d migration(s) applied", current, applied)
+	return nil
+}
+
+// nextVersion is the version after current, or the first version if the
+// database has none. It returns os.ErrNotExist if there's none left.
+func nextVersion(src source.Driver, current uint, hasVersion bool) (uint, error) {
+	if !hasVersion {
+		return src.First()
+	}
+	return src.Next(current)
+}
+
+// applyMigration applies the up migration of version under a
+// "migrate {version}" span. A failed migration leaves the schema dirty,
+// which the span records.
+func applyMigration(ctx context.Context, m *migrate.Migrate, src source.Driver, version uint) error {
+	name := ""
+	if r, identifier, err := src.ReadUp(version); err == nil {
+		r.Close()
+		name = identifier
+	}
+	_, span := otel.Tracer(tracerName).Start(ctx, fmt.Sprintf("migrate %d", version),
+		trace.WithAttributes(
+			attribute.String("db.system.name", "postgresql"),
+			attribute.Int64("db.migration.version", int64(version)),
+			attribute.String("db.migration.name", name),
+			attribute.String("db.migration.direction", "up"),
+		))
+	defer span.End()
+
+	if err := m.Steps(1); err != nil {
+		if _, dirty, verr := m.Version(); verr == nil {
+			span.SetAttributes(attribute.Bool("db.migration.dirty", dirty))
+		}
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return fmt.Errorf("migration %d (%s) failed: %w", version, name, err)
+	}
+	log.Printf("✓ Applied migration %d (%s)", version, name)
+	return nil
+}
@@ -2,11 +2,18 @@ package users
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 )
 
+// ErrEmailTaken is returned when another user already has the email.
+var ErrEmailTaken = errors.New("email already in use")
+
 type UsersController struct {
 	db *sqlx.DB
 }
@@ -76,3 +83,91 @@ func (c *UsersController) DeleteUser(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+// SearchUsers finds users whose name contains name. It uses a named query:
+// sqlx binds :pattern from the map and rewrites it to $1 for Postgres, so the
+// span shows the rewritten statement.
+func (c *UsersController) SearchUsers(ctx context.Context, name string) ([]User, error) {
+	rows, err := c.db.NamedQueryContext(ctx,
+		"SELECT * FROM users WHERE name ILIKE :pattern ORDER BY name",
+		map[string]interface{}{"pattern": "%" + name + "%"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search users: %v", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var user User
+		if err := rows.StructScan(&user); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+// CreateUsers inserts users with one statement. Given a slice, NamedExecContext
+// expands the VALUES clause to one row per user, so the batch is a single
+// round trip and a single span.
+func (c *UsersController) CreateUsers(ctx context.Context, users []User) error {
+	for i := range users {
+		users[i].ID = uuid.New().String()
+	}
+	_, err := c.db.NamedExecContext(ctx,
+		"INSERT INTO users (id, name, email) VALUES (:id, :name, :email)",
+		users)
+	if isUniqueViolation(err) {
+		return ErrEmailTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to create users: %v", err)
+	}
+	return nil
+}
+
+// ChangeEmail updates a user's email and records the change in
+// user_email_changes, in one transaction. The user row is locked first, so
+// the old email in the audit row is the one replaced.
+func (c *UsersController) ChangeEmail(ctx context.Context, id, email string) (err error) {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var user User
+	if err := tx.GetContext(ctx, &user, "SELECT * FROM users WHERE id = $1 FOR UPDATE", id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		return fmt.Errorf("failed to get user: %v", err)
+	}
+
+	change := map[string]interface{}{"id": id, "old_email": user.Email, "new_email": email}
+	if _, err := tx.NamedExecContext(ctx, "UPDATE users SET email = :new_email WHERE id = :id", change); err != nil {
+		if isUniqueViolation(err) {
+			return ErrEmailTaken
+		}
+		return fmt.Errorf("failed to update email: %v", err)
+	}
+	if _, err := tx.NamedExecContext(ctx,
+		"INSERT INTO user_email_changes (user_id, old_email, new_email) VALUES (:id, :old_email, :new_email)",
+		change); err != nil {
+		return fmt.Errorf("failed to record email change: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit: %v", err)
+	}
+	return nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
@@ -1,6 +1,8 @@
 package users
 
 import (
+	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 
@@ -111,3 +113,77 @@ func (u *UsersHandler) DeleteUser(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
 }
+
+func (u *UsersHandler) SearchUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	ctx, span := u.tracer.Start(ctx, "search-users")
+	defer span.End()
+
+	users, err := u.controller.SearchUsers(ctx, c.Query("name"))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	span.SetAttributes(attribute.Int("users.count", len(users)))
+
+	c.JSON(http.StatusOK, users)
+}
+
+func (u *UsersHandler) CreateUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	ctx, span := u.tracer.Start(ctx, "create-users")
+	defer span.End()
+
+	var users []User
+	if err := c.ShouldBindJSON(&users); err != nil || len(users) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected a non-empty array of users"})
+		return
+	}
+	span.SetAttributes(attribute.Int("db.operation.batch.size", len(users)))
+
+	if err := u.controller.CreateUsers(ctx, users); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if errors.Is(err, ErrEmailTaken) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, users)
+}
+
+func (u *UsersHandler) ChangeEmail(c *gin.Context) {
+	ctx := c.Request.Context()
+	ctx, span := u.tracer.Start(ctx, "change-email", oteltrace.WithAttributes(
+		attribute.String("user.id", c.Param("id")),
+	))
+	defer span.End()
+
+	var req struct {
+		Email string `json:"email" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := u.controller.ChangeEmail(ctx, c.Param("id"), req.Email)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, gin.H{"message": "Email changed successfully"})
+	case errors.Is(err, sql.ErrNoRows):
+		c.JSON(http.StatusNotFound, gin.H{"message": "User not found"})
+	case errors.Is(err, ErrEmailTaken):
+		span.RecordError(err)
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
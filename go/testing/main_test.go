@@ -0,0 +1,106 @@
+//go:build integration
+
+package main
+
+import (
+	"context"
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"testing_example/users"
+
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
+	"github.com/testcontainers/testcontainers-go"
+	tcpostgres "github.com/testcontainers/testcontainers-go/modules/postgres"
+	tcredis "github.com/testcontainers/testcontainers-go/modules/redis"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	// spans has every span the tests' requests ended, in the order they
+	// ended. Each test resets it first.
+	spans *tracetest.InMemoryExporter
+
+	// server serves the users API on Postgres and Redis in containers.
+	server *httptest.Server
+)
+
+func TestMain(m *testing.M) {
+	os.Exit(run(m))
+}
+
+// run starts Postgres and Redis, then the users API on them, runs the tests,
+// and tears it all down again.
+func run(m *testing.M) int {
+	ctx := context.Background()
+
+	// The tracer provider replaces go-agent's, which the tests don't start.
+	// It must be installed before the database and Redis clients are
+	// created, since their instrumentation takes the global provider then.
+	// The syncer exports each span when it ends, so a test sees its spans
+	// without flushing.
+	spans = tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+	defer tp.Shutdown(ctx)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	pg, err := tcpostgres.Run(ctx, "postgres:16-alpine",
+		tcpostgres.WithDatabase("otel_demo"),
+		tcpostgres.WithUsername("postgres"),
+		tcpostgres.WithPassword("postgres"),
+		tcpostgres.BasicWaitStrategies(),
+	)
+	defer testcontainers.TerminateContainer(pg)
+	if err != nil {
+		log.Printf("failed to start postgres: %v", err)
+		return 1
+	}
+	dsn, err := pg.ConnectionString(ctx, "sslmode=disable")
+	if err != nil {
+		log.Printf("failed to get the postgres DSN: %v", err)
+		return 1
+	}
+
+	rc, err := tcredis.Run(ctx, "redis:7-alpine")
+	defer testcontainers.TerminateContainer(rc)
+	if err != nil {
+		log.Printf("failed to start redis: %v", err)
+		return 1
+	}
+	addr, err := rc.Endpoint(ctx, "")
+	if err != nil {
+		log.Printf("failed to get the redis address: %v", err)
+		return 1
+	}
+
+	// The same clients and service main uses, on the containers
+	db, err := openDB(dsn)
+	if err != nil {
+		log.Printf("failed to open the database: %v", err)
+		return 1
+	}
+	defer db.Close()
+	redisClient, err := openRedis(addr)
+	if err != nil {
+		log.Printf("failed to instrument redis: %v", err)
+		return 1
+	}
+	defer redisClient.Close()
+
+	svc := commonusers.NewService(db, redisClient)
+	if err := svc.EnsureSchema(ctx); err != nil {
+		log.Printf("failed to ensure the users schema: %v", err)
+		return 1
+	}
+
+	server = httptest.NewServer(users.NewRouter(svc))
+	defer server.Close()
+
+	return m.Run()
+}
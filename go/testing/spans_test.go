@@ -0,0 +1,122 @@
+//go:build integration
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// waitFor returns the first span named name. otelhttp ends the server span
+// after the handler returns, which can be after the client has read the
+// response, so it waits a little for the span to end.
+func waitFor(t *testing.T, name string) tracetest.SpanStub {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		for _, s := range spans.GetSpans() {
+			if s.Name == name {
+				return s
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no span named %q, got %s", name, spanNames(spans.GetSpans()))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// children returns the spans whose parent is parent, in the order they
+// ended.
+func children(parent tracetest.SpanStub) tracetest.SpanStubs {
+	var out tracetest.SpanStubs
+	for _, s := range spans.GetSpans() {
+		if s.Parent.SpanID() == parent.SpanContext.SpanID() {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// child returns the first child of parent named name, and fails the test if
+// there's none.
+func child(t *testing.T, parent tracetest.SpanStub, name string) tracetest.SpanStub {
+	t.Helper()
+	kids := children(parent)
+	for _, s := range kids {
+		if s.Name == name {
+			return s
+		}
+	}
+	t.Fatalf("%q has no child named %q, its children are %s", parent.Name, name, spanNames(kids))
+	return tracetest.SpanStub{}
+}
+
+// hasChild reports whether parent has a child named name.
+func hasChild(parent tracetest.SpanStub, name string) bool {
+	for _, s := range children(parent) {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// assertAttrs fails the test unless span has every attribute in want.
+func assertAttrs(t *testing.T, span tracetest.SpanStub, want ...attribute.KeyValue) {
+	t.Helper()
+	got := attribute.NewSet(span.Attributes...)
+	for _, kv := range want {
+		v, ok := got.Value(kv.Key)
+		if !ok {
+			t.Errorf("%q has no attribute %s", span.Name, kv.Key)
+			continue
+		}
+		if v != kv.Value {
+			t.Errorf("%q has %s=%s, want %s", span.Name, kv.Key, v.Emit(), kv.Value.Emit())
+		}
+	}
+}
+
+// attr returns the value of span's attribute key, and fails the test if it
+// has none.
+func attr(t *testing.T, span tracetest.SpanStub, key attribute.Key) attribute.Value {
+	t.Helper()
+	set := attribute.NewSet(span.Attributes...)
+	v, ok := set.Value(key)
+	if !ok {
+		t.Fatalf("%q has no attribute %s", span.Name, key)
+	}
+	return v
+}
+
+// assertKind fails the test unless span is of kind want.
+func assertKind(t *testing.T, span tracetest.SpanStub, want trace.SpanKind) {
+	t.Helper()
+	if span.SpanKind != want {
+		t.Errorf("%q is a %s span, want %s", span.Name, span.SpanKind, want)
+	}
+}
+
+// hasEvent reports whether span has an event named name.
+func hasEvent(span tracetest.SpanStub, name string) bool {
+	for _, e := range span.Events {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func spanNames(stubs tracetest.SpanStubs) string {
+	names := make([]string, len(stubs))
+	for i, s := range stubs {
+		names[i] = s.Name
+	}
+	return "[" + strings.Join(names, ", ") + "]"
+}
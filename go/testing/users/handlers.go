@@ -0,0 +1,112 @@
+package users
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/last9/opentelemetry-examples/go/common/otelerr"
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// UsersHandler adapts the shared users service to net/http.
+type UsersHandler struct {
+	service *commonusers.Service
+}
+
+func NewUsersHandler(s *commonusers.Service) *UsersHandler {
+	return &UsersHandler{
+		service: s,
+	}
+}
+
+// NewRouter returns the users API, with a server span per request named
+// after its route, such as "GET /users/{id}".
+//
+// It uses otelhttp rather than go-agent's nethttp package, which starts the
+// agent if it isn't started yet. The tests install their own tracer
+// provider instead of starting the agent, and the router must not replace it.
+func NewRouter(svc *commonusers.Service) http.Handler {
+	h := NewUsersHandler(svc)
+	mux := http.NewServeMux()
+	handle := func(pattern string, f http.HandlerFunc) {
+		mux.Handle(pattern, otelhttp.NewHandler(f, pattern))
+	}
+	handle("GET /users", h.GetUsers)
+	handle("GET /users/{id}", h.GetUser)
+	handle("POST /users", h.CreateUser)
+	handle("PUT /users/{id}", h.UpdateUser)
+	handle("DELETE /users/{id}", h.DeleteUser)
+	return mux
+}
+
+func (u *UsersHandler) GetUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := u.service.List(r.Context())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, users)
+}
+
+func (u *UsersHandler) GetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := u.service.Get(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (u *UsersHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var in commonusers.CreateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
+		return
+	}
+	user, err := u.service.Create(r.Context(), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, user)
+}
+
+func (u *UsersHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	var in commonusers.UpdateInput
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		writeError(w, r, commonusers.ErrInvalidInput)
+		return
+	}
+	user, err := u.service.Update(r.Context(), r.PathValue("id"), in)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, user)
+}
+
+func (u *UsersHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	if err := u.service.Delete(r.Context(), r.PathValue("id")); err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes the error response. Server errors are also recorded on
+// the request span, with the stack of the service operation that failed; the
+// service span already carries the error itself.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	status := commonusers.StatusCode(err)
+	if status >= http.StatusInternalServerError {
+		otelerr.Record(r.Context(), err)
+	}
+	writeJSON(w, status, commonusers.ErrorBody(err))
+}
@@ -0,0 +1,245 @@
+//go:build integration
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	commonusers "github.com/last9/opentelemetry-examples/go/common/users"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// A request to the users API is traced as:
+//
+//	POST /users              server span, from otelhttp
+//	└── users.Create         internal span, from the users service
+//	    ├── sql:query        client span, from go-agent's database integration
+//	    └── del              client span, from go-agent's Redis integration
+//
+// The tests assert that tree, and the attributes on it that dashboards and
+// alerts rely on.
+
+func TestCreateUser(t *testing.T) {
+	spans.Reset()
+
+	var user commonusers.User
+	status := call(t, http.DefaultClient, http.MethodPost, "/users", newUser(t), &user)
+	if status != http.StatusCreated {
+		t.Fatalf("POST /users: got %d, want %d", status, http.StatusCreated)
+	}
+
+	srv := waitFor(t, "POST /users")
+	assertKind(t, srv, trace.SpanKindServer)
+	if srv.Parent.IsValid() {
+		t.Errorf("%q has a parent, want a root span", srv.Name)
+	}
+	assertAttrs(t, srv,
+		attribute.String("http.method", http.MethodPost),
+		attribute.Int("http.status_code", http.StatusCreated),
+	)
+
+	create := child(t, srv, "users.Create")
+	assertKind(t, create, trace.SpanKindInternal)
+	assertAttrs(t, create, attribute.String("user.id", user.ID))
+
+	insert := child(t, create, "sql:query")
+	assertKind(t, insert, trace.SpanKindClient)
+	assertAttrs(t, insert, attribute.String("db.system", "postgresql"))
+	if stmt := attr(t, insert, "db.statement").AsString(); !strings.HasPrefix(stmt, "INSERT INTO users") {
+		t.Errorf("%q has db.statement %q, want an INSERT INTO users", insert.Name, stmt)
+	}
+
+	// Creating a user invalidates the cached list
+	invalidate := child(t, create, "del")
+	assertKind(t, invalidate, trace.SpanKindClient)
+	assertAttrs(t, invalidate, attribute.String("db.system", "redis"))
+}
+
+func TestGetUserCaching(t *testing.T) {
+	user := createUser(t)
+	path := "/users/" + user.ID
+
+	// The first read misses the cache, reads Postgres and fills the cache
+	spans.Reset()
+	if status := call(t, http.DefaultClient, http.MethodGet, path, nil, nil); status != http.StatusOK {
+		t.Fatalf("GET %s: got %d, want %d", path, status, http.StatusOK)
+	}
+	get := child(t, waitFor(t, "GET /users/{id}"), "users.Get")
+	assertAttrs(t, get,
+		attribute.String("user.id", user.ID),
+		attribute.Bool("cache.hit", false),
+	)
+	child(t, get, "get")
+	query := child(t, get, "sql:query")
+	if stmt := attr(t, query, "db.statement").AsString(); !strings.Contains(stmt, "FROM users WHERE id") {
+		t.Errorf("%q has db.statement %q, want a SELECT of one user", query.Name, stmt)
+	}
+	child(t, get, "set")
+
+	// The second is served from Redis, without a query
+	spans.Reset()
+	if status := call(t, http.DefaultClient, http.MethodGet, path, nil, nil); status != http.StatusOK {
+		t.Fatalf("GET %s: got %d, want %d", path, status, http.StatusOK)
+	}
+	get = child(t, waitFor(t, "GET /users/{id}"), "users.Get")
+	assertAttrs(t, get, attribute.Bool("cache.hit", true))
+	child(t, get, "get")
+	if hasChild(get, "sql:query") {
+		t.Errorf("%q queried Postgres on a cache hit", get.Name)
+	}
+}
+
+func TestGetUserNotFound(t *testing.T) {
+	spans.Reset()
+
+	path := "/users/00000000-0000-4000-8000-000000000000"
+	if status := call(t, http.DefaultClient, http.MethodGet, path, nil, nil); status != http.StatusNotFound {
+		t.Fatalf("GET %s: got %d, want %d", path, status, http.StatusNotFound)
+	}
+
+	// A client error is not an error of the service: no span has an error
+	// status, and the service span says why the request was rejected
+	srv := waitFor(t, "GET /users/{id}")
+	assertAttrs(t, srv, attribute.Int("http.status_code", http.StatusNotFound))
+	if srv.Status.Code != codes.Unset {
+		t.Errorf("%q has status %s, want Unset", srv.Name, srv.Status.Code)
+	}
+	get := child(t, srv, "users.Get")
+	if get.Status.Code != codes.Unset {
+		t.Errorf("%q has status %s, want Unset", get.Name, get.Status.Code)
+	}
+	if !hasEvent(get, "users.rejected") {
+		t.Errorf("%q has no users.rejected event", get.Name)
+	}
+}
+
+func TestCreateUserConflict(t *testing.T) {
+	user := createUser(t)
+	spans.Reset()
+
+	body := map[string]string{"name": "Someone Else", "email": user.Email}
+	if status := call(t, http.DefaultClient, http.MethodPost, "/users", body, nil); status != http.StatusConflict {
+		t.Fatalf("POST /users with a duplicate email: got %d, want %d", status, http.StatusConflict)
+	}
+
+	// Postgres rejected the insert, so its span is an error. The service
+	// answered correctly, so its span isn't
+	create := child(t, waitFor(t, "POST /users"), "users.Create")
+	if create.Status.Code != codes.Unset {
+		t.Errorf("%q has status %s, want Unset", create.Name, create.Status.Code)
+	}
+	if !hasEvent(create, "users.rejected") {
+		t.Errorf("%q has no users.rejected event", create.Name)
+	}
+	insert := child(t, create, "sql:query")
+	if insert.Status.Code != codes.Error {
+		t.Errorf("%q has status %s, want Error", insert.Name, insert.Status.Code)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	user := createUser(t)
+	spans.Reset()
+
+	path := "/users/" + user.ID
+	if status := call(t, http.DefaultClient, http.MethodDelete, path, nil, nil); status != http.StatusNoContent {
+		t.Fatalf("DELETE %s: got %d, want %d", path, status, http.StatusNoContent)
+	}
+
+	del := child(t, waitFor(t, "DELETE /users/{id}"), "users.Delete")
+	assertAttrs(t, del, attribute.String("user.id", user.ID))
+	exec := child(t, del, "sql:exec")
+	if stmt := attr(t, exec, "db.statement").AsString(); !strings.HasPrefix(stmt, "DELETE FROM users") {
+		t.Errorf("%q has db.statement %q, want a DELETE FROM users", exec.Name, stmt)
+	}
+	child(t, del, "del")
+}
+
+// TestTraceContextPropagation checks that the server continues the trace of
+// an instrumented caller, instead of starting one of its own.
+func TestTraceContextPropagation(t *testing.T) {
+	spans.Reset()
+
+	ctx, caller := otel.Tracer("testing_example").Start(context.Background(), "caller")
+	client := &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+	status := callContext(ctx, t, client, http.MethodGet, "/users", nil, nil)
+	caller.End()
+	if status != http.StatusOK {
+		t.Fatalf("GET /users: got %d, want %d", status, http.StatusOK)
+	}
+
+	srv := waitFor(t, "GET /users")
+	out := child(t, waitFor(t, "caller"), "HTTP GET")
+	assertKind(t, out, trace.SpanKindClient)
+	if srv.Parent.SpanID() != out.SpanContext.SpanID() {
+		t.Errorf("%q has parent %s, want the client span %s", srv.Name, srv.Parent.SpanID(), out.SpanContext.SpanID())
+	}
+	if srv.SpanContext.TraceID() != caller.SpanContext().TraceID() {
+		t.Errorf("%q is in trace %s, want the caller's %s", srv.Name, srv.SpanContext.TraceID(), caller.SpanContext().TraceID())
+	}
+	if !srv.Parent.IsRemote() {
+		t.Errorf("%q has a local parent, want the remote client span", srv.Name)
+	}
+}
+
+// newUser returns the body of a user to create, with an email no other test
+// uses, since emails are unique.
+func newUser(t *testing.T) map[string]string {
+	return map[string]string{
+		"name":  "Ada Lovelace",
+		"email": fmt.Sprintf("%s-%d@example.com", strings.ToLower(t.Name()), time.Now().UnixNano()),
+	}
+}
+
+// createUser creates a user for a test to read, update or delete.
+func createUser(t *testing.T) commonusers.User {
+	t.Helper()
+	var user commonusers.User
+	if status := call(t, http.DefaultClient, http.MethodPost, "/users", newUser(t), &user); status != http.StatusCreated {
+		t.Fatalf("POST /users: got %d, want %d", status, http.StatusCreated)
+	}
+	return user
+}
+
+// call sends body as JSON to path on the server, decodes the response into
+// out if it's not nil, and returns the status.
+func call(t *testing.T, client *http.Client, method, path string, body, out any) int {
+	t.Helper()
+	return callContext(context.Background(), t, client, method, path, body, out)
+}
+
+func callContext(ctx context.Context, t *testing.T, client *http.Client, method, path string, body, out any) int {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, server.URL+path, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: decoding the response: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
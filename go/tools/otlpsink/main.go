@@ -0,0 +1,239 @@
+// otlpsink is an OTLP receiver for tests. It accepts traces, metrics and
+// logs over OTLP/HTTP, in protobuf or JSON, and over OTLP/gRPC, all on one
+// port, and keeps them in memory so a test can ask what an example sent:
+//
+//	GET    /api/spans?service=nethttp&name=GET+/users
+//	GET    /api/metrics?service=nethttp
+//	GET    /api/logs
+//	DELETE /api/telemetry
+//
+// The runner in ../runner starts it for every run. Nothing is forwarded.
+package main
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	collectorlogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	collectormetricspb "go.opentelemetry.io/proto/otlp/collector/metrics/v1"
+	collectortracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	// OTLP/gRPC exporters compress with gzip when configured to
+	_ "google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxBodySize caps an OTLP/HTTP request body, after decompression.
+const maxBodySize = 32 << 20
+
+func main() {
+	addr := flag.String("addr", getenv("OTLPSINK_ADDR", "localhost:4318"), "address to listen on, for OTLP/HTTP, OTLP/gRPC and the query API")
+	verbose := flag.Bool("v", false, "log every span received")
+	flag.Parse()
+
+	s := newStore()
+	srv := newServer(s, *verbose)
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatalf("listen: %v", err)
+	}
+	// The runner reads the address from this line, so it can pass :0
+	fmt.Printf("otlpsink listening on %s\n", ln.Addr())
+
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("serve: %v", err)
+		}
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+}
+
+// newServer serves OTLP/gRPC and OTLP/HTTP on the same port. OTLP/gRPC
+// clients, such as go-agent's metric exporter, speak HTTP/2 without TLS, so
+// the server accepts it, and passes requests with a gRPC content type to the
+// gRPC server.
+func newServer(s *store, verbose bool) *http.Server {
+	grpcServer := grpc.NewServer()
+	collectortracepb.RegisterTraceServiceServer(grpcServer, &traceService{store: s, verbose: verbose})
+	collectormetricspb.RegisterMetricsServiceServer(grpcServer, &metricsService{store: s})
+	collectorlogspb.RegisterLogsServiceServer(grpcServer, &logsService{store: s})
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		req := &collectortracepb.ExportTraceServiceRequest{}
+		if !decode(w, r, req) {
+			return
+		}
+		logSpans(s.addSpans(req.GetResourceSpans()), verbose)
+		encode(w, r, &collectortracepb.ExportTraceServiceResponse{})
+	})
+	mux.HandleFunc("POST /v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		req := &collectormetricspb.ExportMetricsServiceRequest{}
+		if !decode(w, r, req) {
+			return
+		}
+		s.addMetrics(req.GetResourceMetrics())
+		encode(w, r, &collectormetricspb.ExportMetricsServiceResponse{})
+	})
+	mux.HandleFunc("POST /v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		req := &collectorlogspb.ExportLogsServiceRequest{}
+		if !decode(w, r, req) {
+			return
+		}
+		s.addLogs(req.GetResourceLogs())
+		encode(w, r, &collectorlogspb.ExportLogsServiceResponse{})
+	})
+
+	mux.HandleFunc("GET /api/spans", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		writeJSON(w, map[string]any{"spans": s.findSpans(q.Get("service"), q.Get("name"))})
+	})
+	mux.HandleFunc("GET /api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"metrics": s.listMetrics(r.URL.Query().Get("service"))})
+	})
+	mux.HandleFunc("GET /api/logs", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"records_by_service": s.logCounts()})
+	})
+	mux.HandleFunc("DELETE /api/telemetry", func(w http.ResponseWriter, r *http.Request) {
+		s.reset()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				grpcServer.ServeHTTP(w, r)
+				return
+			}
+			mux.ServeHTTP(w, r)
+		}),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	srv.Protocols = new(http.Protocols)
+	srv.Protocols.SetHTTP1(true)
+	srv.Protocols.SetUnencryptedHTTP2(true)
+	return srv
+}
+
+// decode reads an OTLP/HTTP request body into msg, as JSON or protobuf by
+// its content type. On failure it answers 400 and returns false.
+func decode(w http.ResponseWriter, r *http.Request, msg proto.Message) bool {
+	var body io.Reader = r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return false
+		}
+		defer gz.Close()
+		body = gz
+	}
+	data, err := io.ReadAll(io.LimitReader(body, maxBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if isJSON(r) {
+		err = protojson.Unmarshal(data, msg)
+	} else {
+		err = proto.Unmarshal(data, msg)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// encode answers an OTLP/HTTP request with msg, in the request's encoding.
+func encode(w http.ResponseWriter, r *http.Request, msg proto.Message) {
+	var data []byte
+	if isJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		data, _ = protojson.Marshal(msg)
+	} else {
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		data, _ = proto.Marshal(msg)
+	}
+	w.Write(data)
+}
+
+func isJSON(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func logSpans(spans []span, verbose bool) {
+	if !verbose {
+		return
+	}
+	for _, sp := range spans {
+		log.Printf("span %s %q kind=%s status=%s trace_id=%s", sp.Service, sp.Name, sp.Kind, sp.Status, sp.TraceID)
+	}
+}
+
+type traceService struct {
+	collectortracepb.UnimplementedTraceServiceServer
+	store   *store
+	verbose bool
+}
+
+func (t *traceService) Export(_ context.Context, req *collectortracepb.ExportTraceServiceRequest) (*collectortracepb.ExportTraceServiceResponse, error) {
+	logSpans(t.store.addSpans(req.GetResourceSpans()), t.verbose)
+	return &collectortracepb.ExportTraceServiceResponse{}, nil
+}
+
+type metricsService struct {
+	collectormetricspb.UnimplementedMetricsServiceServer
+	store *store
+}
+
+func (m *metricsService) Export(_ context.Context, req *collectormetricspb.ExportMetricsServiceRequest) (*collectormetricspb.ExportMetricsServiceResponse, error) {
+	m.store.addMetrics(req.GetResourceMetrics())
+	return &collectormetricspb.ExportMetricsServiceResponse{}, nil
+}
+
+type logsService struct {
+	collectorlogspb.UnimplementedLogsServiceServer
+	store *store
+}
+
+func (l *logsService) Export(_ context.Context, req *collectorlogspb.ExportLogsServiceRequest) (*collectorlogspb.ExportLogsServiceResponse, error) {
+	l.store.addLogs(req.GetResourceLogs())
+	return &collectorlogspb.ExportLogsServiceResponse{}, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
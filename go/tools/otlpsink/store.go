@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	metricspb "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// span is a received span, flattened for assertions: its service and scope
+// are copied from the resource and scope it was sent under.
+type span struct {
+	Service      string         `json:"service"`
+	Scope        string         `json:"scope"`
+	Name         string         `json:"name"`
+	Kind         string         `json:"kind"`
+	TraceID      string         `json:"trace_id"`
+	SpanID       string         `json:"span_id"`
+	ParentSpanID string         `json:"parent_span_id,omitempty"`
+	Status       string         `json:"status"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	Events       []event        `json:"events,omitempty"`
+}
+
+type event struct {
+	Name       string         `json:"name"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+// metric is a metric name a service has sent at least once.
+type metric struct {
+	Service string `json:"service"`
+	Name    string `json:"name"`
+}
+
+// store keeps everything received since the last reset, in memory.
+type store struct {
+	mu      sync.Mutex
+	spans   []span
+	metrics map[metric]struct{}
+	// logs counts log records by service
+	logs map[string]int
+}
+
+func newStore() *store {
+	return &store{metrics: map[metric]struct{}{}, logs: map[string]int{}}
+}
+
+func (s *store) addSpans(resourceSpans []*tracepb.ResourceSpans) []span {
+	var added []span
+	for _, rs := range resourceSpans {
+		service := serviceName(rs.GetResource())
+		for _, ss := range rs.GetScopeSpans() {
+			for _, sp := range ss.GetSpans() {
+				added = append(added, span{
+					Service:      service,
+					Scope:        ss.GetScope().GetName(),
+					Name:         sp.GetName(),
+					Kind:         spanKind(sp.GetKind()),
+					TraceID:      hex.EncodeToString(sp.GetTraceId()),
+					SpanID:       hex.EncodeToString(sp.GetSpanId()),
+					ParentSpanID: hex.EncodeToString(sp.GetParentSpanId()),
+					Status:       statusCode(sp.GetStatus().GetCode()),
+					Attributes:   attributes(sp.GetAttributes()),
+					Events:       events(sp.GetEvents()),
+				})
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = append(s.spans, added...)
+	return added
+}
+
+func (s *store) addMetrics(resourceMetrics []*metricspb.ResourceMetrics) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rm := range resourceMetrics {
+		service := serviceName(rm.GetResource())
+		for _, sm := range rm.GetScopeMetrics() {
+			for _, m := range sm.GetMetrics() {
+				s.metrics[metric{Service: service, Name: m.GetName()}] = struct{}{}
+			}
+		}
+	}
+}
+
+func (s *store) addLogs(resourceLogs []*logspb.ResourceLogs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, rl := range resourceLogs {
+		service := serviceName(rl.GetResource())
+		for _, sl := range rl.GetScopeLogs() {
+			s.logs[service] += len(sl.GetLogRecords())
+		}
+	}
+}
+
+// findSpans returns the spans matching service and name, in the order they
+// were received. An empty filter matches every span.
+func (s *store) findSpans(service, name string) []span {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []span{}
+	for _, sp := range s.spans {
+		if (service == "" || sp.Service == service) && (name == "" || sp.Name == name) {
+			found = append(found, sp)
+		}
+	}
+	return found
+}
+
+// listMetrics returns the metric names received, sorted by service and name.
+func (s *store) listMetrics(service string) []metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	found := []metric{}
+	for m := range s.metrics {
+		if service == "" || m.Service == service {
+			found = append(found, m)
+		}
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].Service != found[j].Service {
+			return found[i].Service < found[j].Service
+		}
+		return found[i].Name < found[j].Name
+	})
+	return found
+}
+
+func (s *store) logCounts() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	counts := make(map[string]int, len(s.logs))
+	for service, n := range s.logs {
+		counts[service] = n
+	}
+	return counts
+}
+
+func (s *store) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.spans = nil
+	s.metrics = map[metric]struct{}{}
+	s.logs = map[string]int{}
+}
+
+func serviceName(res *resourcepb.Resource) string {
+	for _, kv := range res.GetAttributes() {
+		if kv.GetKey() == "service.name" {
+			return kv.GetValue().GetStringValue()
+		}
+	}
+	return ""
+}
+
+func spanKind(kind tracepb.Span_SpanKind) string {
+	switch kind {
+	case tracepb.Span_SPAN_KIND_INTERNAL:
+		return "internal"
+	case tracepb.Span_SPAN_KIND_SERVER:
+		return "server"
+	case tracepb.Span_SPAN_KIND_CLIENT:
+		return "client"
+	case tracepb.Span_SPAN_KIND_PRODUCER:
+		return "producer"
+	case tracepb.Span_SPAN_KIND_CONSUMER:
+		return "consumer"
+	}
+	return "unspecified"
+}
+
+func statusCode(code tracepb.Status_StatusCode) string {
+	switch code {
+	case tracepb.Status_STATUS_CODE_OK:
+		return "ok"
+	case tracepb.Status_STATUS_CODE_ERROR:
+		return "error"
+	}
+	return "unset"
+}
+
+func events(evs []*tracepb.Span_Event) []event {
+	if len(evs) == 0 {
+		return nil
+	}
+	out := make([]event, 0, len(evs))
+	for _, ev := range evs {
+		out = append(out, event{Name: ev.GetName(), Attributes: attributes(ev.GetAttributes())})
+	}
+	return out
+}
+
+func attributes(kvs []*commonpb.KeyValue) map[string]any {
+	if len(kvs) == 0 {
+		return nil
+	}
+	attrs := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		attrs[kv.GetKey()] = value(kv.GetValue())
+	}
+	return attrs
+}
+
+// value converts an attribute value to its JSON equivalent. Bytes are hex
+// encoded.
+func value(v *commonpb.AnyValue) any {
+	switch v := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return v.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return v.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return v.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return v.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return hex.EncodeToString(v.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		values := make([]any, 0, len(v.ArrayValue.GetValues()))
+		for _, item := range v.ArrayValue.GetValues() {
+			values = append(values, value(item))
+		}
+		return values
+	case *commonpb.AnyValue_KvlistValue:
+		return attributes(v.KvlistValue.GetValues())
+	}
+	return nil
+}
@@ -0,0 +1,19 @@
+module github.com/last9/opentelemetry-examples/go/tools/runner
+
+go 1.24.0
+
+require github.com/last9/opentelemetry-examples/go/common v0.0.0
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	go.opentelemetry.io/auto/sdk v1.1.0 // indirect
+	go.opentelemetry.io/otel v1.36.0 // indirect
+	go.opentelemetry.io/otel/metric v1.36.0 // indirect
+	go.opentelemetry.io/otel/sdk v1.36.0 // indirect
+	go.opentelemetry.io/otel/trace v1.36.0 // indirect
+	golang.org/x/sys v0.33.0 // indirect
+)
+
+replace github.com/last9/opentelemetry-examples/go/common => ../../common
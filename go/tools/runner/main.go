@@ -0,0 +1,202 @@
+// runner builds the Go examples and runs their smoke scenarios against an
+// in-repo OTLP sink, so every example can be checked with one command:
+//
+//	go run . build            # build every module under go/
+//	go run . run nethttp gin  # start each example, send its steps, assert its spans
+//	go run . list             # the examples run knows, and what they need
+//
+// Run it from go/tools/runner, or pass -root.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `usage: runner <command> [flags] [example...]
+
+commands:
+  build   build, and with -vet vet, every module under go/, or the given ones
+  run     run the smoke scenario of every known example, or the given ones
+  list    list the examples run knows
+
+Run "runner <command> -h" for the command's flags.
+`)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var code int
+	switch os.Args[1] {
+	case "build":
+		code = buildCommand(ctx, os.Args[2:])
+	case "run":
+		code = runCommand(ctx, os.Args[2:])
+	case "list":
+		code = listCommand()
+	default:
+		usage()
+		code = 2
+	}
+	os.Exit(code)
+}
+
+func buildCommand(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	root := fs.String("root", "", "the repository's go directory (default: found from the working directory)")
+	vet := fs.Bool("vet", false, "also run go vet")
+	fs.Parse(args)
+
+	goDir, err := findRoot(*root)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	dirs := fs.Args()
+	if len(dirs) == 0 {
+		if dirs, err = modules(goDir); err != nil {
+			log.Print(err)
+			return 1
+		}
+	}
+
+	failed := 0
+	for _, dir := range dirs {
+		start := time.Now()
+		if err := buildModule(ctx, filepath.Join(goDir, dir), *vet); err != nil {
+			failed++
+			fmt.Printf("✗ %s: %v\n", dir, err)
+			continue
+		}
+		fmt.Printf("✓ %s (%s)\n", dir, time.Since(start).Round(100*time.Millisecond))
+	}
+	fmt.Printf("\n%d built, %d failed\n", len(dirs)-failed, failed)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runCommand(ctx context.Context, args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	root := fs.String("root", "", "the repository's go directory (default: found from the working directory)")
+	readyTimeout := fs.Duration("ready-timeout", 60*time.Second, "how long an example may take to become ready")
+	spanTimeout := fs.Duration("span-timeout", 15*time.Second, "how long to wait for the expected spans after the steps")
+	keepDeps := fs.Bool("keep-deps", false, "leave dependency containers running")
+	fs.Parse(args)
+
+	goDir, err := findRoot(*root)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	names := fs.Args()
+	if len(names) == 0 {
+		names = exampleNames()
+	}
+	for _, name := range names {
+		if _, ok := examples[name]; !ok {
+			log.Printf("unknown example %q; known: %s", name, strings.Join(exampleNames(), ", "))
+			return 1
+		}
+	}
+
+	binDir, err := os.MkdirTemp("", "runner-")
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	s, err := startSink(ctx, goDir, binDir)
+	if err != nil {
+		log.Print(err)
+		return 1
+	}
+	defer s.stop()
+
+	opts := options{
+		Root:         goDir,
+		BinDir:       binDir,
+		RunID:        testrun.NewRunID(),
+		ReadyTimeout: *readyTimeout,
+		SpanTimeout:  *spanTimeout,
+		KeepDeps:     *keepDeps,
+	}
+	log.Printf("Running %d examples against %s (test.run_id=%s, logs in %s)", len(names), s.Endpoint, opts.RunID, binDir)
+
+	failed := 0
+	for _, name := range names {
+		out := runExample(ctx, opts, s, name, examples[name])
+		if out.Err == nil {
+			fmt.Printf("✓ %s (%d steps, %d spans)\n", name, out.Steps, out.Spans)
+			continue
+		}
+		failed++
+		fmt.Printf("✗ %s: %v\n", name, out.Err)
+		for _, exp := range out.Missed {
+			fmt.Printf("    missing span %s\n", exp)
+		}
+		if len(out.Received) > 0 {
+			fmt.Printf("    received: %s\n", strings.Join(out.Received, ", "))
+		}
+		fmt.Printf("    log: %s\n", out.LogTo)
+		if errors.Is(ctx.Err(), context.Canceled) {
+			break
+		}
+	}
+	fmt.Printf("\n%d passed, %d failed (test.run_id=%s)\n", len(names)-failed, failed, opts.RunID)
+	if failed > 0 {
+		return 1
+	}
+	os.RemoveAll(binDir)
+	return 0
+}
+
+func listCommand() int {
+	for _, name := range exampleNames() {
+		ex := examples[name]
+		needs := "no dependencies"
+		if ex.Deps != nil {
+			needs = fmt.Sprintf("%s from %s", strings.Join(ex.Deps.Services, ", "), ex.Deps.File)
+		}
+		fmt.Printf("%-14s %d steps, %d spans, %s\n", name, len(ex.Steps), len(ex.Spans), needs)
+	}
+	return 0
+}
+
+// findRoot returns dir, or the nearest directory from the working
+// directory up that has the common module, which is the go directory.
+func findRoot(dir string) (string, error) {
+	if dir != "" {
+		return filepath.Abs(dir)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for d := wd; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "common", "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", fmt.Errorf("no go directory above %s; pass -root", wd)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+)
+
+// options are the settings shared by every example of a run.
+type options struct {
+	Root   string
+	BinDir string
+	RunID  string
+	// ReadyTimeout bounds how long an example may take to start.
+	ReadyTimeout time.Duration
+	// SpanTimeout bounds how long the runner waits for expected spans once
+	// the steps are done.
+	SpanTimeout time.Duration
+	// KeepDeps leaves the example's containers running.
+	KeepDeps bool
+}
+
+// outcome is the result of running one example.
+type outcome struct {
+	Name   string
+	Err    error
+	Steps  int
+	Spans  int
+	LogTo  string
+	Missed []spanExpectation
+	// Received are the distinct names of the spans received, listed when
+	// an expectation was missed.
+	Received []string
+}
+
+// runExample starts the example's dependencies, builds and starts the
+// example against the sink, sends its steps, and waits for its spans.
+func runExample(ctx context.Context, opts options, s *sink, name string, ex example) outcome {
+	out := outcome{Name: name, LogTo: filepath.Join(opts.BinDir, name+".log")}
+	if err := s.reset(ctx); err != nil {
+		out.Err = fmt.Errorf("reset sink: %w", err)
+		return out
+	}
+
+	if ex.Deps != nil {
+		if err := composeUp(ctx, opts.Root, ex.Deps); err != nil {
+			out.Err = err
+			return out
+		}
+		if !opts.KeepDeps {
+			defer composeDown(opts.Root, ex.Deps)
+		}
+	}
+
+	bin := filepath.Join(opts.BinDir, name)
+	dir := filepath.Join(opts.Root, ex.Dir)
+	if err := goBuild(ctx, dir, ex.Package, bin); err != nil {
+		out.Err = fmt.Errorf("build: %w", err)
+		return out
+	}
+
+	logFile, err := os.Create(out.LogTo)
+	if err != nil {
+		out.Err = err
+		return out
+	}
+	defer logFile.Close()
+
+	// Examples read files, such as openfeature's flags.json, from their
+	// own directory
+	cmd := exec.Command(bin)
+	cmd.Dir = dir
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	cmd.Env = append(os.Environ(), exampleEnv(s.Endpoint, name, ex.Env)...)
+	if err := cmd.Start(); err != nil {
+		out.Err = fmt.Errorf("start: %w", err)
+		return out
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	defer stopProcess(cmd, exited)
+
+	client := &http.Client{
+		Transport: testrun.NewTransport(http.DefaultTransport, opts.RunID),
+		Timeout:   10 * time.Second,
+	}
+	if err := waitReady(ctx, client, ex.BaseURL+ex.Ready, opts.ReadyTimeout, exited); err != nil {
+		out.Err = err
+		return out
+	}
+
+	runCtx := testrun.ContextWithRun(ctx, opts.RunID)
+	for _, st := range ex.Steps {
+		out.Steps++
+		if err := sendStep(testrun.ContextWithCase(runCtx, name+" "+st.Name), client, ex.BaseURL, st, opts.RunID); err != nil {
+			out.Err = fmt.Errorf("step %q: %w", st.Name, err)
+			return out
+		}
+	}
+
+	missing, spans, err := s.waitForSpans(ctx, name, ex.Spans, opts.SpanTimeout)
+	out.Spans = len(spans)
+	out.Missed = missing
+	if err != nil {
+		out.Err = fmt.Errorf("query sink: %w", err)
+	} else if len(missing) > 0 {
+		out.Received = spanNames(spans)
+		out.Err = fmt.Errorf("%d of %d expected spans not received, %d spans from %s", len(missing), len(ex.Spans), len(spans), name)
+	}
+	return out
+}
+
+func spanNames(spans []receivedSpan) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, sp := range spans {
+		name := fmt.Sprintf("%s (%s)", sp.Name, sp.Kind)
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// exampleEnv points the example's exporters at the sink, names its service
+// after the example, and exports often, so spans reach the sink while the
+// example runs.
+func exampleEnv(endpoint, name string, extra map[string]string) []string {
+	env := []string{
+		"OTEL_EXPORTER_OTLP_ENDPOINT=" + endpoint,
+		"OTEL_EXPORTER_OTLP_HEADERS=",
+		"OTEL_EXPORTER_OTLP_INSECURE=true",
+		"OTEL_SERVICE_NAME=" + name,
+		"OTEL_BSP_SCHEDULE_DELAY=100",
+		"OTEL_METRIC_EXPORT_INTERVAL=1000",
+		"OTEL_TRACES_SAMPLER=always_on",
+	}
+	for key, value := range extra {
+		env = append(env, key+"="+value)
+	}
+	return env
+}
+
+// waitReady polls url until it answers with a status below 500. It fails
+// early if the example exits.
+func waitReady(ctx context.Context, client *http.Client, url string, timeout time.Duration, exited <-chan error) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+	for time.Now().Before(deadline) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode < 500 {
+				return nil
+			}
+			err = fmt.Errorf("status %d", resp.StatusCode)
+		}
+		lastErr = err
+		select {
+		case err := <-exited:
+			return fmt.Errorf("exited before ready: %v", err)
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("not ready after %s: %v", timeout, lastErr)
+}
+
+func sendStep(ctx context.Context, client *http.Client, baseURL string, st step, runID string) error {
+	var body io.Reader
+	if st.Body != "" {
+		body = strings.NewReader(strings.ReplaceAll(st.Body, "{run}", runID))
+	}
+	req, err := http.NewRequestWithContext(ctx, st.Method, baseURL+st.Path, body)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode != st.Status {
+		return fmt.Errorf("status: want %d, got %d", st.Status, resp.StatusCode)
+	}
+	return nil
+}
+
+// stopProcess interrupts the example, so it can flush its telemetry, and
+// kills it if it hasn't exited after 10 seconds.
+func stopProcess(cmd *exec.Cmd, exited <-chan error) {
+	if err := cmd.Process.Signal(syscall.SIGINT); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		cmd.Process.Kill()
+	}
+	select {
+	case <-exited:
+	case <-time.After(10 * time.Second):
+		cmd.Process.Kill()
+		<-exited
+	}
+}
+
+func composeUp(ctx context.Context, root string, d *deps) error {
+	args := append([]string{"compose", "-f", filepath.Join(root, d.File), "up", "-d", "--wait"}, d.Services...)
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker compose up %s: %w", d.File, err)
+	}
+	return nil
+}
+
+// composeDown removes the containers and volumes of d, so the next run
+// starts from empty databases.
+func composeDown(root string, d *deps) {
+	cmd := exec.Command("docker", "compose", "-f", filepath.Join(root, d.File), "down", "-v")
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Run()
+}
+
+// goBuild builds the main package pkg of the module in dir to out.
+func goBuild(ctx context.Context, dir, pkg, out string) error {
+	if pkg == "" {
+		pkg = "."
+	}
+	if pkg != "." {
+		pkg = "./" + pkg
+	}
+	cmd := exec.CommandContext(ctx, "go", "build", "-o", out, pkg)
+	cmd.Dir = dir
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%w\n%s", err, output)
+	}
+	return nil
+}
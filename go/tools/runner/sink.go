@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// sink is a running otlpsink, started by the runner on a free port.
+type sink struct {
+	cmd *exec.Cmd
+	// Endpoint is the base URL to export OTLP to, over HTTP or gRPC.
+	Endpoint string
+}
+
+// startSink builds ../otlpsink into binDir and starts it. It returns once
+// the sink is listening.
+func startSink(ctx context.Context, root, binDir string) (*sink, error) {
+	bin := filepath.Join(binDir, "otlpsink")
+	if err := goBuild(ctx, filepath.Join(root, "tools", "otlpsink"), ".", bin); err != nil {
+		return nil, fmt.Errorf("build otlpsink: %w", err)
+	}
+	cmd := exec.Command(bin, "-addr", "localhost:0")
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start otlpsink: %w", err)
+	}
+
+	// The sink prints its address once it is listening
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("otlpsink exited before listening: %w", err)
+	}
+	addr, ok := strings.CutPrefix(strings.TrimSpace(line), "otlpsink listening on ")
+	if !ok {
+		cmd.Process.Kill()
+		return nil, fmt.Errorf("unexpected otlpsink output %q", line)
+	}
+	return &sink{cmd: cmd, Endpoint: "http://" + addr}, nil
+}
+
+func (s *sink) stop() {
+	s.cmd.Process.Signal(os.Interrupt)
+	s.cmd.Wait()
+}
+
+// reset drops everything the sink has received.
+func (s *sink) reset(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, s.Endpoint+"/api/telemetry", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// receivedSpan is a span as the sink's /api/spans returns it.
+type receivedSpan struct {
+	Service    string         `json:"service"`
+	Name       string         `json:"name"`
+	Kind       string         `json:"kind"`
+	TraceID    string         `json:"trace_id"`
+	Status     string         `json:"status"`
+	Attributes map[string]any `json:"attributes"`
+}
+
+func (s *sink) spans(ctx context.Context, service string) ([]receivedSpan, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.Endpoint+"/api/spans?service="+url.QueryEscape(service), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		Spans []receivedSpan `json:"spans"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	return body.Spans, nil
+}
+
+// waitForSpans polls the sink until every expectation is met by a span of
+// service, or timeout passes. It returns the expectations still unmet, and
+// the spans received.
+func (s *sink) waitForSpans(ctx context.Context, service string, want []spanExpectation, timeout time.Duration) ([]spanExpectation, []receivedSpan, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		spans, err := s.spans(ctx, service)
+		if err != nil {
+			return want, nil, err
+		}
+		var missing []spanExpectation
+		for _, exp := range want {
+			if !exp.metBy(spans) {
+				missing = append(missing, exp)
+			}
+		}
+		if len(missing) == 0 || time.Now().After(deadline) {
+			return missing, spans, nil
+		}
+		select {
+		case <-ctx.Done():
+			return missing, spans, ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+func (e spanExpectation) metBy(spans []receivedSpan) bool {
+	for _, sp := range spans {
+		if sp.Name == e.Name && (e.Kind == "" || sp.Kind == e.Kind) && hasAttributes(sp.Attributes, e.Attributes) {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAttributes(got, want map[string]any) bool {
+	for key, w := range want {
+		g, ok := got[key]
+		if !ok {
+			return false
+		}
+		// Compare as JSON, since the sink's numbers decode as float64
+		wj, _ := json.Marshal(w)
+		gj, _ := json.Marshal(g)
+		if string(wj) != string(gj) {
+			return false
+		}
+	}
+	return true
+}
+
+func (e spanExpectation) String() string {
+	s := e.Name
+	if e.Kind != "" {
+		s += " (" + e.Kind + ")"
+	}
+	if len(e.Attributes) > 0 {
+		attrs, _ := json.Marshal(e.Attributes)
+		s += " with " + string(attrs)
+	}
+	return s
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	agent "github.com/last9/go-agent"
+	"github.com/twitchtv/twirp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+	pb "twirp-example/proto"
+	"twirp-example/twirpotel"
+)
+
+const tracerName = "twirp-example/client"
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	// The hooks start a client span per call and inject its context into the
+	// request headers, so the HTTP client isn't instrumented itself
+	client := pb.NewInventoryProtobufClient(
+		getEnv("TWIRP_SERVER_URL", "http://localhost:8080"),
+		&http.Client{Timeout: 5 * time.Second},
+		twirp.WithClientHooks(twirpotel.ClientHooks()),
+	)
+
+	orders, err := strconv.Atoi(getEnv("TWIRP_CLIENT_ORDERS", "1"))
+	if err != nil {
+		log.Fatalf("invalid TWIRP_CLIENT_ORDERS: %v", err)
+	}
+	for range orders {
+		placeOrder(context.Background(), client)
+	}
+}
+
+// placeOrder makes a few calls under one root span, some of which fail on
+// purpose: an unknown item, and a reservation the stock can't cover.
+func placeOrder(ctx context.Context, client pb.Inventory) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "place order")
+	defer span.End()
+	log.Printf("Order trace %s", span.SpanContext().TraceID())
+
+	items, err := client.ListItems(ctx, &pb.ListItemsRequest{})
+	if err != nil {
+		log.Printf("ListItems: %v", err)
+		return
+	}
+	for _, item := range items.Items {
+		log.Printf("  %s %-8s stock=%d", item.Sku, item.Name, item.Stock)
+	}
+
+	if _, err := client.GetItem(ctx, &pb.GetItemRequest{Sku: "sku-9"}); err != nil {
+		log.Printf("GetItem sku-9: %v", err)
+	}
+
+	for _, req := range []*pb.ReserveRequest{
+		{Sku: "sku-1", Quantity: 2},
+		{Sku: "sku-3", Quantity: 1},
+	} {
+		resp, err := client.Reserve(ctx, req)
+		if err != nil {
+			log.Printf("Reserve %s: %v", req.Sku, err)
+			continue
+		}
+		log.Printf("Reserve %s: %s, %d left", req.Sku, resp.ReservationId, resp.Remaining)
+	}
+	trace.SpanFromContext(ctx).AddEvent("order placed")
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
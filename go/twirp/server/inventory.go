@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/twitchtv/twirp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	pb "twirp-example/proto"
+)
+
+const tracerName = "twirp-example/server"
+
+// inventory implements pb.Inventory, in memory.
+type inventory struct {
+	// failRate is the fraction of reservations that fail with an error that
+	// isn't a twirp.Error, which Twirp answers as an internal error
+	failRate float64
+
+	mu           sync.Mutex
+	items        map[string]*pb.Item
+	reservations atomic.Int64
+}
+
+func newInventory(failRate float64) *inventory {
+	return &inventory{failRate: failRate, items: map[string]*pb.Item{
+		"sku-1": {Sku: "sku-1", Name: "Mug", Stock: 10},
+		"sku-2": {Sku: "sku-2", Name: "Notebook", Stock: 3},
+		"sku-3": {Sku: "sku-3", Name: "Pen", Stock: 0},
+	}}
+}
+
+func (s *inventory) GetItem(_ context.Context, req *pb.GetItemRequest) (*pb.Item, error) {
+	if req.Sku == "" {
+		return nil, twirp.RequiredArgumentError("sku")
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[req.Sku]
+	if !ok {
+		return nil, twirp.NotFoundError("no item with sku " + req.Sku)
+	}
+	return &pb.Item{Sku: item.Sku, Name: item.Name, Stock: item.Stock}, nil
+}
+
+func (s *inventory) ListItems(context.Context, *pb.ListItemsRequest) (*pb.ListItemsResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	resp := &pb.ListItemsResponse{}
+	for _, item := range s.items {
+		resp.Items = append(resp.Items, &pb.Item{Sku: item.Sku, Name: item.Name, Stock: item.Stock})
+	}
+	sort.Slice(resp.Items, func(i, j int) bool { return resp.Items[i].Sku < resp.Items[j].Sku })
+	return resp, nil
+}
+
+func (s *inventory) Reserve(ctx context.Context, req *pb.ReserveRequest) (*pb.ReserveResponse, error) {
+	if req.Quantity <= 0 {
+		return nil, twirp.InvalidArgumentError("quantity", "must be positive")
+	}
+	// The handler's context carries the server span, so its spans are
+	// children of it
+	trace.SpanFromContext(ctx).SetAttributes(
+		attribute.String("inventory.sku", req.Sku),
+		attribute.Int("inventory.quantity", int(req.Quantity)),
+	)
+	_, span := otel.Tracer(tracerName).Start(ctx, "update stock")
+	defer span.End()
+	time.Sleep(time.Duration(10+rand.IntN(40)) * time.Millisecond)
+	if rand.Float64() < s.failRate {
+		err := errors.New("stock store: connection reset by peer")
+		span.RecordError(err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[req.Sku]
+	if !ok {
+		return nil, twirp.NotFoundError("no item with sku " + req.Sku)
+	}
+	if item.Stock < req.Quantity {
+		return nil, twirp.NewError(twirp.FailedPrecondition, "insufficient stock").
+			WithMeta("stock", strconv.Itoa(int(item.Stock)))
+	}
+	item.Stock -= req.Quantity
+	return &pb.ReserveResponse{
+		ReservationId: fmt.Sprintf("res-%d", s.reservations.Add(1)),
+		Remaining:     item.Stock,
+	}, nil
+}
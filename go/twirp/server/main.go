@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	agent "github.com/last9/go-agent"
+	"github.com/twitchtv/twirp"
+	pb "twirp-example/proto"
+	"twirp-example/twirpotel"
+)
+
+func main() {
+	// Initialize go-agent (automatic OpenTelemetry setup)
+	agent.Start()
+	defer agent.Shutdown()
+
+	log.Println("✓ go-agent initialized")
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failRate, _ := strconv.ParseFloat(os.Getenv("TWIRP_FAIL_RATE"), 64)
+
+	// The hooks start a server span per call, so the handler isn't wrapped in
+	// HTTP instrumentation: every call is a POST, and the span would be
+	// named the same for all of them
+	handler := pb.NewInventoryServer(newInventory(failRate),
+		twirp.WithServerHooks(twirpotel.ServerHooks()))
+
+	mux := http.NewServeMux()
+	mux.Handle(handler.PathPrefix(), twirpotel.WithTraceContext(handler))
+
+	srv := &http.Server{
+		Addr:              ":" + getEnv("PORT", "8080"),
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+	log.Printf("✓ Twirp server running on %s%s", srv.Addr, handler.PathPrefix())
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("failed to shut down server: %v", err)
+	}
+}
+
+func getEnv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
@@ -0,0 +1,194 @@
+// Package twirpotel traces Twirp services with Twirp's own hooks: a server
+// span per call from ServerHooks, and a client span per call from
+// ClientHooks, with the trace context carried in the HTTP headers.
+//
+// Twirp's server hooks don't see the HTTP request, so the caller's trace
+// context is extracted by WithTraceContext, around the Twirp handler:
+//
+//	handler := pb.NewInventoryServer(svc, twirp.WithServerHooks(twirpotel.ServerHooks()))
+//	http.ListenAndServe(":8080", twirpotel.WithTraceContext(handler))
+//
+//	client := pb.NewInventoryProtobufClient(url, http.DefaultClient,
+//		twirp.WithClientHooks(twirpotel.ClientHooks()))
+package twirpotel
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/twitchtv/twirp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.37.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope of the spans.
+const ScopeName = "twirp-example/twirpotel"
+
+// ErrorCodeKey is the Twirp error code a call failed with, such as
+// not_found.
+const ErrorCodeKey = attribute.Key("rpc.twirp.error_code")
+
+// otherMethod is the rpc.method of a request no method was routed to.
+const otherMethod = "_OTHER"
+
+// rpcSystem is the rpc.system of Twirp. The semconv package has no constant
+// for it.
+var rpcSystem = semconv.RPCSystemKey.String("twirp")
+
+// spanKey holds the span the hooks started, so a hook never ends a span it
+// didn't start, such as the caller's when a client call fails before its
+// request is prepared.
+type spanKey struct{}
+
+func withSpan(ctx context.Context, span trace.Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+func spanFrom(ctx context.Context) (trace.Span, bool) {
+	span, ok := ctx.Value(spanKey{}).(trace.Span)
+	return span, ok
+}
+
+// WithTraceContext extracts the caller's trace context from the request
+// headers, so the server span ServerHooks starts continues the caller's
+// trace.
+func WithTraceContext(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// ServerHooks returns hooks that trace each call to a Twirp server with a
+// server span named {package}.{Service}/{Method}.
+//
+// The span starts when the request is received, before Twirp routes it, so
+// requests that fail routing are traced too, with rpc.method _OTHER.
+func ServerHooks() *twirp.ServerHooks {
+	tracer := otel.Tracer(ScopeName)
+	return &twirp.ServerHooks{
+		RequestReceived: func(ctx context.Context) (context.Context, error) {
+			service := serviceName(ctx)
+			ctx, span := tracer.Start(ctx, service+"/"+otherMethod,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					rpcSystem,
+					semconv.RPCService(service),
+					semconv.RPCMethod(otherMethod),
+				))
+			return withSpan(ctx, span), nil
+		},
+		RequestRouted: func(ctx context.Context) (context.Context, error) {
+			if span, ok := spanFrom(ctx); ok {
+				method, _ := twirp.MethodName(ctx)
+				span.SetName(serviceName(ctx) + "/" + method)
+				span.SetAttributes(semconv.RPCMethod(method))
+			}
+			return ctx, nil
+		},
+		Error: func(ctx context.Context, twerr twirp.Error) context.Context {
+			if span, ok := spanFrom(ctx); ok {
+				recordError(span, twerr, serverFault(twerr.Code()))
+			}
+			return ctx
+		},
+		ResponseSent: func(ctx context.Context) {
+			span, ok := spanFrom(ctx)
+			if !ok {
+				return
+			}
+			if status, ok := twirp.StatusCode(ctx); ok {
+				if code, err := strconv.Atoi(status); err == nil {
+					span.SetAttributes(semconv.HTTPResponseStatusCode(code))
+				}
+			}
+			span.End()
+		},
+	}
+}
+
+// ClientHooks returns hooks that trace each call from a Twirp client with a
+// client span named {package}.{Service}/{Method}, and inject its context
+// into the request headers.
+func ClientHooks() *twirp.ClientHooks {
+	tracer := otel.Tracer(ScopeName)
+	return &twirp.ClientHooks{
+		RequestPrepared: func(ctx context.Context, req *http.Request) (context.Context, error) {
+			service := serviceName(ctx)
+			method, _ := twirp.MethodName(ctx)
+			attrs := []attribute.KeyValue{
+				rpcSystem,
+				semconv.RPCService(service),
+				semconv.RPCMethod(method),
+				semconv.ServerAddress(req.URL.Hostname()),
+			}
+			if port, err := strconv.Atoi(req.URL.Port()); err == nil {
+				attrs = append(attrs, semconv.ServerPort(port))
+			}
+			ctx, span := tracer.Start(ctx, service+"/"+method,
+				trace.WithSpanKind(trace.SpanKindClient),
+				trace.WithAttributes(attrs...))
+			otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+			return withSpan(ctx, span), nil
+		},
+		ResponseReceived: func(ctx context.Context) {
+			if span, ok := spanFrom(ctx); ok {
+				span.End()
+			}
+		},
+		Error: func(ctx context.Context, twerr twirp.Error) {
+			if span, ok := spanFrom(ctx); ok {
+				// The call failed, whoever is to blame
+				recordError(span, twerr, true)
+				span.End()
+			}
+		},
+	}
+}
+
+// recordError sets the error attributes of twerr on span. Only faults set the
+// span status to Error and record the error, with the cause of an internal
+// error if it wraps one.
+func recordError(span trace.Span, twerr twirp.Error, fault bool) {
+	span.SetAttributes(
+		ErrorCodeKey.String(string(twerr.Code())),
+		semconv.ErrorTypeKey.String(string(twerr.Code())),
+	)
+	if !fault {
+		return
+	}
+	var err error = twerr
+	if cause := errors.Unwrap(twerr); cause != nil {
+		err = cause
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, twerr.Msg())
+}
+
+// serverFault reports whether code means the server failed, rather than the
+// client or the request. Only those set the server span status to Error, the
+// way the gRPC conventions treat the matching gRPC codes.
+func serverFault(code twirp.ErrorCode) bool {
+	switch code {
+	case twirp.Unknown, twirp.DeadlineExceeded, twirp.Unimplemented,
+		twirp.Internal, twirp.Unavailable, twirp.DataLoss:
+		return true
+	}
+	return false
+}
+
+// serviceName is the fully qualified service of a call, such as
+// inventory.Inventory.
+func serviceName(ctx context.Context) string {
+	service, _ := twirp.ServiceName(ctx)
+	if pkg, ok := twirp.PackageName(ctx); ok && pkg != "" {
+		return pkg + "." + service
+	}
+	return service
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/testrun"
+	"github.com/last9/opentelemetry-examples/go/common/users/contract"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+func initTracer(ctx context.Context) (func(context.Context) error, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("create OTLP exporter: %w", err)
+	}
+
+	// resource.Default() reads OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES
+	res, err := resource.Merge(resource.Default(), resource.Empty())
+	if err != nil {
+		return nil, fmt.Errorf("merge resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	// Baggage carries test.run_id and test.case.name to the provider
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	return tp.Shutdown, nil
+}
+
+func getenv(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func main() {
+	os.Exit(run())
+}
+
+// run verifies the provider and returns the exit code: 1 if any
+// interaction failed.
+func run() int {
+	ctx := context.Background()
+	shutdown, err := initTracer(ctx)
+	if err != nil {
+		log.Printf("init tracer: %v", err)
+		return 1
+	}
+	defer func() {
+		// Export the spans of a failed run before exiting
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(shutdownCtx); err != nil {
+			log.Printf("tracer shutdown: %v", err)
+		}
+	}()
+
+	baseURL := getenv("USERS_API_URL", "http://localhost:8080")
+	runID := getenv("TEST_RUN_ID", testrun.NewRunID())
+	client := &http.Client{
+		Transport: otelhttp.NewTransport(http.DefaultTransport),
+		Timeout:   10 * time.Second,
+	}
+
+	log.Printf("Verifying %s against %s (test.run_id=%s)", contract.SuiteName, baseURL, runID)
+	results := contract.NewVerifier(baseURL, client, runID).Verify(ctx)
+
+	failed := 0
+	for _, r := range results {
+		if r.Passed {
+			fmt.Printf("✓ %s\n", r.Interaction)
+			continue
+		}
+		failed++
+		fmt.Printf("✗ %s: %v\n    trace_id=%s span_id=%s\n", r.Interaction, r.Err, r.TraceID, r.SpanID)
+	}
+	fmt.Printf("\n%d passed, %d failed (test.run_id=%s)\n", len(results)-failed, failed, runID)
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
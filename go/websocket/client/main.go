@@ -0,0 +1,140 @@
+// Package main is a WebSocket chat client that sends a few messages and
+// prints the broadcasts it receives back. Each send starts a new trace that
+// continues through the server and into the broadcast received here.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/last9/opentelemetry-examples/go/websocket/last9"
+)
+
+const channel = "chat"
+
+func main() {
+	ctx := context.Background()
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "websocket-client"
+	}
+	inst := last9.NewInstrumentation(ctx, serviceName)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := inst.Shutdown(shutdownCtx); err != nil {
+			log.Printf("telemetry shutdown: %v", err)
+		}
+	}()
+
+	url := os.Getenv("WEBSOCKET_URL")
+	if url == "" {
+		url = "ws://localhost:8080/ws"
+	}
+
+	conn, err := dial(ctx, url)
+	if err != nil {
+		log.Fatalf("dial %s: %v", url, err)
+	}
+	defer conn.Close()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		receive(conn)
+	}()
+
+	for i := 1; i <= 5; i++ {
+		if err := send(ctx, conn, fmt.Sprintf("hello #%d", i)); err != nil {
+			log.Printf("send: %v", err)
+		}
+		time.Sleep(time.Second)
+	}
+
+	conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+	}
+}
+
+// dial opens the socket inside a client span and sends its traceparent on the
+// handshake request so the server's upgrade span joins the same trace.
+func dial(ctx context.Context, url string) (*websocket.Conn, error) {
+	ctx, span := last9.Tracer().Start(ctx, "websocket.connect",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("url.full", url)),
+	)
+	defer span.End()
+
+	header := http.Header{}
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(header))
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, url, header)
+	if err != nil {
+		last9.RecordError(span, err)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// send publishes a chat message. The producer span is the root of the trace
+// and its context rides along in the envelope.
+func send(ctx context.Context, conn *websocket.Conn, text string) error {
+	payload, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	ctx, span := last9.StartProducerSpan(ctx, channel, len(payload))
+	defer span.End()
+
+	env := last9.Envelope{Type: "message", Payload: payload}
+	env.Inject(ctx)
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		last9.RecordError(span, err)
+		return err
+	}
+	if err := conn.WriteMessage(websocket.TextMessage, data); err != nil {
+		last9.RecordError(span, err)
+		return err
+	}
+	return nil
+}
+
+// receive reads broadcasts until the connection closes, recording a consumer
+// span for each one under the trace the server propagated.
+func receive(conn *websocket.Conn) {
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var env last9.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			log.Printf("invalid envelope: %v", err)
+			continue
+		}
+
+		_, span := last9.StartConsumerSpan(env.Extract(context.Background()), channel, len(env.Payload),
+			attribute.String("websocket.message.type", env.Type),
+		)
+		log.Printf("%s from %s: %s", env.Type, env.From, env.Payload)
+		span.End()
+	}
+}
@@ -0,0 +1,84 @@
+package last9
+
+import (
+	"context"
+	"encoding/json"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope used for all WebSocket spans.
+const ScopeName = "github.com/last9/opentelemetry-examples/go/websocket"
+
+// MessagingSystem is the messaging.system value recorded on message spans.
+const MessagingSystem = "websocket"
+
+// Envelope is the JSON frame exchanged over the socket. WebSocket frames have
+// no headers, so the W3C trace context travels inside the envelope instead.
+type Envelope struct {
+	Type    string            `json:"type"`
+	From    string            `json:"from,omitempty"`
+	Payload json.RawMessage   `json:"payload"`
+	Trace   map[string]string `json:"trace,omitempty"`
+}
+
+// Inject writes the trace context from ctx into the envelope.
+func (e *Envelope) Inject(ctx context.Context) {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	e.Trace = carrier
+}
+
+// Extract returns ctx enriched with the trace context carried by the envelope.
+func (e *Envelope) Extract(ctx context.Context) context.Context {
+	if len(e.Trace) == 0 {
+		return ctx
+	}
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(e.Trace))
+}
+
+// Tracer returns the tracer used for WebSocket spans.
+func Tracer() trace.Tracer {
+	return otel.Tracer(ScopeName)
+}
+
+// StartProducerSpan starts a span for sending a message on channel. The
+// returned context should be injected into the outgoing envelope.
+func StartProducerSpan(ctx context.Context, channel string, size int, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(messageAttributes(channel, size), attrs...)
+	return Tracer().Start(ctx, "publish "+channel,
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(semconv.MessagingOperationTypePublish),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// StartConsumerSpan starts a span for a message received on channel. ctx
+// should already carry the context extracted from the envelope.
+func StartConsumerSpan(ctx context.Context, channel string, size int, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(messageAttributes(channel, size), attrs...)
+	return Tracer().Start(ctx, "receive "+channel,
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(semconv.MessagingOperationTypeReceive),
+		trace.WithAttributes(attrs...),
+	)
+}
+
+// RecordError marks the span as failed.
+func RecordError(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+func messageAttributes(channel string, size int) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		semconv.MessagingSystemKey.String(MessagingSystem),
+		semconv.MessagingDestinationName(channel),
+		semconv.MessagingMessageBodySize(size),
+	}
+}
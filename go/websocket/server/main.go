@@ -0,0 +1,279 @@
+// Package main runs a WebSocket chat server instrumented with OpenTelemetry.
+//
+// Each connection produces a span for the upgrade handshake. Every inbound
+// message produces a consumer span whose parent is extracted from the JSON
+// envelope, and each broadcast to a connected client produces a producer
+// span, so client -> server -> broadcast shows up as a single trace.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/last9/opentelemetry-examples/go/websocket/last9"
+)
+
+const channel = "chat"
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Allow any origin for the demo. Restrict this in production.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// client is a single connected socket. Writes go through send so that only
+// the writePump goroutine writes to the connection.
+type client struct {
+	id   string
+	conn *websocket.Conn
+	send chan []byte
+}
+
+// hub tracks connected clients and fans messages out to them.
+type hub struct {
+	mu      sync.RWMutex
+	clients map[*client]struct{}
+
+	messages    metric.Int64Counter
+	messageSize metric.Int64Histogram
+	connections metric.Int64UpDownCounter
+}
+
+func newHub() *hub {
+	meter := otel.Meter(last9.ScopeName)
+
+	messages, err := meter.Int64Counter("websocket.messages",
+		metric.WithDescription("Number of WebSocket messages sent and received"),
+		metric.WithUnit("{message}"))
+	if err != nil {
+		log.Fatalf("failed to create messages counter: %v", err)
+	}
+	messageSize, err := meter.Int64Histogram("websocket.message.size",
+		metric.WithDescription("Size of WebSocket message payloads"),
+		metric.WithUnit("By"))
+	if err != nil {
+		log.Fatalf("failed to create message size histogram: %v", err)
+	}
+	connections, err := meter.Int64UpDownCounter("websocket.connections.active",
+		metric.WithDescription("Number of open WebSocket connections"),
+		metric.WithUnit("{connection}"))
+	if err != nil {
+		log.Fatalf("failed to create connections counter: %v", err)
+	}
+
+	return &hub{
+		clients:     make(map[*client]struct{}),
+		messages:    messages,
+		messageSize: messageSize,
+		connections: connections,
+	}
+}
+
+func (h *hub) register(ctx context.Context, c *client) {
+	h.mu.Lock()
+	h.clients[c] = struct{}{}
+	h.mu.Unlock()
+	h.connections.Add(ctx, 1)
+}
+
+func (h *hub) unregister(ctx context.Context, c *client) {
+	h.mu.Lock()
+	if _, ok := h.clients[c]; ok {
+		delete(h.clients, c)
+		close(c.send)
+	}
+	h.mu.Unlock()
+	h.connections.Add(ctx, -1)
+}
+
+// broadcast sends env to every connected client. Each delivery gets its own
+// producer span, a child of the consumer span that received the message.
+func (h *hub) broadcast(ctx context.Context, env last9.Envelope) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for c := range h.clients {
+		out := env
+		out.Type = "broadcast"
+
+		pctx, span := last9.StartProducerSpan(ctx, channel, len(out.Payload),
+			attribute.String("websocket.client.id", c.id))
+		out.Inject(pctx)
+
+		data, err := json.Marshal(out)
+		if err != nil {
+			last9.RecordError(span, err)
+			span.End()
+			continue
+		}
+
+		select {
+		case c.send <- data:
+			h.record(pctx, "send", len(out.Payload))
+		default:
+			// The client is not draining its queue; drop rather than block
+			// every other subscriber.
+			span.SetStatus(codes.Error, "send buffer full")
+			span.SetAttributes(attribute.Bool("websocket.message.dropped", true))
+		}
+		span.End()
+	}
+}
+
+func (h *hub) record(ctx context.Context, direction string, size int) {
+	attrs := metric.WithAttributes(
+		attribute.String("websocket.direction", direction),
+		semconv.MessagingDestinationName(channel),
+	)
+	h.messages.Add(ctx, 1, attrs)
+	h.messageSize.Record(ctx, int64(size), attrs)
+}
+
+// serveWS upgrades the connection inside a server span. The client may send
+// traceparent on the handshake request, linking the connect to its trace.
+func (h *hub) serveWS(w http.ResponseWriter, r *http.Request) {
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	ctx, span := last9.Tracer().Start(ctx, "websocket.upgrade",
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(r.Method),
+			semconv.URLPath(r.URL.Path),
+			semconv.ClientAddress(r.RemoteAddr),
+			semconv.UserAgentOriginal(r.UserAgent()),
+		),
+	)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already written an HTTP error response.
+		last9.RecordError(span, err)
+		span.End()
+		return
+	}
+
+	c := &client{
+		id:   r.RemoteAddr,
+		conn: conn,
+		send: make(chan []byte, 16),
+	}
+	span.SetAttributes(
+		semconv.HTTPResponseStatusCode(http.StatusSwitchingProtocols),
+		attribute.String("websocket.client.id", c.id),
+	)
+	span.End()
+
+	h.register(ctx, c)
+	go c.writePump()
+	h.readPump(c)
+}
+
+// readPump handles inbound messages until the connection closes. The
+// connection itself is not a span: a socket can stay open for hours, so each
+// message carries its own trace context instead.
+func (h *hub) readPump(c *client) {
+	defer func() {
+		h.unregister(context.Background(), c)
+		c.conn.Close()
+	}()
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("read error from %s: %v", c.id, err)
+			}
+			return
+		}
+
+		var env last9.Envelope
+		if err := json.Unmarshal(data, &env); err != nil {
+			_, span := last9.StartConsumerSpan(context.Background(), channel, len(data),
+				attribute.String("websocket.client.id", c.id))
+			last9.RecordError(span, err)
+			span.End()
+			continue
+		}
+
+		ctx, span := last9.StartConsumerSpan(env.Extract(context.Background()), channel, len(env.Payload),
+			attribute.String("websocket.client.id", c.id),
+			attribute.String("websocket.message.type", env.Type),
+		)
+		h.record(ctx, "receive", len(env.Payload))
+
+		env.From = c.id
+		h.broadcast(ctx, env)
+		span.End()
+	}
+}
+
+func (c *client) writePump() {
+	for data := range c.send {
+		c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+		if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+			log.Printf("write error to %s: %v", c.id, err)
+			return
+		}
+	}
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "websocket-server"
+	}
+	inst := last9.NewInstrumentation(ctx, serviceName)
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := inst.Shutdown(shutdownCtx); err != nil {
+			log.Printf("telemetry shutdown: %v", err)
+		}
+	}()
+
+	h := newHub()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", h.serveWS)
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+
+	addr := ":8080"
+	if port := os.Getenv("PORT"); port != "" {
+		addr = ":" + port
+	}
+	srv := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		log.Printf("WebSocket server listening on ws://localhost%s/ws", addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalf("server failed: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	srv.Shutdown(shutdownCtx)
+}
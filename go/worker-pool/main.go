@@ -0,0 +1,144 @@
+// Worker pool that writes a crash report naming the traces it was working on
+// when a job panics or the process is aborted, so a crash can be matched to
+// its traces in Last9.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/crashreport"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func main() {
+	ctx := context.Background()
+	tp, err := initTracerProvider(ctx)
+	if err != nil {
+		log.Fatalf("failed to initialize tracing: %v", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("failed to shut down tracer provider: %v", err)
+		}
+	}()
+
+	crash, err := crashreport.Register(tp, crashreport.Config{
+		Size: envInt("CRASH_REPORT_TRACES", crashreport.DefaultSize),
+		Dir:  os.Getenv("CRASH_REPORT_DIR"),
+		OnReport: func(path string, r crashreport.Report) {
+			log.Printf("crash report written to %s (reason=%s trace_id=%s)", path, r.Reason, r.TraceID)
+		},
+	})
+	if err != nil {
+		log.Fatalf("failed to register crash handler: %v", err)
+	}
+	stopWatching := crash.WatchSignals()
+	defer stopWatching()
+
+	workers := newPool(envInt("WORKERS", 4), envInt("QUEUE_SIZE", 100), crash)
+
+	var nextID atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /jobs", func(w http.ResponseWriter, r *http.Request) {
+		kind := r.URL.Query().Get("kind")
+		if kind == "" {
+			kind = "thumbnail"
+		}
+		sc := trace.SpanContextFromContext(r.Context())
+		j := job{
+			id:       nextID.Add(1),
+			kind:     kind,
+			crash:    r.URL.Query().Get("crash") == "true",
+			enqueued: sc,
+		}
+		if !workers.enqueue(j) {
+			http.Error(w, "queue full", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]any{"job_id": j.id, "trace_id": sc.TraceID().String()})
+	})
+
+	addr := ":" + envOr("PORT", "8080")
+	srv := &http.Server{Addr: addr, Handler: otelhttp.NewHandler(mux, "worker-pool")}
+	go func() {
+		log.Printf("worker pool listening on %s", addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("server error: %v", err)
+		}
+	}()
+
+	// SIGINT and SIGTERM shut down cleanly; SIGABRT and SIGQUIT are left to
+	// the crash handler
+	sigCtx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-sigCtx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("server shutdown: %v", err)
+	}
+	workers.close()
+}
+
+func initTracerProvider(ctx context.Context) (*sdktrace.TracerProvider, error) {
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := resource.New(ctx,
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithProcess(),
+		resource.WithHost(),
+		resource.WithAttributes(
+			semconv.ServiceName(envOr("OTEL_SERVICE_NAME", "worker-pool")),
+			semconv.DeploymentEnvironment(envOr("DEPLOYMENT_ENVIRONMENT", "local")),
+		),
+	)
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+func envInt(key string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(key)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
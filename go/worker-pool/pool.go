@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/last9/opentelemetry-examples/go/common/crashreport"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/last9/opentelemetry-examples/go/worker-pool")
+
+// job is a unit of work queued by POST /jobs.
+type job struct {
+	id   int64
+	kind string
+	// crash makes the job panic, to demonstrate the crash report
+	crash bool
+	// enqueued links the job's trace to the request that queued it
+	enqueued trace.SpanContext
+}
+
+// pool runs jobs on a fixed number of workers. Every worker goroutine is
+// started through the crash handler, so a panic in a job writes a crash
+// report before it takes the process down.
+type pool struct {
+	jobs  chan job
+	crash *crashreport.Handler
+	wg    sync.WaitGroup
+}
+
+func newPool(workers, queue int, crash *crashreport.Handler) *pool {
+	p := &pool{jobs: make(chan job, queue), crash: crash}
+	for i := 0; i < workers; i++ {
+		p.wg.Add(1)
+		crash.Go(context.Background(), func(ctx context.Context) {
+			defer p.wg.Done()
+			for j := range p.jobs {
+				p.process(ctx, j)
+			}
+		})
+	}
+	return p
+}
+
+// enqueue queues j, or returns false if the queue is full.
+func (p *pool) enqueue(j job) bool {
+	select {
+	case p.jobs <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// close stops taking jobs and waits for the queued ones to finish.
+func (p *pool) close() {
+	close(p.jobs)
+	p.wg.Wait()
+}
+
+// process runs a job in its own trace, linked to the request that queued it.
+// Each job is a new root, so the crash report's ring holds one entry per job.
+func (p *pool) process(ctx context.Context, j job) {
+	ctx, span := tracer.Start(ctx, "job.process",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(trace.Link{SpanContext: j.enqueued}),
+		trace.WithAttributes(
+			attribute.Int64("job.id", j.id),
+			attribute.String("job.kind", j.kind),
+		),
+	)
+	defer span.End()
+	// Runs before span.End, so a panic is recorded on this span and the
+	// crash report names this trace. The worker's own Recover then flushes
+	// the ended span and lets the process crash.
+	defer p.crash.Recover(ctx)
+
+	for _, step := range []string{"fetch", "transform", "store"} {
+		if err := p.step(ctx, j, step); err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			return
+		}
+	}
+}
+
+func (p *pool) step(ctx context.Context, j job, name string) error {
+	_, span := tracer.Start(ctx, "job."+name)
+	defer span.End()
+
+	time.Sleep(time.Duration(20+rand.Intn(60)) * time.Millisecond)
+	if name == "transform" && j.crash {
+		// A bug that only shows up for some inputs: writing to a nil map
+		var counts map[string]int
+		counts[j.kind]++
+	}
+	if name == "store" && rand.Intn(20) == 0 {
+		return fmt.Errorf("store %s: write timed out", j.kind)
+	}
+	return nil
+}